@@ -0,0 +1,80 @@
+/*
+Command faulttolerant runs the example job of package
+example/faulttolerant, failing its nodes on purpose along the way.
+
+Usage:
+
+	faulttolerant -etcd http://127.0.0.1:4001 [-tasks 15] [-standbys 2] [-fail-prob 0.05] [-fail-limit 3] [-checkpoint-dir dir]
+
+Every node of the job runs in this process. A node failed on purpose stops as
+if it crashed; a standby node takes its task over from its latest snapshot,
+and a new standby node is started in its place. The job prints its total,
+and exits with status 1 if it isn't the one of a job without failures.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-distributed/meritop/example/faulttolerant"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/faultinject"
+)
+
+func main() {
+	etcdURLs := flag.String("etcd", "http://127.0.0.1:4001", "comma separated etcd URLs")
+	etcdAPI := flag.String("etcd-api", etcdutil.APIv2, "version of the etcd API, v2 or v3")
+	name := flag.String("name", "", "job name, faulttolerant-{unix time} by default")
+	host := flag.String("host", "127.0.0.1", "host the nodes listen on")
+	numOfTasks := flag.Uint64("tasks", 15, "number of tasks")
+	fanout := flag.Uint64("fanout", 2, "fanout of the tree of tasks")
+	numOfEpochs := flag.Uint64("epochs", 10, "number of epochs")
+	numOfStandbys := flag.Int("standbys", 2, "number of standby nodes")
+	checkpointDir := flag.String("checkpoint-dir", "", "directory keeping snapshots, etcd by default")
+	checkpointInterval := flag.Uint64("checkpoint-interval", 1, "epochs between two snapshots of a task")
+	failProb := flag.Float64("fail-prob", 0.05, "probability of a task to fail in any callback")
+	failLimit := flag.Int("fail-limit", 3, "number of failures at most, 0 for no limit")
+	seed := flag.Int64("seed", 0, "seed of the failures, the current time by default")
+	flag.Parse()
+
+	if *name == "" {
+		*name = fmt.Sprintf("faulttolerant-%d", time.Now().Unix())
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
+	logger.Printf("job %s fails with seed %d", *name, *seed)
+
+	total, err := faulttolerant.Run(faulttolerant.Config{
+		Name:               *name,
+		EtcdURLs:           strings.Split(*etcdURLs, ","),
+		EtcdAPI:            *etcdAPI,
+		Host:               *host,
+		NumOfTasks:         *numOfTasks,
+		Fanout:             *fanout,
+		NumOfEpochs:        *numOfEpochs,
+		NumOfStandbys:      *numOfStandbys,
+		CheckpointDir:      *checkpointDir,
+		CheckpointInterval: *checkpointInterval,
+		Faults: faultinject.NewSchedule(*seed, faultinject.Fault{
+			Probability: *failProb,
+			Limit:       *failLimit,
+		}),
+		Logger: logger,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "faulttolerant: %v\n", err)
+		os.Exit(1)
+	}
+	want := faulttolerant.Want(*numOfTasks, *numOfEpochs)
+	fmt.Printf("job %s finished with total %d, want %d\n", *name, total, want)
+	if total != want {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Command meritop-agent runs on every machine of a cluster, and starts
+meritop-worker for the jobs which need nodes. It watches etcd for jobs with a
+job spec and free tasks, i.e. tasks no node has run yet or which failed, and
+starts a worker for each of them, up to the capacity of the machine. Workers
+take their application from the job spec, see meritop-controller.
+
+Usage:
+
+	meritop-agent -host 10.0.0.5 [-etcd http://127.0.0.1:4001] [-capacity 4] [-worker meritop-worker] [-- worker options]
+
+Workers serve the other nodes on -host, at ports of their own. The options
+after "--" are passed to every worker, e.g. -- -compression snappy.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func main() {
+	etcdURLs := flag.String("etcd", "http://127.0.0.1:4001", "comma separated etcd URLs")
+	etcdAPI := flag.String("etcd-api", etcdutil.APIv2, "version of the etcd API, v2 or v3")
+	host := flag.String("host", "127.0.0.1", "host the workers serve the other nodes on")
+	worker := flag.String("worker", "meritop-worker", "path of the worker binary")
+	capacity := flag.Int("capacity", 1, "workers running on the machine at most")
+	interval := flag.Duration("interval", 5*time.Second, "interval of looking for jobs needing nodes")
+	grace := flag.Duration("grace", 30*time.Second, "time a worker has to take a task before the agent starts another for the job")
+	flag.Parse()
+
+	client, err := etcdutil.NewCoordinator(*etcdAPI, strings.Split(*etcdURLs, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	a := &agent{
+		client: client,
+		worker: *worker,
+		args: append([]string{
+			"-etcd", *etcdURLs,
+			"-etcd-api", *etcdAPI,
+			"-listen", net.JoinHostPort(*host, "0"),
+		}, flag.Args()...),
+		capacity: *capacity,
+		grace:    *grace,
+		running:  make(map[string][]*launch),
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if err := a.poll(); err != nil {
+			log.Printf("meritop-agent: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case sig := <-signals:
+			log.Printf("meritop-agent: %v, stopping workers", sig)
+			a.stop(sig)
+			return
+		}
+	}
+}
+
+// agent starts workers for the jobs needing nodes.
+type agent struct {
+	client   etcdutil.Coordinator
+	worker   string
+	args     []string
+	capacity int
+	grace    time.Duration
+
+	mu sync.Mutex
+	// running workers by job
+	running map[string][]*launch
+	total   int
+}
+
+// launch is a worker started by the agent.
+type launch struct {
+	cmd *exec.Cmd
+	at  time.Time
+}
+
+// poll starts workers for the free tasks of the jobs, but those that workers
+// started recently may be about to take.
+func (a *agent) poll() error {
+	jobs, err := etcdutil.ListJobs(a.client)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if !a.runnable(job) {
+			continue
+		}
+		free, err := etcdutil.FreeTasks(a.client, job)
+		if err != nil {
+			return err
+		}
+		for n := len(free) - a.starting(job); n > 0; n-- {
+			if !a.start(job) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// runnable tells whether generic workers can run the job: it has a job spec
+// and hasn't finished.
+func (a *agent) runnable(job string) bool {
+	if _, err := etcdutil.GetJobSpec(a.client, job); err != nil {
+		return false
+	}
+	codec, err := etcdutil.GetCodec(a.client, job)
+	if err != nil {
+		return false
+	}
+	ec, err := etcdutil.GetEpochChange(a.client, codec, job)
+	return err == nil && ec.Epoch != etcdutil.ExitEpoch
+}
+
+// starting returns the number of workers of the job started within the grace
+// period, which might not have taken a task yet.
+func (a *agent) starting(job string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, l := range a.running[job] {
+		if time.Since(l.at) < a.grace {
+			n++
+		}
+	}
+	return n
+}
+
+// start starts a worker for the job. It returns false if the machine is at
+// capacity.
+func (a *agent) start(job string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.total >= a.capacity {
+		return false
+	}
+	cmd := exec.Command(a.worker, append(a.args, "-name", job)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Printf("meritop-agent: starting worker of job %s failed: %v", job, err)
+		return true
+	}
+	log.Printf("meritop-agent: started worker %d of job %s", cmd.Process.Pid, job)
+	l := &launch{cmd: cmd, at: time.Now()}
+	a.running[job] = append(a.running[job], l)
+	a.total++
+	go a.wait(job, l)
+	return true
+}
+
+// wait forgets the worker once it exits.
+func (a *agent) wait(job string, l *launch) {
+	err := l.cmd.Wait()
+	log.Printf("meritop-agent: worker %d of job %s exited: %v", l.cmd.Process.Pid, job, err)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ls := a.running[job]
+	for i := range ls {
+		if ls[i] == l {
+			a.running[job] = append(ls[:i], ls[i+1:]...)
+			break
+		}
+	}
+	if len(a.running[job]) == 0 {
+		delete(a.running, job)
+	}
+	a.total--
+}
+
+// stop passes the signal on to the workers.
+func (a *agent) stop(sig os.Signal) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ls := range a.running {
+		for _, l := range ls {
+			l.cmd.Process.Signal(sig)
+		}
+	}
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "meritop-agent: "+format+"\n", v...)
+	os.Exit(1)
+}
@@ -0,0 +1,388 @@
+/*
+Command meritop-controller sets up a job in etcd and supervises it until it
+finishes.
+
+Usage:
+
+	meritop-controller -name job -tasks 16 [-task ps -topology ps -param servers=2 ... -plugin ps.so ... -phase train:10 ... -depends prep -input data=prep/url ...] [-etcd http://127.0.0.1:4001] [-etcd-api v3] [-data-token] [-admin :8080 -admin-token secret] [-epoch-interval 5m] [-kube-image meritop-worker -kube-standbys 2] [-keep]
+	meritop-controller -name job -tasks 4 -embed-etcd 127.0.0.1:4001 [options]
+	meritop-controller -name job -resume [options]
+	meritop-controller -name job -retry [options]
+
+It reports failed tasks so that standby nodes take them over, and serves the
+admin API of the job (see Controller.AdminHandler) and its metrics, if
+-admin is set. The admin token is granted the admin role. Once the job has
+finished, its etcd layout is destroyed unless -keep is set. On SIGINT or
+SIGTERM, it stops supervising and leaves the job as it is.
+
+-task, -topology, -param, -plugin, -phase, -depends and -input make the job
+spec (see etcdutil.JobSpec), which tells meritop-worker nodes what to run
+unless their own flags say otherwise. The hash of a plugin is that of the
+local file unless given. With phases, the job is shut down once the last phase
+is over. With -depends or -input, the job is set up once the jobs it depends
+on have finished, its inputs set to the artifacts they exported.
+
+With -require, tasks only go to nodes which have the resources they require,
+e.g. -require 0-3:gpu=1,memory=16Gi for the first four tasks, as the nodes
+tell with meritop-worker -resources.
+
+With -epoch-interval, the controller advances the epoch on a wall-clock
+schedule, whatever the tasks do, e.g. for streaming jobs aggregating the data
+that arrived during each window.
+
+With -kube-image, the controller runs the nodes of the job itself, in pods of
+the Kubernetes cluster it runs in, or of -kube-server: one pod of the image
+per task, and -kube-standbys pods standing by, which find etcd and the job
+through their environment. Failed pods are replaced while the controller
+fails their tasks over, and the pods are deleted once the job has finished
+(see package kube).
+
+With -mesos, the controller runs the nodes of the job in containers of
+Apache Mesos instead, one per task, which are launched again if they fail,
+and killed once the job has finished (see controller/mesos).
+
+With -embed-etcd, the controller runs etcd itself, serving the v2 API on the
+given address, where the nodes of the job find it with meritop-worker -etcd,
+so that a job runs on one machine without an etcd cluster to set up. -etcd and
+-etcd-api are ignored then. Its data are kept in -embed-etcd-dir, or removed
+once the controller exits. Listen on an address other machines reach for
+nodes elsewhere, e.g. in pods of -kube-image.
+
+With -resume, it supervises a job whose layout is already in etcd, e.g. after
+a previous controller crashed, instead of setting up a new one; the flags of
+the layout are ignored then (see Controller.Resume).
+
+With -retry, it runs again a job which ended without finishing its work,
+reusing the results its tasks recorded, e.g. the items a work queue has
+processed already (see Controller.Retry).
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/controller/mesos"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/kube"
+	"github.com/go-distributed/meritop/pkg/taskplugin"
+)
+
+// kubeInterval is how often the pods of the job are reconciled.
+const kubeInterval = 10 * time.Second
+
+func main() {
+	etcdURLs := flag.String("etcd", "http://127.0.0.1:4001", "comma separated etcd URLs")
+	etcdAPI := flag.String("etcd-api", etcdutil.APIv2, "version of the etcd API, v2 or v3")
+	embedEtcd := flag.String("embed-etcd", "", "address to serve an etcd embedded in the controller on, e.g. 127.0.0.1:4001, instead of using -etcd")
+	embedEtcdDir := flag.String("embed-etcd-dir", "", "directory of the data of the embedded etcd, a temporary one removed on exit if empty")
+	name := flag.String("name", "", "job name")
+	numOfTasks := flag.Uint64("tasks", 0, "number of tasks")
+	seed := flag.Int64("seed", 0, "job-wide seed of randomized topologies, the current time by default")
+	dataToken := flag.Bool("data-token", false, "generate a token authenticating data requests between tasks")
+	admin := flag.String("admin", "", "address serving the admin API and metrics, if any")
+	adminToken := flag.String("admin-token", "", "bearer token of the admin API")
+	task := flag.String("task", "", "registered task builder of the job spec")
+	topology := flag.String("topology", "", "registered topology of the job spec")
+	params := meritop.Params{}
+	flag.Var(params, "param", "name=value param of the job spec; can be repeated")
+	var plugins pluginFlags
+	flag.Var(&plugins, "plugin", "Go plugin of the job spec as path[,sha256=hex][,version=v]; can be repeated")
+	var depends dependsFlags
+	flag.Var(&depends, "depends", "job the job spec depends on; can be repeated")
+	inputs := meritop.Params{}
+	flag.Var(inputs, "input", "param=job/artifact input of the job spec; can be repeated")
+	var phases phaseFlags
+	flag.Var(&phases, "phase", "phase of the job spec as name:epochs[:topology], run in order; can be repeated")
+	config := meritop.Params{}
+	flag.Var(config, "config", "name=value of the job config, e.g. a learning rate, which tasks may change on the fly; can be repeated")
+	keep := flag.Bool("keep", false, "keep the etcd layout of the job once it has finished")
+	resume := flag.Bool("resume", false, "supervise the job already set up in etcd")
+	retry := flag.Bool("retry", false, "run again the work left unfinished by the job, which has ended")
+	requirements := requireFlags{}
+	flag.Var(requirements, "require", "resources tasks require as id[-id]:name=amount,..., e.g. 0-3:gpu=1; can be repeated")
+	epochMaster := flag.Int64("epoch-master", -1, "ID of the only task which may advance the epoch, any if negative")
+	deadline := flag.Duration("deadline", 0, "fail and shut down the job if it is still running this long after the controller starts, no deadline if 0")
+	maxEpochs := flag.Uint64("max-epochs", 0, "fail and shut down the job once it reaches this epoch, no limit if 0")
+	epochInterval := flag.Duration("epoch-interval", 0, "advance the epoch on this schedule, e.g. 5m for streaming jobs; only tasks advance it if 0")
+	kubeImage := flag.String("kube-image", "", "image of meritop-worker to run the tasks in pods of Kubernetes, if any")
+	kubeStandbys := flag.Int("kube-standbys", 0, "standby pods taking over failed tasks")
+	kubeArgs := flag.String("kube-args", "", "space separated flags of the workers in pods or Mesos containers, e.g. \"-compression snappy\"")
+	kubeNamespace := flag.String("kube-namespace", "", "namespace of the pods, that of the controller by default")
+	kubeServer := flag.String("kube-server", "", "URL of the Kubernetes API server, that of the cluster the controller runs in by default")
+	kubeToken := flag.String("kube-token", "", "bearer token of -kube-server")
+	mesosMaster := flag.String("mesos", "", "URL of the Mesos master to run the tasks in containers of, if any")
+	mesosImage := flag.String("mesos-image", "", "Docker image of meritop-worker in Mesos, that installed on the agents if empty")
+	mesosCPUs := flag.Float64("mesos-cpus", 1, "CPUs of each container in Mesos")
+	mesosMem := flag.Float64("mesos-mem", 512, "MB of memory of each container in Mesos")
+	flag.Parse()
+	if *name == "" || *numOfTasks == 0 && !*resume && !*retry {
+		fmt.Fprintf(os.Stderr, "meritop-controller: -name and -tasks are required\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *admin != "" && *adminToken == "" {
+		fatalf("-admin needs -admin-token")
+	}
+
+	if *embedEtcd != "" {
+		e, err := etcdutil.StartEmbeddedEtcd(*embedEtcd, *embedEtcdDir)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		defer e.Stop()
+		atExit = append(atExit, func() { e.Stop() })
+		log.Printf("embedded etcd serves at %s", e.URL())
+		*etcdURLs, *etcdAPI = e.URL(), etcdutil.APIv2
+	}
+	client, err := etcdutil.NewCoordinator(*etcdAPI, strings.Split(*etcdURLs, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	c := controller.New(*name, client, *numOfTasks)
+	if *seed != 0 {
+		c.SetSeed(*seed)
+	}
+	if *task != "" || *topology != "" || len(phases) > 0 || len(depends) > 0 || len(inputs) > 0 {
+		if *task == "" || *topology == "" {
+			fatalf("the job spec needs both -task and -topology")
+		}
+		c.SetJobSpec(etcdutil.JobSpec{Task: *task, Topology: *topology, Params: params, Plugins: plugins, Phases: phases, DependsOn: depends, Inputs: inputs})
+	}
+	if *epochMaster >= 0 {
+		c.SetEpochMaster(uint64(*epochMaster))
+	}
+	if len(requirements) > 0 {
+		c.SetRequirements(requirements)
+	}
+	if *epochInterval > 0 {
+		c.SetEpochInterval(*epochInterval)
+	}
+	if *deadline > 0 {
+		c.SetDeadline(time.Now().Add(*deadline))
+	}
+	if *maxEpochs > 0 {
+		c.SetMaxEpochs(*maxEpochs)
+	}
+	if *dataToken {
+		token, err := etcdutil.NewDataToken()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		c.SetDataToken(token)
+	}
+	if *mesosMaster != "" {
+		s := mesos.NewScheduler(*mesosMaster, "meritop-"+*name)
+		if err := s.Start(); err != nil {
+			fatalf("%v", err)
+		}
+		c.SetResourceManager(s, controller.ContainerSpec{
+			Image:    *mesosImage,
+			Args:     strings.Fields(*kubeArgs),
+			Env:      map[string]string{kube.EnvEtcd: *etcdURLs, kube.EnvEtcdAPI: *etcdAPI},
+			CPUs:     *mesosCPUs,
+			MemoryMB: *mesosMem,
+		})
+	}
+	start := c.Start
+	if *resume {
+		start = c.Resume
+	}
+	if *retry {
+		start = func() error { return c.Retry(true) }
+	}
+	if err := start(); err != nil {
+		fatalf("%v", err)
+	}
+	if len(config) > 0 {
+		if err := c.SetJobConfig(config); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	var placer *kube.Placer
+	placerStop := make(chan struct{})
+	if *kubeImage != "" {
+		status, err := c.Status()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		var client *kube.Client
+		if *kubeServer != "" {
+			client = kube.NewClient(*kubeServer, *kubeNamespace, *kubeToken, nil)
+		} else if client, err = kube.InClusterClient(*kubeNamespace); err != nil {
+			fatalf("%v", err)
+		}
+		placer = kube.NewPlacer(client, kube.Placement{
+			Job:      *name,
+			Tasks:    status.NumOfTasks,
+			Standbys: *kubeStandbys,
+			Image:    *kubeImage,
+			Args:     strings.Fields(*kubeArgs),
+			EtcdURLs: strings.Split(*etcdURLs, ","),
+			EtcdAPI:  *etcdAPI,
+		})
+		go placer.Run(kubeInterval, placerStop)
+	}
+
+	if *admin != "" {
+		c.SetBootstrapAdmin("admin")
+		mux := http.NewServeMux()
+		mux.Handle(controller.AdminPrefix+"/", c.AdminHandler(controller.NewTokenAuthenticator(map[string]string{*adminToken: "admin"})))
+		mux.Handle("/metrics", c.MetricsHandler())
+		go func() {
+			if err := http.ListenAndServe(*admin, mux); err != nil {
+				fatalf("%v", err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	stop := make(chan bool, 1)
+	statusC := c.Subscribe(stop)
+	for {
+		select {
+		case status, ok := <-statusC:
+			if !ok {
+				fatalf("lost the status of job %s", *name)
+			}
+			if !status.Finished() {
+				continue
+			}
+			stop <- true
+			log.Printf("job %s has finished", *name)
+			if r, err := etcdutil.GetJobResult(client, *name); err == nil {
+				log.Printf("job %s finished by task %d with result %q", *name, r.TaskID, r.Result)
+			}
+			failure, err := etcdutil.GetJobFailure(client, *name)
+			if err == nil {
+				log.Printf("job %s failed: %s", *name, failure.Reason)
+			}
+			close(placerStop)
+			if placer != nil {
+				if err := placer.Remove(); err != nil {
+					log.Printf("removing the pods of job %s failed: %v", *name, err)
+				}
+			}
+			if *keep {
+				c.StopSupervising()
+			} else {
+				c.Stop()
+			}
+			if failure != nil {
+				exit(1)
+			}
+			return
+		case sig := <-signals:
+			log.Printf("got %v, leaving job %s as it is", sig, *name)
+			stop <- true
+			close(placerStop)
+			c.StopSupervising()
+			return
+		}
+	}
+}
+
+// pluginFlags are the repeated -plugin flags.
+type pluginFlags []etcdutil.PluginSpec
+
+func (p *pluginFlags) String() string { return fmt.Sprint(*p) }
+
+func (p *pluginFlags) Set(s string) error {
+	spec, err := taskplugin.ParseSpec(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, spec)
+	return nil
+}
+
+// dependsFlags are the repeated -depends flags.
+type dependsFlags []string
+
+func (d *dependsFlags) String() string { return strings.Join(*d, ",") }
+
+func (d *dependsFlags) Set(s string) error {
+	*d = append(*d, s)
+	return nil
+}
+
+// phaseFlags are the repeated -phase flags.
+type phaseFlags []etcdutil.PhaseSpec
+
+func (p *phaseFlags) String() string { return fmt.Sprint(*p) }
+
+func (p *phaseFlags) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return fmt.Errorf("phase %q isn't name:epochs[:topology]", s)
+	}
+	epochs, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || epochs == 0 {
+		return fmt.Errorf("bad epochs of phase %q", s)
+	}
+	spec := etcdutil.PhaseSpec{Name: parts[0], Epochs: epochs}
+	if len(parts) == 3 {
+		spec.Topology = parts[2]
+	}
+	*p = append(*p, spec)
+	return nil
+}
+
+// requireFlags are the resources tasks require, by task ID.
+type requireFlags map[uint64]etcdutil.Resources
+
+func (r requireFlags) String() string { return fmt.Sprint(map[uint64]etcdutil.Resources(r)) }
+
+func (r requireFlags) Set(s string) error {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("requirement %q isn't id[-id]:resources", s)
+	}
+	ids := strings.SplitN(parts[0], "-", 2)
+	first, err := strconv.ParseUint(ids[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad task ID of requirement %q", s)
+	}
+	last := first
+	if len(ids) == 2 {
+		if last, err = strconv.ParseUint(ids[1], 10, 64); err != nil || last < first {
+			return fmt.Errorf("bad task IDs of requirement %q", s)
+		}
+	}
+	res, err := etcdutil.ParseResources(parts[1])
+	if err != nil {
+		return err
+	}
+	for id := first; id <= last; id++ {
+		r[id] = res
+	}
+	return nil
+}
+
+// atExit run before the controller exits, e.g. to stop the embedded etcd,
+// as deferred calls don't run on os.Exit.
+var atExit []func()
+
+func exit(code int) {
+	for i := len(atExit) - 1; i >= 0; i-- {
+		atExit[i]()
+	}
+	os.Exit(code)
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "meritop-controller: "+format+"\n", v...)
+	exit(1)
+}
@@ -0,0 +1,114 @@
+/*
+Command meritop-loadgen runs the tasks of package example/loadgen in this
+process against an etcd cluster, and reports the throughput of the job.
+
+Usage:
+
+	meritop-loadgen [-etcd http://127.0.0.1:4001] [-tasks 16] [-fanout 2] [-bytes 1048576] [-epochs 100] [-compression snappy]
+
+To load a cluster across machines instead, run "meritop-worker -task loadgen
+-topology tree" on them, with a job set up by meritop-controller.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/example/loadgen"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func main() {
+	etcdURLs := flag.String("etcd", "http://127.0.0.1:4001", "comma separated etcd URLs")
+	etcdAPI := flag.String("etcd-api", etcdutil.APIv2, "version of the etcd API, v2 or v3")
+	name := flag.String("name", "", "job name, loadgen-{unix time} by default")
+	numOfTasks := flag.Uint64("tasks", 16, "number of tasks")
+	fanout := flag.Uint64("fanout", 2, "fanout of the tree of tasks")
+	bytes := flag.Int("bytes", 1<<20, "bytes served by every task to its parent at every epoch")
+	numOfEpochs := flag.Uint64("epochs", 100, "number of epochs")
+	compression := flag.String("compression", "", "comma separated encodings of data, e.g. snappy,gzip")
+	flag.Parse()
+	if *name == "" {
+		*name = fmt.Sprintf("loadgen-%d", time.Now().Unix())
+	}
+
+	client, err := etcdutil.NewCoordinator(*etcdAPI, strings.Split(*etcdURLs, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	c := controller.New(*name, client, *numOfTasks)
+	if err := c.Start(); err != nil {
+		fatalf("%v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		start time.Time
+		done  = make(chan struct{})
+	)
+	builder := &loadgen.TaskBuilder{
+		Bytes:       *bytes,
+		NumOfEpochs: *numOfEpochs,
+		EpochDone: func(epoch uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			// Epoch 0 warms up, e.g. connections.
+			if epoch == 0 {
+				start = time.Now()
+			}
+			if epoch == *numOfEpochs {
+				close(done)
+			}
+		},
+	}
+	opts := []framework.Option{framework.WithCoordinator(client)}
+	if *compression != "" {
+		opts = append(opts, framework.WithCompression(strings.Split(*compression, ",")...))
+	}
+	logger := log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile)
+	for i := uint64(0); i < *numOfTasks; i++ {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			fatalf("%v", err)
+		}
+		bootstrap := framework.NewBootStrap(*name, strings.Split(*etcdURLs, ","), ln, logger, opts...)
+		bootstrap.SetTaskBuilder(builder)
+		bootstrap.SetTopology(example.NewTreeTopology(*fanout, *numOfTasks))
+		go bootstrap.Start()
+	}
+
+	<-done
+	mu.Lock()
+	elapsed := time.Since(start)
+	mu.Unlock()
+	// Every task but the root serves its parent at every epoch.
+	moved := float64(*bytes) * float64(*numOfTasks-1) * float64(*numOfEpochs)
+	fmt.Printf("job %s: %d epochs of %d tasks in %v, %.1f epochs/s, %.1f MB/s\n",
+		*name, *numOfEpochs, *numOfTasks, elapsed,
+		float64(*numOfEpochs)/elapsed.Seconds(), moved/elapsed.Seconds()/(1<<20))
+
+	// Let the nodes see the job finish before its layout is gone.
+	stop := make(chan bool, 1)
+	for status := range c.Subscribe(stop) {
+		if status.Finished() {
+			break
+		}
+	}
+	stop <- true
+	c.Stop()
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "meritop-loadgen: "+format+"\n", v...)
+	os.Exit(1)
+}
@@ -0,0 +1,304 @@
+/*
+Command meritop-worker runs a node of a job set up by meritop-controller. The
+application of the job is selected among the registered task builders and
+topologies (see meritop.RegisterTaskBuilder), so that one worker binary runs
+many kinds of jobs.
+
+Usage:
+
+	meritop-worker -name job -task ps -topology ps [-param servers=2 ...] -listen 10.0.0.5:7000 [-etcd http://127.0.0.1:4001] [options]
+	meritop-worker -name job -listen 10.0.0.5:7000 [options]
+	meritop-worker -list
+	meritop-worker -topology tree -param fanout=2 -dot 15 | dot -Tsvg > tree.svg
+
+Without -task or -topology, they come from the job spec that meritop-controller
+keeps in etcd, as do the params not given with -param and the phases of the
+job. The Go plugins of the job spec are loaded first, see package taskplugin.
+With -dot, it checks the topology for the given number of tasks and prints it
+in Graphviz DOT instead, see topoutil.Validate.
+
+The node takes a free task of the job, or stands by until one fails. With
+-standby, it joins the standby pool of the job and only takes over tasks that
+failed or were handed over. With -backup, it runs a backup copy of a
+straggler of a job run with -speculate-after, and exits once the epoch of the
+straggler is over. With -resources, e.g. gpu=1,memory=16Gi, it only takes
+tasks whose requirements set by meritop-controller -require it meets. -listen
+must be reachable by the other nodes. -etcd, -etcd-api, -name and -listen
+default to $MERITOP_ETCD, $MERITOP_ETCD_API, $MERITOP_JOB and $MERITOP_LISTEN,
+as set in the pods of package kube. Run "meritop-worker -help" for the other
+options, which map to the options of framework.NewBootStrap.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/kube"
+	"github.com/go-distributed/meritop/pkg/taskplugin"
+	"github.com/go-distributed/meritop/pkg/topoutil"
+
+	"github.com/go-distributed/meritop/pkg/membudget"
+	"github.com/go-distributed/meritop/pkg/sandbox"
+	"github.com/go-distributed/meritop/pkg/stream"
+	// registered applications
+	_ "github.com/go-distributed/meritop/example"
+	_ "github.com/go-distributed/meritop/example/faulttolerant"
+	_ "github.com/go-distributed/meritop/example/loadgen"
+)
+
+func main() {
+	etcdURLs := flag.String("etcd", envOr(kube.EnvEtcd, "http://127.0.0.1:4001"), "comma separated etcd URLs")
+	etcdAPI := flag.String("etcd-api", envOr(kube.EnvEtcdAPI, etcdutil.APIv2), "version of the etcd API, v2 or v3")
+	name := flag.String("name", os.Getenv(kube.EnvJob), "job name")
+	listen := flag.String("listen", envOr(kube.EnvListen, "127.0.0.1:0"), "address serving the other nodes")
+	task := flag.String("task", "", "registered task builder, from the job spec by default")
+	topology := flag.String("topology", "", "registered topology, from the job spec by default")
+	params := meritop.Params{}
+	flag.Var(params, "param", "name=value param of the task builder and topology; can be repeated")
+	list := flag.Bool("list", false, "list the registered task builders and topologies")
+	dot := flag.Uint64("dot", 0, "check -topology for this many tasks and print it in Graphviz DOT")
+
+	checkpointDir := flag.String("checkpoint-dir", "", "directory keeping snapshots, etcd by default")
+	checkpointInterval := flag.Uint64("checkpoint-interval", 1, "epochs between two snapshots of a task")
+	etcdDataToken := flag.Bool("data-token", false, "authenticate data requests with the token of the job in etcd")
+	compression := flag.String("compression", "", "comma separated encodings of data, e.g. snappy,gzip")
+	streams := flag.Int("streams", 0, "parallel streams of large data responses, one if 0")
+	streamMinSize := flag.Int("stream-min-size", 4<<20, "bytes of data responses sent over parallel streams at least")
+	codecs := flag.String("codecs", "", "comma separated content types of typed data, e.g. application/json; gob, then JSON by default")
+	serveWorkers := flag.Int("serve-workers", 0, "workers serving data requests, one per request if 0")
+	serveBacklog := flag.Int("serve-backlog", 0, "data requests waiting for a serve worker")
+	requestTimeout := flag.Duration("request-timeout", 0, "timeout of data requests, none if 0")
+	dnsMaxTTL := flag.Duration("dns-max-ttl", 0, "resolve the names in the addresses of tasks again after this long at most, and on connection failure; left to the OS if 0")
+	verifyData := flag.Bool("verify-data", false, "fetch data twice and flag divergences, for debugging transports and compression")
+	degraded := flag.Bool("degraded", false, "keep running while etcd can't take writes")
+	standby := flag.Bool("standby", false, "stand by to take over failed tasks only")
+	resources := flag.String("resources", "", "resources of the node as name=amount[Ki|Mi|Gi|Ti],..., e.g. gpu=1,memory=16Gi; only tasks without requirements are taken if empty")
+	speculateAfter := flag.Duration("speculate-after", 0, "time in an epoch after which neighbors with no output get a backup copy, none if 0")
+	backup := flag.Bool("backup", false, "run a backup copy of a straggler instead of a task")
+	memoryBudget := flag.Int64("memory-budget", 0, "bytes of data and results the framework holds at most, no limit if 0")
+	sandboxed := flag.Bool("sandbox", false, "run the task in a child process, restarted from its last snapshot if it crashes")
+	sink := flag.String("sink", "", "URL of the sink of results emitted by tasks, file:///dir or http(s)://...")
+	heartbeatInterval := flag.Duration("heartbeat-interval", 0, "interval of heartbeats, 1s if 0")
+	heartbeatTTL := flag.Duration("heartbeat-ttl", 0, "time after the last heartbeat the node is failed over, 3 intervals if 0")
+	var ttls etcdutil.TTLs
+	flag.DurationVar(&ttls.Address, "address-ttl", 0, "time the claim of a task lasts until the first heartbeat, 3s if 0")
+	flag.DurationVar(&ttls.Standby, "standby-ttl", 0, "time after the last refresh a node leaves the standby pool, 3 heartbeat intervals if 0")
+	flag.DurationVar(&ttls.Meta, "meta-ttl", 0, "time meta flags stay set, until flagged again if 0")
+	flag.DurationVar(&ttls.DeadLetter, "dead-letter-ttl", 0, "time undelivered meta and data are kept, a week if 0")
+	var tlsInfo frameworkhttp.TLSInfo
+	flag.StringVar(&tlsInfo.CertFile, "tls-cert", "", "certificate of the node, enabling TLS between nodes")
+	flag.StringVar(&tlsInfo.KeyFile, "tls-key", "", "key of the certificate of the node")
+	flag.StringVar(&tlsInfo.CAFile, "tls-ca", "", "CA of the certificates of the other nodes")
+	flag.BoolVar(&tlsInfo.ClientCertAuth, "tls-client-auth", false, "require client certificates, i.e. mutual TLS")
+	flag.Parse()
+
+	if *list {
+		fmt.Printf("task builders: %s\ntopologies: %s\n",
+			strings.Join(meritop.TaskBuilders(), ", "), strings.Join(meritop.Topologies(), ", "))
+		return
+	}
+	if *dot > 0 {
+		topo, err := meritop.NewTopology(*topology, *dot, params)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if err := topoutil.Validate(topo, *dot, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "meritop-worker: %v\n", err)
+		}
+		if err := topoutil.WriteDOT(os.Stdout, topo, *dot, 0); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	if *name == "" {
+		fmt.Fprintf(os.Stderr, "meritop-worker: -name is required\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := etcdutil.NewCoordinator(*etcdAPI, strings.Split(*etcdURLs, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	numOfTasks := waitNumOfTasks(client, *name)
+	spec, err := etcdutil.GetJobSpec(client, *name)
+	if err != nil && !etcdutil.IsKeyNotFound(err) {
+		fatalf("job spec of %s: %v", *name, err)
+	}
+	if err := taskplugin.Load(spec.Plugins); err != nil {
+		fatalf("%v", err)
+	}
+	if *task == "" {
+		*task = spec.Task
+	}
+	if *topology == "" {
+		*topology = spec.Topology
+	}
+	for k, v := range spec.Params {
+		if _, ok := params[k]; !ok {
+			params[k] = v
+		}
+	}
+	if *task == "" || *topology == "" {
+		fatalf("job %s has no spec; set -task and -topology", *name)
+	}
+	taskBuilder, err := meritop.NewTaskBuilder(*task, numOfTasks, params)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if sandbox.IsChild() {
+		if err := sandbox.Serve(taskBuilder); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	topo, err := meritop.NewTopology(*topology, numOfTasks, params)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	opts := []framework.Option{
+		framework.WithCoordinator(client),
+		framework.WithCheckpointInterval(*checkpointInterval),
+	}
+	if *checkpointDir != "" {
+		opts = append(opts, framework.WithCheckpointStore(checkpoint.NewFileStore(*checkpointDir)))
+	}
+	if *etcdDataToken {
+		opts = append(opts, framework.WithEtcdDataToken())
+	}
+	if *compression != "" {
+		opts = append(opts, framework.WithCompression(strings.Split(*compression, ",")...))
+	}
+	if *streams > 1 {
+		opts = append(opts, framework.WithParallelStreams(*streams, *streamMinSize))
+	}
+	if *codecs != "" {
+		opts = append(opts, framework.WithCodecs(strings.Split(*codecs, ",")...))
+	}
+	if *serveWorkers > 0 {
+		opts = append(opts, framework.WithServeWorkers(*serveWorkers, *serveBacklog))
+	}
+	if *requestTimeout > 0 {
+		opts = append(opts, framework.WithRequestTimeout(*requestTimeout))
+	}
+	if *dnsMaxTTL > 0 {
+		opts = append(opts, framework.WithDNS(frameworkhttp.DNSPolicy{MaxTTL: *dnsMaxTTL}))
+	}
+	if *verifyData {
+		opts = append(opts, framework.WithDataVerification())
+	}
+	if *degraded {
+		opts = append(opts, framework.WithDegradedMode())
+	}
+	if *standby {
+		opts = append(opts, framework.WithStandby())
+	}
+	if *resources != "" {
+		r, err := etcdutil.ParseResources(*resources)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		opts = append(opts, framework.WithResources(r))
+	}
+	if *speculateAfter > 0 {
+		opts = append(opts, framework.WithSpeculation(*speculateAfter))
+	}
+	if *backup {
+		opts = append(opts, framework.WithBackup())
+	}
+	if len(spec.Phases) > 0 {
+		opts = append(opts, framework.WithPhases(phases(spec.Phases, numOfTasks, params)...))
+	}
+	if ttls != (etcdutil.TTLs{}) {
+		ttls.Heartbeat = *heartbeatTTL
+		opts = append(opts, framework.WithTTLs(ttls))
+	}
+	if *heartbeatInterval > 0 || *heartbeatTTL > 0 {
+		opts = append(opts, framework.WithHeartbeat(*heartbeatInterval, *heartbeatTTL))
+	}
+	if tlsInfo.CertFile != "" {
+		opts = append(opts, framework.WithTLS(tlsInfo))
+	}
+	if *memoryBudget > 0 {
+		opts = append(opts, framework.WithMemoryBudget(membudget.New(*memoryBudget)))
+	}
+	if *sandboxed {
+		opts = append(opts, framework.WithSandbox(sandbox.Config{Path: os.Args[0], Args: os.Args[1:]}))
+	}
+	if *sink != "" {
+		s, err := stream.NewSink(*sink)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		opts = append(opts, framework.WithSink(s))
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
+	bootstrap := framework.NewBootStrap(*name, strings.Split(*etcdURLs, ","), ln, logger, opts...)
+	bootstrap.SetTaskBuilder(taskBuilder)
+	bootstrap.SetTopology(topo)
+	bootstrap.Start()
+}
+
+// phases builds the phases of the job spec with the registered topologies.
+func phases(specs []etcdutil.PhaseSpec, numOfTasks uint64, params meritop.Params) []framework.Phase {
+	var phases []framework.Phase
+	for _, spec := range specs {
+		p := framework.Phase{Name: spec.Name, Epochs: spec.Epochs}
+		if spec.Topology != "" {
+			topo, err := meritop.NewTopology(spec.Topology, numOfTasks, params)
+			if err != nil {
+				fatalf("phase %s: %v", spec.Name, err)
+			}
+			p.Topology = topo
+		}
+		phases = append(phases, p)
+	}
+	return phases
+}
+
+// waitNumOfTasks waits for the controller to set up the job, and returns its
+// number of tasks.
+func waitNumOfTasks(client etcdutil.Coordinator, name string) uint64 {
+	for {
+		n, err := etcdutil.GetNumOfTasks(client, name)
+		if err == nil {
+			return n
+		}
+		if !etcdutil.IsKeyNotFound(err) && !etcdutil.IsTransient(err) {
+			fatalf("%v", err)
+		}
+		log.Printf("waiting for job %s to be set up: %v", name, err)
+		time.Sleep(time.Second)
+	}
+}
+
+// envOr returns the environment variable, e.g. set by kube.Placer, or def if
+// it's unset.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "meritop-worker: "+format+"\n", v...)
+	os.Exit(1)
+}
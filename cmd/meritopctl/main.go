@@ -0,0 +1,267 @@
+/*
+Command meritopctl administers meritop jobs.
+
+Usage:
+
+	meritopctl init -etcd urls -name name -tasks n [-task builder -topology topology [-param name=value]...]
+	meritopctl tasks -etcd urls -name name
+	meritopctl epoch -etcd urls -name name
+	meritopctl kill -etcd urls -name name taskID
+	meritopctl restart -etcd urls -name name taskID
+	meritopctl destroy -etcd urls -name name
+	meritopctl harvest -etcd urls -name name [-dir dir]
+	meritopctl inspect-archive -etcd http://127.0.0.1:4001 [-etcd-api v3] [-name name] archive.tar.gz
+
+All commands take -etcd-api v3 for etcd v3 clusters.
+
+init sets up the etcd layout of a job, for nodes to run its tasks, without
+supervising it; run meritop-controller -resume to have failed tasks reported.
+
+tasks lists the tasks of a job, with their state, the address of the node
+running them and their last heartbeat. epoch prints the current epoch.
+
+kill fails a task as if its node crashed: the node exits and the task is
+failed over. restart hands a task over to a standby node, which restores it
+from its checkpoint.
+
+destroy shuts a job down, so that all its nodes exit, and deletes it from
+etcd.
+
+harvest saves whatever a job, e.g. one which failed, has produced: the latest
+checkpoint of each task, its results and artifacts, with a manifest of what
+is missing, as {job}-harvest.tar.gz in -dir (see Controller.Harvest). It
+works on a job whose layout is gone too, with its results and artifacts
+only.
+
+inspect-archive loads a job archived by Controller.Archive into etcd under a
+scratch name, and prints its status. The loaded job has finished, so no node
+ever runs its tasks; delete it with "meritopctl destroy" when done.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: meritopctl init|tasks|epoch|kill|restart|destroy|harvest|inspect-archive -etcd urls [-name name] [args]\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "init":
+		initJob(os.Args[2:])
+	case "tasks":
+		listTasks(os.Args[2:])
+	case "epoch":
+		printEpoch(os.Args[2:])
+	case "kill":
+		killTask(os.Args[2:])
+	case "restart":
+		restartTask(os.Args[2:])
+	case "destroy":
+		destroyJob(os.Args[2:])
+	case "harvest":
+		harvestJob(os.Args[2:])
+	case "inspect-archive":
+		inspectArchive(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+// jobFlags are the flags naming the job which commands administer.
+type jobFlags struct {
+	etcdURLs *string
+	etcdAPI  *string
+	name     *string
+}
+
+func newJobFlags(fs *flag.FlagSet) jobFlags {
+	return jobFlags{
+		etcdURLs: fs.String("etcd", "http://127.0.0.1:4001", "comma separated etcd URLs"),
+		etcdAPI:  fs.String("etcd-api", etcdutil.APIv2, "version of the etcd API, v2 or v3"),
+		name:     fs.String("name", "", "job name"),
+	}
+}
+
+func (jf jobFlags) client() etcdutil.Coordinator {
+	client, err := etcdutil.NewCoordinator(*jf.etcdAPI, strings.Split(*jf.etcdURLs, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return client
+}
+
+// open parses the flags of a command on a job set up in etcd, which takes
+// nargs args, and returns the controller of the job.
+func open(cmd string, args []string, nargs int) (*controller.Controller, *flag.FlagSet) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	jf := newJobFlags(fs)
+	fs.Parse(args)
+	if *jf.name == "" || fs.NArg() != nargs {
+		usage()
+	}
+	c, err := controller.Open(*jf.name, jf.client())
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return c, fs
+}
+
+func initJob(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	jf := newJobFlags(fs)
+	numOfTasks := fs.Uint64("tasks", 0, "number of tasks")
+	task := fs.String("task", "", "registered task builder of the job spec")
+	topology := fs.String("topology", "", "registered topology of the job spec")
+	params := meritop.Params{}
+	fs.Var(params, "param", "name=value param of the job spec; can be repeated")
+	fs.Parse(args)
+	if *jf.name == "" || *numOfTasks == 0 || fs.NArg() != 0 {
+		usage()
+	}
+	c := controller.New(*jf.name, jf.client(), *numOfTasks)
+	if *task != "" || *topology != "" {
+		if *task == "" || *topology == "" {
+			fatalf("the job spec needs both -task and -topology")
+		}
+		c.SetJobSpec(etcdutil.JobSpec{Task: *task, Topology: *topology, Params: params})
+	}
+	if err := c.InitEtcdLayout(); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func listTasks(args []string) {
+	c, _ := open("tasks", args, 0)
+	status, err := c.Status()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Print(status)
+}
+
+func printEpoch(args []string) {
+	c, _ := open("epoch", args, 0)
+	epoch, err := c.GetEpoch()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if epoch == etcdutil.ExitEpoch {
+		fmt.Println("finished")
+		return
+	}
+	fmt.Println(epoch)
+}
+
+func killTask(args []string) {
+	c, fs := open("kill", args, 1)
+	if err := c.KillTask(parseTaskID(fs.Arg(0))); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func restartTask(args []string) {
+	c, fs := open("restart", args, 1)
+	if err := c.RestartTask(parseTaskID(fs.Arg(0))); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func destroyJob(args []string) {
+	c, _ := open("destroy", args, 0)
+	if err := c.ShutdownJob(); err != nil {
+		fatalf("%v", err)
+	}
+	if err := c.DestroyEtcdLayout(); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func harvestJob(args []string) {
+	fs := flag.NewFlagSet("harvest", flag.ExitOnError)
+	jf := newJobFlags(fs)
+	dir := fs.String("dir", ".", "directory to save the harvest in")
+	fs.Parse(args)
+	if *jf.name == "" || fs.NArg() != 0 {
+		usage()
+	}
+	client := jf.client()
+	c, err := controller.Open(*jf.name, client)
+	if err == controller.ErrNoLayout {
+		c = controller.New(*jf.name, client, 0)
+	} else if err != nil {
+		fatalf("%v", err)
+	}
+	m, err := c.Harvest(controller.NewDirStore(*dir))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if m.Status == nil {
+		fmt.Printf("job %s has no layout left: no checkpoints harvested\n", m.Job)
+	}
+	fmt.Printf("checkpoints: %d, missing for tasks %v\n", len(m.Checkpoints), m.MissingCheckpoints)
+	fmt.Printf("unfinished tasks: %v\n", m.UnfinishedTasks)
+	fmt.Printf("results: %d, artifacts: %d\n", len(m.Results), len(m.Artifacts))
+}
+
+func parseTaskID(s string) uint64 {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		fatalf("bad task ID %q", s)
+	}
+	return id
+}
+
+func inspectArchive(args []string) {
+	fs := flag.NewFlagSet("inspect-archive", flag.ExitOnError)
+	etcdURLs := fs.String("etcd", "http://127.0.0.1:4001", "comma separated etcd URLs")
+	etcdAPI := fs.String("etcd-api", etcdutil.APIv2, "version of the etcd API, v2 or v3")
+	name := fs.String("name", "", "job name to load the archive as, archive-{unix time} by default")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	if *name == "" {
+		*name = fmt.Sprintf("archive-%d", time.Now().Unix())
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer f.Close()
+	client, err := etcdutil.NewCoordinator(*etcdAPI, strings.Split(*etcdURLs, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	c, summary, err := controller.LoadArchive(client, f, *name)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	status, err := c.Status()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("job %s archived at %s, loaded as %s\n", summary.Job, summary.ArchivedAt.UTC().Format(time.RFC3339), *name)
+	fmt.Print(status)
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "meritopctl: "+format+"\n", v...)
+	os.Exit(1)
+}
@@ -0,0 +1,222 @@
+package contract_test
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// What applications implement.
+var (
+	_ meritop.Topology    = (*starTopology)(nil)
+	_ meritop.Task        = (*sumTask)(nil)
+	_ meritop.TaskBuilder = (*sumTaskBuilder)(nil)
+)
+
+// frameworkAPI is meritop.Framework as applications call it. Methods may be
+// added to meritop.Framework, but not removed or changed.
+type frameworkAPI interface {
+	FlagMeta(linkType, meta string)
+	FlagMetaToParent(meta string)
+	FlagMetaToChild(meta string)
+	FlagMetaBroadcast(meta string)
+	GatherMeta(meta string)
+	GetTopology() meritop.Topology
+	ShutdownJob()
+	FinishJob(result []byte)
+	IncEpoch()
+	GetLogger() logging.Logger
+	EnterBarrier(name string)
+	DataRequest(toID uint64, meta string)
+	Handle(name string, h meritop.TypedHandler)
+	TypedDataRequest(toID uint64, name string, arg interface{}) error
+	RegisterHandler(name string, h meritop.HandlerFunc)
+	Call(toID uint64, name string, args []byte)
+	Respond(requestID uint64, data []byte)
+	AllReduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error)
+	Reduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error)
+	Broadcast(data []byte) ([]byte, error)
+	SendMessage(toID uint64, payload []byte)
+	GetJobConfig() map[string]string
+	Push(toID uint64, payload []byte)
+	GetTaskID() uint64
+	ReportProgress()
+	Publish(topic, data string)
+	Subscribe(topic string, handler func(data string))
+	Emit(record []byte)
+	ExportArtifact(name, value string)
+	AssignShards(shards map[uint64][]string)
+	RecordResult(key, value string)
+	GetResults() map[string]string
+}
+
+var _ frameworkAPI = meritop.Framework(nil)
+
+// bootstrapAPI is meritop.Bootstrap as drivers call it.
+type bootstrapAPI interface {
+	SetTaskBuilder(taskBuilder meritop.TaskBuilder)
+	SetTopology(topology meritop.Topology)
+	Start()
+}
+
+var _ bootstrapAPI = meritop.Bootstrap(nil)
+
+// newBootStrap is framework.NewBootStrap as drivers call it.
+var newBootStrap func(jobName string, etcdURLs []string, ln net.Listener, logger *log.Logger, opts ...framework.Option) meritop.Bootstrap = framework.NewBootStrap
+
+// starTopology links task 0, the parent, to every other task.
+type starTopology struct {
+	numOfTasks, taskID uint64
+}
+
+func (t *starTopology) SetTaskID(taskID uint64)            { t.taskID = taskID }
+func (t *starTopology) SetNumberOfTasks(numOfTasks uint64) { t.numOfTasks = numOfTasks }
+
+func (t *starTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkParent, meritop.LinkChild}
+}
+
+func (t *starTopology) GetReverseLinkType(linkType string) string {
+	if linkType == meritop.LinkParent {
+		return meritop.LinkChild
+	}
+	return meritop.LinkParent
+}
+
+func (t *starTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	switch {
+	case t.taskID == 0 && linkType == meritop.LinkChild:
+		children := make([]uint64, 0, t.numOfTasks-1)
+		for id := uint64(1); id < t.numOfTasks; id++ {
+			children = append(children, id)
+		}
+		return children
+	case t.taskID != 0 && linkType == meritop.LinkParent:
+		return []uint64{0}
+	}
+	return nil
+}
+
+// sumTaskBuilder builds tasks whose parent adds up taskID * epoch of its
+// children at every epoch, and sends the sum of all epochs to Result.
+type sumTaskBuilder struct {
+	NumOfEpochs uint64
+	Result      chan uint64
+}
+
+func (b *sumTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &sumTask{builder: b}
+}
+
+type sumTask struct {
+	builder   *sumTaskBuilder
+	framework meritop.Framework
+	taskID    uint64
+
+	mu       sync.Mutex
+	epoch    uint64
+	total    uint64
+	children map[uint64]bool
+}
+
+func (t *sumTask) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID = taskID
+	t.framework = framework
+}
+
+func (t *sumTask) Exit() {}
+
+func (t *sumTask) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	t.epoch = epoch
+	t.children = make(map[uint64]bool)
+	t.mu.Unlock()
+	if t.taskID != 0 {
+		t.framework.FlagMetaToParent("ready")
+	}
+}
+
+func (t *sumTask) MetaReady(fromID uint64, linkType, meta string) {
+	if linkType == meritop.LinkChild {
+		t.framework.DataRequest(fromID, "value")
+	}
+}
+
+func (t *sumTask) Serve(fromID uint64, linkType, req string) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return []byte(strconv.FormatUint(t.taskID*t.epoch, 10))
+}
+
+func (t *sumTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	value, err := strconv.ParseUint(string(resp), 10, 64)
+	if err != nil {
+		t.framework.GetLogger().Warnf("bad value from task %d: %v", fromID, err)
+		return
+	}
+	t.mu.Lock()
+	if t.children[fromID] {
+		t.mu.Unlock()
+		return
+	}
+	t.children[fromID] = true
+	t.total += value
+	done := len(t.children) == len(t.framework.GetTopology().GetNeighbors(meritop.LinkChild, t.epoch))
+	epoch, total := t.epoch, t.total
+	t.mu.Unlock()
+	if !done {
+		return
+	}
+	if epoch < t.builder.NumOfEpochs {
+		t.framework.IncEpoch()
+		return
+	}
+	t.framework.ShutdownJob()
+	t.builder.Result <- total
+}
+
+// TestContract runs the job of sumTaskBuilder on a star of tasks, the way an
+// application does.
+func TestContract(t *testing.T) {
+	job := "TestContract"
+	numOfTasks := uint64(4)
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, coord, numOfTasks)
+	if err := ctl.Start(); err != nil {
+		t.Fatalf("controller.Start() failed: %v", err)
+	}
+	defer ctl.Stop()
+
+	builder := &sumTaskBuilder{NumOfEpochs: 3, Result: make(chan uint64, 1)}
+	logger := log.New(ioutil.Discard, "", 0)
+	for i := uint64(0); i < numOfTasks; i++ {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen() failed: %v", err)
+		}
+		bootstrap := newBootStrap(job, nil, ln, logger, framework.WithCoordinator(coord))
+		bootstrap.SetTaskBuilder(builder)
+		bootstrap.SetTopology(&starTopology{numOfTasks: numOfTasks})
+		go bootstrap.Start()
+	}
+
+	select {
+	case total := <-builder.Result:
+		// children 1, 2 and 3 at epochs 1, 2 and 3
+		if want := uint64(6 * 6); total != want {
+			t.Errorf("total = %d, want %d", total, want)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("job didn't finish")
+	}
+}
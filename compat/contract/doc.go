@@ -0,0 +1,14 @@
+/*
+Package contract holds the contract tests of the API of meritop: its tests
+are a small program written the way applications are, i.e. against the
+interfaces of package meritop and framework.NewBootStrap only, which builds
+and runs a job to its end. A change of meritop.Task, TaskBuilder, Topology,
+Bootstrap or Framework which would break applications breaks the build of
+these tests, so that it is caught before a release rather than by users.
+
+Additions to the interfaces applications implement, e.g. a method of
+meritop.Task, break applications as much as removals do, and so do changes of
+the signatures of the methods of meritop.Framework. New optional interfaces
+of tasks don't, see meritop.Checkpointer.
+*/
+package contract
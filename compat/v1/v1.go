@@ -0,0 +1,163 @@
+/*
+Package v1 freezes the API of meritop which tasks and drivers are written
+against, as of version 1, so that applications can upgrade the library for
+bug fixes without adopting changes of the API at once. Applications import
+the interfaces of this package instead of those of package meritop, and
+start nodes with its NewBootStrap:
+
+	bootstrap := v1.NewBootStrap(job, etcdURLs, ln, logger, opts...)
+	bootstrap.SetTaskBuilder(builder) // a v1.TaskBuilder
+	bootstrap.SetTopology(topology)
+	bootstrap.Start()
+
+As the API of meritop evolves, e.g. its Task or Framework interfaces, this
+package adapts the frozen API to it. The optional interfaces of tasks, e.g.
+meritop.Checkpointer, and the types which haven't changed are those of
+package meritop.
+*/
+package v1
+
+import (
+	"log"
+	"net"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// Task is meritop.Task of version 1.
+type Task interface {
+	Init(taskID uint64, framework Framework)
+	Exit()
+	SetEpoch(epoch uint64)
+	MetaReady(fromID uint64, linkType, meta string)
+	DataReady(fromID uint64, linkType, req string, resp []byte)
+	Serve(fromID uint64, linkType, req string) []byte
+}
+
+// TaskBuilder is meritop.TaskBuilder of version 1.
+type TaskBuilder interface {
+	GetTask(taskID uint64) Task
+}
+
+// PhasedTaskBuilder is meritop.PhasedTaskBuilder of version 1.
+type PhasedTaskBuilder interface {
+	TaskBuilder
+	GetEpochTask(taskID, epoch uint64, current Task) Task
+}
+
+// Bootstrap is meritop.Bootstrap of version 1.
+type Bootstrap interface {
+	SetTaskBuilder(taskBuilder TaskBuilder)
+	SetTopology(topology meritop.Topology)
+	Start()
+}
+
+// Framework is meritop.Framework of version 1.
+type Framework interface {
+	FlagMeta(linkType, meta string)
+	FlagMetaToParent(meta string)
+	FlagMetaToChild(meta string)
+	FlagMetaBroadcast(meta string)
+	GatherMeta(meta string)
+	GetTopology() meritop.Topology
+	ShutdownJob()
+	IncEpoch()
+	GetLogger() logging.Logger
+	EnterBarrier(name string)
+	DataRequest(toID uint64, meta string)
+	Handle(name string, h meritop.TypedHandler)
+	TypedDataRequest(toID uint64, name string, arg interface{}) error
+	RegisterHandler(name string, h meritop.HandlerFunc)
+	Call(toID uint64, name string, args []byte)
+	Respond(requestID uint64, data []byte)
+	AllReduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error)
+	Reduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error)
+	Broadcast(data []byte) ([]byte, error)
+	SendMessage(toID uint64, payload []byte)
+	GetJobConfig() map[string]string
+	Push(toID uint64, payload []byte)
+	GetTaskID() uint64
+	ReportProgress()
+	Publish(topic, data string)
+	Subscribe(topic string, handler func(data string))
+	Emit(record []byte)
+	ExportArtifact(name, value string)
+}
+
+// NewBootStrap is framework.NewBootStrap of version 1.
+func NewBootStrap(jobName string, etcdURLs []string, ln net.Listener, logger *log.Logger, opts ...framework.Option) Bootstrap {
+	return &bootstrap{framework.NewBootStrap(jobName, etcdURLs, ln, logger, opts...)}
+}
+
+type bootstrap struct {
+	meritop.Bootstrap
+}
+
+func (b *bootstrap) SetTaskBuilder(tb TaskBuilder) {
+	b.Bootstrap.SetTaskBuilder(AdaptTaskBuilder(tb))
+}
+
+// AdaptTaskBuilder returns the task builder of meritop building the tasks of
+// tb, e.g. to register it with meritop.RegisterTaskBuilder.
+func AdaptTaskBuilder(tb TaskBuilder) meritop.TaskBuilder {
+	if p, ok := tb.(PhasedTaskBuilder); ok {
+		return phasedTaskBuilder{p}
+	}
+	return taskBuilder{tb}
+}
+
+type taskBuilder struct {
+	b TaskBuilder
+}
+
+func (tb taskBuilder) GetTask(taskID uint64) meritop.Task {
+	return AdaptTask(tb.b.GetTask(taskID))
+}
+
+type phasedTaskBuilder struct {
+	b PhasedTaskBuilder
+}
+
+func (tb phasedTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return AdaptTask(tb.b.GetTask(taskID))
+}
+
+func (tb phasedTaskBuilder) GetEpochTask(taskID, epoch uint64, current meritop.Task) meritop.Task {
+	next := tb.b.GetEpochTask(taskID, epoch, current.(*task).t)
+	if next == nil {
+		return nil
+	}
+	return AdaptTask(next)
+}
+
+// AdaptTask returns the task of meritop running t.
+func AdaptTask(t Task) meritop.Task {
+	return &task{t}
+}
+
+type task struct {
+	t Task
+}
+
+// The framework of meritop implements Framework of version 1.
+func (t *task) Init(taskID uint64, f meritop.Framework) { t.t.Init(taskID, f) }
+
+func (t *task) Exit() { t.t.Exit() }
+
+func (t *task) SetEpoch(epoch uint64) { t.t.SetEpoch(epoch) }
+
+func (t *task) MetaReady(fromID uint64, linkType, meta string) {
+	t.t.MetaReady(fromID, linkType, meta)
+}
+
+func (t *task) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.t.DataReady(fromID, linkType, req, resp)
+}
+
+func (t *task) Serve(fromID uint64, linkType, req string) []byte {
+	return t.t.Serve(fromID, linkType, req)
+}
+
+func (t *task) Adapted() interface{} { return t.t }
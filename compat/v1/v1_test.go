@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/go-distributed/meritop"
+)
+
+// The framework of meritop still implements the frozen Framework.
+var _ Framework = meritop.Framework(nil)
+
+type testTask struct {
+	epoch uint64
+	f     Framework
+}
+
+func (t *testTask) Init(taskID uint64, f Framework)                            { t.f = f }
+func (t *testTask) Exit()                                                      {}
+func (t *testTask) SetEpoch(epoch uint64)                                      { t.epoch = epoch }
+func (t *testTask) MetaReady(fromID uint64, linkType, meta string)             {}
+func (t *testTask) DataReady(fromID uint64, linkType, req string, resp []byte) {}
+func (t *testTask) Serve(fromID uint64, linkType, req string) []byte           { return []byte(req) }
+func (t *testTask) Snapshot() []byte                                           { return nil }
+func (t *testTask) Restore(snapshot []byte)                                    {}
+
+// testBuilder runs an evaluation task from epoch 10.
+type testBuilder struct{}
+
+func (testBuilder) GetTask(taskID uint64) Task { return &testTask{} }
+
+func (testBuilder) GetEpochTask(taskID, epoch uint64, current Task) Task {
+	if epoch == 10 {
+		return &testTask{epoch: 10}
+	}
+	return nil
+}
+
+func TestAdaptTaskBuilder(t *testing.T) {
+	b, ok := AdaptTaskBuilder(testBuilder{}).(meritop.PhasedTaskBuilder)
+	if !ok {
+		t.Fatalf("adapted task builder isn't phased")
+	}
+	mt := b.GetTask(0)
+	mt.SetEpoch(3)
+	a, ok := mt.(meritop.AdaptedTask)
+	if !ok {
+		t.Fatalf("adapted task doesn't implement AdaptedTask")
+	}
+	tt := a.Adapted().(*testTask)
+	if tt.epoch != 3 {
+		t.Errorf("epoch = %d, want 3", tt.epoch)
+	}
+	// Optional interfaces are found on the adapted task only.
+	if _, ok := a.Adapted().(meritop.Checkpointer); !ok {
+		t.Errorf("adapted task isn't a Checkpointer")
+	}
+	if _, ok := mt.(meritop.Checkpointer); ok {
+		t.Errorf("adapter is a Checkpointer")
+	}
+	if next := b.GetEpochTask(0, 5, mt); next != nil {
+		t.Errorf("task at epoch 5 = %v, want the current one", next)
+	}
+	next := b.GetEpochTask(0, 10, mt)
+	if next == nil || next.(meritop.AdaptedTask).Adapted().(*testTask).epoch != 10 {
+		t.Errorf("task at epoch 10 = %v, want the evaluation task", next)
+	}
+}
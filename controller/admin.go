@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+const (
+	AdminPrefix      = "/admin"
+	AdminEpoch       = AdminPrefix + "/epoch"
+	AdminStatus      = AdminPrefix + "/status"
+	AdminShutdown    = AdminPrefix + "/shutdown"
+	AdminRoles       = AdminPrefix + "/roles"
+	AdminScale       = AdminPrefix + "/scale"
+	AdminDeadLetters = AdminPrefix + "/deadletters"
+	AdminStragglers  = AdminPrefix + "/stragglers"
+)
+
+// AdminHandler returns the admin API of the job. Every request goes through
+// the given authenticator first, then the role of the caller is checked
+// (see SetRole and SetBootstrapAdmin). The API includes:
+//
+//	GET    /admin/epoch                     -> current epoch of the job (viewer)
+//	GET    /admin/status                    -> status of the job and its tasks (viewer)
+//	GET    /admin/deadletters               -> JSON of what tasks couldn't deliver (viewer)
+//	GET    /admin/stragglers                -> JSON of the tasks consistently slower than the others (viewer)
+//	POST   /admin/shutdown                  -> shutdown all tasks of the job (operator)
+//	POST   /admin/scale?add=N               -> add N tasks (operator)
+//	POST   /admin/scale?remove=ID,ID        -> remove the last tasks (operator)
+//	GET    /admin/roles                     -> the role policy (admin)
+//	PUT    /admin/roles?identity=ID&role=R  -> grant a role (admin)
+//	DELETE /admin/roles?identity=ID         -> revoke a role (admin)
+//
+// To use client certificates, serve it with TLS, e.g.
+//
+//	ln = tls.NewListener(ln, &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven, ...})
+//	http.Serve(ln, c.AdminHandler(controller.NewClientCertAuthenticator()))
+func (c *Controller) AdminHandler(auth Authenticator) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(AdminEpoch, c.requireRole(auth, RoleViewer, c.handleEpoch))
+	mux.Handle(AdminStatus, c.requireRole(auth, RoleViewer, c.handleStatus))
+	mux.Handle(AdminDeadLetters, c.requireRole(auth, RoleViewer, c.handleDeadLetters))
+	mux.Handle(AdminStragglers, c.requireRole(auth, RoleViewer, c.handleStragglers))
+	mux.Handle(AdminShutdown, c.requireRole(auth, RoleOperator, c.handleShutdown))
+	mux.Handle(AdminScale, c.requireRole(auth, RoleOperator, c.handleScale))
+	mux.Handle(AdminRoles, c.requireRole(auth, RoleAdmin, c.handleRoles))
+	return mux
+}
+
+func (c *Controller) handleEpoch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	epoch, err := c.GetEpoch()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, strconv.FormatUint(epoch, 10))
+}
+
+func (c *Controller) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := c.Status()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, status)
+}
+
+func (c *Controller) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dls, err := c.DeadLetters()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if dls == nil {
+		dls = []etcdutil.DeadLetter{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dls)
+}
+
+func (c *Controller) handleStragglers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stragglers, err := c.Stragglers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stragglers == nil {
+		stragglers = []Straggler{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stragglers)
+}
+
+func (c *Controller) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := c.ShutdownJob(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) handleScale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var err error
+	switch {
+	case q.Get("add") != "":
+		var n uint64
+		if n, err = strconv.ParseUint(q.Get("add"), 10, 64); err != nil {
+			http.Error(w, "bad number of tasks", http.StatusBadRequest)
+			return
+		}
+		err = c.AddTasks(n)
+	case q.Get("remove") != "":
+		var ids []uint64
+		for _, s := range strings.Split(q.Get("remove"), ",") {
+			id, perr := strconv.ParseUint(s, 10, 64)
+			if perr != nil {
+				http.Error(w, "bad task ID", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		err = c.RemoveTasks(ids)
+	default:
+		http.Error(w, "need add or remove", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) handleRoles(w http.ResponseWriter, r *http.Request) {
+	identity := r.URL.Query().Get("identity")
+	var err error
+	switch r.Method {
+	case "GET":
+		var roles map[string]Role
+		if roles, err = c.GetRoles(); err == nil {
+			for id, role := range roles {
+				fmt.Fprintf(w, "%s %s\n", id, role)
+			}
+			return
+		}
+	case "PUT":
+		var role Role
+		if role, err = ParseRole(r.URL.Query().Get("role")); err != nil || checkIdentity(identity) != nil {
+			http.Error(w, "bad identity or role", http.StatusBadRequest)
+			return
+		}
+		err = c.SetRole(identity, role)
+	case "DELETE":
+		if checkIdentity(identity) != nil {
+			http.Error(w, "bad identity", http.StatusBadRequest)
+			return
+		}
+		err = c.RemoveRole(identity)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) GetEpoch() (uint64, error) {
+	resp, err := c.etcdclient.Get(etcdutil.EpochPath(c.name), false, false)
+	if err != nil {
+		return 0, err
+	}
+	return c.codec.DecodeEpoch(resp.Node.Value)
+}
+
+// DeadLetters returns the meta and data requests that tasks of the job
+// couldn't deliver, oldest first.
+func (c *Controller) DeadLetters() ([]etcdutil.DeadLetter, error) {
+	return etcdutil.GetDeadLetters(c.etcdclient, c.name)
+}
+
+// Publish publishes an event on the topic to the tasks subscribed to it (see
+// meritop.Framework.Subscribe), e.g. an early stop decided outside the job.
+func (c *Controller) Publish(topic, data string) error {
+	c.events.record("published %q on topic %s", data, topic)
+	return etcdutil.Publish(c.etcdclient, c.name, topic, data)
+}
+
+// SetJobConfig replaces the config of the job, e.g. hyperparameters like the
+// learning rate, which tasks read with meritop.Framework.GetJobConfig. Running
+// tasks get the new config with meritop.ConfigObserver.
+func (c *Controller) SetJobConfig(config map[string]string) error {
+	c.events.record("set job config %v", config)
+	return etcdutil.SetJobConfig(c.etcdclient, c.name, config)
+}
+
+// GetJobConfig returns the config of the job, empty if it has none.
+func (c *Controller) GetJobConfig() (map[string]string, error) {
+	return etcdutil.GetJobConfig(c.etcdclient, c.name)
+}
+
+// KillTask fails the task as if its node crashed: the node loses its claim
+// and exits, and the task is failed over to a standby or free node.
+func (c *Controller) KillTask(id uint64) error {
+	if id >= c.numOfTasks {
+		return fmt.Errorf("controller: no task %d in job of %d tasks", id, c.numOfTasks)
+	}
+	c.events.record("killed task %d", id)
+	if _, err := c.etcdclient.Delete(etcdutil.TaskHealthyPath(c.name, id), false); err != nil && !etcdutil.IsKeyNotFound(err) {
+		return err
+	}
+	// Failure detection reports it too, if the job is supervised.
+	return etcdutil.ReportFailure(c.etcdclient, c.name, strconv.FormatUint(id, 10))
+}
+
+// RestartTask asks the node running the task to hand it over to a standby
+// node, which restores it from its checkpoint, see framework.WithStandby.
+func (c *Controller) RestartTask(id uint64) error {
+	if id >= c.numOfTasks {
+		return fmt.Errorf("controller: no task %d in job of %d tasks", id, c.numOfTasks)
+	}
+	c.events.record("restarting task %d", id)
+	return etcdutil.RequestDrain(c.etcdclient, c.name, id)
+}
+
+// ShutdownJob sets the epoch to exit epoch, so all tasks will exit.
+func (c *Controller) ShutdownJob() error {
+	epoch, err := c.GetEpoch()
+	if err != nil {
+		return err
+	}
+	if epoch == etcdutil.ExitEpoch {
+		return nil
+	}
+	c.logger.Infof("controller shutting down job %s at epoch %d", c.name, epoch)
+	c.events.record("shut down at epoch %d", epoch)
+	return etcdutil.CASEpoch(c.etcdclient, c.codec, c.name, epoch, etcdutil.ExitEpoch)
+}
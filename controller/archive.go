@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+var ErrJobNotFinished = errors.New("controller: job is not finished")
+
+// ObjectStore keeps whole objects by name, e.g. a bucket of S3 or GCS.
+type ObjectStore interface {
+	Put(name string, r io.Reader) error
+}
+
+// dirStore keeps objects as files in a directory, e.g. on a shared file
+// system or one synced to object storage.
+type dirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) ObjectStore {
+	return &dirStore{dir: dir}
+}
+
+func (s *dirStore) Put(name string, r io.Reader) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, name)
+	tmp, err := ioutil.TempFile(s.dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// eventLog records what the controller did to the job, e.g. failures
+// reported and scaling, to be archived with the job.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) record(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, time.Now().UTC().Format(time.RFC3339Nano)+" "+fmt.Sprintf(format, v...))
+}
+
+func (l *eventLog) bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var b bytes.Buffer
+	for _, e := range l.events {
+		b.WriteString(e)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// ArchiveSummary is the summary.json of an archive.
+type ArchiveSummary struct {
+	Job        string
+	ArchivedAt time.Time
+	Status     *JobStatus
+}
+
+// Archive saves the etcd subtree of a finished job, the events of the
+// controller and a summary as {job}.tar.gz to dest, and then destroys the
+// etcd layout of the job. The archive has:
+//
+//	etcd.json     recursive etcd node of the job
+//	events.log    one event of the controller per line
+//	summary.json  ArchiveSummary
+//
+// It returns ErrJobNotFinished unless the job has exited, and leaves etcd
+// untouched if saving fails.
+func (c *Controller) Archive(dest ObjectStore) error {
+	status, err := c.Status()
+	if err != nil {
+		return err
+	}
+	if !status.Finished() {
+		return ErrJobNotFinished
+	}
+	resp, err := c.etcdclient.Get(etcdutil.JobPath(c.name), true, true)
+	if err != nil {
+		return err
+	}
+	// The data token is a secret, and of no use once the job is over.
+	nodes := resp.Node.Nodes[:0]
+	for _, n := range resp.Node.Nodes {
+		if n.Key != etcdutil.DataTokenPath(c.name) {
+			nodes = append(nodes, n)
+		}
+	}
+	resp.Node.Nodes = nodes
+	var buf bytes.Buffer
+	summary := &ArchiveSummary{Job: c.name, ArchivedAt: time.Now(), Status: status}
+	if err := writeArchive(&buf, resp.Node, c.events.bytes(), summary); err != nil {
+		return err
+	}
+	if err := dest.Put(c.name+".tar.gz", &buf); err != nil {
+		return fmt.Errorf("controller failed to save archive: %v", err)
+	}
+	c.logger.Infof("controller archived job %s", c.name)
+	_, err = c.etcdclient.Delete(etcdutil.JobPath(c.name), true)
+	return err
+}
+
+func writeArchive(w io.Writer, root *etcd.Node, events []byte, summary *ArchiveSummary) error {
+	tree, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	sum, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"etcd.json", tree},
+		{"events.log", events},
+		{"summary.json", sum},
+	} {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), ModTime: summary.ArchivedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// LoadArchive loads an archive saved by Archive into etcd as job name, e.g. a
+// scratch name for inspecting a historical run with Status. The epoch of an
+// archived job is the exit epoch, so nodes never run tasks of it. It returns
+// a controller of the loaded job and the summary of the archive.
+func LoadArchive(client etcdutil.Coordinator, r io.Reader, name string) (*Controller, *ArchiveSummary, error) {
+	root, summary, err := readArchive(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	from := etcdutil.JobPath(summary.Job)
+	to := etcdutil.JobPath(name)
+	var load func(n *etcd.Node) error
+	load = func(n *etcd.Node) error {
+		if !n.Dir {
+			_, err := client.Create(to+strings.TrimPrefix(n.Key, from), n.Value, 0)
+			return err
+		}
+		for _, child := range n.Nodes {
+			if err := load(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := load(root); err != nil {
+		return nil, nil, fmt.Errorf("controller failed to load archive of job %s: %v", summary.Job, err)
+	}
+	c := New(name, client, summary.Status.NumOfTasks)
+	if c.codec, err = etcdutil.GetCodec(client, name); err != nil {
+		return nil, nil, err
+	}
+	return c, summary, nil
+}
+
+func readArchive(r io.Reader) (*etcd.Node, *ArchiveSummary, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var root *etcd.Node
+	var summary *ArchiveSummary
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch hdr.Name {
+		case "etcd.json":
+			err = json.NewDecoder(tr).Decode(&root)
+		case "summary.json":
+			err = json.NewDecoder(tr).Decode(&summary)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("controller: bad %s in archive: %v", hdr.Name, err)
+		}
+	}
+	if root == nil || summary == nil || summary.Status == nil {
+		return nil, nil, errors.New("controller: incomplete archive")
+	}
+	return root, summary, nil
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestArchiveWrite(t *testing.T) {
+	name := "TestArchiveWrite"
+	root := &etcd.Node{Key: etcdutil.JobPath(name), Dir: true, Nodes: etcd.Nodes{
+		{Key: etcdutil.EpochPath(name), Value: "3"},
+	}}
+	var events eventLog
+	events.record("task %d failed", 2)
+	summary := &ArchiveSummary{Job: name, ArchivedAt: time.Unix(1400000000, 0), Status: &JobStatus{Epoch: 3}}
+
+	dir, err := ioutil.TempDir("", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, root, events.bytes(), summary); err != nil {
+		t.Fatalf("writeArchive failed: %v", err)
+	}
+	if err := NewDirStore(dir).Put(name+".tar.gz", &buf); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, name+".tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files[hdr.Name], err = ioutil.ReadAll(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var node etcd.Node
+	if err := json.Unmarshal(files["etcd.json"], &node); err != nil {
+		t.Fatalf("etcd.json: %v", err)
+	}
+	if len(node.Nodes) != 1 || node.Nodes[0].Value != "3" {
+		t.Errorf("etcd.json = %s", files["etcd.json"])
+	}
+	if !bytes.HasSuffix(files["events.log"], []byte(" task 2 failed\n")) {
+		t.Errorf("events.log = %q", files["events.log"])
+	}
+	var s ArchiveSummary
+	if err := json.Unmarshal(files["summary.json"], &s); err != nil {
+		t.Fatalf("summary.json: %v", err)
+	}
+	if s.Job != name || s.Status.Epoch != 3 {
+		t.Errorf("summary.json = %s", files["summary.json"])
+	}
+}
+
+func TestArchiveRead(t *testing.T) {
+	name := "TestArchiveRead"
+	root := &etcd.Node{Key: etcdutil.JobPath(name), Dir: true, Nodes: etcd.Nodes{
+		{Key: etcdutil.EpochPath(name), Value: "3"},
+	}}
+	summary := &ArchiveSummary{Job: name, ArchivedAt: time.Unix(1400000000, 0), Status: &JobStatus{Epoch: 3, NumOfTasks: 2}}
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, root, nil, summary); err != nil {
+		t.Fatalf("writeArchive failed: %v", err)
+	}
+	r, s, err := readArchive(&buf)
+	if err != nil {
+		t.Fatalf("readArchive failed: %v", err)
+	}
+	if r.Key != root.Key || len(r.Nodes) != 1 || r.Nodes[0].Value != "3" {
+		t.Errorf("root = %+v", r)
+	}
+	if s.Job != name || s.Status.NumOfTasks != 2 || !s.ArchivedAt.Equal(summary.ArchivedAt) {
+		t.Errorf("summary = %+v", s)
+	}
+
+	if _, _, err := readArchive(bytes.NewReader(nil)); err == nil {
+		t.Error("readArchive of nothing succeeded")
+	}
+}
+
+func TestHarvest(t *testing.T) {
+	job := "TestHarvest"
+	client := etcdutil.NewMemoryCoordinator()
+	c := newTestController(t, client, 3)
+	if err := etcdutil.SaveCheckpoint(client, job, 1, 4, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	if err := etcdutil.SetResult(client, job, "item/0", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := etcdutil.SetArtifact(client, job, "model", "file:///model"); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := c.Harvest(NewDirStore(dir))
+	if err != nil {
+		t.Fatalf("Harvest failed: %v", err)
+	}
+	if want := []HarvestedCheckpoint{{TaskID: 1, Epoch: 4, File: "checkpoints/1-4"}}; !reflect.DeepEqual(m.Checkpoints, want) {
+		t.Errorf("checkpoints = %+v, want %+v", m.Checkpoints, want)
+	}
+	if want := []uint64{0, 2}; !reflect.DeepEqual(m.MissingCheckpoints, want) {
+		t.Errorf("missing checkpoints = %v, want %v", m.MissingCheckpoints, want)
+	}
+	if want := []uint64{0, 1, 2}; !reflect.DeepEqual(m.UnfinishedTasks, want) {
+		t.Errorf("unfinished tasks = %v, want %v", m.UnfinishedTasks, want)
+	}
+
+	f, err := os.Open(filepath.Join(dir, job+"-harvest.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(b)
+	}
+	if files["checkpoints/1-4"] != "state" {
+		t.Errorf("checkpoint of task 1 = %q, want state", files["checkpoints/1-4"])
+	}
+	var results map[string]string
+	if err := json.Unmarshal([]byte(files["results.json"]), &results); err != nil || results["item/0"] != "a" {
+		t.Errorf("results.json = %s", files["results.json"])
+	}
+	if _, ok := files["manifest.json"]; !ok {
+		t.Errorf("no manifest.json in harvest")
+	}
+
+	// Once the layout is gone, the outputs are harvested still.
+	if err := c.DestroyEtcdLayout(); err != nil {
+		t.Fatal(err)
+	}
+	m, err = c.Harvest(NewDirStore(dir))
+	if err != nil {
+		t.Fatalf("Harvest without layout failed: %v", err)
+	}
+	if m.Status != nil || len(m.Checkpoints) != 0 || !reflect.DeepEqual(m.Artifacts, []string{"model"}) {
+		t.Errorf("harvest without layout = %+v", m)
+	}
+}
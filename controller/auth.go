@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrUnauthenticated = errors.New("controller: unauthenticated")
+
+// Authenticator decides who is calling the controller admin API.
+type Authenticator interface {
+	// Authenticate returns the identity of the caller, or an error if the
+	// caller can't be authenticated.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// tokenAuthenticator accepts requests carrying "Authorization: Bearer {token}".
+type tokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator creates an authenticator with static tokens. The map
+// is from token to the identity it stands for.
+func NewTokenAuthenticator(tokens map[string]string) Authenticator {
+	return &tokenAuthenticator{tokens: tokens}
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", ErrUnauthenticated
+	}
+	id, ok := a.tokens[strings.TrimPrefix(h, "Bearer ")]
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return id, nil
+}
+
+// clientCertAuthenticator accepts requests with a verified TLS client
+// certificate. The identity is the common name of the certificate.
+type clientCertAuthenticator struct {
+	allowed map[string]bool
+}
+
+// NewClientCertAuthenticator creates an authenticator for mutual TLS. The admin
+// API must then be served with a tls.Config verifying client certificates
+// (ClientAuth set to tls.VerifyClientCertIfGiven or stricter). If no common
+// name is given, any verified certificate is accepted.
+func NewClientCertAuthenticator(commonNames ...string) Authenticator {
+	a := &clientCertAuthenticator{}
+	if len(commonNames) > 0 {
+		a.allowed = make(map[string]bool)
+		for _, cn := range commonNames {
+			a.allowed[cn] = true
+		}
+	}
+	return a
+}
+
+func (a *clientCertAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", ErrUnauthenticated
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if a.allowed != nil && !a.allowed[cn] {
+		return "", ErrUnauthenticated
+	}
+	return cn, nil
+}
+
+type multiAuthenticator []Authenticator
+
+// NewMultiAuthenticator accepts a request if any of given authenticators
+// accepts it, e.g. both tokens and client certificates.
+func NewMultiAuthenticator(auths ...Authenticator) Authenticator {
+	return multiAuthenticator(auths)
+}
+
+func (m multiAuthenticator) Authenticate(r *http.Request) (string, error) {
+	for _, a := range m {
+		if id, err := a.Authenticate(r); err == nil {
+			return id, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// RequireAuth only passes authenticated requests to h.
+func RequireAuth(auth Authenticator, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := auth.Authenticate(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
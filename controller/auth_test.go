@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAuthToken(t *testing.T) {
+	auth := NewTokenAuthenticator(map[string]string{"secret": "alice"})
+	h := RequireAuth(auth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		header string
+		code   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for i, tt := range tests {
+		r, err := http.NewRequest("GET", AdminEpoch, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("#%d: code want = %d, get = %d", i, tt.code, w.Code)
+		}
+	}
+}
+
+func TestClientCertAuthenticatorWithoutTLS(t *testing.T) {
+	r, err := http.NewRequest("GET", AdminEpoch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClientCertAuthenticator().Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("err want = %v, get = %v", ErrUnauthenticated, err)
+	}
+}
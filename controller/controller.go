@@ -1,12 +1,17 @@
 package controller
 
 import (
-	"log"
-	"os"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
 	"strconv"
+	"sync"
+	"time"
 
-	"github.com/coreos/go-etcd/etcd"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/logging"
+	"github.com/go-distributed/meritop/pkg/metrics"
 )
 
 // This is the controller of a job.
@@ -14,70 +19,354 @@ import (
 // cluster containers, etc. to setup framework to run.
 type Controller struct {
 	name           string
-	etcdclient     *etcd.Client
+	etcdclient     etcdutil.Coordinator
+	retry          etcdutil.RetryPolicy
+	codec          etcdutil.Codec
+	scaleMu        sync.Mutex
 	numOfTasks     uint64
 	failDetectStop chan bool
-	logger         *log.Logger
+	quotaStop      chan struct{}
+	epochStop      chan bool
+	scheduleStop   chan struct{}
+	deadlineStop   chan struct{}
+	logger         logging.Logger
+
+	quota    Quota
+	restarts *restartLimiter
+	// restarts delayed by the restart quota, cancelled on Stop
+	restartMu       sync.Mutex
+	restartsStopped bool
+	delayedRestarts []*time.Timer
+	seed            int64
+	dataToken       string
+	jobSpec         etcdutil.JobSpec
+	epochInterval   time.Duration
+	// limits past which the job fails, if set, see SetDeadline and
+	// SetMaxEpochs
+	deadline  time.Time
+	maxEpochs uint64
+	// task which may advance the epoch, if any, see SetEpochMaster
+	epochMaster *uint64
+	// resources tasks require, see SetRequirements
+	requirements map[uint64]etcdutil.Resources
+
+	bootstrapAdmin string
+	events         eventLog
+	containers     *containers
+
+	failuresDetected metrics.Counter
+	restartsDelayed  metrics.Counter
+	etcdErrors       metrics.Counter
 }
 
-func New(name string, etcd *etcd.Client, numOfTasks uint64) *Controller {
+func New(name string, etcd etcdutil.Coordinator, numOfTasks uint64) *Controller {
 	return &Controller{
 		name:       name,
 		etcdclient: etcd,
 		numOfTasks: numOfTasks,
-		logger:     log.New(os.Stdout, "", log.Lshortfile|log.Ltime|log.Ldate),
+		retry:      etcdutil.DefaultRetryPolicy,
+		codec:      etcdutil.TextCodec,
+		logger:     logging.Default().With("job", name),
+		seed:       time.Now().UnixNano(),
 	}
 }
 
+// Open returns a controller of the job already set up in etcd, e.g. to
+// administer it from another process, without supervising it as Resume does.
+func Open(name string, client etcdutil.Coordinator) (*Controller, error) {
+	codec, err := etcdutil.GetCodec(client, name)
+	if err != nil {
+		return nil, err
+	}
+	nt, err := etcdutil.GetTaskCount(client, name)
+	if err != nil {
+		if etcdutil.IsKeyNotFound(err) {
+			return nil, ErrNoLayout
+		}
+		return nil, err
+	}
+	c := New(name, client, nt.N)
+	c.codec = codec
+	return c, nil
+}
+
+// SetLogger replaces the default logger, which logs to stdout.
+func (c *Controller) SetLogger(l logging.Logger) { c.logger = l.With("job", c.name) }
+
+// SetRetryPolicy sets how the controller retries etcd operations failing with
+// transient errors. The default is etcdutil.DefaultRetryPolicy.
+func (c *Controller) SetRetryPolicy(p etcdutil.RetryPolicy) { c.retry = p }
+
+// SetCodec sets the codec of epoch and meta values of the job. The default is
+// etcdutil.TextCodec. It must be called before Start.
+func (c *Controller) SetCodec(codec etcdutil.Codec) { c.codec = codec }
+
+// SetSeed sets the job-wide random seed shared by all tasks, so that
+// randomized jobs can be reproduced. It must be called before Start.
+func (c *Controller) SetSeed(seed int64) { c.seed = seed }
+
+// SetDataToken distributes the token authenticating data requests between
+// tasks through etcd, for nodes started with framework.WithEtcdDataToken. See
+// etcdutil.NewDataToken. It must be called before Start.
+func (c *Controller) SetDataToken(token string) { c.dataToken = token }
+
+// SetJobSpec tells nodes of generic worker binaries which registered task
+// builder and topology run the job. It must be called before Start.
+func (c *Controller) SetJobSpec(spec etcdutil.JobSpec) { c.jobSpec = spec }
+
+// SetEpochMaster designates the only task which may advance the epoch with
+// Framework.IncEpoch, e.g. the master of a parameter server, so that a task
+// calling it by mistake fails with framework.ErrNotEpochMaster instead of
+// advancing the job. Any task may by default. It must be called before Start.
+func (c *Controller) SetEpochMaster(taskID uint64) { c.epochMaster = &taskID }
+
+// SetRequirements sets the resources tasks require, by task ID, e.g. GPUs, so
+// that only nodes which have them claim the tasks (see
+// framework.WithResources). It must be called before Start.
+func (c *Controller) SetRequirements(reqs map[uint64]etcdutil.Resources) { c.requirements = reqs }
+
 // A controller typical workflow:
+// 0. controller waits for the jobs the job spec depends on, if any.
 // 1. controller sets up etcd layout before any task starts running.
-// 2. Being ready, controller lets other tasks to run and reports any failure found.
+// 2. controller requests containers running the tasks, if it has a resource
+// manager.
+// 3. Being ready, controller lets other tasks to run and reports any failure found.
 func (c *Controller) Start() error {
+	if err := c.waitDependencies(); err != nil {
+		return err
+	}
 	if err := c.InitEtcdLayout(); err != nil {
 		return err
 	}
+	if err := c.requestContainers(); err != nil {
+		return err
+	}
+	c.Supervise()
+	c.events.record("started with %d tasks", c.numOfTasks)
+	c.logger.Infof("Controller starting, name: %s, numberOfTask: %d\n", c.name, c.numOfTasks)
+	return nil
+}
+
+// ErrNoLayout is returned by Resume, Open and Retry if the job has no complete etcd
+// layout.
+var ErrNoLayout = errors.New("controller: job has no etcd layout to resume")
+
+// Resume takes over the job whose etcd layout is already set up, e.g. by a
+// controller which crashed mid-job, instead of setting up a new one. The
+// number of tasks, the codec and the job spec come from etcd. Tasks whose
+// heartbeat expired while no controller was watching are reported failed,
+// then the job is supervised as by Start.
+func (c *Controller) Resume() error {
+	codec, err := etcdutil.GetCodec(c.etcdclient, c.name)
+	if err != nil {
+		return err
+	}
+	c.codec = codec
+	// The epoch is the last key of the layout.
+	if _, err := etcdutil.GetEpochChange(c.etcdclient, c.codec, c.name); err != nil {
+		if etcdutil.IsKeyNotFound(err) {
+			return ErrNoLayout
+		}
+		return err
+	}
+	status, err := c.Status()
+	if err != nil {
+		return err
+	}
+	c.numOfTasks = status.NumOfTasks
+	if spec, err := etcdutil.GetJobSpec(c.etcdclient, c.name); err == nil {
+		c.jobSpec = spec
+	} else if !etcdutil.IsKeyNotFound(err) {
+		return err
+	}
+	if status.Finished() {
+		c.logger.Infof("Controller resuming, name: %s has finished", c.name)
+		return nil
+	}
+
+	// Watch first, so that no heartbeat expires unnoticed in between.
+	c.Supervise()
+	for _, ts := range status.Tasks {
+		if ts.State != TaskFailed {
+			continue
+		}
+		id := strconv.FormatUint(ts.ID, 10)
+		_, err := c.etcdclient.Get(etcdutil.FreeTaskPath(c.name, id), false, false)
+		if etcdutil.IsKeyNotFound(err) {
+			c.reportFailure(id)
+		}
+	}
+	c.events.record("resumed at epoch %d with %d tasks", status.Epoch, c.numOfTasks)
+	c.logger.Infof("Controller resuming, name: %s, epoch: %d, numberOfTask: %d\n", c.name, status.Epoch, c.numOfTasks)
+	return nil
+}
+
+// Supervise reports failed tasks, enforces the usage quota, ends the phases,
+// advances the epoch on schedule, fails the job past its deadline or max
+// epochs and records the completion of a job whose etcd layout is set up,
+// until StopSupervising. Start does all.
+func (c *Controller) Supervise() {
 	// Currently no previous changes will be watches before watch is setup.
 	// We assumes that ttl is usually a few seconds. watch is setup before that.
-	go c.startFailureDetection()
-	c.logger.Printf("Controller starting, name: %s, numberOfTask: %d\n", c.name, c.numOfTasks)
-	return nil
+	c.failDetectStop = make(chan bool, 1)
+	go c.startFailureDetection(c.failDetectStop)
+	c.quotaStop = make(chan struct{})
+	go c.enforceUsageQuota(c.quotaStop)
+	c.epochStop = make(chan bool)
+	go c.followEpochs(c.jobSpec.Phases, c.epochStop)
+	c.scheduleStop = make(chan struct{})
+	go c.advanceEpochs(c.epochInterval, c.scheduleStop)
+	c.deadlineStop = make(chan struct{})
+	go c.enforceDeadline(c.deadline, c.deadlineStop)
 }
 
 func (c *Controller) Stop() error {
+	c.recordDone()
+	c.stopDelayedRestarts()
+	c.releaseContainers()
 	c.DestroyEtcdLayout()
-	c.stopFailureDetection()
-	c.logger.Printf("Controller stoping...\n")
+	c.StopSupervising()
+	c.logger.Infof("Controller stoping...\n")
 	return nil
 }
 
-func (c *Controller) InitEtcdLayout() error {
-	// Initilize the job epoch to 0
-	if _, err := c.etcdclient.Create(etcdutil.EpochPath(c.name), "0", 0); err != nil {
-		c.logger.Fatalf("controller create initial epoch failed: %v", err)
+// StopSupervising stops what Supervise starts, leaving the job in etcd.
+func (c *Controller) StopSupervising() {
+	c.recordDone()
+	c.stopDelayedRestarts()
+	c.stopFailureDetection()
+	if c.quotaStop != nil {
+		close(c.quotaStop)
+		c.quotaStop = nil
+	}
+	if c.epochStop != nil {
+		close(c.epochStop)
+		c.epochStop = nil
+	}
+	if c.scheduleStop != nil {
+		close(c.scheduleStop)
+		c.scheduleStop = nil
+	}
+	if c.deadlineStop != nil {
+		close(c.deadlineStop)
+		c.deadlineStop = nil
+	}
+}
+
+// MetricsHandler serves the metrics of the controller in the Prometheus text
+// format.
+func (c *Controller) MetricsHandler() http.Handler {
+	r := metrics.NewRegistry(map[string]string{"job": c.name})
+	r.RegisterCounter("meritop_failures_detected_total", "Task failures detected.", &c.failuresDetected)
+	r.RegisterCounter("meritop_restarts_delayed_total", "Restarts delayed by the restart quota.", &c.restartsDelayed)
+	r.RegisterCounter("meritop_etcd_errors_total", "Failures to report task failures to etcd.", &c.etcdErrors)
+	if fc, ok := c.etcdclient.(*etcdutil.FailoverCoordinator); ok {
+		fc.Register(r)
+	}
+	return r
+}
+
+func (c *Controller) InitEtcdLayout() error { return c.initEtcdLayout(false) }
+
+// EnsureEtcdLayout is InitEtcdLayout keeping the keys already created, e.g.
+// by a previous attempt which failed halfway. No task must have started
+// before the layout is complete.
+func (c *Controller) EnsureEtcdLayout() error { return c.initEtcdLayout(true) }
+
+func (c *Controller) initEtcdLayout(keep bool) error {
+	if err := c.checkTasksQuota(c.numOfTasks); err != nil {
+		return err
+	}
+	created := func(err error) bool { return err == nil || keep && etcdutil.IsNodeExist(err) }
+
+	if err := etcdutil.CreateCodec(c.etcdclient, c.name, c.codec); !created(err) {
+		return c.layoutError("create codec", err)
+	}
+
+	// before the number of tasks, which generic workers wait for
+	if c.jobSpec.Task != "" {
+		if err := etcdutil.CreateJobSpec(c.etcdclient, c.name, c.jobSpec); !created(err) {
+			return c.layoutError("create job spec", err)
+		}
+	}
+
+	// before the free tasks, which nodes claim by their requirements
+	if c.requirements != nil {
+		if err := etcdutil.CreateRequirements(c.etcdclient, c.name, c.requirements); !created(err) {
+			return c.layoutError("create task requirements", err)
+		}
+	}
+
+	if err := etcdutil.CreateNumOfTasks(c.etcdclient, c.name, c.numOfTasks); !created(err) {
+		return c.layoutError("create number of tasks", err)
+	}
+
+	if err := etcdutil.CreateSeed(c.etcdclient, c.name, c.seed); !created(err) {
+		return c.layoutError("create seed", err)
+	}
+
+	if c.dataToken != "" {
+		if err := etcdutil.CreateDataToken(c.etcdclient, c.name, c.dataToken); !created(err) {
+			return c.layoutError("create data token", err)
+		}
+	}
+
+	if c.epochMaster != nil {
+		if err := etcdutil.CreateEpochMaster(c.etcdclient, c.name, *c.epochMaster); !created(err) {
+			return c.layoutError("create epoch master", err)
+		}
+	}
+
+	if c.bootstrapAdmin != "" {
+		if err := c.SetRole(c.bootstrapAdmin, RoleAdmin); err != nil {
+			return c.layoutError("grant bootstrap admin", err)
+		}
 	}
 
 	// initiate etcd data layout
 	// currently it creates as many unassigned tasks as task masters.
 	for i := uint64(0); i < c.numOfTasks; i++ {
 		key := etcdutil.FreeTaskPath(c.name, strconv.FormatUint(i, 10))
-		if _, err := c.etcdclient.Create(key, "", 0); err != nil {
-			c.logger.Fatalf("controller create failed. Key: %s, err: %v", key, err)
+		if _, err := c.etcdclient.Create(key, "", 0); !created(err) {
+			return c.layoutError("create "+key, err)
 		}
 	}
+
+	// Initilize the job epoch to 0. Nodes waiting for the layout wait for the
+	// epoch, so it goes last.
+	if _, err := c.etcdclient.Create(etcdutil.EpochPath(c.name), c.codec.EncodeEpoch(0), 0); !created(err) {
+		return c.layoutError("create initial epoch", err)
+	}
 	return nil
 }
 
+// layoutError logs and returns an error of setting up the etcd layout. Tasks
+// can't start without the layout, so it's up to the caller to give up.
+func (c *Controller) layoutError(what string, err error) error {
+	err = fmt.Errorf("controller %s failed: %v", what, err)
+	c.logger.Errorf("%v", err)
+	return err
+}
+
+// DestroyEtcdLayout deletes the subtree of the job, leaving other jobs and
+// other users of etcd alone.
 func (c *Controller) DestroyEtcdLayout() error {
-	_, err := c.etcdclient.Delete("/", true)
+	dir := etcdutil.JobPath(c.name)
+	if path.Dir(dir) != etcdutil.RootDir {
+		return fmt.Errorf("controller: job name %q isn't a single etcd directory", c.name)
+	}
+	_, err := c.etcdclient.Delete(dir, true)
 	return err
 }
 
-func (c *Controller) startFailureDetection() error {
-	c.failDetectStop = make(chan bool, 1)
-	return etcdutil.DetectFailure(c.etcdclient, c.name, c.failDetectStop, c.logger)
+func (c *Controller) startFailureDetection(stop chan bool) error {
+	return etcdutil.WatchFailure(c.etcdclient, c.name, stop, c.reportFailure)
 }
 
 func (c *Controller) stopFailureDetection() error {
-	c.failDetectStop <- true
+	if c.failDetectStop != nil {
+		c.failDetectStop <- true
+		c.failDetectStop = nil
+	}
 	return nil
 }
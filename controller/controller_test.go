@@ -1,14 +1,40 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/kube"
+	"github.com/go-distributed/meritop/pkg/logging"
 )
 
+// newTestController returns the controller of n tasks of a job named after
+// the test, logging nowhere, with the etcd layout of the job set up.
+func newTestController(t *testing.T, client etcdutil.Coordinator, n uint64) *Controller {
+	c := New(t.Name(), client, n)
+	c.SetLogger(testLogger())
+	if err := c.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	return c
+}
+
+// testLogger logs nowhere.
+func testLogger() logging.Logger {
+	return logging.NewStd(log.New(ioutil.Discard, "", 0), logging.Info)
+}
+
 // etcd needs to be initialized beforehand
 func TestControllerInitEtcdLayout(t *testing.T) {
 	m := etcdutil.MustNewMember(t, "controller_test")
@@ -32,8 +58,11 @@ func TestControllerInitEtcdLayout(t *testing.T) {
 			name:       tt.name,
 			etcdclient: etcdClient,
 			numOfTasks: tt.numberOfTasks,
+			logger:     logging.Default(),
+		}
+		if err := c.InitEtcdLayout(); err != nil {
+			t.Fatalf("#%d: InitEtcdLayout failed: %v", i, err)
 		}
-		c.InitEtcdLayout()
 
 		for taskID := uint64(0); taskID < tt.numberOfTasks; taskID++ {
 			key := etcdutil.FreeTaskPath(c.name, strconv.FormatUint(taskID, 10))
@@ -46,3 +75,509 @@ func TestControllerInitEtcdLayout(t *testing.T) {
 		c.DestroyEtcdLayout()
 	}
 }
+
+// A layout set up halfway is completed by EnsureEtcdLayout, not by
+// InitEtcdLayout.
+func TestEnsureEtcdLayout(t *testing.T) {
+	job := "TestEnsureEtcdLayout"
+	client := etcdutil.NewMemoryCoordinator()
+	if err := etcdutil.CreateCodec(client, job, etcdutil.TextCodec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Create(etcdutil.FreeTaskPath(job, "0"), "", 0); err != nil {
+		t.Fatal(err)
+	}
+	c := New(job, client, 2)
+	c.SetLogger(testLogger())
+	if err := c.InitEtcdLayout(); err == nil {
+		t.Fatalf("InitEtcdLayout of a layout set up halfway succeeded")
+	}
+	if err := c.EnsureEtcdLayout(); err != nil {
+		t.Fatalf("EnsureEtcdLayout failed: %v", err)
+	}
+	status, err := c.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Epoch != 0 || status.NumOfTasks != 2 || len(status.Tasks) != 2 || status.Tasks[1].State != TaskFree {
+		t.Errorf("status = %v", status)
+	}
+}
+
+func TestControllerJobSpec(t *testing.T) {
+	job := "TestControllerJobSpec"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 2)
+	c.SetLogger(testLogger())
+	spec := etcdutil.JobSpec{Task: "loadgen", Topology: "tree", Params: map[string]string{"fanout": "2"}}
+	c.SetJobSpec(spec)
+	if err := c.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	got, err := etcdutil.GetJobSpec(client, job)
+	if err != nil || !reflect.DeepEqual(got, spec) {
+		t.Errorf("job spec = (%+v, %v), want (%+v, nil)", got, err, spec)
+	}
+}
+
+func TestControllerResume(t *testing.T) {
+	job := "TestControllerResume"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 3)
+	c.SetLogger(testLogger())
+	if err := c.Resume(); err != ErrNoLayout {
+		t.Fatalf("Resume without layout = %v, want %v", err, ErrNoLayout)
+	}
+	if err := c.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	// Task 0 is running, task 1 failed while no controller was watching, and
+	// task 2 is still free.
+	for _, id := range []string{"0", "1"} {
+		if _, err := client.Delete(etcdutil.FreeTaskPath(job, id), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.Create(etcdutil.TaskHealthyPath(job, 0), "addr", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := New(job, client, 0)
+	resumed.SetLogger(testLogger())
+	if err := resumed.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	defer resumed.StopSupervising()
+	if resumed.numOfTasks != 3 {
+		t.Errorf("numOfTasks = %d, want 3", resumed.numOfTasks)
+	}
+	status, err := resumed.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TaskState{TaskAssigned, TaskFailed, TaskFree}
+	for i, ts := range status.Tasks {
+		if ts.State != want[i] {
+			t.Errorf("task %d is %v, want %v", i, ts.State, want[i])
+		}
+	}
+	resp, err := client.Get(etcdutil.FreeTaskPath(job, "1"), false, false)
+	if err != nil || resp.Node.Value != "failed" {
+		t.Errorf("failure of task 1 isn't reported: %v", err)
+	}
+}
+
+func TestDestroyEtcdLayout(t *testing.T) {
+	client := etcdutil.NewMemoryCoordinator()
+	if _, err := client.Create("/other/key", "v", 0); err != nil {
+		t.Fatal(err)
+	}
+	var ctls []*Controller
+	for _, job := range []string{"TestDestroyEtcdLayout-a", "TestDestroyEtcdLayout-b"} {
+		c := New(job, client, 2)
+		c.SetLogger(testLogger())
+		if err := c.InitEtcdLayout(); err != nil {
+			t.Fatalf("InitEtcdLayout of %s failed: %v", job, err)
+		}
+		ctls = append(ctls, c)
+	}
+	if err := ctls[0].DestroyEtcdLayout(); err != nil {
+		t.Fatalf("DestroyEtcdLayout failed: %v", err)
+	}
+	if _, err := client.Get(etcdutil.JobPath(ctls[0].name), false, false); !etcdutil.IsKeyNotFound(err) {
+		t.Errorf("layout of destroyed job: err = %v, want key not found", err)
+	}
+	for _, key := range []string{etcdutil.EpochPath(ctls[1].name), "/other/key"} {
+		if _, err := client.Get(key, false, false); err != nil {
+			t.Errorf("%s is gone with another job: %v", key, err)
+		}
+	}
+	for _, name := range []string{"", "..", "a/b"} {
+		if err := New(name, client, 1).DestroyEtcdLayout(); err == nil {
+			t.Errorf("DestroyEtcdLayout of job %q should fail", name)
+		}
+	}
+}
+
+func TestControllerDeadLetters(t *testing.T) {
+	job := "TestControllerDeadLetters"
+	client := etcdutil.NewMemoryCoordinator()
+	c := newTestController(t, client, 2)
+	dl := etcdutil.DeadLetter{From: 1, To: 0, Epoch: 1, Kind: "data", Payload: "req", Error: "gone", At: time.Unix(1400000000, 0).UTC()}
+	if err := etcdutil.AddDeadLetter(client, job, dl, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", AdminDeadLetters, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	c.SetRole("viewer", RoleViewer)
+	c.AdminHandler(NewTokenAuthenticator(map[string]string{"secret": "viewer"})).ServeHTTP(w, r)
+	var got []etcdutil.DeadLetter
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("GET %s = %d %q: %v", AdminDeadLetters, w.Code, w.Body.String(), err)
+	}
+	if len(got) != 1 || got[0] != dl {
+		t.Errorf("dead letters = %+v, want %+v", got, dl)
+	}
+}
+
+func TestControllerPhases(t *testing.T) {
+	job := "TestControllerPhases"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 1)
+	c.SetLogger(testLogger())
+	c.SetJobSpec(etcdutil.JobSpec{Task: "t", Topology: "tree", Phases: []etcdutil.PhaseSpec{
+		{Name: "train", Epochs: 2},
+		{Name: "export", Epochs: 1},
+	}})
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.StopSupervising()
+
+	waitEvent := func(want string) {
+		for i := 0; !strings.Contains(string(c.events.bytes()), want); i++ {
+			if i == 100 {
+				t.Fatalf("events %q miss %q", c.events.bytes(), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitEvent("phase train started at epoch 0")
+	for epoch := uint64(0); epoch < 3; epoch++ {
+		if err := etcdutil.CASEpoch(client, c.codec, job, epoch, epoch+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitEvent("phase export started at epoch 2")
+	waitEvent("shut down at epoch 3")
+	if epoch, err := c.GetEpoch(); err != nil || epoch != etcdutil.ExitEpoch {
+		t.Errorf("epoch after the last phase = (%d, %v), want exit epoch", epoch, err)
+	}
+}
+
+func TestControllerDependencies(t *testing.T) {
+	defer func(d time.Duration) { dependencyPollInterval = d }(dependencyPollInterval)
+	dependencyPollInterval = time.Millisecond
+	client := etcdutil.NewMemoryCoordinator()
+	logger := testLogger()
+
+	prep := New("TestControllerDependencies-prep", client, 1)
+	prep.SetLogger(logger)
+	if err := prep.Start(); err != nil {
+		t.Fatalf("Start of prep failed: %v", err)
+	}
+	train := New("TestControllerDependencies-train", client, 1)
+	train.SetLogger(logger)
+	train.SetJobSpec(etcdutil.JobSpec{Task: "t", Topology: "tree",
+		Params: map[string]string{"epochs": "3"},
+		Inputs: map[string]string{"data": prep.name + "/url"}})
+	started := make(chan error, 1)
+	go func() { started <- train.Start() }()
+	select {
+	case err := <-started:
+		t.Fatalf("train started before prep finished: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := etcdutil.SetArtifact(client, prep.name, "url", "file:///data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := prep.ShutdownJob(); err != nil {
+		t.Fatal(err)
+	}
+	prep.Stop()
+	if err := <-started; err != nil {
+		t.Fatalf("Start of train failed: %v", err)
+	}
+	defer train.Stop()
+	spec, err := etcdutil.GetJobSpec(client, train.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"epochs": "3", "data": "file:///data"}; !reflect.DeepEqual(spec.Params, want) {
+		t.Errorf("params = %v, want %v", spec.Params, want)
+	}
+}
+
+func TestControllerEpochInterval(t *testing.T) {
+	job := "TestControllerEpochInterval"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 1)
+	c.SetLogger(testLogger())
+	c.SetEpochInterval(5 * time.Millisecond)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.StopSupervising()
+
+	for i := 0; ; i++ {
+		epoch, err := c.GetEpoch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if epoch >= 3 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("epoch = %d after 1s, want it advanced every 5ms", epoch)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(string(c.events.bytes()), "advanced to epoch 3 on schedule") {
+		t.Errorf("events %q miss the scheduled epoch 3", c.events.bytes())
+	}
+	// The schedule ends with the job.
+	if err := c.ShutdownJob(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if epoch, err := c.GetEpoch(); err != nil || epoch != etcdutil.ExitEpoch {
+		t.Errorf("epoch after shutdown = (%d, %v), want exit epoch", epoch, err)
+	}
+}
+
+func TestControllerKillRestartTask(t *testing.T) {
+	job := "TestControllerKillRestartTask"
+	client := etcdutil.NewMemoryCoordinator()
+	newTestController(t, client, 2)
+	for id := uint64(0); id < 2; id++ {
+		if _, err := etcdutil.ClaimTask(client, job, id, "node"); err != nil {
+			t.Fatalf("ClaimTask failed: %v", err)
+		}
+	}
+
+	// Another process administers the job set up above.
+	admin, err := Open(job, client)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := Open("TestControllerNoJob", client); err != ErrNoLayout {
+		t.Errorf("Open of no job = %v, want %v", err, ErrNoLayout)
+	}
+	if err := admin.KillTask(0); err != nil {
+		t.Fatalf("KillTask failed: %v", err)
+	}
+	if err := admin.RestartTask(1); err != nil {
+		t.Fatalf("RestartTask failed: %v", err)
+	}
+	if err := admin.KillTask(2); err == nil {
+		t.Errorf("KillTask of no task succeeded")
+	}
+	status, err := admin.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Tasks[0].State != TaskFailed || status.Tasks[1].State != TaskAssigned {
+		t.Errorf("status = %v, want task 0 failed and task 1 assigned", status)
+	}
+	if ok, err := etcdutil.DrainRequested(client, job, 1); !ok || err != nil {
+		t.Errorf("DrainRequested = %v, %v, want true", ok, err)
+	}
+}
+
+// fakeResourceManager hands out containers of increasing IDs.
+type fakeResourceManager struct {
+	specs    []ContainerSpec
+	released []string
+}
+
+func (rm *fakeResourceManager) RequestContainers(n int, spec ContainerSpec) ([]string, error) {
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, strconv.Itoa(len(rm.specs)))
+		rm.specs = append(rm.specs, spec)
+	}
+	return ids, nil
+}
+
+func (rm *fakeResourceManager) ReleaseContainer(id string) error {
+	rm.released = append(rm.released, id)
+	return nil
+}
+
+func TestControllerResourceManager(t *testing.T) {
+	job := "TestControllerResourceManager"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 3)
+	c.SetLogger(testLogger())
+	rm := &fakeResourceManager{}
+	c.SetResourceManager(rm, ContainerSpec{Image: "meritop-worker", Env: map[string]string{kube.EnvEtcd: "http://etcd:4001"}})
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if len(rm.specs) != 3 {
+		t.Fatalf("containers requested = %d, want 3", len(rm.specs))
+	}
+	want := map[string]string{kube.EnvEtcd: "http://etcd:4001", kube.EnvJob: job}
+	if env := rm.specs[0].Env; !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+	c.Stop()
+	if want := []string{"0", "1", "2"}; !reflect.DeepEqual(rm.released, want) {
+		t.Errorf("released = %v, want %v", rm.released, want)
+	}
+}
+
+func TestControllerRetry(t *testing.T) {
+	job := "TestControllerRetry"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 2)
+	c.SetLogger(testLogger())
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := c.Retry(true); err != ErrJobRunning {
+		t.Fatalf("Retry of running job = %v, want %v", err, ErrJobRunning)
+	}
+	if err := etcdutil.SetResult(client, job, "item/0", "a"); err != nil {
+		t.Fatal(err)
+	}
+	// Task 0 took its task, then the job was shut down.
+	if _, err := client.Delete(etcdutil.FreeTaskPath(job, "0"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ShutdownJob(); err != nil {
+		t.Fatal(err)
+	}
+	c.StopSupervising()
+
+	retried := New(job, client, 0)
+	retried.SetLogger(testLogger())
+	if err := retried.Retry(true); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	status, err := retried.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Epoch != 0 || status.NumOfTasks != 2 {
+		t.Errorf("retried job at epoch %d with %d tasks, want 0 with 2", status.Epoch, status.NumOfTasks)
+	}
+	for _, ts := range status.Tasks {
+		if ts.State != TaskFree {
+			t.Errorf("task %d is %v, want %v", ts.ID, ts.State, TaskFree)
+		}
+	}
+	if done, _ := etcdutil.JobDone(client, job); done {
+		t.Errorf("retried job is recorded done")
+	}
+	results, err := etcdutil.GetResults(client, job)
+	if want := map[string]string{"item/0": "a"}; err != nil || !reflect.DeepEqual(results, want) {
+		t.Errorf("results = (%v, %v), want %v", results, err, want)
+	}
+
+	if err := retried.ShutdownJob(); err != nil {
+		t.Fatal(err)
+	}
+	retried.Stop()
+	if err := retried.Retry(false); err != nil {
+		t.Fatalf("Retry of all work failed: %v", err)
+	}
+	defer retried.Stop()
+	if results, err := etcdutil.GetResults(client, job); err != nil || len(results) != 0 {
+		t.Errorf("results of job retried from scratch = (%v, %v), want none", results, err)
+	}
+}
+
+func TestControllerWaitResult(t *testing.T) {
+	job := "TestControllerWaitResult"
+	client := etcdutil.NewMemoryCoordinator()
+	c := newTestController(t, client, 1)
+	stop := make(chan struct{})
+	close(stop)
+	if r, err := c.WaitResult(stop); err != ErrWaitStopped {
+		t.Fatalf("WaitResult of running job = (%v, %v), want %v", r, err, ErrWaitStopped)
+	}
+
+	results := make(chan *etcdutil.JobResult, 1)
+	go func() {
+		r, err := c.WaitResult(nil)
+		if err != nil {
+			t.Errorf("WaitResult failed: %v", err)
+		}
+		results <- r
+	}()
+	if err := etcdutil.CreateJobResult(client, job, &etcdutil.JobResult{TaskID: 0, Result: []byte("loss=0.1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ShutdownJob(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-results:
+		if r == nil || string(r.Result) != "loss=0.1" {
+			t.Errorf("result = %+v, want loss=0.1", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitResult didn't return")
+	}
+
+	// A job shut down without a result has none, even once destroyed.
+	if err := etcdutil.ClearJobResult(client, job); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := c.WaitResult(nil); err != ErrNoResult {
+		t.Errorf("WaitResult of job without result = (%v, %v), want %v", r, err, ErrNoResult)
+	}
+	c.Stop()
+	if r, err := c.WaitResult(nil); err != ErrNoResult {
+		t.Errorf("WaitResult of destroyed job = (%v, %v), want %v", r, err, ErrNoResult)
+	}
+}
+
+func TestControllerLimits(t *testing.T) {
+	client := etcdutil.NewMemoryCoordinator()
+	logger := testLogger()
+
+	// The job fails once it reaches its max epochs.
+	c := New("TestControllerLimitsEpochs", client, 1)
+	c.SetLogger(logger)
+	c.SetMaxEpochs(2)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Stop()
+	for epoch := uint64(0); epoch < 2; epoch++ {
+		if err := etcdutil.CASEpoch(client, etcdutil.TextCodec, "TestControllerLimitsEpochs", epoch, epoch+1); err != nil {
+			t.Fatalf("CASEpoch to %d failed: %v", epoch+1, err)
+		}
+	}
+	_, err := c.WaitResult(nil)
+	if fe, ok := err.(*JobFailedError); !ok || fe.Reason != ReasonMaxEpochs {
+		t.Errorf("WaitResult = %v, want failure of %s", err, ReasonMaxEpochs)
+	}
+
+	// The job fails once it runs past its deadline.
+	c = New("TestControllerLimitsDeadline", client, 1)
+	c.SetLogger(logger)
+	c.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Stop()
+	_, err = c.WaitResult(nil)
+	if fe, ok := err.(*JobFailedError); !ok || fe.Reason != ReasonDeadline {
+		t.Errorf("WaitResult = %v, want failure of %s", err, ReasonDeadline)
+	}
+
+	// A job finished before its deadline doesn't fail.
+	c = New("TestControllerLimitsFinished", client, 1)
+	c.SetLogger(logger)
+	c.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Stop()
+	if err := c.ShutdownJob(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := etcdutil.GetJobFailure(client, "TestControllerLimitsFinished"); !etcdutil.IsKeyNotFound(err) {
+		t.Errorf("GetJobFailure of finished job = %v, want key not found", err)
+	}
+}
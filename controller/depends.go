@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// how often the controller checks whether the jobs it depends on are done
+var dependencyPollInterval = time.Second
+
+// waitDependencies waits for the jobs the job spec depends on to finish, and
+// sets the params of its inputs to the artifacts they exported.
+func (c *Controller) waitDependencies() error {
+	type input struct{ job, artifact string }
+	inputs := make(map[string]input)
+	deps := append([]string(nil), c.jobSpec.DependsOn...)
+	for param, s := range c.jobSpec.Inputs {
+		job, artifact, err := etcdutil.ParseInput(s)
+		if err != nil {
+			return err
+		}
+		inputs[param] = input{job, artifact}
+		deps = append(deps, job)
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+	for _, job := range deps {
+		if done, _ := etcdutil.JobDone(c.etcdclient, job); !done {
+			c.logger.Infof("job %s waits for job %s to finish", c.name, job)
+		}
+		if _, err := etcdutil.WaitJobDone(c.etcdclient, job, dependencyPollInterval, nil); err != nil {
+			return fmt.Errorf("controller failed to wait for job %s: %v", job, err)
+		}
+		// A job which failed has no outputs to depend on.
+		if f, err := etcdutil.GetJobFailure(c.etcdclient, job); err == nil {
+			return &JobFailedError{Job: job, Reason: f.Reason}
+		}
+	}
+	params := make(map[string]string)
+	for k, v := range c.jobSpec.Params {
+		params[k] = v
+	}
+	for param, in := range inputs {
+		value, err := etcdutil.GetArtifact(c.etcdclient, in.job, in.artifact)
+		if err != nil {
+			return fmt.Errorf("controller failed to get artifact %s of job %s: %v", in.artifact, in.job, err)
+		}
+		params[param] = value
+	}
+	c.jobSpec.Params = params
+	c.events.record("jobs %v it depends on have finished", deps)
+	return nil
+}
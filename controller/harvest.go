@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// HarvestManifest is the manifest.json of a harvest: what it has of the job,
+// and what is missing.
+type HarvestManifest struct {
+	Job         string
+	HarvestedAt time.Time
+	// nil if the job had no layout left, e.g. as its controller destroyed it
+	Status *JobStatus
+	// why the controller failed the job, if it did
+	Failure *etcdutil.JobFailure
+	// latest checkpoint of each task which has one
+	Checkpoints []HarvestedCheckpoint
+	// tasks without a checkpoint, and tasks which hadn't finished
+	MissingCheckpoints []uint64
+	UnfinishedTasks    []uint64
+	// keys of the results and names of the artifacts of the job
+	Results   []string
+	Artifacts []string
+}
+
+type HarvestedCheckpoint struct {
+	TaskID uint64
+	Epoch  uint64
+	// name of the file of the snapshot in the harvest
+	File string
+}
+
+// Harvest saves whatever the job has produced, e.g. as it failed 90% through
+// an expensive run, as {job}-harvest.tar.gz to dest. The harvest has:
+//
+//	manifest.json                  HarvestManifest
+//	checkpoints/{taskID}-{epoch}   latest snapshot of each task
+//	results.json                   results of the job by key
+//	artifacts.json                 artifacts of the job by name
+//	events.log                     one event of the controller per line
+//
+// Unlike Archive, it takes a job in any state, and leaves etcd untouched.
+// Results and artifacts outlive the layout of the job, so they are harvested
+// even once it is destroyed, while checkpoints are not.
+func (c *Controller) Harvest(dest ObjectStore) (*HarvestManifest, error) {
+	m := &HarvestManifest{Job: c.name, HarvestedAt: time.Now()}
+	numOfTasks := uint64(0)
+	if _, err := etcdutil.GetEpochChange(c.etcdclient, c.codec, c.name); err == nil {
+		if m.Status, err = c.Status(); err != nil {
+			return nil, err
+		}
+		numOfTasks = m.Status.NumOfTasks
+	} else if !etcdutil.IsKeyNotFound(err) {
+		return nil, err
+	}
+
+	if f, err := etcdutil.GetJobFailure(c.etcdclient, c.name); err == nil {
+		m.Failure = f
+	} else if !etcdutil.IsKeyNotFound(err) {
+		return nil, err
+	}
+
+	var files []harvestFile
+	for id := uint64(0); id < numOfTasks; id++ {
+		epoch, data, found, err := etcdutil.GetLatestCheckpoint(c.etcdclient, c.name, id)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			m.MissingCheckpoints = append(m.MissingCheckpoints, id)
+			continue
+		}
+		name := "checkpoints/" + strconv.FormatUint(id, 10) + "-" + strconv.FormatUint(epoch, 10)
+		m.Checkpoints = append(m.Checkpoints, HarvestedCheckpoint{TaskID: id, Epoch: epoch, File: name})
+		files = append(files, harvestFile{name, data})
+	}
+	if m.Status != nil {
+		for _, ts := range m.Status.Tasks {
+			if ts.State != TaskFinished {
+				m.UnfinishedTasks = append(m.UnfinishedTasks, ts.ID)
+			}
+		}
+	}
+
+	results, err := etcdutil.GetResults(c.etcdclient, c.name)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := etcdutil.GetArtifacts(c.etcdclient, c.name)
+	if err != nil {
+		return nil, err
+	}
+	m.Results, m.Artifacts = sortedKeys(results), sortedKeys(artifacts)
+	for _, f := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"results.json", results},
+		{"artifacts.json", artifacts},
+		{"manifest.json", m},
+	} {
+		b, err := json.MarshalIndent(f.v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, harvestFile{f.name, b})
+	}
+	files = append(files, harvestFile{"events.log", c.events.bytes()})
+
+	var buf bytes.Buffer
+	if err := writeHarvest(&buf, files, m.HarvestedAt); err != nil {
+		return nil, err
+	}
+	if err := dest.Put(c.name+"-harvest.tar.gz", &buf); err != nil {
+		return nil, fmt.Errorf("controller failed to save harvest: %v", err)
+	}
+	c.logger.Infof("controller harvested job %s: %d checkpoints, %d results, %d artifacts",
+		c.name, len(m.Checkpoints), len(m.Results), len(m.Artifacts))
+	return m, nil
+}
+
+type harvestFile struct {
+	name string
+	data []byte
+}
+
+func writeHarvest(w io.Writer, files []harvestFile, at time.Time) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), ModTime: at}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Reasons the controller fails jobs with, see etcdutil.JobFailure.
+const (
+	ReasonDeadline  = "deadline exceeded"
+	ReasonMaxEpochs = "max epochs exceeded"
+)
+
+// JobFailedError is returned by WaitResult for a job the controller failed,
+// e.g. as it ran past its deadline.
+type JobFailedError struct {
+	Job    string
+	Reason string
+}
+
+func (e *JobFailedError) Error() string {
+	return "controller: job " + e.Job + " failed: " + e.Reason
+}
+
+// SetDeadline makes the controller fail the job, and shut it down, if it is
+// still running at t, so that a runaway job doesn't run until someone
+// notices. A controller resuming the job needs the deadline set again. It
+// must be called before Start or Resume.
+func (c *Controller) SetDeadline(t time.Time) { c.deadline = t }
+
+// SetMaxEpochs makes the controller fail the job, and shut it down, once it
+// reaches epoch n, i.e. after n epochs. It must be called before Start or
+// Resume.
+func (c *Controller) SetMaxEpochs(n uint64) { c.maxEpochs = n }
+
+// enforceDeadline fails the job at deadline unless stop is closed first.
+func (c *Controller) enforceDeadline(deadline time.Time, stop chan struct{}) {
+	if deadline.IsZero() {
+		return
+	}
+	select {
+	case <-time.After(deadline.Sub(time.Now())):
+	case <-stop:
+		return
+	}
+	c.failJob(ReasonDeadline)
+}
+
+// failJob records why the job failed, unless it has finished meanwhile, and
+// shuts it down. The tasks exit as when any task shuts the job down.
+func (c *Controller) failJob(reason string) {
+	epoch, err := c.GetEpoch()
+	if err == nil && epoch == etcdutil.ExitEpoch {
+		return
+	}
+	err = c.retry.Do(func() error {
+		err := etcdutil.CreateJobFailure(c.etcdclient, c.name, &etcdutil.JobFailure{Reason: reason, At: time.Now()})
+		if err != nil && etcdutil.IsNodeExist(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		c.etcdErrors.Inc()
+		c.logger.Errorf("controller failed to record that job %s failed: %v", c.name, err)
+	}
+	c.events.record("failed: %s", reason)
+	c.logger.Warnf("job %s failed: %s; shutting down", c.name, reason)
+	for {
+		// A task might advance the epoch meanwhile.
+		err := c.retry.Do(c.ShutdownJob)
+		if err == nil || !etcdutil.IsCompareFailed(err) {
+			if err != nil {
+				c.logger.Errorf("controller failed to shut down failed job: %v", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,433 @@
+/*
+Package mesos gets the containers of jobs from Apache Mesos, as a framework
+of the Mesos scheduler HTTP API (v1). It implements
+controller.ResourceManager:
+
+	s := mesos.NewScheduler("http://mesos-master:5050", "meritop")
+	if err := s.Start(); err != nil {
+		...
+	}
+	c.SetResourceManager(s, spec)
+
+Containers are launched as Mesos tasks on the agents whose offers fit them,
+and serve the other nodes on the hostname of their agent. Containers which
+fail or are lost are launched again, while the controller fails their meritop
+tasks over through etcd, so that the new nodes take them over.
+
+It talks to the master over HTTP rather than through a client library, so
+that meritop doesn't depend on one.
+*/
+package mesos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/pkg/kube"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+const (
+	schedulerPath  = "/api/v1/scheduler"
+	streamIDHeader = "Mesos-Stream-Id"
+	// how long Mesos holds back offers the scheduler declines
+	refuseSeconds = 5
+)
+
+// ErrNotSubscribed is returned for calls before the scheduler subscribed to
+// the master, or after it stopped.
+var ErrNotSubscribed = errors.New("mesos: scheduler isn't subscribed to the master")
+
+// Scheduler is a Mesos framework launching containers of meritop jobs.
+type Scheduler struct {
+	master string
+	name   string
+	user   string
+	client *http.Client
+	logger logging.Logger
+
+	mu          sync.Mutex
+	streamID    string
+	frameworkID string
+	body        io.ReadCloser
+	lastID      uint64
+	// containers waiting for an offer, in order
+	pending []*container
+	// containers launched, by ID
+	launched map[string]*container
+}
+
+type container struct {
+	id   string
+	spec controller.ContainerSpec
+	// launches so far, and the agent of the last one
+	attempt int
+	agentID string
+}
+
+// taskID returns the ID of the Mesos task of the last launch, as Mesos
+// tasks aren't launched twice.
+func (c *container) taskID() string { return c.id + "." + strconv.Itoa(c.attempt) }
+
+// NewScheduler returns a scheduler of the framework of the name on the Mesos
+// master at the URL, e.g. http://10.0.0.1:5050.
+func NewScheduler(master, name string) *Scheduler {
+	return &Scheduler{
+		master:   strings.TrimSuffix(master, "/"),
+		name:     name,
+		user:     "root",
+		client:   &http.Client{},
+		logger:   logging.Default().With("mesos", name),
+		launched: make(map[string]*container),
+	}
+}
+
+// SetUser sets the user containers run as. The default is root.
+func (s *Scheduler) SetUser(user string) { s.user = user }
+
+// SetLogger replaces the default logger, which logs to stdout.
+func (s *Scheduler) SetLogger(l logging.Logger) { s.logger = l.With("mesos", s.name) }
+
+// Start subscribes the framework to the master, and handles the events of
+// the master until Stop.
+func (s *Scheduler) Start() error {
+	sub := call{
+		Type: "SUBSCRIBE",
+		Subscribe: &subscribe{FrameworkInfo: frameworkInfo{
+			User: s.user,
+			Name: s.name,
+			// Containers outlive the scheduler for a while, e.g. across a
+			// restart of the controller.
+			FailoverTimeout: time.Minute.Seconds(),
+		}},
+	}
+	resp, err := s.post(sub, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return statusError(resp)
+	}
+	s.mu.Lock()
+	s.streamID = resp.Header.Get(streamIDHeader)
+	s.body = resp.Body
+	s.mu.Unlock()
+	r := bufio.NewReader(resp.Body)
+	// The first event is SUBSCRIBED.
+	if err := s.nextEvent(r); err != nil {
+		resp.Body.Close()
+		return err
+	}
+	if s.framework() == "" {
+		resp.Body.Close()
+		return ErrNotSubscribed
+	}
+	go s.events(r)
+	return nil
+}
+
+// Stop unsubscribes the framework. Its containers are killed once the
+// failover timeout of the framework is over.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.body != nil {
+		s.body.Close()
+		s.body = nil
+	}
+}
+
+// RequestContainers queues n containers running spec, which are launched as
+// offers fitting them come in. Containers take a CPU and 512 MB of memory
+// unless spec says otherwise, and run meritop-worker unless spec has a
+// command.
+func (s *Scheduler) RequestContainers(n int, spec controller.ContainerSpec) ([]string, error) {
+	if s.framework() == "" {
+		return nil, ErrNotSubscribed
+	}
+	if spec.CPUs == 0 {
+		spec.CPUs = 1
+	}
+	if spec.MemoryMB == 0 {
+		spec.MemoryMB = 512
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, n)
+	for i := range ids {
+		s.lastID++
+		ids[i] = s.name + "-" + strconv.FormatUint(s.lastID, 10)
+		s.pending = append(s.pending, &container{id: ids[i], spec: spec})
+	}
+	return ids, nil
+}
+
+// ReleaseContainer kills the container of the ID, or drops it if it hasn't
+// been launched yet.
+func (s *Scheduler) ReleaseContainer(id string) error {
+	s.mu.Lock()
+	for i, c := range s.pending {
+		if c.id == id {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	c, ok := s.launched[id]
+	delete(s.launched, id)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.call(call{
+		Type: "KILL",
+		Kill: &kill{TaskID: value{c.taskID()}, AgentID: value{c.agentID}},
+	})
+}
+
+func (s *Scheduler) framework() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frameworkID
+}
+
+// events handles the events of the master until the stream ends.
+func (s *Scheduler) events(r *bufio.Reader) {
+	for {
+		if err := s.nextEvent(r); err != nil {
+			s.mu.Lock()
+			stopped := s.body == nil
+			s.frameworkID = ""
+			s.mu.Unlock()
+			if !stopped {
+				s.logger.Errorf("mesos: lost the event stream of the master: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// nextEvent reads and handles an event in RecordIO format, i.e. the length
+// of the record, a newline and the record.
+func (s *Scheduler) nextEvent(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return fmt.Errorf("mesos: bad record length %q", line)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	var e event
+	if err := json.Unmarshal(b, &e); err != nil {
+		return err
+	}
+	s.handle(&e)
+	return nil
+}
+
+func (s *Scheduler) handle(e *event) {
+	switch e.Type {
+	case "SUBSCRIBED":
+		s.mu.Lock()
+		s.frameworkID = e.Subscribed.FrameworkID.Value
+		s.mu.Unlock()
+		s.logger.Infof("mesos: subscribed as framework %s", e.Subscribed.FrameworkID.Value)
+	case "OFFERS":
+		for i := range e.Offers.Offers {
+			s.handleOffer(&e.Offers.Offers[i])
+		}
+	case "UPDATE":
+		s.handleUpdate(&e.Update.Status)
+	case "ERROR":
+		s.logger.Errorf("mesos: master error: %s", e.Error.Message)
+	}
+}
+
+// handleOffer launches the pending containers which fit the offer, in order,
+// or declines it.
+func (s *Scheduler) handleOffer(o *offer) {
+	cpus, mem := o.scalar("cpus"), o.scalar("mem")
+	var tasks []taskInfo
+	s.mu.Lock()
+	for len(s.pending) > 0 {
+		c := s.pending[0]
+		if c.spec.CPUs > cpus || c.spec.MemoryMB > mem {
+			break
+		}
+		cpus -= c.spec.CPUs
+		mem -= c.spec.MemoryMB
+		s.pending = s.pending[1:]
+		c.attempt++
+		c.agentID = o.AgentID.Value
+		s.launched[c.id] = c
+		tasks = append(tasks, newTaskInfo(c, o))
+	}
+	s.mu.Unlock()
+
+	if len(tasks) == 0 {
+		s.callAsync(call{
+			Type:    "DECLINE",
+			Decline: &decline{OfferIDs: []value{o.ID}, Filters: filters{RefuseSeconds: refuseSeconds}},
+		})
+		return
+	}
+	s.callAsync(call{
+		Type: "ACCEPT",
+		Accept: &accept{
+			OfferIDs: []value{o.ID},
+			Operations: []operation{{
+				Type:   "LAUNCH",
+				Launch: &launch{TaskInfos: tasks},
+			}},
+			Filters: filters{RefuseSeconds: refuseSeconds},
+		},
+	})
+}
+
+// handleUpdate acknowledges an update of a container, and launches it again
+// if it failed.
+func (s *Scheduler) handleUpdate(st *taskStatus) {
+	if st.UUID != "" {
+		s.callAsync(call{
+			Type:        "ACKNOWLEDGE",
+			Acknowledge: &acknowledge{AgentID: st.AgentID, TaskID: st.TaskID, UUID: st.UUID},
+		})
+	}
+	var failed bool
+	switch st.State {
+	case "TASK_FAILED", "TASK_LOST", "TASK_ERROR", "TASK_DROPPED", "TASK_GONE":
+		failed = true
+	case "TASK_FINISHED", "TASK_KILLED":
+	default:
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var c *container
+	for _, lc := range s.launched {
+		if lc.taskID() == st.TaskID.Value {
+			c = lc
+		}
+	}
+	if c == nil {
+		return
+	}
+	delete(s.launched, c.id)
+	if !failed {
+		return
+	}
+	s.logger.Warnf("mesos: container %s is %s: %s, launching it again", c.id, st.State, st.Message)
+	c.agentID = ""
+	s.pending = append(s.pending, c)
+}
+
+func newTaskInfo(c *container, o *offer) taskInfo {
+	env := environment{Variables: []variable{}}
+	var names []string
+	for k := range c.spec.Env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		env.Variables = append(env.Variables, variable{Name: k, Value: c.spec.Env[k]})
+	}
+	if _, ok := c.spec.Env[kube.EnvListen]; !ok {
+		env.Variables = append(env.Variables, variable{Name: kube.EnvListen, Value: o.Hostname + ":0"})
+	}
+	cmd := c.spec.Command
+	if cmd == "" {
+		cmd = "meritop-worker"
+	}
+	shell := false
+	t := taskInfo{
+		Name:    c.id,
+		TaskID:  value{c.taskID()},
+		AgentID: o.AgentID,
+		Resources: []resource{
+			{Name: "cpus", Type: "SCALAR", Scalar: &scalar{c.spec.CPUs}},
+			{Name: "mem", Type: "SCALAR", Scalar: &scalar{c.spec.MemoryMB}},
+		},
+		Command: &commandInfo{
+			Value:       cmd,
+			Shell:       &shell,
+			Arguments:   append([]string{cmd}, c.spec.Args...),
+			Environment: env,
+		},
+	}
+	if c.spec.Image != "" {
+		t.Container = &containerInfo{
+			Type:  "MESOS",
+			Mesos: &mesosInfo{Image: image{Type: "DOCKER", Docker: &dockerImage{Name: c.spec.Image}}},
+		}
+	}
+	return t
+}
+
+// call makes a call of the framework to the master.
+func (s *Scheduler) call(c call) error {
+	s.mu.Lock()
+	c.FrameworkID = &value{s.frameworkID}
+	streamID := s.streamID
+	s.mu.Unlock()
+	if c.FrameworkID.Value == "" {
+		return ErrNotSubscribed
+	}
+	resp, err := s.post(c, streamID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// callAsync makes a call without holding up the event stream.
+func (s *Scheduler) callAsync(c call) {
+	go func() {
+		if err := s.call(c); err != nil {
+			s.logger.Errorf("mesos: %s failed: %v", c.Type, err)
+		}
+	}()
+}
+
+func (s *Scheduler) post(c call, streamID string) (*http.Response, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", s.master+schedulerPath, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if streamID != "" {
+		req.Header.Set(streamIDHeader, streamID)
+	}
+	return s.client.Do(req)
+}
+
+func statusError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("mesos: master responded %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,132 @@
+package mesos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/pkg/kube"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// fakeMaster streams the events sent on events to the subscriber, and
+// passes the other calls on to calls.
+type fakeMaster struct {
+	events chan string
+	calls  chan call
+	done   chan struct{}
+}
+
+func (m *fakeMaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var c call
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if c.Type != "SUBSCRIBE" {
+		if r.Header.Get(streamIDHeader) != "stream" {
+			http.Error(w, "no stream", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		m.calls <- c
+		return
+	}
+	w.Header().Set(streamIDHeader, "stream")
+	send := func(e string) {
+		fmt.Fprintf(w, "%d\n%s", len(e), e)
+		w.(http.Flusher).Flush()
+	}
+	send(`{"type":"SUBSCRIBED","subscribed":{"framework_id":{"value":"fw"}}}`)
+	for {
+		select {
+		case e := <-m.events:
+			send(e)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func offerEvent(id string, cpus, mem float64) string {
+	return fmt.Sprintf(`{"type":"OFFERS","offers":{"offers":[{"id":{"value":%q},"agent_id":{"value":"agent"},"hostname":"host1",`+
+		`"resources":[{"name":"cpus","type":"SCALAR","scalar":{"value":%g}},{"name":"mem","type":"SCALAR","scalar":{"value":%g}}]}]}}`, id, cpus, mem)
+}
+
+func (m *fakeMaster) next(t *testing.T) call {
+	select {
+	case c := <-m.calls:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no call")
+	}
+	return call{}
+}
+
+func TestScheduler(t *testing.T) {
+	m := &fakeMaster{events: make(chan string), calls: make(chan call, 10), done: make(chan struct{})}
+	hs := httptest.NewServer(m)
+	defer hs.Close()
+	defer close(m.done)
+
+	s := NewScheduler(hs.URL, "test")
+	s.SetLogger(logging.NewStd(log.New(ioutil.Discard, "", 0), logging.Info))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+	spec := controller.ContainerSpec{Image: "meritop-worker", CPUs: 1, MemoryMB: 100, Env: map[string]string{kube.EnvJob: "job"}}
+	ids, err := s.RequestContainers(3, spec)
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("RequestContainers = (%v, %v), want 3 IDs", ids, err)
+	}
+
+	// An offer for two containers launches the first two.
+	m.events <- offerEvent("o1", 2.5, 1000)
+	c := m.next(t)
+	if c.Type != "ACCEPT" || c.FrameworkID.Value != "fw" || len(c.Accept.Operations) != 1 {
+		t.Fatalf("call = %+v, want ACCEPT", c)
+	}
+	tasks := c.Accept.Operations[0].Launch.TaskInfos
+	if len(tasks) != 2 || tasks[0].TaskID.Value != ids[0]+".1" || tasks[1].TaskID.Value != ids[1]+".1" {
+		t.Fatalf("launched %+v, want %s and %s", tasks, ids[0], ids[1])
+	}
+	env := tasks[0].Command.Environment.Variables
+	if len(env) != 2 || env[0] != (variable{kube.EnvJob, "job"}) || env[1] != (variable{kube.EnvListen, "host1:0"}) {
+		t.Errorf("env = %v", env)
+	}
+	if tasks[0].Container.Mesos.Image.Docker.Name != "meritop-worker" {
+		t.Errorf("image = %+v", tasks[0].Container.Mesos.Image)
+	}
+
+	// An offer too small is declined.
+	m.events <- offerEvent("o2", 0.5, 1000)
+	if c := m.next(t); c.Type != "DECLINE" || c.Decline.OfferIDs[0].Value != "o2" {
+		t.Fatalf("call = %+v, want DECLINE of o2", c)
+	}
+
+	// A failed container is launched again, after the pending one.
+	m.events <- `{"type":"UPDATE","update":{"status":{"task_id":{"value":"` + ids[0] + `.1"},"agent_id":{"value":"agent"},"state":"TASK_FAILED","uuid":"dXVpZA=="}}}`
+	if c := m.next(t); c.Type != "ACKNOWLEDGE" || c.Acknowledge.UUID != "dXVpZA==" {
+		t.Fatalf("call = %+v, want ACKNOWLEDGE", c)
+	}
+	m.events <- offerEvent("o3", 4, 1000)
+	c = m.next(t)
+	tasks = c.Accept.Operations[0].Launch.TaskInfos
+	if len(tasks) != 2 || tasks[0].TaskID.Value != ids[2]+".1" || tasks[1].TaskID.Value != ids[0]+".2" {
+		t.Fatalf("launched %+v, want %s and %s again", tasks, ids[2], ids[0])
+	}
+
+	if err := s.ReleaseContainer(ids[1]); err != nil {
+		t.Fatalf("ReleaseContainer failed: %v", err)
+	}
+	if c := m.next(t); c.Type != "KILL" || c.Kill.TaskID.Value != ids[1]+".1" {
+		t.Fatalf("call = %+v, want KILL of %s", c, ids[1])
+	}
+}
@@ -0,0 +1,158 @@
+package mesos
+
+// The JSON messages of the scheduler HTTP API, as far as the scheduler uses
+// them. See mesos/v1/scheduler/scheduler.proto.
+
+type value struct {
+	Value string `json:"value"`
+}
+
+type call struct {
+	FrameworkID *value       `json:"framework_id,omitempty"`
+	Type        string       `json:"type"`
+	Subscribe   *subscribe   `json:"subscribe,omitempty"`
+	Accept      *accept      `json:"accept,omitempty"`
+	Decline     *decline     `json:"decline,omitempty"`
+	Kill        *kill        `json:"kill,omitempty"`
+	Acknowledge *acknowledge `json:"acknowledge,omitempty"`
+}
+
+type subscribe struct {
+	FrameworkInfo frameworkInfo `json:"framework_info"`
+}
+
+type frameworkInfo struct {
+	User            string  `json:"user"`
+	Name            string  `json:"name"`
+	FailoverTimeout float64 `json:"failover_timeout,omitempty"`
+}
+
+type filters struct {
+	RefuseSeconds float64 `json:"refuse_seconds,omitempty"`
+}
+
+type accept struct {
+	OfferIDs   []value     `json:"offer_ids"`
+	Operations []operation `json:"operations"`
+	Filters    filters     `json:"filters"`
+}
+
+type decline struct {
+	OfferIDs []value `json:"offer_ids"`
+	Filters  filters `json:"filters"`
+}
+
+type kill struct {
+	TaskID  value `json:"task_id"`
+	AgentID value `json:"agent_id"`
+}
+
+type acknowledge struct {
+	AgentID value  `json:"agent_id"`
+	TaskID  value  `json:"task_id"`
+	UUID    string `json:"uuid"`
+}
+
+type operation struct {
+	Type   string  `json:"type"`
+	Launch *launch `json:"launch,omitempty"`
+}
+
+type launch struct {
+	TaskInfos []taskInfo `json:"task_infos"`
+}
+
+type taskInfo struct {
+	Name      string         `json:"name"`
+	TaskID    value          `json:"task_id"`
+	AgentID   value          `json:"agent_id"`
+	Resources []resource     `json:"resources"`
+	Command   *commandInfo   `json:"command,omitempty"`
+	Container *containerInfo `json:"container,omitempty"`
+}
+
+type resource struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Scalar *scalar `json:"scalar,omitempty"`
+}
+
+type scalar struct {
+	Value float64 `json:"value"`
+}
+
+type commandInfo struct {
+	Value       string      `json:"value"`
+	Shell       *bool       `json:"shell,omitempty"`
+	Arguments   []string    `json:"arguments,omitempty"`
+	Environment environment `json:"environment"`
+}
+
+type environment struct {
+	Variables []variable `json:"variables"`
+}
+
+type variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type containerInfo struct {
+	Type  string     `json:"type"`
+	Mesos *mesosInfo `json:"mesos,omitempty"`
+}
+
+type mesosInfo struct {
+	Image image `json:"image"`
+}
+
+type image struct {
+	Type   string       `json:"type"`
+	Docker *dockerImage `json:"docker,omitempty"`
+}
+
+type dockerImage struct {
+	Name string `json:"name"`
+}
+
+type event struct {
+	Type       string `json:"type"`
+	Subscribed struct {
+		FrameworkID value `json:"framework_id"`
+	} `json:"subscribed"`
+	Offers struct {
+		Offers []offer `json:"offers"`
+	} `json:"offers"`
+	Update struct {
+		Status taskStatus `json:"status"`
+	} `json:"update"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type offer struct {
+	ID        value      `json:"id"`
+	AgentID   value      `json:"agent_id"`
+	Hostname  string     `json:"hostname"`
+	Resources []resource `json:"resources"`
+}
+
+// scalar returns the amount of the scalar resource of the name offered.
+func (o *offer) scalar(name string) float64 {
+	v := 0.0
+	for _, r := range o.Resources {
+		if r.Name == name && r.Scalar != nil {
+			v += r.Scalar.Value
+		}
+	}
+	return v
+}
+
+type taskStatus struct {
+	TaskID  value  `json:"task_id"`
+	AgentID value  `json:"agent_id"`
+	State   string `json:"state"`
+	Message string `json:"message"`
+	UUID    string `json:"uuid"`
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// followEpochs follows the job through the phases of its spec until stop,
+// shuts it down once the last phase is over, fails it once it reaches its
+// max epochs, and records once it has finished for the jobs depending on it.
+func (c *Controller) followEpochs(phases []etcdutil.PhaseSpec, stop chan bool) {
+	changeC := make(chan *etcdutil.EpochChange, 1)
+	ec, err := etcdutil.GetAndWatchEpoch(c.etcdclient, c.codec, c.name, changeC, stop)
+	if err != nil {
+		c.logger.Errorf("controller failed to watch the epoch: %v", err)
+		return
+	}
+	current := -1
+	first := ec.Epoch
+	stragglers := make(map[uint64]bool)
+	for ec.Epoch != etcdutil.ExitEpoch {
+		// Timings are recorded as epochs end.
+		if ec.Epoch != first {
+			c.warnStragglers(stragglers)
+		}
+		if c.maxEpochs > 0 && ec.Epoch >= c.maxEpochs {
+			c.failJob(ReasonMaxEpochs)
+		} else if len(phases) > 0 {
+			i, ok := etcdutil.PhaseAt(phases, ec.Epoch)
+			switch {
+			case !ok:
+				// A failure, e.g. of CAS against a new epoch, is retried at
+				// the next epoch.
+				if err := c.ShutdownJob(); err != nil {
+					c.logger.Errorf("controller failed to shut down job after its phases: %v", err)
+				}
+			case i != current:
+				current = i
+				c.events.record("phase %s started at epoch %d", phases[i].Name, ec.Epoch)
+				c.logger.Infof("job %s enters phase %s at epoch %d", c.name, phases[i].Name, ec.Epoch)
+			}
+		}
+		select {
+		case ec = <-changeC:
+		case <-stop:
+			return
+		}
+	}
+	c.recordDone()
+}
+
+// recordDone records that the job has finished, if it has, for the jobs
+// depending on it. The record outlives the layout of the job.
+func (c *Controller) recordDone() {
+	epoch, err := c.GetEpoch()
+	if err != nil || epoch != etcdutil.ExitEpoch {
+		return
+	}
+	if done, _ := etcdutil.JobDone(c.etcdclient, c.name); done {
+		return
+	}
+	err = c.retry.Do(func() error {
+		return etcdutil.SetJobDone(c.etcdclient, c.name, time.Now())
+	})
+	if err != nil {
+		c.etcdErrors.Inc()
+		c.logger.Errorf("controller failed to record that job %s has finished: %v", c.name, err)
+	}
+}
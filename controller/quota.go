@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+var ErrQuotaExceeded = errors.New("controller: quota exceeded")
+
+// Quota limits the resources a job can use, so that one runaway experiment
+// can't exhaust the shared etcd or storage. Zero means no limit.
+type Quota struct {
+	// Requests to have more tasks are rejected.
+	MaxTasks uint64
+	// Restarts of failed tasks beyond this are delayed until the rate of the
+	// last hour drops below it.
+	MaxRestartsPerHour int
+	// A job storing more keys or checkpoint bytes in etcd is shut down.
+	// Checkpoint bytes are the sizes of snapshots in the default etcd
+	// checkpoint store; snapshots in other stores, e.g. checkpoint.NewFileStore,
+	// are not counted.
+	MaxEtcdKeys        int
+	MaxCheckpointBytes int
+	// How often etcd usage is evaluated. Default is one minute.
+	CheckInterval time.Duration
+}
+
+// SetQuota sets the quota of the job. It must be called before Start.
+func (c *Controller) SetQuota(q Quota) {
+	if q.CheckInterval == 0 {
+		q.CheckInterval = time.Minute
+	}
+	c.quota = q
+	c.restarts = newRestartLimiter(q.MaxRestartsPerHour, time.Hour)
+}
+
+func (c *Controller) checkTasksQuota(numOfTasks uint64) error {
+	if c.quota.MaxTasks != 0 && numOfTasks > c.quota.MaxTasks {
+		c.logger.Warnf("job %s wants %d tasks, quota is %d", c.name, numOfTasks, c.quota.MaxTasks)
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// reportFailure lets a new node take over the failed task, throttled by the
+// restart quota.
+func (c *Controller) reportFailure(failedTask string) {
+	c.failuresDetected.Inc()
+	c.events.record("task %s failed", failedTask)
+	delay := c.restarts.reserve(time.Now())
+	report := func() {
+		err := c.retry.Do(func() error {
+			return etcdutil.ReportFailure(c.etcdclient, c.name, failedTask)
+		})
+		if err != nil {
+			c.etcdErrors.Inc()
+			c.logger.Errorf("ReportFailure returns error: %v", err)
+		}
+	}
+	if delay <= 0 {
+		report()
+		return
+	}
+	c.logger.Warnf("job %s exceeds restart quota, restarting task %s in %v", c.name, failedTask, delay)
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	if c.restartsStopped {
+		return
+	}
+	c.restartsDelayed.Inc()
+	c.delayedRestarts = append(c.delayedRestarts, time.AfterFunc(delay, func() {
+		c.restartMu.Lock()
+		defer c.restartMu.Unlock()
+		// The job might be gone, and reporting would bring the task back.
+		if !c.restartsStopped {
+			report()
+		}
+	}))
+}
+
+// stopDelayedRestarts cancels restarts waiting for the restart quota.
+func (c *Controller) stopDelayedRestarts() {
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	c.restartsStopped = true
+	for _, t := range c.delayedRestarts {
+		t.Stop()
+	}
+	c.delayedRestarts = nil
+}
+
+// enforceUsageQuota periodically evaluates etcd usage of the job and shuts it
+// down if it is over quota.
+func (c *Controller) enforceUsageQuota(stop chan struct{}) {
+	if c.quota.MaxEtcdKeys == 0 && c.quota.MaxCheckpointBytes == 0 {
+		return
+	}
+	for {
+		select {
+		case <-time.After(c.quota.CheckInterval):
+		case <-stop:
+			return
+		}
+		keys, checkpointBytes, err := c.etcdUsage()
+		if err != nil {
+			c.logger.Errorf("controller failed to get etcd usage: %v", err)
+			continue
+		}
+		if (c.quota.MaxEtcdKeys != 0 && keys > c.quota.MaxEtcdKeys) ||
+			(c.quota.MaxCheckpointBytes != 0 && checkpointBytes > c.quota.MaxCheckpointBytes) {
+			c.logger.Warnf("job %s exceeds quota: %d keys, %d checkpoint bytes; shutting down",
+				c.name, keys, checkpointBytes)
+			if err := c.ShutdownJob(); err != nil {
+				c.logger.Errorf("controller failed to shutdown job: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// etcdUsage returns the number of keys and the bytes of checkpoints the job
+// keeps in etcd. Checkpoints are counted by their decoded sizes.
+func (c *Controller) etcdUsage() (keys, checkpointBytes int, err error) {
+	resp, err := c.etcdclient.Get(etcdutil.JobPath(c.name), false, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	checkpointDir := etcdutil.CheckpointPath(c.name)
+	var walk func(n *etcd.Node, inCheckpoint bool)
+	walk = func(n *etcd.Node, inCheckpoint bool) {
+		inCheckpoint = inCheckpoint || n.Key == checkpointDir
+		if !n.Dir {
+			keys++
+			if inCheckpoint {
+				checkpointBytes += checkpointSize(n.Value)
+			}
+		}
+		for _, child := range n.Nodes {
+			walk(child, inCheckpoint)
+		}
+	}
+	walk(resp.Node, false)
+	return keys, checkpointBytes, nil
+}
+
+// checkpointSize returns the size of a snapshot stored base64 encoded in etcd.
+func checkpointSize(value string) int {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return len(value)
+	}
+	return len(data)
+}
+
+// restartLimiter allows at most max restarts in any window of given length.
+type restartLimiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Duration
+	// scheduled restart times, oldest first
+	times []time.Time
+}
+
+func newRestartLimiter(max int, window time.Duration) *restartLimiter {
+	return &restartLimiter{max: max, window: window}
+}
+
+// reserve schedules a restart and returns how long it must wait.
+func (l *restartLimiter) reserve(now time.Time) time.Duration {
+	if l == nil || l.max <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// forget restarts out of the window
+	for len(l.times) > 0 && !l.times[0].After(now.Add(-l.window)) {
+		l.times = l.times[1:]
+	}
+	at := now
+	if len(l.times) >= l.max {
+		// wait until the one max restarts before leaves the window
+		at = l.times[len(l.times)-l.max].Add(l.window)
+	}
+	l.times = append(l.times, at)
+	return at.Sub(now)
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartLimiter(t *testing.T) {
+	start := time.Now()
+	l := newRestartLimiter(2, time.Hour)
+	tests := []struct {
+		at   time.Duration
+		wait time.Duration
+	}{
+		{0, 0},
+		{time.Minute, 0},
+		// third restart within the hour waits for the first to leave the window
+		{2 * time.Minute, 58 * time.Minute},
+		// and the fourth for the second
+		{3 * time.Minute, 58 * time.Minute},
+		// long after, no waiting
+		{5 * time.Hour, 0},
+	}
+	for i, tt := range tests {
+		if wait := l.reserve(start.Add(tt.at)); wait != tt.wait {
+			t.Errorf("#%d: wait want = %v, get = %v", i, tt.wait, wait)
+		}
+	}
+}
+
+// Requests beyond the task quota are rejected before touching etcd.
+func TestTasksQuota(t *testing.T) {
+	c := &Controller{
+		name:       "TestTasksQuota",
+		numOfTasks: 5,
+		logger:     testLogger(),
+	}
+	c.SetQuota(Quota{MaxTasks: 4})
+	if err := c.InitEtcdLayout(); err != ErrQuotaExceeded {
+		t.Errorf("InitEtcdLayout beyond quota: err want = %v, get = %v", ErrQuotaExceeded, err)
+	}
+	c.numOfTasks = 3
+	if err := c.AddTasks(2); err != ErrQuotaExceeded {
+		t.Errorf("AddTasks beyond quota: err want = %v, get = %v", ErrQuotaExceeded, err)
+	}
+}
+
+// Restarts delayed by the quota must not recreate free tasks after Stop.
+func TestDelayedRestartsStopped(t *testing.T) {
+	c := &Controller{
+		name:   "TestDelayedRestartsStopped",
+		logger: testLogger(),
+	}
+	c.SetQuota(Quota{MaxRestartsPerHour: 1})
+	c.restarts.reserve(time.Now())
+
+	c.reportFailure("0")
+	if len(c.delayedRestarts) != 1 {
+		t.Fatalf("delayed restarts want = 1, get = %d", len(c.delayedRestarts))
+	}
+	c.stopDelayedRestarts()
+	c.reportFailure("1")
+	if len(c.delayedRestarts) != 0 {
+		t.Errorf("delayed restarts after stop want = 0, get = %d", len(c.delayedRestarts))
+	}
+	if n := c.failuresDetected.Value(); n != 2 {
+		t.Errorf("failures detected want = 2, get = %d", n)
+	}
+	if n := c.restartsDelayed.Value(); n != 1 {
+		t.Errorf("restarts delayed want = 1, get = %d", n)
+	}
+}
+
+func TestCheckpointQuotaSize(t *testing.T) {
+	tests := []struct {
+		value string
+		size  int
+	}{
+		{"", 0},
+		{"YQ==", 1},
+		{"AAEC", 3},
+		// not base64, counted as is
+		{"a!", 2},
+	}
+	for i, tt := range tests {
+		if size := checkpointSize(tt.value); size != tt.size {
+			t.Errorf("#%d: checkpointSize(%q) = %d, want %d", i, tt.value, size, tt.size)
+		}
+	}
+}
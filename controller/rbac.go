@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Role decides which admin operations a caller may perform. Each role can do
+// everything the roles below it can do.
+type Role int
+
+const (
+	RoleNone Role = iota
+	// Viewer can see the status of the job.
+	RoleViewer
+	// Operator can also change the job, e.g. shutdown or scale it.
+	RoleOperator
+	// Admin can also manage the roles of others.
+	RoleAdmin
+)
+
+var ErrBadIdentity = errors.New("controller: bad identity")
+
+var roleNames = []string{"none", "viewer", "operator", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+func ParseRole(s string) (Role, error) {
+	for i, name := range roleNames {
+		if s == name {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, fmt.Errorf("controller: unknown role %q", s)
+}
+
+// The role policy is stored in etcd in the job namespace, so it goes away with
+// the job and is shared by all controller replicas. Identities come from the
+// Authenticator; callers without a role are denied.
+
+// Identities are escaped in etcd keys, but "." and ".." would still escape
+// the roles directory.
+func checkIdentity(identity string) error {
+	if identity == "" || identity == "." || identity == ".." {
+		return ErrBadIdentity
+	}
+	return nil
+}
+
+// SetRole grants a role to an identity.
+func (c *Controller) SetRole(identity string, role Role) error {
+	if err := checkIdentity(identity); err != nil {
+		return err
+	}
+	if role == RoleNone {
+		return c.RemoveRole(identity)
+	}
+	_, err := c.etcdclient.Set(etcdutil.RolePath(c.name, identity), role.String(), 0)
+	return err
+}
+
+func (c *Controller) RemoveRole(identity string) error {
+	if err := checkIdentity(identity); err != nil {
+		return err
+	}
+	_, err := c.etcdclient.Delete(etcdutil.RolePath(c.name, identity), false)
+	if err != nil && etcdutil.IsKeyNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// GetRole returns the role of an identity, RoleNone if it has none.
+func (c *Controller) GetRole(identity string) (Role, error) {
+	if checkIdentity(identity) != nil {
+		return RoleNone, nil
+	}
+	resp, err := c.etcdclient.Get(etcdutil.RolePath(c.name, identity), false, false)
+	if err != nil {
+		if etcdutil.IsKeyNotFound(err) {
+			return RoleNone, nil
+		}
+		return RoleNone, err
+	}
+	return ParseRole(resp.Node.Value)
+}
+
+// GetRoles returns the whole role policy.
+func (c *Controller) GetRoles() (map[string]Role, error) {
+	roles := make(map[string]Role)
+	resp, err := c.etcdclient.Get(etcdutil.RoleDir(c.name), false, false)
+	if err != nil {
+		if etcdutil.IsKeyNotFound(err) {
+			return roles, nil
+		}
+		return nil, err
+	}
+	for _, n := range resp.Node.Nodes {
+		role, err := ParseRole(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := url.QueryUnescape(path.Base(n.Key))
+		if err != nil {
+			return nil, err
+		}
+		roles[identity] = role
+	}
+	return roles, nil
+}
+
+// SetBootstrapAdmin names the identity granted RoleAdmin when the etcd
+// layout is initialized, who can then grant roles to others through the admin
+// API. Without it, roles can only be granted by calling SetRole. It must be
+// called before Start.
+func (c *Controller) SetBootstrapAdmin(identity string) { c.bootstrapAdmin = identity }
+
+// requireRole only passes requests from callers with at least given role.
+func (c *Controller) requireRole(auth Authenticator, min Role, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := auth.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		role, err := c.GetRole(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if role < min {
+			http.Error(w, fmt.Sprintf("%s (role %s) is not allowed, need %s", id, role, min), http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	})
+}
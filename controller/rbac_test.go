@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{RoleNone, RoleViewer, RoleOperator, RoleAdmin} {
+		r, err := ParseRole(role.String())
+		if err != nil {
+			t.Errorf("ParseRole(%s) failed: %v", role, err)
+		}
+		if r != role {
+			t.Errorf("ParseRole(%s) = %s", role, r)
+		}
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Errorf("ParseRole(root) should fail")
+	}
+	if !(RoleViewer < RoleOperator && RoleOperator < RoleAdmin) {
+		t.Errorf("roles should be ordered by privilege")
+	}
+}
+
+func TestCheckIdentity(t *testing.T) {
+	for _, id := range []string{"", ".", ".."} {
+		if err := checkIdentity(id); err != ErrBadIdentity {
+			t.Errorf("checkIdentity(%q) = %v, want %v", id, err, ErrBadIdentity)
+		}
+	}
+	for _, id := range []string{"alice", "../../epoch", "CN=alice/O=ops"} {
+		if err := checkIdentity(id); err != nil {
+			t.Errorf("checkIdentity(%q) = %v", id, err)
+		}
+	}
+}
+
+func TestAdminHandlerPermissions(t *testing.T) {
+	job := "TestAdminHandlerPermissions"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	c := New(job, etcd.NewClient([]string{m.URL()}), 2)
+	c.SetBootstrapAdmin("root")
+	if err := c.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer c.DestroyEtcdLayout()
+
+	tokens := map[string]string{"root": "root", "nobody": "nobody"}
+	for _, role := range []Role{RoleViewer, RoleOperator, RoleAdmin} {
+		id := role.String()
+		tokens[id] = id
+		if err := c.SetRole(id, role); err != nil {
+			t.Fatalf("SetRole(%s) failed: %v", id, err)
+		}
+	}
+	h := c.AdminHandler(NewTokenAuthenticator(tokens))
+
+	// Requests passing the role check get these codes. Scale has no
+	// parameter, so it is rejected as bad request without side effects.
+	routes := []struct {
+		method, url string
+		min         Role
+		code        int
+	}{
+		{"GET", AdminEpoch, RoleViewer, http.StatusOK},
+		{"GET", AdminStatus, RoleViewer, http.StatusOK},
+		{"GET", AdminDeadLetters, RoleViewer, http.StatusOK},
+		{"POST", AdminScale, RoleOperator, http.StatusBadRequest},
+		{"GET", AdminRoles, RoleAdmin, http.StatusOK},
+		{"POST", AdminShutdown, RoleOperator, http.StatusNoContent},
+	}
+	callers := []struct {
+		token string
+		role  Role
+	}{
+		{"", RoleNone},
+		{"nobody", RoleNone},
+		{"viewer", RoleViewer},
+		{"operator", RoleOperator},
+		{"admin", RoleAdmin},
+		{"root", RoleAdmin},
+	}
+	for _, rt := range routes {
+		for _, caller := range callers {
+			r, err := http.NewRequest(rt.method, rt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := rt.code
+			switch {
+			case caller.token == "":
+				want = http.StatusUnauthorized
+			default:
+				r.Header.Set("Authorization", "Bearer "+caller.token)
+				if caller.role < rt.min {
+					want = http.StatusForbidden
+				}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != want {
+				t.Errorf("%s %s by %q: code want = %d, get = %d (%s)", rt.method, rt.url, caller.token, want, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestRoleIdentityEscaped(t *testing.T) {
+	job := "TestRoleIdentityEscaped"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	c := newTestController(t, etcd.NewClient([]string{m.URL()}), 1)
+	defer c.DestroyEtcdLayout()
+
+	ids := []string{"../../epoch", "CN=alice/O=ops"}
+	for _, id := range ids {
+		if err := c.SetRole(id, RoleViewer); err != nil {
+			t.Fatalf("SetRole(%q) failed: %v", id, err)
+		}
+	}
+	if epoch, err := c.GetEpoch(); err != nil || epoch != 0 {
+		t.Errorf("epoch = (%d, %v), want 0", epoch, err)
+	}
+	roles, err := c.GetRoles()
+	if err != nil {
+		t.Fatalf("GetRoles failed: %v", err)
+	}
+	for _, id := range ids {
+		if roles[id] != RoleViewer {
+			t.Errorf("role of %q = %s, want %s", id, roles[id], RoleViewer)
+		}
+	}
+}
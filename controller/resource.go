@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/go-distributed/meritop/pkg/kube"
+)
+
+// ContainerSpec tells what the containers of a job run, usually
+// meritop-worker, which takes its flags from the environment (see
+// kube.EnvEtcd).
+type ContainerSpec struct {
+	// Image is the container image, if any.
+	Image   string
+	Command string
+	Args    []string
+	Env     map[string]string
+	// resources of each container
+	CPUs     float64
+	MemoryMB float64
+}
+
+// ResourceManager gets containers from a cluster manager, e.g. Mesos (see
+// controller/mesos) or YARN, to run the nodes of a job.
+type ResourceManager interface {
+	// RequestContainers requests n containers running spec, and returns
+	// their IDs. They may start later, once the cluster has room for them.
+	RequestContainers(n int, spec ContainerSpec) ([]string, error)
+	// ReleaseContainer stops the container of the ID and gives its
+	// resources back.
+	ReleaseContainer(id string) error
+}
+
+// containers are those the controller got from its resource manager.
+type containers struct {
+	rm   ResourceManager
+	spec ContainerSpec
+
+	mu  sync.Mutex
+	ids []string
+}
+
+// SetResourceManager makes the controller request a container of rm per
+// task once the etcd layout is set up, and release them on Stop. The
+// containers run spec, with the name of the job in the environment. It must
+// be called before Start.
+func (c *Controller) SetResourceManager(rm ResourceManager, spec ContainerSpec) {
+	env := make(map[string]string, len(spec.Env)+1)
+	for k, v := range spec.Env {
+		env[k] = v
+	}
+	env[kube.EnvJob] = c.name
+	spec.Env = env
+	c.containers = &containers{rm: rm, spec: spec}
+}
+
+// requestContainers requests a container per task, if the controller has a
+// resource manager.
+func (c *Controller) requestContainers() error {
+	cs := c.containers
+	if cs == nil {
+		return nil
+	}
+	ids, err := cs.rm.RequestContainers(int(c.numOfTasks), cs.spec)
+	if err != nil {
+		return c.layoutError("request containers", err)
+	}
+	cs.mu.Lock()
+	cs.ids = append(cs.ids, ids...)
+	cs.mu.Unlock()
+	c.events.record("requested %d containers", len(ids))
+	return nil
+}
+
+// releaseContainers releases the containers of the job.
+func (c *Controller) releaseContainers() {
+	cs := c.containers
+	if cs == nil {
+		return
+	}
+	cs.mu.Lock()
+	ids := cs.ids
+	cs.ids = nil
+	cs.mu.Unlock()
+	for _, id := range ids {
+		if err := cs.rm.ReleaseContainer(id); err != nil {
+			c.logger.Errorf("controller failed to release container %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+var (
+	// ErrNoResult is returned by WaitResult if the job finished without a
+	// result, e.g. as a task or the controller shut it down.
+	ErrNoResult = errors.New("controller: job finished without a result")
+	// ErrWaitStopped is returned by WaitResult once stop is closed.
+	ErrWaitStopped = errors.New("controller: stopped waiting for the result")
+)
+
+// resultPollInterval is how often WaitResult looks for the result.
+const resultPollInterval = 100 * time.Millisecond
+
+// WaitResult waits for the job to finish, and returns the result a task
+// finished it with (see Framework.FinishJob). A job the controller failed,
+// e.g. past its deadline, returns a *JobFailedError instead of ErrNoResult.
+// The result outlives the layout of the job, so it may be waited for after
+// Stop.
+func (c *Controller) WaitResult(stop chan struct{}) (*etcdutil.JobResult, error) {
+	for {
+		r, err := etcdutil.GetJobResult(c.etcdclient, c.name)
+		if err == nil {
+			return r, nil
+		}
+		if !etcdutil.IsKeyNotFound(err) && !etcdutil.IsTransient(err) {
+			return nil, err
+		}
+		if c.finished() {
+			// The result is recorded before the job exits.
+			if r, err := etcdutil.GetJobResult(c.etcdclient, c.name); err == nil {
+				return r, nil
+			}
+			if f, err := etcdutil.GetJobFailure(c.etcdclient, c.name); err == nil {
+				return nil, &JobFailedError{Job: c.name, Reason: f.Reason}
+			}
+			return nil, ErrNoResult
+		}
+		select {
+		case <-time.After(resultPollInterval):
+		case <-stop:
+			return nil, ErrWaitStopped
+		}
+	}
+}
+
+// finished tells whether the job has exited, or is recorded done with its
+// layout gone.
+func (c *Controller) finished() bool {
+	epoch, err := c.GetEpoch()
+	if err == nil {
+		return epoch == etcdutil.ExitEpoch
+	}
+	if !etcdutil.IsKeyNotFound(err) {
+		return false
+	}
+	done, err := etcdutil.JobDone(c.etcdclient, c.name)
+	return err == nil && done
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// ErrJobRunning is returned by Retry if the job hasn't finished.
+var ErrJobRunning = errors.New("controller: job is still running")
+
+// Retry runs again a job which ended without finishing its work, e.g. as it
+// was stopped or gave up on failing tasks. The layout of the job is set up
+// anew, from the one left in etcd, if any, or from the controller otherwise,
+// then the job is supervised as by Start. A controller without a number of
+// tasks needs the former, and returns ErrNoLayout without it.
+//
+// With onlyFailed, the results the job recorded (see
+// meritop.Framework.RecordResult) are kept, so that tasks reusing them, e.g.
+// the master of a work queue, only redo the work left unfinished. Otherwise
+// they are cleared, and the job runs again from scratch.
+func (c *Controller) Retry(onlyFailed bool) error {
+	codec, err := etcdutil.GetCodec(c.etcdclient, c.name)
+	if err != nil {
+		return err
+	}
+	// The epoch is the last key of the layout.
+	if _, err := etcdutil.GetEpochChange(c.etcdclient, codec, c.name); err == nil {
+		status, err := c.Status()
+		if err != nil {
+			return err
+		}
+		if !status.Finished() {
+			return ErrJobRunning
+		}
+		c.codec = codec
+		c.numOfTasks = status.NumOfTasks
+		if spec, err := etcdutil.GetJobSpec(c.etcdclient, c.name); err == nil {
+			c.jobSpec = spec
+		} else if !etcdutil.IsKeyNotFound(err) {
+			return err
+		}
+		if err := c.DestroyEtcdLayout(); err != nil {
+			return c.layoutError("destroy finished layout", err)
+		}
+	} else if !etcdutil.IsKeyNotFound(err) {
+		return err
+	} else if c.numOfTasks == 0 {
+		return ErrNoLayout
+	}
+
+	if err := etcdutil.ClearJobDone(c.etcdclient, c.name); err != nil {
+		return c.layoutError("clear done record", err)
+	}
+	if err := etcdutil.ClearJobResult(c.etcdclient, c.name); err != nil {
+		return c.layoutError("clear result", err)
+	}
+	if err := etcdutil.ClearJobFailure(c.etcdclient, c.name); err != nil {
+		return c.layoutError("clear failure", err)
+	}
+	if !onlyFailed {
+		if err := etcdutil.ClearResults(c.etcdclient, c.name); err != nil {
+			return c.layoutError("clear results", err)
+		}
+	}
+	if err := c.InitEtcdLayout(); err != nil {
+		return err
+	}
+	if err := c.requestContainers(); err != nil {
+		return err
+	}
+	c.Supervise()
+	c.events.record("retried with %d tasks, only failed work: %v", c.numOfTasks, onlyFailed)
+	c.logger.Infof("Controller retrying, name: %s, numberOfTask: %d\n", c.name, c.numOfTasks)
+	return nil
+}
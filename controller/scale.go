@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Task IDs are always 0 to numOfTasks-1, since topologies are built on that.
+// So scaling up appends new IDs and scaling down removes the last ones.
+//
+// A change of the number of tasks takes effect at the next epoch, on all tasks
+// at the same time (see etcdutil.TaskCount). Until then, nodes taking the new
+// tasks wait, and the removed tasks keep running. Another change can't be made
+// before the previous one takes effect; it fails with etcdutil.ErrScalePending.
+
+// AddTasks adds n free tasks to the job. They will be claimed by idle nodes
+// waiting for a free task.
+func (c *Controller) AddTasks(n uint64) error {
+	c.scaleMu.Lock()
+	defer c.scaleMu.Unlock()
+	prev := c.numOfTasks
+	if err := c.checkTasksQuota(prev + n); err != nil {
+		return err
+	}
+	nt, err := etcdutil.GetTaskCount(c.etcdclient, c.name)
+	if err != nil {
+		return err
+	}
+	for id := prev; id < prev+n; id++ {
+		key := etcdutil.FreeTaskPath(c.name, strconv.FormatUint(id, 10))
+		if _, err := c.etcdclient.Create(key, "", 0); err != nil {
+			c.deleteFreeTasks(prev, id)
+			return fmt.Errorf("controller create failed. Key: %s, err: %v", key, err)
+		}
+	}
+	if err := etcdutil.CASNumOfTasks(c.etcdclient, c.name, nt, prev+n); err != nil {
+		// Don't leave free tasks nobody should claim.
+		c.deleteFreeTasks(prev, prev+n)
+		return err
+	}
+	c.numOfTasks = prev + n
+	c.events.record("scaled from %d to %d tasks", prev, c.numOfTasks)
+	c.logger.Infof("controller scaled job %s from %d to %d tasks", c.name, prev, c.numOfTasks)
+	return nil
+}
+
+// deleteFreeTasks deletes free tasks of IDs in [from, to).
+func (c *Controller) deleteFreeTasks(from, to uint64) {
+	for id := from; id < to; id++ {
+		c.etcdclient.Delete(etcdutil.FreeTaskPath(c.name, strconv.FormatUint(id, 10)), false)
+	}
+}
+
+// RemoveTasks removes given tasks from the job. The IDs must be the last
+// ones, e.g. 8 and 9 of a job with 10 tasks.
+func (c *Controller) RemoveTasks(ids []uint64) error {
+	c.scaleMu.Lock()
+	defer c.scaleMu.Unlock()
+	prev := c.numOfTasks
+	n := uint64(len(ids))
+	if n > prev {
+		return fmt.Errorf("controller: can't remove %d tasks out of %d", n, prev)
+	}
+	removed := make(map[uint64]bool)
+	for _, id := range ids {
+		if id < prev-n || id >= prev || removed[id] {
+			return fmt.Errorf("controller: tasks to remove must be the last %d IDs, get %v", n, ids)
+		}
+		removed[id] = true
+	}
+	nt, err := etcdutil.GetTaskCount(c.etcdclient, c.name)
+	if err != nil {
+		return err
+	}
+	// Lower the number first so that failure detection won't treat the
+	// removed tasks as failed once they stop heartbeating.
+	if err := etcdutil.CASNumOfTasks(c.etcdclient, c.name, nt, prev-n); err != nil {
+		return err
+	}
+	c.deleteFreeTasks(prev-n, prev)
+	c.numOfTasks = prev - n
+	c.events.record("scaled from %d to %d tasks", prev, c.numOfTasks)
+	c.logger.Infof("controller scaled job %s from %d to %d tasks", c.name, prev, c.numOfTasks)
+	return nil
+}
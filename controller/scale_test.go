@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Only the last task IDs can be removed; invalid requests are rejected before
+// touching etcd.
+func TestRemoveTasksInvalidIDs(t *testing.T) {
+	c := &Controller{name: "TestRemoveTasksInvalidIDs", numOfTasks: 5}
+	tests := [][]uint64{
+		{0},
+		{3},
+		{4, 4},
+		{5},
+		{0, 1, 2, 3, 4, 5},
+	}
+	for i, ids := range tests {
+		if err := c.RemoveTasks(ids); err == nil {
+			t.Errorf("#%d: RemoveTasks(%v) should fail", i, ids)
+		}
+	}
+	if c.numOfTasks != 5 {
+		t.Errorf("numOfTasks want = 5, get = %d", c.numOfTasks)
+	}
+}
+
+func TestAddTasksAtNextEpoch(t *testing.T) {
+	job := "TestAddTasksAtNextEpoch"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	client := etcd.NewClient([]string{m.URL()})
+	c := newTestController(t, client, 2)
+	defer c.DestroyEtcdLayout()
+
+	numTasks := func() uint64 {
+		ec, err := etcdutil.GetEpochChange(client, etcdutil.TextCodec, job)
+		if err != nil {
+			t.Fatalf("GetEpochChange failed: %v", err)
+		}
+		nt, err := etcdutil.GetTaskCount(client, job)
+		if err != nil {
+			t.Fatalf("GetTaskCount failed: %v", err)
+		}
+		return nt.At(ec.Index)
+	}
+
+	if err := c.AddTasks(1); err != nil {
+		t.Fatalf("AddTasks failed: %v", err)
+	}
+	if n := numTasks(); n != 2 {
+		t.Errorf("number of tasks in current epoch = %d, want 2", n)
+	}
+	// Another change must wait, and leaves no free task behind.
+	if err := c.AddTasks(1); err != etcdutil.ErrScalePending {
+		t.Errorf("AddTasks = %v, want %v", err, etcdutil.ErrScalePending)
+	}
+	if _, err := client.Get(etcdutil.FreeTaskPath(job, "3"), false, false); !etcdutil.IsKeyNotFound(err) {
+		t.Errorf("free task 3 should be rolled back, get err = %v", err)
+	}
+
+	if err := etcdutil.CASEpoch(client, etcdutil.TextCodec, job, 0, 1); err != nil {
+		t.Fatalf("CASEpoch failed: %v", err)
+	}
+	if n := numTasks(); n != 3 {
+		t.Errorf("number of tasks in next epoch = %d, want 3", n)
+	}
+	if err := c.AddTasks(1); err != nil {
+		t.Errorf("AddTasks after the last change takes effect failed: %v", err)
+	}
+}
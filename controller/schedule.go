@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// SetEpochInterval makes the controller advance the epoch every d, whatever
+// the tasks do, e.g. for streaming jobs aggregating the data that arrived
+// during each window. Tasks may still advance it in between. It must be
+// called before Start or Resume.
+func (c *Controller) SetEpochInterval(d time.Duration) { c.epochInterval = d }
+
+// advanceEpochs advances the epoch of the job every interval until stop, or
+// until the job has finished.
+func (c *Controller) advanceEpochs(interval time.Duration, stop chan struct{}) {
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		epoch, err := c.GetEpoch()
+		if err != nil {
+			c.logger.Errorf("controller failed to get the epoch to advance: %v", err)
+			continue
+		}
+		if epoch == etcdutil.ExitEpoch {
+			return
+		}
+		err = c.retry.Do(func() error {
+			return etcdutil.CASEpoch(c.etcdclient, c.codec, c.name, epoch, epoch+1)
+		})
+		if err != nil {
+			// A task might have advanced it meanwhile; the next window starts
+			// from there.
+			c.logger.Warnf("controller failed to advance epoch %d on schedule: %v", epoch, err)
+			continue
+		}
+		c.events.record("advanced to epoch %d on schedule", epoch+1)
+	}
+}
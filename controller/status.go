@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+type TaskState int
+
+const (
+	// No node has taken the task yet.
+	TaskFree TaskState = iota
+	// A node is running the task and heartbeating.
+	TaskAssigned
+	// The node running the task has failed; the task waits for a new node.
+	TaskFailed
+	// The job has exited.
+	TaskFinished
+)
+
+func (s TaskState) String() string {
+	switch s {
+	case TaskFree:
+		return "free"
+	case TaskAssigned:
+		return "assigned"
+	case TaskFailed:
+		return "failed"
+	case TaskFinished:
+		return "finished"
+	}
+	return "unknown"
+}
+
+type TaskStatus struct {
+	ID    uint64
+	State TaskState
+	// Address of the node running the task, if it is assigned.
+	Address string
+	// Increases every time a new node takes over the task; zero if the task
+	// is not assigned.
+	Generation uint64
+	// Zero if the task has never heartbeated or its heartbeat expired.
+	LastHeartbeat time.Time
+}
+
+// JobStatus is a snapshot of the progress of a job.
+type JobStatus struct {
+	Epoch      uint64
+	NumOfTasks uint64
+	Tasks      []TaskStatus
+	// Addresses of the nodes in the standby pool, see framework.WithStandby.
+	Standbys []string
+}
+
+func (s *JobStatus) Finished() bool { return s.Epoch == etcdutil.ExitEpoch }
+
+// Status reads the current status of the job from etcd.
+func (c *Controller) Status() (*JobStatus, error) {
+	status, _, err := c.readStatus()
+	return status, err
+}
+
+// readStatus reads the keys making up the job status, but not the others,
+// e.g. checkpoints, which can be big. It also returns the etcd index before
+// the reads, from which changes can be watched.
+func (c *Controller) readStatus() (*JobStatus, uint64, error) {
+	var nodes etcd.Nodes
+	var index uint64
+	for i, key := range []string{
+		etcdutil.EpochPath(c.name),
+		etcdutil.NumTasksPath(c.name),
+		etcdutil.HealthyPath(c.name),
+		etcdutil.FreeTaskDir(c.name),
+		etcdutil.CodecPath(c.name),
+		etcdutil.StandbyPoolDir(c.name),
+	} {
+		resp, err := c.etcdclient.Get(key, false, true)
+		if err != nil {
+			if etcdutil.IsKeyNotFound(err) {
+				continue
+			}
+			return nil, 0, err
+		}
+		if i == 0 {
+			index = resp.EtcdIndex
+		}
+		nodes = append(nodes, resp.Node)
+	}
+	status, err := parseStatus(c.name, nodes)
+	return status, index, err
+}
+
+// statusChange tells whether a change of given key might change the status.
+// Heartbeats, meta flags and checkpoints don't.
+func (c *Controller) statusChange(resp *etcd.Response) bool {
+	key := resp.Node.Key
+	switch {
+	case key == etcdutil.EpochPath(c.name), key == etcdutil.NumTasksPath(c.name):
+		return true
+	case strings.HasPrefix(key, etcdutil.FreeTaskDir(c.name)+"/"):
+		return true
+	case strings.HasPrefix(key, etcdutil.HealthyPath(c.name)+"/"),
+		strings.HasPrefix(key, etcdutil.StandbyPoolDir(c.name)+"/"):
+		// A heartbeat swaps the value of the healthy or standby key.
+		return resp.Action != "compareAndSwap"
+	}
+	return false
+}
+
+// Subscribe sends the status of the job every time it changes, until stop.
+// Heartbeats alone don't count as changes.
+func (c *Controller) Subscribe(stop chan bool) <-chan *JobStatus {
+	statusC := make(chan *JobStatus, 1)
+	go func() {
+		defer close(statusC)
+		status, index, err := c.readStatus()
+		if err != nil {
+			c.logger.Errorf("controller failed to get status: %v", err)
+			return
+		}
+		statusC <- status
+
+		receiver := make(chan *etcd.Response, 1)
+		go c.etcdclient.Watch(etcdutil.JobPath(c.name), index+1, true, receiver, stop)
+		last := status
+		for resp := range receiver {
+			if !c.statusChange(resp) {
+				continue
+			}
+			status, err := c.Status()
+			if err != nil {
+				c.logger.Errorf("controller failed to get status: %v", err)
+				continue
+			}
+			if status.sameAs(last) {
+				continue
+			}
+			last = status
+			select {
+			case statusC <- status:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return statusC
+}
+
+// sameAs tells whether two statuses are the same but heartbeat times.
+func (s *JobStatus) sameAs(o *JobStatus) bool {
+	if s.Epoch != o.Epoch || s.NumOfTasks != o.NumOfTasks || len(s.Tasks) != len(o.Tasks) ||
+		!reflect.DeepEqual(s.Standbys, o.Standbys) {
+		return false
+	}
+	for i, ts := range s.Tasks {
+		if ts.State != o.Tasks[i].State || ts.Address != o.Tasks[i].Address || ts.Generation != o.Tasks[i].Generation {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStatus builds the job status from recursive etcd nodes of the job.
+func parseStatus(name string, roots etcd.Nodes) (*JobStatus, error) {
+	nodes := make(map[string]*etcd.Node)
+	var walk func(n *etcd.Node)
+	walk = func(n *etcd.Node) {
+		nodes[n.Key] = n
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+
+	status := new(JobStatus)
+	var err error
+	codec := etcdutil.TextCodec
+	if n, ok := nodes[etcdutil.CodecPath(name)]; ok {
+		if codec, err = etcdutil.CodecByName(n.Value); err != nil {
+			return nil, err
+		}
+	}
+	epoch, ok := nodes[etcdutil.EpochPath(name)]
+	if !ok {
+		return nil, fmt.Errorf("controller: job %s has no epoch", name)
+	}
+	if status.Epoch, err = codec.DecodeEpoch(epoch.Value); err != nil {
+		return nil, err
+	}
+	numTasks, ok := nodes[etcdutil.NumTasksPath(name)]
+	if !ok {
+		return nil, fmt.Errorf("controller: job %s has no number of tasks", name)
+	}
+	if _, status.NumOfTasks, err = etcdutil.ParseNumTasks(numTasks.Value); err != nil {
+		return nil, err
+	}
+
+	for id := uint64(0); id < status.NumOfTasks; id++ {
+		ts := TaskStatus{ID: id}
+		healthy, hasHealthy := nodes[etcdutil.TaskHealthyPath(name, id)]
+		if hasHealthy {
+			ts.LastHeartbeat, ts.Address, _ = etcdutil.ParseHealthy(healthy.Value)
+			ts.Generation = healthy.CreatedIndex
+		}
+		free, hasFree := nodes[etcdutil.FreeTaskPath(name, strconv.FormatUint(id, 10))]
+		switch {
+		case status.Finished():
+			ts.State = TaskFinished
+		case hasFree && free.Value == "failed":
+			ts.State = TaskFailed
+		case hasFree:
+			ts.State = TaskFree
+		case hasHealthy:
+			ts.State = TaskAssigned
+		default:
+			// heartbeat expired, but the failure isn't reported yet
+			ts.State = TaskFailed
+		}
+		status.Tasks = append(status.Tasks, ts)
+	}
+	if standby, ok := nodes[etcdutil.StandbyPoolDir(name)]; ok {
+		status.Standbys = etcdutil.ParseStandbys(standby.Nodes)
+	}
+	return status, nil
+}
+
+// String formats the status as one line for the job followed by one line for
+// each task.
+func (s *JobStatus) String() string {
+	lines := []string{fmt.Sprintf("epoch %d numTasks %d", s.Epoch, s.NumOfTasks)}
+	for _, ts := range s.Tasks {
+		heartbeat := "-"
+		if !ts.LastHeartbeat.IsZero() {
+			heartbeat = ts.LastHeartbeat.UTC().Format(time.RFC3339)
+		}
+		addr := ts.Address
+		if addr == "" {
+			addr = "-"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", strconv.FormatUint(ts.ID, 10), ts.State, addr, heartbeat))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestParseStatus(t *testing.T) {
+	name := "TestParseStatus"
+	now := time.Unix(1400000000, 0)
+	root := &etcd.Node{Key: etcdutil.JobPath(name), Dir: true, Nodes: etcd.Nodes{
+		{Key: etcdutil.EpochPath(name), Value: "3"},
+		{Key: etcdutil.NumTasksPath(name), Value: "4,4"},
+		{Key: etcdutil.HealthyPath(name), Dir: true, Nodes: etcd.Nodes{
+			{
+				Key:          etcdutil.TaskHealthyPath(name, 0),
+				Value:        strconv.FormatInt(now.UnixNano(), 10) + ",host0:1234",
+				CreatedIndex: 7,
+			},
+		}},
+		{Key: etcdutil.FreeTaskDir(name), Dir: true, Nodes: etcd.Nodes{
+			{Key: etcdutil.FreeTaskPath(name, "1"), Value: "failed"},
+			{Key: etcdutil.FreeTaskPath(name, "2"), Value: ""},
+		}},
+		{Key: etcdutil.StandbyPoolDir(name), Dir: true, Nodes: etcd.Nodes{
+			{Key: etcdutil.StandbyPath(name, "host9:1234"), Value: "host9:1234"},
+		}},
+	}}
+
+	status, err := parseStatus(name, root.Nodes)
+	if err != nil {
+		t.Fatalf("parseStatus failed: %v", err)
+	}
+	if status.Epoch != 3 || status.NumOfTasks != 4 || len(status.Tasks) != 4 ||
+		len(status.Standbys) != 1 || status.Standbys[0] != "host9:1234" {
+		t.Fatalf("status = %+v", status)
+	}
+	wanted := []TaskStatus{
+		{ID: 0, State: TaskAssigned, Address: "host0:1234", Generation: 7, LastHeartbeat: now},
+		{ID: 1, State: TaskFailed},
+		{ID: 2, State: TaskFree},
+		{ID: 3, State: TaskFailed},
+	}
+	for i, ts := range status.Tasks {
+		w := wanted[i]
+		if ts.ID != w.ID || ts.State != w.State || ts.Address != w.Address || ts.Generation != w.Generation ||
+			!ts.LastHeartbeat.Equal(w.LastHeartbeat) {
+			t.Errorf("task %d status = %+v, want %+v", i, ts, w)
+		}
+	}
+
+	root.Nodes[0].Value = strconv.FormatUint(etcdutil.ExitEpoch, 10)
+	if status, err = parseStatus(name, root.Nodes); err != nil {
+		t.Fatalf("parseStatus failed: %v", err)
+	}
+	for _, ts := range status.Tasks {
+		if ts.State != TaskFinished {
+			t.Errorf("task %d state = %s, want finished", ts.ID, ts.State)
+		}
+	}
+}
+
+func TestStatusChange(t *testing.T) {
+	name := "TestStatusChange"
+	c := &Controller{name: name}
+	tests := []struct {
+		action, key string
+		change      bool
+	}{
+		{"compareAndSwap", etcdutil.EpochPath(name), true},
+		{"compareAndSwap", etcdutil.NumTasksPath(name), true},
+		{"set", etcdutil.FreeTaskPath(name, "1"), true},
+		{"delete", etcdutil.FreeTaskPath(name, "1"), true},
+		{"create", etcdutil.TaskHealthyPath(name, 1), true},
+		{"expire", etcdutil.TaskHealthyPath(name, 1), true},
+		{"compareAndDelete", etcdutil.TaskHealthyPath(name, 1), true},
+		// heartbeat
+		{"compareAndSwap", etcdutil.TaskHealthyPath(name, 1), false},
+		{"set", etcdutil.StandbyPath(name, "host:1"), true},
+		{"expire", etcdutil.StandbyPath(name, "host:1"), true},
+		{"compareAndSwap", etcdutil.StandbyPath(name, "host:1"), false},
+		{"set", etcdutil.MetaPath(name, 1, "parent"), false},
+		{"set", etcdutil.TaskCheckpointPath(name, 1, 3), false},
+		{"set", etcdutil.RolePath(name, "alice"), false},
+	}
+	for i, tt := range tests {
+		resp := &etcd.Response{Action: tt.action, Node: &etcd.Node{Key: tt.key}}
+		if change := c.statusChange(resp); change != tt.change {
+			t.Errorf("#%d: %s %s: change want = %v, get = %v", i, tt.action, tt.key, tt.change, change)
+		}
+	}
+}
+
+func TestStatusSameAs(t *testing.T) {
+	s := &JobStatus{Epoch: 1, NumOfTasks: 1, Tasks: []TaskStatus{{ID: 0, State: TaskAssigned, Address: "a"}}}
+	heartbeat := &JobStatus{Epoch: 1, NumOfTasks: 1, Tasks: []TaskStatus{{ID: 0, State: TaskAssigned, Address: "a", LastHeartbeat: time.Now()}}}
+	failed := &JobStatus{Epoch: 1, NumOfTasks: 1, Tasks: []TaskStatus{{ID: 0, State: TaskFailed, Address: "a"}}}
+	if !s.sameAs(heartbeat) {
+		t.Errorf("heartbeat alone should not change status")
+	}
+	if s.sameAs(failed) {
+		t.Errorf("task state change should change status")
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// A task is a straggler if it was slower than the P95 of the tasks in more
+// than stragglerShare of at least stragglerMinEpochs epochs it was timed in.
+const (
+	stragglerMinEpochs = 3
+	stragglerShare     = 0.75
+)
+
+// Straggler is a task consistently slower than the others, e.g. as its node
+// runs on a bad machine.
+type Straggler struct {
+	TaskID uint64 `json:"taskID"`
+	// Address of the node running the task, if it has one
+	Addr string `json:"addr,omitempty"`
+	// The task was slower than the P95 of the tasks in Slow of Epochs epochs.
+	Slow   int `json:"slow"`
+	Epochs int `json:"epochs"`
+	// Median of the durations of the task, and of all tasks, in those epochs
+	Median    time.Duration `json:"median"`
+	JobMedian time.Duration `json:"jobMedian"`
+}
+
+// Stragglers returns the tasks consistently slower than the P95 of the
+// tasks in the last epochs they were timed in (see etcdutil.TimingWindow),
+// sorted by task ID.
+func (c *Controller) Stragglers() ([]Straggler, error) {
+	timings, err := etcdutil.GetTimings(c.etcdclient, c.name)
+	if err != nil {
+		return nil, err
+	}
+	stragglers := findStragglers(timings)
+	for i := range stragglers {
+		stragglers[i].Addr, _ = etcdutil.GetAddress(c.etcdclient, c.name, stragglers[i].TaskID)
+	}
+	return stragglers, nil
+}
+
+func findStragglers(timings map[uint64][]etcdutil.EpochTiming) []Straggler {
+	byEpoch := make(map[uint64][]time.Duration)
+	for _, ts := range timings {
+		for _, t := range ts {
+			byEpoch[t.Epoch] = append(byEpoch[t.Epoch], t.Duration)
+		}
+	}
+	p95 := make(map[uint64]time.Duration)
+	for epoch, ds := range byEpoch {
+		p95[epoch] = percentile(ds, 0.95)
+	}
+	var stragglers []Straggler
+	for id, ts := range timings {
+		s := Straggler{TaskID: id}
+		var mine, all []time.Duration
+		for _, t := range ts {
+			// An epoch timed by one task tells nothing.
+			if len(byEpoch[t.Epoch]) < 2 {
+				continue
+			}
+			s.Epochs++
+			if t.Duration > p95[t.Epoch] {
+				s.Slow++
+			}
+			mine = append(mine, t.Duration)
+			all = append(all, byEpoch[t.Epoch]...)
+		}
+		if s.Epochs < stragglerMinEpochs || float64(s.Slow) <= stragglerShare*float64(s.Epochs) {
+			continue
+		}
+		s.Median, s.JobMedian = percentile(mine, 0.5), percentile(all, 0.5)
+		stragglers = append(stragglers, s)
+	}
+	sort.Sort(byTaskID(stragglers))
+	return stragglers
+}
+
+// percentile interpolates between the closest ranks, so that the slowest of
+// a few tasks is above the P95.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Sort(durations(sorted))
+	h := p * float64(len(sorted)-1)
+	i := int(h)
+	if i+1 >= len(sorted) {
+		return sorted[i]
+	}
+	return sorted[i] + time.Duration((h-float64(i))*float64(sorted[i+1]-sorted[i]))
+}
+
+// warnStragglers logs the stragglers found since the last call, which are
+// kept in known.
+func (c *Controller) warnStragglers(known map[uint64]bool) {
+	stragglers, err := c.Stragglers()
+	if err != nil {
+		c.logger.Warnf("controller failed to look for stragglers: %v", err)
+		return
+	}
+	for _, s := range stragglers {
+		if known[s.TaskID] {
+			continue
+		}
+		known[s.TaskID] = true
+		c.events.record("task %d is a straggler", s.TaskID)
+		c.logger.Warnf("task %d on %s is slower than the P95 in %d of %d epochs, median %v against %v",
+			s.TaskID, s.Addr, s.Slow, s.Epochs, s.Median, s.JobMedian)
+	}
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+type byTaskID []Straggler
+
+func (s byTaskID) Len() int           { return len(s) }
+func (s byTaskID) Less(i, j int) bool { return s[i].TaskID < s[j].TaskID }
+func (s byTaskID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
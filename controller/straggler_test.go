@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestStragglers(t *testing.T) {
+	job := "TestStragglers"
+	client := etcdutil.NewMemoryCoordinator()
+	c := New(job, client, 4)
+	if s, err := c.Stragglers(); s != nil || err != nil {
+		t.Fatalf("Stragglers without timings = (%v, %v), want none", s, err)
+	}
+	// Task 2 is the slowest in every epoch but the one task 3 is slower in.
+	for epoch := uint64(1); epoch <= 5; epoch++ {
+		for id := uint64(0); id < 4; id++ {
+			d := time.Second
+			switch {
+			case id == 2:
+				d = 3 * time.Second
+			case id == 3 && epoch == 1:
+				d = 5 * time.Second
+			}
+			if err := etcdutil.RecordTiming(client, job, id, etcdutil.EpochTiming{Epoch: epoch, Duration: d}); err != nil {
+				t.Fatalf("RecordTiming failed: %v", err)
+			}
+		}
+	}
+	if _, err := etcdutil.ClaimTask(client, job, 2, "host:1"); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	s, err := c.Stragglers()
+	if err != nil {
+		t.Fatalf("Stragglers failed: %v", err)
+	}
+	if len(s) != 1 {
+		t.Fatalf("Stragglers = %v, want task 2", s)
+	}
+	want := Straggler{TaskID: 2, Addr: "host:1", Slow: 4, Epochs: 5, Median: 3 * time.Second, JobMedian: time.Second}
+	if s[0] != want {
+		t.Errorf("straggler = %+v, want %+v", s[0], want)
+	}
+}
@@ -0,0 +1,65 @@
+package faulttolerant
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/faultinject"
+)
+
+// TestRun fails an inner task and a leaf once each. Standby nodes take them
+// over from their snapshots, and the job finishes with the same total.
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faulttolerant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := Config{
+		Name:          "TestFaultTolerantRun",
+		Coordinator:   etcdutil.NewMemoryCoordinator(),
+		Host:          "127.0.0.1",
+		NumOfTasks:    7,
+		Fanout:        2,
+		NumOfEpochs:   5,
+		NumOfStandbys: 1,
+		CheckpointDir: dir,
+		Faults: faultinject.NewSchedule(1,
+			faultinject.Fault{
+				Callback:    faultinject.DataReady,
+				LinkType:    meritop.LinkChild,
+				Epochs:      []uint64{2},
+				Tasks:       []uint64{1},
+				Probability: 1,
+				Limit:       1,
+			},
+			faultinject.Fault{
+				Callback:    faultinject.SetEpoch,
+				Epochs:      []uint64{4},
+				Tasks:       []uint64{6},
+				Probability: 1,
+				Limit:       1,
+			},
+		),
+		Logger: log.New(ioutil.Discard, "", 0),
+	}
+	total, err := Run(cfg)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := Want(cfg.NumOfTasks, cfg.NumOfEpochs); total != want {
+		t.Errorf("total = %d, want %d", total, want)
+	}
+}
+
+func TestWant(t *testing.T) {
+	// tasks contribute 1, 2, 3 at epoch 1, and twice as much at epoch 2
+	if w := Want(3, 2); w != 18 {
+		t.Errorf("Want(3, 2) = %d, want 18", w)
+	}
+}
@@ -0,0 +1,16 @@
+package faulttolerant
+
+import "github.com/go-distributed/meritop"
+
+// The tasks are registered for worker binaries, e.g.
+// "-task faulttolerant -topology tree -param epochs=10". They don't fail on
+// purpose there; kill worker processes instead.
+func init() {
+	meritop.RegisterTaskBuilder("faulttolerant", func(numOfTasks uint64, params meritop.Params) (meritop.TaskBuilder, error) {
+		epochs, err := params.Uint("epochs", 10)
+		if err != nil {
+			return nil, err
+		}
+		return &TaskBuilder{NumOfEpochs: epochs}, nil
+	})
+}
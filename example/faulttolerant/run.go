@@ -0,0 +1,106 @@
+package faulttolerant
+
+import (
+	"log"
+	"net"
+
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/faultinject"
+)
+
+// Config configures a fault tolerant job run by Run.
+type Config struct {
+	Name     string
+	EtcdURLs []string
+	EtcdAPI  string
+	// Coordinator replaces etcd at EtcdURLs if set, e.g. in tests.
+	Coordinator etcdutil.Coordinator
+	// Host the nodes listen on.
+	Host string
+
+	NumOfTasks  uint64
+	Fanout      uint64
+	NumOfEpochs uint64
+	// NumOfStandbys is how many spare nodes wait to take over tasks. A node
+	// failed on purpose is replaced by a new standby node, as a cluster
+	// manager would restart it.
+	NumOfStandbys int
+
+	// CheckpointDir keeps snapshots on disk if set, or in etcd otherwise.
+	CheckpointDir      string
+	CheckpointInterval uint64
+
+	Faults *faultinject.Schedule
+	Logger *log.Logger
+}
+
+// Want returns the total the job finishes with.
+func Want(numOfTasks, numOfEpochs uint64) int64 {
+	return int64(numOfTasks*(numOfTasks+1)/2) * int64(numOfEpochs*(numOfEpochs+1)/2)
+}
+
+// Run sets up the job with a controller, runs its nodes in this process, and
+// returns the total of the job once it finishes. Standby nodes left over keep
+// waiting for failures until the process exits.
+func Run(cfg Config) (int64, error) {
+	client := cfg.Coordinator
+	if client == nil {
+		var err error
+		if client, err = etcdutil.NewCoordinator(cfg.EtcdAPI, cfg.EtcdURLs); err != nil {
+			return 0, err
+		}
+	}
+	ctl := controller.New(cfg.Name, client, cfg.NumOfTasks)
+	if err := ctl.Start(); err != nil {
+		return 0, err
+	}
+	defer ctl.Stop()
+
+	nodes := cfg.NumOfTasks + uint64(cfg.NumOfStandbys)
+	builder := &TaskBuilder{
+		NumOfEpochs: cfg.NumOfEpochs,
+		Faults:      cfg.Faults,
+		ResultChan:  make(chan int64, 1),
+		FailChan:    make(chan uint64, nodes),
+	}
+	opts := []framework.Option{framework.WithCoordinator(client)}
+	if cfg.CheckpointDir != "" {
+		opts = append(opts, framework.WithCheckpointStore(checkpoint.NewFileStore(cfg.CheckpointDir)))
+	}
+	if cfg.CheckpointInterval > 0 {
+		opts = append(opts, framework.WithCheckpointInterval(cfg.CheckpointInterval))
+	}
+	startNode := func() error {
+		ln, err := net.Listen("tcp4", net.JoinHostPort(cfg.Host, "0"))
+		if err != nil {
+			return err
+		}
+		bootstrap := framework.NewBootStrap(cfg.Name, cfg.EtcdURLs, ln, cfg.Logger, opts...)
+		bootstrap.SetTaskBuilder(builder)
+		bootstrap.SetTopology(example.NewTreeTopology(cfg.Fanout, cfg.NumOfTasks))
+		go bootstrap.Start()
+		return nil
+	}
+	for i := uint64(0); i < nodes; i++ {
+		if err := startNode(); err != nil {
+			return 0, err
+		}
+	}
+	for {
+		select {
+		case total := <-builder.ResultChan:
+			return total, nil
+		case taskID := <-builder.FailChan:
+			if cfg.Logger != nil {
+				cfg.Logger.Printf("node of task %d failed, starting a standby node", taskID)
+			}
+			if err := startNode(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
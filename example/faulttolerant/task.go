@@ -0,0 +1,223 @@
+/*
+Package faulttolerant is a template for jobs which survive node failures. It
+configures the three pieces meritop recovers tasks with:
+ 1. checkpointing: tasks implement meritop.Checkpointer, so that a task taken
+    over by another node resumes from its latest snapshot;
+ 2. standby nodes: more nodes are started than there are tasks, and the spare
+    ones take over tasks of failed nodes;
+ 3. failure injection: a faultinject.Schedule fails nodes on purpose, so that
+    recovery can be seen working before it is needed in production.
+
+The tasks form a tree. At epoch e, task i contributes (i+1)*e, and every task
+adds up the contributions of its subtree. Every task keeps the running total
+of its subtree sums across epochs, which is the state it checkpoints. After
+NumOfEpochs epochs, the root reports its total, i.e. the sum of every
+contribution of the job, whatever nodes failed on the way (see Want).
+*/
+package faulttolerant
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/faultinject"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+const (
+	subtreeReady = "SubtreeReady"
+	reqSum       = "sum"
+)
+
+// TaskBuilder builds the tasks of the job.
+type TaskBuilder struct {
+	NumOfEpochs uint64
+	// Faults to inject into the tasks, if any.
+	Faults *faultinject.Schedule
+	// ResultChan receives the total of the root once the job finishes.
+	ResultChan chan int64
+	// FailChan receives the ID of the task of every node failed on purpose,
+	// e.g. to start a standby node in its place. Sends don't block.
+	FailChan chan uint64
+}
+
+func (b *TaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &task{builder: b}
+}
+
+// snapshot is the checkpointed state of a task.
+type snapshot struct {
+	// Epoch is the last epoch added to Total.
+	Epoch uint64
+	Total int64
+}
+
+type task struct {
+	builder   *TaskBuilder
+	framework meritop.Framework
+	taskID    uint64
+	logger    logging.Logger
+
+	// Callbacks can be invoked concurrently.
+	mu           sync.Mutex
+	epoch        uint64
+	state        snapshot
+	sum          int64
+	fromChildren map[uint64]int64
+	// once failed, the node is going down and the task mustn't go on
+	failed bool
+}
+
+func (t *task) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID = taskID
+	t.framework = framework
+	t.logger = framework.GetLogger()
+}
+
+func (t *task) Exit() {}
+
+func (t *task) Snapshot() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, err := json.Marshal(t.state)
+	if err != nil {
+		t.logger.Fatalf("task %d can't encode snapshot: %v", t.taskID, err)
+	}
+	return b
+}
+
+func (t *task) Restore(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := json.Unmarshal(b, &t.state); err != nil {
+		t.logger.Fatalf("task %d can't decode snapshot: %v", t.taskID, err)
+	}
+	t.logger.Infof("task %d restored total %d of epoch %d", t.taskID, t.state.Total, t.state.Epoch)
+}
+
+func (t *task) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	t.epoch = epoch
+	t.sum = 0
+	t.fromChildren = make(map[uint64]int64)
+	t.mu.Unlock()
+	if t.fail(faultinject.SetEpoch, "") {
+		return
+	}
+	if len(t.children()) == 0 {
+		t.finishEpoch()
+	}
+}
+
+func (t *task) MetaReady(fromID uint64, linkType, meta string) {
+	if linkType != meritop.LinkChild || meta != subtreeReady {
+		return
+	}
+	if t.fail(faultinject.MetaReady, linkType) {
+		return
+	}
+	t.framework.DataRequest(fromID, reqSum)
+}
+
+func (t *task) Serve(fromID uint64, linkType, req string) []byte {
+	if t.fail(faultinject.Serve, linkType) {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, err := json.Marshal(t.sum)
+	if err != nil {
+		t.logger.Fatalf("task %d can't encode sum: %v", t.taskID, err)
+	}
+	return b
+}
+
+func (t *task) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	if linkType != meritop.LinkChild {
+		return
+	}
+	if t.fail(faultinject.DataReady, linkType) {
+		return
+	}
+	var sum int64
+	if err := json.Unmarshal(resp, &sum); err != nil {
+		// The child failed while serving. It flags again once taken over.
+		t.logger.Warnf("task %d can't decode sum from %d: %v", t.taskID, fromID, err)
+		return
+	}
+	t.mu.Lock()
+	if _, ok := t.fromChildren[fromID]; ok {
+		// at-least-once delivery
+		t.mu.Unlock()
+		return
+	}
+	t.fromChildren[fromID] = sum
+	done := len(t.fromChildren) == len(t.children())
+	t.mu.Unlock()
+	if done {
+		t.finishEpoch()
+	}
+}
+
+func (t *task) children() []uint64 {
+	return t.framework.GetTopology().GetNeighbors(meritop.LinkChild, t.epoch)
+}
+
+// finishEpoch adds up the subtree, and hands it over to the parent, or moves
+// the job on if it is the root.
+func (t *task) finishEpoch() {
+	t.mu.Lock()
+	epoch := t.epoch
+	t.sum = int64(t.taskID+1) * int64(epoch)
+	for _, sum := range t.fromChildren {
+		t.sum += sum
+	}
+	// A task taken over within the epoch redoes it from the snapshot at
+	// the start of the epoch, so the epoch isn't added twice.
+	if t.state.Epoch < epoch {
+		t.state.Epoch = epoch
+		t.state.Total += t.sum
+	}
+	total := t.state.Total
+	t.mu.Unlock()
+
+	if t.taskID != 0 {
+		t.framework.FlagMetaToParent(subtreeReady)
+		return
+	}
+	t.logger.Infof("epoch %d sums up to %d, total %d", epoch, t.sum, total)
+	if epoch < t.builder.NumOfEpochs {
+		t.framework.IncEpoch()
+		return
+	}
+	t.framework.ShutdownJob()
+	if t.builder.ResultChan != nil {
+		t.builder.ResultChan <- total
+	}
+}
+
+// fail tells whether the task fails at given point according to the schedule,
+// and if so, stops the node as if it crashed.
+func (t *task) fail(callback, linkType string) bool {
+	t.mu.Lock()
+	if t.failed {
+		t.mu.Unlock()
+		return true
+	}
+	p := faultinject.Point{TaskID: t.taskID, Epoch: t.epoch, Callback: callback, LinkType: linkType}
+	t.failed = t.builder.Faults.ShouldFail(p)
+	failed := t.failed
+	t.mu.Unlock()
+	if !failed {
+		return false
+	}
+	t.logger.Warnf("task %d fails on purpose at %s of epoch %d", t.taskID, callback, p.Epoch)
+	framework.StopNode(t.framework)
+	select {
+	case t.builder.FailChan <- t.taskID:
+	default:
+	}
+	return true
+}
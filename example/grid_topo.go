@@ -0,0 +1,86 @@
+package example
+
+import "github.com/go-distributed/meritop"
+
+// GridTopology lays tasks out row by row on a 2D grid of given columns, each
+// task linked to the tasks above, below, left and right of it. This fits
+// model-parallel algorithms which exchange the borders of blocks with their
+// neighbors, e.g. stencil computations and block matrix factorization, by
+// flagging meta and requesting data along LinkUp, LinkDown, LinkLeft and
+// LinkRight. The last row is short if the tasks don't fill it. The grid
+// doesn't wrap around, so that no task is its neighbor by two links, and it
+// stays the same between epochs.
+type GridTopology struct {
+	numOfColumns       uint64
+	numOfTasks, taskID uint64
+}
+
+// NewGridTopology creates a grid of nTasks tasks, numOfColumns of them per
+// row. numOfColumns must be positive.
+func NewGridTopology(numOfColumns, nTasks uint64) *GridTopology {
+	return &GridTopology{numOfColumns: numOfColumns, numOfTasks: nTasks}
+}
+
+// Position returns the row and column of the task, counted from 0.
+func (t *GridTopology) Position(taskID uint64) (row, column uint64) {
+	return taskID / t.numOfColumns, taskID % t.numOfColumns
+}
+
+// TaskAt returns the ID of the task at given row and column, false if there
+// is none.
+func (t *GridTopology) TaskAt(row, column uint64) (uint64, bool) {
+	id := row*t.numOfColumns + column
+	if column >= t.numOfColumns || id >= t.numOfTasks {
+		return 0, false
+	}
+	return id, true
+}
+
+func (t *GridTopology) SetTaskID(taskID uint64) { t.taskID = taskID }
+
+func (t *GridTopology) SetNumberOfTasks(nt uint64) { t.numOfTasks = nt }
+
+func (t *GridTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkUp, meritop.LinkDown, meritop.LinkLeft, meritop.LinkRight}
+}
+
+func (t *GridTopology) GetReverseLinkType(linkType string) string {
+	switch linkType {
+	case meritop.LinkUp:
+		return meritop.LinkDown
+	case meritop.LinkDown:
+		return meritop.LinkUp
+	case meritop.LinkLeft:
+		return meritop.LinkRight
+	case meritop.LinkRight:
+		return meritop.LinkLeft
+	}
+	return ""
+}
+
+func (t *GridTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	if t.taskID >= t.numOfTasks {
+		return nil
+	}
+	row, column := t.Position(t.taskID)
+	var id uint64
+	ok := false
+	switch linkType {
+	case meritop.LinkUp:
+		if row > 0 {
+			id, ok = t.TaskAt(row-1, column)
+		}
+	case meritop.LinkDown:
+		id, ok = t.TaskAt(row+1, column)
+	case meritop.LinkLeft:
+		if column > 0 {
+			id, ok = t.TaskAt(row, column-1)
+		}
+	case meritop.LinkRight:
+		id, ok = t.TaskAt(row, column+1)
+	}
+	if !ok {
+		return nil
+	}
+	return []uint64{id}
+}
@@ -0,0 +1,65 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/topoutil"
+)
+
+func TestGridTopology(t *testing.T) {
+	// 0 1 2
+	// 3 4 5
+	// 6 7
+	topo := NewGridTopology(3, 8)
+	tests := []struct {
+		id                    uint64
+		up, down, left, right []uint64
+	}{
+		{0, nil, []uint64{3}, nil, []uint64{1}},
+		{2, nil, []uint64{5}, []uint64{1}, nil},
+		{4, []uint64{1}, []uint64{7}, []uint64{3}, []uint64{5}},
+		// No task below 5 in the short last row.
+		{5, []uint64{2}, nil, []uint64{4}, nil},
+		{7, []uint64{4}, nil, []uint64{6}, nil},
+	}
+	for _, tt := range tests {
+		topo.SetTaskID(tt.id)
+		for linkType, want := range map[string][]uint64{
+			meritop.LinkUp:    tt.up,
+			meritop.LinkDown:  tt.down,
+			meritop.LinkLeft:  tt.left,
+			meritop.LinkRight: tt.right,
+		} {
+			if g := topo.GetNeighbors(linkType, 0); !reflect.DeepEqual(g, want) {
+				t.Errorf("%s of task %d = %v, want %v", linkType, tt.id, g, want)
+			}
+		}
+	}
+	if row, column := topo.Position(7); row != 2 || column != 1 {
+		t.Errorf("Position(7) = %d, %d, want 2, 1", row, column)
+	}
+	if _, ok := topo.TaskAt(2, 2); ok {
+		t.Errorf("TaskAt(2, 2) found a task beyond the 8 tasks")
+	}
+	for _, n := range []uint64{1, 2, 3, 8, 9, 20} {
+		if err := topoutil.Validate(NewGridTopology(3, n), n, 0); err != nil {
+			t.Errorf("%d tasks: %v", n, err)
+		}
+	}
+}
+
+func TestRegisteredGrid(t *testing.T) {
+	topo, err := meritop.NewTopology("grid", 16, meritop.Params{"columns": "4"})
+	if err != nil {
+		t.Fatalf("NewTopology failed: %v", err)
+	}
+	topo.SetTaskID(5)
+	if d := topo.GetNeighbors(meritop.LinkDown, 0); !reflect.DeepEqual(d, []uint64{9}) {
+		t.Errorf("down of task 5 = %v, want [9]", d)
+	}
+	if _, err := meritop.NewTopology("grid", 16, meritop.Params{"columns": "0"}); err == nil {
+		t.Errorf("0 columns should fail")
+	}
+}
@@ -0,0 +1,88 @@
+package example
+
+import "github.com/go-distributed/meritop"
+
+// HierarchicalTreeTopology is a tree whose fan-out depends on the level, e.g.
+// to aggregate along a network hierarchy: with fan-outs 4 and 8, the root has
+// 4 aggregators, one per rack, and each aggregator the 8 leaves of its rack.
+// Tasks fill the tree level by level, task 0 being the root. Levels below the
+// last fan-out keep to it. Like TreeTopology, it stays the same between
+// epochs.
+type HierarchicalTreeTopology struct {
+	fanouts            []uint64
+	numOfTasks, taskID uint64
+	parents, children  []uint64
+}
+
+// NewHierarchicalTreeTopology creates a tree of nTasks tasks with given
+// fan-outs, from the root down. Fan-outs must be positive.
+func NewHierarchicalTreeTopology(fanouts []uint64, nTasks uint64) *HierarchicalTreeTopology {
+	return &HierarchicalTreeTopology{fanouts: fanouts, numOfTasks: nTasks}
+}
+
+func (t *HierarchicalTreeTopology) fanout(level int) uint64 {
+	if level < len(t.fanouts) {
+		return t.fanouts[level]
+	}
+	return t.fanouts[len(t.fanouts)-1]
+}
+
+// locate returns the level of the task, the ID of the first task of the
+// level, and the number of tasks the level holds in a full tree.
+func (t *HierarchicalTreeTopology) locate(taskID uint64) (level int, first, width uint64) {
+	width = 1
+	for taskID >= first+width {
+		first += width
+		width *= t.fanout(level)
+		level++
+	}
+	return level, first, width
+}
+
+func (t *HierarchicalTreeTopology) SetTaskID(taskID uint64) {
+	t.taskID = taskID
+	t.parents, t.children = nil, nil
+	if taskID >= t.numOfTasks {
+		return
+	}
+	level, first, width := t.locate(taskID)
+	index := taskID - first
+	if level > 0 {
+		// The level above holds width / fanout(level-1) tasks.
+		fanout := t.fanout(level - 1)
+		t.parents = []uint64{first - width/fanout + index/fanout}
+	}
+	fanout := t.fanout(level)
+	for child := first + width + index*fanout; child < first+width+(index+1)*fanout && child < t.numOfTasks; child++ {
+		t.children = append(t.children, child)
+	}
+}
+
+func (t *HierarchicalTreeTopology) SetNumberOfTasks(nt uint64) {
+	t.numOfTasks = nt
+	t.SetTaskID(t.taskID)
+}
+
+func (t *HierarchicalTreeTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkParent, meritop.LinkChild}
+}
+
+func (t *HierarchicalTreeTopology) GetReverseLinkType(linkType string) string {
+	switch linkType {
+	case meritop.LinkParent:
+		return meritop.LinkChild
+	case meritop.LinkChild:
+		return meritop.LinkParent
+	}
+	return ""
+}
+
+func (t *HierarchicalTreeTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	switch linkType {
+	case meritop.LinkParent:
+		return t.parents
+	case meritop.LinkChild:
+		return t.children
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/topoutil"
+)
+
+func TestHierarchicalTreeTopology(t *testing.T) {
+	//          0
+	//    1           2
+	// 3 4 5 6     7 8 9 10
+	// 11 12 13
+	topo := NewHierarchicalTreeTopology([]uint64{2, 4}, 14)
+	tests := []struct {
+		id                uint64
+		parents, children []uint64
+	}{
+		{0, nil, []uint64{1, 2}},
+		{1, []uint64{0}, []uint64{3, 4, 5, 6}},
+		{2, []uint64{0}, []uint64{7, 8, 9, 10}},
+		{6, []uint64{1}, nil},
+		{7, []uint64{2}, nil},
+		// Levels below the last fan-out keep to it.
+		{3, []uint64{1}, []uint64{11, 12, 13}},
+		{13, []uint64{3}, nil},
+	}
+	for _, tt := range tests {
+		topo.SetTaskID(tt.id)
+		if p := topo.GetNeighbors(meritop.LinkParent, 0); !reflect.DeepEqual(p, tt.parents) {
+			t.Errorf("parents of task %d = %v, want %v", tt.id, p, tt.parents)
+		}
+		if c := topo.GetNeighbors(meritop.LinkChild, 0); !reflect.DeepEqual(c, tt.children) {
+			t.Errorf("children of task %d = %v, want %v", tt.id, c, tt.children)
+		}
+	}
+	for _, n := range []uint64{1, 2, 3, 11, 14, 50} {
+		if err := topoutil.Validate(NewHierarchicalTreeTopology([]uint64{2, 4}, n), n, 0); err != nil {
+			t.Errorf("%d tasks: %v", n, err)
+		}
+	}
+}
+
+func TestRegisteredHierarchy(t *testing.T) {
+	topo, err := meritop.NewTopology("hierarchy", 37, meritop.Params{"fanouts": "4,8"})
+	if err != nil {
+		t.Fatalf("NewTopology failed: %v", err)
+	}
+	topo.SetTaskID(4)
+	if c := topo.GetNeighbors(meritop.LinkChild, 0); len(c) != 8 || c[0] != 29 {
+		t.Errorf("children of the last aggregator = %v, want 29 to 36", c)
+	}
+	for _, fanouts := range []string{"", "4,0", "x"} {
+		if _, err := meritop.NewTopology("hierarchy", 37, meritop.Params{"fanouts": fanouts}); err == nil {
+			t.Errorf("fanouts %q should fail", fanouts)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/kube"
+)
+
+// pollInterval is how often the harness checks the pods of a job.
+var pollInterval = 2 * time.Second
+
+// Harness runs jobs on the cluster kubectl is configured for.
+type Harness struct {
+	// Kubectl is the path of kubectl, "kubectl" if empty.
+	Kubectl string
+	// Log takes the log of the controller, and the output of kubectl.
+	Log io.Writer
+}
+
+func (h *Harness) kubectl(stdin []byte, args ...string) ([]byte, error) {
+	path := h.Kubectl
+	if path == "" {
+		path = "kubectl"
+	}
+	cmd := exec.Command(path, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("k8s: kubectl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Apply creates or updates the objects of the job.
+func (h *Harness) Apply(j Job) error {
+	data, err := Render(j)
+	if err != nil {
+		return err
+	}
+	out, err := h.kubectl(data, "apply", "-f", "-")
+	if err == nil && h.Log != nil {
+		h.Log.Write(out)
+	}
+	return err
+}
+
+// WaitRollout waits until the controller and a pod per task of the job run,
+// or the job is over, or timeout.
+func (h *Harness) WaitRollout(j Job, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		phase, err := h.podPhase(j, j.ControllerPod())
+		if err != nil {
+			return err
+		}
+		running, err := h.runningTasks(j)
+		if err != nil {
+			return err
+		}
+		switch {
+		case phase == kube.PodRunning && running >= j.Tasks:
+			return nil
+		case phase == kube.PodSucceeded:
+			// The job is over already.
+			return nil
+		case phase == kube.PodFailed:
+			return fmt.Errorf("k8s: controller of job %s failed before the rollout", j.Name)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("k8s: job %s has %d of %d tasks running, controller %s, after %v",
+				j.Name, running, j.Tasks, phase, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// StreamStatus copies the log of the controller of the job to h.Log until
+// the controller exits.
+func (h *Harness) StreamStatus(j Job) error {
+	path := h.Kubectl
+	if path == "" {
+		path = "kubectl"
+	}
+	cmd := exec.Command(path, "logs", "-f", "-n", j.namespace(), j.ControllerPod())
+	cmd.Stdout, cmd.Stderr = h.Log, h.Log
+	return cmd.Run()
+}
+
+// Wait waits until the controller of the job exits, or timeout. It returns
+// an error unless the job succeeded.
+func (h *Harness) Wait(j Job, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		phase, err := h.podPhase(j, j.ControllerPod())
+		if err != nil {
+			return err
+		}
+		switch phase {
+		case kube.PodSucceeded:
+			return nil
+		case kube.PodFailed:
+			return fmt.Errorf("k8s: job %s failed", j.Name)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("k8s: job %s still runs after %v", j.Name, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// TearDown deletes the objects of the job, including the pods of its tasks
+// the controller might have left behind.
+func (h *Harness) TearDown(j Job) error {
+	_, err := h.kubectl(nil, "delete", "all,serviceaccount,role,rolebinding",
+		"-n", j.namespace(), "-l", kube.LabelJob+"="+j.Name, "--ignore-not-found")
+	return err
+}
+
+func (h *Harness) podPhase(j Job, pod string) (string, error) {
+	out, err := h.kubectl(nil, "get", "pod", pod, "-n", j.namespace(), "-o", "jsonpath={.status.phase}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (h *Harness) runningTasks(j Job) (uint64, error) {
+	out, err := h.kubectl(nil, "get", "pods", "-n", j.namespace(),
+		"-l", kube.LabelJob+"="+j.Name+","+kube.LabelRole+"="+kube.RoleTask,
+		"-o", "jsonpath={.items[*].status.phase}")
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, phase := range strings.Fields(string(out)) {
+		if phase == kube.PodRunning {
+			n++
+		}
+	}
+	return n, nil
+}
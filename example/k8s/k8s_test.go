@@ -0,0 +1,89 @@
+package k8s
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func psJob(name, image string) Job {
+	return Job{
+		Name:       name,
+		Image:      image,
+		Tasks:      4,
+		Standbys:   1,
+		Spec:       etcdutil.JobSpec{Task: "ps", Topology: "ps", Params: map[string]string{"servers": "1", "epochs": "20"}},
+		WorkerArgs: []string{"-compression", "snappy"},
+	}
+}
+
+func TestRender(t *testing.T) {
+	data, err := Render(psJob("ps", "meritop"))
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			Kind     string
+			Metadata struct{ Name string }
+			Spec     struct {
+				Containers []struct{ Args []string }
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatalf("manifests aren't JSON: %v", err)
+	}
+	var kinds []string
+	for _, item := range list.Items {
+		kinds = append(kinds, item.Kind+"/"+item.Metadata.Name)
+	}
+	want := []string{"Pod/ps-etcd", "Service/ps-etcd", "ServiceAccount/ps-controller",
+		"Role/ps-controller", "RoleBinding/ps-controller", "Pod/ps-controller"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("objects = %v, want %v", kinds, want)
+	}
+	args := list.Items[len(list.Items)-1].Spec.Containers[0].Args
+	wantArgs := []string{"-name", "ps", "-tasks", "4", "-task", "ps", "-topology", "ps",
+		"-etcd", "http://ps-etcd:2379", "-kube-image", "meritop", "-kube-namespace", "default",
+		"-param", "epochs=20", "-param", "servers=1", "-kube-standbys", "1", "-kube-args", "-compression snappy"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("controller args = %q, want %q", args, wantArgs)
+	}
+
+	if _, err := Render(Job{Name: "ps", Image: "meritop", Tasks: 4}); err == nil {
+		t.Errorf("Render without task and topology succeeded")
+	}
+}
+
+// TestEndToEnd runs the parameter server example on the cluster kubectl is
+// configured for, in the image of $MERITOP_E2E_K8S_IMAGE.
+func TestEndToEnd(t *testing.T) {
+	image := os.Getenv("MERITOP_E2E_K8S_IMAGE")
+	if image == "" {
+		t.Skip("MERITOP_E2E_K8S_IMAGE isn't set")
+	}
+	j := psJob("e2e-"+strconv.FormatInt(time.Now().Unix(), 10), image)
+	j.Namespace = os.Getenv("MERITOP_E2E_K8S_NAMESPACE")
+	h := &Harness{Log: os.Stdout}
+	defer func() {
+		if err := h.TearDown(j); err != nil {
+			t.Errorf("TearDown failed: %v", err)
+		}
+	}()
+	if err := h.Apply(j); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := h.WaitRollout(j, 5*time.Minute); err != nil {
+		t.Fatalf("WaitRollout failed: %v", err)
+	}
+	go h.StreamStatus(j)
+	if err := h.Wait(j, 10*time.Minute); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Package k8s runs a meritop job on a real Kubernetes cluster, end to end: it
+renders the manifests of the job from its spec, applies them with kubectl,
+waits for the pods to roll out, streams the log of the controller until the
+job is over, and tears everything down.
+
+The manifests hold an etcd pod and service for the job, the service account
+the controller manages the pods of the job as, and the pod of
+meritop-controller, which runs the nodes of the job in pods of the same
+image (see meritop-controller -kube-image and package kube). The image runs
+meritop-worker as its entrypoint, and has meritop-controller on its path too,
+both built with the task builders and topologies of the job, e.g. those of
+package example, as the image of the Dockerfile of this directory.
+
+Render prints the manifests as a JSON list, which "kubectl apply -f" takes:
+
+	data, _ := k8s.Render(k8s.Job{Name: "ps", Image: "meritop", Tasks: 4,
+		Spec: etcdutil.JobSpec{Task: "ps", Topology: "ps", Params: map[string]string{"servers": "1"}}})
+
+The end-to-end test of the package runs the parameter server example on the
+cluster kubectl is configured for, in the image of $MERITOP_E2E_K8S_IMAGE,
+and is skipped if it isn't set, so that the Kubernetes integration is
+checked against a real cluster as the framework evolves.
+*/
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/kube"
+)
+
+// DefaultEtcdImage is the image of the etcd of a job by default.
+const DefaultEtcdImage = "quay.io/coreos/etcd:v2.3.8"
+
+const etcdPort = 2379
+
+// Job is a job to run on Kubernetes.
+type Job struct {
+	Name string
+	// Namespace of the objects of the job, "default" if empty
+	Namespace string
+	// Image has meritop-controller and meritop-worker
+	Image string
+	// EtcdImage is DefaultEtcdImage if empty
+	EtcdImage string
+	Tasks     uint64
+	Standbys  int
+	// Spec of the job, of which plugins and dependencies aren't supported
+	Spec etcdutil.JobSpec
+	// WorkerArgs are flags of the workers, e.g. -compression snappy
+	WorkerArgs []string
+}
+
+func (j *Job) namespace() string {
+	if j.Namespace == "" {
+		return "default"
+	}
+	return j.Namespace
+}
+
+func (j *Job) etcdImage() string {
+	if j.EtcdImage == "" {
+		return DefaultEtcdImage
+	}
+	return j.EtcdImage
+}
+
+// ControllerPod is the name of the pod of the controller of the job.
+func (j *Job) ControllerPod() string { return j.Name + "-controller" }
+
+func (j *Job) etcdName() string { return j.Name + "-etcd" }
+
+func (j *Job) etcdURL() string {
+	return "http://" + j.etcdName() + ":" + strconv.Itoa(etcdPort)
+}
+
+// object is a Kubernetes object, as rendered to JSON.
+type object map[string]interface{}
+
+// Render returns the manifests of the job, as a JSON list of objects.
+func Render(j Job) ([]byte, error) {
+	if j.Name == "" || j.Image == "" || j.Tasks == 0 {
+		return nil, errors.New("k8s: a job needs a name, an image and tasks")
+	}
+	if j.Spec.Task == "" || j.Spec.Topology == "" {
+		return nil, errors.New("k8s: the job spec needs both a task and a topology")
+	}
+	if len(j.Spec.Plugins) > 0 || len(j.Spec.DependsOn) > 0 {
+		return nil, errors.New("k8s: plugins and dependencies aren't supported")
+	}
+	list := object{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      objects(&j),
+	}
+	return json.MarshalIndent(list, "", "  ")
+}
+
+func objects(j *Job) []object {
+	meta := func(name, role string) object {
+		l := map[string]string{kube.LabelJob: j.Name, kube.LabelRole: role}
+		return object{"name": name, "namespace": j.namespace(), "labels": l}
+	}
+	etcdLabels := map[string]string{kube.LabelJob: j.Name, kube.LabelRole: "etcd"}
+	return []object{
+		{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   meta(j.etcdName(), "etcd"),
+			"spec": object{
+				"containers": []object{{
+					"name":    "etcd",
+					"image":   j.etcdImage(),
+					"command": []string{"etcd"},
+					"args": []string{
+						"-listen-client-urls", "http://0.0.0.0:" + strconv.Itoa(etcdPort),
+						"-advertise-client-urls", j.etcdURL(),
+					},
+					"ports": []object{{"containerPort": etcdPort}},
+				}},
+			},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   meta(j.etcdName(), "etcd"),
+			"spec": object{
+				"selector": etcdLabels,
+				"ports":    []object{{"port": etcdPort}},
+			},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ServiceAccount",
+			"metadata":   meta(j.ControllerPod(), "controller"),
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "Role",
+			"metadata":   meta(j.ControllerPod(), "controller"),
+			"rules": []object{{
+				"apiGroups": []string{""},
+				"resources": []string{"pods"},
+				"verbs":     []string{"get", "list", "create", "delete"},
+			}},
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "RoleBinding",
+			"metadata":   meta(j.ControllerPod(), "controller"),
+			"roleRef": object{
+				"apiGroup": "rbac.authorization.k8s.io",
+				"kind":     "Role",
+				"name":     j.ControllerPod(),
+			},
+			"subjects": []object{{
+				"kind":      "ServiceAccount",
+				"name":      j.ControllerPod(),
+				"namespace": j.namespace(),
+			}},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   meta(j.ControllerPod(), "controller"),
+			"spec": object{
+				"serviceAccountName": j.ControllerPod(),
+				"restartPolicy":      "Never",
+				// The controller sets up the layout of the job once etcd
+				// takes requests.
+				"initContainers": []object{{
+					"name":    "wait-etcd",
+					"image":   "busybox",
+					"command": []string{"sh", "-c", "until wget -q -O- " + j.etcdURL() + "/version; do sleep 1; done"},
+				}},
+				"containers": []object{{
+					"name":    "controller",
+					"image":   j.Image,
+					"command": []string{"meritop-controller"},
+					"args":    controllerArgs(j),
+				}},
+			},
+		},
+	}
+}
+
+// controllerArgs are the flags of meritop-controller running the job in pods
+// of the image of the job.
+func controllerArgs(j *Job) []string {
+	args := []string{
+		"-name", j.Name,
+		"-tasks", strconv.FormatUint(j.Tasks, 10),
+		"-task", j.Spec.Task,
+		"-topology", j.Spec.Topology,
+		"-etcd", j.etcdURL(),
+		"-kube-image", j.Image,
+		"-kube-namespace", j.namespace(),
+	}
+	var names []string
+	for name := range j.Spec.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-param", name+"="+j.Spec.Params[name])
+	}
+	for _, p := range j.Spec.Phases {
+		phase := p.Name + ":" + strconv.FormatUint(p.Epochs, 10)
+		if p.Topology != "" {
+			phase += ":" + p.Topology
+		}
+		args = append(args, "-phase", phase)
+	}
+	if j.Standbys > 0 {
+		args = append(args, "-kube-standbys", strconv.Itoa(j.Standbys))
+	}
+	if len(j.WorkerArgs) > 0 {
+		args = append(args, "-kube-args", strings.Join(j.WorkerArgs, " "))
+	}
+	return args
+}
@@ -0,0 +1,46 @@
+package loadgen
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestLoadgen(t *testing.T) {
+	job := "TestLoadgen"
+	numOfTasks := uint64(4)
+	client := etcdutil.NewMemoryCoordinator()
+	c := controller.New(job, client, numOfTasks)
+	if err := c.Start(); err != nil {
+		t.Fatalf("controller Start failed: %v", err)
+	}
+	defer c.Stop()
+
+	epochs := make(chan uint64, 4)
+	builder := &TaskBuilder{
+		Bytes:       1 << 10,
+		NumOfEpochs: 3,
+		EpochDone:   func(epoch uint64) { epochs <- epoch },
+	}
+	for i := uint64(0); i < numOfTasks; i++ {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen failed: %v", err)
+		}
+		bootstrap := framework.NewBootStrap(job, nil, ln, log.New(ioutil.Discard, "", 0), framework.WithCoordinator(client))
+		bootstrap.SetTaskBuilder(builder)
+		bootstrap.SetTopology(example.NewTreeTopology(2, numOfTasks))
+		go bootstrap.Start()
+	}
+	for want := uint64(0); want <= builder.NumOfEpochs; want++ {
+		if epoch := <-epochs; epoch != want {
+			t.Fatalf("epoch done = %d, want %d", epoch, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Package loadgen generates load on the transport and etcd of a cluster, e.g.
+to size a deployment before running real jobs on it.
+
+The tasks form a tree. At every epoch, every task serves a payload of Bytes
+bytes to its parent, once it has got the payloads of its children. The root
+moves to the next epoch once it has got its children's, so that every epoch
+moves Bytes times the number of links in the tree, and flags as much meta.
+*/
+package loadgen
+
+import (
+	"sync"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+const (
+	payloadReady = "PayloadReady"
+	reqPayload   = "payload"
+)
+
+// TaskBuilder builds the tasks of the load.
+type TaskBuilder struct {
+	Bytes       int
+	NumOfEpochs uint64
+	// EpochDone is called by the root at the end of every epoch, if set.
+	EpochDone func(epoch uint64)
+}
+
+func (b *TaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &task{builder: b, payload: make([]byte, b.Bytes)}
+}
+
+// The tasks are registered for worker binaries, e.g.
+// "-task loadgen -topology tree -param bytes=1048576".
+func init() {
+	meritop.RegisterTaskBuilder("loadgen", func(numOfTasks uint64, params meritop.Params) (meritop.TaskBuilder, error) {
+		bytes, err := params.Uint("bytes", 1<<20)
+		if err != nil {
+			return nil, err
+		}
+		epochs, err := params.Uint("epochs", 100)
+		if err != nil {
+			return nil, err
+		}
+		return &TaskBuilder{Bytes: int(bytes), NumOfEpochs: epochs}, nil
+	})
+}
+
+type task struct {
+	builder   *TaskBuilder
+	framework meritop.Framework
+	taskID    uint64
+	logger    logging.Logger
+	payload   []byte
+
+	// Callbacks can be invoked concurrently.
+	mu           sync.Mutex
+	epoch        uint64
+	fromChildren map[uint64]bool
+}
+
+func (t *task) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID = taskID
+	t.framework = framework
+	t.logger = framework.GetLogger()
+}
+
+func (t *task) Exit() {}
+
+func (t *task) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	t.epoch = epoch
+	t.fromChildren = make(map[uint64]bool)
+	t.mu.Unlock()
+	if len(t.framework.GetTopology().GetNeighbors(meritop.LinkChild, epoch)) == 0 {
+		t.finishEpoch(epoch)
+	}
+}
+
+func (t *task) MetaReady(fromID uint64, linkType, meta string) {
+	if linkType == meritop.LinkChild && meta == payloadReady {
+		t.framework.DataRequest(fromID, reqPayload)
+	}
+}
+
+func (t *task) Serve(fromID uint64, linkType, req string) []byte { return t.payload }
+
+func (t *task) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	if linkType != meritop.LinkChild {
+		return
+	}
+	if len(resp) != t.builder.Bytes {
+		t.logger.Errorf("task %d got %d bytes from %d, want %d", t.taskID, len(resp), fromID, t.builder.Bytes)
+	}
+	t.mu.Lock()
+	epoch := t.epoch
+	if t.fromChildren[fromID] {
+		// at-least-once delivery
+		t.mu.Unlock()
+		return
+	}
+	t.fromChildren[fromID] = true
+	done := len(t.fromChildren) == len(t.framework.GetTopology().GetNeighbors(meritop.LinkChild, epoch))
+	t.mu.Unlock()
+	if done {
+		t.finishEpoch(epoch)
+	}
+}
+
+func (t *task) finishEpoch(epoch uint64) {
+	if t.taskID != 0 {
+		t.framework.FlagMetaToParent(payloadReady)
+		return
+	}
+	if t.builder.EpochDone != nil {
+		t.builder.EpochDone(epoch)
+	}
+	if epoch < t.builder.NumOfEpochs {
+		t.framework.IncEpoch()
+		return
+	}
+	t.framework.ShutdownJob()
+}
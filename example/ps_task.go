@@ -0,0 +1,240 @@
+package example
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+/*
+The parameter server tasks show how to push and pull parameter shards on the
+parameter server topology. The model is a vector of Dim values, split evenly
+across servers. Worker w owns data point w, and minimizes the squared distance
+between the model and its data point. At each epoch:
+1. servers flag "ParamReady" to workers;
+2. workers pull every shard, compute the gradient, and flag "GradientReady";
+3. servers pull the gradient of their shard from every worker, apply the
+   averaged gradient, and flag "ShardUpdated";
+4. the first worker advances the epoch when all shards are updated.
+After NumOfEpochs epochs the model converges to the mean of workers' data, and
+every server reports its shard on ShardChan.
+*/
+
+const (
+	psParamReady    = "ParamReady"
+	psGradientReady = "GradientReady"
+	psShardUpdated  = "ShardUpdated"
+	psReqParam      = "param"
+	psReqGradient   = "gradient"
+)
+
+type PSTaskBuilder struct {
+	NumOfServers, NumOfWorkers uint64
+	Dim                        int
+	LearningRate               float64
+	NumOfEpochs                uint64
+	// ShardChan receives the final shard of each server, keyed by server ID.
+	ShardChan chan map[uint64][]float64
+}
+
+func (b *PSTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	if taskID < b.NumOfServers {
+		return &psServer{builder: b}
+	}
+	return &psWorker{builder: b}
+}
+
+// shardRange returns the range of the model kept by given server.
+func (b *PSTaskBuilder) shardRange(serverID uint64) (int, int) {
+	size := (b.Dim + int(b.NumOfServers) - 1) / int(b.NumOfServers)
+	from := int(serverID) * size
+	to := from + size
+	if to > b.Dim {
+		to = b.Dim
+	}
+	if from > to {
+		from = to
+	}
+	return from, to
+}
+
+type psServer struct {
+	builder   *PSTaskBuilder
+	framework meritop.Framework
+	taskID    uint64
+	logger    logging.Logger
+
+	// Callbacks can be invoked concurrently.
+	mu          sync.Mutex
+	epoch       uint64
+	shard       []float64
+	gradient    []float64
+	fromWorkers map[uint64]bool
+}
+
+func (t *psServer) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID = taskID
+	t.framework = framework
+	t.logger = framework.GetLogger()
+	from, to := t.builder.shardRange(taskID)
+	t.shard = make([]float64, to-from)
+}
+
+func (t *psServer) Exit() {}
+
+func (t *psServer) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	t.epoch = epoch
+	t.gradient = make([]float64, len(t.shard))
+	t.fromWorkers = make(map[uint64]bool)
+	t.mu.Unlock()
+	t.framework.FlagMeta(meritop.LinkWorker, psParamReady)
+}
+
+func (t *psServer) MetaReady(fromID uint64, linkType, meta string) {
+	if linkType == meritop.LinkWorker && meta == psGradientReady {
+		t.framework.DataRequest(fromID, psReqGradient)
+	}
+}
+
+func (t *psServer) Serve(fromID uint64, linkType, req string) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, err := json.Marshal(t.shard)
+	if err != nil {
+		t.logger.Fatalf("server %d can't encode shard: %v", t.taskID, err)
+	}
+	return b
+}
+
+func (t *psServer) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	var g []float64
+	if err := json.Unmarshal(resp, &g); err != nil {
+		t.logger.Fatalf("server %d can't decode gradient from %d: %v", t.taskID, fromID, err)
+	}
+	t.mu.Lock()
+	if t.fromWorkers[fromID] {
+		// at-least-once delivery
+		t.mu.Unlock()
+		return
+	}
+	t.fromWorkers[fromID] = true
+	for i := range g {
+		t.gradient[i] += g[i]
+	}
+	if uint64(len(t.fromWorkers)) < t.builder.NumOfWorkers {
+		t.mu.Unlock()
+		return
+	}
+	for i := range t.shard {
+		t.shard[i] -= t.builder.LearningRate * t.gradient[i] / float64(t.builder.NumOfWorkers)
+	}
+	epoch := t.epoch
+	shard := append([]float64(nil), t.shard...)
+	t.mu.Unlock()
+
+	if epoch == t.builder.NumOfEpochs && t.builder.ShardChan != nil {
+		t.builder.ShardChan <- map[uint64][]float64{t.taskID: shard}
+	}
+	t.framework.FlagMeta(meritop.LinkWorker, psShardUpdated)
+}
+
+type psWorker struct {
+	builder   *PSTaskBuilder
+	framework meritop.Framework
+	taskID    uint64
+	logger    logging.Logger
+
+	mu      sync.Mutex
+	epoch   uint64
+	model   []float64
+	pulled  map[uint64]bool
+	updated map[uint64]bool
+}
+
+func (t *psWorker) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID = taskID
+	t.framework = framework
+	t.logger = framework.GetLogger()
+}
+
+func (t *psWorker) Exit() {}
+
+func (t *psWorker) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.epoch = epoch
+	t.model = make([]float64, t.builder.Dim)
+	t.pulled = make(map[uint64]bool)
+	t.updated = make(map[uint64]bool)
+}
+
+func (t *psWorker) MetaReady(fromID uint64, linkType, meta string) {
+	if linkType != meritop.LinkServer {
+		return
+	}
+	switch meta {
+	case psParamReady:
+		t.framework.DataRequest(fromID, psReqParam)
+	case psShardUpdated:
+		t.mu.Lock()
+		t.updated[fromID] = true
+		done := uint64(len(t.updated)) == t.builder.NumOfServers
+		epoch := t.epoch
+		t.mu.Unlock()
+		// The first worker drives the epochs.
+		if !done || t.taskID != t.builder.NumOfServers {
+			return
+		}
+		if epoch == t.builder.NumOfEpochs {
+			t.framework.ShutdownJob()
+		} else {
+			t.framework.IncEpoch()
+		}
+	}
+}
+
+// Serve gives a server the gradient of its shard.
+func (t *psWorker) Serve(fromID uint64, linkType, req string) []byte {
+	from, to := t.builder.shardRange(fromID)
+	t.mu.Lock()
+	g := make([]float64, to-from)
+	target := t.dataPoint()
+	for i := range g {
+		g[i] = t.model[from+i] - target
+	}
+	t.mu.Unlock()
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.logger.Fatalf("worker %d can't encode gradient: %v", t.taskID, err)
+	}
+	return b
+}
+
+func (t *psWorker) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	var shard []float64
+	if err := json.Unmarshal(resp, &shard); err != nil {
+		t.logger.Fatalf("worker %d can't decode shard from %d: %v", t.taskID, fromID, err)
+	}
+	from, _ := t.builder.shardRange(fromID)
+	t.mu.Lock()
+	if t.pulled[fromID] {
+		t.mu.Unlock()
+		return
+	}
+	t.pulled[fromID] = true
+	copy(t.model[from:], shard)
+	done := uint64(len(t.pulled)) == t.builder.NumOfServers
+	t.mu.Unlock()
+	// Gradient is computed lazily in Serve; it only depends on the model.
+	if done {
+		t.framework.FlagMeta(meritop.LinkServer, psGradientReady)
+	}
+}
+
+// dataPoint is the data owned by this worker.
+func (t *psWorker) dataPoint() float64 {
+	return float64(t.taskID - t.builder.NumOfServers)
+}
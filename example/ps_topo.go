@@ -0,0 +1,64 @@
+package example
+
+import "github.com/go-distributed/meritop"
+
+// The parameter server topology splits tasks into servers and workers. Tasks
+// 0 to numOfServers-1 are servers, each holding a shard of the parameters;
+// the rest are workers. Every worker is linked to every server (fully
+// bipartite): a worker has all servers as LinkServer neighbors, and a server
+// has all workers as LinkWorker neighbors. It stays the same between epochs.
+type ParameterServerTopology struct {
+	numOfServers, numOfTasks uint64
+	taskID                   uint64
+}
+
+func (t *ParameterServerTopology) SetTaskID(taskID uint64) { t.taskID = taskID }
+
+func (t *ParameterServerTopology) SetNumberOfTasks(nt uint64) { t.numOfTasks = nt }
+
+func (t *ParameterServerTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkServer, meritop.LinkWorker}
+}
+
+func (t *ParameterServerTopology) GetReverseLinkType(linkType string) string {
+	switch linkType {
+	case meritop.LinkServer:
+		return meritop.LinkWorker
+	case meritop.LinkWorker:
+		return meritop.LinkServer
+	}
+	return ""
+}
+
+func (t *ParameterServerTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	isServer := t.IsServer(t.taskID)
+	switch {
+	case linkType == meritop.LinkServer && !isServer:
+		return idRange(0, t.numOfServers)
+	case linkType == meritop.LinkWorker && isServer:
+		return idRange(t.numOfServers, t.numOfTasks)
+	}
+	return nil
+}
+
+// IsServer tells whether given task is a server.
+func (t *ParameterServerTopology) IsServer(taskID uint64) bool {
+	return taskID < t.numOfServers
+}
+
+func idRange(from, to uint64) []uint64 {
+	ids := make([]uint64, 0, to-from)
+	for id := from; id < to; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Creates a new parameter server topology with given number of servers and
+// workers.
+func NewParameterServerTopology(nServers, nWorkers uint64) *ParameterServerTopology {
+	return &ParameterServerTopology{
+		numOfServers: nServers,
+		numOfTasks:   nServers + nWorkers,
+	}
+}
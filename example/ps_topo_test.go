@@ -0,0 +1,31 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+)
+
+// 2 servers (0, 1) and 3 workers (2, 3, 4).
+func TestParameterServerTopology(t *testing.T) {
+	tests := []struct {
+		id               uint64
+		servers, workers []uint64
+	}{
+		{0, nil, []uint64{2, 3, 4}},
+		{1, nil, []uint64{2, 3, 4}},
+		{2, []uint64{0, 1}, nil},
+		{4, []uint64{0, 1}, nil},
+	}
+	for i, tt := range tests {
+		topo := NewParameterServerTopology(2, 3)
+		topo.SetTaskID(tt.id)
+		if g := topo.GetNeighbors(meritop.LinkServer, 0); !reflect.DeepEqual(g, tt.servers) {
+			t.Errorf("#%d: servers want = %v, get = %v", i, tt.servers, g)
+		}
+		if g := topo.GetNeighbors(meritop.LinkWorker, 0); !reflect.DeepEqual(g, tt.workers) {
+			t.Errorf("#%d: workers want = %v, get = %v", i, tt.workers, g)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package example
+
+import (
+	"math/rand"
+
+	"github.com/go-distributed/meritop"
+)
+
+// The random pair topology pairs tasks randomly at each epoch, e.g. for
+// decentralized SGD where paired tasks average their models. The pairing is
+// derived from the job seed and the epoch only, so both sides of a pair
+// compute the same pairing without talking to each other. Framework sets the
+// same seed on every task (see meritop.SeededTopology). With odd number of
+// tasks, one task sits out at each epoch.
+type RandomPairTopology struct {
+	seed       int64
+	numOfTasks uint64
+	taskID     uint64
+}
+
+func (t *RandomPairTopology) SetTaskID(taskID uint64) { t.taskID = taskID }
+
+func (t *RandomPairTopology) SetNumberOfTasks(nt uint64) { t.numOfTasks = nt }
+
+func (t *RandomPairTopology) SetSeed(seed int64) { t.seed = seed }
+
+func (t *RandomPairTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkPeer}
+}
+
+func (t *RandomPairTopology) GetReverseLinkType(linkType string) string {
+	if linkType == meritop.LinkPeer {
+		return meritop.LinkPeer
+	}
+	return ""
+}
+
+func (t *RandomPairTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	if linkType != meritop.LinkPeer {
+		return nil
+	}
+	perm := t.permutation(epoch)
+	for i := 0; i+1 < len(perm); i += 2 {
+		switch t.taskID {
+		case perm[i]:
+			return []uint64{perm[i+1]}
+		case perm[i+1]:
+			return []uint64{perm[i]}
+		}
+	}
+	return nil
+}
+
+// permutation shuffles task IDs with a Fisher-Yates shuffle seeded by job seed
+// and epoch. We don't use rand.Perm so the result doesn't depend on its
+// implementation.
+func (t *RandomPairTopology) permutation(epoch uint64) []uint64 {
+	// mix epoch in so that consecutive epochs get unrelated seeds
+	r := rand.New(rand.NewSource(t.seed ^ int64(epoch*0x9E3779B97F4A7C15)))
+	perm := make([]uint64, t.numOfTasks)
+	for i := range perm {
+		perm[i] = uint64(i)
+	}
+	for i := len(perm) - 1; i > 0; i-- {
+		j := r.Int63n(int64(i) + 1)
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm
+}
+
+// Creates a new random pair topology with given number of tasks. The seed is
+// normally set by framework; it is given here for use outside of a job.
+func NewRandomPairTopology(seed int64, nTasks uint64) *RandomPairTopology {
+	return &RandomPairTopology{
+		seed:       seed,
+		numOfTasks: nTasks,
+	}
+}
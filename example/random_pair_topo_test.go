@@ -0,0 +1,58 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+)
+
+// peers returns the peer of every task at given epoch, -1 for no peer.
+func peers(seed int64, n, epoch uint64) []int64 {
+	res := make([]int64, n)
+	for id := uint64(0); id < n; id++ {
+		topo := NewRandomPairTopology(seed, n)
+		topo.SetTaskID(id)
+		p := topo.GetNeighbors(meritop.LinkPeer, epoch)
+		switch len(p) {
+		case 0:
+			res[id] = -1
+		case 1:
+			res[id] = int64(p[0])
+		default:
+			panic("more than one peer")
+		}
+	}
+	return res
+}
+
+func TestRandomPairTopology(t *testing.T) {
+	for _, n := range []uint64{2, 7, 10} {
+		for epoch := uint64(0); epoch < 5; epoch++ {
+			ps := peers(42, n, epoch)
+			alone := 0
+			for id, p := range ps {
+				if p == -1 {
+					alone++
+					continue
+				}
+				if p == int64(id) || ps[p] != int64(id) {
+					t.Errorf("n = %d, epoch = %d: task %d pairs with %d, which pairs with %d", n, epoch, id, p, ps[p])
+				}
+			}
+			if alone != int(n%2) {
+				t.Errorf("n = %d, epoch = %d: %d tasks without peer", n, epoch, alone)
+			}
+		}
+	}
+}
+
+func TestRandomPairTopologyChangesWithEpoch(t *testing.T) {
+	first := peers(42, 10, 0)
+	for epoch := uint64(1); epoch < 10; epoch++ {
+		if !reflect.DeepEqual(first, peers(42, 10, epoch)) {
+			return
+		}
+	}
+	t.Errorf("pairing never changes in 10 epochs")
+}
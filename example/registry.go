@@ -0,0 +1,108 @@
+package example
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-distributed/meritop"
+)
+
+// The example topologies and tasks are registered for worker binaries, e.g.
+// "-task ps -topology ps -param servers=2".
+func init() {
+	meritop.RegisterTopology("tree", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		fanout, err := params.Uint("fanout", 2)
+		if err != nil {
+			return nil, err
+		}
+		return NewTreeTopology(fanout, numOfTasks), nil
+	})
+	meritop.RegisterTopology("hierarchy", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		fanouts, err := parseFanouts(params["fanouts"])
+		if err != nil {
+			return nil, err
+		}
+		return NewHierarchicalTreeTopology(fanouts, numOfTasks), nil
+	})
+	meritop.RegisterTopology("ring", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		return NewRingTopology(numOfTasks), nil
+	})
+	meritop.RegisterTopology("grid", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		columns, err := params.Uint("columns", 2)
+		if err != nil {
+			return nil, err
+		}
+		if columns == 0 {
+			return nil, fmt.Errorf("grid: columns param must be positive")
+		}
+		return NewGridTopology(columns, numOfTasks), nil
+	})
+	meritop.RegisterTopology("randompair", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		// The seed is set by framework.
+		return NewRandomPairTopology(0, numOfTasks), nil
+	})
+	meritop.RegisterTopology("ps", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		servers, err := psServers(numOfTasks, params)
+		if err != nil {
+			return nil, err
+		}
+		return NewParameterServerTopology(servers, numOfTasks-servers), nil
+	})
+	meritop.RegisterTaskBuilder("ps", newPSTaskBuilder)
+}
+
+// parseFanouts parses the "fanouts" param of the hierarchy topology, comma
+// separated from the root down, e.g. "4,8".
+func parseFanouts(s string) ([]uint64, error) {
+	if s == "" {
+		return nil, fmt.Errorf("hierarchy: fanouts param is required, e.g. fanouts=4,8")
+	}
+	var fanouts []uint64
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(f, 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("hierarchy: bad fanout %q", f)
+		}
+		fanouts = append(fanouts, n)
+	}
+	return fanouts, nil
+}
+
+// psServers is the "servers" param, 1 by default. Other tasks are workers.
+func psServers(numOfTasks uint64, params meritop.Params) (uint64, error) {
+	servers, err := params.Uint("servers", 1)
+	if err != nil {
+		return 0, err
+	}
+	if servers == 0 || servers >= numOfTasks {
+		return 0, fmt.Errorf("ps: %d servers out of %d tasks leave no server or no worker", servers, numOfTasks)
+	}
+	return servers, nil
+}
+
+func newPSTaskBuilder(numOfTasks uint64, params meritop.Params) (meritop.TaskBuilder, error) {
+	servers, err := psServers(numOfTasks, params)
+	if err != nil {
+		return nil, err
+	}
+	dim, err := params.Uint("dim", 10)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := params.Float("rate", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	epochs, err := params.Uint("epochs", 10)
+	if err != nil {
+		return nil, err
+	}
+	return &PSTaskBuilder{
+		NumOfServers: servers,
+		NumOfWorkers: numOfTasks - servers,
+		Dim:          int(dim),
+		LearningRate: rate,
+		NumOfEpochs:  epochs,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package example
+
+import "github.com/go-distributed/meritop"
+
+// The ring topology connects tasks in a circle: task i has (i-1)%n as its
+// prev and (i+1)%n as its next. This fits ring-allreduce style aggregation,
+// where each task receives a chunk from prev and passes its result to next.
+// The ring stays the same between epochs.
+type RingTopology struct {
+	numOfTasks uint64
+	taskID     uint64
+}
+
+func (t *RingTopology) SetTaskID(taskID uint64) { t.taskID = taskID }
+
+func (t *RingTopology) SetNumberOfTasks(nt uint64) { t.numOfTasks = nt }
+
+func (t *RingTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkPrev, meritop.LinkNext}
+}
+
+func (t *RingTopology) GetReverseLinkType(linkType string) string {
+	switch linkType {
+	case meritop.LinkPrev:
+		return meritop.LinkNext
+	case meritop.LinkNext:
+		return meritop.LinkPrev
+	}
+	return ""
+}
+
+func (t *RingTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	// A single task has no one to talk to.
+	if t.numOfTasks < 2 {
+		return nil
+	}
+	switch linkType {
+	case meritop.LinkPrev:
+		return []uint64{(t.taskID + t.numOfTasks - 1) % t.numOfTasks}
+	case meritop.LinkNext:
+		return []uint64{(t.taskID + 1) % t.numOfTasks}
+	}
+	return nil
+}
+
+// Creates a new ring topology with given number of tasks.
+func NewRingTopology(nTasks uint64) *RingTopology {
+	return &RingTopology{numOfTasks: nTasks}
+}
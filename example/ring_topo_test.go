@@ -0,0 +1,43 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+)
+
+func TestRingTopology(t *testing.T) {
+	tests := []struct {
+		numOfTasks uint64
+		id         uint64
+		prev, next []uint64
+	}{
+		{1, 0, nil, nil},
+		{2, 0, []uint64{1}, []uint64{1}},
+		{2, 1, []uint64{0}, []uint64{0}},
+		{5, 0, []uint64{4}, []uint64{1}},
+		{5, 2, []uint64{1}, []uint64{3}},
+		{5, 4, []uint64{3}, []uint64{0}},
+	}
+	for i, tt := range tests {
+		ring := NewRingTopology(tt.numOfTasks)
+		ring.SetTaskID(tt.id)
+		if g := ring.GetNeighbors(meritop.LinkPrev, 0); !reflect.DeepEqual(g, tt.prev) {
+			t.Errorf("#%d: prev want = %v, get = %v", i, tt.prev, g)
+		}
+		if g := ring.GetNeighbors(meritop.LinkNext, 0); !reflect.DeepEqual(g, tt.next) {
+			t.Errorf("#%d: next want = %v, get = %v", i, tt.next, g)
+		}
+	}
+}
+
+func TestRingReverseLinkType(t *testing.T) {
+	ring := NewRingTopology(3)
+	for _, linkType := range ring.GetLinkTypes() {
+		reverse := ring.GetReverseLinkType(linkType)
+		if ring.GetReverseLinkType(reverse) != linkType {
+			t.Errorf("reverse of reverse of %s = %s", linkType, ring.GetReverseLinkType(reverse))
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package example
 
+import "github.com/go-distributed/meritop"
+
 //The tree structure is basically assume that all the task forms a tree.
 //Also the tree structure stays the same between epochs.
 type TreeTopology struct {
@@ -35,6 +37,30 @@ func (t *TreeTopology) GetChildren(epoch uint64) []uint64 { return t.children }
 
 func (t *TreeTopology) SetNumberOfTasks(nt uint64) { t.numOfTasks = nt }
 
+func (t *TreeTopology) GetLinkTypes() []string {
+	return []string{meritop.LinkParent, meritop.LinkChild}
+}
+
+func (t *TreeTopology) GetReverseLinkType(linkType string) string {
+	switch linkType {
+	case meritop.LinkParent:
+		return meritop.LinkChild
+	case meritop.LinkChild:
+		return meritop.LinkParent
+	}
+	return ""
+}
+
+func (t *TreeTopology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	switch linkType {
+	case meritop.LinkParent:
+		return t.parents
+	case meritop.LinkChild:
+		return t.children
+	}
+	return nil
+}
+
 // Creates a new tree topology with given fanout and number of tasks.
 // This will be called during the task graph configuration.
 func NewTreeTopology(fanout, nTasks uint64) *TreeTopology {
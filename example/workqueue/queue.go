@@ -0,0 +1,155 @@
+package workqueue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reqNext = "next"
+	reqDone = "done"
+)
+
+// The requests of workers are "next", which a worker sends when it holds no
+// item, and "done/{index}/{result}". Both are answered with the next item as
+// "{index}/{item}", or nothing if there's none to hand out yet.
+func doneReq(index int, result string) string {
+	return reqDone + "/" + strconv.Itoa(index) + "/" + result
+}
+
+func itemResp(index int, item string) []byte {
+	return []byte(strconv.Itoa(index) + "/" + item)
+}
+
+func parseItem(resp []byte) (int, string, error) {
+	s := string(resp)
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return 0, "", fmt.Errorf("bad item %q", s)
+	}
+	index, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, "", fmt.Errorf("bad item %q: %v", s, err)
+	}
+	return index, s[i+1:], nil
+}
+
+// Results of items are recorded as "item/{index}".
+func resultKey(index int) string { return "item/" + strconv.Itoa(index) }
+
+func parseResultKey(key string) (int, error) {
+	if !strings.HasPrefix(key, "item/") {
+		return 0, fmt.Errorf("bad result key %q", key)
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(key, "item/"))
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("bad result key %q", key)
+	}
+	return index, nil
+}
+
+type lease struct {
+	index int
+	at    time.Time
+}
+
+// queue is the state of the master: items waiting to be handed out, items
+// leased to workers, and results. It isn't safe for concurrent use.
+type queue struct {
+	items        []string
+	leaseTimeout time.Duration
+
+	waiting []int
+	leases  map[uint64]lease
+	results []string
+	done    []bool
+	numDone int
+	// onComplete, if set, is called with the first result of each item.
+	onComplete func(index int, result string)
+}
+
+func newQueue(items []string, leaseTimeout time.Duration) *queue {
+	q := &queue{
+		items:        items,
+		leaseTimeout: leaseTimeout,
+		leases:       make(map[uint64]lease),
+		results:      make([]string, len(items)),
+		done:         make([]bool, len(items)),
+	}
+	for i := range items {
+		q.waiting = append(q.waiting, i)
+	}
+	return q
+}
+
+// handle handles a request of worker at time now, and returns the item handed
+// out to the worker, if any.
+func (q *queue) handle(worker uint64, req string, now time.Time) ([]byte, error) {
+	if req != reqNext {
+		parts := strings.SplitN(req, "/", 3)
+		if len(parts) != 3 || parts[0] != reqDone {
+			return nil, fmt.Errorf("bad request %q", req)
+		}
+		index, err := strconv.Atoi(parts[1])
+		if err != nil || index < 0 || index >= len(q.items) {
+			return nil, fmt.Errorf("bad request %q", req)
+		}
+		q.complete(worker, index, parts[2])
+	}
+	// A worker asking for an item doesn't work on any other, so an item it
+	// still holds is lost, e.g. as the worker has restarted on a standby node,
+	// or has taken the answer to an earlier request.
+	if l, ok := q.leases[worker]; ok {
+		delete(q.leases, worker)
+		q.waiting = append(q.waiting, l.index)
+	}
+	return q.handOut(worker, now), nil
+}
+
+// complete records the result of an item. An item handed out twice keeps the
+// first result.
+func (q *queue) complete(worker uint64, index int, result string) {
+	if l, ok := q.leases[worker]; ok && l.index == index {
+		delete(q.leases, worker)
+	}
+	if q.done[index] {
+		return
+	}
+	q.done[index] = true
+	q.results[index] = result
+	q.numDone++
+	if q.onComplete != nil {
+		q.onComplete(index, result)
+	}
+}
+
+// handOut leases the next waiting item to worker. Once none is waiting, it
+// takes over an item leased for longer than the lease timeout, as its worker
+// may have failed for good.
+func (q *queue) handOut(worker uint64, now time.Time) []byte {
+	for len(q.waiting) > 0 {
+		index := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		if q.done[index] {
+			continue
+		}
+		q.leases[worker] = lease{index: index, at: now}
+		return itemResp(index, q.items[index])
+	}
+	if q.leaseTimeout <= 0 {
+		return nil
+	}
+	for owner, l := range q.leases {
+		if owner == worker || now.Sub(l.at) < q.leaseTimeout {
+			continue
+		}
+		delete(q.leases, owner)
+		q.leases[worker] = lease{index: l.index, at: now}
+		return itemResp(l.index, q.items[l.index])
+	}
+	return nil
+}
+
+func (q *queue) finished() bool { return q.numDone == len(q.items) }
@@ -0,0 +1,92 @@
+package workqueue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	q := newQueue([]string{"a", "b", "c"}, 0)
+	steps := []struct {
+		worker uint64
+		req    string
+		want   string
+	}{
+		{1, "next", "0/a"},
+		{2, "next", "1/b"},
+		// worker 1 has restarted: item 0 goes back to the queue
+		{1, "next", "2/c"},
+		{2, "done/1/B", "0/a"},
+		{1, "done/2/C", ""},
+		// a late result of item 2 is dropped
+		{1, "done/2/late", ""},
+		{2, "done/0/A", ""},
+	}
+	for i, s := range steps {
+		item, err := q.handle(s.worker, s.req, now)
+		if err != nil || string(item) != s.want {
+			t.Fatalf("#%d: handle(%d, %q) = (%q, %v), want (%q, nil)", i, s.worker, s.req, item, err, s.want)
+		}
+	}
+	if !q.finished() || !reflect.DeepEqual(q.results, []string{"A", "B", "C"}) {
+		t.Errorf("finished = %v, results = %v", q.finished(), q.results)
+	}
+	for _, req := range []string{"", "done", "done/3/x", "done/x/x", "undo/0/x"} {
+		if _, err := q.handle(1, req, now); err == nil {
+			t.Errorf("handle(%q) should fail", req)
+		}
+	}
+}
+
+func TestQueueLeaseTimeout(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	q := newQueue([]string{"a"}, time.Minute)
+	if item, _ := q.handle(1, "next", now); string(item) != "0/a" {
+		t.Fatalf("first item = %q, want 0/a", item)
+	}
+	if item, _ := q.handle(2, "next", now.Add(30*time.Second)); item != nil {
+		t.Errorf("item leased for 30s handed out again: %q", item)
+	}
+	if item, _ := q.handle(2, "next", now.Add(2*time.Minute)); string(item) != "0/a" {
+		t.Errorf("item leased for 2m isn't handed out again, got %q", item)
+	}
+	// Both workers process the item; the first result is kept.
+	q.handle(1, "done/0/A1", now.Add(3*time.Minute))
+	q.handle(2, "done/0/A2", now.Add(3*time.Minute))
+	if !q.finished() || q.results[0] != "A1" {
+		t.Errorf("finished = %v, results = %v", q.finished(), q.results)
+	}
+}
+
+func TestQueueKeepResults(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	q := newQueue([]string{"a", "b", "c"}, 0)
+	// item 1 was processed before the job was retried
+	index, err := parseResultKey(resultKey(1))
+	if err != nil || index != 1 {
+		t.Fatalf("parseResultKey(%q) = (%d, %v), want 1", resultKey(1), index, err)
+	}
+	q.complete(0, index, "B")
+	recorded := make(map[string]string)
+	q.onComplete = func(index int, result string) { recorded[resultKey(index)] = result }
+
+	if item, _ := q.handle(1, "next", now); string(item) != "0/a" {
+		t.Fatalf("first item = %q, want 0/a", item)
+	}
+	if item, _ := q.handle(1, "done/0/A", now); string(item) != "2/c" {
+		t.Fatalf("second item = %q, want 2/c", item)
+	}
+	if item, _ := q.handle(1, "done/2/C", now); item != nil || !q.finished() {
+		t.Fatalf("queue isn't finished: %q", item)
+	}
+	if want := map[string]string{"item/0": "A", "item/2": "C"}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("recorded = %v, want %v", recorded, want)
+	}
+	for _, key := range []string{"item", "item/x", "item/-1", "other/1"} {
+		if _, err := parseResultKey(key); err == nil {
+			t.Errorf("parseResultKey(%q) should fail", key)
+		}
+	}
+}
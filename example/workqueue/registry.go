@@ -0,0 +1,11 @@
+package workqueue
+
+import "github.com/go-distributed/meritop"
+
+// The topology is registered for worker binaries, e.g. "-topology workqueue"
+// with the task builder of a sweep registered by its own package.
+func init() {
+	meritop.RegisterTopology("workqueue", func(numOfTasks uint64, params meritop.Params) (meritop.Topology, error) {
+		return NewTopology(numOfTasks), nil
+	})
+}
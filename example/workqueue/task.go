@@ -0,0 +1,232 @@
+/*
+Package workqueue runs embarrassingly parallel jobs, e.g. hyperparameter
+sweeps, on a master and a pool of stateless workers.
+
+Task 0 is the master, which holds the items of the job. The other tasks are
+workers: an idle worker pulls the next item from the master with a data
+request, processes it, and sends the result back with the request for the
+following item. The master hands out items in order, and each item to one
+worker at a time.
+
+An item is re-queued if the worker holding it fails: a standby node taking
+over the task of the worker asks for a new item, which tells the master that
+the item held is lost. Without standby nodes, items leased for longer than
+LeaseTimeout are handed out again to idle workers. The state of the master
+isn't recovered if it fails.
+
+With KeepResults, the master records the result of every item in etcd, so
+that a job which failed before processing all items can be retried (see
+controller.Retry) to process only those left.
+
+The topology is NewTopology, registered as "workqueue".
+*/
+package workqueue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// NewTopology links the master, task 0, to every worker, with the workers as
+// its LinkWorker neighbors and the master as theirs LinkServer neighbor.
+func NewTopology(numOfTasks uint64) *example.ParameterServerTopology {
+	return example.NewParameterServerTopology(1, numOfTasks-1)
+}
+
+// TaskBuilder builds the master and workers of a job processing Items.
+type TaskBuilder struct {
+	Items []string
+	// Process is run by workers on the items. It may be run more than once
+	// on an item, e.g. if a worker fails after processing it.
+	Process func(item string) string
+	// Done is called by the master with the results of the items in order,
+	// before it shuts the job down.
+	Done func(results []string)
+
+	// LeaseTimeout is how long an item is held by a worker before it is
+	// handed out again to an idle one. Zero waits for the worker forever.
+	LeaseTimeout time.Duration
+	// RetryInterval is how long an idle worker waits to ask again if there is
+	// no item to hand out, or to resend a request left unanswered, e.g. while
+	// the master is failing over. One second by default.
+	RetryInterval time.Duration
+	// KeepResults records the result of every item as the result
+	// "item/{index}" of the job, and skips items with a result recorded
+	// already, e.g. by the run of the job before it was retried.
+	KeepResults bool
+}
+
+func (b *TaskBuilder) GetTask(taskID uint64) meritop.Task {
+	if taskID == 0 {
+		return &master{builder: b}
+	}
+	return &worker{builder: b}
+}
+
+func (b *TaskBuilder) retryInterval() time.Duration {
+	if b.RetryInterval > 0 {
+		return b.RetryInterval
+	}
+	return time.Second
+}
+
+type master struct {
+	builder   *TaskBuilder
+	framework meritop.Framework
+	logger    logging.Logger
+
+	mu       sync.Mutex
+	queue    *queue
+	shutdown bool
+}
+
+func (m *master) Init(taskID uint64, framework meritop.Framework) {
+	m.framework = framework
+	m.logger = framework.GetLogger()
+	m.queue = newQueue(m.builder.Items, m.builder.LeaseTimeout)
+	if !m.builder.KeepResults {
+		return
+	}
+	for key, result := range framework.GetResults() {
+		index, err := parseResultKey(key)
+		if err != nil || index >= len(m.builder.Items) {
+			m.logger.Errorf("master ignores result %s: not of an item", key)
+			continue
+		}
+		m.queue.complete(0, index, result)
+	}
+	m.queue.onComplete = func(index int, result string) {
+		m.framework.RecordResult(resultKey(index), result)
+	}
+}
+
+func (m *master) Exit() {}
+
+func (m *master) SetEpoch(epoch uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finishIfDone()
+}
+
+func (m *master) MetaReady(fromID uint64, linkType, meta string) {}
+
+func (m *master) DataReady(fromID uint64, linkType, req string, resp []byte) {}
+
+func (m *master) Serve(fromID uint64, linkType, req string) []byte {
+	if linkType != meritop.LinkWorker {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, err := m.queue.handle(fromID, req, time.Now())
+	if err != nil {
+		m.logger.Errorf("master got %v from worker %d", err, fromID)
+		return nil
+	}
+	m.finishIfDone()
+	return item
+}
+
+// finishIfDone shuts the job down once all items are done.
+func (m *master) finishIfDone() {
+	if m.shutdown || !m.queue.finished() {
+		return
+	}
+	m.shutdown = true
+	if m.builder.Done != nil {
+		m.builder.Done(m.queue.results)
+	}
+	m.framework.ShutdownJob()
+}
+
+type worker struct {
+	builder   *TaskBuilder
+	framework meritop.Framework
+	taskID    uint64
+	logger    logging.Logger
+
+	mu sync.Mutex
+	// request waiting for an answer, if any
+	req string
+	// bumped on every request, so that retries of answered ones stop
+	gen    int
+	exited bool
+}
+
+func (w *worker) Init(taskID uint64, framework meritop.Framework) {
+	w.taskID = taskID
+	w.framework = framework
+	w.logger = framework.GetLogger()
+}
+
+func (w *worker) Exit() {
+	w.mu.Lock()
+	w.exited = true
+	w.mu.Unlock()
+}
+
+func (w *worker) SetEpoch(epoch uint64) { w.request(reqNext) }
+
+func (w *worker) MetaReady(fromID uint64, linkType, meta string) {}
+
+func (w *worker) Serve(fromID uint64, linkType, req string) []byte { return nil }
+
+func (w *worker) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	if linkType != meritop.LinkServer {
+		return
+	}
+	w.mu.Lock()
+	if req != w.req {
+		// answer to a resent request answered already
+		w.mu.Unlock()
+		return
+	}
+	w.req = ""
+	w.gen++
+	w.mu.Unlock()
+
+	if len(resp) == 0 {
+		time.AfterFunc(w.builder.retryInterval(), func() { w.request(reqNext) })
+		return
+	}
+	index, item, err := parseItem(resp)
+	if err != nil {
+		w.logger.Errorf("worker %d got %v", w.taskID, err)
+		w.request(reqNext)
+		return
+	}
+	w.request(doneReq(index, w.builder.Process(item)))
+}
+
+// request sends a request to the master, and resends it until it is
+// answered, as data requests are dropped if the master fails. Unlike other
+// tasks, workers send requests out of callbacks, which DataRequest allows, so
+// a request may carry an epoch that is just over; the master drops it then.
+func (w *worker) request(req string) {
+	w.mu.Lock()
+	if w.exited {
+		w.mu.Unlock()
+		return
+	}
+	w.req = req
+	w.gen++
+	gen := w.gen
+	w.mu.Unlock()
+	w.send(req, gen)
+}
+
+func (w *worker) send(req string, gen int) {
+	w.framework.DataRequest(0, req)
+	time.AfterFunc(w.builder.retryInterval(), func() {
+		w.mu.Lock()
+		resend := !w.exited && w.gen == gen
+		w.mu.Unlock()
+		if resend {
+			w.send(req, gen)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package workqueue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// failingBuilder stops the node of the first worker handed out the item to
+// fail, before it processes it.
+type failingBuilder struct {
+	*TaskBuilder
+	item   string
+	once   sync.Once
+	failed chan uint64
+}
+
+func (b *failingBuilder) GetTask(taskID uint64) meritop.Task {
+	t := b.TaskBuilder.GetTask(taskID)
+	if taskID == 0 {
+		return t
+	}
+	return &failingWorker{Task: t, builder: b}
+}
+
+type failingWorker struct {
+	meritop.Task
+	builder   *failingBuilder
+	framework meritop.Framework
+	taskID    uint64
+}
+
+func (w *failingWorker) Init(taskID uint64, fw meritop.Framework) {
+	w.taskID = taskID
+	w.framework = fw
+	w.Task.Init(taskID, fw)
+}
+
+func (w *failingWorker) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	failed := false
+	if strings.HasSuffix(string(resp), "/"+w.builder.item) {
+		w.builder.once.Do(func() { failed = true })
+	}
+	if failed {
+		framework.StopNode(w.framework)
+		w.builder.failed <- w.taskID
+		return
+	}
+	w.Task.DataReady(fromID, linkType, req, resp)
+}
+
+// TestWorkQueue runs a job of 20 items on 3 workers, one of which fails
+// while holding an item. A standby node takes over its task, and the item is
+// processed once re-queued.
+func TestWorkQueue(t *testing.T) {
+	job := "TestWorkQueue"
+	numOfTasks := uint64(4)
+	client := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, client, numOfTasks)
+	if err := ctl.Start(); err != nil {
+		t.Fatalf("controller Start failed: %v", err)
+	}
+	// The layout is kept: nodes still heartbeating when the test returns would
+	// fail on losing their claims.
+	defer ctl.StopSupervising()
+
+	var items, want []string
+	for i := 0; i < 20; i++ {
+		items = append(items, fmt.Sprintf("item-%d", i))
+		want = append(want, fmt.Sprintf("ITEM-%d", i))
+	}
+	resultsC := make(chan []string, 1)
+	builder := &failingBuilder{
+		TaskBuilder: &TaskBuilder{
+			Items:         items,
+			Process:       strings.ToUpper,
+			Done:          func(results []string) { resultsC <- results },
+			RetryInterval: 50 * time.Millisecond,
+		},
+		item:   "item-7",
+		failed: make(chan uint64, 1),
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+	// one node per task and a standby node
+	for i := uint64(0); i < numOfTasks+1; i++ {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bootstrap := framework.NewBootStrap(job, nil, ln, logger, framework.WithCoordinator(client))
+		bootstrap.SetTaskBuilder(builder)
+		bootstrap.SetTopology(NewTopology(numOfTasks))
+		go bootstrap.Start()
+	}
+
+	select {
+	case results := <-resultsC:
+		if !reflect.DeepEqual(results, want) {
+			t.Errorf("results = %v, want %v", results, want)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("job didn't finish")
+	}
+	select {
+	case <-builder.failed:
+	default:
+		t.Errorf("no worker failed")
+	}
+}
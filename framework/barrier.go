@@ -0,0 +1,56 @@
+package framework
+
+import (
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// EnterBarrier marks that the task has entered the named barrier of current
+// epoch. Once all tasks of the epoch have entered it, a task implementing
+// meritop.BarrierWaiter is notified. Like DataRequest, it is meant to be
+// called synchronously in the callbacks of the task.
+func (f *framework) EnterBarrier(name string) {
+	f.events <- &barrierEvent{name: name, epoch: f.epoch}
+}
+
+func (f *framework) handleBarrier(b *barrierEvent) {
+	if b.ready {
+		if w, ok := adapted(f.task).(meritop.BarrierWaiter); ok {
+			f.spawn(func() { w.BarrierReady(b.name) })
+		}
+		return
+	}
+	stop := make(chan bool, 1)
+	f.metaStops = append(f.metaStops, stop)
+	f.barriers = append(f.barriers, b.name)
+	go f.waitBarrier(b, f.numOfTasks, stop)
+}
+
+func (f *framework) waitBarrier(b *barrierEvent, numOfTasks uint64, stop chan bool) {
+	if err := etcdutil.EnterBarrier(f.etcdClient, f.name, b.epoch, b.name, f.taskID); err != nil {
+		f.log.Fatalf("task %d failed to enter barrier %s: %v", f.taskID, b.name, err)
+	}
+	ok, err := etcdutil.WaitBarrier(f.etcdClient, f.name, b.epoch, b.name, numOfTasks, stop)
+	if err != nil {
+		f.log.Fatalf("task %d failed to wait barrier %s: %v", f.taskID, b.name, err)
+	}
+	if ok {
+		f.events <- &barrierEvent{name: b.name, epoch: b.epoch, ready: true}
+	}
+}
+
+// leaveBarriers cleans up barriers of current epoch once it is over.
+func (f *framework) leaveBarriers() {
+	if len(f.barriers) == 0 {
+		return
+	}
+	go func(epoch uint64, names []string) {
+		for _, name := range names {
+			if err := etcdutil.LeaveBarrier(f.etcdClient, f.name, epoch, name, f.taskID); err != nil {
+				f.metrics.etcdErrors.Inc()
+				f.log.Errorf("task %d failed to leave barrier %s: %v", f.taskID, name, err)
+			}
+		}
+	}(f.epoch, f.barriers)
+	f.barriers = nil
+}
@@ -1,34 +1,38 @@
 package framework
 
 import (
+	"errors"
 	"log"
 	"net"
-	"os"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/go-distributed/meritop"
-	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/collective"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
-)
-
-type taskRole int
-
-const (
-	roleNone taskRole = iota
-	roleParent
-	roleChild
+	"github.com/go-distributed/meritop/pkg/logging"
+	"github.com/go-distributed/meritop/pkg/membudget"
+	"github.com/go-distributed/meritop/pkg/sandbox"
+	"github.com/go-distributed/meritop/pkg/topoutil"
 )
 
 // One need to pass in at least these two for framework to start.
-func NewBootStrap(jobName string, etcdURLs []string, ln net.Listener, logger *log.Logger) meritop.Bootstrap {
-	return &framework{
-		name:     jobName,
-		etcdURLs: etcdURLs,
-		ln:       ln,
-		log:      logger,
+func NewBootStrap(jobName string, etcdURLs []string, ln net.Listener, logger *log.Logger, opts ...Option) meritop.Bootstrap {
+	f := &framework{
+		name:               jobName,
+		etcdURLs:           etcdURLs,
+		ln:                 ln,
+		checkpointInterval: 1,
+		retry:              etcdutil.DefaultRetryPolicy,
 	}
+	if logger != nil {
+		f.log = logging.NewStd(logger, logging.Info)
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 func (f *framework) SetTaskBuilder(taskBuilder meritop.TaskBuilder) { f.taskBuilder = taskBuilder }
@@ -39,119 +43,251 @@ func (f *framework) Start() {
 	var err error
 
 	if f.log == nil {
-		f.log = log.New(os.Stdout, "", log.Lshortfile|log.Ltime|log.Ldate)
+		f.log = logging.Default()
+	}
+	f.log = f.log.With("job", f.name)
+
+	if f.etcdClient == nil {
+		if f.etcdClient, err = etcdutil.NewCoordinator(f.etcdAPI, f.etcdURLs); err != nil {
+			f.log.Fatalf("%v", err)
+		}
+	}
+	if f.checkpointStore == nil {
+		f.checkpointStore = checkpoint.NewEtcdStore(f.etcdClient, f.name)
+	}
+	if f.selfOrganizeTasks > 0 {
+		if err = f.selfOrganize(); err != nil {
+			f.log.Fatalf("selfOrganize failed: %v", err)
+		}
 	}
 
-	f.etcdClient = etcd.NewClient(f.etcdURLs)
+	if err = f.setupTransport(); err != nil {
+		f.log.Fatalf("setupTransport failed: %v", err)
+	}
+	if f.etcdDataToken {
+		err = f.retry.Do(func() (err error) {
+			f.dataToken, err = etcdutil.GetDataToken(f.etcdClient, f.name)
+			return err
+		})
+		if err != nil {
+			f.log.Fatalf("GetDataToken failed: %v", err)
+		}
+	}
+	if f.dataToken != "" {
+		f.httpClient = f.httpClient.WithToken(f.dataToken)
+	}
+	if err = f.preflight(); err != nil {
+		f.log.Fatalf("%v", err)
+	}
+	err = f.retry.Do(func() (err error) {
+		f.codec, err = etcdutil.GetCodec(f.etcdClient, f.name)
+		return err
+	})
+	if err != nil {
+		f.log.Fatalf("GetCodec failed: %v", err)
+	}
 
-	if err = f.occupyTask(); err != nil {
+	err = f.occupyTask()
+	if err == errJobFinished {
+		f.log.Infof("standby node found that job has finished\n")
+		return
+	}
+	if err != nil {
 		f.log.Fatalf("occupyTask() failed: %v", err)
 	}
+	f.log = f.log.With("task", f.taskID)
 
-	f.epochChan = make(chan uint64, 1) // grab epoch from etcd
-	f.epochStop = make(chan bool, 1)   // stop etcd watch
+	f.epochChan = make(chan *etcdutil.EpochChange, 1) // grab epoch from etcd
+	f.epochStop = make(chan bool, 1)                  // stop etcd watch
 	// meta will have epoch prepended so we must get epoch before any watch on meta
-	f.epoch, err = etcdutil.GetAndWatchEpoch(f.etcdClient, f.name, f.epochChan, f.epochStop)
+	var ec *etcdutil.EpochChange
+	err = f.retry.Do(func() (err error) {
+		ec, err = etcdutil.GetAndWatchEpoch(f.etcdClient, f.codec, f.name, f.epochChan, f.epochStop)
+		return err
+	})
 	if err != nil {
 		f.log.Fatalf("WatchEpoch failed: %v", err)
 	}
+	f.setEpoch(ec.Epoch)
 	if f.epoch == exitEpoch {
-		f.log.Printf("task %d found that job has finished\n", f.taskID)
+		f.log.Infof("task %d found that job has finished\n", f.taskID)
 		f.epochStop <- true
 		return
 	}
-	f.log.Printf("task %d starting at epoch %d\n", f.taskID, f.epoch)
+	if f.backup && f.epoch != f.backupEpoch {
+		f.log.Infof("task %d is past epoch %d, its backup is too late", f.taskID, f.backupEpoch)
+		f.epochStop <- true
+		return
+	}
+	f.log.Infof("task %d starting at epoch %d\n", f.taskID, f.epoch)
+
+	f.seedTopologies()
 
 	// task builder and topology are defined by applications.
 	// Both should be initialized at this point.
 	// Get the task implementation and topology for this node (indentified by taskID)
+	if f.sandbox != nil {
+		f.taskBuilder = sandbox.NewTaskBuilder(*f.sandbox)
+	}
 	f.task = f.taskBuilder.GetTask(f.taskID)
-	f.topology.SetTaskID(f.taskID)
-
+	// A node taking over mid-job starts with the task of current epoch, into
+	// which the checkpoint is restored.
+	if t := f.epochTask(); t != nil {
+		f.task = t
+	}
+	f.metrics = newNodeMetrics(f.name, f.taskID)
+	f.metrics.epoch.Set(int64(f.epoch))
+	if f.memory == nil {
+		// Buffers are accounted, without limit.
+		f.memory = membudget.New(0)
+	}
+	f.memory.Register(f.metrics.registry)
+	if fc, ok := f.etcdClient.(*etcdutil.FailoverCoordinator); ok {
+		fc.Register(f.metrics.registry)
+	}
+	inPhase := f.enterPhase()
+	// The job might have been scaled since the topology was configured.
+	joined, removed := f.applyNumOfTasks(ec.Index)
+	if removed {
+		f.log.Fatalf("task %d has been removed from the job", f.taskID)
+	}
+	f.state = stateJoining
+	if joined && inPhase {
+		f.state = stateRunning
+	}
+	if f.servePool != nil {
+		f.servePool.start()
+	}
 	go f.startHTTP()
 
-	f.heartbeat()
+	if f.backup {
+		f.skipHeartbeat()
+	} else {
+		f.heartbeat()
+	}
 	f.setupChannels()
+	f.collectives = collective.NewCollectives(f)
+	f.watchJobConfig()
 	f.task.Init(f.taskID, f)
+	if f.backup {
+		f.restoreBackup()
+	} else {
+		f.restoreCheckpoint()
+	}
 	f.run()
 	f.releaseResource()
 }
 
 func (f *framework) setupChannels() {
 	f.httpStop = make(chan struct{})
-	f.metaChan = make(chan *metaChange, 100)
-	f.dataReqtoSendChan = make(chan *dataRequest, 100)
-	f.dataReqChan = make(chan *dataRequest, 100)
-	f.dataRespToSendChan = make(chan *dataResponse, 100)
-	f.dataRespChan = make(chan *frameworkhttp.DataResponse, 100)
+	f.events = make(chan event, 100)
 }
 
-func (f *framework) run() {
-	f.log.Printf("framework of task %d starts to run", f.taskID)
-	defer f.log.Printf("framework of task %d stops running.", f.taskID)
-	f.setEpochStarted()
-	for {
-		select {
-		case nextEpoch, ok := <-f.epochChan:
-			f.releaseEpochResource()
-			if !ok { // single task exit
-				nextEpoch = exitEpoch
-				return
-			}
-			f.epoch = nextEpoch
-			if f.epoch == exitEpoch {
-				return
-			}
-			// start the next epoch's work
-			f.setEpochStarted()
-		case meta := <-f.metaChan:
-			if meta.epoch != f.epoch {
-				break
-			}
-			go f.handleMetaChange(meta.who, meta.from, meta.meta)
-		case req := <-f.dataReqtoSendChan:
-			if req.epoch != f.epoch {
-				f.log.Printf("epoch mismatch: task %d, req-to-send epoch: %d, current epoch: %d",
-					f.taskID, req.epoch, f.epoch)
-				break
-			}
-			go f.sendRequest(req)
-		case req := <-f.dataReqChan:
-			if req.epoch != f.epoch {
-				f.log.Printf("epoch mismatch: task %d, request epoch: %d, current epoch: %d",
-					f.taskID, req.epoch, f.epoch)
-				req.notifyEpochMismatch()
-				break
-			}
-			go f.handleDataReq(req)
-		case resp := <-f.dataRespToSendChan:
-			if resp.epoch != f.epoch {
-				f.log.Printf("epoch mismatch: task %d, resp-to-send epoch: %d, current epoch: %d",
-					f.taskID, resp.epoch, f.epoch)
-				resp.notifyEpochMismatch()
-				break
-			}
-			go f.sendResponse(resp)
-		case resp := <-f.dataRespChan:
-			if resp.Epoch != f.epoch {
-				f.log.Printf("epoch mismatch: task %d, response epoch: %d, current epoch: %d",
-					f.taskID, resp.Epoch, f.epoch)
-				break
-			}
-			go f.handleDataResp(resp)
+// handleEpochChange moves the task to the new epoch, or stops it. A nil epoch
+// change stops the node running the task while the job goes on.
+func (f *framework) handleEpochChange(ec *etcdutil.EpochChange) {
+	f.releaseEpochResource()
+	if ec == nil { // single task exit
+		f.state = stateExited
+		return
+	}
+	if f.backup {
+		// A backup copy runs one epoch only.
+		if f.state == stateRunning {
+			f.writeResults()
 		}
+		f.state = stateExited
+		return
+	}
+	// The epoch is over. Its results go before the snapshot of the next one.
+	if f.state == stateRunning {
+		f.writeResults()
+		f.recordTiming()
+	}
+	f.metrics.epochTransitions.Inc()
+	f.setEpoch(ec.Epoch)
+	if f.epoch == exitEpoch {
+		f.state = stateExited
+		return
+	}
+	if !f.enterPhase() {
+		f.state = stateJoining
+		return
 	}
+	joined, removed := f.applyNumOfTasks(ec.Index)
+	if removed {
+		f.log.Infof("task %d is removed from the job", f.taskID)
+		f.state = stateExited
+		return
+	}
+	if !joined {
+		f.state = stateJoining
+		return
+	}
+	if f.drainRequested() {
+		f.drain()
+		f.state = stateExited
+		return
+	}
+	f.state = stateRunning
+	f.saveCheckpoint()
+	f.switchTask()
+	// start the next epoch's work
+	f.setEpochStarted()
 }
 
 func (f *framework) setEpochStarted() {
+	f.epochCancel = make(chan struct{})
+	f.running.open(f.epoch)
+	f.progress.report(time.Now())
+	f.startTiming()
+	if f.probeLinks && f.epoch == 0 {
+		f.warmUp()
+	}
+	f.metrics.epoch.Set(int64(f.epoch))
+	f.notifyPhase()
 	f.task.SetEpoch(f.epoch)
 
 	// setup etcd watches
-	// - create self's parent and child meta flag
+	// For each type of link, watch the meta that neighbors flag to the
+	// reverse side of the link. E.g.
 	// - watch parents' child meta flag
 	// - watch children's parent meta flag
-	f.watchAll(roleParent, f.topology.GetParents(f.epoch))
-	f.watchAll(roleChild, f.topology.GetChildren(f.epoch))
+	for _, linkType := range f.topology.GetLinkTypes() {
+		f.watchAll(linkType, f.topology.GetNeighbors(linkType, f.epoch))
+	}
+	f.watchBroadcast()
+	f.watchPeers()
+	f.watchShards()
+	f.watchStragglers()
+}
+
+// applyNumOfTasks rebuilds the topology with the number of tasks of the epoch
+// started at given etcd index. Scaling takes effect at the same epoch on all
+// tasks (see etcdutil.TaskCount). joined is false if this task has been added
+// but doesn't take part in this epoch yet; removed is true if it has been
+// removed by scaling down.
+func (f *framework) applyNumOfTasks(epochIndex uint64) (joined, removed bool) {
+	var nt *etcdutil.TaskCount
+	err := f.retry.Do(func() (err error) {
+		nt, err = etcdutil.GetTaskCount(f.etcdClient, f.name)
+		return err
+	})
+	if err != nil {
+		f.log.Fatalf("GetTaskCount failed: %v", err)
+	}
+	f.numOfTasks = nt.At(epochIndex)
+	if f.taskID >= f.numOfTasks {
+		return false, f.taskID >= nt.N
+	}
+	f.topology.SetNumberOfTasks(f.numOfTasks)
+	f.topology.SetTaskID(f.taskID)
+	// Topologies may change with epochs, so they are checked at every one.
+	if err := topoutil.CheckAncestors(f.topology, f.taskID, f.epoch); err != nil {
+		f.log.Fatalf("%v", err)
+	}
+	f.metrics.numOfTasks.Set(int64(f.numOfTasks))
+	return true, false
 }
 
 func (f *framework) releaseEpochResource() {
@@ -159,34 +295,97 @@ func (f *framework) releaseEpochResource() {
 		c <- true
 	}
 	f.metaStops = nil
+	f.gather = nil
+	f.shards = shardState{}
+	f.dropMetas()
+	f.leaveBarriers()
+	f.running.close()
+	// The task takes the pushes of the epoch before it moves on.
+	f.pushes.Wait()
+	f.failDeferred()
+	if f.collectives != nil {
+		f.collectives.SetEpoch(f.epoch)
+	}
+	if f.epochCancel != nil {
+		close(f.epochCancel)
+		f.epochCancel = nil
+	}
 }
 
 // release resources: heartbeat, epoch watch.
 func (f *framework) releaseResource() {
-	f.log.Printf("framework of task %d is releasing resources...\n", f.taskID)
+	f.log.Infof("framework of task %d is releasing resources...\n", f.taskID)
 	f.epochStop <- true
-	close(f.heartbeatStop)
+	f.subscriptions.stop()
+	f.stopHeartbeat()
 	f.stopHTTP()
+	if f.supervisor != nil {
+		f.supervisor.StopSupervising()
+	}
+	if f.servePool != nil {
+		f.servePool.stop()
+	}
 }
 
+// errJobFinished is returned by occupyTask to standby nodes outliving the job.
+var errJobFinished = errors.New("job has finished")
+
 // occupyTask will grab the first unassigned task and register itself on etcd.
+// Standby nodes wait for as long as the job runs.
 func (f *framework) occupyTask() error {
+	if f.backup {
+		return f.takeBackup()
+	}
+	wait := etcdutil.WaitFreeTaskFor
+	if f.standby {
+		wait = etcdutil.WaitFailedTaskFor
+		stop := make(chan struct{})
+		defer close(stop)
+		go f.standBy(stop)
+	}
+	if f.resources != nil {
+		addr := f.ln.Addr().String()
+		if err := etcdutil.AdvertiseCapabilities(f.etcdClient, f.name, addr, f.resources); err != nil {
+			f.log.Warnf("node failed to advertise its resources %v: %v", f.resources, err)
+		}
+		defer etcdutil.WithdrawCapabilities(f.etcdClient, f.name, addr)
+	}
 	for {
-		freeTask, err := etcdutil.WaitFreeTask(f.etcdClient, f.name, f.log)
+		freeTask, err := wait(f.etcdClient, f.name, f.log, f.resources)
+		if err == etcdutil.ErrWaitFreeTaskTimeout {
+			var ec *etcdutil.EpochChange
+			if ec, err = etcdutil.GetEpochChange(f.etcdClient, f.codec, f.name); err == nil {
+				if ec.Epoch == exitEpoch {
+					return errJobFinished
+				}
+				continue
+			}
+		}
 		if err != nil {
+			// The layout of a finished job might be gone already.
+			if etcdutil.IsKeyNotFound(err) {
+				return errJobFinished
+			}
 			return err
 		}
-		f.log.Printf("standby got failure at task %d", freeTask)
-		ok := etcdutil.TryOccupyTask(f.etcdClient, f.name, freeTask, f.ln.Addr().String())
-		if ok {
+		f.log.Infof("standby got failure at task %d", freeTask)
+		claim, err := etcdutil.ClaimTaskTTL(f.etcdClient, f.name, freeTask, f.ln.Addr().String(), f.ttls.AddressSeconds())
+		if err == nil {
 			f.taskID = freeTask
+			f.claim = claim
 			return nil
 		}
-		f.log.Printf("standby tried task %d failed. Wait free task again.", freeTask)
+		f.log.Infof("standby tried task %d failed: %v. Wait free task again.", freeTask, err)
 	}
 }
 
-func (f *framework) watchAll(who taskRole, taskIDs []uint64) {
+func (f *framework) watchAll(linkType string, taskIDs []uint64) {
+	// E.g. watch parent's child-meta.
+	f.watchMeta(linkType, f.topology.GetReverseLinkType(linkType), taskIDs)
+}
+
+// watchMeta watches the meta of given type flagged by the given neighbors.
+func (f *framework) watchMeta(linkType, metaType string, taskIDs []uint64) {
 	stops := make([]chan bool, len(taskIDs))
 
 	for i, taskID := range taskIDs {
@@ -194,23 +393,17 @@ func (f *framework) watchAll(who taskRole, taskIDs []uint64) {
 		stop := make(chan bool, 1)
 		stops[i] = stop
 
-		var watchPath string
-		switch who {
-		case roleParent:
-			// Watch parent's child-meta.
-			watchPath = etcdutil.ChildMetaPath(f.name, taskID)
-		case roleChild:
-			// Watch child's parent-meta.
-			watchPath = etcdutil.ParentMetaPath(f.name, taskID)
-		default:
-			f.log.Panic("unexpected")
-		}
+		watchPath := etcdutil.MetaPath(f.name, taskID, metaType)
 
 		// When a node working for a task crashed, a new node will take over
 		// the task and continue what's left. It assumes that progress is stalled
 		// until the new node comes (no middle stages being dismissed by newcomer).
 
-		resp, err := f.etcdClient.Get(watchPath, false, false)
+		var resp *etcd.Response
+		err := f.retry.Do(func() (err error) {
+			resp, err = f.etcdClient.Get(watchPath, false, false)
+			return err
+		})
 		var watchIndex uint64
 		if err != nil {
 			if !etcdutil.IsKeyNotFound(err) {
@@ -228,30 +421,35 @@ func (f *framework) watchAll(who taskRole, taskIDs []uint64) {
 				if resp.Action != "set" && resp.Action != "get" {
 					continue
 				}
-				// epoch is prepended to meta. When a new one starts and replaces
+				// epoch is flagged with meta. When a new one starts and replaces
 				// the old one, it doesn't need to handle previous things, whose
 				// epoch is smaller than current one.
-				values := strings.SplitN(resp.Node.Value, "-", 2)
-				ep, err := strconv.ParseUint(values[0], 10, 64)
+				ep, meta, err := f.codec.DecodeMeta(resp.Node.Value)
 				if err != nil {
-					f.log.Panicf("WARN: not a unit64 prepended to meta: %s", values[0])
+					f.log.Errorf("task %d ignores meta of task %d: %v", f.taskID, taskID, err)
+					continue
 				}
-				f.metaChan <- &metaChange{
-					from:  taskID,
-					who:   who,
-					epoch: ep,
-					meta:  values[1],
+				f.events <- &metaChange{
+					from:     taskID,
+					linkType: linkType,
+					metaType: metaType,
+					epoch:    ep,
+					meta:     meta,
+					at:       time.Now(),
 				}
 			}
 		}(receiver, taskID)
 	}
 	f.metaStops = append(f.metaStops, stops...)
 }
-func (f *framework) handleMetaChange(who taskRole, taskID uint64, meta string) {
-	switch who {
-	case roleParent:
-		f.task.ParentMetaReady(taskID, meta)
-	case roleChild:
-		f.task.ChildMetaReady(taskID, meta)
+func (f *framework) handleMetaChange(m *metaChange) {
+	if !f.running.admits(m.epoch) {
+		f.dropStale("meta", m.from, m.epoch)
+		return
+	}
+	if m.metaType == metaBroadcast {
+		f.handleBroadcast(m.from, m.meta, m.epoch)
+		return
 	}
+	f.task.MetaReady(m.from, m.linkType, m.meta)
 }
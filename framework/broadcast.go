@@ -0,0 +1,169 @@
+package framework
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Meta types of broadcast and gather, i.e. the keys
+// /{app}/tasks/{taskID}/broadcastMeta and gatherMeta. A broadcast flows from
+// parents to children, and the gathered meta from children to parents.
+const (
+	metaBroadcast = meritop.MetaBroadcast
+	metaGather    = "gather"
+)
+
+// FlagMetaBroadcast flags meta to all descendants of the task in a tree
+// topology, i.e. one with LinkParent and LinkChild. Each task forwards it to
+// its children, and then gets MetaReady with linkType meritop.MetaBroadcast.
+// It is meant to be called by the root, once per epoch.
+func (f *framework) FlagMetaBroadcast(meta string) {
+	f.FlagMeta(metaBroadcast, meta)
+}
+
+// GatherMeta acknowledges the broadcast of current epoch with meta. The meta
+// of a task and its subtree is sent up to the parent once all children have
+// gathered theirs, and the root implementing meritop.MetaGatherer gets the
+// meta of all tasks. Like DataRequest, it is meant to be called synchronously
+// in the callbacks of the task.
+func (f *framework) GatherMeta(meta string) {
+	f.events <- &metaChange{
+		from:     f.taskID,
+		metaType: metaGather,
+		epoch:    f.epoch,
+		meta:     meta,
+		at:       time.Now(),
+	}
+}
+
+func isTree(t meritop.Topology) bool {
+	var parent, child bool
+	for _, linkType := range t.GetLinkTypes() {
+		parent = parent || linkType == meritop.LinkParent
+		child = child || linkType == meritop.LinkChild
+	}
+	return parent && child
+}
+
+// watchBroadcast watches the broadcast of parents and the meta gathered by
+// children in current epoch.
+func (f *framework) watchBroadcast() {
+	if !isTree(f.topology) {
+		return
+	}
+	f.gather = newGatherRound(f.topology.GetNeighbors(meritop.LinkChild, f.epoch))
+	f.watchMeta(meritop.LinkParent, metaBroadcast, f.topology.GetNeighbors(meritop.LinkParent, f.epoch))
+	f.watchMeta(meritop.LinkChild, metaGather, f.topology.GetNeighbors(meritop.LinkChild, f.epoch))
+}
+
+// handleBroadcast forwards the broadcast to the children before letting the
+// task know, so that the broadcast goes on even if the task is slow.
+func (f *framework) handleBroadcast(fromID uint64, meta string, epoch uint64) {
+	if len(f.topology.GetNeighbors(meritop.LinkChild, epoch)) > 0 {
+		f.flagMeta(metaBroadcast, meta, epoch)
+	}
+	f.task.MetaReady(fromID, metaBroadcast, meta)
+}
+
+// handleGather runs in the event loop with the meta gathered by the task
+// itself or by one of its children.
+func (f *framework) handleGather(m *metaChange) {
+	if f.gather == nil {
+		f.log.Warnf("task %d gathers meta, but the topology isn't a tree", f.taskID)
+		return
+	}
+	metas := map[string]string{strconv.FormatUint(m.from, 10): m.meta}
+	if m.from != f.taskID {
+		metas = nil
+		if err := json.Unmarshal([]byte(m.meta), &metas); err != nil {
+			f.log.Errorf("task %d got bad meta gathered by task %d: %v", f.taskID, m.from, err)
+			return
+		}
+	}
+	if !f.gather.add(m.from, m.from == f.taskID, metas) {
+		return
+	}
+	if len(f.topology.GetNeighbors(meritop.LinkParent, f.epoch)) > 0 {
+		value, _ := json.Marshal(f.gather.metas)
+		go f.flagMeta(metaGather, string(value), f.epoch)
+		return
+	}
+	g, ok := adapted(f.task).(meritop.MetaGatherer)
+	if !ok {
+		return
+	}
+	all := make(map[uint64]string, len(f.gather.metas))
+	for id, meta := range f.gather.metas {
+		taskID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			f.log.Errorf("task %d got meta gathered by bad task ID %q", f.taskID, id)
+			return
+		}
+		all[taskID] = meta
+	}
+	f.spawn(func() { g.MetaGathered(all) })
+}
+
+func (f *framework) flagMeta(metaType, meta string, epoch uint64) {
+	if !f.commitOutput(epoch) {
+		return
+	}
+	key := etcdutil.MetaPath(f.name, f.taskID, metaType)
+	value := f.codec.EncodeMeta(epoch, meta)
+	if err := f.setMeta(key, value); err != nil {
+		f.keepDeadLetter(etcdutil.DeadLetter{LinkType: metaType, Epoch: epoch, Kind: "meta", Payload: meta}, err)
+		f.log.Fatalf("etcdClient.Set failed; key: %s, value: %s, error: %v", key, value, err)
+	}
+	f.timeOutput()
+}
+
+// gatherRound collects the meta gathered by a task and its children in one
+// epoch. Metas are keyed by formatted task IDs for JSON.
+type gatherRound struct {
+	children map[uint64]bool
+	self     bool
+	metas    map[string]string
+	done     bool
+}
+
+func newGatherRound(children []uint64) *gatherRound {
+	g := &gatherRound{children: make(map[uint64]bool), metas: make(map[string]string)}
+	for _, id := range children {
+		g.children[id] = false
+	}
+	return g
+}
+
+// add returns true once the task and all its children have gathered. It
+// doesn't fire again for meta repeated after that, e.g. by a child which was
+// failed over.
+func (g *gatherRound) add(from uint64, self bool, metas map[string]string) bool {
+	if g.done {
+		return false
+	}
+	if self {
+		g.self = true
+	} else {
+		if _, ok := g.children[from]; !ok {
+			return false
+		}
+		g.children[from] = true
+	}
+	for id, meta := range metas {
+		g.metas[id] = meta
+	}
+	if !g.self {
+		return false
+	}
+	for _, ok := range g.children {
+		if !ok {
+			return false
+		}
+	}
+	g.done = true
+	return true
+}
@@ -0,0 +1,34 @@
+package framework
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGatherRound(t *testing.T) {
+	g := newGatherRound([]uint64{1, 2})
+	if g.add(1, false, map[string]string{"1": "a", "3": "c"}) {
+		t.Fatal("gathered before the task itself")
+	}
+	if g.add(0, true, map[string]string{"0": "r"}) {
+		t.Fatal("gathered before child 2")
+	}
+	if g.add(4, false, map[string]string{"4": "x"}) {
+		t.Fatal("gathered from a task which isn't a child")
+	}
+	if !g.add(2, false, map[string]string{"2": "b"}) {
+		t.Fatal("not gathered after all children")
+	}
+	wanted := map[string]string{"0": "r", "1": "a", "2": "b", "3": "c"}
+	if !reflect.DeepEqual(g.metas, wanted) {
+		t.Errorf("metas = %v, want %v", g.metas, wanted)
+	}
+	if g.add(2, false, map[string]string{"2": "b"}) {
+		t.Error("gathered twice")
+	}
+
+	leaf := newGatherRound(nil)
+	if !leaf.add(5, true, map[string]string{"5": "l"}) {
+		t.Error("leaf not gathered by itself")
+	}
+}
@@ -0,0 +1,53 @@
+package framework
+
+import (
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+)
+
+// restoreCheckpoint brings back the latest snapshot of the task if it has one.
+// It should be called after task Init and before the first SetEpoch.
+func (f *framework) restoreCheckpoint() {
+	c, ok := adapted(f.task).(meritop.Checkpointer)
+	if !ok {
+		return
+	}
+	epoch, data, err := f.checkpointStore.Latest(f.taskID)
+	if err != nil {
+		if err != checkpoint.ErrNotFound {
+			f.metrics.checkpointErrors.Inc()
+			f.log.Errorf("task %d failed to load checkpoint: %v", f.taskID, err)
+		}
+		return
+	}
+	f.log.Infof("task %d restoring checkpoint of epoch %d", f.taskID, epoch)
+	c.Restore(data)
+}
+
+// saveCheckpoint persists a snapshot of the task keyed by current epoch.
+// Failing to save is not fatal; we will just recompute more after failure.
+func (f *framework) saveCheckpoint() {
+	c, ok := adapted(f.task).(meritop.Checkpointer)
+	if !ok {
+		return
+	}
+	if f.checkpointInterval == 0 || f.epoch%f.checkpointInterval != 0 {
+		return
+	}
+	f.saveSnapshot(c)
+}
+
+// checkpoint saves a snapshot of the task regardless of the interval, e.g.
+// before it is handed over.
+func (f *framework) checkpoint() {
+	if c, ok := adapted(f.task).(meritop.Checkpointer); ok {
+		f.saveSnapshot(c)
+	}
+}
+
+func (f *framework) saveSnapshot(c meritop.Checkpointer) {
+	if err := f.checkpointStore.Save(f.taskID, f.epoch, c.Snapshot()); err != nil {
+		f.metrics.checkpointErrors.Inc()
+		f.log.Errorf("task %d failed to save checkpoint at epoch %d: %v", f.taskID, f.epoch, err)
+	}
+}
@@ -0,0 +1,105 @@
+package framework
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// TestCheckpointRestore kills the node of a Checkpointer task at epoch 3 and
+// checks that the node taking over restores the snapshot saved when epoch 3
+// started, before SetEpoch is called on it.
+func TestCheckpointRestore(t *testing.T) {
+	job := "TestCheckpointRestore"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	etcdURLs := []string{m.URL()}
+
+	// controller is needed to report the failure.
+	ctl := controller.New(job, etcd.NewClient(etcdURLs), 1)
+	ctl.Start()
+	defer ctl.Stop()
+
+	builder := &checkpointTaskBuilder{events: make(chan string, 100), failEpoch: 3}
+	start := func() {
+		f := NewBootStrap(job, etcdURLs, createListener(t), nil)
+		f.SetTaskBuilder(builder)
+		f.SetTopology(example.NewTreeTopology(1, 1))
+		go f.Start()
+	}
+
+	start()
+	for epoch := 0; epoch <= 3; epoch++ {
+		if e, want := <-builder.events, fmt.Sprintf("SetEpoch %d", epoch); e != want {
+			t.Fatalf("first node: event want = %q, get = %q", want, e)
+		}
+	}
+
+	start()
+	for _, want := range []string{"Restore 2", "SetEpoch 3"} {
+		if e := <-builder.events; e != want {
+			t.Errorf("second node: event want = %q, get = %q", want, e)
+		}
+	}
+}
+
+type checkpointTaskBuilder struct {
+	mu        sync.Mutex
+	nodes     int
+	events    chan string
+	failEpoch uint64
+}
+
+func (b *checkpointTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nodes++
+	return &checkpointTask{events: b.events, fail: b.nodes == 1, failEpoch: b.failEpoch}
+}
+
+// checkpointTask goes through epochs on its own. Its state is the last epoch
+// it has finished.
+type checkpointTask struct {
+	framework meritop.Framework
+	events    chan string
+	fail      bool
+	failEpoch uint64
+	finished  uint64
+}
+
+func (t *checkpointTask) Init(taskID uint64, framework meritop.Framework) {
+	t.framework = framework
+}
+func (t *checkpointTask) Exit() {}
+
+func (t *checkpointTask) SetEpoch(epoch uint64) {
+	t.events <- fmt.Sprintf("SetEpoch %d", epoch)
+	switch {
+	case epoch == t.failEpoch && t.fail:
+		t.framework.(*framework).stop()
+	case epoch == t.failEpoch:
+		t.framework.ShutdownJob()
+	default:
+		t.finished = epoch
+		t.framework.IncEpoch()
+	}
+}
+
+func (t *checkpointTask) Snapshot() []byte {
+	return []byte(strconv.FormatUint(t.finished, 10))
+}
+
+func (t *checkpointTask) Restore(data []byte) {
+	t.events <- fmt.Sprintf("Restore %s", data)
+}
+
+func (t *checkpointTask) MetaReady(fromID uint64, linkType, meta string)             {}
+func (t *checkpointTask) Serve(fromID uint64, linkType, req string) []byte           { return nil }
+func (t *checkpointTask) DataReady(fromID uint64, linkType, req string, resp []byte) {}
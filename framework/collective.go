@@ -0,0 +1,42 @@
+package framework
+
+import (
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/collective"
+)
+
+// Like DataRequest, the collectives assume the epoch doesn't change while the
+// task starts them. Their data requests go along the links of the topology.
+
+func (f *framework) AllReduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error) {
+	l, err := collective.TopologyLinks(f.taskID, f.topology, f.epoch)
+	if err != nil {
+		return nil, err
+	}
+	return f.collectives.AllReduce(l, data, collective.ReduceFunc(reduce))
+}
+
+func (f *framework) Reduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error) {
+	l, err := collective.TopologyLinks(f.taskID, f.topology, f.epoch)
+	if err != nil {
+		return nil, err
+	}
+	return f.collectives.Reduce(l, data, collective.ReduceFunc(reduce))
+}
+
+func (f *framework) Broadcast(data []byte) ([]byte, error) {
+	l, err := collective.TopologyLinks(f.taskID, f.topology, f.epoch)
+	if err != nil {
+		return nil, err
+	}
+	return f.collectives.Broadcast(l, data)
+}
+
+// serveCollective serves the data requests of collectives, which don't reach
+// the task. It returns false for the other requests.
+func (f *framework) serveCollective(fromID uint64, req string) ([]byte, bool) {
+	if f.collectives == nil {
+		return nil, false
+	}
+	return f.collectives.Serve(fromID, req)
+}
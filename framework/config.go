@@ -0,0 +1,64 @@
+package framework
+
+import (
+	"sync"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// jobConfig is the config of the job, read by the task out of the event loop.
+type jobConfig struct {
+	mu     sync.Mutex
+	config map[string]string
+}
+
+func (c *jobConfig) set(config map[string]string) {
+	c.mu.Lock()
+	c.config = config
+	c.mu.Unlock()
+}
+
+func (c *jobConfig) get() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	config := make(map[string]string, len(c.config))
+	for k, v := range c.config {
+		config[k] = v
+	}
+	return config
+}
+
+// GetJobConfig returns a copy of the config, which the task may keep.
+func (f *framework) GetJobConfig() map[string]string { return f.jobConfig.get() }
+
+// watchJobConfig reads the config of the job, and watches it until the node
+// stops. Changes go through the event loop, so that the task learns of them
+// like of other events.
+func (f *framework) watchJobConfig() {
+	stop := make(chan bool, 1)
+	if !f.subscriptions.add(stop) {
+		return
+	}
+	var config map[string]string
+	err := f.retry.Do(func() (err error) {
+		config, err = etcdutil.WatchJobConfig(f.etcdClient, f.name, stop, func(config map[string]string) {
+			f.events <- &configChange{config: config}
+		})
+		return err
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to watch the job config: %v", f.taskID, err)
+		return
+	}
+	f.jobConfig.set(config)
+}
+
+func (f *framework) handleConfigChange(c *configChange) {
+	f.jobConfig.set(c.config)
+	if o, ok := adapted(f.task).(meritop.ConfigObserver); ok {
+		config := f.jobConfig.get()
+		f.spawn(func() { o.ConfigChanged(config) })
+	}
+}
@@ -0,0 +1,59 @@
+package framework
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+type configTask struct {
+	meritop.Task
+	changes []map[string]string
+}
+
+func (t *configTask) ConfigChanged(config map[string]string) {
+	t.changes = append(t.changes, config)
+}
+
+func TestJobConfig(t *testing.T) {
+	job := "TestJobConfig"
+	client := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, client, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	if err := ctl.SetJobConfig(map[string]string{"lr": "0.1"}); err != nil {
+		t.Fatalf("SetJobConfig failed: %v", err)
+	}
+	task := &configTask{}
+	f := newTestFramework(t, WithCoordinator(client))
+	f.state = stateJoining
+	f.task = task
+	f.watchJobConfig()
+	defer f.subscriptions.stop()
+	if got, want := f.GetJobConfig(), map[string]string{"lr": "0.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %v, want %v", got, want)
+	}
+
+	want := map[string]string{"lr": "0.01"}
+	if err := ctl.SetJobConfig(want); err != nil {
+		t.Fatalf("SetJobConfig failed: %v", err)
+	}
+	select {
+	case ev := <-f.events:
+		f.step(ev)
+	case <-time.After(time.Second):
+		t.Fatal("no config change")
+	}
+	if got := f.GetJobConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %v, want %v", got, want)
+	}
+	if len(task.changes) != 1 || !reflect.DeepEqual(task.changes[0], want) {
+		t.Errorf("config changes = %v, want [%v]", task.changes, want)
+	}
+}
@@ -1,71 +1,210 @@
 package framework
 
 import (
+	"crypto/tls"
 	"net/http"
+	"time"
 
+	"github.com/go-distributed/meritop"
 	"github.com/go-distributed/meritop/framework/frameworkhttp"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
 	"github.com/go-distributed/meritop/pkg/topoutil"
 )
 
-func (f *framework) sendRequest(dr *dataRequest) {
-	addr, err := etcdutil.GetAddress(f.etcdClient, f.name, dr.taskID)
+// sendRequest sends a data request of the task, until cancel is closed.
+func (f *framework) sendRequest(dr *requestToSend, cancel <-chan struct{}) {
+	f.metrics.dataRequestsSent.Inc()
+	f.metrics.pendingDataRequests.Add(1)
+	defer f.metrics.pendingDataRequests.Add(-1)
+	dead := etcdutil.DeadLetter{To: dr.taskID, Epoch: dr.epoch, Kind: "data", Payload: dr.req}
+	addr, err := f.taskAddress(dr.taskID, dr.epoch)
 	if err != nil {
+		// The task might be failing over. Drop the request as if the old node
+		// didn't respond.
 		// TODO: We should handle network faults later by retrying
-		f.log.Fatalf("getAddress(%d) failed: %v", dr.taskID, err)
+		f.keepDeadLetter(dead, err)
 		return
 	}
-	d, err := frameworkhttp.RequestData(addr, dr.req, f.taskID, dr.taskID, dr.epoch, f.log)
+	start := time.Now()
+	d, err := f.requestData(addr, dr, cancel)
 	if err != nil {
+		if err == frameworkhttp.ErrCanceled {
+			f.log.Infof("data request to task %d of epoch %d is canceled", dr.taskID, dr.epoch)
+			return
+		}
 		if err == frameworkhttp.ErrReqEpochMismatch {
-			f.log.Printf("Epoch mismatch error from server")
+			f.log.Warnf("Epoch mismatch error from server")
+			return
+		}
+		if err == frameworkhttp.ErrServerClosed {
+			// this node is stopping
 			return
 		}
-		f.log.Printf("RequestData failed: %v", err)
+		if failedByTask(dr.req, err) {
+			// The task takes the error, see DataFailed and CallReady.
+			f.events <- &dataFailure{taskID: dr.taskID, epoch: dr.epoch, req: dr.req, err: err}
+			return
+		}
+		f.keepDeadLetter(dead, err)
 		return
 	}
-	f.dataRespChan <- d
+	f.metrics.bytesReceived.Add(uint64(len(d.Data)))
+	if f.verifyData {
+		f.verifyResponse(addr, dr, cancel, d)
+	}
+	if f.shadow != nil {
+		go f.shadowRequest(addr, dr, cancel, d, time.Since(start))
+	}
+	// The data is held until the task takes it, see handleDataResp.
+	if !f.memory.Acquire(int64(len(d.Data)), cancel) {
+		releasePayload(d.Release)
+		f.log.Infof("data request to task %d of epoch %d is canceled waiting for memory", dr.taskID, dr.epoch)
+		return
+	}
+	f.events <- d
 }
 
 func (f *framework) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	d, release, err := f.getTaskData(taskID, epoch, req, nil)
+	return ownData(d, release), err
+}
+
+// getTaskData serves a data request of another task through the event loop.
+// Typed requests come with their handler, see GetTypedTaskData. The data is
+// released with release, if not nil, once it is sent.
+func (f *framework) getTaskData(taskID, epoch uint64, req string, typed *typedRequest) ([]byte, func(), error) {
+	if f.servePool != nil {
+		if !f.servePool.admit() {
+			f.metrics.requestsRejected.Inc()
+			return nil, nil, frameworkhttp.ErrServerBusy
+		}
+		defer f.servePool.done()
+	}
+	f.metrics.servingDataRequests.Add(1)
+	defer f.metrics.servingDataRequests.Add(-1)
 	dataChan := make(chan []byte, 1)
-	f.dataReqChan <- &dataRequest{
+	failed := make(chan error, 1)
+	dr := &dataRequest{
 		taskID:   taskID,
 		epoch:    epoch,
 		req:      req,
+		typed:    typed,
 		dataChan: dataChan,
+		failed:   failed,
 	}
+	f.events <- dr
 
 	select {
 	case d, ok := <-dataChan:
+		// The release of the data, if any, is set before it is sent or
+		// dropped.
 		if !ok {
+			releasePayload(dr.release)
 			// it assumes that only epoch mismatch will close the channel
-			return nil, frameworkhttp.ErrReqEpochMismatch
+			return nil, nil, frameworkhttp.ErrReqEpochMismatch
 		}
-		return d, nil
+		// The data leaves the framework for the HTTP server.
+		f.memory.Release(int64(len(d)))
+		f.metrics.dataRequestsServed.Inc()
+		f.metrics.bytesSent.Add(uint64(len(d)))
+		return d, dr.release, nil
+	case err := <-failed:
+		return nil, nil, err
 	case <-f.httpStop:
 		// If a node stopped running and there is remaining requests, we need to
 		// respond error message back. It is used to let client routines stop blocking --
 		// especially helpful in test cases.
 
-		// This is used to drain the channel queue and get the rest notified.
-		<-f.dataReqChan
+		// This is used to drain the event queue and get the rest notified.
+		select {
+		case <-f.events:
+		default:
+		}
+		return nil, nil, frameworkhttp.ErrServerClosed
+	}
+}
+
+// GetObservableData serves observers. Observers are not part of the topology,
+// so there is no epoch check for them.
+func (f *framework) GetObservableData(req string) ([]byte, error) {
+	if _, ok := adapted(f.task).(meritop.Observable); !ok {
+		return nil, frameworkhttp.ErrNotObservable
+	}
+	dataChan := make(chan []byte, 1)
+	f.events <- &observeRequest{
+		req:      req,
+		dataChan: dataChan,
+	}
+	select {
+	case d := <-dataChan:
+		return d, nil
+	case <-f.httpStop:
 		return nil, frameworkhttp.ErrServerClosed
 	}
 }
 
+func (f *framework) handleObserveReq(or *observeRequest) {
+	or.dataChan <- adapted(f.task).(meritop.Observable).ServeAsObserver(or.req)
+}
+
+// setupTransport secures the listener and the client of the framework with
+// TLS, and makes the client accept compressed data, if configured.
+func (f *framework) setupTransport() error {
+	f.httpClient = frameworkhttp.DefaultClient
+	if f.tlsInfo != nil {
+		serverConfig, err := f.tlsInfo.ServerConfig()
+		if err != nil {
+			return err
+		}
+		clientConfig, err := f.tlsInfo.ClientConfig()
+		if err != nil {
+			return err
+		}
+		f.ln = tls.NewListener(f.ln, serverConfig)
+		f.httpClient = frameworkhttp.NewClient(clientConfig)
+	}
+	if f.dns != nil {
+		f.httpClient = f.httpClient.WithDNS(*f.dns)
+	}
+	if len(f.compression) > 0 {
+		f.httpClient = f.httpClient.WithCompression(f.compression...)
+	}
+	f.httpClient = f.httpClient.WithAccept(f.acceptedContentTypes()...)
+	if f.streams > 1 {
+		f.httpClient = f.httpClient.WithParallelStreams(f.streams)
+	}
+	if f.requestTimeout > 0 {
+		f.httpClient = f.httpClient.WithTimeout(f.requestTimeout)
+	}
+	// Data verified or shadowed is read after the task takes it.
+	if !f.verifyData && f.shadow == nil {
+		f.httpClient = f.httpClient.WithBuffers(f.payloadBuffer)
+	}
+	return nil
+}
+
 // Framework http server for data request.
 // Each request will be in the format: "/datareq?taskID=XXX&req=XXX".
+// It also serves "/status" and "/metrics" for debugging and monitoring.
 // "taskID" indicates the requesting task. "req" is the meta data for this request.
 // On success, it should respond with requested data in http body.
 func (f *framework) startHTTP() {
-	f.log.Printf("task %d serving http on %s\n", f.taskID, f.ln.Addr())
+	f.log.Infof("task %d serving http on %s\n", f.taskID, f.ln.Addr())
 	// TODO: http server graceful shutdown
-	handler := frameworkhttp.NewDataRequestHandler(f.log, f)
-	err := http.Serve(f.ln, handler)
+	mux := http.NewServeMux()
+	mux.Handle(frameworkhttp.DataRequestPrefix, f.authorized(f.compressed(f.parallel(frameworkhttp.NewDataRequestHandler(f.log, f)))))
+	mux.Handle(frameworkhttp.ObserveRequestPrefix, f.authorized(f.compressed(frameworkhttp.NewObserveRequestHandler(f.log, f))))
+	mux.Handle(frameworkhttp.MessagePrefix, f.authorized(frameworkhttp.NewMessageHandler(f.log, f)))
+	mux.Handle(frameworkhttp.StatusPrefix, frameworkhttp.NewStatusHandler(f))
+	mux.Handle(frameworkhttp.MetricsPrefix, f.metrics.registry)
+	mux.Handle(frameworkhttp.ProbePrefix, frameworkhttp.NewProbeHandler())
+	for pattern, h := range f.httpHandlers {
+		mux.Handle(pattern, h)
+	}
+	err := http.Serve(f.ln, mux)
 	select {
 	case <-f.httpStop:
-		f.log.Printf("task %d http stops serving", f.taskID)
+		f.log.Infof("task %d http stops serving", f.taskID)
 	default:
 		if err != nil {
 			f.log.Fatalf("task %d http.Serve() returns error: %v\n", f.taskID, err)
@@ -73,6 +212,31 @@ func (f *framework) startHTTP() {
 	}
 }
 
+// authorized requires the data token with requests to h, if the job has one.
+func (f *framework) authorized(h http.Handler) http.Handler {
+	if f.dataToken == "" {
+		return h
+	}
+	return frameworkhttp.RequireToken(f.dataToken, h)
+}
+
+// compressed compresses the responses of h, if the task has encodings.
+func (f *framework) compressed(h http.Handler) http.Handler {
+	if len(f.compression) == 0 {
+		return h
+	}
+	return frameworkhttp.Compress(h, f.compression...)
+}
+
+// parallel sends large data responses of h as parallel transfers, if the task
+// has parallel streams.
+func (f *framework) parallel(h http.Handler) http.Handler {
+	if f.streams < 2 {
+		return h
+	}
+	return frameworkhttp.Parallel(h, f.streamMinSize)
+}
+
 // Close listener, stop HTTP server;
 // Write error message back to under-serving responses.
 func (f *framework) stopHTTP() {
@@ -85,18 +249,62 @@ func (f *framework) sendResponse(dr *dataResponse) {
 }
 
 func (f *framework) handleDataReq(dr *dataRequest) {
+	linkType, ok := topoutil.GetLinkType(f.topology, dr.epoch, dr.taskID)
+	if !ok {
+		// The requester doesn't agree with us on the topology, e.g. we haven't
+		// joined the epoch yet. Let it retry as with epoch mismatch.
+		f.log.Warnf("task %d: data request from task %d which is not a neighbor at epoch %d",
+			f.taskID, dr.taskID, dr.epoch)
+		dr.notifyEpochMismatch()
+		return
+	}
 	var data []byte
-	switch {
-	case topoutil.IsParent(f.topology, dr.epoch, dr.taskID):
-		data = f.task.ServeAsChild(dr.taskID, dr.req)
-	case topoutil.IsChild(f.topology, dr.epoch, dr.taskID):
-		data = f.task.ServeAsParent(dr.taskID, dr.req)
-	default:
-		f.log.Panic("unexpected")
+	if isCall(dr.req) {
+		var err error
+		if data, err = f.serveCall(dr.taskID, dr.req); err != nil {
+			dr.failed <- err
+			return
+		}
+	} else if dr.typed != nil {
+		var err error
+		if data, err = f.serveTyped(dr.taskID, dr.typed); err != nil {
+			f.log.With("epoch", dr.epoch).Errorf("task %d failed to serve %q of task %d: %v", f.taskID, dr.req, dr.taskID, err)
+			dr.failed <- frameworkhttp.ErrBadRequest
+			return
+		}
+	} else if data, ok = f.serveCollective(dr.taskID, dr.req); !ok {
+		var err error
+		if data, err = f.serveTask(dr, linkType); err != nil {
+			if err != errDeferred {
+				dr.failed <- err
+			}
+			return
+		}
+	}
+	if !f.commitOutput(dr.epoch) {
+		// The requester retries with the copy whose output the epoch takes.
+		releasePayload(dr.release)
+		dr.release = nil
+		dr.failed <- frameworkhttp.ErrServerBusy
+		return
+	}
+	f.timeOutput()
+	f.respond(dr, data)
+}
+
+// respond sends the data served for a request of another task.
+func (f *framework) respond(dr *dataRequest, data []byte) {
+	// The data is held until it is sent. Without room for it, the requester
+	// retries later as with a busy server.
+	if !f.memory.TryAcquire(int64(len(data))) {
+		f.log.With("epoch", dr.epoch).Warnf("task %d: no memory for %d bytes of %q of task %d", f.taskID, len(data), dr.req, dr.taskID)
+		releasePayload(dr.release)
+		dr.failed <- frameworkhttp.ErrServerBusy
+		return
 	}
 	// Getting the data from task could take a long time. We need to let
 	// the response-to-send go through event loop to check epoch.
-	f.dataRespToSendChan <- &dataResponse{
+	f.events <- &dataResponse{
 		taskID:   dr.taskID,
 		epoch:    dr.epoch,
 		req:      dr.req,
@@ -105,13 +313,135 @@ func (f *framework) handleDataReq(dr *dataRequest) {
 	}
 }
 
-func (f *framework) handleDataResp(resp *frameworkhttp.DataResponse) {
+// serveTask serves a data request with the task, which may fail it if it is
+// an ErrorServer, or defer it if it is a DeferredServer.
+func (f *framework) serveTask(dr *dataRequest, linkType string) ([]byte, error) {
+	if ds, ok := adapted(f.task).(meritop.DeferredServer); ok {
+		return f.serveDeferred(ds, dr, linkType)
+	}
+	if ps, ok := adapted(f.task).(meritop.PayloadServer); ok {
+		p, err := ps.ServePayload(dr.taskID, linkType, dr.req)
+		if err != nil {
+			releasePayload(p.Release)
+			return nil, serveError(err)
+		}
+		dr.release = p.Release
+		return p.Data, nil
+	}
+	es, ok := adapted(f.task).(meritop.ErrorServer)
+	if !ok {
+		return f.task.Serve(dr.taskID, linkType, dr.req), nil
+	}
+	data, err := es.ServeWithError(dr.taskID, linkType, dr.req)
+	return data, serveError(err)
+}
+
+// serveError is the error of the task sent to the requester.
+func serveError(err error) error {
 	switch {
-	case topoutil.IsParent(f.topology, resp.Epoch, resp.TaskID):
-		f.task.ParentDataReady(resp.TaskID, resp.Req, resp.Data)
-	case topoutil.IsChild(f.topology, resp.Epoch, resp.TaskID):
-		f.task.ChildDataReady(resp.TaskID, resp.Req, resp.Data)
-	default:
-		f.log.Panic("unexpected")
+	case err == meritop.ErrNotReady:
+		return frameworkhttp.ErrServerBusy
+	case err != nil:
+		return &frameworkhttp.HandlerError{Msg: err.Error()}
+	}
+	return nil
+}
+
+// failedByTask tells whether the other task failed the request, for the task
+// to learn of it rather than it being kept as a dead letter.
+func failedByTask(req string, err error) bool {
+	_, ok := err.(*frameworkhttp.HandlerError)
+	return ok || isCall(req) && err == frameworkhttp.ErrNoHandler
+}
+
+// handleDataFailure gives the error of a data request or of a call to the
+// task.
+func (f *framework) handleDataFailure(df *dataFailure) {
+	if !f.running.admits(df.epoch) {
+		f.dropStale("data", df.taskID, df.epoch)
+		return
+	}
+	if isCall(df.req) {
+		f.callFailed(df)
+		return
+	}
+	linkType, ok := topoutil.GetLinkType(f.topology, df.epoch, df.taskID)
+	if !ok {
+		return
+	}
+	r, ok := adapted(f.task).(meritop.DataErrorReceiver)
+	if !ok {
+		f.log.Warnf("task %d: data request %q to task %d failed: %v", f.taskID, df.req, df.taskID, df.err)
+		return
+	}
+	r.DataFailed(df.taskID, linkType, df.req, df.err)
+}
+
+func (f *framework) handleDataResp(resp *frameworkhttp.DataResponse) {
+	defer f.memory.Release(int64(len(resp.Data)))
+	// A buffer of the task goes with DataReady, and back to it otherwise.
+	release := resp.Release
+	defer func() { releasePayload(release) }()
+	if !f.running.admits(resp.Epoch) {
+		f.dropStale("data", resp.TaskID, resp.Epoch)
+		return
+	}
+	linkType, ok := topoutil.GetLinkType(f.topology, resp.Epoch, resp.TaskID)
+	if !ok {
+		f.log.Warnf("task %d: data response from task %d which is not a neighbor at epoch %d",
+			f.taskID, resp.TaskID, resp.Epoch)
+		return
+	}
+	if f.collectives != nil && f.collectives.DataReady(resp.TaskID, resp.Req, resp.Data) {
+		return
+	}
+	if !f.validate(resp) {
+		return
+	}
+	if isCall(resp.Req) {
+		f.callReady(resp)
+		return
+	}
+	if h, ok := f.handler(requestName(resp.Req)); ok {
+		f.typedDataReady(h, resp)
+		return
+	}
+	release = nil
+	f.task.DataReady(resp.TaskID, linkType, resp.Req, resp.Data)
+}
+
+// dropDataResp drops data the task hasn't taken.
+func (f *framework) dropDataResp(resp *frameworkhttp.DataResponse) {
+	f.memory.Release(int64(len(resp.Data)))
+	releasePayload(resp.Release)
+}
+
+// payloadBuffer asks the task for a buffer to read the data of a plain data
+// request into, see meritop.PayloadReceiver.
+func (f *framework) payloadBuffer(toID uint64, req string, size int) ([]byte, func()) {
+	r, ok := adapted(f.task).(meritop.PayloadReceiver)
+	if !ok || isCall(req) || f.collectives != nil && f.collectives.Handles(req) {
+		return nil, nil
+	}
+	if _, ok := f.handler(requestName(req)); ok {
+		return nil, nil
+	}
+	p := r.PayloadBuffer(toID, req, size)
+	return p.Data, p.Release
+}
+
+func releasePayload(release func()) {
+	if release != nil {
+		release()
+	}
+}
+
+// ownData returns data the framework owns, copied out of the buffer of the
+// task, which it releases, if there is one.
+func ownData(d []byte, release func()) []byte {
+	if release == nil {
+		return d
 	}
+	defer release()
+	return append([]byte(nil), d...)
 }
@@ -0,0 +1,21 @@
+package framework
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// keepDeadLetter keeps meta or data the task couldn't deliver in etcd, where
+// the controller shows it (see controller.Controller.DeadLetters), instead of
+// only logging it.
+func (f *framework) keepDeadLetter(dl etcdutil.DeadLetter, cause error) {
+	dl.From = f.taskID
+	dl.Error = cause.Error()
+	dl.At = time.Now()
+	f.metrics.deadLetters.Inc()
+	f.log.With("epoch", dl.Epoch).Errorf("task %d couldn't deliver %s %q: %v", f.taskID, dl.Kind, dl.Payload, cause)
+	if err := etcdutil.AddDeadLetter(f.etcdClient, f.name, dl, f.ttls.DeadLetterSeconds()); err != nil {
+		f.log.Errorf("task %d failed to keep dead letter: %v", f.taskID, err)
+	}
+}
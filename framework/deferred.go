@@ -0,0 +1,82 @@
+package framework
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-distributed/meritop"
+)
+
+// errDeferred is returned for requests the task responds to later.
+var errDeferred = errors.New("response deferred")
+
+// deferredRequests are the data requests of other tasks which the task
+// responds to later, by request ID.
+type deferredRequests struct {
+	mu      sync.Mutex
+	lastID  uint64
+	pending map[uint64]*dataRequest
+}
+
+func (d *deferredRequests) add(dr *dataRequest) uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending == nil {
+		d.pending = make(map[uint64]*dataRequest)
+	}
+	d.lastID++
+	d.pending[d.lastID] = dr
+	return d.lastID
+}
+
+func (d *deferredRequests) take(id uint64) (*dataRequest, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dr, ok := d.pending[id]
+	delete(d.pending, id)
+	return dr, ok
+}
+
+// drop forgets all requests, and returns them.
+func (d *deferredRequests) drop() []*dataRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var drs []*dataRequest
+	for _, dr := range d.pending {
+		drs = append(drs, dr)
+	}
+	d.pending = nil
+	return drs
+}
+
+// serveDeferred serves a data request with a DeferredServer. The request is
+// pending before the task is called, as it may respond right away.
+func (f *framework) serveDeferred(ds meritop.DeferredServer, dr *dataRequest, linkType string) ([]byte, error) {
+	id := f.deferred.add(dr)
+	data, err := ds.ServeDeferred(id, dr.taskID, linkType, dr.req)
+	if err == meritop.ErrPending {
+		return nil, errDeferred
+	}
+	if _, ok := f.deferred.take(id); !ok {
+		// The task has responded with Respond already.
+		return nil, errDeferred
+	}
+	return data, serveError(err)
+}
+
+func (f *framework) Respond(requestID uint64, data []byte) {
+	dr, ok := f.deferred.take(requestID)
+	if !ok {
+		f.log.Warnf("task %d drops response to request %d: not pending, e.g. of an epoch which is over", f.taskID, requestID)
+		return
+	}
+	f.respond(dr, data)
+}
+
+// failDeferred fails the deferred requests of the epoch which is over, as
+// with epoch mismatch.
+func (f *framework) failDeferred() {
+	for _, dr := range f.deferred.drop() {
+		dr.notifyEpochMismatch()
+	}
+}
@@ -0,0 +1,136 @@
+package framework
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Degraded mode keeps the task going while etcd can be read but can't take
+// writes, e.g. during quorum loss (see WithDegradedMode).
+
+// how often buffered meta is set again
+var metaFlushInterval = time.Second
+
+// metaBuffer holds meta flags waiting for etcd to take writes. Only the
+// latest value of a key is kept, as etcd would.
+type metaBuffer struct {
+	mu       sync.Mutex
+	pending  map[string]string
+	flushing bool
+}
+
+// setMeta sets the meta key, or buffers it if etcd can't take it in degraded
+// mode. Once meta is buffered, later flags are buffered behind it, so that
+// they aren't overwritten by older ones.
+func (f *framework) setMeta(key, value string) error {
+	if f.degradedMode && f.metaBuffered() {
+		f.bufferMeta(key, value)
+		return nil
+	}
+	err := f.retry.Do(func() error {
+		_, err := f.etcdClient.Set(key, value, f.ttls.MetaSeconds())
+		return err
+	})
+	if err != nil && f.degradedMode && etcdutil.IsTransient(err) {
+		f.log.Warnf("task %d buffers meta until etcd takes writes again: %v", f.taskID, err)
+		f.bufferMeta(key, value)
+		return nil
+	}
+	return err
+}
+
+func (f *framework) metaBuffered() bool {
+	f.metaBuf.mu.Lock()
+	defer f.metaBuf.mu.Unlock()
+	return len(f.metaBuf.pending) > 0
+}
+
+func (f *framework) bufferMeta(key, value string) {
+	b := &f.metaBuf
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		b.pending = make(map[string]string)
+	}
+	b.pending[key] = value
+	f.metrics.bufferedMeta.Set(int64(len(b.pending)))
+	if !b.flushing {
+		b.flushing = true
+		go f.flushMeta()
+	}
+}
+
+// flushMeta sets the buffered meta until there is none left, or the node
+// stops.
+func (f *framework) flushMeta() {
+	b := &f.metaBuf
+	for {
+		select {
+		case <-time.After(metaFlushInterval):
+		case <-f.httpStop:
+			return
+		}
+		b.mu.Lock()
+		pending := make(map[string]string, len(b.pending))
+		for key, value := range b.pending {
+			pending[key] = value
+		}
+		b.mu.Unlock()
+
+		for key, value := range pending {
+			if _, err := f.etcdClient.Set(key, value, f.ttls.MetaSeconds()); err != nil {
+				if !etcdutil.IsTransient(err) {
+					f.log.Fatalf("etcdClient.Set failed; key: %s, value: %s, error: %v", key, value, err)
+				}
+				break
+			}
+			b.mu.Lock()
+			// It might have been flagged again meanwhile.
+			if b.pending[key] == value {
+				delete(b.pending, key)
+			}
+			b.mu.Unlock()
+		}
+
+		b.mu.Lock()
+		f.metrics.bufferedMeta.Set(int64(len(b.pending)))
+		if len(b.pending) == 0 {
+			b.flushing = false
+			b.mu.Unlock()
+			f.log.Infof("task %d has flushed buffered meta", f.taskID)
+			return
+		}
+		b.mu.Unlock()
+	}
+}
+
+// addrCache keeps the last known addresses of tasks.
+type addrCache struct {
+	mu    sync.Mutex
+	addrs map[uint64]string
+}
+
+// getAddress gets the address of the task from etcd. In degraded mode, it
+// falls back to the last known address if etcd can't be reached.
+func (f *framework) getAddress(taskID uint64) (string, error) {
+	addr, err := etcdutil.GetAddress(f.etcdClient, f.name, taskID)
+	if !f.degradedMode {
+		return addr, err
+	}
+	c := &f.addrs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		if c.addrs == nil {
+			c.addrs = make(map[uint64]string)
+		}
+		c.addrs[taskID] = addr
+		return addr, nil
+	}
+	if last, ok := c.addrs[taskID]; ok && etcdutil.IsTransient(err) {
+		return last, nil
+	}
+	return "", err
+}
@@ -0,0 +1,69 @@
+package framework
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// readOnlyCoordinator fails writes as etcd does without a leader.
+type readOnlyCoordinator struct {
+	etcdutil.Coordinator
+	mu       sync.Mutex
+	readOnly bool
+}
+
+func (c *readOnlyCoordinator) setReadOnly(readOnly bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readOnly = readOnly
+}
+
+func (c *readOnlyCoordinator) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	c.mu.Lock()
+	readOnly := c.readOnly
+	c.mu.Unlock()
+	if readOnly {
+		return nil, &etcd.EtcdError{ErrorCode: 300, Message: "Raft Internal Error"}
+	}
+	return c.Coordinator.Set(key, value, ttl)
+}
+
+func TestDegradedModeBuffersMeta(t *testing.T) {
+	defer func(d time.Duration) { metaFlushInterval = d }(metaFlushInterval)
+	metaFlushInterval = 10 * time.Millisecond
+
+	job := "TestDegradedModeBuffersMeta"
+	coord := &readOnlyCoordinator{Coordinator: etcdutil.NewMemoryCoordinator(), readOnly: true}
+	f := newTestFramework(t, WithCoordinator(coord))
+	f.degradedMode = true
+	defer close(f.httpStop)
+
+	f.flagMeta("parent", "old", 1)
+	f.flagMeta("parent", "new", 2)
+	key := etcdutil.MetaPath(job, 0, "parent")
+	if _, err := coord.Get(key, false, false); !etcdutil.IsKeyNotFound(err) {
+		t.Fatalf("meta set while etcd is read-only: %v", err)
+	}
+	if n := f.metrics.bufferedMeta.Value(); n != 1 {
+		t.Errorf("buffered meta = %d, want 1", n)
+	}
+
+	coord.setReadOnly(false)
+	for i := 0; f.metaBuffered(); i++ {
+		if i == 100 {
+			t.Fatalf("buffered meta isn't flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err := coord.Get(key, false, false)
+	if err != nil {
+		t.Fatalf("Get meta failed: %v", err)
+	}
+	if want := f.codec.EncodeMeta(2, "new"); resp.Node.Value != want {
+		t.Errorf("meta = %q, want %q", resp.Node.Value, want)
+	}
+}
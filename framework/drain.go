@@ -0,0 +1,38 @@
+package framework
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Drain asks the node running given task to hand the task over to a standby
+// node, e.g. for maintenance of its machine. It returns once the request is
+// made. The node hands the task over at the start of the next epoch: it saves
+// a checkpoint of the task, if the task is a meritop.Checkpointer, frees the
+// task without it being reported as failed, and stops. The standby node
+// restores the checkpoint and runs the epoch.
+func Drain(jobName string, etcdURLs []string, taskID uint64) error {
+	return etcdutil.RequestDrain(etcd.NewClient(etcdURLs), jobName, taskID)
+}
+
+func (f *framework) drainRequested() bool {
+	ok, err := etcdutil.DrainRequested(f.etcdClient, f.name, f.taskID)
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to check drain request: %v", f.taskID, err)
+		return false
+	}
+	return ok
+}
+
+// drain hands the task over at the start of current epoch.
+func (f *framework) drain() {
+	f.log.Infof("task %d is draining at epoch %d", f.taskID, f.epoch)
+	f.checkpoint()
+	// The claim mustn't be renewed after it is released.
+	f.stopHeartbeat()
+	if err := etcdutil.HandOver(f.etcdClient, f.name, f.claim); err != nil {
+		// The claim expires and the task is failed over.
+		f.log.Errorf("task %d failed to hand over: %v", f.taskID, err)
+	}
+}
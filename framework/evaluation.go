@@ -0,0 +1,103 @@
+package framework
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Evaluation is better done out of the topology: a task in the topology holds
+// up every epoch until it is done, while an observer consumes snapshots of
+// Checkpointer tasks at its own pace and the job never waits for it.
+
+// Snapshot is a checkpoint of a task taken at the start of an epoch.
+type Snapshot struct {
+	TaskID uint64
+	Epoch  uint64
+	Data   []byte
+}
+
+// SetCheckpointStore sets where the observer reads snapshots. It must be the
+// same as the job's (see WithCheckpointStore); the default is etcd.
+func (o *Observer) SetCheckpointStore(s checkpoint.Store) { o.checkpointStore = s }
+
+func (o *Observer) store() checkpoint.Store {
+	if o.checkpointStore == nil {
+		o.checkpointStore = checkpoint.NewEtcdStore(o.etcdClient, o.name)
+	}
+	return o.checkpointStore
+}
+
+// LatestSnapshot returns the latest snapshot of given task. It returns
+// checkpoint.ErrNotFound if the task hasn't been checkpointed yet.
+func (o *Observer) LatestSnapshot(taskID uint64) (*Snapshot, error) {
+	epoch, data, err := o.store().Latest(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{TaskID: taskID, Epoch: epoch, Data: data}, nil
+}
+
+// FollowSnapshots sends snapshots of given task as the job goes on, starting
+// with the latest one. A receiver slower than the job only gets the newest
+// snapshot when it comes back; those in between are skipped. The channel is
+// closed after Stop.
+func (o *Observer) FollowSnapshots(taskID uint64) (<-chan *Snapshot, error) {
+	resp, err := o.etcdClient.Get(etcdutil.EpochPath(o.name), false, false)
+	if err != nil {
+		return nil, err
+	}
+	store := o.store()
+	snapshots := make(chan *Snapshot)
+	receiver := make(chan *etcd.Response, 1)
+	stop := make(chan bool, 1)
+	done := make(chan struct{})
+	o.stops = append(o.stops, stop)
+	o.dones = append(o.dones, done)
+	go o.etcdClient.Watch(etcdutil.EpochPath(o.name), resp.EtcdIndex+1, false, receiver, stop)
+
+	go func() {
+		defer close(snapshots)
+		defer drain(receiver)
+		var pending *Snapshot
+		var sent uint64
+		hasSent := false
+		// Snapshots are saved when epochs start, so check again on every epoch.
+		check := func() {
+			epoch, data, err := store.Latest(taskID)
+			if err != nil {
+				if err != checkpoint.ErrNotFound {
+					o.log.Errorf("observer: failed to get snapshot of task %d: %v", taskID, err)
+				}
+				return
+			}
+			if hasSent && epoch <= sent || pending != nil && epoch <= pending.Epoch {
+				return
+			}
+			pending = &Snapshot{TaskID: taskID, Epoch: epoch, Data: data}
+		}
+		check()
+		for {
+			// only try to send if there is something new
+			var out chan *Snapshot
+			if pending != nil {
+				out = snapshots
+			}
+			select {
+			case out <- pending:
+				sent, hasSent = pending.Epoch, true
+				pending = nil
+			case resp, ok := <-receiver:
+				if !ok {
+					return
+				}
+				if resp.Action == "compareAndSwap" || resp.Action == "set" {
+					check()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return snapshots, nil
+}
@@ -0,0 +1,292 @@
+package framework
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// nodeState is the state of the node running the task. The event loop is a
+// state machine: step handles one event at a time, and is the only place the
+// state changes.
+//
+//	joining --epoch joined--> running --epoch--> running
+//	running --epoch not joined--> joining
+//	any --exit, removal, drain or stop--> exited
+type nodeState int
+
+const (
+	// The task has been added to the job, but doesn't take part in current
+	// epoch yet.
+	stateJoining nodeState = iota
+	// The task takes part in current epoch.
+	stateRunning
+	// The node has stopped running the task. No event is handled any more.
+	stateExited
+)
+
+func (s nodeState) String() string {
+	switch s {
+	case stateJoining:
+		return "joining"
+	case stateRunning:
+		return "running"
+	case stateExited:
+		return "exited"
+	}
+	return "unknown"
+}
+
+func (f *framework) run() {
+	f.log.Infof("framework of task %d starts to run", f.taskID)
+	defer f.log.Infof("framework of task %d stops running.", f.taskID)
+	if f.state == stateRunning {
+		f.setEpochStarted()
+	} else {
+		f.log.Infof("task %d is added to the job, waiting for it to take effect", f.taskID)
+	}
+	for f.state != stateExited {
+		f.step(f.nextEvent())
+	}
+}
+
+// nextEvent waits for the next event. Epoch changes go before anything else
+// queued, which is likely of the epoch that is over. The epoch channel being
+// closed gives a nil epoch change.
+func (f *framework) nextEvent() event {
+	select {
+	case ec := <-f.epochChan:
+		return ec
+	default:
+	}
+	select {
+	case ec := <-f.epochChan:
+		return ec
+	case ev := <-f.events:
+		return ev
+	case <-f.debounceC:
+		return debounceEnd{}
+	}
+}
+
+// step handles one event in current state. Only epoch changes, observe
+// requests, messages, topic events and config changes are handled before the
+// task joins the epoch. Other events are
+// dropped unless the task is running the epoch they are of; requests among
+// them are told of epoch mismatch, so that they are retried.
+func (f *framework) step(ev event) {
+	if f.state == stateExited {
+		f.reject(ev)
+		return
+	}
+	switch e := ev.(type) {
+	case *etcdutil.EpochChange:
+		f.handleEpochChange(e)
+	case *observeRequest:
+		f.spawn(func() { f.handleObserveReq(e) })
+	case debounceEnd:
+		f.dispatchMetas()
+	case *metaChange:
+		if f.takes("meta", e.from, e.epoch) {
+			f.queueMetas(e)
+		}
+	case *requestToSend:
+		if f.accepts("req-to-send", e.epoch) {
+			cancel := f.epochCancel
+			f.spawn(func() { f.sendRequest(e, cancel) })
+		}
+	case *dataRequest:
+		if !f.accepts("request", e.epoch) {
+			e.notifyEpochMismatch()
+			break
+		}
+		f.serve(func() { f.handleDataReq(e) })
+	case *dataResponse:
+		if !f.accepts("resp-to-send", e.epoch) {
+			f.memory.Release(int64(len(e.data)))
+			e.notifyEpochMismatch()
+			break
+		}
+		f.spawn(func() { f.sendResponse(e) })
+	case *frameworkhttp.DataResponse:
+		if f.takes("data", e.TaskID, e.Epoch) {
+			f.spawn(func() { f.handleDataResp(e) })
+		} else {
+			f.dropDataResp(e)
+		}
+	case *barrierEvent:
+		if f.accepts("barrier", e.epoch) {
+			f.handleBarrier(e)
+		}
+	case *peerFailure:
+		if f.accepts("peer failure", e.epoch) {
+			f.handlePeerFailure(e)
+		}
+	case *message:
+		f.handleMessage(e)
+	case *pushToSend:
+		if !f.accepts("push-to-send", e.epoch) {
+			f.spawn(func() { f.handlePushFailure(&pushFailure{e, frameworkhttp.ErrReqEpochMismatch}) })
+			break
+		}
+		cancel := f.epochCancel
+		f.spawn(func() { f.push(e, cancel) })
+	case *pushFailure:
+		// Pushes are reported failed after their epoch too.
+		f.spawn(func() { f.handlePushFailure(e) })
+	case *dataFailure:
+		if f.takes("data", e.taskID, e.epoch) {
+			f.spawn(func() { f.handleDataFailure(e) })
+		}
+	case *configChange:
+		f.handleConfigChange(e)
+	case *topicEvent:
+		f.spawn(func() { e.handler(e.data) })
+	case *shardsToAssign:
+		if f.accepts("shard assignment", e.assignment.Epoch) {
+			f.handleShardsToAssign(e)
+		}
+	case *shardOwnerFailure:
+		if f.accepts("shard owner failure", e.epoch) {
+			f.handleShardOwnerFailure(e)
+		}
+	case *shardAssignment:
+		f.handleShardAssignment(e)
+	default:
+		f.log.Errorf("task %d: unknown event %T", f.taskID, ev)
+	}
+	f.flushMetas()
+}
+
+// accepts tells whether an event of given epoch is handled in current state.
+func (f *framework) accepts(kind string, epoch uint64) bool {
+	if f.state != stateRunning {
+		f.log.With("epoch", f.epoch).Warnf("task %d is %s: drops %s of epoch %d", f.taskID, f.state, kind, epoch)
+		return false
+	}
+	if epoch != f.epoch {
+		f.log.With("epoch", f.epoch).Warnf("epoch mismatch: %s epoch: %d", kind, epoch)
+		return false
+	}
+	return true
+}
+
+// takes is accepts for meta and data on their way to the task, which drops
+// them as stale otherwise.
+func (f *framework) takes(kind string, fromID, epoch uint64) bool {
+	if f.state == stateRunning && epoch == f.epoch {
+		return true
+	}
+	f.dropStale(kind, fromID, epoch)
+	return false
+}
+
+// reject lets the requests waiting on the event go once the node has exited.
+func (f *framework) reject(ev event) {
+	switch e := ev.(type) {
+	case *dataRequest:
+		e.notifyEpochMismatch()
+	case *dataResponse:
+		f.memory.Release(int64(len(e.data)))
+		e.notifyEpochMismatch()
+	case *frameworkhttp.DataResponse:
+		f.dropDataResp(e)
+	case *message:
+		e.ack <- frameworkhttp.ErrServerClosed
+	}
+}
+
+// spawn runs a handler out of the event loop, so that the loop goes on while
+// the task or the network takes its time. Tests run handlers in line with
+// runHandler, so that the interleaving of events is deterministic.
+func (f *framework) spawn(fn func()) {
+	if f.runHandler != nil {
+		f.runHandler(fn)
+		return
+	}
+	go fn()
+}
+
+// serve runs the handler of a data request on the serve pool, if the node has
+// one.
+func (f *framework) serve(fn func()) {
+	if f.servePool == nil || f.runHandler != nil {
+		f.spawn(fn)
+		return
+	}
+	f.servePool.run(fn)
+}
+
+// queueMetas batches the meta with the others queued, so that a burst, e.g. at
+// the start of an epoch, is dispatched at once. Identical meta in a batch is
+// dispatched once. The batch is dispatched once no more events are queued, or
+// with a debounce window, once the window is over; then only the latest meta
+// of a neighbor on a link is dispatched.
+func (f *framework) queueMetas(m *metaChange) {
+	f.addMeta(m)
+	if f.metaDebounce > 0 && f.debounceTimer == nil {
+		f.debounceTimer = time.NewTimer(f.metaDebounce)
+		f.debounceC = f.debounceTimer.C
+	}
+}
+
+// flushMetas dispatches the batch of meta not held for debounce, once no more
+// events are queued.
+func (f *framework) flushMetas() {
+	if f.metaDebounce > 0 || len(f.pendingMetas) == 0 || len(f.events) > 0 {
+		return
+	}
+	f.dispatchMetas()
+}
+
+func (f *framework) addMeta(m *metaChange) {
+	if m.epoch != f.epoch {
+		return
+	}
+	for i, p := range f.pendingMetas {
+		if p.from != m.from || p.linkType != m.linkType || p.metaType != m.metaType {
+			continue
+		}
+		if p.meta == m.meta || f.metaDebounce > 0 {
+			// Keep the time of the first one for the lag.
+			m.at = p.at
+			f.pendingMetas[i] = m
+			f.metrics.metaCoalesced.Inc()
+			return
+		}
+	}
+	f.pendingMetas = append(f.pendingMetas, m)
+}
+
+func (f *framework) dispatchMetas() {
+	f.stopDebounce()
+	now := time.Now()
+	var lag time.Duration
+	for _, m := range f.pendingMetas {
+		m := m
+		if d := now.Sub(m.at); d > lag {
+			lag = d
+		}
+		if m.metaType == metaGather {
+			f.handleGather(m)
+			continue
+		}
+		f.spawn(func() { f.handleMetaChange(m) })
+	}
+	f.pendingMetas = nil
+	f.metrics.eventLoopLag.Set(int64(lag / time.Microsecond))
+}
+
+// dropMetas drops meta of the epoch that is over.
+func (f *framework) dropMetas() {
+	f.stopDebounce()
+	f.pendingMetas = nil
+}
+
+func (f *framework) stopDebounce() {
+	if f.debounceTimer != nil {
+		f.debounceTimer.Stop()
+		f.debounceTimer, f.debounceC = nil, nil
+	}
+}
@@ -0,0 +1,393 @@
+package framework
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestMetaBatch(t *testing.T) {
+	f := &framework{epoch: 2, metrics: newNodeMetrics("TestMetaBatch", 0)}
+	queued := []*metaChange{
+		{from: 1, linkType: "child", epoch: 2, meta: "a"},
+		{from: 1, linkType: "child", epoch: 1, meta: "stale"},
+		{from: 2, linkType: "child", epoch: 2, meta: "a"},
+		{from: 1, linkType: "child", epoch: 2, meta: "a"},
+		{from: 1, linkType: "child", epoch: 2, meta: "b"},
+	}
+	for _, m := range queued {
+		f.addMeta(m)
+	}
+	if len(f.pendingMetas) != 3 || f.pendingMetas[0].meta != "a" || f.pendingMetas[1].from != 2 || f.pendingMetas[2].meta != "b" {
+		t.Errorf("pending metas without debounce = %v", f.pendingMetas)
+	}
+	if n := f.metrics.metaCoalesced.Value(); n != 1 {
+		t.Errorf("coalesced = %d, want 1", n)
+	}
+
+	f = &framework{epoch: 2, metrics: newNodeMetrics("TestMetaBatch", 0), metaDebounce: time.Second}
+	first := time.Unix(1400000000, 0)
+	queued[0].at = first
+	for _, m := range queued {
+		f.addMeta(m)
+	}
+	if len(f.pendingMetas) != 2 || f.pendingMetas[0].meta != "b" || !f.pendingMetas[0].at.Equal(first) || f.pendingMetas[1].from != 2 {
+		t.Errorf("pending metas with debounce = %v", f.pendingMetas)
+	}
+	f.dropMetas()
+	if f.pendingMetas != nil {
+		t.Errorf("pending metas after drop = %v", f.pendingMetas)
+	}
+}
+
+func TestStepStates(t *testing.T) {
+	f := newTestFramework(t)
+	f.epoch = 1
+	f.state = stateJoining
+	mismatch := func(ev event, dataChan chan []byte) bool {
+		f.step(ev)
+		select {
+		case _, ok := <-dataChan:
+			return !ok
+		default:
+			return false
+		}
+	}
+
+	c := make(chan []byte, 1)
+	if !mismatch(&dataRequest{taskID: 1, epoch: 1, dataChan: c}, c) {
+		t.Errorf("request served while joining")
+	}
+	f.state = stateRunning
+	c = make(chan []byte, 1)
+	if !mismatch(&dataRequest{taskID: 1, epoch: 0, dataChan: c}, c) {
+		t.Errorf("request of stale epoch served")
+	}
+	f.step(&metaChange{from: 1, epoch: 0, meta: "stale"})
+	if len(f.pendingMetas) != 0 {
+		t.Errorf("pending metas = %v, want none of stale epoch", f.pendingMetas)
+	}
+
+	cancel := make(chan struct{})
+	f.epochCancel = cancel
+	f.step((*etcdutil.EpochChange)(nil))
+	select {
+	case <-cancel:
+	default:
+		t.Errorf("data requests of the epoch aren't canceled on stop")
+	}
+	if f.state != stateExited {
+		t.Fatalf("state after stop = %s, want %s", f.state, stateExited)
+	}
+	c = make(chan []byte, 1)
+	if !mismatch(&dataResponse{taskID: 1, epoch: 1, dataChan: c}, c) {
+		t.Errorf("response sent after exit")
+	}
+}
+
+type staleTask struct {
+	meritop.Task
+	ready []string
+	stale []string
+}
+
+func (t *staleTask) MetaReady(fromID uint64, linkType, meta string) {
+	t.ready = append(t.ready, meta)
+}
+
+func (t *staleTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.ready = append(t.ready, string(resp))
+}
+
+func (t *staleTask) StaleMessage(fromID uint64, kind string, epoch uint64) {
+	t.stale = append(t.stale, fmt.Sprintf("%s of %d at %d", kind, fromID, epoch))
+}
+
+func TestStaleMessages(t *testing.T) {
+	topo := example.NewTreeTopology(2, 3)
+	topo.SetTaskID(0)
+	task := &staleTask{}
+	f := newTestFramework(t)
+	f.epoch = 1
+	f.topology = topo
+	f.task = task
+	f.running.open(1)
+
+	f.step(&metaChange{from: 1, linkType: meritop.LinkChild, epoch: 0, meta: "stale"})
+	f.step(&frameworkhttp.DataResponse{TaskID: 2, Epoch: 0, Data: []byte("stale")})
+	f.step(&frameworkhttp.DataResponse{TaskID: 2, Epoch: 1, Data: []byte("fresh")})
+	// The epoch is over by the time the handler runs.
+	f.running.close()
+	f.handleDataResp(&frameworkhttp.DataResponse{TaskID: 1, Epoch: 1, Data: []byte("late")})
+	f.handleMetaChange(&metaChange{from: 1, linkType: meritop.LinkChild, epoch: 1, meta: "late"})
+
+	if len(task.ready) != 1 || task.ready[0] != "fresh" {
+		t.Errorf("task got %v, want only fresh", task.ready)
+	}
+	want := []string{"meta of 1 at 0", "data of 2 at 0", "data of 1 at 1", "meta of 1 at 1"}
+	if !reflect.DeepEqual(task.stale, want) {
+		t.Errorf("stale messages = %v, want %v", task.stale, want)
+	}
+	if n := f.metrics.staleMessages.Value(); n != 4 {
+		t.Errorf("stale messages counted = %d, want 4", n)
+	}
+}
+
+// DataRequest may be called off the event loop, e.g. by a timer, while the
+// epoch changes on it.
+func TestDataRequestOffLoop(t *testing.T) {
+	f := newTestFramework(t)
+	f.setEpoch(1)
+	done := make(chan bool)
+	go func() {
+		f.DataRequest(1, "params")
+		close(done)
+	}()
+	f.setEpoch(2)
+	<-done
+	e := (<-f.events).(*requestToSend)
+	if e.taskID != 1 || e.req != "params" || (e.epoch != 1 && e.epoch != 2) {
+		t.Errorf("request = %+v, want params to task 1 of epoch 1 or 2", e)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	job := "TestDeadLetter"
+	f := newTestFramework(t, WithCoordinator(etcdutil.NewMemoryCoordinator()))
+	// Task 1 has no address: it is gone.
+	f.sendRequest(&requestToSend{taskID: 1, epoch: 2, req: "params"}, nil)
+	dls, err := etcdutil.GetDeadLetters(f.etcdClient, job)
+	if err != nil {
+		t.Fatalf("GetDeadLetters failed: %v", err)
+	}
+	if len(dls) != 1 || dls[0].From != 0 || dls[0].To != 1 || dls[0].Epoch != 2 || dls[0].Kind != "data" || dls[0].Payload != "params" || dls[0].Error == "" {
+		t.Errorf("dead letters = %+v", dls)
+	}
+	if n := f.metrics.deadLetters.Value(); n != 1 {
+		t.Errorf("dead letters counted = %d, want 1", n)
+	}
+}
+
+type peerTask struct {
+	meritop.Task
+	failed []uint64
+}
+
+func (t *peerTask) PeerFailed(taskID uint64) { t.failed = append(t.failed, taskID) }
+
+func TestPeerFailure(t *testing.T) {
+	job := "TestPeerFailure"
+	client := etcdutil.NewMemoryCoordinator()
+	if err := etcdutil.CreateNumOfTasks(client, job, 3); err != nil {
+		t.Fatal(err)
+	}
+	claims := make([]*etcdutil.Claim, 3)
+	for i := range claims {
+		c, err := etcdutil.ClaimTask(client, job, uint64(i), fmt.Sprintf("host:%d", i))
+		if err != nil {
+			t.Fatalf("ClaimTask failed: %v", err)
+		}
+		claims[i] = c
+	}
+	task := &peerTask{}
+	f := newTestFramework(t, WithCoordinator(client))
+	f.epoch = 1
+	f.task = task
+	f.watchPeers()
+	// Let the watch start.
+	time.Sleep(50 * time.Millisecond)
+	if err := etcdutil.ReleaseClaim(client, job, claims[2]); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-f.events:
+		f.step(ev)
+	case <-time.After(time.Second):
+		t.Fatal("no peer failure")
+	}
+	// A failure of the epoch that is over is dropped.
+	f.step(&peerFailure{taskID: 1, epoch: 0})
+	f.releaseEpochResource()
+
+	if !reflect.DeepEqual(task.failed, []uint64{2}) {
+		t.Errorf("failed peers = %v, want [2]", task.failed)
+	}
+}
+
+type messageTask struct {
+	meritop.Task
+	messages chan string
+}
+
+func (t *messageTask) MessageReady(fromID uint64, payload []byte) {
+	t.messages <- fmt.Sprintf("%d:%s", fromID, payload)
+}
+
+func TestSendMessage(t *testing.T) {
+	job := "TestSendMessage"
+	client := etcdutil.NewMemoryCoordinator()
+	task := &messageTask{messages: make(chan string, 1)}
+	receiver := newTestFramework(t)
+	receiver.taskID = 2
+	receiver.epoch = 1
+	receiver.task = task
+	defer close(receiver.httpStop)
+	go func() {
+		for ev := range receiver.events {
+			receiver.step(ev)
+		}
+	}()
+	s := httptest.NewServer(frameworkhttp.NewMessageHandler(receiver.log, receiver))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+	// Task 2 runs on the receiver, not linked to task 0 by any topology. Task
+	// 3 has failed over from it.
+	for _, id := range []uint64{2, 3} {
+		if _, err := etcdutil.ClaimTask(client, job, id, addr); err != nil {
+			t.Fatalf("ClaimTask failed: %v", err)
+		}
+	}
+	sender := newTestFramework(t, WithCoordinator(client))
+	sender.httpClient = frameworkhttp.DefaultClient
+
+	sender.sendMessage(2, 1, []byte("shard-7"))
+	select {
+	case m := <-task.messages:
+		if m != "0:shard-7" {
+			t.Errorf("message = %s, want 0:shard-7", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+
+	sender.sendMessage(3, 1, []byte("shard-8"))
+	sender.sendMessage(4, 1, []byte("shard-9"))
+	dls, err := etcdutil.GetDeadLetters(client, job)
+	if err != nil {
+		t.Fatalf("GetDeadLetters failed: %v", err)
+	}
+	if len(dls) != 2 {
+		t.Fatalf("dead letters = %+v, want 2", dls)
+	}
+	for i, dl := range dls {
+		if dl.Kind != "message" || dl.From != 0 || dl.Epoch != 1 || dl.Error == "" {
+			t.Errorf("#%d: dead letter = %+v", i, dl)
+		}
+	}
+	if dls[0].Error != frameworkhttp.ErrWrongTask.Error() {
+		t.Errorf("dead letter error = %q, want %q", dls[0].Error, frameworkhttp.ErrWrongTask)
+	}
+}
+
+type pushTask struct {
+	meritop.Task
+	pushes chan string
+	// PushReady waits for it, unless nil
+	release chan struct{}
+}
+
+func (t *pushTask) PushReady(fromID uint64, payload []byte) {
+	if t.release != nil {
+		<-t.release
+	}
+	t.pushes <- fmt.Sprintf("%d:%s", fromID, payload)
+}
+
+func TestPush(t *testing.T) {
+	job := "TestPush"
+	client := etcdutil.NewMemoryCoordinator()
+	task := &pushTask{pushes: make(chan string, 1)}
+	receiver := newTestFramework(t)
+	receiver.taskID = 2
+	receiver.epoch = 1
+	receiver.task = task
+	defer close(receiver.httpStop)
+	go func() {
+		for ev := range receiver.events {
+			receiver.step(ev)
+		}
+	}()
+	s := httptest.NewServer(frameworkhttp.NewMessageHandler(receiver.log, receiver))
+	defer s.Close()
+	if _, err := etcdutil.ClaimTask(client, job, 2, strings.TrimPrefix(s.URL, "http://")); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	sender := newTestFramework(t, WithCoordinator(client))
+	sender.httpClient = frameworkhttp.DefaultClient
+	defer close(sender.httpStop)
+
+	sender.push(&pushToSend{to: 2, epoch: 1, payload: []byte("grad")}, nil)
+	select {
+	case p := <-task.pushes:
+		if p != "0:grad" {
+			t.Errorf("push = %s, want 0:grad", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no push")
+	}
+
+	// Pushes of an epoch the receiver is over fail, and those of an epoch it
+	// hasn't started fail once the epoch of the sender is over.
+	cancel := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(cancel) })
+	tests := []struct {
+		epoch  uint64
+		cancel chan struct{}
+		want   error
+	}{
+		{0, nil, frameworkhttp.ErrReqEpochMismatch},
+		{2, cancel, frameworkhttp.ErrCanceled},
+	}
+	for i, tt := range tests {
+		sender.push(&pushToSend{to: 2, epoch: tt.epoch, payload: []byte("late")}, tt.cancel)
+		select {
+		case ev := <-sender.events:
+			if pf, ok := ev.(*pushFailure); !ok || pf.err != tt.want || pf.epoch != tt.epoch {
+				t.Errorf("#%d: event = %+v, want push failure %v", i, ev, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("#%d: no push failure", i)
+		}
+	}
+	select {
+	case p := <-task.pushes:
+		t.Errorf("push %s taken out of its epoch", p)
+	default:
+	}
+}
+
+func TestPushEpochCutOff(t *testing.T) {
+	task := &pushTask{pushes: make(chan string, 1), release: make(chan struct{})}
+	f := newTestFramework(t)
+	f.taskID = 2
+	f.epoch = 1
+	f.task = task
+	// The task takes the push in a goroutine of its own.
+	f.runHandler = nil
+	f.handleMessage(&message{from: 0, to: 2, payload: []byte("grad"), push: true, epoch: 1, ack: make(chan error, 1)})
+
+	// The epoch isn't over until the task has taken its pushes.
+	done := make(chan struct{})
+	go func() {
+		f.releaseEpochResource()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("epoch over before the task took its push")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(task.release)
+	<-done
+	if p := <-task.pushes; p != "0:grad" {
+		t.Errorf("push = %s, want 0:grad", p)
+	}
+}
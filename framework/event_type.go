@@ -1,17 +1,53 @@
 package framework
 
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// event is what the event loop handles, one at a time, in the order queued:
+// *metaChange, *requestToSend, *dataRequest, *dataResponse,
+// *frameworkhttp.DataResponse, *observeRequest, *barrierEvent, *peerFailure,
+// *message, *topicEvent, *shardsToAssign, *shardOwnerFailure or
+// *shardAssignment. Epoch changes, i.e. *etcdutil.EpochChange, come on their own
+// channel to go first, and debounceEnd from the debounce timer.
+type event interface{}
+
+// debounceEnd ends the debounce window of the meta queued.
+type debounceEnd struct{}
+
 type metaChange struct {
-	from  uint64
-	who   taskRole
-	epoch uint64
-	meta  string
+	from     uint64
+	linkType string
+	// the meta flag it comes from, e.g. the reverse of linkType
+	metaType string
+	epoch    uint64
+	meta     string
+	// when it is queued to the event loop
+	at time.Time
+}
+
+// requestToSend is a data request of the task to another task.
+type requestToSend struct {
+	taskID uint64
+	epoch  uint64
+	req    string
 }
 
+// dataRequest is a data request of another task to the task.
 type dataRequest struct {
-	taskID   uint64
-	epoch    uint64
-	req      string
+	taskID uint64
+	epoch  uint64
+	req    string
+	// nil unless the request is typed
+	typed    *typedRequest
 	dataChan chan []byte
+	// takes the error the request fails with, other than epoch mismatch
+	failed chan error
+	// releases the data served, if it is a payload of the task, see
+	// meritop.PayloadServer
+	release func()
 }
 
 func (dr *dataRequest) notifyEpochMismatch() {
@@ -29,3 +65,87 @@ type dataResponse struct {
 func (dr *dataResponse) notifyEpochMismatch() {
 	close(dr.dataChan)
 }
+
+// barrierEvent is either the task entering a barrier, or all tasks having
+// entered it.
+type barrierEvent struct {
+	name  string
+	epoch uint64
+	ready bool
+}
+
+// peerFailure is another task failing, see meritop.PeerFailureObserver.
+type peerFailure struct {
+	taskID uint64
+	epoch  uint64
+}
+
+// message is a message of another task, see meritop.MessageReceiver, or a
+// push of the epoch, see meritop.PushReceiver.
+type message struct {
+	from    uint64
+	to      uint64
+	payload []byte
+	ack     chan error
+	push    bool
+	epoch   uint64
+}
+
+// configChange is a new config of the job, see meritop.ConfigObserver.
+type configChange struct {
+	config map[string]string
+}
+
+// pushToSend is a push of the task, see Framework.Push.
+type pushToSend struct {
+	to      uint64
+	epoch   uint64
+	payload []byte
+}
+
+// pushFailure is a push of the task which wasn't taken within its epoch, see
+// meritop.PushFailureReceiver.
+type pushFailure struct {
+	*pushToSend
+	err error
+}
+
+// dataFailure is a data request or a call of the task which the other task
+// failed, see meritop.DataErrorReceiver and meritop.CallReceiver.
+type dataFailure struct {
+	taskID uint64
+	epoch  uint64
+	req    string
+	err    error
+}
+
+// topicEvent is an event published on a topic the task subscribed to.
+type topicEvent struct {
+	topic   string
+	data    string
+	handler func(data string)
+}
+
+// shardsToAssign is an assignment of shards the task publishes, see
+// Framework.AssignShards.
+type shardsToAssign struct {
+	assignment *etcdutil.ShardAssignment
+}
+
+// shardOwnerFailure is a task failing in an epoch the task assigned shards
+// in.
+type shardOwnerFailure struct {
+	taskID uint64
+	epoch  uint64
+}
+
+// shardAssignment is an assignment of shards published, see
+// meritop.ShardReceiver.
+type shardAssignment struct {
+	assignment *etcdutil.ShardAssignment
+}
+
+type observeRequest struct {
+	req      string
+	dataChan chan []byte
+}
@@ -1,88 +1,233 @@
 package framework
 
 import (
-	"fmt"
-	"log"
-	"math"
+	"errors"
 	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/coreos/go-etcd/etcd"
 	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
 	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/collective"
+	"github.com/go-distributed/meritop/pkg/datacodec"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/logging"
+	"github.com/go-distributed/meritop/pkg/membudget"
+	"github.com/go-distributed/meritop/pkg/sandbox"
+	"github.com/go-distributed/meritop/pkg/stream"
 )
 
-const exitEpoch = math.MaxUint64
+const exitEpoch = etcdutil.ExitEpoch
 
 type framework struct {
 	// These should be passed by outside world
 	name     string
 	etcdURLs []string
-	log      *log.Logger
+	etcdAPI  string
+	log      logging.Logger
 
 	// user defined interfaces
 	taskBuilder meritop.TaskBuilder
 	topology    meritop.Topology
 
-	task       meritop.Task
-	taskID     uint64
-	epoch      uint64
-	etcdClient *etcd.Client
-	ln         net.Listener
+	task   meritop.Task
+	taskID uint64
+	claim  *etcdutil.Claim
+	epoch  uint64
+	// epoch as read off the event loop, see setEpoch
+	sharedEpoch uint64
+	numOfTasks  uint64
+	state       nodeState
+	etcdClient  etcdutil.Coordinator
+	retry       etcdutil.RetryPolicy
+	codec       etcdutil.Codec
+	ln          net.Listener
+	tlsInfo     *frameworkhttp.TLSInfo
+	httpClient  *frameworkhttp.Client
+	// required with data requests if not empty
+	dataToken     string
+	etcdDataToken bool
+	// runs the task in a child process if set, see WithSandbox
+	sandbox      *sandbox.Config
+	degradedMode bool
+	compression  []string
+	// parallel streams of large data responses, see WithParallelStreams
+	streams       int
+	streamMinSize int
+	metaBuf       metaBuffer
+	addrs         addrCache
+
+	// number of tasks if the nodes set up the job themselves
+	selfOrganizeTasks uint64
+	supervisor        *controller.Controller
+
+	// workers serving data requests; one goroutine per request if nil
+	servePool *servePool
+	// data requests time out after it, if non-zero
+	requestTimeout time.Duration
+	// resolves the names in the addresses of tasks if set, see WithDNS
+	dns *frameworkhttp.DNSPolicy
+	// fetch the data of requests twice, see WithDataVerification
+	verifyData bool
+	// candidate transport data requests are duplicated over
+	shadow frameworkhttp.DataTransport
+	// closed once current epoch is over, canceling its data requests
+	epochCancel chan struct{}
+	// epoch the task runs, checked by handlers right before the callbacks
+	running epochGate
+	// contracts of data responses by request name
+	schemas map[string]Schema
+	// collectives of the task, see AllReduce
+	collectives *collective.Collectives
+	// handlers of typed data requests and of calls by name, see Handle and
+	// RegisterHandler
+	handlersMu sync.RWMutex
+	handlers   map[string]meritop.TypedHandler
+	named      map[string]meritop.HandlerFunc
+	// pushes of current epoch the task is taking, see Push
+	pushes sync.WaitGroup
+	// data requests of other tasks the task responds to later, see Respond
+	deferred deferredRequests
+	// codecs of typed data, in order of preference; defaultCodecs if empty
+	codecs []datacodec.Codec
+	// budget of the buffers of the task, see WithMemoryBudget
+	memory *membudget.Budget
+	// where the results of the task go, see Emit
+	sink    stream.Sink
+	results results
+
+	checkpointStore    checkpoint.Store
+	checkpointInterval uint64
+	httpHandlers       map[string]http.Handler
+	progressTimeout    time.Duration
+	heartbeatInterval  time.Duration
+	ttls               etcdutil.TTLs
+	standby            bool
+	resources          etcdutil.Resources
+	speculateAfter     time.Duration
+	backup             bool
+	probeLinks         bool
+	links              linkStats
+	progress           progress
+	metrics            *nodeMetrics
+
+	// epoch the backup copy runs, see WithBackup
+	backupEpoch uint64
+	// copy of the task whose output current epoch takes, see WithSpeculation
+	speculation speculation
+	// how long the task takes in current epoch
+	timing epochTiming
+
+	// phases of the job, and the one of current epoch
+	phases       []Phase
+	phase        *Phase
+	phaseChanged bool
 
 	// etcd stops
 	metaStops []chan bool
-	epochStop chan bool
+	// topics subscribed, for as long as the node runs
+	subscriptions subscriptions
+	// config of the job, see GetJobConfig
+	jobConfig jobConfig
+	// shard assignment of current epoch, see AssignShards
+	shards shardState
+	// barriers entered in current epoch
+	barriers []string
+	// meta gathered in current epoch, nil unless the topology is a tree
+	gather *gatherRound
+	// meta waiting to be dispatched, see queueMetas
+	pendingMetas  []*metaChange
+	metaDebounce  time.Duration
+	debounceTimer *time.Timer
+	debounceC     <-chan time.Time
+	epochStop     chan bool
 
 	httpStop      chan struct{}
 	heartbeatStop chan struct{}
+	heartbeatDone chan struct{}
 
 	// event loop
-	epochChan          chan uint64
-	metaChan           chan *metaChange
-	dataReqtoSendChan  chan *dataRequest
-	dataReqChan        chan *dataRequest
-	dataRespToSendChan chan *dataResponse
-	dataRespChan       chan *frameworkhttp.DataResponse
+	epochChan chan *etcdutil.EpochChange
+	events    chan event
+	// runs the handlers spawned by the loop; nil runs them in new goroutines
+	runHandler func(func())
 }
 
-func (f *framework) FlagMetaToParent(meta string) {
-	value := fmt.Sprintf("%d-%s", f.epoch, meta)
-	_, err := f.etcdClient.Set(etcdutil.ParentMetaPath(f.name, f.GetTaskID()), value, 0)
-	if err != nil {
-		f.log.Fatalf("etcdClient.Set failed; key: %s, value: %s, error: %v",
-			etcdutil.ParentMetaPath(f.name, f.GetTaskID()), value, err)
-	}
-}
+func (f *framework) FlagMetaToParent(meta string) { f.FlagMeta(meritop.LinkParent, meta) }
 
-func (f *framework) FlagMetaToChild(meta string) {
-	value := fmt.Sprintf("%d-%s", f.epoch, meta)
-	_, err := f.etcdClient.Set(etcdutil.ChildMetaPath(f.name, f.GetTaskID()), value, 0)
-	if err != nil {
-		f.log.Fatalf("etcdClient.Set failed; key: %s, value: %s, error: %v",
-			etcdutil.ChildMetaPath(f.name, f.GetTaskID()), value, err)
-	}
-}
+func (f *framework) FlagMetaToChild(meta string) { f.FlagMeta(meritop.LinkChild, meta) }
+
+func (f *framework) FlagMeta(linkType, meta string) { f.flagMeta(linkType, meta, f.epoch) }
 
 // When app code invoke this method on framework, we simply
 // update the etcd epoch to next uint64. All nodes should watch
 // for epoch and update their local epoch correspondingly.
+// See IncEpoch for the errors, which are logged here.
 func (f *framework) IncEpoch() {
-	err := etcdutil.CASEpoch(f.etcdClient, f.name, f.epoch, f.epoch+1)
-	if err != nil {
+	switch err := f.incEpoch(); err {
+	case nil:
+	case ErrEpochMoved:
+		f.log.Warnf("task %d: epoch %d is over already", f.taskID, f.epoch)
+	case ErrNotEpochMaster:
+		f.log.Errorf("task %d may not advance epoch %d: %v", f.taskID, f.epoch, err)
+	default:
 		f.log.Fatalf("task %d Epoch CompareAndSwap(%d, %d) failed: %v",
 			f.taskID, f.epoch+1, f.epoch, err)
 	}
 }
 
+var (
+	// ErrNotEpochMaster is returned by IncEpoch for a task other than the one
+	// designated to advance the epoch (see controller.SetEpochMaster).
+	ErrNotEpochMaster = errors.New("framework: task isn't the epoch master of the job")
+	// ErrEpochMoved is returned by IncEpoch if the epoch has moved on from the
+	// one the task runs, e.g. as the node the task failed over from advanced
+	// it right before failing, or the job has exited.
+	ErrEpochMoved = errors.New("framework: epoch has moved on already")
+)
+
+// IncEpoch advances the job from the epoch the task runs to the next one. The
+// epoch in etcd is compared and swapped, so that it advances once however
+// many nodes of the task call IncEpoch in the epoch, e.g. a master failing
+// over mid-transition; the calls but the first fail with ErrEpochMoved. Unlike
+// Framework.IncEpoch, which logs errors, it lets the task handle them.
+func IncEpoch(fw meritop.Framework) error { return fw.(*framework).incEpoch() }
+
+func (f *framework) incEpoch() error {
+	epoch := f.epoch
+	var master uint64
+	var designated bool
+	err := f.retry.Do(func() (err error) {
+		master, designated, err = etcdutil.GetEpochMaster(f.etcdClient, f.name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if designated && master != f.taskID {
+		return ErrNotEpochMaster
+	}
+	err = f.retry.Do(func() error {
+		return etcdutil.CASEpoch(f.etcdClient, f.codec, f.name, epoch, epoch+1)
+	})
+	if err != nil && etcdutil.IsCompareFailed(err) {
+		return ErrEpochMoved
+	}
+	return err
+}
+
+// DataRequest may be called from any goroutine, e.g. a timer resending a
+// request, unlike most methods. The request carries the epoch current when it
+// is called; if the epoch changes before the request is sent, it is dropped as
+// stale on either end.
 func (f *framework) DataRequest(toID uint64, req string) {
-	// assumption here:
-	// Event driven task will call this in a synchronous way so that
-	// the epoch won't change at the time task sending this request.
-	// Epoch may change, however, before the request is actually being sent.
-	f.dataReqtoSendChan <- &dataRequest{
+	f.events <- &requestToSend{
 		taskID: toID,
-		epoch:  f.epoch,
+		epoch:  atomic.LoadUint64(&f.sharedEpoch),
 		req:    req,
 	}
 }
@@ -94,14 +239,82 @@ func (f *framework) stop() {
 	close(f.epochChan)
 }
 
+// StopNode stops the node running the task as if it crashed, while the job
+// goes on. It is meant for fault injection in tests, e.g. with
+// faultinject.Wrap.
+func StopNode(fw meritop.Framework) { fw.(*framework).stop() }
+
 // When node call this on framework, it simply set epoch to exitEpoch,
 // All nodes will be notified of the epoch change and exit themselves.
 func (f *framework) ShutdownJob() {
-	etcdutil.CASEpoch(f.etcdClient, f.name, f.epoch, exitEpoch)
+	etcdutil.CASEpoch(f.etcdClient, f.codec, f.name, f.epoch, exitEpoch)
+}
+
+// FinishJob records the result before the epoch exits, so that the result is
+// there once the job has finished.
+func (f *framework) FinishJob(result []byte) {
+	r := &etcdutil.JobResult{TaskID: f.taskID, At: time.Now(), Result: result}
+	err := f.retry.Do(func() error {
+		return etcdutil.CreateJobResult(f.etcdClient, f.name, r)
+	})
+	if err != nil && !etcdutil.IsNodeExist(err) {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to record the result of the job: %v", f.taskID, err)
+	}
+	f.ShutdownJob()
 }
 
-func (f *framework) GetLogger() *log.Logger { return f.log }
+func (f *framework) GetLogger() logging.Logger { return f.log }
 
 func (f *framework) GetTaskID() uint64 { return f.taskID }
 
+func (f *framework) ExportArtifact(name, value string) {
+	err := f.retry.Do(func() error {
+		return etcdutil.SetArtifact(f.etcdClient, f.name, name, value)
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to export artifact %s: %v", f.taskID, name, err)
+	}
+}
+
+func (f *framework) RecordResult(key, value string) {
+	err := f.retry.Do(func() error {
+		return etcdutil.SetResult(f.etcdClient, f.name, key, value)
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to record result %s: %v", f.taskID, key, err)
+	}
+}
+
+func (f *framework) GetResults() map[string]string {
+	var results map[string]string
+	err := f.retry.Do(func() (err error) {
+		results, err = etcdutil.GetResults(f.etcdClient, f.name)
+		return err
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to get results: %v", f.taskID, err)
+	}
+	return results
+}
+
 func (f *framework) GetEpoch() uint64 { return f.epoch }
+
+// adapted returns the task t adapts, if it's an adapter, to look for
+// optional interfaces on.
+func adapted(t meritop.Task) interface{} {
+	if a, ok := t.(meritop.AdaptedTask); ok {
+		return a.Adapted()
+	}
+	return t
+}
+
+// setEpoch sets the epoch of the node on the event loop, and the copy that
+// DataRequest reads from other goroutines.
+func (f *framework) setEpoch(epoch uint64) {
+	f.epoch = epoch
+	atomic.StoreUint64(&f.sharedEpoch, epoch)
+}
@@ -2,17 +2,21 @@ package framework
 
 import (
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 
-	"github.com/coreos/go-etcd/etcd"
 	"github.com/go-distributed/meritop"
 	"github.com/go-distributed/meritop/controller"
 	"github.com/go-distributed/meritop/example"
 	"github.com/go-distributed/meritop/framework/frameworkhttp"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/logging"
 )
 
 // TestRequestDataEpochMismatch creates a scenario where data request happened
@@ -20,17 +24,15 @@ import (
 // request client should get notified and return error.
 func TestRequestDataEpochMismatch(t *testing.T) {
 	job := "TestRequestDataEpochMismatch"
-	m := etcdutil.StartNewEtcdServer(t, job)
-	defer m.Terminate(t)
-	etcdURLs := []string{m.URL()}
-	controller := controller.New(job, etcd.NewClient(etcdURLs), 1)
+	coord := etcdutil.NewMemoryCoordinator()
+	controller := controller.New(job, coord, 1)
 	controller.Start()
 	defer controller.Stop()
 
 	fw := &framework{
-		name:     job,
-		etcdURLs: etcdURLs,
-		ln:       createListener(t),
+		name:       job,
+		etcdClient: coord,
+		ln:         createListener(t),
 	}
 	var wg sync.WaitGroup
 	fw.SetTaskBuilder(&testableTaskBuilder{
@@ -61,14 +63,10 @@ func TestRequestDataEpochMismatch(t *testing.T) {
 // it's passed from framework correctly and unmodified.
 func TestFrameworkFlagMetaReady(t *testing.T) {
 	appName := "framework_test_flagmetaready"
-	// launch testing etcd server
-	m := etcdutil.MustNewMember(t, appName)
-	m.Launch()
-	defer m.Terminate(t)
-	url := fmt.Sprintf("http://%s", m.ClientListeners[0].Addr().String())
+	coord := etcdutil.NewMemoryCoordinator()
 
 	// launch controller to setup etcd layout
-	ctl := controller.New(appName, etcd.NewClient([]string{url}), 2)
+	ctl := controller.New(appName, coord, 2)
 	if err := ctl.InitEtcdLayout(); err != nil {
 		t.Fatalf("initEtcdLayout failed: %v", err)
 	}
@@ -80,14 +78,14 @@ func TestFrameworkFlagMetaReady(t *testing.T) {
 	// simulate two tasks on two nodes -- 0 and 1
 	// 0 is parent, 1 is child
 	f0 := &framework{
-		name:     appName,
-		etcdURLs: []string{url},
-		ln:       createListener(t),
+		name:       appName,
+		etcdClient: coord,
+		ln:         createListener(t),
 	}
 	f1 := &framework{
-		name:     appName,
-		etcdURLs: []string{url},
-		ln:       createListener(t),
+		name:       appName,
+		etcdClient: coord,
+		ln:         createListener(t),
 	}
 
 	var wg sync.WaitGroup
@@ -121,20 +119,20 @@ func TestFrameworkFlagMetaReady(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		// 0: F#FlagChildMetaReady -> 1: T#ParentMetaReady
+		// 0: F#FlagMetaToChild -> 1: T#MetaReady
 		f0.FlagMetaToChild(tt.cMeta)
 		// from child(1)'s view
 		data := <-pDataChan
-		expected := &tDataBundle{0, tt.cMeta, "", nil}
+		expected := &tDataBundle{0, meritop.LinkParent, tt.cMeta, "", nil}
 		if !reflect.DeepEqual(data, expected) {
 			t.Errorf("#%d: data bundle want = %v, get = %v", i, expected, data)
 		}
 
-		// 1: F#FlagParentMetaReady -> 0: T#ChildMetaReady
+		// 1: F#FlagMetaToParent -> 0: T#MetaReady
 		f1.FlagMetaToParent(tt.pMeta)
 		// from parent(0)'s view
 		data = <-cDataChan
-		expected = &tDataBundle{1, tt.pMeta, "", nil}
+		expected = &tDataBundle{1, meritop.LinkChild, tt.pMeta, "", nil}
 		if !reflect.DeepEqual(data, expected) {
 			t.Errorf("#%d: data bundle want = %v, get = %v", i, expected, data)
 		}
@@ -143,14 +141,10 @@ func TestFrameworkFlagMetaReady(t *testing.T) {
 
 func TestFrameworkDataRequest(t *testing.T) {
 	appName := "framework_test_flagmetaready"
-	// launch testing etcd server
-	m := etcdutil.MustNewMember(t, appName)
-	m.Launch()
-	defer m.Terminate(t)
-	url := fmt.Sprintf("http://%s", m.ClientListeners[0].Addr().String())
+	coord := etcdutil.NewMemoryCoordinator()
 
 	// launch controller to setup etcd layout
-	ctl := controller.New(appName, etcd.NewClient([]string{url}), 2)
+	ctl := controller.New(appName, coord, 2)
 	if err := ctl.InitEtcdLayout(); err != nil {
 		t.Fatalf("initEtcdLayout failed: %v", err)
 	}
@@ -175,14 +169,14 @@ func TestFrameworkDataRequest(t *testing.T) {
 	// simulate two tasks on two nodes -- 0 and 1
 	// 0 is parent, 1 is child
 	f0 := &framework{
-		name:     appName,
-		etcdURLs: []string{url},
-		ln:       createListener(t),
+		name:       appName,
+		etcdClient: coord,
+		ln:         createListener(t),
 	}
 	f1 := &framework{
-		name:     appName,
-		etcdURLs: []string{url},
-		ln:       createListener(t),
+		name:       appName,
+		etcdClient: coord,
+		ln:         createListener(t),
 	}
 
 	var wg sync.WaitGroup
@@ -208,43 +202,82 @@ func TestFrameworkDataRequest(t *testing.T) {
 	defer f0.ShutdownJob()
 
 	for i, tt := range tests {
-		// 0: F#DataRequest -> 1: T#ServeAsChild -> 0: T#ChildDataReady
+		// 0: F#DataRequest -> 1: T#Serve -> 0: T#DataReady
 		f0.DataRequest(1, tt.req)
-		// from child(1)'s view at 1: T#ServeAsChild
+		// from child(1)'s view at 1: T#Serve
 		data := <-pDataChan
-		expected := &tDataBundle{0, "", data.req, nil}
+		expected := &tDataBundle{0, meritop.LinkParent, "", data.req, nil}
 		if !reflect.DeepEqual(data, expected) {
 			t.Errorf("#%d: data bundle want = %v, get = %v", i, expected, data)
 		}
-		// from parent(0)'s view at 0: T#ChildDataReady
+		// from parent(0)'s view at 0: T#DataReady
 		data = <-cDataChan
-		expected = &tDataBundle{1, "", data.req, data.resp}
+		expected = &tDataBundle{1, meritop.LinkChild, "", data.req, data.resp}
 		if !reflect.DeepEqual(data, expected) {
 			t.Errorf("#%d: data bundle want = %v, get = %v", i, expected, data)
 		}
 
-		// 1: F#DataRequest -> 0: T#ServeAsParent -> 1: T#ParentDataReady
+		// 1: F#DataRequest -> 0: T#Serve -> 1: T#DataReady
 		f1.DataRequest(0, tt.req)
-		// from parent(0)'s view at 0: T#ServeAsParent
+		// from parent(0)'s view at 0: T#Serve
 		data = <-cDataChan
-		expected = &tDataBundle{1, "", data.req, nil}
+		expected = &tDataBundle{1, meritop.LinkChild, "", data.req, nil}
 		if !reflect.DeepEqual(data, expected) {
 			t.Errorf("#%d: data bundle want = %v, get = %v", i, expected, data)
 		}
-		// from child(1)'s view at 1: T#ParentDataReady
+		// from child(1)'s view at 1: T#DataReady
 		data = <-pDataChan
-		expected = &tDataBundle{0, "", data.req, data.resp}
+		expected = &tDataBundle{0, meritop.LinkParent, "", data.req, data.resp}
 		if !reflect.DeepEqual(data, expected) {
 			t.Errorf("#%d: data bundle want = %v, get = %v", i, expected, data)
 		}
 	}
 }
 
+// TestFrameworkSelfOrganize runs a job without a controller: the nodes set up
+// the layout themselves, and flag meta to each other as usual.
+func TestFrameworkSelfOrganize(t *testing.T) {
+	appName := "framework_test_selforganize"
+	coord := etcdutil.NewMemoryCoordinator()
+	pDataChan := make(chan *tDataBundle, 1)
+	var wg sync.WaitGroup
+	taskBuilder := &testableTaskBuilder{pDataChan: pDataChan, setupLatch: &wg}
+	fs := make([]*framework, 2)
+	for i := range fs {
+		fs[i] = &framework{
+			name:              appName,
+			etcdClient:        coord,
+			ln:                createListener(t),
+			selfOrganizeTasks: 2,
+		}
+		fs[i].SetTaskBuilder(taskBuilder)
+		fs[i].SetTopology(example.NewTreeTopology(2, 2))
+	}
+	wg.Add(2)
+	for _, f := range fs {
+		go f.Start()
+	}
+	wg.Wait()
+	f0 := fs[0]
+	if f0.GetTaskID() != 0 {
+		f0 = fs[1]
+	}
+	defer f0.ShutdownJob()
+
+	f0.FlagMetaToChild("hello")
+	data := <-pDataChan
+	if expected := (&tDataBundle{0, meritop.LinkParent, "hello", "", nil}); !reflect.DeepEqual(data, expected) {
+		t.Errorf("data bundle want = %v, get = %v", expected, data)
+	}
+}
+
 type tDataBundle struct {
-	id   uint64
-	meta string
-	req  string
-	resp []byte
+	id uint64
+	// link type from the receiver's view
+	linkType string
+	meta     string
+	req      string
+	resp     []byte
 }
 
 type testableTaskBuilder struct {
@@ -292,33 +325,50 @@ func (t *testableTask) Init(taskID uint64, framework meritop.Framework) {
 func (t *testableTask) Exit()                 {}
 func (t *testableTask) SetEpoch(epoch uint64) {}
 
-func (t *testableTask) ParentMetaReady(fromID uint64, meta string) {
+func (t *testableTask) MetaReady(fromID uint64, linkType, meta string) {
 	if t.dataChan != nil {
-		t.dataChan <- &tDataBundle{fromID, meta, "", nil}
+		t.dataChan <- &tDataBundle{fromID, linkType, meta, "", nil}
 	}
 }
 
-func (t *testableTask) ChildMetaReady(fromID uint64, meta string) {
-	t.ParentMetaReady(fromID, meta)
-}
-
-func (t *testableTask) ServeAsParent(fromID uint64, req string) []byte {
+func (t *testableTask) Serve(fromID uint64, linkType, req string) []byte {
 	if t.dataChan != nil {
-		t.dataChan <- &tDataBundle{fromID, "", req, nil}
+		t.dataChan <- &tDataBundle{fromID, linkType, "", req, nil}
 	}
 	return t.dataMap[req]
 }
-func (t *testableTask) ServeAsChild(fromID uint64, req string) []byte {
-	return t.ServeAsParent(fromID, req)
-}
-func (t *testableTask) ParentDataReady(fromID uint64, req string, resp []byte) {
+
+func (t *testableTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
 	if t.dataChan != nil {
-		t.dataChan <- &tDataBundle{fromID, "", req, resp}
+		t.dataChan <- &tDataBundle{fromID, linkType, "", req, resp}
+	}
+}
+
+// newTestFramework returns the framework of task 0 of a job named after the
+// test, running, for tests calling its methods without bootstrapping it: it
+// logs nowhere, runs handlers inline and queues events without an event loop.
+// opts are applied first, e.g. WithCoordinator; tests set the fields they
+// need, e.g. task or topology, on the framework returned.
+func newTestFramework(t *testing.T, opts ...Option) *framework {
+	f := &framework{
+		name:       t.Name(),
+		state:      stateRunning,
+		codec:      etcdutil.TextCodec,
+		log:        testLogger(),
+		events:     make(chan event, 100),
+		httpStop:   make(chan struct{}),
+		runHandler: func(fn func()) { fn() },
+	}
+	for _, opt := range opts {
+		opt(f)
 	}
+	f.metrics = newNodeMetrics(f.name, f.taskID)
+	return f
 }
 
-func (t *testableTask) ChildDataReady(fromID uint64, req string, resp []byte) {
-	t.ParentDataReady(fromID, req, resp)
+// testLogger logs nowhere.
+func testLogger() logging.Logger {
+	return logging.NewStd(log.New(ioutil.Discard, "", 0), logging.Info)
 }
 
 func createListener(t *testing.T) net.Listener {
@@ -328,3 +378,136 @@ func createListener(t *testing.T) net.Listener {
 	}
 	return l
 }
+
+// allReduceTask sums the IDs of all tasks with AllReduce at epoch 1.
+type allReduceTask struct {
+	testableTask
+	sums chan string
+}
+
+func (t *allReduceTask) SetEpoch(epoch uint64) {
+	if epoch != 1 {
+		return
+	}
+	go func() {
+		sum, err := t.framework.AllReduce([]byte{byte(t.id)}, func(a, b []byte) []byte {
+			return []byte{a[0] + b[0]}
+		})
+		if err != nil {
+			t.sums <- err.Error()
+			return
+		}
+		t.sums <- fmt.Sprintf("task %d: %d", t.id, sum[0])
+	}()
+}
+
+type allReduceTaskBuilder struct {
+	setupLatch *sync.WaitGroup
+	sums       chan string
+}
+
+func (b *allReduceTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &allReduceTask{testableTask: testableTask{setupLatch: b.setupLatch}, sums: b.sums}
+}
+
+// TestFrameworkAllReduce runs AllReduce on a ring and on a tree of 3 tasks.
+func TestFrameworkAllReduce(t *testing.T) {
+	for _, topo := range []string{"ring", "tree"} {
+		appName := "framework_test_allreduce_" + topo
+		coord := etcdutil.NewMemoryCoordinator()
+		ctl := controller.New(appName, coord, 3)
+		if err := ctl.InitEtcdLayout(); err != nil {
+			t.Fatalf("initEtcdLayout failed: %v", err)
+		}
+		var wg sync.WaitGroup
+		taskBuilder := &allReduceTaskBuilder{setupLatch: &wg, sums: make(chan string, 3)}
+		fs := make([]*framework, 3)
+		for i := range fs {
+			fs[i] = &framework{name: appName, etcdClient: coord, ln: createListener(t)}
+			fs[i].SetTaskBuilder(taskBuilder)
+			if topo == "ring" {
+				fs[i].SetTopology(example.NewRingTopology(3))
+			} else {
+				fs[i].SetTopology(example.NewTreeTopology(2, 3))
+			}
+		}
+		wg.Add(3)
+		for _, f := range fs {
+			go f.Start()
+		}
+		wg.Wait()
+		fs[0].IncEpoch()
+
+		var got []string
+		for i := 0; i < 3; i++ {
+			select {
+			case sum := <-taskBuilder.sums:
+				got = append(got, sum)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: AllReduce isn't done, got %v", topo, got)
+			}
+		}
+		sort.Strings(got)
+		if want := []string{"task 0: 3", "task 1: 3", "task 2: 3"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: sums = %v, want %v", topo, got, want)
+		}
+		fs[0].ShutdownJob()
+		ctl.DestroyEtcdLayout()
+	}
+}
+
+// TestIncEpoch advances the epoch from the designated master, and checks that
+// a second advance from the same epoch, e.g. by the node the master failed
+// over to, and an advance from another task both fail.
+func TestIncEpoch(t *testing.T) {
+	job := "TestIncEpoch"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, coord, 2)
+	ctl.SetEpochMaster(0)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	newFramework := func(taskID uint64) *framework {
+		return &framework{name: job, taskID: taskID, etcdClient: coord, codec: etcdutil.TextCodec}
+	}
+
+	master := newFramework(0)
+	if err := IncEpoch(master); err != nil {
+		t.Fatalf("IncEpoch failed: %v", err)
+	}
+	failedOver := newFramework(0)
+	if err := IncEpoch(failedOver); err != ErrEpochMoved {
+		t.Errorf("IncEpoch of epoch over = %v, want %v", err, ErrEpochMoved)
+	}
+	worker := newFramework(1)
+	worker.epoch = 1
+	if err := IncEpoch(worker); err != ErrNotEpochMaster {
+		t.Errorf("IncEpoch of worker = %v, want %v", err, ErrNotEpochMaster)
+	}
+	if epoch, err := ctl.GetEpoch(); err != nil || epoch != 1 {
+		t.Errorf("epoch = (%d, %v), want 1", epoch, err)
+	}
+}
+
+func TestFinishJob(t *testing.T) {
+	job := "TestFinishJob"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, coord, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	f := &framework{name: job, taskID: 1, etcdClient: coord, codec: etcdutil.TextCodec}
+	f.FinishJob([]byte("accuracy=0.9"))
+	// A later result, e.g. of another task finishing the job too, is dropped.
+	f.FinishJob([]byte("accuracy=0.5"))
+
+	r, err := ctl.WaitResult(nil)
+	if err != nil {
+		t.Fatalf("WaitResult failed: %v", err)
+	}
+	if r.TaskID != 1 || string(r.Result) != "accuracy=0.9" {
+		t.Errorf("result = %+v, want accuracy=0.9 of task 1", r)
+	}
+}
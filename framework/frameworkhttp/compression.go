@@ -0,0 +1,132 @@
+package frameworkhttp
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// Encodings data can be compressed with, negotiated with Accept-Encoding and
+// Content-Encoding. Gradients and parameters often compress well, which pays
+// off on slow links.
+const (
+	EncodingGzip   = "gzip"
+	EncodingSnappy = "snappy"
+)
+
+func checkEncodings(encodings []string) {
+	for _, enc := range encodings {
+		if enc != EncodingGzip && enc != EncodingSnappy {
+			panic("frameworkhttp: unknown encoding " + enc)
+		}
+	}
+}
+
+// Compress compresses successful responses of h with the first of encodings
+// accepted by the client. Other responses aren't compressed.
+func Compress(h http.Handler, encodings ...string) http.Handler {
+	checkEncodings(encodings)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := negotiate(r.Header.Get("Accept-Encoding"), encodings)
+		if enc == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: enc}
+		h.ServeHTTP(cw, r)
+		if cw.w != nil {
+			cw.w.Close()
+		}
+	})
+}
+
+// negotiate returns the first of encodings in the Accept-Encoding header, or
+// "" if there is none.
+func negotiate(accept string, encodings []string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.TrimSpace(fields[0])
+		if len(fields) > 1 && strings.Replace(fields[1], " ", "", -1) == "q=0" {
+			continue
+		}
+		accepted[name] = true
+	}
+	for _, enc := range encodings {
+		if accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressWriter decides to compress at the status of the response.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.Header().Add("Vary", "Accept-Encoding")
+	if code == http.StatusOK {
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		cw.Header().Del("Content-Length")
+		switch cw.encoding {
+		case EncodingGzip:
+			cw.w = gzip.NewWriter(cw.ResponseWriter)
+		case EncodingSnappy:
+			cw.w = snappy.NewBufferedWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.w == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.w.Write(b)
+}
+
+// WithCompression returns a copy of the client accepting responses compressed
+// with the encodings, in order of preference.
+func (c *Client) WithCompression(encodings ...string) *Client {
+	checkEncodings(encodings)
+	cc := *c
+	cc.encodings = encodings
+	return &cc
+}
+
+// readBody reads the body of the response, decompressing it if needed.
+func readBody(resp *http.Response) ([]byte, error) {
+	var r io.Reader = resp.Body
+	switch enc := resp.Header.Get("Content-Encoding"); enc {
+	case "":
+	case EncodingGzip:
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case EncodingSnappy:
+		r = snappy.NewReader(resp.Body)
+	default:
+		return nil, fmt.Errorf("frameworkhttp: unknown content encoding %q", enc)
+	}
+	return ioutil.ReadAll(r)
+}
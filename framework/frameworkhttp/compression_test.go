@@ -0,0 +1,82 @@
+package frameworkhttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type repeatDataGetter struct{}
+
+func (repeatDataGetter) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	if epoch != 0 {
+		return nil, ErrReqEpochMismatch
+	}
+	return bytes.Repeat([]byte(req), 1000), nil
+}
+
+func TestCompression(t *testing.T) {
+	logger := testLogger()
+	tests := []struct {
+		server []string
+		client []string
+		want   string
+	}{
+		{nil, []string{EncodingGzip}, ""},
+		// The http package accepts gzip by itself.
+		{[]string{EncodingGzip}, nil, EncodingGzip},
+		{[]string{EncodingGzip}, []string{EncodingGzip}, EncodingGzip},
+		{[]string{EncodingSnappy, EncodingGzip}, []string{EncodingGzip, EncodingSnappy}, EncodingSnappy},
+		{[]string{EncodingSnappy}, []string{EncodingGzip}, ""},
+	}
+	for i, tt := range tests {
+		var h http.Handler = NewDataRequestHandler(logger, repeatDataGetter{})
+		if len(tt.server) > 0 {
+			h = Compress(h, tt.server...)
+		}
+		var encoding string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+			encoding = w.Header().Get("Content-Encoding")
+		}))
+		addr := strings.TrimPrefix(s.URL, "http://")
+		c := DefaultClient
+		if len(tt.client) > 0 {
+			c = c.WithCompression(tt.client...)
+		}
+
+		d, err := c.RequestData(addr, "gradient", 1, 0, 0, logger)
+		if err != nil {
+			t.Errorf("#%d: RequestData failed: %v", i, err)
+		} else if !bytes.Equal(d.Data, bytes.Repeat([]byte("gradient"), 1000)) {
+			t.Errorf("#%d: data of %d bytes isn't what is served", i, len(d.Data))
+		}
+		if encoding != tt.want {
+			t.Errorf("#%d: encoding want = %q, get = %q", i, tt.want, encoding)
+		}
+		if _, err := c.RequestData(addr, "gradient", 1, 0, 1, logger); err != ErrReqEpochMismatch {
+			t.Errorf("#%d: err want = %v, get = %v", i, ErrReqEpochMismatch, err)
+		}
+		s.Close()
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", EncodingGzip},
+		{"snappy, gzip", EncodingGzip},
+		{"deflate, snappy;q=0.5", EncodingSnappy},
+		{"gzip;q=0, snappy", EncodingSnappy},
+	}
+	for i, tt := range tests {
+		if get := negotiate(tt.accept, []string{EncodingGzip, EncodingSnappy}); get != tt.want {
+			t.Errorf("#%d: negotiate(%q) = %q, want %q", i, tt.accept, get, tt.want)
+		}
+	}
+}
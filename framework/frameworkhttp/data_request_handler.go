@@ -2,31 +2,84 @@ package frameworkhttp
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+
+	"github.com/go-distributed/meritop/pkg/logging"
 )
 
 var (
 	ErrReqEpochMismatch error = errors.New("data request error: epoch mismatch")
 	ErrServerClosed     error = errors.New("server has been closed")
+	// ErrServerBusy turns a data request away for the requester to retry
+	// later, as the server has too many requests to serve.
+	ErrServerBusy error = errors.New("data request error: server busy")
+	// ErrBadRequest is returned for typed data requests whose argument can't
+	// be unmarshaled, or which the task fails to serve.
+	ErrBadRequest error = errors.New("data request error: bad request")
+	// ErrNotAcceptable is returned for typed data requests whose client
+	// accepts no codec of the server.
+	ErrNotAcceptable error = errors.New("data request error: no acceptable codec")
+	// ErrNoHandler is returned for calls of a handler the server doesn't
+	// have.
+	ErrNoHandler error = errors.New("data request error: no handler")
 )
 
+// StatusHandlerFailed is the status of responses to data requests which the
+// task of the server failed, e.g. calls of a handler, whose body is the error.
+const StatusHandlerFailed = 422
+
+// HandlerError is the error a handler of the server failed a call with, or
+// its task failed a data request with.
+type HandlerError struct {
+	Msg string
+}
+
+func (e *HandlerError) Error() string { return "handler error: " + e.Msg }
+
 const (
 	DataRequestPrefix string = "/datareq"
 	DataRequestTaskID string = "taskID"
 	DataRequestReq    string = "req"
 	DataRequestEpoch  string = "epoch"
+	// DataResponseEpoch is the header stamping data responses with the epoch
+	// of the server, which the client checks against the one it requested.
+	DataResponseEpoch string = "X-Meritop-Epoch"
 )
 
 type DataGetter interface {
 	GetTaskData(uint64, uint64, string) ([]byte, error)
 }
 
+// TypedDataGetter is a DataGetter serving typed data too, marshaled with a
+// codec of the content types in accept, the Accept header of the request. It
+// returns the content type of the data, "" for untyped data.
+type TypedDataGetter interface {
+	DataGetter
+	GetTypedTaskData(fromID, epoch uint64, req, accept string) ([]byte, string, error)
+}
+
+// PayloadDataGetter is a TypedDataGetter whose data may be in a buffer of the
+// task, e.g. memory pinned through cgo, which is written as it is and then
+// released with release, if not nil.
+type PayloadDataGetter interface {
+	TypedDataGetter
+	GetTaskPayload(fromID, epoch uint64, req, accept string) (data []byte, contentType string, release func(), err error)
+}
+
+// NegotiateContentType returns the first of contentTypes in the Accept
+// header, or "" if there is none.
+func NegotiateContentType(accept string, contentTypes []string) string {
+	return negotiate(accept, contentTypes)
+}
+
 type dataReqHandler struct {
-	logger *log.Logger
+	logger logging.Logger
 	DataGetter
 }
 
@@ -35,9 +88,15 @@ type DataResponse struct {
 	Epoch  uint64
 	Req    string
 	Data   []byte
+	// ContentType is that of typed data. Untyped data has whatever the server
+	// sets, if anything.
+	ContentType string
+	// Release, if not nil, hands Data, which is in a buffer of the BufferFunc
+	// of the client, back unless it is taken over.
+	Release func()
 }
 
-func NewDataRequestHandler(logger *log.Logger, dg DataGetter) http.Handler {
+func NewDataRequestHandler(logger logging.Logger, dg DataGetter) http.Handler {
 	return &dataReqHandler{
 		logger:     logger,
 		DataGetter: dg,
@@ -54,32 +113,84 @@ func (h *dataReqHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fromIDStr := q.Get(DataRequestTaskID)
 	fromID, err := strconv.ParseUint(fromIDStr, 0, 64)
 	if err != nil {
-		h.logger.Panic("Internal error: fromID couldn't be parsed")
+		panic("Internal error: fromID couldn't be parsed")
 	}
 	epochStr := q.Get(DataRequestEpoch)
 	epoch, err := strconv.ParseUint(epochStr, 0, 64)
 	if err != nil {
-		h.logger.Panic("Internal error: epoch couldn't be parsed")
+		panic("Internal error: epoch couldn't be parsed")
 	}
 	req := q.Get(DataRequestReq)
 
-	b, err := h.GetTaskData(fromID, epoch, req)
+	var b []byte
+	var contentType string
+	if pg, ok := h.DataGetter.(PayloadDataGetter); ok {
+		var release func()
+		b, contentType, release, err = pg.GetTaskPayload(fromID, epoch, req, r.Header.Get("Accept"))
+		if release != nil {
+			defer release()
+		}
+	} else if tg, ok := h.DataGetter.(TypedDataGetter); ok {
+		b, contentType, err = tg.GetTypedTaskData(fromID, epoch, req, r.Header.Get("Accept"))
+	} else {
+		b, err = h.GetTaskData(fromID, epoch, req)
+	}
 	if err != nil {
+		switch err {
+		case ErrServerBusy:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case ErrBadRequest:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case ErrNotAcceptable:
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		case ErrNoHandler:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if he, ok := err.(*HandlerError); ok {
+			http.Error(w, he.Msg, StatusHandlerFailed)
+			return
+		}
 		if err == ErrReqEpochMismatch || err == ErrServerClosed {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
 		}
-		h.logger.Panic("unimplemented")
+		panic("unimplemented")
+	}
+	w.Header().Set(DataResponseEpoch, strconv.FormatUint(epoch, 10))
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
 	}
 	if _, err := w.Write(b); err != nil {
-		log.Printf("http: response write failed: %v", err)
+		h.logger.Errorf("http: response write failed: %v", err)
 	}
 }
 
-func RequestData(addr string, req string, from, to, epoch uint64, logger *log.Logger) (*DataResponse, error) {
+// DataTransport fetches the data of requests to other tasks, as Client does
+// over HTTP. Other transports can be validated against Client on live jobs
+// before they replace it, see framework.WithShadowTransport.
+type DataTransport interface {
+	RequestDataCancel(addr string, req string, from, to, epoch uint64, cancel <-chan struct{}, logger logging.Logger) (*DataResponse, error)
+}
+
+// RequestData requests data of task to at given epoch with DefaultClient.
+func RequestData(addr string, req string, from, to, epoch uint64, logger logging.Logger) (*DataResponse, error) {
+	return DefaultClient.RequestData(addr, req, from, to, epoch, logger)
+}
+
+func (c *Client) RequestData(addr string, req string, from, to, epoch uint64, logger logging.Logger) (*DataResponse, error) {
+	return c.RequestDataCancel(addr, req, from, to, epoch, nil, logger)
+}
+
+// RequestDataCancel is RequestData which gives up with ErrCanceled once
+// cancel is closed, e.g. as the epoch of the request is over.
+func (c *Client) RequestDataCancel(addr string, req string, from, to, epoch uint64, cancel <-chan struct{}, logger logging.Logger) (*DataResponse, error) {
 	u := url.URL{
-		Scheme: "http",
+		Scheme: c.scheme,
 		Host:   addr,
 		Path:   DataRequestPrefix,
 	}
@@ -91,7 +202,7 @@ func RequestData(addr string, req string, from, to, epoch uint64, logger *log.Lo
 	urlStr := u.String()
 	// send request
 	// pass the response to the awaiting event loop for data response
-	resp, err := http.Get(urlStr)
+	resp, err := c.get(urlStr, cancel)
 	if err != nil {
 		// The error could be caused because: 1. network failure; 2. We might have
 		// sent request to failed server.
@@ -99,20 +210,99 @@ func RequestData(addr string, req string, from, to, epoch uint64, logger *log.Lo
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, ErrUnauthorized
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			return nil, ErrServerBusy
+		}
+		if resp.StatusCode == http.StatusBadRequest {
+			return nil, ErrBadRequest
+		}
+		if resp.StatusCode == http.StatusNotAcceptable {
+			return nil, ErrNotAcceptable
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNoHandler
+		}
+		if resp.StatusCode == StatusHandlerFailed {
+			msg, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &HandlerError{Msg: strings.TrimSuffix(string(msg), "\n")}
+		}
 		if resp.StatusCode == http.StatusInternalServerError {
 			// Now assuming only epoch mismatch can cause this error.
 			return nil, ErrReqEpochMismatch
 		}
 		logger.Fatalf("http: response code = %d, expect = %d", resp.StatusCode, 200)
 	}
-	data, err := ioutil.ReadAll(resp.Body)
+	// Servers predating the stamp don't set it.
+	if stamp := resp.Header.Get(DataResponseEpoch); stamp != "" && stamp != strconv.FormatUint(epoch, 10) {
+		return nil, ErrReqEpochMismatch
+	}
+	var data []byte
+	var release func()
+	if resp.Header.Get(DataResponseTransfer) != "" {
+		data, err = c.fetchTransfer(addr, resp, cancel)
+	} else if c.buffers != nil && resp.ContentLength >= 0 && resp.Header.Get("Content-Encoding") == "" {
+		data, release, err = c.readInto(to, req, resp)
+	} else {
+		data, err = readBody(resp)
+	}
 	if err != nil {
-		logger.Fatalf("http: ioutil.ReadAll(%v) returns error: %v", resp.Body, err)
+		// Reading is cut off by cancellation and timeouts too.
+		if canceled(cancel) {
+			return nil, ErrCanceled
+		}
+		return nil, err
 	}
 	return &DataResponse{
 		TaskID: to,
 		Epoch:  epoch,
 		Req:    req,
 		Data:   data,
+
+		ContentType: resp.Header.Get("Content-Type"),
+		Release:     release,
 	}, nil
 }
+
+// BufferFunc returns a buffer of size bytes at least to read the data of a
+// request to task to into, and the function releasing it, or a nil buffer for
+// the client to allocate one.
+type BufferFunc func(to uint64, req string, size int) (buf []byte, release func())
+
+// WithBuffers returns a copy of the client reading the data of responses
+// into buffers of fn, e.g. memory pinned through cgo, when their size is
+// known up front, i.e. they are neither compressed nor parallel transfers.
+func (c *Client) WithBuffers(fn BufferFunc) *Client {
+	cc := *c
+	cc.buffers = fn
+	return &cc
+}
+
+// readInto reads the body of resp into a buffer of the BufferFunc of the
+// client, which it releases if reading fails.
+func (c *Client) readInto(to uint64, req string, resp *http.Response) ([]byte, func(), error) {
+	size := int(resp.ContentLength)
+	buf, release := c.buffers(to, req, size)
+	if buf == nil {
+		data, err := readBody(resp)
+		return data, nil, err
+	}
+	if len(buf) < size {
+		if release != nil {
+			release()
+		}
+		return nil, nil, fmt.Errorf("frameworkhttp: buffer of %d bytes for %d bytes of data", len(buf), size)
+	}
+	if _, err := io.ReadFull(resp.Body, buf[:size]); err != nil {
+		if release != nil {
+			release()
+		}
+		return nil, nil, err
+	}
+	return buf[:size], release, nil
+}
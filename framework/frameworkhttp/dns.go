@@ -0,0 +1,158 @@
+package frameworkhttp
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DNSPolicy is how a client resolves the host names in the addresses of
+// tasks, e.g. of Kubernetes services, which resolve to other addresses once
+// pods are rescheduled.
+type DNSPolicy struct {
+	// MaxTTL is how long a name resolved is used at most before it is
+	// resolved again, 30s if 0. Connections kept alive to the old addresses of
+	// a name are closed once it resolves to others.
+	MaxTTL time.Duration
+	// DialTimeout is how long connecting to an address takes at most before
+	// the next address of the name is tried, 5s if 0.
+	DialTimeout time.Duration
+}
+
+func (p DNSPolicy) maxTTL() time.Duration {
+	if p.MaxTTL <= 0 {
+		return 30 * time.Second
+	}
+	return p.MaxTTL
+}
+
+func (p DNSPolicy) dialTimeout() time.Duration {
+	if p.DialTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return p.DialTimeout
+}
+
+// WithDNS returns a copy of the client resolving names with the policy
+// rather than leaving it to the resolver of the OS, whose cache might hold
+// stale addresses for longer. A request which fails to connect is retried
+// once with the name resolved again.
+func (c *Client) WithDNS(p DNSPolicy) *Client {
+	cc := *c
+	hc := *c.client
+	t := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if ht, ok := c.client.Transport.(*http.Transport); ok {
+		t.TLSClientConfig = ht.TLSClientConfig
+	}
+	r := newResolver(p, net.LookupHost)
+	r.changed = t.CloseIdleConnections
+	t.Dial = r.dial
+	hc.Transport = t
+	cc.client = &hc
+	cc.dns = r
+	return &cc
+}
+
+// resolver caches the addresses of names for at most the max TTL of its
+// policy.
+type resolver struct {
+	policy DNSPolicy
+	lookup func(host string) ([]string, error)
+	// changed is called once a name resolves to other addresses.
+	changed func()
+
+	mu    sync.Mutex
+	cache map[string]resolved
+}
+
+type resolved struct {
+	addrs []string
+	at    time.Time
+}
+
+func newResolver(p DNSPolicy, lookup func(host string) ([]string, error)) *resolver {
+	return &resolver{policy: p, lookup: lookup, cache: make(map[string]resolved)}
+}
+
+// resolve returns the addresses of host, which is returned as it is if it
+// is an IP address.
+func (r *resolver) resolve(host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	r.mu.Lock()
+	old, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Since(old.at) < r.policy.maxTTL() {
+		return old.addrs, nil
+	}
+	addrs, err := r.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cache[host] = resolved{addrs: addrs, at: time.Now()}
+	r.mu.Unlock()
+	if ok && !sameAddrs(old.addrs, addrs) && r.changed != nil {
+		r.changed()
+	}
+	return addrs, nil
+}
+
+// forget drops the addresses of the host of addr, so that it is resolved
+// again. It tells whether there were any.
+func (r *resolver) forget(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.cache[host]
+	delete(r.cache, host)
+	return ok
+}
+
+// dial connects to the first address of the host of addr which takes the
+// connection.
+func (r *resolver) dial(network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := r.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	err = &net.AddrError{Err: "no address", Addr: host}
+	for _, a := range addrs {
+		var conn net.Conn
+		if conn, err = net.DialTimeout(network, net.JoinHostPort(a, port), r.policy.dialTimeout()); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// dialFailed tells whether a request failed to connect to the server.
+func dialFailed(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	oe, ok := err.(*net.OpError)
+	return ok && oe.Op == "dial"
+}
+
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package frameworkhttp
+
+import (
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDNSReresolve moves the task behind a name to another address on the
+// same port, as a rescheduled pod behind a service, which the client finds by
+// resolving the name again once it fails to connect, long before the max TTL.
+func TestDNSReresolve(t *testing.T) {
+	a := startServerOn(t, "127.0.0.1:0")
+	_, port, _ := net.SplitHostPort(a.Listener.Addr().String())
+	var mu sync.Mutex
+	ip, lookups := "127.0.0.1", 0
+	c := DefaultClient.WithDNS(DNSPolicy{MaxTTL: time.Hour})
+	c.dns.lookup = func(host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		return []string{ip}, nil
+	}
+	get := func() error {
+		resp, err := c.get("http://task.svc:"+port+ProbePrefix, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if err := get(); err != nil || lookups != 1 {
+		t.Fatalf("second request = %v after %d lookups, want the cached address", err, lookups)
+	}
+
+	a.Close()
+	b := startServerOn(t, "127.0.0.2:"+port)
+	defer b.Close()
+	mu.Lock()
+	ip = "127.0.0.2"
+	mu.Unlock()
+	if err := get(); err != nil {
+		t.Fatalf("request after the move failed: %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("lookups = %d, want 2", lookups)
+	}
+}
+
+func startServerOn(t *testing.T, addr string) *httptest.Server {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("can't listen on %s: %v", addr, err)
+	}
+	s := httptest.NewUnstartedServer(NewProbeHandler())
+	s.Listener = ln
+	s.Start()
+	return s
+}
+
+func TestResolverMaxTTL(t *testing.T) {
+	addrs := []string{"10.0.0.1"}
+	r := newResolver(DNSPolicy{MaxTTL: time.Millisecond}, func(string) ([]string, error) { return addrs, nil })
+	changes := 0
+	r.changed = func() { changes++ }
+	if got, _ := r.resolve("task.svc"); got[0] != "10.0.0.1" {
+		t.Fatalf("resolve = %v, want 10.0.0.1", got)
+	}
+	addrs = []string{"10.0.0.2"}
+	time.Sleep(2 * time.Millisecond)
+	if got, _ := r.resolve("task.svc"); got[0] != "10.0.0.2" {
+		t.Errorf("resolve after max TTL = %v, want 10.0.0.2", got)
+	}
+	if changes != 1 {
+		t.Errorf("changes = %d, want 1", changes)
+	}
+	if got, _ := r.resolve("10.0.0.3"); got[0] != "10.0.0.3" {
+		t.Errorf("resolve of an IP = %v, want it as is", got)
+	}
+}
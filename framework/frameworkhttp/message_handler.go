@@ -0,0 +1,162 @@
+package frameworkhttp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// ErrWrongTask is returned for messages to a node which doesn't run the task
+// they are sent to, e.g. as the task has failed over to another node.
+var ErrWrongTask = errors.New("message error: wrong task")
+
+const (
+	MessagePrefix string = "/message"
+	MessageFrom   string = "from"
+	MessageTo     string = "to"
+	// MessageEpoch is the epoch of pushes, which messages don't have.
+	MessageEpoch string = "epoch"
+)
+
+// StatusTooEarly is the status of responses to pushes of an epoch the task
+// of the server hasn't started yet, for the client to retry later.
+const StatusTooEarly = 425
+
+// MessageReceiver takes the messages which tasks send to each other out of
+// the topology.
+type MessageReceiver interface {
+	ReceiveMessage(from, to uint64, payload []byte) error
+}
+
+// PushReceiver is a MessageReceiver taking pushes too, i.e. messages bound to
+// an epoch. It returns ErrReqEpochMismatch for pushes of an epoch which is
+// over, and ErrServerBusy for those of an epoch which hasn't started yet.
+type PushReceiver interface {
+	MessageReceiver
+	ReceivePush(from, to, epoch uint64, payload []byte) error
+}
+
+type messageHandler struct {
+	logger logging.Logger
+	MessageReceiver
+}
+
+func NewMessageHandler(logger logging.Logger, mr MessageReceiver) http.Handler {
+	return &messageHandler{
+		logger:          logger,
+		MessageReceiver: mr,
+	}
+}
+
+func (h *messageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != MessagePrefix {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	from, err := strconv.ParseUint(q.Get(MessageFrom), 10, 64)
+	if err != nil {
+		http.Error(w, "bad "+MessageFrom, http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.ParseUint(q.Get(MessageTo), 10, 64)
+	if err != nil {
+		http.Error(w, "bad "+MessageTo, http.StatusBadRequest)
+		return
+	}
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Errorf("http: message read failed: %v", err)
+		return
+	}
+
+	if epochStr := q.Get(MessageEpoch); epochStr != "" {
+		epoch, perr := strconv.ParseUint(epochStr, 10, 64)
+		if perr != nil {
+			http.Error(w, "bad "+MessageEpoch, http.StatusBadRequest)
+			return
+		}
+		pr, ok := h.MessageReceiver.(PushReceiver)
+		if !ok {
+			http.Error(w, "pushes not taken", http.StatusBadRequest)
+			return
+		}
+		err = pr.ReceivePush(from, to, epoch, payload)
+	} else {
+		err = h.ReceiveMessage(from, to, payload)
+	}
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrWrongTask:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case ErrServerClosed:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case ErrReqEpochMismatch:
+		http.Error(w, err.Error(), http.StatusGone)
+	case ErrServerBusy:
+		http.Error(w, err.Error(), StatusTooEarly)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SendMessage sends the payload of task from to task to, whose node serves
+// on addr. It returns once the node has taken the message.
+func (c *Client) SendMessage(addr string, from, to uint64, payload []byte) error {
+	return c.sendMessage(addr, from, to, nil, payload)
+}
+
+// Push sends the payload of task from at the epoch to task to, whose node
+// serves on addr. It returns once the node has taken the push, or with
+// ErrReqEpochMismatch if the task has moved past the epoch, or ErrServerBusy
+// if it hasn't started it yet.
+func (c *Client) Push(addr string, from, to, epoch uint64, payload []byte) error {
+	return c.sendMessage(addr, from, to, &epoch, payload)
+}
+
+// sendMessage sends a message, or a push if epoch isn't nil.
+func (c *Client) sendMessage(addr string, from, to uint64, epoch *uint64, payload []byte) error {
+	u := url.URL{
+		Scheme: c.scheme,
+		Host:   addr,
+		Path:   MessagePrefix,
+	}
+	q := u.Query()
+	q.Add(MessageFrom, strconv.FormatUint(from, 10))
+	q.Add(MessageTo, strconv.FormatUint(to, 10))
+	if epoch != nil {
+		q.Add(MessageEpoch, strconv.FormatUint(*epoch, 10))
+	}
+	u.RawQuery = q.Encode()
+	resp, err := c.post(u.String(), payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusConflict:
+		return ErrWrongTask
+	case http.StatusServiceUnavailable:
+		return ErrServerClosed
+	case http.StatusGone:
+		return ErrReqEpochMismatch
+	case StatusTooEarly:
+		return ErrServerBusy
+	}
+	b, _ := readBody(resp)
+	return errors.New("message error: " + resp.Status + ": " + string(bytes.TrimSpace(b)))
+}
@@ -0,0 +1,125 @@
+package frameworkhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type message struct {
+	from, to uint64
+	payload  string
+}
+
+// fakeReceiver runs task 1 and keeps the messages it takes.
+type fakeReceiver struct {
+	messages []message
+}
+
+func (r *fakeReceiver) ReceiveMessage(from, to uint64, payload []byte) error {
+	if to != 1 {
+		return ErrWrongTask
+	}
+	r.messages = append(r.messages, message{from, to, string(payload)})
+	return nil
+}
+
+func TestMessageHandler(t *testing.T) {
+	r := &fakeReceiver{}
+	h := NewMessageHandler(testLogger(), r)
+	tests := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{"POST", "/message?from=0&to=1", http.StatusNoContent},
+		{"POST", "/message?from=0&to=2", http.StatusConflict},
+		{"POST", "/message?from=x&to=1", http.StatusBadRequest},
+		{"GET", "/message?from=0&to=1", http.StatusMethodNotAllowed},
+		{"POST", "/message/1", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader("shard"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("#%d: code = %d, want %d", i, w.Code, tt.code)
+		}
+	}
+	if want := []message{{0, 1, "shard"}}; !reflect.DeepEqual(r.messages, want) {
+		t.Errorf("messages = %v, want %v", r.messages, want)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	r := &fakeReceiver{}
+	h := NewMessageHandler(testLogger(), r)
+	s := httptest.NewServer(RequireToken("secret", h))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	c := DefaultClient.WithToken("secret")
+	if err := c.SendMessage(addr, 2, 1, []byte("shard")); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if err := c.SendMessage(addr, 2, 3, []byte("shard")); err != ErrWrongTask {
+		t.Errorf("SendMessage to the wrong task = %v, want %v", err, ErrWrongTask)
+	}
+	if err := DefaultClient.SendMessage(addr, 2, 1, []byte("shard")); err != ErrUnauthorized {
+		t.Errorf("SendMessage without token = %v, want %v", err, ErrUnauthorized)
+	}
+	if want := []message{{2, 1, "shard"}}; !reflect.DeepEqual(r.messages, want) {
+		t.Errorf("messages = %v, want %v", r.messages, want)
+	}
+}
+
+// fakePushReceiver runs task 1 at epoch 2.
+type fakePushReceiver struct {
+	fakeReceiver
+}
+
+func (r *fakePushReceiver) ReceivePush(from, to, epoch uint64, payload []byte) error {
+	switch {
+	case epoch < 2:
+		return ErrReqEpochMismatch
+	case epoch > 2:
+		return ErrServerBusy
+	}
+	return r.ReceiveMessage(from, to, payload)
+}
+
+func TestPush(t *testing.T) {
+	r := &fakePushReceiver{}
+	s := httptest.NewServer(NewMessageHandler(testLogger(), r))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	tests := []struct {
+		to, epoch uint64
+		want      error
+	}{
+		{1, 2, nil},
+		{1, 1, ErrReqEpochMismatch},
+		{1, 3, ErrServerBusy},
+		{2, 2, ErrWrongTask},
+	}
+	for i, tt := range tests {
+		if err := DefaultClient.Push(addr, 0, tt.to, tt.epoch, []byte("grad")); err != tt.want {
+			t.Errorf("#%d: Push = %v, want %v", i, err, tt.want)
+		}
+	}
+	if want := []message{{0, 1, "grad"}}; !reflect.DeepEqual(r.messages, want) {
+		t.Errorf("pushes = %v, want %v", r.messages, want)
+	}
+	// Servers without pushes turn them away.
+	s2 := httptest.NewServer(NewMessageHandler(testLogger(), &fakeReceiver{}))
+	defer s2.Close()
+	if err := DefaultClient.Push(strings.TrimPrefix(s2.URL, "http://"), 0, 1, 2, []byte("grad")); err == nil {
+		t.Errorf("Push to a server without pushes succeeded")
+	}
+}
@@ -0,0 +1,94 @@
+package frameworkhttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+var ErrNotObservable error = errors.New("observe request error: task is not observable")
+
+const (
+	ObserveRequestPrefix string = "/observe"
+	ObserveRequestReq    string = "req"
+)
+
+type ObservableDataGetter interface {
+	GetObservableData(string) ([]byte, error)
+}
+
+type observeReqHandler struct {
+	logger logging.Logger
+	ObservableDataGetter
+}
+
+func NewObserveRequestHandler(logger logging.Logger, dg ObservableDataGetter) http.Handler {
+	return &observeReqHandler{
+		logger:               logger,
+		ObservableDataGetter: dg,
+	}
+}
+
+func (h *observeReqHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ObserveRequestPrefix {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	req := r.URL.Query().Get(ObserveRequestReq)
+	b, err := h.GetObservableData(req)
+	if err != nil {
+		switch err {
+		case ErrNotObservable:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		h.logger.Errorf("http: response write failed: %v", err)
+	}
+}
+
+// RequestObservableData fetches data exposed by the task served at addr.
+// Unlike RequestData, it doesn't carry a task ID or an epoch, because the
+// requester is not part of the topology.
+// RequestObservableData requests data from an observable task with
+// DefaultClient.
+func RequestObservableData(addr string, req string) ([]byte, error) {
+	return DefaultClient.RequestObservableData(addr, req)
+}
+
+func (c *Client) RequestObservableData(addr string, req string) ([]byte, error) {
+	u := url.URL{
+		Scheme: c.scheme,
+		Host:   addr,
+		Path:   ObserveRequestPrefix,
+	}
+	q := u.Query()
+	q.Add(ObserveRequestReq, req)
+	u.RawQuery = q.Encode()
+	resp, err := c.get(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, ErrNotObservable
+	case http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	default:
+		return nil, fmt.Errorf("observe request error: %s", strings.TrimSpace(string(data)))
+	}
+}
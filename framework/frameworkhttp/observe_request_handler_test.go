@@ -0,0 +1,65 @@
+package frameworkhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeObservable map[string][]byte
+
+func (o fakeObservable) GetObservableData(req string) ([]byte, error) {
+	switch req {
+	case "unobservable":
+		return nil, ErrNotObservable
+	case "broken":
+		return nil, errors.New("broken")
+	}
+	return o[req], nil
+}
+
+func TestObserveRequestHandler(t *testing.T) {
+	h := NewObserveRequestHandler(testLogger(), fakeObservable{"model": []byte("weights")})
+	tests := []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/observe?req=model", http.StatusOK, "weights"},
+		{"/observe?req=unobservable", http.StatusNotFound, ErrNotObservable.Error() + "\n"},
+		{"/observe?req=broken", http.StatusInternalServerError, "broken\n"},
+		{"/observe/model", http.StatusBadRequest, "bad path\n"},
+	}
+	for i, tt := range tests {
+		r, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("#%d: response want = (%d, %q), get = (%d, %q)", i, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRequestObservableData(t *testing.T) {
+	h := NewObserveRequestHandler(testLogger(), fakeObservable{"model": []byte("weights")})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	d, err := RequestObservableData(addr, "model")
+	if err != nil || !reflect.DeepEqual(d, []byte("weights")) {
+		t.Errorf("RequestObservableData(model) = (%q, %v)", d, err)
+	}
+	if _, err := RequestObservableData(addr, "unobservable"); err != ErrNotObservable {
+		t.Errorf("err want = %v, get = %v", ErrNotObservable, err)
+	}
+	if _, err := RequestObservableData(addr, "broken"); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("err want = broken, get = %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package frameworkhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrChecksumMismatch is returned for parallel transfers with a chunk which
+// doesn't match its checksum after retries.
+var ErrChecksumMismatch = errors.New("data request error: chunk checksum mismatch")
+
+const (
+	// DataRequestStreams is the header of data requests whose client may
+	// fetch a large response over that many parallel streams.
+	DataRequestStreams string = "X-Meritop-Streams"
+	// DataRequestChunkSize is the header of data requests whose client takes
+	// chunks of transfers of up to that many bytes, see chunkSizes.
+	DataRequestChunkSize string = "X-Meritop-Chunk-Size"
+	// DataResponseTransfer is the header of responses sent as a parallel
+	// transfer, whose body is the manifest of its chunks.
+	DataResponseTransfer string = "X-Meritop-Transfer"
+	// Chunks of transfers are requested with the ID of the transfer and
+	// their range of bytes.
+	DataRequestTransfer string = "transfer"
+	DataRequestOffset   string = "offset"
+	DataRequestEnd      string = "end"
+
+	// maxStreams caps the streams a transfer is fetched over.
+	maxStreams = 16
+	// maxChunks caps the chunks a transfer is split into.
+	maxChunks = 4096
+	// The chunk size of a link starts at initialChunkSize, grows by
+	// chunkSizeStep with every chunk fetched and halves with every chunk
+	// failed, between minChunkSize and maxChunkSize.
+	initialChunkSize = 1 << 20
+	chunkSizeStep    = 256 << 10
+	minChunkSize     = 64 << 10
+	maxChunkSize     = 64 << 20
+	// chunkAttempts is how many times a client fetches a chunk which doesn't
+	// match its checksum.
+	chunkAttempts = 2
+)
+
+// transferTTL is how long a server keeps the data of a transfer its client
+// doesn't delete, e.g. as it failed.
+var transferTTL = time.Minute
+
+// transferManifest splits the data of a transfer into chunks of ChunkSize,
+// the last one shorter, with the CRC-32 (IEEE) checksum of each.
+type transferManifest struct {
+	Size      int
+	ChunkSize int
+	Checksums []uint32
+}
+
+type transfer struct {
+	data    []byte
+	expires time.Time
+}
+
+type transfers struct {
+	mu     sync.Mutex
+	lastID uint64
+	m      map[uint64]*transfer
+}
+
+func (ts *transfers) add(data []byte) uint64 {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	now := time.Now()
+	for id, t := range ts.m {
+		if now.After(t.expires) {
+			delete(ts.m, id)
+		}
+	}
+	ts.lastID++
+	ts.m[ts.lastID] = &transfer{data: data, expires: now.Add(transferTTL)}
+	return ts.lastID
+}
+
+func (ts *transfers) get(id uint64) ([]byte, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t, ok := ts.m[id]
+	if !ok {
+		return nil, false
+	}
+	return t.data, true
+}
+
+func (ts *transfers) remove(id uint64) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.m, id)
+}
+
+// Parallel sends successful responses of h of at least minSize bytes as
+// parallel transfers to clients asking for them, see WithParallelStreams. A
+// single TCP stream often can't fill a fast link, so the client fetches the
+// chunks of the response over parallel streams, checks them against their
+// checksums and reassembles them. A transfer has a chunk for each stream, or
+// more if they'd be larger than the chunk size the client asks for. The data
+// of a transfer is kept until the client deletes it, or for a minute at most.
+func Parallel(h http.Handler, minSize int) http.Handler {
+	ts := &transfers{m: make(map[uint64]*transfer)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if idStr := q.Get(DataRequestTransfer); idStr != "" {
+			serveChunk(ts, w, r, idStr)
+			return
+		}
+		streams, _ := strconv.Atoi(r.Header.Get(DataRequestStreams))
+		if streams < 2 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if streams > maxStreams {
+			streams = maxStreams
+		}
+		rec := &recorder{header: make(http.Header), code: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		data := rec.body.Bytes()
+		if rec.code != http.StatusOK || len(data) < minSize {
+			w.WriteHeader(rec.code)
+			w.Write(data)
+			return
+		}
+		m := transferManifest{Size: len(data), ChunkSize: (len(data) + streams - 1) / streams}
+		if size, err := strconv.Atoi(r.Header.Get(DataRequestChunkSize)); err == nil && size > 0 && size < m.ChunkSize {
+			m.ChunkSize = maxInt(size, (len(data)+maxChunks-1)/maxChunks)
+		}
+		for off := 0; off < len(data); off += m.ChunkSize {
+			m.Checksums = append(m.Checksums, crc32.ChecksumIEEE(data[off:minInt(off+m.ChunkSize, len(data))]))
+		}
+		w.Header().Set(DataResponseTransfer, strconv.FormatUint(ts.add(data), 10))
+		w.Header().Del("Content-Length")
+		json.NewEncoder(w).Encode(m)
+	})
+}
+
+// serveChunk serves a chunk of a transfer, or deletes the transfer.
+func serveChunk(ts *transfers, w http.ResponseWriter, r *http.Request, idStr string) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "bad transfer", http.StatusBadRequest)
+		return
+	}
+	if r.Method == "DELETE" {
+		ts.remove(id)
+		return
+	}
+	data, ok := ts.get(id)
+	if !ok {
+		http.Error(w, "no transfer", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	off, err := strconv.Atoi(q.Get(DataRequestOffset))
+	end, err2 := strconv.Atoi(q.Get(DataRequestEnd))
+	if err != nil || err2 != nil || off < 0 || off > end || end > len(data) {
+		http.Error(w, "bad chunk", http.StatusBadRequest)
+		return
+	}
+	w.Write(data[off:end])
+}
+
+// recorder keeps a response to send it later.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(code int) { r.code = code }
+
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// chunkSizes adapts the chunk size of transfers per link, i.e. address of the
+// server, like TCP its congestion window: additively increased with every
+// chunk fetched, halved with every chunk failed or timed out. Fast links take
+// large chunks without hand-tuning, and lossy ones back off quickly.
+type chunkSizes struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func (cs *chunkSizes) get(addr string) int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if size, ok := cs.m[addr]; ok {
+		return size
+	}
+	return initialChunkSize
+}
+
+// observe adapts the chunk size of the link to a chunk fetched, or failed
+// with err.
+func (cs *chunkSizes) observe(addr string, err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	size, ok := cs.m[addr]
+	if !ok {
+		size = initialChunkSize
+	}
+	if err == nil {
+		size = minInt(size+chunkSizeStep, maxChunkSize)
+	} else {
+		size = maxInt(size/2, minChunkSize)
+	}
+	cs.m[addr] = size
+}
+
+// WithParallelStreams returns a copy of the client fetching large data
+// responses over n parallel streams, from servers wrapped with Parallel. The
+// chunks of transfers are sized per link, see chunkSizes.
+func (c *Client) WithParallelStreams(n int) *Client {
+	cc := *c
+	cc.streams = n
+	cc.chunkSizes = &chunkSizes{m: make(map[string]int)}
+	return &cc
+}
+
+// fetchTransfer fetches the chunks of the transfer of the response in
+// parallel, and reassembles them.
+func (c *Client) fetchTransfer(addr string, resp *http.Response, cancel <-chan struct{}) ([]byte, error) {
+	id := resp.Header.Get(DataResponseTransfer)
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	var m transferManifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	u := url.URL{Scheme: c.scheme, Host: addr, Path: DataRequestPrefix}
+	defer func() {
+		q := url.Values{DataRequestTransfer: {id}}
+		u.RawQuery = q.Encode()
+		if req, err := c.newRequest("DELETE", u.String(), nil); err == nil {
+			if resp, err := c.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	// The streams fetch the chunks in turn.
+	chunks := make(chan int, len(m.Checksums))
+	for i := range m.Checksums {
+		chunks <- i
+	}
+	close(chunks)
+	streams := maxInt(minInt(c.streams, len(m.Checksums)), 1)
+	data := make([]byte, m.Size)
+	errs := make(chan error, streams)
+	for s := 0; s < streams; s++ {
+		go func() {
+			for i := range chunks {
+				off := i * m.ChunkSize
+				end := minInt(off+m.ChunkSize, m.Size)
+				q := url.Values{
+					DataRequestTransfer: {id},
+					DataRequestOffset:   {strconv.Itoa(off)},
+					DataRequestEnd:      {strconv.Itoa(end)},
+				}
+				cu := u
+				cu.RawQuery = q.Encode()
+				err := c.fetchChunk(cu.String(), data[off:end], m.Checksums[i], cancel)
+				if err != ErrCanceled && c.chunkSizes != nil {
+					c.chunkSizes.observe(addr, err)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for s := 0; s < streams; s++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetchChunk fetches a chunk into chunk, until it matches its checksum.
+func (c *Client) fetchChunk(urlStr string, chunk []byte, sum uint32, cancel <-chan struct{}) error {
+	for i := 0; i < chunkAttempts; i++ {
+		resp, err := c.get(urlStr, cancel)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("frameworkhttp: chunk response code = %d, expect = %d", resp.StatusCode, 200)
+		}
+		b, err := readBody(resp)
+		resp.Body.Close()
+		if err != nil {
+			if canceled(cancel) {
+				return ErrCanceled
+			}
+			return err
+		}
+		if len(b) == len(chunk) && crc32.ChecksumIEEE(b) == sum {
+			copy(chunk, b)
+			return nil
+		}
+	}
+	return ErrChecksumMismatch
+}
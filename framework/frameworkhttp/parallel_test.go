@@ -0,0 +1,188 @@
+package frameworkhttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallelTransfer(t *testing.T) {
+	logger := testLogger()
+	var mu sync.Mutex
+	chunks := 0
+	transfer := Parallel(NewDataRequestHandler(logger, repeatDataGetter{}), 2000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(DataRequestOffset) != "" {
+			mu.Lock()
+			chunks++
+			mu.Unlock()
+		}
+		transfer.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	tests := []struct {
+		streams int
+		req     string
+		chunks  int
+	}{
+		{0, "large", 0},
+		{4, "large", 4},
+		// Responses below the minimum size go whole.
+		{4, "s", 0},
+		{100, "large", maxStreams},
+	}
+	for i, tt := range tests {
+		chunks = 0
+		c := DefaultClient.WithParallelStreams(tt.streams)
+		d, err := c.RequestData(addr, tt.req, 1, 0, 0, logger)
+		if err != nil {
+			t.Fatalf("#%d: RequestData failed: %v", i, err)
+		}
+		if want := bytes.Repeat([]byte(tt.req), 1000); !bytes.Equal(d.Data, want) {
+			t.Errorf("#%d: data of %d bytes, want %d", i, len(d.Data), len(want))
+		}
+		if chunks != tt.chunks {
+			t.Errorf("#%d: chunks = %d, want %d", i, chunks, tt.chunks)
+		}
+	}
+
+	// Transfers are deleted once fetched.
+	resp, err := http.Get(s.URL + DataRequestPrefix + "?transfer=1&offset=0&end=1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status of deleted transfer = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestParallelTransferChecksum(t *testing.T) {
+	logger := testLogger()
+	transfer := Parallel(NewDataRequestHandler(logger, repeatDataGetter{}), 0)
+	// Corrupt the first byte of every chunk.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(DataRequestOffset) == "" {
+			transfer.ServeHTTP(w, r)
+			return
+		}
+		rec := &recorder{header: make(http.Header), code: http.StatusOK}
+		transfer.ServeHTTP(rec, r)
+		b := rec.body.Bytes()
+		b[0]++
+		w.Write(b)
+	}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	c := DefaultClient.WithParallelStreams(2)
+	if _, err := c.RequestData(addr, "x", 1, 0, 0, logger); err != ErrChecksumMismatch {
+		t.Errorf("err = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestChunkSizes(t *testing.T) {
+	cs := &chunkSizes{m: make(map[string]int)}
+	if size := cs.get("a"); size != initialChunkSize {
+		t.Errorf("initial size = %d, want %d", size, initialChunkSize)
+	}
+	cs.observe("a", nil)
+	cs.observe("a", nil)
+	if size, want := cs.get("a"), initialChunkSize+2*chunkSizeStep; size != want {
+		t.Errorf("size after 2 chunks = %d, want %d", size, want)
+	}
+	cs.observe("a", ErrChecksumMismatch)
+	if size, want := cs.get("a"), (initialChunkSize+2*chunkSizeStep)/2; size != want {
+		t.Errorf("size after a failed chunk = %d, want %d", size, want)
+	}
+	if size := cs.get("b"); size != initialChunkSize {
+		t.Errorf("size of another link = %d, want %d", size, initialChunkSize)
+	}
+	for i := 0; i < 100; i++ {
+		cs.observe("a", ErrChecksumMismatch)
+	}
+	if size := cs.get("a"); size != minChunkSize {
+		t.Errorf("size after failed chunks = %d, want %d", size, minChunkSize)
+	}
+	for i := 0; i < maxChunkSize/chunkSizeStep; i++ {
+		cs.observe("a", nil)
+	}
+	if size := cs.get("a"); size != maxChunkSize {
+		t.Errorf("size after chunks = %d, want %d", size, maxChunkSize)
+	}
+}
+
+// The chunks of transfers grow while they are fetched, and shrink as they
+// time out.
+func TestParallelTransferChunkSize(t *testing.T) {
+	logger := testLogger()
+	var mu sync.Mutex
+	chunks, asked := 0, ""
+	slow := false
+	transfer := Parallel(NewDataRequestHandler(logger, repeatDataGetter{}), 0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		mu.Lock()
+		switch {
+		case q.Get(DataRequestTransfer) == "":
+			asked = r.Header.Get(DataRequestChunkSize)
+		case q.Get(DataRequestOffset) != "":
+			chunks++
+		}
+		delay := slow
+		mu.Unlock()
+		if delay && q.Get(DataRequestOffset) != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		transfer.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+	c := DefaultClient.WithParallelStreams(2)
+	// 4096000 bytes, in chunks of at most half of it
+	req := strings.Repeat("x", 4096)
+	fetch := func(c *Client) (int, string, error) {
+		mu.Lock()
+		chunks = 0
+		mu.Unlock()
+		_, err := c.RequestData(addr, req, 1, 0, 0, logger)
+		mu.Lock()
+		defer mu.Unlock()
+		return chunks, asked, err
+	}
+
+	n, size, err := fetch(c)
+	if err != nil || n != 4 || size != strconv.Itoa(initialChunkSize) {
+		t.Fatalf("first transfer: %d chunks of %s bytes, err %v, want 4 of %d", n, size, err, initialChunkSize)
+	}
+	grown := initialChunkSize + 4*chunkSizeStep
+	if got := c.chunkSizes.get(addr); got != grown {
+		t.Fatalf("size after 4 chunks = %d, want %d", got, grown)
+	}
+
+	mu.Lock()
+	slow = true
+	mu.Unlock()
+	if _, _, err := fetch(c.WithTimeout(50 * time.Millisecond)); err == nil {
+		t.Fatalf("transfer of chunks timing out succeeded")
+	}
+	// Each stream failed a chunk.
+	if got := c.chunkSizes.get(addr); got != grown/4 {
+		t.Fatalf("size after 2 chunks timed out = %d, want %d", got, grown/4)
+	}
+
+	mu.Lock()
+	slow = false
+	mu.Unlock()
+	n, size, err = fetch(c)
+	if want := (4096000 + grown/4 - 1) / (grown / 4); err != nil || n != want || size != strconv.Itoa(grown/4) {
+		t.Errorf("transfer after timeouts: %d chunks of %s bytes, err %v, want %d of %d", n, size, err, want, grown/4)
+	}
+}
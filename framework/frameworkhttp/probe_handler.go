@@ -0,0 +1,76 @@
+package frameworkhttp
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	ProbePrefix string = "/probe"
+	ProbeSize   string = "size"
+	// Larger probes are refused, so that probing can't be used to load nodes.
+	MaxProbeSize = 16 << 20
+)
+
+// LinkStatus is the baseline quality of a link to a neighbor, measured when
+// the task starts.
+type LinkStatus struct {
+	TaskID   uint64 `json:"taskID"`
+	LinkType string `json:"linkType"`
+	// Round trip time of a small request.
+	LatencyNs int64 `json:"latencyNs"`
+	// Throughput of a large response.
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+}
+
+// NewProbeHandler responds with as many bytes as requested.
+func NewProbeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.Atoi(r.URL.Query().Get(ProbeSize))
+		if err != nil || size < 0 || size > MaxProbeSize {
+			http.Error(w, "bad probe size", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		io.CopyN(w, zeros{}, int64(size))
+	})
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Probe requests size bytes from the node at addr with DefaultClient, and
+// returns how long it takes.
+func Probe(addr string, size int) (time.Duration, error) {
+	return DefaultClient.Probe(addr, size)
+}
+
+func (c *Client) Probe(addr string, size int) (time.Duration, error) {
+	start := time.Now()
+	resp, err := c.get(fmt.Sprintf("%s://%s%s?%s=%d", c.scheme, addr, ProbePrefix, ProbeSize, size), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("probe: response code = %d", resp.StatusCode)
+	}
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if n != int64(size) {
+		return 0, fmt.Errorf("probe: got %d bytes, want %d", n, size)
+	}
+	return time.Since(start), nil
+}
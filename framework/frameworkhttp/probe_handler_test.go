@@ -0,0 +1,30 @@
+package frameworkhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProbe(t *testing.T) {
+	s := httptest.NewServer(NewProbeHandler())
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	for _, size := range []int{0, 64, 1 << 20} {
+		if _, err := Probe(addr, size); err != nil {
+			t.Errorf("Probe(%d) failed: %v", size, err)
+		}
+	}
+	if _, err := Probe(addr, MaxProbeSize+1); err == nil {
+		t.Errorf("Probe beyond max size should fail")
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", ProbePrefix+"?size=x", nil)
+	NewProbeHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad size: code want = %d, get = %d", http.StatusBadRequest, w.Code)
+	}
+}
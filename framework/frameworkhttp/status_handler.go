@@ -0,0 +1,41 @@
+package frameworkhttp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	StatusPrefix string = "/status"
+	// Metrics are served in the Prometheus text format by pkg/metrics.
+	MetricsPrefix string = "/metrics"
+)
+
+// NodeStatus is what a framework node reports for debugging and monitoring.
+type NodeStatus struct {
+	TaskID     uint64 `json:"taskID"`
+	Epoch      uint64 `json:"epoch"`
+	NumOfTasks uint64 `json:"numOfTasks"`
+	// Data requests sent by this task and waiting for response.
+	PendingDataRequests int64 `json:"pendingDataRequests"`
+	// Data requests from other tasks being served by this task.
+	ServingDataRequests int64  `json:"servingDataRequests"`
+	DataRequestsSent    uint64 `json:"dataRequestsSent"`
+	DataRequestsServed  uint64 `json:"dataRequestsServed"`
+	BytesSent           uint64 `json:"bytesSent"`
+	BytesReceived       uint64 `json:"bytesReceived"`
+	// Baseline of links to neighbors, if probed at warm-up.
+	Links []LinkStatus `json:"links,omitempty"`
+}
+
+type StatusGetter interface {
+	GetStatus() NodeStatus
+}
+
+// NewStatusHandler serves the node status as JSON.
+func NewStatusHandler(sg StatusGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sg.GetStatus())
+	})
+}
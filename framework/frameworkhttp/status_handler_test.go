@@ -0,0 +1,28 @@
+package frameworkhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type fakeStatusGetter NodeStatus
+
+func (g fakeStatusGetter) GetStatus() NodeStatus { return NodeStatus(g) }
+
+func TestStatusHandler(t *testing.T) {
+	sg := fakeStatusGetter{TaskID: 3, Epoch: 7, PendingDataRequests: 2, BytesReceived: 1024,
+		Links: []LinkStatus{{TaskID: 1, LinkType: "parent", LatencyNs: 300, BytesPerSecond: 1e8}}}
+
+	w := httptest.NewRecorder()
+	NewStatusHandler(sg).ServeHTTP(w, &http.Request{})
+	var s NodeStatus
+	if err := json.NewDecoder(w.Body).Decode(&s); err != nil {
+		t.Fatalf("decode status failed: %v", err)
+	}
+	if !reflect.DeepEqual(s, NodeStatus(sg)) {
+		t.Errorf("status = %+v, want %+v", s, sg)
+	}
+}
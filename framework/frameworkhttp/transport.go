@@ -0,0 +1,264 @@
+package frameworkhttp
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnauthorized is returned for requests without the token of the job.
+var ErrUnauthorized = errors.New("request error: unauthorized")
+
+// ErrCanceled is returned for requests canceled before they are responded.
+var ErrCanceled = errors.New("request error: canceled")
+
+// Client sends requests to the HTTP servers of tasks.
+type Client struct {
+	scheme    string
+	client    *http.Client
+	token     string
+	encodings []string
+	accept    []string
+	streams   int
+	buffers   BufferFunc
+	dns       *resolver
+
+	// chunk sizes of transfers per link, with parallel streams
+	chunkSizes *chunkSizes
+}
+
+// DefaultClient speaks plain HTTP.
+var DefaultClient = NewClient(nil)
+
+// NewClient returns a client speaking HTTPS with given TLS config, or plain
+// HTTP if it is nil.
+func NewClient(tlsConfig *tls.Config) *Client {
+	if tlsConfig == nil {
+		return &Client{scheme: "http", client: http.DefaultClient}
+	}
+	return &Client{
+		scheme: "https",
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}
+}
+
+// WithToken returns a copy of the client sending the token with requests,
+// for servers wrapped with RequireToken.
+func (c *Client) WithToken(token string) *Client {
+	cc := *c
+	cc.token = token
+	return &cc
+}
+
+// WithAccept returns a copy of the client accepting typed data of the
+// content types, in order of preference.
+func (c *Client) WithAccept(contentTypes ...string) *Client {
+	cc := *c
+	cc.accept = contentTypes
+	return &cc
+}
+
+// WithTimeout returns a copy of the client giving up requests which aren't
+// responded within d, e.g. as the server hangs.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	cc := *c
+	hc := *c.client
+	hc.Timeout = d
+	cc.client = &hc
+	return &cc
+}
+
+// get sends a GET request, which is canceled once cancel is closed, unless
+// it is nil. Reading the body of the response is canceled too, until it is
+// closed.
+func (c *Client) get(url string, cancel <-chan struct{}) (*http.Response, error) {
+	req, err := c.newRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.encodings) > 0 {
+		req.Header.Set("Accept-Encoding", strings.Join(c.encodings, ", "))
+	}
+	if len(c.accept) > 0 {
+		req.Header.Set("Accept", strings.Join(c.accept, ", "))
+	}
+	if c.streams > 1 {
+		req.Header.Set(DataRequestStreams, strconv.Itoa(c.streams))
+		if c.chunkSizes != nil {
+			req.Header.Set(DataRequestChunkSize, strconv.Itoa(c.chunkSizes.get(req.URL.Host)))
+		}
+	}
+	resp, err := c.do(req, cancel)
+	if err != nil && dialFailed(err) && c.dns != nil && c.dns.forget(req.URL.Host) {
+		// The name might resolve to another address by now, e.g. of a
+		// rescheduled pod.
+		resp, err = c.do(req, cancel)
+	}
+	return resp, err
+}
+
+// do sends the request, which is canceled once cancel is closed, unless it is
+// nil.
+func (c *Client) do(req *http.Request, cancel <-chan struct{}) (*http.Response, error) {
+	t := c.client.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	rc, ok := t.(requestCanceler)
+	if cancel == nil || !ok {
+		return c.client.Do(req)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			rc.CancelRequest(req)
+		case <-done:
+		}
+	}()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		close(done)
+		if canceled(cancel) {
+			return nil, ErrCanceled
+		}
+		return nil, err
+	}
+	resp.Body = &cancelableBody{ReadCloser: resp.Body, done: done}
+	return resp, nil
+}
+
+// post sends a POST request with the body.
+func (c *Client) post(url string, body []byte) (*http.Response, error) {
+	req, err := c.newRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return c.client.Do(req)
+}
+
+// newRequest returns a request carrying the token of the client, if any.
+func (c *Client) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+type requestCanceler interface {
+	CancelRequest(*http.Request)
+}
+
+func canceled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// cancelableBody stops watching for cancellation once it is closed.
+type cancelableBody struct {
+	io.ReadCloser
+	done chan struct{}
+	once sync.Once
+}
+
+func (b *cancelableBody) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return b.ReadCloser.Close()
+}
+
+// RequireToken serves only requests carrying "Authorization: Bearer {token}",
+// so that processes outside of the job can't request data from tasks.
+func RequireToken(token string, h http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// TLSInfo names the PEM files securing the HTTP transport between tasks, so
+// that data exchanged by tasks isn't exposed on shared clusters. All tasks of
+// a job should share the CA.
+type TLSInfo struct {
+	CertFile string
+	KeyFile  string
+	// CAFile verifies the certificates of the other side. Without it, servers
+	// are verified with the CAs of the system.
+	CAFile string
+	// ClientCertAuth makes servers require client certificates signed by the
+	// CA, i.e. mutual TLS. Clients then present CertFile.
+	ClientCertAuth bool
+}
+
+// ServerConfig returns the TLS config of the servers of tasks.
+func (info TLSInfo) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(info.CertFile, info.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if !info.ClientCertAuth {
+		return cfg, nil
+	}
+	if info.CAFile == "" {
+		return nil, errors.New("frameworkhttp: client cert auth needs a CA file")
+	}
+	if cfg.ClientCAs, err = loadCA(info.CAFile); err != nil {
+		return nil, err
+	}
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// ClientConfig returns the TLS config of tasks requesting other tasks.
+func (info TLSInfo) ClientConfig() (*tls.Config, error) {
+	cfg := new(tls.Config)
+	if info.ClientCertAuth {
+		cert, err := tls.LoadX509KeyPair(info.CertFile, info.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if info.CAFile != "" {
+		var err error
+		if cfg.RootCAs, err = loadCA(info.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func loadCA(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("frameworkhttp: no certificate in CA file %s", file)
+	}
+	return pool, nil
+}
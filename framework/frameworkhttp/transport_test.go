@@ -0,0 +1,321 @@
+package frameworkhttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frameworkhttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	info := writeTestCerts(t, dir)
+
+	serverConfig, err := info.ServerConfig()
+	if err != nil {
+		t.Fatalf("ServerConfig failed: %v", err)
+	}
+	s := httptest.NewUnstartedServer(NewProbeHandler())
+	s.TLS = serverConfig
+	s.StartTLS()
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "https://")
+
+	clientConfig, err := info.ClientConfig()
+	if err != nil {
+		t.Fatalf("ClientConfig failed: %v", err)
+	}
+	if _, err := NewClient(clientConfig).Probe(addr, 10); err != nil {
+		t.Errorf("Probe with client cert failed: %v", err)
+	}
+
+	info.ClientCertAuth = false
+	clientConfig, err = info.ClientConfig()
+	if err != nil {
+		t.Fatalf("ClientConfig failed: %v", err)
+	}
+	if _, err := NewClient(clientConfig).Probe(addr, 10); err == nil {
+		t.Errorf("Probe without client cert succeeded")
+	}
+	if _, err := DefaultClient.Probe(addr, 10); err == nil {
+		t.Errorf("Probe over plain HTTP succeeded")
+	}
+}
+
+// writeTestCerts writes a CA, and a certificate signed by it for 127.0.0.1
+// used by both servers and clients.
+func writeTestCerts(t *testing.T, dir string) TLSInfo {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "meritop test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "task"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := TLSInfo{
+		CertFile:       filepath.Join(dir, "task.pem"),
+		KeyFile:        filepath.Join(dir, "task-key.pem"),
+		CAFile:         filepath.Join(dir, "ca.pem"),
+		ClientCertAuth: true,
+	}
+	for file, block := range map[string]*pem.Block{
+		info.CAFile:   {Type: "CERTIFICATE", Bytes: caDER},
+		info.CertFile: {Type: "CERTIFICATE", Bytes: certDER},
+		info.KeyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return info
+}
+
+type fakeDataGetter struct{}
+
+func (fakeDataGetter) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	return []byte(req), nil
+}
+
+func TestRequireToken(t *testing.T) {
+	logger := testLogger()
+	s := httptest.NewServer(RequireToken("secret", NewDataRequestHandler(logger, fakeDataGetter{})))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	tests := []struct {
+		client *Client
+		err    error
+	}{
+		{DefaultClient, ErrUnauthorized},
+		{DefaultClient.WithToken("guess"), ErrUnauthorized},
+		{DefaultClient.WithToken("secret"), nil},
+	}
+	for i, tt := range tests {
+		d, err := tt.client.RequestData(addr, "req", 1, 0, 0, logger)
+		if err != tt.err {
+			t.Errorf("#%d: err want = %v, get = %v", i, tt.err, err)
+			continue
+		}
+		if err == nil && string(d.Data) != "req" {
+			t.Errorf("#%d: data want = req, get = %q", i, d.Data)
+		}
+	}
+}
+
+// hungDataGetter never responds, as a hung peer.
+type hungDataGetter chan struct{}
+
+func (g hungDataGetter) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	<-g
+	return nil, ErrServerClosed
+}
+
+func TestRequestDataHungPeer(t *testing.T) {
+	logger := testLogger()
+	g := make(hungDataGetter)
+	s := httptest.NewServer(NewDataRequestHandler(logger, g))
+	defer s.Close()
+	defer close(g)
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	if _, err := DefaultClient.WithTimeout(20*time.Millisecond).RequestData(addr, "req", 1, 0, 0, logger); err == nil {
+		t.Errorf("request to hung peer didn't time out")
+	}
+
+	cancel := make(chan struct{})
+	time.AfterFunc(20*time.Millisecond, func() { close(cancel) })
+	if _, err := DefaultClient.RequestDataCancel(addr, "req", 1, 0, 0, cancel, logger); err != ErrCanceled {
+		t.Errorf("err want = %v, get = %v", ErrCanceled, err)
+	}
+}
+
+func TestRequestDataEpochStamp(t *testing.T) {
+	logger := testLogger()
+	stamp := "3"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(DataResponseEpoch, stamp)
+		w.Write([]byte("data"))
+	}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	if _, err := RequestData(addr, "req", 1, 0, 3, logger); err != nil {
+		t.Errorf("RequestData of stamped epoch failed: %v", err)
+	}
+	if _, err := RequestData(addr, "req", 1, 0, 4, logger); err != ErrReqEpochMismatch {
+		t.Errorf("err want = %v, get = %v", ErrReqEpochMismatch, err)
+	}
+	stamp = ""
+	if _, err := RequestData(addr, "req", 1, 0, 4, logger); err != nil {
+		t.Errorf("RequestData of unstamped response failed: %v", err)
+	}
+}
+
+// typedDataGetter serves req as typed data of the first content type it has
+// and the client accepts.
+type typedDataGetter []string
+
+func (g typedDataGetter) GetTaskData(fromID, epoch uint64, req string) ([]byte, error) {
+	return []byte(req), nil
+}
+
+func (g typedDataGetter) GetTypedTaskData(fromID, epoch uint64, req, accept string) ([]byte, string, error) {
+	if req == "bad" {
+		return nil, "", ErrBadRequest
+	}
+	ct := NegotiateContentType(accept, g)
+	if ct == "" {
+		return nil, "", ErrNotAcceptable
+	}
+	return []byte(req), ct, nil
+}
+
+func TestRequestTypedData(t *testing.T) {
+	logger := testLogger()
+	s := httptest.NewServer(NewDataRequestHandler(logger, typedDataGetter{"application/x-gob", "application/json"}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	c := DefaultClient.WithAccept("application/json", "application/x-gob;q=0.5")
+	d, err := c.RequestData(addr, "req", 1, 0, 0, logger)
+	if err != nil || d.ContentType != "application/x-gob" || string(d.Data) != "req" {
+		t.Errorf("RequestData = (%+v, %v), want req of application/x-gob", d, err)
+	}
+	d, err = DefaultClient.WithAccept("application/json").RequestData(addr, "req", 1, 0, 0, logger)
+	if err != nil || d.ContentType != "application/json" {
+		t.Errorf("RequestData = (%+v, %v), want application/json", d, err)
+	}
+	if _, err := DefaultClient.WithAccept("text/csv").RequestData(addr, "req", 1, 0, 0, logger); err != ErrNotAcceptable {
+		t.Errorf("err want = %v, get = %v", ErrNotAcceptable, err)
+	}
+	if _, err := c.RequestData(addr, "bad", 1, 0, 0, logger); err != ErrBadRequest {
+		t.Errorf("err want = %v, get = %v", ErrBadRequest, err)
+	}
+}
+
+// handlerDataGetter fails calls as the handlers of a task do.
+type handlerDataGetter struct{}
+
+func (handlerDataGetter) GetTaskData(fromID, epoch uint64, req string) ([]byte, error) {
+	switch req {
+	case "missing":
+		return nil, ErrNoHandler
+	case "failing":
+		return nil, &HandlerError{Msg: "out of range"}
+	}
+	return []byte(req), nil
+}
+
+func TestRequestDataHandlerErrors(t *testing.T) {
+	logger := testLogger()
+	s := httptest.NewServer(NewDataRequestHandler(logger, handlerDataGetter{}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	if _, err := RequestData(addr, "missing", 1, 0, 0, logger); err != ErrNoHandler {
+		t.Errorf("err want = %v, get = %v", ErrNoHandler, err)
+	}
+	_, err := RequestData(addr, "failing", 1, 0, 0, logger)
+	if he, ok := err.(*HandlerError); !ok || he.Msg != "out of range" {
+		t.Errorf("err want = handler error: out of range, get = %v", err)
+	}
+}
+
+// payloadDataGetter serves req out of a buffer, and records its release.
+type payloadDataGetter struct {
+	typedDataGetter
+	released chan []byte
+}
+
+func (g payloadDataGetter) GetTaskPayload(fromID, epoch uint64, req, accept string) ([]byte, string, func(), error) {
+	buf := []byte(req)
+	return buf, "", func() { g.released <- buf }, nil
+}
+
+func TestRequestDataPayload(t *testing.T) {
+	logger := testLogger()
+	g := payloadDataGetter{released: make(chan []byte, 1)}
+	s := httptest.NewServer(NewDataRequestHandler(logger, g))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	var buf []byte
+	released := false
+	c := DefaultClient.WithBuffers(func(to uint64, req string, size int) ([]byte, func()) {
+		buf = make([]byte, size+2)
+		return buf, func() { released = true }
+	})
+	d, err := c.RequestData(addr, "req", 1, 0, 0, logger)
+	if err != nil || string(d.Data) != "req" || &d.Data[0] != &buf[0] || d.Release == nil {
+		t.Fatalf("RequestData = (%+v, %v), want req in the buffer", d, err)
+	}
+	d.Release()
+	if !released {
+		t.Errorf("buffer isn't released")
+	}
+	select {
+	case b := <-g.released:
+		if string(b) != "req" {
+			t.Errorf("released %q, want req", b)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("served buffer isn't released")
+	}
+}
+
+// testLogger logs nowhere.
+func testLogger() logging.Logger {
+	return logging.NewStd(log.New(ioutil.Discard, "", 0), logging.Info)
+}
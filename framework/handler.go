@@ -0,0 +1,101 @@
+package framework
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// callPrefix prefixes the data requests of calls: call:{name}/{base64 of
+// the args}. The request name of a call, e.g. for WithSchema, is
+// call:{name}.
+const callPrefix = "call:"
+
+func (f *framework) RegisterHandler(name string, h meritop.HandlerFunc) {
+	if strings.Contains(name, "/") {
+		panic("framework: handler name has /: " + name)
+	}
+	f.handlersMu.Lock()
+	defer f.handlersMu.Unlock()
+	if f.named == nil {
+		f.named = make(map[string]meritop.HandlerFunc)
+	}
+	f.named[name] = h
+}
+
+func (f *framework) namedHandler(name string) (meritop.HandlerFunc, bool) {
+	f.handlersMu.RLock()
+	defer f.handlersMu.RUnlock()
+	h, ok := f.named[name]
+	return h, ok
+}
+
+func (f *framework) Call(toID uint64, name string, args []byte) {
+	f.DataRequest(toID, callPrefix+name+"/"+base64.URLEncoding.EncodeToString(args))
+}
+
+func isCall(req string) bool { return strings.HasPrefix(req, callPrefix) }
+
+// parseCall returns the name and the args of a call.
+func parseCall(req string) (string, []byte, error) {
+	parts := strings.SplitN(strings.TrimPrefix(req, callPrefix), "/", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("%q is not a call", req)
+	}
+	args, err := base64.URLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return parts[0], args, nil
+}
+
+// serveCall serves a call of another task with the handler of its name.
+func (f *framework) serveCall(fromID uint64, req string) ([]byte, error) {
+	name, args, err := parseCall(req)
+	if err != nil {
+		f.log.Warnf("task %d: bad call %q of task %d: %v", f.taskID, req, fromID, err)
+		return nil, frameworkhttp.ErrBadRequest
+	}
+	h, ok := f.namedHandler(name)
+	if !ok {
+		f.log.Warnf("task %d: task %d calls %s, which has no handler", f.taskID, fromID, name)
+		return nil, frameworkhttp.ErrNoHandler
+	}
+	result, err := h(fromID, args)
+	if err != nil {
+		return nil, &frameworkhttp.HandlerError{Msg: err.Error()}
+	}
+	return result, nil
+}
+
+// callReady gives the result of a call to the task.
+func (f *framework) callReady(resp *frameworkhttp.DataResponse) {
+	name, args, err := parseCall(resp.Req)
+	if err != nil {
+		f.invalidData(resp, fmt.Errorf("has bad args: %v", err))
+		return
+	}
+	r, ok := adapted(f.task).(meritop.CallReceiver)
+	if !ok {
+		f.log.Warnf("task %d drops result of %s of task %d: not a call receiver", f.taskID, name, resp.TaskID)
+		return
+	}
+	r.CallReady(resp.TaskID, name, args, resp.Data, nil)
+}
+
+// callFailed gives the error of a call to the task.
+func (f *framework) callFailed(cf *dataFailure) {
+	name, args, err := parseCall(cf.req)
+	if err != nil {
+		return
+	}
+	r, ok := adapted(f.task).(meritop.CallReceiver)
+	if !ok {
+		f.log.Warnf("task %d: call of %s of task %d failed: %v", f.taskID, name, cf.taskID, cf.err)
+		return
+	}
+	r.CallReady(cf.taskID, name, args, nil, cf.err)
+}
@@ -0,0 +1,276 @@
+package framework
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// callTask exposes handlers, and calls those of task 1 at epoch 1.
+type callTask struct {
+	testableTask
+	results chan string
+}
+
+func (t *callTask) Init(taskID uint64, fw meritop.Framework) {
+	fw.RegisterHandler("upper", func(fromID uint64, args []byte) ([]byte, error) {
+		return bytes.ToUpper(args), nil
+	})
+	fw.RegisterHandler("fail", func(fromID uint64, args []byte) ([]byte, error) {
+		return nil, errors.New("no " + string(args))
+	})
+	t.testableTask.Init(taskID, fw)
+}
+
+func (t *callTask) SetEpoch(epoch uint64) {
+	if epoch != 1 || t.id != 0 {
+		return
+	}
+	t.framework.Call(1, "upper", []byte("abc"))
+	t.framework.Call(1, "fail", []byte("luck"))
+	t.framework.Call(1, "missing", nil)
+}
+
+func (t *callTask) CallReady(fromID uint64, name string, args, result []byte, err error) {
+	t.results <- fmt.Sprintf("%d %s(%s) = %s, %v", fromID, name, args, result, err)
+}
+
+type callTaskBuilder struct {
+	setupLatch *sync.WaitGroup
+	results    chan string
+}
+
+func (b *callTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &callTask{testableTask: testableTask{setupLatch: b.setupLatch}, results: b.results}
+}
+
+func TestFrameworkCall(t *testing.T) {
+	appName := "framework_test_call"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(appName, coord, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("initEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	var wg sync.WaitGroup
+	taskBuilder := &callTaskBuilder{setupLatch: &wg, results: make(chan string, 3)}
+	fs := make([]*framework, 2)
+	for i := range fs {
+		fs[i] = &framework{name: appName, etcdClient: coord, ln: createListener(t)}
+		fs[i].SetTaskBuilder(taskBuilder)
+		fs[i].SetTopology(example.NewTreeTopology(2, 2))
+	}
+	wg.Add(2)
+	for _, f := range fs {
+		go f.Start()
+	}
+	wg.Wait()
+	defer fs[0].ShutdownJob()
+	fs[0].IncEpoch()
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-taskBuilder.results:
+			got = append(got, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("call results = %v, want 3", got)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"1 fail(luck) = , handler error: no luck",
+		"1 missing() = , data request error: no handler",
+		"1 upper(abc) = ABC, <nil>",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("call result = %q, want %q", got[i], want[i])
+		}
+	}
+	if dls, _ := etcdutil.GetDeadLetters(coord, appName); len(dls) != 0 {
+		t.Errorf("dead letters = %+v, want none", dls)
+	}
+}
+
+// errorServerTask fails or defers some data requests of task 0 at epoch 1.
+type errorServerTask struct {
+	testableTask
+	mu       sync.Mutex
+	notReady int
+	results  chan string
+}
+
+func (t *errorServerTask) SetEpoch(epoch uint64) {
+	if epoch != 1 || t.id != 0 {
+		return
+	}
+	t.framework.DataRequest(1, "later")
+	t.framework.DataRequest(1, "unknown")
+}
+
+func (t *errorServerTask) ServeWithError(fromID uint64, linkType, req string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch req {
+	case "later":
+		if t.notReady > 0 {
+			t.notReady--
+			return nil, meritop.ErrNotReady
+		}
+		return []byte("done"), nil
+	}
+	return nil, fmt.Errorf("unknown request %s", req)
+}
+
+func (t *errorServerTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.results <- fmt.Sprintf("%s: %s", req, resp)
+}
+
+func (t *errorServerTask) DataFailed(fromID uint64, linkType, req string, err error) {
+	t.results <- fmt.Sprintf("%s failed: %v", req, err)
+}
+
+type errorServerTaskBuilder struct {
+	setupLatch *sync.WaitGroup
+	results    chan string
+}
+
+func (b *errorServerTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &errorServerTask{testableTask: testableTask{setupLatch: b.setupLatch}, notReady: 2, results: b.results}
+}
+
+func TestFrameworkServeError(t *testing.T) {
+	appName := "framework_test_serve_error"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(appName, coord, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("initEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	var wg sync.WaitGroup
+	taskBuilder := &errorServerTaskBuilder{setupLatch: &wg, results: make(chan string, 2)}
+	fs := make([]*framework, 2)
+	for i := range fs {
+		fs[i] = &framework{name: appName, etcdClient: coord, ln: createListener(t)}
+		fs[i].SetTaskBuilder(taskBuilder)
+		fs[i].SetTopology(example.NewTreeTopology(2, 2))
+	}
+	wg.Add(2)
+	for _, f := range fs {
+		go f.Start()
+	}
+	wg.Wait()
+	defer fs[0].ShutdownJob()
+	fs[0].IncEpoch()
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-taskBuilder.results:
+			got = append(got, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("results = %v, want 2", got)
+		}
+	}
+	sort.Strings(got)
+	want := []string{"later: done", "unknown failed: handler error: unknown request unknown"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result = %q, want %q", got[i], want[i])
+		}
+	}
+}
+
+// deferredServerTask responds later to the data requests of task 0 at
+// epoch 1, once its data is computed.
+type deferredServerTask struct {
+	testableTask
+	results chan string
+}
+
+func (t *deferredServerTask) SetEpoch(epoch uint64) {
+	if epoch != 1 || t.id != 0 {
+		return
+	}
+	t.framework.DataRequest(1, "gradient")
+	t.framework.DataRequest(1, "now")
+}
+
+func (t *deferredServerTask) ServeDeferred(requestID, fromID uint64, linkType, req string) ([]byte, error) {
+	if req == "now" {
+		return []byte("served"), nil
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		t.framework.Respond(requestID, []byte("computed"))
+	}()
+	return nil, meritop.ErrPending
+}
+
+func (t *deferredServerTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.results <- fmt.Sprintf("%s: %s", req, resp)
+}
+
+type deferredServerTaskBuilder struct {
+	setupLatch *sync.WaitGroup
+	results    chan string
+}
+
+func (b *deferredServerTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &deferredServerTask{testableTask: testableTask{setupLatch: b.setupLatch}, results: b.results}
+}
+
+func TestFrameworkDeferredResponse(t *testing.T) {
+	appName := "framework_test_deferred_response"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(appName, coord, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("initEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	var wg sync.WaitGroup
+	taskBuilder := &deferredServerTaskBuilder{setupLatch: &wg, results: make(chan string, 2)}
+	fs := make([]*framework, 2)
+	for i := range fs {
+		fs[i] = &framework{name: appName, etcdClient: coord, ln: createListener(t)}
+		fs[i].SetTaskBuilder(taskBuilder)
+		fs[i].SetTopology(example.NewTreeTopology(2, 2))
+	}
+	wg.Add(2)
+	for _, f := range fs {
+		go f.Start()
+	}
+	wg.Wait()
+	defer fs[0].ShutdownJob()
+	fs[0].IncEpoch()
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-taskBuilder.results:
+			got = append(got, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("results = %v, want 2", got)
+		}
+	}
+	// The request served right away comes back first.
+	want := []string{"now: served", "gradient: computed"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result = %q, want %q", got[i], want[i])
+		}
+	}
+	if _, ok := fs[1].deferred.take(1); ok {
+		t.Errorf("request 1 still pending after its response")
+	}
+}
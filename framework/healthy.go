@@ -1,6 +1,7 @@
 package framework
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/go-distributed/meritop/pkg/etcdutil"
@@ -10,12 +11,101 @@ var (
 	heartbeatInterval = 1 * time.Second
 )
 
+// heartbeatSettings returns the interval and TTL of heartbeats, see
+// WithHeartbeat.
+func (f *framework) heartbeatSettings() (interval, ttl time.Duration) {
+	if f.heartbeatInterval > 0 {
+		return f.heartbeatInterval, f.ttls.Heartbeat
+	}
+	return heartbeatInterval, f.ttls.Heartbeat
+}
+
+// heartbeat keeps the claim of the task alive. With a progress timeout, it
+// also releases the claim if the task stops making progress, which fails the
+// task over as if the node were dead.
 func (f *framework) heartbeat() {
 	f.heartbeatStop = make(chan struct{})
+	f.heartbeatDone = make(chan struct{})
+	beatStop, beatDone := f.heartbeatStop, f.heartbeatDone
+	if f.progressTimeout > 0 {
+		beatStop = make(chan struct{})
+		f.progress.report(time.Now())
+		go f.watchProgress(beatStop, beatDone)
+	}
+	interval, ttl := f.heartbeatSettings()
 	go func() {
-		err := etcdutil.Heartbeat(f.etcdClient, f.name, f.taskID, heartbeatInterval, f.heartbeatStop)
+		defer close(beatDone)
+		err := etcdutil.Heartbeat(f.etcdClient, f.name, f.claim, interval, ttl, beatStop)
+		// In degraded mode, keep trying as long as the claim isn't lost. If
+		// etcd is in quorum loss, the claim can't expire either.
+		for f.degradedMode && err != nil && err != etcdutil.ErrClaimLost && etcdutil.IsTransient(err) {
+			f.metrics.etcdErrors.Inc()
+			f.log.Warnf("task %d can't heartbeat, keeps trying: %v", f.taskID, err)
+			err = etcdutil.Heartbeat(f.etcdClient, f.name, f.claim, interval, ttl, beatStop)
+		}
+		if err == etcdutil.ErrClaimLost {
+			// Another node might be running the task now.
+			f.log.Fatalf("task %d lost its claim", f.taskID)
+		}
 		if err != nil {
-			f.log.Printf("Heartbeat stops with error: %v\n", err)
+			f.metrics.etcdErrors.Inc()
+			f.log.Errorf("Heartbeat stops with error: %v\n", err)
 		}
 	}()
 }
+
+// standBy keeps the node in the standby pool of the job until stop.
+func (f *framework) standBy(stop chan struct{}) {
+	interval, _ := f.heartbeatSettings()
+	if err := etcdutil.RegisterStandby(f.etcdClient, f.name, f.ln.Addr().String(), interval, f.ttls.Standby, stop); err != nil {
+		f.log.Errorf("node %s left the standby pool: %v", f.ln.Addr(), err)
+	}
+}
+
+// stopHeartbeat stops heartbeating and waits until no more heartbeats are
+// sent. It can be called more than once.
+func (f *framework) stopHeartbeat() {
+	select {
+	case <-f.heartbeatStop:
+	default:
+		close(f.heartbeatStop)
+	}
+	<-f.heartbeatDone
+}
+
+// ReportProgress tells the framework that the task isn't stuck. Starting an
+// epoch counts as progress too.
+func (f *framework) ReportProgress() { f.progress.report(time.Now()) }
+
+func (f *framework) watchProgress(beatStop, beatDone chan struct{}) {
+	ticker := time.NewTicker(f.progressTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !f.progress.stalled(time.Now(), f.progressTimeout) {
+				break
+			}
+			close(beatStop)
+			<-beatDone
+			if err := etcdutil.ReleaseClaim(f.etcdClient, f.name, f.claim); err != nil {
+				f.log.Errorf("task %d failed to release claim: %v", f.taskID, err)
+			}
+			f.log.Fatalf("task %d made no progress in %v", f.taskID, f.progressTimeout)
+		case <-f.heartbeatStop:
+			close(beatStop)
+			return
+		}
+	}
+}
+
+// progress is the time of the last progress of the task in unix nanoseconds.
+// The task reports it from its own goroutines.
+type progress int64
+
+func (p *progress) report(now time.Time) { atomic.StoreInt64((*int64)(p), now.UnixNano()) }
+
+func (p *progress) stalled(now time.Time, timeout time.Duration) bool {
+	last := time.Unix(0, atomic.LoadInt64((*int64)(p)))
+	return now.Sub(last) > timeout
+}
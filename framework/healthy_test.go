@@ -0,0 +1,30 @@
+package framework
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressStalled(t *testing.T) {
+	start := time.Unix(100, 0)
+	timeout := 10 * time.Second
+	var p progress
+	p.report(start)
+	tests := []struct {
+		report  time.Duration
+		at      time.Duration
+		stalled bool
+	}{
+		{0, 5 * time.Second, false},
+		{0, 10 * time.Second, false},
+		{0, 11 * time.Second, true},
+		{8 * time.Second, 11 * time.Second, false},
+		{8 * time.Second, 19 * time.Second, true},
+	}
+	for i, tt := range tests {
+		p.report(start.Add(tt.report))
+		if s := p.stalled(start.Add(tt.at), timeout); s != tt.stalled {
+			t.Errorf("#%d: stalled want = %v, get = %v", i, tt.stalled, s)
+		}
+	}
+}
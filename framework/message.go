@@ -0,0 +1,152 @@
+package framework
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func (f *framework) SendMessage(toID uint64, payload []byte) {
+	// Like DataRequest, it assumes the epoch doesn't change while the task
+	// sends. The epoch only tags dead letters.
+	go f.sendMessage(toID, f.epoch, payload)
+}
+
+// sendMessage looks up the node running the task in etcd, and sends it the
+// message. Messages which can't be delivered are kept as dead letters.
+func (f *framework) sendMessage(toID, epoch uint64, payload []byte) {
+	dead := etcdutil.DeadLetter{To: toID, Epoch: epoch, Kind: "message", Payload: string(payload)}
+	var addr string
+	err := f.retry.Do(func() (err error) {
+		addr, err = f.getAddress(toID)
+		return err
+	})
+	if err != nil {
+		f.keepDeadLetter(dead, err)
+		return
+	}
+	if err := f.httpClient.SendMessage(addr, f.taskID, toID, payload); err != nil {
+		f.keepDeadLetter(dead, err)
+	}
+}
+
+// ReceiveMessage takes a message of another task to the event loop, and
+// returns once the loop has taken it.
+func (f *framework) ReceiveMessage(fromID, toID uint64, payload []byte) error {
+	return f.receive(&message{from: fromID, to: toID, payload: payload})
+}
+
+// ReceivePush is ReceiveMessage for a push of the epoch.
+func (f *framework) ReceivePush(fromID, toID, epoch uint64, payload []byte) error {
+	return f.receive(&message{from: fromID, to: toID, payload: payload, push: true, epoch: epoch})
+}
+
+func (f *framework) receive(m *message) error {
+	m.ack = make(chan error, 1)
+	f.events <- m
+	select {
+	case err := <-m.ack:
+		return err
+	case <-f.httpStop:
+		return frameworkhttp.ErrServerClosed
+	}
+}
+
+func (f *framework) handleMessage(m *message) {
+	if m.to != f.taskID {
+		m.ack <- frameworkhttp.ErrWrongTask
+		return
+	}
+	if m.push {
+		f.handlePush(m)
+		return
+	}
+	m.ack <- nil
+	r, ok := adapted(f.task).(meritop.MessageReceiver)
+	if !ok {
+		f.log.Warnf("task %d drops message of task %d: not a message receiver", f.taskID, m.from)
+		return
+	}
+	f.spawn(func() { r.MessageReady(m.from, m.payload) })
+}
+
+func (f *framework) Push(toID uint64, payload []byte) {
+	// Like DataRequest, it assumes the epoch doesn't change while the task
+	// pushes.
+	f.events <- &pushToSend{to: toID, epoch: f.epoch, payload: payload}
+}
+
+// push sends the push to the node running the task. Pushes which can't be
+// sent within their epoch are reported failed.
+func (f *framework) push(p *pushToSend, cancel <-chan struct{}) {
+	var addr string
+	err := f.retry.Do(func() (err error) {
+		addr, err = f.getAddress(p.to)
+		return err
+	})
+	if err == nil {
+		err = f.pushTo(addr, p, cancel)
+	}
+	if err != nil {
+		f.events <- &pushFailure{p, err}
+	}
+}
+
+// pushTo sends the push to addr, retrying while the task hasn't started the
+// epoch, until the epoch of the push is over.
+func (f *framework) pushTo(addr string, p *pushToSend, cancel <-chan struct{}) error {
+	backoff := busyBackoff
+	for {
+		err := f.httpClient.Push(addr, f.taskID, p.to, p.epoch, p.payload)
+		if err != frameworkhttp.ErrServerBusy {
+			return err
+		}
+		f.log.Debugf("task %d isn't at epoch %d, retrying push in %v", p.to, p.epoch, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-cancel:
+			return frameworkhttp.ErrCanceled
+		case <-f.httpStop:
+			return frameworkhttp.ErrServerClosed
+		}
+		if backoff *= 2; backoff > maxBusyBackoff {
+			backoff = maxBusyBackoff
+		}
+	}
+}
+
+// handlePush lets the task take a push of current epoch. Pushes of an epoch
+// which is over fail, while those of an epoch the task hasn't started are
+// retried.
+func (f *framework) handlePush(m *message) {
+	switch {
+	case m.epoch < f.epoch:
+		m.ack <- frameworkhttp.ErrReqEpochMismatch
+		return
+	case m.epoch > f.epoch || f.state != stateRunning:
+		m.ack <- frameworkhttp.ErrServerBusy
+		return
+	}
+	m.ack <- nil
+	r, ok := adapted(f.task).(meritop.PushReceiver)
+	if !ok {
+		f.log.Warnf("task %d drops push of task %d: not a push receiver", f.taskID, m.from)
+		return
+	}
+	f.pushes.Add(1)
+	f.spawn(func() {
+		defer f.pushes.Done()
+		r.PushReady(m.from, m.payload)
+	})
+}
+
+func (f *framework) handlePushFailure(pf *pushFailure) {
+	r, ok := adapted(f.task).(meritop.PushFailureReceiver)
+	if !ok {
+		f.keepDeadLetter(etcdutil.DeadLetter{To: pf.to, Epoch: pf.epoch, Kind: "push", Payload: string(pf.payload)}, pf.err)
+		return
+	}
+	r.PushFailed(pf.to, pf.epoch, pf.payload, pf.err)
+}
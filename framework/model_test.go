@@ -0,0 +1,181 @@
+package framework
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// TestEventInterleavings drives the event loop of task 0, the root of a tree
+// of three tasks, with random sequences of epoch changes, shutdowns, node
+// stops, meta, data requests and responses of its children. Events queued by
+// the handlers are interleaved with the generated ones. After every step it
+// checks that:
+// - the task gets no callback once the node has exited,
+// - callbacks, data served and data sent are all of current epoch,
+// - every data request is eventually served or told of epoch mismatch.
+func TestEventInterleavings(t *testing.T) {
+	job := "TestEventInterleavings"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, coord, 3)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+
+	for seed := int64(0); seed < 200; seed++ {
+		if err := runInterleaving(t, coord, rand.New(rand.NewSource(seed)), 40); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+// runInterleaving runs one random sequence of steps events long, followed by
+// the events still queued.
+func runInterleaving(t *testing.T, coord etcdutil.Coordinator, r *rand.Rand, steps int) error {
+	topo := example.NewTreeTopology(2, 3)
+	topo.SetTaskID(0)
+	f := newTestFramework(t, WithCoordinator(coord))
+	f.topology = topo
+	f.numOfTasks = 3
+	f.running.open(f.epoch)
+	task := &modelTask{f: f}
+	f.task = task
+	defer f.releaseEpochResource()
+
+	// the epoch of the job, which the node might not have seen yet
+	jobEpoch := uint64(0)
+	var queued []event
+	var requests []*dataRequest
+	var trace []string
+	for i := 0; i < steps || len(queued) > 0; i++ {
+		var ev event
+		if len(queued) > 0 && (i >= steps || r.Intn(2) == 0) {
+			ev, queued = queued[0], queued[1:]
+		} else {
+			ev = genEvent(r, &jobEpoch)
+			if req, ok := ev.(*dataRequest); ok {
+				requests = append(requests, req)
+			}
+		}
+		trace = append(trace, describeEvent(ev))
+		f.step(ev)
+		for n := len(f.events); n > 0; n-- {
+			queued = append(queued, <-f.events)
+		}
+
+		if task.err != nil {
+			return fmt.Errorf("%v after %v", task.err, trace)
+		}
+		pending := requests[:0]
+		for _, req := range requests {
+			select {
+			case data, ok := <-req.dataChan:
+				if ok && (f.state != stateRunning || string(data) != epochTag(f.epoch)) {
+					return fmt.Errorf("request of epoch %d got %q at epoch %d (%s) after %v",
+						req.epoch, data, f.epoch, f.state, trace)
+				}
+			default:
+				pending = append(pending, req)
+			}
+		}
+		requests = pending
+	}
+	if len(requests) > 0 {
+		return fmt.Errorf("%d requests never answered after %v", len(requests), trace)
+	}
+	return nil
+}
+
+// genEvent generates an event of the job at jobEpoch, or of an epoch close to
+// it.
+func genEvent(r *rand.Rand, jobEpoch *uint64) event {
+	epoch := *jobEpoch
+	switch r.Intn(3) {
+	case 0:
+		if epoch > 0 {
+			epoch--
+		}
+	case 1:
+		epoch++
+	}
+	child := uint64(1 + r.Intn(2))
+	switch n := r.Intn(20); {
+	case n == 0:
+		return &etcdutil.EpochChange{Epoch: exitEpoch, Index: 1 << 62}
+	case n == 1:
+		return (*etcdutil.EpochChange)(nil)
+	case n < 6:
+		*jobEpoch++
+		return &etcdutil.EpochChange{Epoch: *jobEpoch, Index: 1 << 62}
+	case n < 10:
+		return &metaChange{from: child, linkType: meritop.LinkChild, metaType: meritop.LinkParent, epoch: epoch, meta: epochTag(epoch)}
+	case n < 16:
+		return &dataRequest{taskID: child, epoch: epoch, req: epochTag(epoch), dataChan: make(chan []byte, 1)}
+	default:
+		return &frameworkhttp.DataResponse{TaskID: child, Epoch: epoch, Req: epochTag(epoch)}
+	}
+}
+
+func describeEvent(ev event) string {
+	switch e := ev.(type) {
+	case *etcdutil.EpochChange:
+		if e == nil {
+			return "stop"
+		}
+		if e.Epoch == exitEpoch {
+			return "shutdown"
+		}
+		return "epoch " + strconv.FormatUint(e.Epoch, 10)
+	case *metaChange:
+		return "meta " + e.meta
+	case *dataRequest:
+		return "request " + e.req
+	case *dataResponse:
+		return "resp-to-send " + e.req
+	case *frameworkhttp.DataResponse:
+		return "response " + e.Req
+	}
+	return fmt.Sprintf("%T", ev)
+}
+
+func epochTag(epoch uint64) string { return "e" + strconv.FormatUint(epoch, 10) }
+
+// modelTask checks that every callback comes while the node runs the epoch
+// the meta or data is tagged with.
+type modelTask struct {
+	f   *framework
+	err error
+}
+
+func (t *modelTask) Init(taskID uint64, framework meritop.Framework) {}
+func (t *modelTask) Exit()                                           {}
+
+func (t *modelTask) SetEpoch(epoch uint64) { t.check("SetEpoch", epochTag(epoch)) }
+
+func (t *modelTask) MetaReady(fromID uint64, linkType, meta string) { t.check("MetaReady", meta) }
+
+func (t *modelTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.check("DataReady", req)
+}
+
+func (t *modelTask) Serve(fromID uint64, linkType, req string) []byte {
+	t.check("Serve", req)
+	return []byte(req)
+}
+
+func (t *modelTask) check(callback, tag string) {
+	if t.err != nil {
+		return
+	}
+	if t.f.state != stateRunning || tag != epochTag(t.f.epoch) {
+		t.err = fmt.Errorf("%s(%s) while %s at epoch %d", callback, tag, t.f.state, t.f.epoch)
+	}
+}
@@ -0,0 +1,255 @@
+package framework
+
+import (
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+type ObserverEventType int
+
+const (
+	EpochChanged ObserverEventType = iota
+	MetaFlagged
+)
+
+// ObserverEvent is what an observer sees from the running job.
+type ObserverEvent struct {
+	Type  ObserverEventType
+	Epoch uint64
+	// The following are only set for MetaFlagged.
+	TaskID uint64
+	// The link type the meta is flagged to, e.g. meritop.LinkChild.
+	FlagTo string
+	Meta   string
+}
+
+// Observer joins a running job in read-only mode. It can read the topology,
+// pull data from tasks implementing meritop.Observable and subscribe to
+// events, but it never claims a task or changes the epoch. It is useful for
+// live model inspection and ad hoc evaluation (see FollowSnapshots).
+type Observer struct {
+	name       string
+	etcdClient etcdutil.Coordinator
+	httpClient *frameworkhttp.Client
+	dataToken  string
+	log        logging.Logger
+
+	// topology is stateful (SetTaskID), so queries must be serialized.
+	topoMu   sync.Mutex
+	topology meritop.Topology
+	seeded   bool
+
+	checkpointStore checkpoint.Store
+
+	stops []chan bool
+	// closed by Stop, so that relays don't block on events nobody reads
+	dones []chan struct{}
+}
+
+func NewObserver(jobName string, etcdURLs []string, topology meritop.Topology, logger *log.Logger) *Observer {
+	l := logging.Default()
+	if logger != nil {
+		l = logging.NewStd(logger, logging.Info)
+	}
+	return &Observer{
+		name:       jobName,
+		etcdClient: etcd.NewClient(etcdURLs),
+		httpClient: frameworkhttp.DefaultClient,
+		log:        l.With("job", jobName),
+		topology:   topology,
+	}
+}
+
+func (o *Observer) GetEpoch() (uint64, error) {
+	codec, err := etcdutil.GetCodec(o.etcdClient, o.name)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := o.etcdClient.Get(etcdutil.EpochPath(o.name), false, false)
+	if err != nil {
+		return 0, err
+	}
+	return codec.DecodeEpoch(resp.Node.Value)
+}
+
+// GetNeighbors returns the neighbors of given task over given link type at
+// given epoch. Like running tasks, the topology is set up with the job seed
+// and the number of tasks of current epoch.
+func (o *Observer) GetNeighbors(taskID uint64, linkType string, epoch uint64) ([]uint64, error) {
+	o.topoMu.Lock()
+	defer o.topoMu.Unlock()
+	if err := o.setupTopology(); err != nil {
+		return nil, err
+	}
+	o.topology.SetTaskID(taskID)
+	return o.topology.GetNeighbors(linkType, epoch), nil
+}
+
+// setupTopology does what framework does to the topology at each epoch.
+func (o *Observer) setupTopology() error {
+	if st, ok := o.topology.(meritop.SeededTopology); ok && !o.seeded {
+		seed, err := etcdutil.GetSeed(o.etcdClient, o.name)
+		if err != nil {
+			return err
+		}
+		st.SetSeed(seed)
+		o.seeded = true
+	}
+	resp, err := o.etcdClient.Get(etcdutil.EpochPath(o.name), false, false)
+	if err != nil {
+		return err
+	}
+	nt, err := etcdutil.GetTaskCount(o.etcdClient, o.name)
+	if err != nil {
+		return err
+	}
+	o.topology.SetNumberOfTasks(nt.At(resp.Node.ModifiedIndex))
+	return nil
+}
+
+// DataRequest pulls data from given task. The task must implement
+// meritop.Observable, otherwise frameworkhttp.ErrNotObservable is returned.
+func (o *Observer) DataRequest(taskID uint64, req string) ([]byte, error) {
+	addr, err := etcdutil.GetAddress(o.etcdClient, o.name, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return o.httpClient.RequestObservableData(addr, req)
+}
+
+// UseDataToken makes the observer send the token with its requests, for jobs
+// run with WithDataToken or WithEtcdDataToken. See etcdutil.GetDataToken for
+// the latter.
+func (o *Observer) UseDataToken(token string) {
+	o.dataToken = token
+	o.httpClient = o.httpClient.WithToken(token)
+}
+
+// UseTLS makes the observer request data over TLS, for jobs run with
+// WithTLS. With info.ClientCertAuth, the observer presents info.CertFile.
+func (o *Observer) UseTLS(info frameworkhttp.TLSInfo) error {
+	cfg, err := info.ClientConfig()
+	if err != nil {
+		return err
+	}
+	o.httpClient = frameworkhttp.NewClient(cfg).WithToken(o.dataToken)
+	return nil
+}
+
+// Subscribe returns a channel of epoch changes and meta flags of all tasks.
+// The channel is closed after Stop.
+func (o *Observer) Subscribe() (<-chan *ObserverEvent, error) {
+	codec, err := etcdutil.GetCodec(o.etcdClient, o.name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.etcdClient.Get(etcdutil.EpochPath(o.name), false, false)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan *ObserverEvent, 100)
+	epochReceiver := make(chan *etcd.Response, 1)
+	metaReceiver := make(chan *etcd.Response, 1)
+	epochStop := make(chan bool, 1)
+	metaStop := make(chan bool, 1)
+	done := make(chan struct{})
+	o.stops = append(o.stops, epochStop, metaStop)
+	o.dones = append(o.dones, done)
+	send := func(e *ObserverEvent) bool {
+		select {
+		case events <- e:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	go o.etcdClient.Watch(etcdutil.EpochPath(o.name), resp.EtcdIndex+1, false, epochReceiver, epochStop)
+	go o.etcdClient.Watch(etcdutil.TaskDirPath(o.name), resp.EtcdIndex+1, true, metaReceiver, metaStop)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for resp := range epochReceiver {
+			if resp.Action != "compareAndSwap" && resp.Action != "set" {
+				continue
+			}
+			epoch, err := codec.DecodeEpoch(resp.Node.Value)
+			if err != nil {
+				o.log.Errorf("observer: %v", err)
+				continue
+			}
+			if !send(&ObserverEvent{Type: EpochChanged, Epoch: epoch}) {
+				drain(epochReceiver)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for resp := range metaReceiver {
+			if resp.Action != "set" {
+				continue
+			}
+			base := path.Base(resp.Node.Key)
+			if !strings.HasSuffix(base, etcdutil.TaskMetaSuffix) {
+				continue
+			}
+			flagTo := strings.TrimSuffix(base, etcdutil.TaskMetaSuffix)
+			taskID, err := strconv.ParseUint(path.Base(path.Dir(resp.Node.Key)), 10, 64)
+			if err != nil {
+				continue
+			}
+			epoch, meta, err := codec.DecodeMeta(resp.Node.Value)
+			if err != nil {
+				continue
+			}
+			e := &ObserverEvent{
+				Type:   MetaFlagged,
+				Epoch:  epoch,
+				TaskID: taskID,
+				FlagTo: flagTo,
+				Meta:   meta,
+			}
+			if !send(e) {
+				drain(metaReceiver)
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	return events, nil
+}
+
+// drain lets the watch see its stop instead of blocking on the receiver.
+func drain(receiver <-chan *etcd.Response) {
+	for _ = range receiver {
+	}
+}
+
+// Stop cancels all subscriptions. Their channels are closed even if the
+// caller has stopped reading them.
+func (o *Observer) Stop() {
+	for _, c := range o.dones {
+		close(c)
+	}
+	for _, c := range o.stops {
+		c <- true
+	}
+	o.stops = nil
+	o.dones = nil
+}
@@ -0,0 +1,143 @@
+package framework
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestObserverSubscribe(t *testing.T) {
+	job := "TestObserverSubscribe"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	etcdURLs := []string{m.URL()}
+	client := etcd.NewClient(etcdURLs)
+	ctl := controller.New(job, client, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+
+	o := NewObserver(job, etcdURLs, example.NewTreeTopology(2, 2), nil)
+	events, err := o.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	if err := etcdutil.CASEpoch(client, etcdutil.TextCodec, job, 0, 1); err != nil {
+		t.Fatalf("CASEpoch failed: %v", err)
+	}
+	e := <-events
+	if want := (&ObserverEvent{Type: EpochChanged, Epoch: 1}); !reflect.DeepEqual(e, want) {
+		t.Errorf("event want = %+v, get = %+v", want, e)
+	}
+
+	if _, err := client.Set(etcdutil.MetaPath(job, 1, meritop.LinkParent), "1-GradientReady", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	e = <-events
+	want := &ObserverEvent{Type: MetaFlagged, Epoch: 1, TaskID: 1, FlagTo: meritop.LinkParent, Meta: "GradientReady"}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("event want = %+v, get = %+v", want, e)
+	}
+
+	// More events than the channel holds, and nobody reads them.
+	for i := 0; i < 200; i++ {
+		client.Set(etcdutil.MetaPath(job, 1, meritop.LinkParent), "1-GradientReady", 0)
+	}
+	o.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("events channel isn't closed after Stop")
+		}
+	}
+}
+
+// Observer must see the same random pairs as the tasks, which use the job
+// seed and number of tasks from etcd rather than the ones given locally.
+func TestObserverGetNeighborsSeeded(t *testing.T) {
+	job := "TestObserverGetNeighborsSeeded"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	etcdURLs := []string{m.URL()}
+	ctl := controller.New(job, etcd.NewClient(etcdURLs), 6)
+	ctl.SetSeed(7)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+
+	o := NewObserver(job, etcdURLs, example.NewRandomPairTopology(0, 2), nil)
+	for id := uint64(0); id < 6; id++ {
+		topo := example.NewRandomPairTopology(7, 6)
+		topo.SetTaskID(id)
+		want := topo.GetNeighbors(meritop.LinkPeer, 3)
+		get, err := o.GetNeighbors(id, meritop.LinkPeer, 3)
+		if err != nil {
+			t.Fatalf("GetNeighbors failed: %v", err)
+		}
+		if !reflect.DeepEqual(get, want) {
+			t.Errorf("task %d: peers want = %v, get = %v", id, want, get)
+		}
+	}
+}
+
+// A slow evaluator following snapshots only gets the newest one, and the job
+// goes on without it.
+func TestObserverFollowSnapshots(t *testing.T) {
+	job := "TestObserverFollowSnapshots"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	etcdURLs := []string{m.URL()}
+	client := etcd.NewClient(etcdURLs)
+	ctl := controller.New(job, client, 1)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+
+	o := NewObserver(job, etcdURLs, example.NewTreeTopology(1, 1), nil)
+	defer o.Stop()
+	snapshots, err := o.FollowSnapshots(0)
+	if err != nil {
+		t.Fatalf("FollowSnapshots failed: %v", err)
+	}
+
+	store := checkpoint.NewEtcdStore(client, job)
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		if err := store.Save(0, epoch, []byte{byte(epoch)}); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if err := etcdutil.CASEpoch(client, etcdutil.TextCodec, job, epoch-1, epoch); err != nil {
+			t.Fatalf("CASEpoch failed: %v", err)
+		}
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-snapshots:
+			if s.Epoch == 3 {
+				if !reflect.DeepEqual(s.Data, []byte{3}) {
+					t.Errorf("snapshot data want = [3], get = %v", s.Data)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("snapshot of epoch 3 doesn't come")
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package framework
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/datacodec"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/logging"
+	"github.com/go-distributed/meritop/pkg/membudget"
+	"github.com/go-distributed/meritop/pkg/sandbox"
+	"github.com/go-distributed/meritop/pkg/stream"
+)
+
+// Option configures optional behaviors of the framework. Options are passed
+// to NewBootStrap.
+type Option func(f *framework)
+
+// WithCheckpointStore sets where snapshots of Checkpointer tasks are kept.
+// By default they are stored in etcd.
+func WithCheckpointStore(s checkpoint.Store) Option {
+	return func(f *framework) { f.checkpointStore = s }
+}
+
+// WithCheckpointInterval sets how many epochs there are between two snapshots
+// of a Checkpointer task. The default is 1, i.e. every epoch.
+func WithCheckpointInterval(epochs uint64) Option {
+	return func(f *framework) { f.checkpointInterval = epochs }
+}
+
+// WithHTTPHandler serves an extra handler on the framework listener, e.g. a
+// modelserve.Publisher. The pattern follows http.ServeMux.
+func WithHTTPHandler(pattern string, h http.Handler) Option {
+	return func(f *framework) {
+		if f.httpHandlers == nil {
+			f.httpHandlers = make(map[string]http.Handler)
+		}
+		f.httpHandlers[pattern] = h
+	}
+}
+
+// WithTLS secures the HTTP transport between tasks, i.e. data requests,
+// probes and observers, with TLS, or mutual TLS if info.ClientCertAuth is
+// set. All tasks of the job must use it.
+func WithTLS(info frameworkhttp.TLSInfo) Option {
+	return func(f *framework) { f.tlsInfo = &info }
+}
+
+// WithDataToken requires the token with data and observe requests to the
+// task, and sends it with the requests of the task. All tasks of the job must
+// share it.
+func WithDataToken(token string) Option {
+	return func(f *framework) { f.dataToken = token }
+}
+
+// WithEtcdDataToken is WithDataToken with the token distributed through etcd
+// by the controller (see controller.SetDataToken).
+func WithEtcdDataToken() Option {
+	return func(f *framework) { f.etcdDataToken = true }
+}
+
+// WithCompression compresses data and observe responses with the first of
+// given encodings, e.g. frameworkhttp.EncodingSnappy, accepted by the
+// requester, and makes the task accept them for its own requests. Tasks of a
+// job may use different encodings; data goes uncompressed if they have none
+// in common.
+func WithCompression(encodings ...string) Option {
+	return func(f *framework) { f.compression = encodings }
+}
+
+// WithParallelStreams fetches data responses of at least minSize bytes over n
+// parallel streams, as a single TCP stream often can't fill high-bandwidth
+// links, and serves them so to tasks asking for it. Chunks of the data are
+// checked against their checksums before they are reassembled, and sized per
+// link: they grow while they are fetched and halve as they fail or time out.
+func WithParallelStreams(n, minSize int) Option {
+	return func(f *framework) {
+		f.streams = n
+		f.streamMinSize = minSize
+	}
+}
+
+// WithSelfOrganize lets the nodes of the job set up its etcd layout for
+// numOfTasks tasks, so that small ad hoc runs don't need a controller. The
+// first node to start sets it up, and reports failed tasks for as long as it
+// runs; use a controller for jobs which must outlive it. All nodes of the job
+// must use it.
+func WithSelfOrganize(numOfTasks uint64) Option {
+	return func(f *framework) { f.selfOrganizeTasks = numOfTasks }
+}
+
+// WithServeWorkers serves data requests on a pool of given number of workers,
+// so that a task with many neighbors, e.g. a parameter server, doesn't call
+// Serve for all of them at once. At most backlog requests wait for a worker;
+// others are turned away, and their requesters retry them with backoff, so
+// that requests don't pile up in memory. By default every request is served
+// right away on its own goroutine.
+func WithServeWorkers(workers, backlog int) Option {
+	return func(f *framework) { f.servePool = newServePool(workers, backlog) }
+}
+
+// WithRequestTimeout gives up data requests of the task which aren't
+// responded within d, so that a hung peer doesn't hold them forever. They are
+// dropped as if the peer failed. Regardless of it, data requests are canceled
+// once the epoch they were sent in is over.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(f *framework) { f.requestTimeout = d }
+}
+
+// WithDNS resolves the host names in the addresses of other tasks with the
+// policy, e.g. of Kubernetes services, whose addresses change as pods are
+// rescheduled. A data request failing to connect is retried once with the
+// name resolved again, rather than waiting for the cache of the resolver of
+// the OS to expire.
+func WithDNS(p frameworkhttp.DNSPolicy) Option {
+	return func(f *framework) { f.dns = &p }
+}
+
+// WithDataVerification is a debug mode fetching the data of every request
+// twice, and flagging responses whose data diverges in the log and in the
+// metrics of the node, so that new transports and compression codecs can be
+// validated before training runs trust them. It doubles the data sent, and
+// tasks must serve the same data to a request within an epoch. Calls aren't
+// fetched twice.
+func WithDataVerification() Option {
+	return func(f *framework) { f.verifyData = true }
+}
+
+// WithShadowTransport duplicates the data requests of the task over a
+// candidate transport, e.g. a new protocol, while the task keeps getting its
+// data over HTTP. Responses whose data differs, failures and the time spent
+// on both transports are reported in the log and in the metrics of the node,
+// so that the candidate can be validated on live jobs before it replaces
+// HTTP. Tasks must serve the same data to a request within an epoch. Calls
+// aren't duplicated.
+func WithShadowTransport(t frameworkhttp.DataTransport) Option {
+	return func(f *framework) { f.shadow = t }
+}
+
+// WithSchema checks the data responses to requests of given name against
+// the schema before DataReady. The name of a request goes up to its first
+// "/", e.g. "exchange" for "exchange/3". Responses breaking the schema are
+// dropped and reported (see meritop.InvalidDataObserver), as if the sender
+// didn't respond.
+func WithSchema(reqName string, s Schema) Option {
+	return func(f *framework) {
+		if f.schemas == nil {
+			f.schemas = make(map[string]Schema)
+		}
+		f.schemas[reqName] = s
+	}
+}
+
+// WithDegradedMode keeps the task running while etcd can be read but can't
+// take writes, e.g. during quorum loss. Meta flags failing to be set are
+// buffered and set once etcd takes writes again, the node keeps heartbeating,
+// and data requests go to the last known addresses of tasks. Without it, the
+// node stops once the retries of a write give up.
+func WithDegradedMode() Option {
+	return func(f *framework) { f.degradedMode = true }
+}
+
+// WithEtcdAPI sets the version of the etcd API, i.e. etcdutil.APIv2, the
+// default, or etcdutil.APIv3. The controller and all nodes of a job must use
+// the same version.
+func WithEtcdAPI(api string) Option {
+	return func(f *framework) { f.etcdAPI = api }
+}
+
+// WithCoordinator sets the store the node coordinates through, instead of etcd
+// at the URLs passed to NewBootStrap. The controller of the job must use the
+// same store.
+func WithCoordinator(c etcdutil.Coordinator) Option {
+	return func(f *framework) { f.etcdClient = c }
+}
+
+// WithMetaDebounce holds meta flags for up to window before dispatching them
+// to the task. Meta flagged by the same neighbor on the same link within the
+// window is coalesced, so the task only gets the latest. It smooths bursts of
+// meta, e.g. at epoch boundaries on large jobs, but delays every meta flag
+// by up to window.
+func WithMetaDebounce(window time.Duration) Option {
+	return func(f *framework) { f.metaDebounce = window }
+}
+
+// WithRetryPolicy sets how the framework retries etcd operations failing with
+// transient errors. The default is etcdutil.DefaultRetryPolicy; the zero
+// policy doesn't retry.
+func WithRetryPolicy(p etcdutil.RetryPolicy) Option {
+	return func(f *framework) { f.retry = p }
+}
+
+// WithLogger sets the logger of the framework, overriding the standard
+// library logger passed to NewBootStrap.
+func WithLogger(l logging.Logger) Option {
+	return func(f *framework) { f.log = l }
+}
+
+// WithLinkProbing makes the task probe the links to its neighbors with small
+// and large payloads at epoch 0. The baseline latency and bandwidth are
+// reported on the status endpoint, e.g. to spot stragglers and slow links
+// later on.
+func WithLinkProbing() Option {
+	return func(f *framework) { f.probeLinks = true }
+}
+
+// WithProgressTimeout fails the task over if it neither starts an epoch nor
+// calls Framework.ReportProgress within the timeout, catching tasks that are
+// alive but stuck. By default only dead nodes are failed over.
+func WithProgressTimeout(d time.Duration) Option {
+	return func(f *framework) { f.progressTimeout = d }
+}
+
+// WithHeartbeat sets how often the node heartbeats, and how long after the
+// last heartbeat its claim of the task expires, i.e. how soon a dead node is
+// failed over. The default is every second, expiring after 3 seconds. etcd
+// keeps the TTL in whole seconds; a TTL of 0 is three intervals. The TTL is
+// that of etcdutil.TTLs.Heartbeat.
+func WithHeartbeat(interval, ttl time.Duration) Option {
+	return func(f *framework) {
+		f.heartbeatInterval = interval
+		f.ttls.Heartbeat = ttl
+	}
+}
+
+// WithTTLs sets the lifetimes of the records the node keeps in etcd, e.g.
+// its claim of the task and its meta flags. The default is
+// etcdutil.DefaultTTLs.
+func WithTTLs(t etcdutil.TTLs) Option {
+	return func(f *framework) { f.ttls = t }
+}
+
+// WithPhases splits the epochs of the job into phases run in order, each
+// on its own topology (see etcdutil.JobSpec). A task implementing
+// meritop.PhaseObserver learns of every phase it enters. Once all phases are
+// over, the task waits for the controller to shut the job down. All tasks of
+// the job must use the same phases.
+func WithPhases(phases ...Phase) Option {
+	return func(f *framework) { f.phases = phases }
+}
+
+// WithStandby makes the node a hot spare of the job: it joins the standby
+// pool in etcd, which the controller reports, and only takes over tasks that
+// failed or were handed over, leaving those no node has run yet to the nodes
+// started for them. Without it, a node takes any free task, and stands by if
+// there is none.
+func WithStandby() Option {
+	return func(f *framework) { f.standby = true }
+}
+
+// WithResources declares the resources the node has, e.g. GPUs and memory,
+// so that it only takes tasks whose requirements they satisfy (see
+// etcdutil.CreateRequirements). The node advertises them in etcd while it
+// looks for a task. Without it, a node only takes tasks without requirements.
+func WithResources(r etcdutil.Resources) Option {
+	return func(f *framework) { f.resources = r }
+}
+
+// WithSpeculation runs backup copies of stragglers, MapReduce-style: once
+// after has passed in an epoch, a task asks for backups of its neighbors
+// which have no output yet, which nodes started WithBackup run. The epoch
+// takes the metas, data and results of whichever copy of a task outputs
+// first, and the other copy's are discarded. All tasks of the job must use
+// it.
+func WithSpeculation(after time.Duration) Option {
+	return func(f *framework) { f.speculateAfter = after }
+}
+
+// WithBackup makes the node run a backup copy of a straggler of the job (see
+// WithSpeculation) instead of taking a task. The copy starts from the
+// checkpoint of the epoch of the straggler, which the task needs to save
+// every epoch if it is a meritop.Checkpointer, and Start returns once the
+// epoch is over.
+func WithBackup() Option {
+	return func(f *framework) { f.backup = true }
+}
+
+// WithSink writes the results the task emits (see meritop.Framework.Emit) to
+// the sink, e.g. one of pkg/stream. The results of an epoch are written once
+// it is over, before the snapshot of the next one, and retried on failure.
+func WithSink(s stream.Sink) Option {
+	return func(f *framework) { f.sink = s }
+}
+
+// WithCodecs marshals the typed data of the task (see meritop.TypedHandler)
+// with the first codec of given content types, e.g. datacodec.ContentTypeJSON,
+// which the requester accepts, and makes the task accept them for its own
+// requests. By default, tasks use gob, then JSON.
+func WithCodecs(contentTypes ...string) Option {
+	var codecs []datacodec.Codec
+	for _, ct := range contentTypes {
+		c, ok := datacodec.Get(ct)
+		if !ok {
+			panic("framework: no codec of " + ct)
+		}
+		codecs = append(codecs, c)
+	}
+	return func(f *framework) { f.codecs = codecs }
+}
+
+// WithMemoryBudget caps the memory of the buffers the framework holds for the
+// task: data received until DataReady takes it, data served until it is sent
+// and results emitted until they are written. Share one budget among the nodes
+// of a process to cap their overhead together. Received data waits for room,
+// data requests of other tasks are turned away as if the task were busy, and
+// results are dropped. By default, buffers are accounted without limit.
+func WithMemoryBudget(b *membudget.Budget) Option {
+	return func(f *framework) { f.memory = b }
+}
+
+// WithSandbox runs the callbacks of the task in a child process started with
+// cfg, which is restarted from the last snapshot of the task if it crashes,
+// e.g. in cgo code, instead of taking the node down (see pkg/sandbox). The
+// child serves the task builder the node was given, whose tasks can't take
+// the framework calls taking functions, nor switch tasks by phase.
+func WithSandbox(cfg sandbox.Config) Option {
+	return func(f *framework) { f.sandbox = &cfg }
+}
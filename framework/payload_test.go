@@ -0,0 +1,93 @@
+package framework
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// payloadTask receives data into its buffers, and serves it out of them.
+type payloadTask struct {
+	meritop.Task
+	buffers  [][]byte
+	released int
+	ready    [][]byte
+}
+
+func (t *payloadTask) PayloadBuffer(toID uint64, req string, size int) meritop.Payload {
+	buf := make([]byte, size)
+	t.buffers = append(t.buffers, buf)
+	return meritop.Payload{Data: buf, Release: func() { t.released++ }}
+}
+
+func (t *payloadTask) ServePayload(fromID uint64, linkType, req string) (meritop.Payload, error) {
+	return meritop.Payload{Data: []byte(req), Release: func() { t.released++ }}, nil
+}
+
+func (t *payloadTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.ready = append(t.ready, resp)
+}
+
+func TestPayloadReceiver(t *testing.T) {
+	topo := example.NewTreeTopology(2, 3)
+	topo.SetTaskID(0)
+	task := &payloadTask{}
+	f := newTestFramework(t)
+	f.epoch = 1
+	f.topology = topo
+	f.task = task
+	f.httpClient = frameworkhttp.DefaultClient.WithBuffers(f.payloadBuffer)
+	f.running.open(1)
+	s := httptest.NewServer(frameworkhttp.NewDataRequestHandler(f.log, &corruptingGetter{}))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	d, err := f.requestData(addr, &requestToSend{taskID: 1, epoch: 1, req: "param"}, nil)
+	if err != nil {
+		t.Fatalf("requestData failed: %v", err)
+	}
+	if len(task.buffers) != 1 || &d.Data[0] != &task.buffers[0][0] {
+		t.Fatalf("data isn't read into the buffer of the task")
+	}
+	f.handleDataResp(d)
+	if len(task.ready) != 1 || string(task.ready[0]) != "param" || task.released != 0 {
+		t.Errorf("task got %q and %d releases, want param without release", task.ready, task.released)
+	}
+
+	// The buffer of data dropped goes back to the task.
+	d, err = f.requestData(addr, &requestToSend{taskID: 1, epoch: 1, req: "param"}, nil)
+	if err != nil {
+		t.Fatalf("requestData failed: %v", err)
+	}
+	f.running.close()
+	f.handleDataResp(d)
+	if len(task.ready) != 1 || task.released != 1 {
+		t.Errorf("task got %d data and %d releases, want 1 and 1", len(task.ready), task.released)
+	}
+
+	// Calls are read into buffers of the framework.
+	if _, err := f.requestData(addr, &requestToSend{taskID: 1, epoch: 1, req: callPrefix + "sum/"}, nil); err != nil {
+		t.Fatalf("requestData failed: %v", err)
+	}
+	if len(task.buffers) != 2 {
+		t.Errorf("buffers = %d, want 2", len(task.buffers))
+	}
+}
+
+func TestPayloadServer(t *testing.T) {
+	task := &payloadTask{}
+	f := &framework{task: task}
+	dr := &dataRequest{taskID: 1, epoch: 1, req: "param"}
+	d, err := f.serveTask(dr, meritop.LinkParent)
+	if err != nil || string(d) != "param" || dr.release == nil {
+		t.Fatalf("serveTask = (%q, %v), want param with its release", d, err)
+	}
+	// Data copied out of the buffer of the task releases it.
+	if d := ownData(d, dr.release); string(d) != "param" || task.released != 1 {
+		t.Errorf("ownData = %q with %d releases, want param with 1", d, task.released)
+	}
+}
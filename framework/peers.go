@@ -0,0 +1,33 @@
+package framework
+
+import (
+	"strconv"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// watchPeers watches the other tasks failing in current epoch, if the task
+// wants to know.
+func (f *framework) watchPeers() {
+	if _, ok := adapted(f.task).(meritop.PeerFailureObserver); !ok {
+		return
+	}
+	stop := make(chan bool, 1)
+	f.metaStops = append(f.metaStops, stop)
+	epoch := f.epoch
+	go etcdutil.WatchFailure(f.etcdClient, f.name, stop, func(failedTask string) {
+		id, err := strconv.ParseUint(failedTask, 10, 64)
+		if err != nil || id == f.taskID {
+			return
+		}
+		f.events <- &peerFailure{taskID: id, epoch: epoch}
+	})
+}
+
+func (f *framework) handlePeerFailure(e *peerFailure) {
+	f.log.With("epoch", e.epoch).Infof("task %d learns that task %d failed", f.taskID, e.taskID)
+	if o, ok := adapted(f.task).(meritop.PeerFailureObserver); ok {
+		f.spawn(func() { o.PeerFailed(e.taskID) })
+	}
+}
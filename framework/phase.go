@@ -0,0 +1,113 @@
+package framework
+
+import (
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Phase is a stage of the job, see WithPhases.
+type Phase struct {
+	Name   string
+	Epochs uint64
+	// Topology runs the epochs of the phase; nil keeps the topology of the
+	// job.
+	Topology meritop.Topology
+}
+
+// epochTask returns the task the task builder picks for current epoch, or nil
+// if the current task goes on.
+func (f *framework) epochTask() meritop.Task {
+	b, ok := f.taskBuilder.(meritop.PhasedTaskBuilder)
+	if !ok {
+		return nil
+	}
+	return b.GetEpochTask(f.taskID, f.epoch, f.task)
+}
+
+// switchTask hands the state of the current task over to the task of the new
+// epoch, if the task builder picks another one.
+func (f *framework) switchTask() {
+	next := f.epochTask()
+	if next == nil {
+		return
+	}
+	f.log.Infof("task %d switches to %T at epoch %d", f.taskID, next, f.epoch)
+	next.Init(f.taskID, f)
+	if from, ok := adapted(f.task).(meritop.Checkpointer); ok {
+		if to, ok := adapted(next).(meritop.Checkpointer); ok {
+			to.Restore(from.Snapshot())
+		}
+	}
+	f.task.Exit()
+	f.task = next
+}
+
+// enterPhase switches to the phase of current epoch, and its topology. It
+// returns false once all phases are over: the task waits for the controller
+// to shut the job down then.
+func (f *framework) enterPhase() bool {
+	if len(f.phases) == 0 {
+		return true
+	}
+	specs := make([]etcdutil.PhaseSpec, len(f.phases))
+	for i, p := range f.phases {
+		specs[i] = etcdutil.PhaseSpec{Name: p.Name, Epochs: p.Epochs}
+	}
+	i, ok := etcdutil.PhaseAt(specs, f.epoch)
+	if !ok {
+		f.log.Infof("task %d is done with all phases at epoch %d", f.taskID, f.epoch)
+		return false
+	}
+	if p := &f.phases[i]; p != f.phase {
+		f.log.Infof("task %d enters phase %s at epoch %d", f.taskID, p.Name, f.epoch)
+		f.phase = p
+		f.phaseChanged = true
+		if p.Topology != nil {
+			f.topology = p.Topology
+		}
+	}
+	return true
+}
+
+// notifyPhase lets the task know of the phase it runs, before its first
+// epoch.
+func (f *framework) notifyPhase() {
+	if !f.phaseChanged {
+		return
+	}
+	f.phaseChanged = false
+	if o, ok := adapted(f.task).(meritop.PhaseObserver); ok {
+		o.PhaseChanged(f.phase.Name)
+	}
+}
+
+// seedTopologies sets the job-wide seed of the randomized topologies.
+func (f *framework) seedTopologies() {
+	var seeded []meritop.SeededTopology
+	for _, t := range f.topologies() {
+		if st, ok := t.(meritop.SeededTopology); ok {
+			seeded = append(seeded, st)
+		}
+	}
+	if len(seeded) == 0 {
+		return
+	}
+	seed, err := etcdutil.GetSeed(f.etcdClient, f.name)
+	if err != nil {
+		f.log.Fatalf("GetSeed failed: %v", err)
+	}
+	for _, st := range seeded {
+		st.SetSeed(seed)
+	}
+}
+
+// topologies returns the topology of the job and those of its phases.
+func (f *framework) topologies() []meritop.Topology {
+	topos := []meritop.Topology{f.topology}
+	for _, p := range f.phases {
+		if p.Topology != nil {
+			topos = append(topos, p.Topology)
+		}
+	}
+	return topos
+}
@@ -0,0 +1,97 @@
+package framework
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+)
+
+// phaseTask records the calls of the framework, and snapshots its name.
+type phaseTask struct {
+	name   string
+	events *[]string
+}
+
+func (t *phaseTask) record(e string)                                            { *t.events = append(*t.events, t.name+" "+e) }
+func (t *phaseTask) Init(taskID uint64, framework meritop.Framework)            { t.record("Init") }
+func (t *phaseTask) Exit()                                                      { t.record("Exit") }
+func (t *phaseTask) SetEpoch(epoch uint64)                                      {}
+func (t *phaseTask) MetaReady(fromID uint64, linkType, meta string)             {}
+func (t *phaseTask) DataReady(fromID uint64, linkType, req string, resp []byte) {}
+func (t *phaseTask) Serve(fromID uint64, linkType, req string) []byte           { return nil }
+func (t *phaseTask) Snapshot() []byte                                           { return []byte(t.name) }
+func (t *phaseTask) Restore(snapshot []byte)                                    { t.record("Restore " + string(snapshot)) }
+
+// phaseTaskBuilder trains until the last epoch, which evaluates.
+type phaseTaskBuilder struct {
+	lastEpoch uint64
+	events    []string
+}
+
+func (b *phaseTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &phaseTask{name: "train", events: &b.events}
+}
+
+func (b *phaseTaskBuilder) GetEpochTask(taskID, epoch uint64, current meritop.Task) meritop.Task {
+	if epoch == b.lastEpoch && current.(*phaseTask).name != "eval" {
+		return &phaseTask{name: "eval", events: &b.events}
+	}
+	return nil
+}
+
+func TestSwitchTask(t *testing.T) {
+	builder := &phaseTaskBuilder{lastEpoch: 3}
+	f := newTestFramework(t)
+	f.taskBuilder = builder
+	f.task = builder.GetTask(0)
+	for f.epoch = 1; f.epoch <= 3; f.epoch++ {
+		f.switchTask()
+	}
+	want := []string{"eval Init", "eval Restore train", "train Exit"}
+	if !reflect.DeepEqual(builder.events, want) {
+		t.Errorf("events = %v, want %v", builder.events, want)
+	}
+	if f.task.(*phaseTask).name != "eval" {
+		t.Errorf("task runs %s at the last epoch, want eval", f.task.(*phaseTask).name)
+	}
+	// GetEpochTask keeps the evaluation task once it runs.
+	f.switchTask()
+	if len(builder.events) != len(want) {
+		t.Errorf("events = %v, want no switch", builder.events)
+	}
+}
+
+// phaseObserver records the phases it enters.
+type phaseObserver struct {
+	meritop.Task
+	phases []string
+}
+
+func (t *phaseObserver) PhaseChanged(phase string) { t.phases = append(t.phases, phase) }
+
+func TestPhases(t *testing.T) {
+	job := example.NewTreeTopology(2, 3)
+	train := example.NewTreeTopology(1, 3)
+	task := &phaseObserver{}
+	f := newTestFramework(t)
+	f.topology = job
+	f.task = task
+	f.phases = []Phase{{Name: "setup", Epochs: 1}, {Name: "train", Epochs: 2, Topology: train}}
+	for f.epoch = 0; f.epoch < 3; f.epoch++ {
+		if !f.enterPhase() {
+			t.Fatalf("epoch %d is out of phases", f.epoch)
+		}
+		f.notifyPhase()
+		if want := []meritop.Topology{job, train, train}[f.epoch]; f.topology != want {
+			t.Errorf("epoch %d runs on topology %p, want %p", f.epoch, f.topology, want)
+		}
+	}
+	if !reflect.DeepEqual(task.phases, []string{"setup", "train"}) {
+		t.Errorf("phases = %v, want [setup train]", task.phases)
+	}
+	if f.enterPhase() {
+		t.Errorf("epoch 3 is in phase %s, want none", f.phase.Name)
+	}
+}
@@ -0,0 +1,103 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+var preflightTimeout = 5 * time.Second
+
+// PreflightError tells which check failed when a node starts. Checks are run
+// before the node claims a task, so a node which can't work doesn't take a
+// task and wedge the job.
+type PreflightError struct {
+	// One of "etcd", "listener" and "loopback".
+	Check string
+	Err   error
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("framework: preflight check %s failed: %v", e.Check, e.Err)
+}
+
+func (f *framework) preflight() error {
+	if _, err := f.etcdClient.Get(etcdutil.FreeTaskDir(f.name), false, false); err != nil {
+		if etcdutil.IsKeyNotFound(err) {
+			err = fmt.Errorf("job %s is not set up", f.name)
+		}
+		return &PreflightError{"etcd", err}
+	}
+	if f.ln == nil {
+		return &PreflightError{"listener", errors.New("no listener")}
+	}
+	host, _, err := net.SplitHostPort(f.ln.Addr().String())
+	if err != nil {
+		return &PreflightError{"listener", err}
+	}
+	// The address is published for other nodes to connect to.
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return &PreflightError{"listener", fmt.Errorf("address %s is not reachable by other nodes", f.ln.Addr())}
+	}
+	if err := f.loopback(); err != nil {
+		return &PreflightError{"loopback", err}
+	}
+	return nil
+}
+
+// loopback sends a data request to the node itself, the way other nodes will.
+func (f *framework) loopback() error {
+	const req = "preflight"
+	mux := http.NewServeMux()
+	dataHandler := frameworkhttp.NewDataRequestHandler(f.log, echoDataGetter{})
+	mux.Handle(frameworkhttp.DataRequestPrefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Don't keep the connection. The listener is served for real later.
+		w.Header().Set("Connection", "close")
+		dataHandler.ServeHTTP(w, r)
+	}))
+	go http.Serve(&onceListener{Listener: f.ln}, mux)
+
+	errc := make(chan error, 1)
+	go func() {
+		d, err := f.httpClient.RequestData(f.ln.Addr().String(), req, 0, 0, 0, f.log)
+		if err == nil && string(d.Data) != req {
+			err = fmt.Errorf("response %q, want %q", d.Data, req)
+		}
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(preflightTimeout):
+		return fmt.Errorf("no response from %s in %v", f.ln.Addr(), preflightTimeout)
+	}
+}
+
+type echoDataGetter struct{}
+
+func (echoDataGetter) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	return []byte(req), nil
+}
+
+// onceListener accepts a single connection, so that serving it stops after
+// the loopback request without closing the underlying listener.
+type onceListener struct {
+	net.Listener
+	accepted bool
+}
+
+func (l *onceListener) Accept() (net.Conn, error) {
+	if l.accepted {
+		return nil, errors.New("framework: preflight listener is done")
+	}
+	l.accepted = true
+	return l.Listener.Accept()
+}
+
+// Close doesn't close the underlying listener, which is still to be served.
+func (l *onceListener) Close() error { return nil }
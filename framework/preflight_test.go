@@ -0,0 +1,35 @@
+package framework
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// The loopback request goes through the listener, which must be served as
+// usual afterwards.
+func TestPreflightLoopback(t *testing.T) {
+	l := createListener(t)
+	defer l.Close()
+	f := newTestFramework(t)
+	f.ln = l
+	f.httpClient = frameworkhttp.DefaultClient
+	if err := f.loopback(); err != nil {
+		t.Fatalf("loopback failed: %v", err)
+	}
+
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}))
+	resp, err := http.Get("http://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Get after loopback failed: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if string(b) != "served" {
+		t.Errorf("response want = %q, get = %q", "served", b)
+	}
+}
@@ -0,0 +1,116 @@
+package framework
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+var (
+	probeSmall   = 64
+	probeLarge   = 1 << 20
+	probeTimeout = 10 * time.Second
+)
+
+type link struct {
+	taskID   uint64
+	linkType string
+}
+
+// linkStats are the baseline of links measured at warm-up.
+type linkStats struct {
+	mu    sync.Mutex
+	links map[link]frameworkhttp.LinkStatus
+}
+
+func (s *linkStats) set(l link, ls frameworkhttp.LinkStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.links == nil {
+		s.links = make(map[link]frameworkhttp.LinkStatus)
+	}
+	s.links[l] = ls
+}
+
+func (s *linkStats) list() []frameworkhttp.LinkStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ls []frameworkhttp.LinkStatus
+	for _, st := range s.links {
+		ls = append(ls, st)
+	}
+	sort.Sort(byLink(ls))
+	return ls
+}
+
+type byLink []frameworkhttp.LinkStatus
+
+func (b byLink) Len() int      { return len(b) }
+func (b byLink) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byLink) Less(i, j int) bool {
+	if b[i].LinkType != b[j].LinkType {
+		return b[i].LinkType < b[j].LinkType
+	}
+	return b[i].TaskID < b[j].TaskID
+}
+
+// warmUp probes the links to all neighbors at epoch 0 in the background. It
+// doesn't hold up the epoch; neighbors which aren't up yet are retried until
+// probeTimeout.
+func (f *framework) warmUp() {
+	var links []link
+	for _, linkType := range f.topology.GetLinkTypes() {
+		for _, id := range f.topology.GetNeighbors(linkType, f.epoch) {
+			links = append(links, link{id, linkType})
+		}
+	}
+	for _, l := range links {
+		go f.probeLink(l)
+	}
+}
+
+func (f *framework) probeLink(l link) {
+	deadline := time.Now().Add(probeTimeout)
+	for {
+		ls, err := f.probe(l)
+		if err == nil {
+			f.links.set(l, ls)
+			return
+		}
+		if time.Now().After(deadline) {
+			f.log.Warnf("task %d failed to probe %s link to task %d: %v", f.taskID, l.linkType, l.taskID, err)
+			return
+		}
+		time.Sleep(probeTimeout / 20)
+	}
+}
+
+// probe takes the best of a few small probes as latency, since the first
+// ones include setting up the connection.
+func (f *framework) probe(l link) (frameworkhttp.LinkStatus, error) {
+	ls := frameworkhttp.LinkStatus{TaskID: l.taskID, LinkType: l.linkType}
+	addr, err := etcdutil.GetAddress(f.etcdClient, f.name, l.taskID)
+	if err != nil {
+		return ls, err
+	}
+	var latency time.Duration
+	for i := 0; i < 3; i++ {
+		d, err := f.httpClient.Probe(addr, probeSmall)
+		if err != nil {
+			return ls, err
+		}
+		if i == 0 || d < latency {
+			latency = d
+		}
+	}
+	d, err := f.httpClient.Probe(addr, probeLarge)
+	if err != nil {
+		return ls, err
+	}
+	ls.LatencyNs = latency.Nanoseconds()
+	ls.BytesPerSecond = float64(probeLarge) / d.Seconds()
+	return ls, nil
+}
@@ -3,11 +3,10 @@ package framework
 import (
 	"encoding/json"
 	"log"
-	"math/rand"
 	"os"
-	"strconv"
 
 	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/faultinject"
 )
 
 /*
@@ -44,7 +43,7 @@ type dummyMaster struct {
 	framework     meritop.Framework
 	epoch, taskID uint64
 	logger        *log.Logger
-	config        map[string]string
+	faults        *faultinject.Schedule
 
 	param, gradient *dummyData
 	fromChildren    map[uint64]*dummyData
@@ -61,9 +60,11 @@ func (t *dummyMaster) Init(taskID uint64, framework meritop.Framework) {
 // Task need to finish up for exit, last chance to save work?
 func (t *dummyMaster) Exit() {}
 
-// Ideally, we should also have the following:
-func (t *dummyMaster) ParentMetaReady(parentID uint64, meta string) {}
-func (t *dummyMaster) ChildMetaReady(childID uint64, meta string) {
+// Master is the root of the tree. It only talks to children.
+func (t *dummyMaster) MetaReady(childID uint64, linkType, meta string) {
+	if linkType != meritop.LinkChild {
+		return
+	}
 	t.logger.Printf("master ChildMetaReady, task: %d, epoch: %d, child: %d\n", t.taskID, t.epoch, childID)
 	// Get data from child. When all the data is back, starts the next epoch.
 	t.framework.DataRequest(childID, meta)
@@ -72,14 +73,14 @@ func (t *dummyMaster) ChildMetaReady(childID uint64, meta string) {
 // This give the task an opportunity to cleanup and regroup.
 func (t *dummyMaster) SetEpoch(epoch uint64) {
 	t.logger.Printf("master SetEpoch, task: %d, epoch: %d\n", t.taskID, epoch)
-	if t.testablyFail("SetEpoch", strconv.FormatUint(epoch, 10)) {
+	t.epoch = epoch
+	if t.testablyFail(faultinject.SetEpoch, "") {
 		return
 	}
 
 	t.param = &dummyData{}
 	t.gradient = &dummyData{}
 
-	t.epoch = epoch
 	t.param.Value = int32(t.epoch)
 
 	// Make sure we have a clean slate.
@@ -88,7 +89,10 @@ func (t *dummyMaster) SetEpoch(epoch uint64) {
 }
 
 // These are payload rpc for application purpose.
-func (t *dummyMaster) ServeAsParent(fromID uint64, req string) []byte {
+func (t *dummyMaster) Serve(fromID uint64, linkType, req string) []byte {
+	if linkType != meritop.LinkChild {
+		return nil
+	}
 	b, err := json.Marshal(t.param)
 	if err != nil {
 		t.logger.Fatalf("Master can't encode parameter: %v, error: %v\n", t.param, err)
@@ -96,12 +100,10 @@ func (t *dummyMaster) ServeAsParent(fromID uint64, req string) []byte {
 	return b
 }
 
-func (t *dummyMaster) ServeAsChild(fromID uint64, req string) []byte {
-	return nil
-}
-
-func (t *dummyMaster) ParentDataReady(parentID uint64, req string, resp []byte) {}
-func (t *dummyMaster) ChildDataReady(childID uint64, req string, resp []byte) {
+func (t *dummyMaster) DataReady(childID uint64, linkType, req string, resp []byte) {
+	if linkType != meritop.LinkChild {
+		return
+	}
 	t.logger.Printf("master ChildDataReady, task: %d, epoch: %d, child: %d, ready: %d\n",
 		t.taskID, t.epoch, childID, len(t.fromChildren))
 	d := new(dummyData)
@@ -114,7 +116,7 @@ func (t *dummyMaster) ChildDataReady(childID uint64, req string, resp []byte) {
 	// This is a weak form of checking. We can also check the task ids.
 	// But this really means that we get all the events from children, we
 	// should go into the next epoch now.
-	if len(t.fromChildren) == len(t.framework.GetTopology().GetChildren(t.epoch)) {
+	if len(t.fromChildren) == len(t.framework.GetTopology().GetNeighbors(meritop.LinkChild, t.epoch)) {
 		for _, g := range t.fromChildren {
 			t.gradient.Value += g.Value
 		}
@@ -134,23 +136,12 @@ func (t *dummyMaster) ChildDataReady(childID uint64, req string, resp []byte) {
 	}
 }
 
-func (t *dummyMaster) testablyFail(method string, args ...string) bool {
-	if t.config == nil {
+func (t *dummyMaster) testablyFail(callback, linkType string) bool {
+	p := faultinject.Point{TaskID: t.taskID, Epoch: t.epoch, Callback: callback, LinkType: linkType}
+	if !t.faults.ShouldFail(p) {
 		return false
 	}
-	if t.config[method] != "fail" {
-		return false
-	}
-	if len(args) >= 1 && t.config["failepoch"] != "" {
-		// we need to care about fail at specific epoch
-		if t.config["failepoch"] != args[0] {
-			return false
-		}
-	}
-	if !probablyFail(t.config["faillevel"]) {
-		return false
-	}
-	t.logger.Printf("master task %d testably fail, method: %s\n", t.taskID, method)
+	t.logger.Printf("master task %d testably fail, method: %s\n", t.taskID, callback)
 	t.framework.(*framework).stop()
 	t.NodeProducer <- true
 	return true
@@ -164,7 +155,7 @@ type dummySlave struct {
 	epoch, taskID uint64
 	logger        *log.Logger
 	NodeProducer  chan bool
-	config        map[string]string
+	faults        *faultinject.Schedule
 
 	param, gradient *dummyData
 	fromChildren    map[uint64]*dummyData
@@ -181,15 +172,10 @@ func (t *dummySlave) Init(taskID uint64, framework meritop.Framework) {
 // Task need to finish up for exit, last chance to save work?
 func (t *dummySlave) Exit() {}
 
-// Ideally, we should also have the following:
-func (t *dummySlave) ParentMetaReady(parentID uint64, meta string) {
-	t.logger.Printf("slave ParentMetaReady, task: %d, epoch: %d\n", t.taskID, t.epoch)
-	t.framework.DataRequest(parentID, meta)
-}
-
-func (t *dummySlave) ChildMetaReady(childID uint64, meta string) {
-	t.logger.Printf("slave ChildMetaReady, task: %d, epoch: %d\n", t.taskID, t.epoch)
-	t.framework.DataRequest(childID, meta)
+// Slave pulls parameter from parent and gradient from children.
+func (t *dummySlave) MetaReady(fromID uint64, linkType, meta string) {
+	t.logger.Printf("slave MetaReady, task: %d, epoch: %d, link: %s\n", t.taskID, t.epoch, linkType)
+	t.framework.DataRequest(fromID, meta)
 }
 
 // This give the task an opportunity to cleanup and regroup.
@@ -204,25 +190,34 @@ func (t *dummySlave) SetEpoch(epoch uint64) {
 }
 
 // These are payload rpc for application purpose.
-func (t *dummySlave) ServeAsParent(fromID uint64, req string) []byte {
-	b, err := json.Marshal(t.param)
+// Children get parameter from us, parent gets gradient.
+func (t *dummySlave) Serve(fromID uint64, linkType, req string) []byte {
+	var b []byte
+	var err error
+	switch linkType {
+	case meritop.LinkChild:
+		b, err = json.Marshal(t.param)
+	case meritop.LinkParent:
+		b, err = json.Marshal(t.gradient)
+	}
 	if err != nil {
-		t.logger.Fatalf("Slave can't encode parameter: %v, error: %v\n", t.param, err)
+		t.logger.Fatalf("Slave can't encode data for %s: %v\n", linkType, err)
 	}
 	return b
 }
 
-func (t *dummySlave) ServeAsChild(fromID uint64, req string) []byte {
-	b, err := json.Marshal(t.gradient)
-	if err != nil {
-		t.logger.Fatalf("Slave can't encode gradient: %v, error: %v\n", t.gradient, err)
+func (t *dummySlave) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	switch linkType {
+	case meritop.LinkParent:
+		t.parentDataReady(fromID, req, resp)
+	case meritop.LinkChild:
+		t.childDataReady(fromID, req, resp)
 	}
-	return b
 }
 
-func (t *dummySlave) ParentDataReady(parentID uint64, req string, resp []byte) {
+func (t *dummySlave) parentDataReady(parentID uint64, req string, resp []byte) {
 	t.logger.Printf("slave ParentDataReady, task: %d, epoch: %d, parent: %d\n", t.taskID, t.epoch, parentID)
-	if t.testablyFail("ParentDataReady") {
+	if t.testablyFail(faultinject.DataReady, meritop.LinkParent) {
 		return
 	}
 	t.param = new(dummyData)
@@ -233,7 +228,7 @@ func (t *dummySlave) ParentDataReady(parentID uint64, req string, resp []byte) {
 
 	// If this task has children, flag meta so that children can start pull
 	// parameter.
-	children := t.framework.GetTopology().GetChildren(t.epoch)
+	children := t.framework.GetTopology().GetNeighbors(meritop.LinkChild, t.epoch)
 	if len(children) != 0 {
 		t.framework.FlagMetaToChild("ParamReady")
 	} else {
@@ -243,7 +238,7 @@ func (t *dummySlave) ParentDataReady(parentID uint64, req string, resp []byte) {
 	}
 }
 
-func (t *dummySlave) ChildDataReady(childID uint64, req string, resp []byte) {
+func (t *dummySlave) childDataReady(childID uint64, req string, resp []byte) {
 	t.logger.Printf("slave ChildDataReady, task: %d, epoch: %d, child: %d\n", t.taskID, t.epoch, childID)
 	d := new(dummyData)
 	json.Unmarshal(resp, d)
@@ -254,14 +249,14 @@ func (t *dummySlave) ChildDataReady(childID uint64, req string, resp []byte) {
 	// This is a weak form of checking. We can also check the task ids.
 	// But this really means that we get all the events from children, we
 	// should go into the next epoch now.
-	if len(t.fromChildren) == len(t.framework.GetTopology().GetChildren(t.epoch)) {
+	if len(t.fromChildren) == len(t.framework.GetTopology().GetNeighbors(meritop.LinkChild, t.epoch)) {
 		// In real ML, we add the gradient first.
 		for _, g := range t.fromChildren {
 			t.gradient.Value += g.Value
 		}
 
 		// If this failure happens, a new node will redo computing again.
-		if t.testablyFail("ChildDataReady") {
+		if t.testablyFail(faultinject.DataReady, meritop.LinkChild) {
 			return
 		}
 
@@ -274,46 +269,31 @@ func (t *dummySlave) ChildDataReady(childID uint64, req string, resp []byte) {
 		//   1.2 request the data with a failed host (request should fail or be
 		//       responded with error message).
 		// 2. already get the data.
-		if t.testablyFail("ChildDataReady") {
+		if t.testablyFail(faultinject.DataReady, meritop.LinkChild) {
 			return
 		}
 	}
 }
 
-func (t *dummySlave) testablyFail(method string, args ...string) bool {
-	if t.config == nil {
-		return false
-	}
-	if t.config[method] != "fail" {
-		return false
-	}
-	if !probablyFail(t.config["faillevel"]) {
+func (t *dummySlave) testablyFail(callback, linkType string) bool {
+	p := faultinject.Point{TaskID: t.taskID, Epoch: t.epoch, Callback: callback, LinkType: linkType}
+	if !t.faults.ShouldFail(p) {
 		return false
 	}
-	t.logger.Printf("slave task %d testably fail, method: %s\n", t.taskID, method)
+	t.logger.Printf("slave task %d testably fail, method: %s, link: %s\n", t.taskID, callback, linkType)
 	t.framework.(*framework).stop()
 	t.NodeProducer <- true
 	return true
 }
 
-func probablyFail(levelStr string) bool {
-	level, err := strconv.Atoi(levelStr)
-	if err != nil {
-		return false
-	}
-	if level < rand.Intn(100)+1 {
-		return false
-	}
-	return true
-}
-
 // used for testing
 type SimpleTaskBuilder struct {
 	GDataChan    chan int32
 	FinishChan   chan struct{}
 	NodeProducer chan bool
-	MasterConfig map[string]string
-	SlaveConfig  map[string]string
+	// Faults to inject into the master and slave tasks, if any.
+	MasterFaults *faultinject.Schedule
+	SlaveFaults  *faultinject.Schedule
 }
 
 // This method is called once by framework implementation to get the
@@ -325,11 +305,11 @@ func (tc SimpleTaskBuilder) GetTask(taskID uint64) meritop.Task {
 			dataChan:     tc.GDataChan,
 			finishChan:   tc.FinishChan,
 			NodeProducer: tc.NodeProducer,
-			config:       tc.MasterConfig,
+			faults:       tc.MasterFaults,
 		}
 	}
 	return &dummySlave{
 		NodeProducer: tc.NodeProducer,
-		config:       tc.SlaveConfig,
+		faults:       tc.SlaveFaults,
 	}
 }
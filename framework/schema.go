@@ -0,0 +1,101 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// Schema is the contract of the data served for a request name, checked on
+// data responses before DataReady, see WithSchema.
+type Schema interface {
+	Validate(data []byte) error
+}
+
+// SchemaFunc is a Schema checking data with the function, e.g. one decoding a
+// protobuf message.
+type SchemaFunc func(data []byte) error
+
+func (s SchemaFunc) Validate(data []byte) error { return s(data) }
+
+// SizeSchema requires data of Min to Max bytes. Zero Max is no upper bound.
+type SizeSchema struct {
+	Min, Max int
+}
+
+func (s SizeSchema) Validate(data []byte) error {
+	if len(data) < s.Min || s.Max > 0 && len(data) > s.Max {
+		return fmt.Errorf("%d bytes, want %d to %d", len(data), s.Min, s.Max)
+	}
+	return nil
+}
+
+// VectorSchema requires data of Dim values of Width bytes each, e.g. a
+// vector of Dim float64 has Width 8.
+type VectorSchema struct {
+	Dim, Width int
+}
+
+func (s VectorSchema) Validate(data []byte) error {
+	if len(data) != s.Dim*s.Width {
+		return fmt.Errorf("%d bytes, want %d values of %d bytes", len(data), s.Dim, s.Width)
+	}
+	return nil
+}
+
+// JSONSchema requires data that decodes as JSON into the values returned by
+// New, and that they are Valid, if set.
+type JSONSchema struct {
+	New   func() interface{}
+	Valid func(v interface{}) error
+}
+
+func (s JSONSchema) Validate(data []byte) error {
+	v := s.New()
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if s.Valid != nil {
+		return s.Valid(v)
+	}
+	return nil
+}
+
+// requestName is the name of a request, which goes up to the first "/", so
+// that requests may carry arguments, e.g. "exchange/3".
+func requestName(req string) string {
+	if i := strings.Index(req, "/"); i >= 0 {
+		return req[:i]
+	}
+	return req
+}
+
+// validate checks a data response against the schema of its request name,
+// if any. A response breaking the contract is dropped, and reported with its
+// sender, as the task would otherwise fail on it later, far from the cause.
+func (f *framework) validate(resp *frameworkhttp.DataResponse) bool {
+	schema, ok := f.schemas[requestName(resp.Req)]
+	if !ok {
+		return true
+	}
+	err := schema.Validate(resp.Data)
+	if err == nil {
+		return true
+	}
+	f.invalidData(resp, fmt.Errorf("breaks its schema: %v", err))
+	return false
+}
+
+// invalidData drops a data response which the task can't take, e.g. as it
+// breaks its schema, and reports it with the reason.
+func (f *framework) invalidData(resp *frameworkhttp.DataResponse, reason error) {
+	err := fmt.Errorf("response of task %d to %q at epoch %d %v", resp.TaskID, resp.Req, resp.Epoch, reason)
+	f.metrics.schemaViolations.Inc()
+	f.log.With("epoch", resp.Epoch).Errorf("task %d drops %v", f.taskID, err)
+	if o, ok := adapted(f.task).(meritop.InvalidDataObserver); ok {
+		o.InvalidData(resp.TaskID, resp.Req, err)
+	}
+}
@@ -0,0 +1,87 @@
+package framework
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+func TestSchemas(t *testing.T) {
+	type point struct{ X, Y float64 }
+	positive := JSONSchema{
+		New: func() interface{} { return new(point) },
+		Valid: func(v interface{}) error {
+			if p := v.(*point); p.X < 0 || p.Y < 0 {
+				return errors.New("negative coordinate")
+			}
+			return nil
+		},
+	}
+	tests := []struct {
+		schema Schema
+		data   string
+		ok     bool
+	}{
+		{SizeSchema{Min: 1, Max: 3}, "ab", true},
+		{SizeSchema{Min: 1, Max: 3}, "", false},
+		{SizeSchema{Min: 1, Max: 3}, "abcd", false},
+		{SizeSchema{Min: 1}, "abcdefgh", true},
+		{VectorSchema{Dim: 2, Width: 8}, "0123456789abcdef", true},
+		{VectorSchema{Dim: 2, Width: 8}, "01234567", false},
+		{positive, `{"X": 1, "Y": 2}`, true},
+		{positive, `{"X": -1, "Y": 2}`, false},
+		{positive, `{"X": 1`, false},
+		{SchemaFunc(func([]byte) error { return nil }), "any", true},
+	}
+	for i, tt := range tests {
+		if err := tt.schema.Validate([]byte(tt.data)); (err == nil) != tt.ok {
+			t.Errorf("#%d: Validate(%q) = %v, want ok %v", i, tt.data, err, tt.ok)
+		}
+	}
+}
+
+type schemaTask struct {
+	meritop.Task
+	ready   []string
+	invalid []string
+}
+
+func (t *schemaTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.ready = append(t.ready, string(resp))
+}
+
+func (t *schemaTask) InvalidData(fromID uint64, req string, err error) {
+	t.invalid = append(t.invalid, req)
+}
+
+func TestWithSchema(t *testing.T) {
+	topo := example.NewTreeTopology(2, 3)
+	topo.SetTaskID(0)
+	task := &schemaTask{}
+	f := newTestFramework(t)
+	f.epoch = 1
+	f.topology = topo
+	f.task = task
+	WithSchema("vector", VectorSchema{Dim: 2, Width: 1})(f)
+	f.running.open(1)
+
+	for _, resp := range []*frameworkhttp.DataResponse{
+		{TaskID: 1, Epoch: 1, Req: "vector", Data: []byte("ab")},
+		{TaskID: 1, Epoch: 1, Req: "vector/3", Data: []byte("abc")},
+		{TaskID: 2, Epoch: 1, Req: "other", Data: []byte("abc")},
+	} {
+		f.handleDataResp(resp)
+	}
+	if len(task.ready) != 2 || task.ready[0] != "ab" || task.ready[1] != "abc" {
+		t.Errorf("task got %v, want ab and abc", task.ready)
+	}
+	if len(task.invalid) != 1 || task.invalid[0] != "vector/3" {
+		t.Errorf("invalid data = %v, want vector/3", task.invalid)
+	}
+	if n := f.metrics.schemaViolations.Value(); n != 1 {
+		t.Errorf("schema violations = %d, want 1", n)
+	}
+}
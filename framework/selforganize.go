@@ -0,0 +1,24 @@
+package framework
+
+import (
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// selfOrganize sets up the etcd layout of the job unless another node has, so
+// that the job runs without a controller (see WithSelfOrganize). The node
+// setting it up also reports failed tasks.
+func (f *framework) selfOrganize() error {
+	ctl := controller.New(f.name, f.etcdClient, f.selfOrganizeTasks)
+	ctl.SetRetryPolicy(f.retry)
+	setup, err := etcdutil.SetupLayoutOnce(f.etcdClient, f.name, ctl.EnsureEtcdLayout)
+	if err != nil {
+		return err
+	}
+	if setup {
+		f.log.Infof("node set up the layout of the job with %d tasks", f.selfOrganizeTasks)
+		ctl.Supervise()
+		f.supervisor = ctl
+	}
+	return nil
+}
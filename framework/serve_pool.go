@@ -0,0 +1,102 @@
+package framework
+
+import (
+	"time"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// servePool serves data requests on a fixed number of workers, so that a
+// parent with dozens of children doesn't call Serve for all of them at once.
+// Requests beyond the backlog are turned away with ErrServerBusy rather than
+// piling up in memory; their requesters retry them (see WithServeWorkers).
+type servePool struct {
+	workers int
+	// admitted requests, either being served or waiting for a worker
+	slots chan struct{}
+	jobs  chan func()
+}
+
+func newServePool(workers, backlog int) *servePool {
+	if workers < 1 || backlog < 0 {
+		panic("framework: serve pool needs a worker and a non-negative backlog")
+	}
+	return &servePool{
+		workers: workers,
+		slots:   make(chan struct{}, workers+backlog),
+		// Admission bounds the jobs, so queuing one never blocks.
+		jobs: make(chan func(), workers+backlog),
+	}
+}
+
+func (p *servePool) start() {
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for fn := range p.jobs {
+				fn()
+			}
+		}()
+	}
+}
+
+// stop lets the workers go once the queued jobs are done. No job may be
+// queued afterwards.
+func (p *servePool) stop() { close(p.jobs) }
+
+// admit takes a slot for a request, unless the pool is full.
+func (p *servePool) admit() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// done frees the slot of a request once it is responded.
+func (p *servePool) done() { <-p.slots }
+
+// run queues a job of an admitted request.
+func (p *servePool) run(fn func()) { p.jobs <- fn }
+
+// backoffs of requests to busy servers
+var (
+	busyBackoff    = 10 * time.Millisecond
+	maxBusyBackoff = time.Second
+)
+
+// requestData requests data of a task, retrying while its server is busy,
+// or, unless cancel is nil, while it hasn't joined the epoch of the request,
+// e.g. as a collective of the epoch reaches it first. It gives up with
+// ErrCanceled once cancel is closed, or ErrServerClosed if the node stops
+// meanwhile.
+func (f *framework) requestData(addr string, dr *requestToSend, cancel <-chan struct{}) (*frameworkhttp.DataResponse, error) {
+	backoff := busyBackoff
+	for {
+		d, err := f.httpClient.RequestDataCancel(addr, dr.req, f.taskID, dr.taskID, dr.epoch, cancel, f.log)
+		switch {
+		case err == frameworkhttp.ErrServerBusy:
+			f.log.Debugf("task %d is busy, retrying data request in %v", dr.taskID, backoff)
+			if f.speculative() {
+				// Another copy of the task might have taken the epoch.
+				if a, err := f.taskAddress(dr.taskID, dr.epoch); err == nil {
+					addr = a
+				}
+			}
+		case err == frameworkhttp.ErrReqEpochMismatch && cancel != nil:
+			f.log.Debugf("task %d isn't at epoch %d, retrying data request in %v", dr.taskID, dr.epoch, backoff)
+		default:
+			return d, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-cancel:
+			return nil, frameworkhttp.ErrCanceled
+		case <-f.httpStop:
+			return nil, frameworkhttp.ErrServerClosed
+		}
+		if backoff *= 2; backoff > maxBusyBackoff {
+			backoff = maxBusyBackoff
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package framework
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/membudget"
+)
+
+func TestServePool(t *testing.T) {
+	p := newServePool(2, 1)
+	for i := 0; i < 3; i++ {
+		if !p.admit() {
+			t.Fatalf("#%d: request turned away within workers and backlog", i)
+		}
+	}
+	if p.admit() {
+		t.Fatalf("request admitted beyond workers and backlog")
+	}
+
+	p.start()
+	defer p.stop()
+	var (
+		mu            sync.Mutex
+		running, most int
+		release       = make(chan struct{})
+		wg            sync.WaitGroup
+	)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		p.run(func() {
+			defer wg.Done()
+			defer p.done()
+			mu.Lock()
+			if running++; running > most {
+				most = running
+			}
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if most != 2 {
+		t.Errorf("most jobs running at once = %d, want 2", most)
+	}
+	if !p.admit() {
+		t.Errorf("request turned away after the others are done")
+	}
+}
+
+// busyGetter turns the first requests away as a full serve pool does.
+type busyGetter struct {
+	mu   sync.Mutex
+	busy int
+}
+
+func (g *busyGetter) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.busy > 0 {
+		g.busy--
+		return nil, frameworkhttp.ErrServerBusy
+	}
+	return []byte(req), nil
+}
+
+func TestServeWorkersBackPressure(t *testing.T) {
+	f := newTestFramework(t)
+	f.servePool = newServePool(1, 0)
+	f.servePool.admit()
+	if _, err := f.GetTaskData(1, 0, "param"); err != frameworkhttp.ErrServerBusy {
+		t.Errorf("GetTaskData error = %v, want %v", err, frameworkhttp.ErrServerBusy)
+	}
+	if n := f.metrics.requestsRejected.Value(); n != 1 {
+		t.Errorf("rejected = %d, want 1", n)
+	}
+
+	defer func(d time.Duration) { busyBackoff = d }(busyBackoff)
+	busyBackoff = time.Millisecond
+	g := &busyGetter{busy: 2}
+	s := httptest.NewServer(frameworkhttp.NewDataRequestHandler(f.log, g))
+	defer s.Close()
+	f.httpClient = frameworkhttp.DefaultClient
+	d, err := f.requestData(strings.TrimPrefix(s.URL, "http://"), &requestToSend{taskID: 1, req: "param"}, nil)
+	if err != nil {
+		t.Fatalf("requestData failed: %v", err)
+	}
+	if string(d.Data) != "param" || g.busy != 0 {
+		t.Errorf("data = %q after %d busy responses left, want %q after none", d.Data, g.busy, "param")
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	topo := example.NewTreeTopology(2, 2)
+	topo.SetTaskID(0)
+	f := newTestFramework(t)
+	f.epoch = 1
+	f.topology = topo
+	f.task = &testableTask{dataMap: map[string][]byte{"big": []byte("123456"), "small": []byte("12")}}
+	f.memory = membudget.New(4)
+	f.sink = &flakySink{written: make(map[uint64][]string)}
+	defer close(f.httpStop)
+	go func() {
+		for ev := range f.events {
+			f.step(ev)
+		}
+	}()
+
+	// Another buffer holds 2 bytes.
+	f.memory.TryAcquire(2)
+	if _, err := f.GetTaskData(1, 1, "big"); err != frameworkhttp.ErrServerBusy {
+		t.Errorf("GetTaskData beyond the budget = %v, want %v", err, frameworkhttp.ErrServerBusy)
+	}
+	if d, err := f.GetTaskData(1, 1, "small"); err != nil || string(d) != "12" {
+		t.Errorf("GetTaskData within the budget = (%q, %v), want 12", d, err)
+	}
+	if n := f.memory.Used(); n != 2 {
+		t.Errorf("used = %d after data is sent, want 2", n)
+	}
+	f.memory.Release(2)
+
+	// Stale data gives its memory back, as does data the task takes.
+	f.memory.TryAcquire(3)
+	f.events <- &frameworkhttp.DataResponse{TaskID: 1, Epoch: 0, Req: "req", Data: []byte("abc")}
+	for i := 0; i < 100 && f.memory.Used() != 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := f.memory.Used(); n != 0 {
+		t.Fatalf("used = %d after stale data is dropped, want 0", n)
+	}
+	f.Emit([]byte("r1"))
+	f.Emit([]byte("r2"))
+	f.Emit([]byte("r3"))
+	if n := f.memory.Used(); n != 4 {
+		t.Errorf("used = %d with two results, want 4", n)
+	}
+	f.writeResults()
+	if n := f.memory.Used(); n != 0 {
+		t.Errorf("used = %d after results are written, want 0", n)
+	}
+	if got := f.sink.(*flakySink).written[1]; len(got) != 2 {
+		t.Errorf("results written = %v, want 2 of 3", got)
+	}
+}
@@ -0,0 +1,43 @@
+package framework
+
+import (
+	"bytes"
+	"hash/crc32"
+	"time"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// shadowRequest duplicates a data request responded over HTTP in primary
+// over the shadow transport, and reports whether the candidate gets the same
+// data, and how fast. The task doesn't wait for it.
+func (f *framework) shadowRequest(addr string, dr *requestToSend, cancel <-chan struct{}, d *frameworkhttp.DataResponse, primary time.Duration) {
+	// Calls aren't idempotent.
+	if isCall(dr.req) {
+		return
+	}
+	start := time.Now()
+	sd, err := f.shadow.RequestDataCancel(addr, dr.req, f.taskID, dr.taskID, dr.epoch, cancel, f.log)
+	if err == frameworkhttp.ErrCanceled {
+		return
+	}
+	elapsed := time.Since(start)
+	f.metrics.shadowRequests.Inc()
+	f.metrics.primaryLatency.Add(uint64(primary / time.Microsecond))
+	f.metrics.shadowLatency.Add(uint64(elapsed / time.Microsecond))
+	if err != nil {
+		f.metrics.shadowErrors.Inc()
+		f.log.Warnf("task %d: data request %q to task %d at epoch %d failed over the shadow transport: %v",
+			f.taskID, dr.req, dr.taskID, dr.epoch, err)
+		return
+	}
+	if bytes.Equal(d.Data, sd.Data) {
+		f.log.Debugf("task %d: data request %q to task %d took %v over HTTP, %v over the shadow transport",
+			f.taskID, dr.req, dr.taskID, primary, elapsed)
+		return
+	}
+	f.metrics.shadowMismatches.Inc()
+	f.log.Errorf("task %d: data of request %q to task %d at epoch %d differs over the shadow transport: %d bytes, crc32 %08x, over HTTP %d bytes, crc32 %08x",
+		f.taskID, dr.req, dr.taskID, dr.epoch,
+		len(sd.Data), crc32.ChecksumIEEE(sd.Data), len(d.Data), crc32.ChecksumIEEE(d.Data))
+}
@@ -0,0 +1,72 @@
+package framework
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// corruptingTransport is a candidate transport corrupting "flaky", and
+// failing "lost".
+type corruptingTransport struct {
+	frameworkhttp.DataTransport
+}
+
+func (t corruptingTransport) RequestDataCancel(addr string, req string, from, to, epoch uint64, cancel <-chan struct{}, logger logging.Logger) (*frameworkhttp.DataResponse, error) {
+	switch req {
+	case "flaky":
+		return &frameworkhttp.DataResponse{Data: []byte("flakz")}, nil
+	case "lost":
+		return nil, frameworkhttp.ErrServerClosed
+	}
+	return t.DataTransport.RequestDataCancel(addr, req, from, to, epoch, cancel, logger)
+}
+
+func TestShadowTransport(t *testing.T) {
+	f := newTestFramework(t)
+	f.httpClient = frameworkhttp.DefaultClient
+	f.shadow = corruptingTransport{frameworkhttp.DefaultClient}
+	g := &corruptingGetter{}
+	s := httptest.NewServer(frameworkhttp.NewDataRequestHandler(f.log, g))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	tests := []struct {
+		req        string
+		fetches    int
+		shadowed   uint64
+		mismatches uint64
+		errors     uint64
+	}{
+		{"param", 2, 1, 0, 0},
+		{"flaky", 1, 2, 1, 0},
+		{"lost", 1, 3, 1, 1},
+		// Calls aren't duplicated.
+		{callPrefix + "sum/", 1, 3, 1, 1},
+	}
+	for i, tt := range tests {
+		g.n = 0
+		dr := &requestToSend{taskID: 1, req: tt.req}
+		d, err := f.requestData(addr, dr, nil)
+		if err != nil {
+			t.Fatalf("#%d: requestData failed: %v", i, err)
+		}
+		f.shadowRequest(addr, dr, nil, d, 0)
+		if g.n != tt.fetches {
+			t.Errorf("#%d: fetches = %d, want %d", i, g.n, tt.fetches)
+		}
+		m := f.metrics
+		if n := m.shadowRequests.Value(); n != tt.shadowed {
+			t.Errorf("#%d: shadow requests = %d, want %d", i, n, tt.shadowed)
+		}
+		if n := m.shadowMismatches.Value(); n != tt.mismatches {
+			t.Errorf("#%d: mismatches = %d, want %d", i, n, tt.mismatches)
+		}
+		if n := m.shadowErrors.Value(); n != tt.errors {
+			t.Errorf("#%d: errors = %d, want %d", i, n, tt.errors)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package framework
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// shardState is the shard assignment of current epoch: the one the task
+// published, if any, and the shards the task was told of.
+type shardState struct {
+	published *etcdutil.ShardAssignment
+	received  []string
+	notified  bool
+}
+
+// AssignShards publishes the assignment of current epoch through the event
+// loop, which then reassigns the shards of failed tasks.
+func (f *framework) AssignShards(shards map[uint64][]string) {
+	a := &etcdutil.ShardAssignment{Epoch: f.epoch, Shards: make(map[uint64][]string, len(shards))}
+	for id, s := range shards {
+		a.Shards[id] = append([]string(nil), s...)
+	}
+	f.events <- &shardsToAssign{assignment: a}
+}
+
+func (f *framework) handleShardsToAssign(e *shardsToAssign) {
+	if f.shards.published == nil {
+		stop := make(chan bool, 1)
+		f.metaStops = append(f.metaStops, stop)
+		epoch := f.epoch
+		go etcdutil.WatchFailure(f.etcdClient, f.name, stop, func(failedTask string) {
+			id, err := strconv.ParseUint(failedTask, 10, 64)
+			if err != nil || id == f.taskID {
+				return
+			}
+			f.events <- &shardOwnerFailure{taskID: id, epoch: epoch}
+		})
+	}
+	f.shards.published = e.assignment
+	f.publishShards()
+}
+
+func (f *framework) handleShardOwnerFailure(e *shardOwnerFailure) {
+	a := f.shards.published
+	if a == nil || !a.Reassign(e.taskID) {
+		return
+	}
+	f.log.With("epoch", f.epoch).Infof("task %d reassigns the shards of failed task %d", f.taskID, e.taskID)
+	f.publishShards()
+}
+
+func (f *framework) publishShards() {
+	err := f.retry.Do(func() error {
+		return etcdutil.SetShardAssignment(f.etcdClient, f.name, f.shards.published)
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to publish shard assignment: %v", f.taskID, err)
+	}
+}
+
+// watchShards watches the shard assignment of current epoch, if the task
+// wants to know.
+func (f *framework) watchShards() {
+	if _, ok := adapted(f.task).(meritop.ShardReceiver); !ok {
+		return
+	}
+	stop := make(chan bool, 1)
+	f.metaStops = append(f.metaStops, stop)
+	var a *etcdutil.ShardAssignment
+	err := f.retry.Do(func() (err error) {
+		a, err = etcdutil.WatchShardAssignment(f.etcdClient, f.name, stop, func(a *etcdutil.ShardAssignment) {
+			f.events <- &shardAssignment{assignment: a}
+		})
+		return err
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to watch the shard assignment: %v", f.taskID, err)
+		return
+	}
+	if a != nil {
+		f.handleShardAssignment(&shardAssignment{assignment: a})
+	}
+}
+
+// handleShardAssignment tells the task of its shards, unless the assignment
+// is of another epoch, e.g. published by a master which has moved on
+// already, or doesn't change them.
+func (f *framework) handleShardAssignment(e *shardAssignment) {
+	if f.state != stateRunning || e.assignment.Epoch != f.epoch {
+		return
+	}
+	shards := e.assignment.Shards[f.taskID]
+	if f.shards.notified && reflect.DeepEqual(shards, f.shards.received) {
+		return
+	}
+	f.shards.received = shards
+	f.shards.notified = true
+	if r, ok := adapted(f.task).(meritop.ShardReceiver); ok {
+		f.spawn(func() { r.ShardAssigned(shards) })
+	}
+}
@@ -0,0 +1,81 @@
+package framework
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+type shardTask struct {
+	meritop.Task
+	assigned [][]string
+}
+
+func (t *shardTask) ShardAssigned(shards []string) { t.assigned = append(t.assigned, shards) }
+
+// TestShardAssignment has task 0 assign shards to tasks 1 and 2, and
+// reassign those of task 2 once it fails.
+func TestShardAssignment(t *testing.T) {
+	job := "TestShardAssignment"
+	client := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(job, client, 3)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("InitEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	claim, err := etcdutil.ClaimTask(client, job, 2, "host:2")
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	newFramework := func(taskID uint64, task meritop.Task) *framework {
+		f := newTestFramework(t, WithCoordinator(client))
+		f.taskID = taskID
+		f.epoch = 1
+		f.task = task
+		return f
+	}
+	step := func(f *framework, what string) {
+		select {
+		case ev := <-f.events:
+			f.step(ev)
+		case <-time.After(time.Second):
+			t.Fatalf("task %d got no %s", f.taskID, what)
+		}
+	}
+	master := newFramework(0, &shardTask{})
+	task := &shardTask{}
+	worker := newFramework(1, task)
+	worker.watchShards()
+	defer worker.releaseEpochResource()
+
+	go master.AssignShards(map[uint64][]string{1: {"a", "b"}, 2: {"c"}})
+	step(master, "assignment to publish")
+	defer master.releaseEpochResource()
+	step(worker, "assignment")
+	// Let the watch of failures start.
+	time.Sleep(50 * time.Millisecond)
+	if err := etcdutil.ReleaseClaim(client, job, claim); err != nil {
+		t.Fatal(err)
+	}
+	step(master, "failure")
+	step(worker, "reassignment")
+
+	want := [][]string{{"a", "b"}, {"a", "b", "c"}}
+	if !reflect.DeepEqual(task.assigned, want) {
+		t.Errorf("shards assigned = %v, want %v", task.assigned, want)
+	}
+	// An assignment of another epoch is dropped.
+	worker.step(&shardAssignment{assignment: &etcdutil.ShardAssignment{Epoch: 2, Shards: map[uint64][]string{1: {"d"}}}})
+	if len(task.assigned) != 2 {
+		t.Errorf("shards assigned = %v, want %v", task.assigned, want)
+	}
+	a, err := etcdutil.GetShardAssignment(client, job)
+	if err != nil || fmt.Sprint(a.Shards) != "map[1:[a b c]]" {
+		t.Errorf("assignment published = (%+v, %v), want shards of task 1 only", a, err)
+	}
+}
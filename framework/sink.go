@@ -0,0 +1,102 @@
+package framework
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// Attempts to write the results of an epoch to the sink, and the backoff
+// before the second one, doubling every attempt. Writes block the event loop,
+// so that results go before the snapshot of the next epoch.
+var (
+	sinkAttempts = 3
+	sinkBackoff  = 100 * time.Millisecond
+)
+
+// results are those the task emitted at an epoch, not written yet.
+type results struct {
+	mu      sync.Mutex
+	epoch   uint64
+	records [][]byte
+}
+
+// add adds a result emitted at the epoch. Results of an earlier epoch, which
+// is over, were emitted too late to be written; add drops them, and returns
+// their size.
+func (r *results) add(epoch uint64, record []byte) (dropped int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if epoch != r.epoch {
+		dropped = size(r.records)
+		r.epoch = epoch
+		r.records = nil
+	}
+	r.records = append(r.records, record)
+	return dropped
+}
+
+// take returns and forgets the results emitted at the epoch.
+func (r *results) take(epoch uint64) [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if epoch != r.epoch {
+		return nil
+	}
+	records := r.records
+	r.records = nil
+	return records
+}
+
+func (f *framework) Emit(record []byte) {
+	if f.sink == nil {
+		f.log.Warnf("task %d drops result: no sink", f.taskID)
+		return
+	}
+	if !f.memory.TryAcquire(int64(len(record))) {
+		f.log.Warnf("task %d drops result: no memory for %d bytes", f.taskID, len(record))
+		return
+	}
+	// Like DataRequest, it assumes the epoch doesn't change while the task
+	// emits.
+	f.memory.Release(f.results.add(f.epoch, record))
+}
+
+func size(records [][]byte) int64 {
+	var n int64
+	for _, r := range records {
+		n += int64(len(r))
+	}
+	return n
+}
+
+// writeResults writes the results of current epoch, which is over, to the
+// sink. Results which can't be written are kept as a dead letter.
+func (f *framework) writeResults() {
+	records := f.results.take(f.epoch)
+	if f.sink == nil || len(records) == 0 {
+		return
+	}
+	defer f.memory.Release(size(records))
+	if !f.commitOutput(f.epoch) {
+		return
+	}
+	var err error
+	backoff := sinkBackoff
+	for i := 0; i < sinkAttempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = f.sink.Write(f.taskID, f.epoch, records); err == nil {
+			f.metrics.resultsWritten.Add(uint64(len(records)))
+			return
+		}
+		f.metrics.sinkErrors.Inc()
+		f.log.With("epoch", f.epoch).Warnf("task %d failed to write results: %v", f.taskID, err)
+	}
+	dead := etcdutil.DeadLetter{Epoch: f.epoch, Kind: "results", Payload: fmt.Sprintf("%d results", len(records))}
+	f.keepDeadLetter(dead, err)
+}
@@ -0,0 +1,71 @@
+package framework
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// flakySink fails the first writes, and keeps the others.
+type flakySink struct {
+	fails   int
+	written map[uint64][]string
+}
+
+func (s *flakySink) Write(taskID, epoch uint64, records [][]byte) error {
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("sink unavailable")
+	}
+	for _, r := range records {
+		s.written[epoch] = append(s.written[epoch], string(r))
+	}
+	return nil
+}
+
+func TestWriteResults(t *testing.T) {
+	defer func(b time.Duration) { sinkBackoff = b }(sinkBackoff)
+	sinkBackoff = time.Millisecond
+	job := "TestWriteResults"
+	sink := &flakySink{fails: 1, written: make(map[uint64][]string)}
+	f := newTestFramework(t, WithCoordinator(etcdutil.NewMemoryCoordinator()))
+	f.taskID = 1
+	f.sink = sink
+
+	f.epoch = 1
+	f.Emit([]byte("a"))
+	f.Emit([]byte("b"))
+	f.writeResults()
+	if want := []string{"a", "b"}; !reflect.DeepEqual(sink.written[1], want) {
+		t.Errorf("results of epoch 1 = %v, want %v", sink.written[1], want)
+	}
+	if f.metrics.resultsWritten.Value() != 2 || f.metrics.sinkErrors.Value() != 1 {
+		t.Errorf("results written = %d, sink errors = %d, want 2, 1",
+			f.metrics.resultsWritten.Value(), f.metrics.sinkErrors.Value())
+	}
+
+	// Results emitted at an epoch which is over aren't written with those
+	// of the next.
+	f.Emit([]byte("late"))
+	f.epoch = 2
+	f.Emit([]byte("c"))
+	f.writeResults()
+	if want := []string{"c"}; !reflect.DeepEqual(sink.written[2], want) {
+		t.Errorf("results of epoch 2 = %v, want %v", sink.written[2], want)
+	}
+
+	sink.fails = sinkAttempts
+	f.epoch = 3
+	f.Emit([]byte("d"))
+	f.writeResults()
+	dls, err := etcdutil.GetDeadLetters(f.etcdClient, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dls) != 1 || dls[0].Kind != "results" || dls[0].Epoch != 3 {
+		t.Errorf("dead letters = %+v, want the results of epoch 3", dls)
+	}
+}
@@ -0,0 +1,167 @@
+package framework
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/checkpoint"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+var backupPollInterval = 500 * time.Millisecond
+
+// speculation is the copy of the task, this one or a backup copy, whose
+// output an epoch takes. Data requests are served off the event loop, hence
+// the lock.
+type speculation struct {
+	mu     sync.Mutex
+	epoch  uint64
+	known  bool
+	winner string
+}
+
+// speculative tells whether another copy of the task might run.
+func (f *framework) speculative() bool { return f.speculateAfter > 0 || f.backup }
+
+// commitOutput tells whether the output of the task in given epoch is to be
+// kept. The first copy of the task to output commits the epoch to itself,
+// and the output of the other is discarded.
+func (f *framework) commitOutput(epoch uint64) bool {
+	if !f.speculative() {
+		return true
+	}
+	addr := f.ln.Addr().String()
+	s := &f.speculation
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.known {
+		if epoch == s.epoch {
+			return s.winner == addr
+		}
+		if epoch < s.epoch {
+			// The epoch is over.
+			return false
+		}
+	}
+	winner, err := etcdutil.CommitOutput(f.etcdClient, f.name, f.taskID, epoch, addr)
+	if err != nil {
+		// Output as without speculation rather than drop it.
+		f.metrics.etcdErrors.Inc()
+		f.log.Warnf("task %d failed to commit its output of epoch %d: %v", f.taskID, epoch, err)
+		return true
+	}
+	s.epoch, s.known, s.winner = epoch, true, winner
+	if winner != addr {
+		f.log.Infof("task %d discards its output of epoch %d, taken from its copy at %s", f.taskID, epoch, winner)
+	}
+	return winner == addr
+}
+
+// taskAddress is the address of the copy of given task to request data of
+// given epoch from: the copy whose output the epoch takes, if known.
+func (f *framework) taskAddress(taskID, epoch uint64) (string, error) {
+	if f.speculative() {
+		if addr, err := etcdutil.GetCommit(f.etcdClient, f.name, taskID, epoch); err == nil {
+			return addr, nil
+		}
+	}
+	return f.getAddress(taskID)
+}
+
+// watchStragglers asks for backups of the neighbors which have no output
+// once f.speculateAfter has passed in current epoch.
+func (f *framework) watchStragglers() {
+	if f.speculateAfter <= 0 || f.backup {
+		return
+	}
+	epoch, cancel := f.epoch, f.epochCancel
+	seen := make(map[uint64]bool)
+	var neighbors []uint64
+	for _, linkType := range f.topology.GetLinkTypes() {
+		for _, id := range f.topology.GetNeighbors(linkType, epoch) {
+			if !seen[id] {
+				seen[id] = true
+				neighbors = append(neighbors, id)
+			}
+		}
+	}
+	go func() {
+		select {
+		case <-time.After(f.speculateAfter):
+		case <-cancel:
+			return
+		}
+		for _, id := range neighbors {
+			if _, err := etcdutil.GetCommit(f.etcdClient, f.name, id, epoch); !etcdutil.IsKeyNotFound(err) {
+				continue
+			}
+			f.log.Infof("task %d asks for a backup of task %d, which has no output at epoch %d after %v",
+				f.taskID, id, epoch, f.speculateAfter)
+			if err := etcdutil.RequestBackup(f.etcdClient, f.name, id, epoch); err != nil {
+				f.log.Warnf("task %d failed to ask for a backup of task %d: %v", f.taskID, id, err)
+			}
+		}
+	}()
+}
+
+// takeBackup waits for a straggler to run a backup copy of, for as long as
+// the job runs.
+func (f *framework) takeBackup() error {
+	addr := f.ln.Addr().String()
+	for {
+		id, epoch, err := etcdutil.TakeBackupRequest(f.etcdClient, f.name, addr)
+		if err == nil {
+			f.log.Infof("backup node runs a copy of task %d at epoch %d", id, epoch)
+			f.taskID, f.backupEpoch = id, epoch
+			return nil
+		}
+		if err != etcdutil.ErrNoBackupRequest {
+			return err
+		}
+		ec, err := etcdutil.GetEpochChange(f.etcdClient, f.codec, f.name)
+		if err != nil {
+			// The layout of a finished job might be gone already.
+			if etcdutil.IsKeyNotFound(err) {
+				return errJobFinished
+			}
+			return err
+		}
+		if ec.Epoch == exitEpoch {
+			return errJobFinished
+		}
+		time.Sleep(backupPollInterval)
+	}
+}
+
+// skipHeartbeat stands in for heartbeat on backup nodes, which don't claim
+// the task: the copy is given up with the epoch.
+func (f *framework) skipHeartbeat() {
+	f.heartbeatStop = make(chan struct{})
+	f.heartbeatDone = make(chan struct{})
+	close(f.heartbeatDone)
+}
+
+// restoreBackup restores the checkpoint of the epoch of the backup copy. A
+// copy which can't start from it gives up.
+func (f *framework) restoreBackup() {
+	c, ok := adapted(f.task).(meritop.Checkpointer)
+	if !ok {
+		return
+	}
+	epoch, data, err := f.checkpointStore.Latest(f.taskID)
+	switch {
+	case err == checkpoint.ErrNotFound && f.backupEpoch == 0:
+		// The task starts afresh.
+	case err != nil:
+		f.metrics.checkpointErrors.Inc()
+		f.log.Errorf("backup of task %d failed to load checkpoint: %v", f.taskID, err)
+		f.state = stateExited
+	case epoch != f.backupEpoch:
+		f.log.Warnf("backup of task %d gives up: latest checkpoint is of epoch %d, not %d", f.taskID, epoch, f.backupEpoch)
+		f.state = stateExited
+	default:
+		f.log.Infof("backup of task %d restoring checkpoint of epoch %d", f.taskID, epoch)
+		c.Restore(data)
+	}
+}
@@ -0,0 +1,60 @@
+package framework
+
+import (
+	"net"
+	"testing"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// TestSpeculation has a backup copy of task 1 output first at epoch 2, so
+// that the metas of the straggler are discarded and data requests go to the
+// backup.
+func TestSpeculation(t *testing.T) {
+	job := "TestSpeculation"
+	client := etcdutil.NewMemoryCoordinator()
+	if _, err := etcdutil.ClaimTask(client, job, 1, "straggler:1"); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	newFramework := func(backup bool) *framework {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		f := newTestFramework(t, WithCoordinator(client))
+		f.taskID = 1
+		f.epoch = 2
+		f.ln = ln
+		f.speculateAfter = 1
+		f.backup = backup
+		f.backupEpoch = 2
+		return f
+	}
+	straggler, backup := newFramework(false), newFramework(true)
+	defer straggler.ln.Close()
+	defer backup.ln.Close()
+	requester := &framework{name: job, taskID: 0, etcdClient: client, speculateAfter: 1}
+
+	if addr, err := requester.taskAddress(1, 2); addr != "straggler:1" || err != nil {
+		t.Fatalf("address before output = (%q, %v), want the claim", addr, err)
+	}
+	backup.FlagMeta("parent", "backup")
+	straggler.FlagMeta("parent", "straggler")
+	resp, err := client.Get(etcdutil.MetaPath(job, 1, "parent"), false, false)
+	if err != nil {
+		t.Fatalf("Get meta failed: %v", err)
+	}
+	if want := etcdutil.TextCodec.EncodeMeta(2, "backup"); resp.Node.Value != want {
+		t.Errorf("meta = %q, want %q", resp.Node.Value, want)
+	}
+	if straggler.commitOutput(2) {
+		t.Errorf("straggler keeps its output of epoch 2")
+	}
+	if addr, err := requester.taskAddress(1, 2); addr != backup.ln.Addr().String() || err != nil {
+		t.Errorf("address after output = (%q, %v), want the backup at %s", addr, err, backup.ln.Addr())
+	}
+	// The straggler is first at the next epoch.
+	if !straggler.commitOutput(3) {
+		t.Errorf("straggler discards its output of epoch 3")
+	}
+}
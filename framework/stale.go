@@ -0,0 +1,50 @@
+package framework
+
+import (
+	"sync"
+
+	"github.com/go-distributed/meritop"
+)
+
+// Meta and data are stamped with the epoch of their sender: meta by the codec
+// in etcd, and data responses by the server (see frameworkhttp.DataResponse).
+// Messages of another epoch than the one the task runs are stale. The event
+// loop drops those it gets, and handlers check again right before calling the
+// task, as the epoch can change while they wait to run. So tasks don't see
+// data of an epoch in another one.
+
+// epochGate tells handlers out of the event loop which epoch the task runs.
+type epochGate struct {
+	mu      sync.Mutex
+	epoch   uint64
+	running bool
+}
+
+func (g *epochGate) open(epoch uint64) {
+	g.mu.Lock()
+	g.epoch, g.running = epoch, true
+	g.mu.Unlock()
+}
+
+func (g *epochGate) close() {
+	g.mu.Lock()
+	g.running = false
+	g.mu.Unlock()
+}
+
+func (g *epochGate) admits(epoch uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.running && g.epoch == epoch
+}
+
+// dropStale drops a message of given kind, "meta" or "data", that the task
+// can't take at the epoch it was sent. The task learns of it if it is a
+// meritop.StaleMessageObserver.
+func (f *framework) dropStale(kind string, fromID, epoch uint64) {
+	f.metrics.staleMessages.Inc()
+	f.log.With("epoch", epoch).Debugf("task %d drops stale %s of task %d", f.taskID, kind, fromID)
+	if o, ok := adapted(f.task).(meritop.StaleMessageObserver); ok {
+		f.spawn(func() { o.StaleMessage(fromID, kind, epoch) })
+	}
+}
@@ -0,0 +1,93 @@
+package framework
+
+import (
+	"strconv"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/metrics"
+)
+
+// nodeMetrics are what the node exposes on /status and /metrics. HTTP
+// handlers read them outside of the event loop; metrics are safe for that.
+type nodeMetrics struct {
+	registry *metrics.Registry
+
+	epoch               *metrics.Gauge
+	numOfTasks          *metrics.Gauge
+	pendingDataRequests *metrics.Gauge
+	servingDataRequests *metrics.Gauge
+	dataRequestsSent    *metrics.Counter
+	dataRequestsServed  *metrics.Counter
+	bytesSent           *metrics.Counter
+	bytesReceived       *metrics.Counter
+	epochTransitions    *metrics.Counter
+	etcdErrors          *metrics.Counter
+	checkpointErrors    *metrics.Counter
+	eventLoopLag        *metrics.Gauge
+	metaCoalesced       *metrics.Counter
+	bufferedMeta        *metrics.Gauge
+	requestsRejected    *metrics.Counter
+	staleMessages       *metrics.Counter
+	schemaViolations    *metrics.Counter
+	deadLetters         *metrics.Counter
+	resultsWritten      *metrics.Counter
+	sinkErrors          *metrics.Counter
+	dataDivergences     *metrics.Counter
+	shadowRequests      *metrics.Counter
+	shadowMismatches    *metrics.Counter
+	shadowErrors        *metrics.Counter
+	primaryLatency      *metrics.Counter
+	shadowLatency       *metrics.Counter
+}
+
+func newNodeMetrics(job string, taskID uint64) *nodeMetrics {
+	r := metrics.NewRegistry(map[string]string{
+		"job":  job,
+		"task": strconv.FormatUint(taskID, 10),
+	})
+	return &nodeMetrics{
+		registry:            r,
+		epoch:               r.NewGauge("meritop_epoch", "Current epoch of the task."),
+		numOfTasks:          r.NewGauge("meritop_tasks", "Number of tasks in current epoch."),
+		pendingDataRequests: r.NewGauge("meritop_pending_data_requests", "Data requests sent and waiting for response."),
+		servingDataRequests: r.NewGauge("meritop_serving_data_requests", "Data requests from other tasks being served."),
+		dataRequestsSent:    r.NewCounter("meritop_data_requests_sent_total", "Data requests sent to other tasks."),
+		dataRequestsServed:  r.NewCounter("meritop_data_requests_served_total", "Data requests of other tasks served."),
+		bytesSent:           r.NewCounter("meritop_bytes_sent_total", "Bytes of data served to other tasks."),
+		bytesReceived:       r.NewCounter("meritop_bytes_received_total", "Bytes of data received from other tasks."),
+		epochTransitions:    r.NewCounter("meritop_epoch_transitions_total", "Epoch changes seen by the task."),
+		etcdErrors:          r.NewCounter("meritop_etcd_errors_total", "Non-fatal etcd errors, e.g. failed heartbeats."),
+		checkpointErrors:    r.NewCounter("meritop_checkpoint_errors_total", "Failures to save or load checkpoints."),
+		eventLoopLag:        r.NewGauge("meritop_event_loop_lag_microseconds", "Longest wait of the last batch of meta in the event loop."),
+		metaCoalesced:       r.NewCounter("meritop_meta_coalesced_total", "Meta flags dropped for a later or identical one."),
+		bufferedMeta:        r.NewGauge("meritop_buffered_meta", "Meta flags waiting for etcd to take writes."),
+		requestsRejected:    r.NewCounter("meritop_data_requests_rejected_total", "Data requests of other tasks turned away by a full serve pool."),
+		deadLetters:         r.NewCounter("meritop_dead_letters_total", "Meta and data requests the task couldn't deliver."),
+		schemaViolations:    r.NewCounter("meritop_schema_violations_total", "Data responses dropped as they break the schema of their request."),
+		staleMessages:       r.NewCounter("meritop_stale_messages_total", "Meta and data of another epoch dropped before reaching the task."),
+		resultsWritten:      r.NewCounter("meritop_results_written_total", "Results emitted by the task and written to the sink."),
+		sinkErrors:          r.NewCounter("meritop_sink_errors_total", "Failures to write results to the sink, retried or not."),
+		dataDivergences:     r.NewCounter("meritop_data_divergences_total", "Data responses which diverged when fetched twice, see WithDataVerification."),
+		shadowRequests:      r.NewCounter("meritop_shadow_requests_total", "Data requests duplicated over the shadow transport, see WithShadowTransport."),
+		shadowMismatches:    r.NewCounter("meritop_shadow_mismatches_total", "Data responses of the shadow transport which differ from HTTP."),
+		shadowErrors:        r.NewCounter("meritop_shadow_errors_total", "Data requests failing over the shadow transport only."),
+		primaryLatency:      r.NewCounter("meritop_primary_latency_microseconds_total", "Time spent on data requests over HTTP which were duplicated."),
+		shadowLatency:       r.NewCounter("meritop_shadow_latency_microseconds_total", "Time spent on data requests over the shadow transport."),
+	}
+}
+
+func (f *framework) GetStatus() frameworkhttp.NodeStatus {
+	m := f.metrics
+	return frameworkhttp.NodeStatus{
+		TaskID:              f.taskID,
+		Epoch:               uint64(m.epoch.Value()),
+		NumOfTasks:          uint64(m.numOfTasks.Value()),
+		PendingDataRequests: m.pendingDataRequests.Value(),
+		ServingDataRequests: m.servingDataRequests.Value(),
+		DataRequestsSent:    m.dataRequestsSent.Value(),
+		DataRequestsServed:  m.dataRequestsServed.Value(),
+		BytesSent:           m.bytesSent.Value(),
+		BytesReceived:       m.bytesReceived.Value(),
+		Links:               f.links.list(),
+	}
+}
@@ -0,0 +1,47 @@
+package framework
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// epochTiming times the task in current epoch, from its start until its last
+// output, i.e. meta flagged or data served, which come from off the event
+// loop. The controller finds stragglers from the timings, see
+// controller.Stragglers.
+type epochTiming struct {
+	started time.Time
+	// unix nanoseconds of the last output, 0 if none
+	lastOutput int64
+	// records are written one at a time
+	mu sync.Mutex
+}
+
+func (f *framework) startTiming() {
+	f.timing.started = time.Now()
+	atomic.StoreInt64(&f.timing.lastOutput, 0)
+}
+
+func (f *framework) timeOutput() {
+	atomic.StoreInt64(&f.timing.lastOutput, time.Now().UnixNano())
+}
+
+// recordTiming records how long the task took in the epoch which is over,
+// unless it had no output. Backup copies aren't timed.
+func (f *framework) recordTiming() {
+	last := atomic.LoadInt64(&f.timing.lastOutput)
+	if f.backup || last == 0 || f.timing.started.IsZero() {
+		return
+	}
+	t := etcdutil.EpochTiming{Epoch: f.epoch, Duration: time.Unix(0, last).Sub(f.timing.started)}
+	f.spawn(func() {
+		f.timing.mu.Lock()
+		defer f.timing.mu.Unlock()
+		if err := etcdutil.RecordTiming(f.etcdClient, f.name, f.taskID, t); err != nil {
+			f.log.Warnf("task %d failed to record its timing of epoch %d: %v", f.taskID, t.Epoch, err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package framework
+
+import (
+	"sync"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// subscriptions keeps the watches of the topics the task subscribed to.
+type subscriptions struct {
+	mu      sync.Mutex
+	stops   []chan bool
+	stopped bool
+}
+
+// add keeps the stop of a watch. It returns false once the node is stopping.
+func (s *subscriptions) add(stop chan bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.stops = append(s.stops, stop)
+	return true
+}
+
+func (s *subscriptions) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stop := range s.stops {
+		stop <- true
+	}
+	s.stops = nil
+	s.stopped = true
+}
+
+func (f *framework) Publish(topic, data string) {
+	err := f.retry.Do(func() error {
+		return etcdutil.Publish(f.etcdClient, f.name, topic, data)
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to publish on topic %s: %v", f.taskID, topic, err)
+	}
+}
+
+// Subscribe watches the topic until the node stops. Events go through the
+// event loop, so that the handler runs like the other callbacks of the task.
+func (f *framework) Subscribe(topic string, handler func(data string)) {
+	stop := make(chan bool, 1)
+	if !f.subscriptions.add(stop) {
+		return
+	}
+	err := f.retry.Do(func() error {
+		return etcdutil.WatchTopic(f.etcdClient, f.name, topic, stop, func(data string) {
+			f.events <- &topicEvent{topic: topic, data: data, handler: handler}
+		})
+	})
+	if err != nil {
+		f.metrics.etcdErrors.Inc()
+		f.log.Errorf("task %d failed to subscribe to topic %s: %v", f.taskID, topic, err)
+	}
+}
@@ -0,0 +1,53 @@
+package framework
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	job := "TestPublishSubscribe"
+	client := etcdutil.NewMemoryCoordinator()
+	if err := etcdutil.CreateNumOfTasks(client, job, 2); err != nil {
+		t.Fatal(err)
+	}
+	frameworks := make([]*framework, 2)
+	for i := range frameworks {
+		frameworks[i] = newTestFramework(t, WithCoordinator(client))
+		frameworks[i].taskID = uint64(i)
+		frameworks[i].state = stateJoining
+	}
+	sub, pub := frameworks[0], frameworks[1]
+
+	var got []string
+	sub.Subscribe("lr", func(data string) { got = append(got, data) })
+	pub.Publish("lr", "0.01")
+	pub.Publish("early-stop", "")
+	pub.Publish("lr", "0.001")
+	// Events are taken before the task joins an epoch.
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-sub.events:
+			sub.step(ev)
+		case <-time.After(time.Second):
+			t.Fatalf("no event #%d", i)
+		}
+	}
+	if want := []string{"0.01", "0.001"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	sub.subscriptions.stop()
+	// No watch is set up once the node stops.
+	sub.Subscribe("early-stop", func(string) { t.Errorf("event after stop") })
+	pub.Publish("early-stop", "")
+	pub.Publish("lr", "0.1")
+	select {
+	case ev := <-sub.events:
+		t.Errorf("event %+v after stop", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
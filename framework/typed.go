@@ -0,0 +1,164 @@
+package framework
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+	"github.com/go-distributed/meritop/pkg/datacodec"
+)
+
+// defaultCodecs are the codecs of typed data of tasks without WithCodecs.
+var defaultCodecs = []datacodec.Codec{datacodec.Gob, datacodec.JSON}
+
+// typedRequest is a typed data request of another task, with its argument
+// unmarshaled and the codec of the result negotiated.
+type typedRequest struct {
+	handler meritop.TypedHandler
+	codec   datacodec.Codec
+	arg     interface{}
+}
+
+func (f *framework) Handle(name string, h meritop.TypedHandler) {
+	if strings.Contains(name, "/") {
+		panic("framework: typed request name has /: " + name)
+	}
+	f.handlersMu.Lock()
+	defer f.handlersMu.Unlock()
+	if f.handlers == nil {
+		f.handlers = make(map[string]meritop.TypedHandler)
+	}
+	f.handlers[name] = h
+}
+
+func (f *framework) handler(name string) (meritop.TypedHandler, bool) {
+	f.handlersMu.RLock()
+	defer f.handlersMu.RUnlock()
+	h, ok := f.handlers[name]
+	return h, ok
+}
+
+// TypedDataRequest marshals the argument with the first codec of the task
+// into the request: {name}/{content type}/{base64 of the argument}. The
+// argument goes in the URL of the request, so it should be small.
+func (f *framework) TypedDataRequest(toID uint64, name string, arg interface{}) error {
+	c := f.dataCodecs()[0]
+	b, err := c.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	req := name + "/" + url.QueryEscape(c.ContentType()) + "/" + base64.URLEncoding.EncodeToString(b)
+	f.DataRequest(toID, req)
+	return nil
+}
+
+// typedArg unmarshals the argument of a typed request.
+func typedArg(req string, h meritop.TypedHandler) (interface{}, error) {
+	parts := strings.SplitN(req, "/", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%q is not a typed request", req)
+	}
+	contentType, err := url.QueryUnescape(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	c, ok := datacodec.Get(contentType)
+	if !ok {
+		return nil, fmt.Errorf("no codec of %s", contentType)
+	}
+	b, err := base64.URLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	arg := h.NewArg()
+	if err := c.Unmarshal(b, arg); err != nil {
+		return nil, err
+	}
+	return arg, nil
+}
+
+func (f *framework) dataCodecs() []datacodec.Codec {
+	if len(f.codecs) == 0 {
+		return defaultCodecs
+	}
+	return f.codecs
+}
+
+// acceptedContentTypes are those the task accepts typed data of.
+func (f *framework) acceptedContentTypes() []string {
+	var contentTypes []string
+	for _, c := range f.dataCodecs() {
+		contentTypes = append(contentTypes, c.ContentType())
+	}
+	return contentTypes
+}
+
+// GetTypedTaskData serves typed requests with their handlers, marshaling the
+// result with the first codec of the task the requester accepts, and other
+// requests as GetTaskData.
+func (f *framework) GetTypedTaskData(taskID, epoch uint64, req, accept string) ([]byte, string, error) {
+	d, contentType, release, err := f.GetTaskPayload(taskID, epoch, req, accept)
+	return ownData(d, release), contentType, err
+}
+
+// GetTaskPayload is GetTypedTaskData which leaves the data served by a
+// meritop.PayloadServer in the buffer of the task, until release.
+func (f *framework) GetTaskPayload(taskID, epoch uint64, req, accept string) ([]byte, string, func(), error) {
+	h, ok := f.handler(requestName(req))
+	if !ok {
+		d, release, err := f.getTaskData(taskID, epoch, req, nil)
+		return d, "", release, err
+	}
+	c := f.dataCodecs()[0]
+	if accept != "" {
+		ct := frameworkhttp.NegotiateContentType(accept, f.acceptedContentTypes())
+		if ct == "" {
+			return nil, "", nil, frameworkhttp.ErrNotAcceptable
+		}
+		c, _ = datacodec.Get(ct)
+	}
+	arg, err := typedArg(req, h)
+	if err != nil {
+		f.log.Warnf("task %d: bad typed request %q of task %d: %v", f.taskID, req, taskID, err)
+		return nil, "", nil, frameworkhttp.ErrBadRequest
+	}
+	tr := &typedRequest{handler: h, codec: c, arg: arg}
+	d, _, err := f.getTaskData(taskID, epoch, req, tr)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return d, c.ContentType(), nil, nil
+}
+
+// serveTyped serves a typed request with its handler.
+func (f *framework) serveTyped(fromID uint64, tr *typedRequest) ([]byte, error) {
+	result, err := tr.handler.Serve(fromID, tr.arg)
+	if err != nil {
+		return nil, err
+	}
+	return tr.codec.Marshal(result)
+}
+
+// typedDataReady unmarshals the result of a typed request for its handler.
+// Results which can't be unmarshaled are dropped as invalid data.
+func (f *framework) typedDataReady(h meritop.TypedHandler, resp *frameworkhttp.DataResponse) {
+	arg, err := typedArg(resp.Req, h)
+	if err != nil {
+		f.invalidData(resp, fmt.Errorf("has a bad argument: %v", err))
+		return
+	}
+	c, ok := datacodec.Get(resp.ContentType)
+	if !ok {
+		f.invalidData(resp, fmt.Errorf("has no codec of %q", resp.ContentType))
+		return
+	}
+	result := h.NewResult()
+	if err := c.Unmarshal(resp.Data, result); err != nil {
+		f.invalidData(resp, fmt.Errorf("can't be unmarshaled: %v", err))
+		return
+	}
+	h.Ready(resp.TaskID, arg, result)
+}
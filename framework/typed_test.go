@@ -0,0 +1,123 @@
+package framework
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/pkg/datacodec"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+type scaleArg struct {
+	Factor float64
+}
+
+type vector struct {
+	Values []float64
+}
+
+// typedTask serves its vector scaled by the factor of the requester, and
+// requests the one of task 1 at epoch 1.
+type typedTask struct {
+	testableTask
+	results chan string
+}
+
+func (t *typedTask) Init(taskID uint64, fw meritop.Framework) {
+	fw.Handle("scale", meritop.TypedHandler{
+		NewArg:    func() interface{} { return new(scaleArg) },
+		NewResult: func() interface{} { return new(vector) },
+		Serve: func(fromID uint64, arg interface{}) (interface{}, error) {
+			f := arg.(*scaleArg).Factor
+			if f == 0 {
+				return nil, fmt.Errorf("zero factor")
+			}
+			return &vector{[]float64{f, f * float64(t.id)}}, nil
+		},
+		Ready: func(fromID uint64, arg, result interface{}) {
+			t.results <- fmt.Sprintf("%d: %v %v", fromID, arg.(*scaleArg).Factor, result.(*vector).Values)
+		},
+	})
+	t.testableTask.Init(taskID, fw)
+}
+
+func (t *typedTask) SetEpoch(epoch uint64) {
+	if epoch != 1 || t.id != 0 {
+		return
+	}
+	if err := t.framework.TypedDataRequest(1, "scale", &scaleArg{2}); err != nil {
+		t.results <- err.Error()
+	}
+	t.framework.TypedDataRequest(1, "scale", &scaleArg{0})
+	t.framework.DataRequest(1, "scale/garbage")
+}
+
+type typedTaskBuilder struct {
+	setupLatch *sync.WaitGroup
+	results    chan string
+}
+
+func (b *typedTaskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &typedTask{testableTask: testableTask{setupLatch: b.setupLatch}, results: b.results}
+}
+
+// TestFrameworkTypedDataRequest requests typed data of a task which only has
+// JSON, from one preferring gob.
+func TestFrameworkTypedDataRequest(t *testing.T) {
+	appName := "framework_test_typed"
+	coord := etcdutil.NewMemoryCoordinator()
+	ctl := controller.New(appName, coord, 2)
+	if err := ctl.InitEtcdLayout(); err != nil {
+		t.Fatalf("initEtcdLayout failed: %v", err)
+	}
+	defer ctl.DestroyEtcdLayout()
+	var wg sync.WaitGroup
+	taskBuilder := &typedTaskBuilder{setupLatch: &wg, results: make(chan string, 3)}
+	fs := make([]*framework, 2)
+	for i := range fs {
+		fs[i] = &framework{name: appName, etcdClient: coord, ln: createListener(t)}
+		fs[i].SetTaskBuilder(taskBuilder)
+		fs[i].SetTopology(example.NewTreeTopology(2, 2))
+	}
+	WithCodecs(datacodec.ContentTypeJSON)(fs[1])
+	wg.Add(2)
+	for _, f := range fs {
+		go f.Start()
+	}
+	wg.Wait()
+	defer fs[0].ShutdownJob()
+	fs[0].IncEpoch()
+
+	select {
+	case r := <-taskBuilder.results:
+		if r != "1: 2 [2 2]" {
+			t.Errorf("result = %q, want 1: 2 [2 2]", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result")
+	}
+
+	// The requests the task fails to serve and those with a bad argument
+	// end up as dead letters.
+	var dls []etcdutil.DeadLetter
+	for i := 0; i < 100 && len(dls) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		if dls, err = etcdutil.GetDeadLetters(coord, appName); err != nil {
+			t.Fatalf("GetDeadLetters failed: %v", err)
+		}
+	}
+	if len(dls) != 2 {
+		t.Fatalf("dead letters = %+v, want 2", dls)
+	}
+	select {
+	case r := <-taskBuilder.results:
+		t.Errorf("unexpected result %q", r)
+	default:
+	}
+}
@@ -0,0 +1,30 @@
+package framework
+
+import (
+	"bytes"
+	"hash/crc32"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// verifyResponse fetches the data of a request once more, and flags the
+// response if the data diverges, e.g. as a new transport or compression
+// codec corrupts it. The task gets the first response either way.
+func (f *framework) verifyResponse(addr string, dr *requestToSend, cancel <-chan struct{}, d *frameworkhttp.DataResponse) {
+	// Calls aren't idempotent.
+	if isCall(dr.req) {
+		return
+	}
+	again, err := f.requestData(addr, dr, cancel)
+	if err != nil {
+		f.log.Warnf("task %d can't verify data request %q to task %d: %v", f.taskID, dr.req, dr.taskID, err)
+		return
+	}
+	if bytes.Equal(d.Data, again.Data) {
+		return
+	}
+	f.metrics.dataDivergences.Inc()
+	f.log.Errorf("task %d: data of request %q to task %d at epoch %d diverges: %d bytes, crc32 %08x, then %d bytes, crc32 %08x",
+		f.taskID, dr.req, dr.taskID, dr.epoch,
+		len(d.Data), crc32.ChecksumIEEE(d.Data), len(again.Data), crc32.ChecksumIEEE(again.Data))
+}
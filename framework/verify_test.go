@@ -0,0 +1,62 @@
+package framework
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-distributed/meritop/framework/frameworkhttp"
+)
+
+// corruptingGetter serves the request as data, corrupting "flaky" on every
+// other request as a broken transport would.
+type corruptingGetter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (g *corruptingGetter) GetTaskData(taskID, epoch uint64, req string) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	if req == "flaky" && g.n%2 == 0 {
+		return []byte("flakz"), nil
+	}
+	return []byte(req), nil
+}
+
+func TestDataVerification(t *testing.T) {
+	f := newTestFramework(t)
+	f.httpClient = frameworkhttp.DefaultClient
+	g := &corruptingGetter{}
+	s := httptest.NewServer(frameworkhttp.NewDataRequestHandler(f.log, g))
+	defer s.Close()
+	addr := strings.TrimPrefix(s.URL, "http://")
+
+	tests := []struct {
+		req       string
+		fetches   int
+		diverging uint64
+	}{
+		{"param", 2, 0},
+		{"flaky", 2, 1},
+		// Calls are fetched once.
+		{callPrefix + "sum/", 1, 1},
+	}
+	for i, tt := range tests {
+		g.n = 0
+		dr := &requestToSend{taskID: 1, req: tt.req}
+		d, err := f.requestData(addr, dr, nil)
+		if err != nil {
+			t.Fatalf("#%d: requestData failed: %v", i, err)
+		}
+		f.verifyResponse(addr, dr, nil, d)
+		if g.n != tt.fetches {
+			t.Errorf("#%d: fetches = %d, want %d", i, g.n, tt.fetches)
+		}
+		if n := f.metrics.dataDivergences.Value(); n != tt.diverging {
+			t.Errorf("#%d: divergences = %d, want %d", i, n, tt.diverging)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 package meritop
 
-import "log"
+import "github.com/go-distributed/meritop/pkg/logging"
 
 // This interface is used by application during taskgraph configuration phase.
 type Bootstrap interface {
@@ -23,14 +23,43 @@ type BackedUpFramework interface {
 	Update(taskID uint64, log UpdateLog)
 }
 
+// ReduceFunc combines the data of two tasks into one, see
+// Framework.AllReduce. It must be associative and commutative.
+type ReduceFunc func(a, b []byte) []byte
+
+// HandlerFunc serves the calls of a named handler of a task, see
+// Framework.RegisterHandler. The error goes back to the caller.
+type HandlerFunc func(fromID uint64, args []byte) ([]byte, error)
+
+// TypedHandler serves typed data requests of a name, see Framework.Handle.
+// The framework marshals the argument and the result with a codec both nodes
+// have (see pkg/datacodec), so that tasks deal with Go values, not bytes.
+type TypedHandler struct {
+	// NewArg and NewResult return pointers to new values, into which the
+	// argument and the result are unmarshaled.
+	NewArg    func() interface{}
+	NewResult func() interface{}
+	// Serve returns the result of the argument of the requesting task.
+	Serve func(fromID uint64, arg interface{}) (interface{}, error)
+	// Ready takes the result of the argument served by task fromID. It is
+	// called instead of DataReady.
+	Ready func(fromID uint64, arg, result interface{})
+}
+
 // Framework hides distributed system complexity and provides users convenience of
 // high level features.
 type Framework interface {
 	// These two are useful for task to inform the framework their status change.
 	// metaData has to be really small, since it might be stored in etcd.
-	// Set meta flag to notify parent/child of the change.
+	// Set meta flag to notify neighbors linked by the given link type.
+	FlagMeta(linkType, meta string)
+	// Shorthands of FlagMeta for LinkParent and LinkChild.
 	FlagMetaToParent(meta string)
 	FlagMetaToChild(meta string)
+	// Flag meta to all descendants in a tree topology, and gather the
+	// acknowledgements of all of them back to the root.
+	FlagMetaBroadcast(meta string)
+	GatherMeta(meta string)
 
 	// This allow the task implementation query its neighbors.
 	GetTopology() Topology
@@ -38,15 +67,117 @@ type Framework interface {
 	// Some task can inform all participating tasks to shutdown.
 	// If successful, all tasks will be gracefully shutdown.
 	ShutdownJob()
+	// Finish the job with its result, e.g. the final loss, which the
+	// controller returns from WaitResult. All tasks exit as on ShutdownJob.
+	// The first result of a job is kept.
+	FinishJob(result []byte)
 
-	// Some task can inform all participating tasks to new epoch
+	// Some task can inform all participating tasks to new epoch. The epoch
+	// advances once however many times it is called in an epoch, e.g. by a
+	// master failing over mid-transition, and only if the task may advance
+	// it (see controller.SetEpochMaster). framework.IncEpoch returns the
+	// errors this logs.
 	IncEpoch()
 
-	GetLogger() *log.Logger
+	GetLogger() logging.Logger
+
+	// Enter the named barrier of current epoch. Tasks implementing
+	// BarrierWaiter are notified once all tasks have entered it.
+	EnterBarrier(name string)
 
-	// Request data from parent or children.
+	// Request data from a neighbor. Unlike the other methods, it may be
+	// called off the callbacks of the task, e.g. by a timer resending a
+	// request; the request is of the epoch current when it is called.
 	DataRequest(toID uint64, meta string)
 
+	// Handle the typed data requests of the name with the handler, which
+	// serves them instead of Serve. All tasks handle the same names, usually
+	// in Init. TypedDataRequest requests typed data from a neighbor; it fails
+	// if the argument can't be marshaled. Names must not have "/".
+	Handle(name string, h TypedHandler)
+	TypedDataRequest(toID uint64, name string, arg interface{}) error
+
+	// Register the handler of the calls of the name, which serves them
+	// instead of Serve, so that a task exposes several endpoints rather than
+	// switching on requests. Call calls the handler of a neighbor with the
+	// args. The result, or the error of the call, e.g.
+	// frameworkhttp.ErrNoHandler if the neighbor has no handler of the name,
+	// goes to CallReady of tasks implementing CallReceiver. Names must not
+	// have "/".
+	RegisterHandler(name string, h HandlerFunc)
+	Call(toID uint64, name string, args []byte)
+
+	// Respond to a data request deferred by DeferredServer. Responses to
+	// requests which are no longer pending, e.g. of an epoch which is over,
+	// are dropped.
+	Respond(requestID uint64, data []byte)
+
+	// Aggregate the data of all tasks of current epoch along the links of a
+	// tree or a ring topology, see pkg/collective. AllReduce gives the result
+	// to all tasks, Reduce to the root only, and Broadcast gives the data of
+	// the root to all. All tasks run the same ones in the same order in an
+	// epoch. They block until done, so tasks call them in their own
+	// goroutines, and fail if the epoch ends before.
+	AllReduce(data []byte, reduce ReduceFunc) ([]byte, error)
+	Reduce(data []byte, reduce ReduceFunc) ([]byte, error)
+	Broadcast(data []byte) ([]byte, error)
+
+	// Send the payload to any task, linked by the topology or not, e.g. to
+	// hand a shard over to another worker. Tasks implementing MessageReceiver
+	// take it. It is best effort: messages which can't be delivered end up in
+	// the dead letters of the job.
+	SendMessage(toID uint64, payload []byte)
+
+	// The config of the job, e.g. hyperparameters, as set by the controller
+	// (see controller.SetJobConfig). It is read when the node starts, and
+	// kept up to date for as long as it runs; tasks implementing
+	// ConfigObserver learn of changes.
+	GetJobConfig() map[string]string
+
+	// Push the payload to any task within current epoch, e.g. a gradient to
+	// aggregate. Unlike messages, pushes are bound to the epoch: each push of
+	// epoch e is either taken by the receiver before it moves to epoch e+1, or
+	// reported failed to the sender, giving aggregation a clean cut-off (see
+	// PushReceiver and PushFailureReceiver).
+	Push(toID uint64, payload []byte)
+
 	// This is used to figure out taskid for current node
 	GetTaskID() uint64
+
+	// Tell the framework the task is making progress. A task which is stuck,
+	// i.e. doesn't report progress nor start a new epoch in time, is failed
+	// over if the framework is configured with a progress timeout.
+	ReportProgress()
+
+	// Publish an event on the topic, e.g. a learning rate change or an early
+	// stop, to all tasks subscribed to it, whatever the topology. Events have
+	// to be small, since they are stored in etcd.
+	Publish(topic, data string)
+	// Subscribe to the events published on the topic from now on. The handler
+	// is called for each of them, in order, for as long as the node runs.
+	Subscribe(topic string, handler func(data string))
+
+	// Emit a result of the task at current epoch, e.g. metrics or
+	// predictions, to the sink of the node. Results are written once the
+	// epoch is over.
+	Emit(record []byte)
+
+	// Export an artifact of the job, e.g. the URL of a model, for the jobs
+	// depending on it (see etcdutil.JobSpec). It outlives the job.
+	ExportArtifact(name, value string)
+
+	// Assign shards of the data, e.g. files or key ranges, to tasks for
+	// current epoch, by task ID. Tasks implementing ShardReceiver get theirs.
+	// The shards of a task failing in the epoch are reassigned to the other
+	// tasks of the assignment. Like DataRequest, it is meant to be called
+	// synchronously in the callbacks of the task, usually by a master in
+	// SetEpoch.
+	AssignShards(shards map[uint64][]string)
+
+	// Record the result of a unit of work of the job, e.g. a work item,
+	// which outlives the job as artifacts do, so that a retry of the job
+	// (see controller.Retry) reuses it instead of redoing the work.
+	RecordResult(key, value string)
+	// The results recorded by the job, including before it was retried.
+	GetResults() map[string]string
 }
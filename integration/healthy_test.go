@@ -26,8 +26,11 @@ func TestHeartbeat(t *testing.T) {
 		t.Fatal("ttl node should expire")
 	}
 
-	client.Create(etcdutil.TaskHealthyPath(name, taskID), "health", ttl)
-	go etcdutil.Heartbeat(client, name, taskID, interval, stop)
+	claim, err := etcdutil.ClaimTask(client, name, taskID, "host:1234")
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	go etcdutil.Heartbeat(client, name, claim, interval, 0, stop)
 	time.Sleep(6 * interval)
 	_, err = client.Get(etcdutil.TaskHealthyPath(name, taskID), false, false)
 	if err != nil {
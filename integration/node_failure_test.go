@@ -5,9 +5,11 @@ import (
 	"testing"
 
 	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop"
 	"github.com/go-distributed/meritop/controller"
 	"github.com/go-distributed/meritop/framework"
 	"github.com/go-distributed/meritop/pkg/etcdutil"
+	"github.com/go-distributed/meritop/pkg/faultinject"
 )
 
 // TestMasterSetEpochFailure checks if a master task failed at SetEpoch,
@@ -32,17 +34,18 @@ func TestMasterSetEpochFailure(t *testing.T) {
 		GDataChan:    make(chan int32, 10),
 		FinishChan:   make(chan struct{}),
 		NodeProducer: make(chan bool, 1),
-		MasterConfig: map[string]string{
-			"SetEpoch":  "fail",
-			"failepoch": "1",
-			"faillevel": "100",
-		},
+		// fail once, so that the new node finishes the job
+		MasterFaults: faultinject.NewSchedule(1, faultinject.Fault{
+			Callback:    faultinject.SetEpoch,
+			Epochs:      []uint64{1},
+			Probability: 1,
+			Limit:       1,
+		}),
 	}
 	for i := uint64(0); i < numOfTasks; i++ {
 		go drive(t, job, etcdURLs, numOfTasks, taskBuilder)
 	}
 	if <-taskBuilder.NodeProducer {
-		taskBuilder.MasterConfig = nil
 		log.Println("Starting a new node")
 		// this time we start a new bootstrap whose task master doesn't fail.
 		go drive(t, job, etcdURLs, numOfTasks, taskBuilder)
@@ -65,25 +68,25 @@ func TestMasterSetEpochFailure(t *testing.T) {
 
 func TestSlaveParentDataReadyFailure(t *testing.T) {
 	job := "TestSlavePDataReadyFailure"
-	slaveConfig := map[string]string{
-		"ParentDataReady": "fail",
-		"faillevel":       "3",
-	}
-	testSlaveFailure(t, job, slaveConfig)
+	testSlaveFailure(t, job, faultinject.Fault{
+		Callback:    faultinject.DataReady,
+		LinkType:    meritop.LinkParent,
+		Probability: 0.03,
+	})
 }
 
 // This test tests fault tolerance in slave ChildDataReady() if node fails before/after
 // sending data to parent node
 func TestSlaveChildDataReadyFailure(t *testing.T) {
 	job := "TestSlaveChildDataReadyFailure"
-	slaveConfig := map[string]string{
-		"ChildDataReady": "fail",
-		"faillevel":      "3",
-	}
-	testSlaveFailure(t, job, slaveConfig)
+	testSlaveFailure(t, job, faultinject.Fault{
+		Callback:    faultinject.DataReady,
+		LinkType:    meritop.LinkChild,
+		Probability: 0.03,
+	})
 }
 
-func testSlaveFailure(t *testing.T, job string, slaveConfig map[string]string) {
+func testSlaveFailure(t *testing.T, job string, fault faultinject.Fault) {
 	m := etcdutil.StartNewEtcdServer(t, job)
 	defer m.Terminate(t)
 
@@ -100,7 +103,7 @@ func testSlaveFailure(t *testing.T, job string, slaveConfig map[string]string) {
 		GDataChan:    make(chan int32, 10),
 		FinishChan:   make(chan struct{}),
 		NodeProducer: make(chan bool, 1),
-		SlaveConfig:  slaveConfig,
+		SlaveFaults:  faultinject.NewSchedule(1, fault),
 	}
 	go func() {
 		for _ = range taskBuilder.NodeProducer {
@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/controller"
+	"github.com/go-distributed/meritop/example"
+	"github.com/go-distributed/meritop/framework"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// TestParameterServer runs the example parameter server tasks with 2 servers
+// and 3 workers. Workers' data points are 0, 1, 2, so every value of the model
+// goes from 0 towards 1, halving the distance at each epoch.
+func TestParameterServer(t *testing.T) {
+	job := "TestParameterServer"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	etcdURLs := []string{m.URL()}
+
+	nServers, nWorkers := uint64(2), uint64(3)
+	controller := controller.New(job, etcd.NewClient(etcdURLs), nServers+nWorkers)
+	controller.Start()
+	defer controller.Stop()
+
+	taskBuilder := &example.PSTaskBuilder{
+		NumOfServers: nServers,
+		NumOfWorkers: nWorkers,
+		Dim:          5,
+		LearningRate: 0.5,
+		NumOfEpochs:  4,
+		ShardChan:    make(chan map[uint64][]float64, nServers),
+	}
+	for i := uint64(0); i < nServers+nWorkers; i++ {
+		go func() {
+			bootstrap := framework.NewBootStrap(job, etcdURLs, createListener(t), nil)
+			bootstrap.SetTaskBuilder(taskBuilder)
+			bootstrap.SetTopology(example.NewParameterServerTopology(nServers, nWorkers))
+			bootstrap.Start()
+		}()
+	}
+
+	// 5 updates: 1 - 0.5^5
+	want := 0.96875
+	got := 0
+	for i := uint64(0); i < nServers; i++ {
+		for id, shard := range <-taskBuilder.ShardChan {
+			for j, v := range shard {
+				got++
+				if v != want {
+					t.Errorf("server %d, value #%d: want = %v, get = %v", id, j, want, v)
+				}
+			}
+		}
+	}
+	if got != taskBuilder.Dim {
+		t.Errorf("number of values want = %d, get = %d", taskBuilder.Dim, got)
+	}
+}
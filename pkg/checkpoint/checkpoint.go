@@ -0,0 +1,17 @@
+package checkpoint
+
+import "errors"
+
+var ErrNotFound = errors.New("checkpoint: not found")
+
+// Store persists task snapshots keyed by task ID and epoch. Framework uses it
+// to save the state of tasks implementing meritop.Checkpointer, and to bring
+// them back when a new node takes over a failed task.
+type Store interface {
+	// Save persists the snapshot of given task taken at the given epoch.
+	Save(taskID, epoch uint64, data []byte) error
+
+	// Latest returns the snapshot with the largest epoch saved for given task.
+	// It returns ErrNotFound if there is none.
+	Latest(taskID uint64) (epoch uint64, data []byte, err error)
+}
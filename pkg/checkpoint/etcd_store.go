@@ -0,0 +1,30 @@
+package checkpoint
+
+import "github.com/go-distributed/meritop/pkg/etcdutil"
+
+// etcdStore keeps snapshots in etcd under the job's checkpoint directory.
+// It is the default store. Since etcd is not designed for large values,
+// tasks with big state should use a blob store instead.
+type etcdStore struct {
+	client etcdutil.Coordinator
+	name   string
+}
+
+func NewEtcdStore(client etcdutil.Coordinator, name string) Store {
+	return &etcdStore{client: client, name: name}
+}
+
+func (s *etcdStore) Save(taskID, epoch uint64, data []byte) error {
+	return etcdutil.SaveCheckpoint(s.client, s.name, taskID, epoch, data)
+}
+
+func (s *etcdStore) Latest(taskID uint64) (uint64, []byte, error) {
+	epoch, data, found, err := etcdutil.GetLatestCheckpoint(s.client, s.name, taskID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !found {
+		return 0, nil, ErrNotFound
+	}
+	return epoch, data, nil
+}
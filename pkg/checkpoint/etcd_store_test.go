@@ -0,0 +1,54 @@
+package checkpoint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+func TestEtcdStore(t *testing.T) {
+	job := "TestEtcdStore"
+	m := etcdutil.StartNewEtcdServer(t, job)
+	defer m.Terminate(t)
+	client := etcd.NewClient([]string{m.URL()})
+	s := NewEtcdStore(client, job)
+
+	if _, _, err := s.Latest(1); err != ErrNotFound {
+		t.Fatalf("Latest on empty store: err want = %v, get = %v", ErrNotFound, err)
+	}
+
+	tests := []struct {
+		epoch uint64
+		data  []byte
+	}{
+		{1, []byte("first")},
+		{2, []byte{0, 1, 2}},
+		{10, []byte("tenth")},
+	}
+	for i, tt := range tests {
+		if err := s.Save(1, tt.epoch, tt.data); err != nil {
+			t.Fatalf("#%d: Save failed: %v", i, err)
+		}
+		ep, data, err := s.Latest(1)
+		if err != nil {
+			t.Fatalf("#%d: Latest failed: %v", i, err)
+		}
+		if ep != tt.epoch || !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("#%d: latest want = (%d, %v), get = (%d, %v)", i, tt.epoch, tt.data, ep, data)
+		}
+		// Snapshots of previous epochs are pruned.
+		resp, err := client.Get(etcdutil.TaskCheckpointDir(job, 1), false, false)
+		if err != nil {
+			t.Fatalf("#%d: Get failed: %v", i, err)
+		}
+		if keys := etcdutil.ListKeys(resp.Node.Nodes); len(keys) != 1 {
+			t.Errorf("#%d: checkpoints want = 1, get = %v", i, keys)
+		}
+	}
+
+	if _, _, err := s.Latest(2); err != ErrNotFound {
+		t.Errorf("Latest of other task: err want = %v, get = %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,90 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// fileStore keeps snapshots on a file system shared by all nodes, e.g. NFS.
+// The layout is {dir}/{taskID}/{epoch}; only the latest snapshot is kept.
+type fileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) Store {
+	return &fileStore{dir: dir}
+}
+
+func (s *fileStore) taskDir(taskID uint64) string {
+	return filepath.Join(s.dir, strconv.FormatUint(taskID, 10))
+}
+
+func (s *fileStore) Save(taskID, epoch uint64, data []byte) error {
+	dir := s.taskDir(taskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, strconv.FormatUint(epoch, 10))
+	// Write to a temp file first so that a crash in the middle won't leave
+	// a partial snapshot behind.
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	epochs, err := s.epochs(taskID)
+	if err != nil {
+		return err
+	}
+	for _, ep := range epochs {
+		if ep < epoch {
+			os.Remove(filepath.Join(dir, strconv.FormatUint(ep, 10)))
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Latest(taskID uint64) (uint64, []byte, error) {
+	epochs, err := s.epochs(taskID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, ErrNotFound
+		}
+		return 0, nil, err
+	}
+	if len(epochs) == 0 {
+		return 0, nil, ErrNotFound
+	}
+	latest := epochs[0]
+	for _, ep := range epochs {
+		if ep > latest {
+			latest = ep
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.taskDir(taskID), strconv.FormatUint(latest, 10)))
+	if err != nil {
+		return 0, nil, err
+	}
+	return latest, data, nil
+}
+
+func (s *fileStore) epochs(taskID uint64) ([]uint64, error) {
+	infos, err := ioutil.ReadDir(s.taskDir(taskID))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]uint64, 0, len(infos))
+	for _, fi := range infos {
+		ep, err := strconv.ParseUint(fi.Name(), 10, 64)
+		if err != nil {
+			// skip temp files
+			continue
+		}
+		res = append(res, ep)
+	}
+	return res, nil
+}
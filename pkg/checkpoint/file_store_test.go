@@ -0,0 +1,47 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewFileStore(dir)
+
+	if _, _, err := s.Latest(1); err != ErrNotFound {
+		t.Fatalf("Latest on empty store: err want = %v, get = %v", ErrNotFound, err)
+	}
+
+	tests := []struct {
+		epoch uint64
+		data  []byte
+	}{
+		{1, []byte("first")},
+		{2, []byte{0, 1, 2}},
+		{10, []byte("tenth")},
+	}
+	for i, tt := range tests {
+		if err := s.Save(1, tt.epoch, tt.data); err != nil {
+			t.Fatalf("#%d: Save failed: %v", i, err)
+		}
+		ep, data, err := s.Latest(1)
+		if err != nil {
+			t.Fatalf("#%d: Latest failed: %v", i, err)
+		}
+		if ep != tt.epoch || !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("#%d: latest want = (%d, %v), get = (%d, %v)", i, tt.epoch, tt.data, ep, data)
+		}
+	}
+
+	// Checkpoints are kept per task.
+	if _, _, err := s.Latest(2); err != ErrNotFound {
+		t.Errorf("Latest of other task: err want = %v, get = %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,151 @@
+package collective
+
+import (
+	"errors"
+
+	"github.com/go-distributed/meritop"
+)
+
+// ErrNoLinks is returned for collectives over a topology which is neither a
+// tree nor a ring.
+var ErrNoLinks = errors.New("collective: topology is neither a tree nor a ring")
+
+// CollectiveReq prefixes the data requests of Collectives, so that they
+// don't mix with those of an Exchanger of the task itself.
+const CollectiveReq = "collective.op"
+
+// ReduceFunc combines two values into one. It must be associative and
+// commutative, since the order values are combined in follows the topology.
+type ReduceFunc func(a, b []byte) []byte
+
+// Links are the links collectives go along: values are reduced from the
+// children up to the root, i.e. the task without parent, and broadcast from
+// the root down to the children. A task has at most one parent.
+type Links struct {
+	Parents  []uint64
+	Children []uint64
+}
+
+// TreeLinks returns the links of the task in a tree topology at the epoch.
+func TreeLinks(topo meritop.Topology, epoch uint64) Links {
+	return Links{
+		Parents:  topo.GetNeighbors(meritop.LinkParent, epoch),
+		Children: topo.GetNeighbors(meritop.LinkChild, epoch),
+	}
+}
+
+// RingLinks returns the links of the task in a ring topology at the epoch.
+// The ring is cut open before task 0, the root, into a chain along next.
+func RingLinks(taskID uint64, topo meritop.Topology, epoch uint64) Links {
+	var l Links
+	if taskID != 0 {
+		l.Parents = topo.GetNeighbors(meritop.LinkPrev, epoch)
+	}
+	for _, next := range topo.GetNeighbors(meritop.LinkNext, epoch) {
+		if next != 0 {
+			l.Children = append(l.Children, next)
+		}
+	}
+	return l
+}
+
+// TopologyLinks returns TreeLinks or RingLinks, according to the link types
+// of the topology.
+func TopologyLinks(taskID uint64, topo meritop.Topology, epoch uint64) (Links, error) {
+	has := make(map[string]bool)
+	for _, linkType := range topo.GetLinkTypes() {
+		has[linkType] = true
+	}
+	switch {
+	case has[meritop.LinkParent] && has[meritop.LinkChild]:
+		return TreeLinks(topo, epoch), nil
+	case has[meritop.LinkPrev] && has[meritop.LinkNext]:
+		return RingLinks(taskID, topo, epoch), nil
+	}
+	return Links{}, ErrNoLinks
+}
+
+// Collectives runs AllReduce, Reduce and Broadcast among all tasks of an
+// epoch, so that tasks don't hand-roll aggregation in their DataReady. All
+// tasks have to run the same collectives in the same order in an epoch. They
+// block until done, or fail with ErrEpochChanged, so tasks run them in their
+// own goroutines. Like with Exchanger, SetEpoch, Serve and DataReady are
+// forwarded to it; framework does it for meritop.Framework.AllReduce.
+type Collectives struct {
+	ex *Exchanger
+}
+
+func NewCollectives(dr DataRequester) *Collectives {
+	return &Collectives{ex: newExchanger(dr, CollectiveReq)}
+}
+
+// SetEpoch fails the collectives of the previous epoch which are not done.
+func (c *Collectives) SetEpoch(epoch uint64) { c.ex.SetEpoch(epoch) }
+
+// Serve answers the data request of a peer. It returns false if req isn't
+// for Collectives.
+func (c *Collectives) Serve(fromID uint64, req string) ([]byte, bool) {
+	if _, ok := c.ex.parseExchangeReq(req); !ok {
+		return nil, false
+	}
+	return c.ex.Serve(fromID, req), true
+}
+
+// Handles tells whether req is a data request of the collectives, whose
+// data Serve and DataReady take.
+func (c *Collectives) Handles(req string) bool {
+	_, ok := c.ex.parseExchangeReq(req)
+	return ok
+}
+
+// DataReady takes the response of a peer. It returns false if the response
+// isn't for Collectives.
+func (c *Collectives) DataReady(fromID uint64, req string, resp []byte) bool {
+	return c.ex.DataReady(fromID, req, resp)
+}
+
+// Reduce reduces the data of all tasks to the root, which gets the result.
+// Other tasks get nil.
+func (c *Collectives) Reduce(l Links, data []byte, reduce ReduceFunc) ([]byte, error) {
+	for _, child := range l.Children {
+		d, err := c.ex.Exchange(child, nil)
+		if err != nil {
+			return nil, err
+		}
+		data = reduce(data, d)
+	}
+	if len(l.Parents) == 0 {
+		return data, nil
+	}
+	if _, err := c.ex.Exchange(l.Parents[0], data); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Broadcast sends the data of the root to all tasks, which all get it. The
+// data of other tasks is ignored.
+func (c *Collectives) Broadcast(l Links, data []byte) ([]byte, error) {
+	if len(l.Parents) > 0 {
+		d, err := c.ex.Exchange(l.Parents[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		data = d
+	}
+	for _, child := range l.Children {
+		if _, err := c.ex.Exchange(child, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// AllReduce reduces the data of all tasks, and gives the result to all.
+func (c *Collectives) AllReduce(l Links, data []byte, reduce ReduceFunc) ([]byte, error) {
+	data, err := c.Reduce(l, data, reduce)
+	if err != nil {
+		return nil, err
+	}
+	return c.Broadcast(l, data)
+}
@@ -0,0 +1,154 @@
+package collective
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+)
+
+// collectiveLoopback delivers data requests among collectives directly, like
+// framework does over HTTP.
+type collectiveLoopback struct {
+	id          uint64
+	collectives map[uint64]*Collectives
+}
+
+func (l *collectiveLoopback) DataRequest(toID uint64, req string) {
+	go func() {
+		resp, ok := l.collectives[toID].Serve(l.id, req)
+		if !ok {
+			panic("not a collective request: " + req)
+		}
+		l.collectives[l.id].DataReady(toID, req, resp)
+	}()
+}
+
+// concat joins sorted comma separated lists, so that the result doesn't
+// depend on the order of reduction.
+func concat(a, b []byte) []byte {
+	var all []string
+	for _, d := range [][]byte{a, b} {
+		if len(d) > 0 {
+			all = append(all, strings.Split(string(d), ",")...)
+		}
+	}
+	sort.Strings(all)
+	return []byte(strings.Join(all, ","))
+}
+
+// runCollective runs op on every task of the topology, and returns what each
+// task gets.
+func runCollective(t *testing.T, n uint64, newTopo func(n uint64) meritop.Topology, op func(c *Collectives, l Links, id uint64) ([]byte, error)) []string {
+	collectives := make(map[uint64]*Collectives)
+	for i := uint64(0); i < n; i++ {
+		collectives[i] = NewCollectives(&collectiveLoopback{id: i, collectives: collectives})
+	}
+	got := make([]string, n)
+	var wg sync.WaitGroup
+	for i := uint64(0); i < n; i++ {
+		topo := newTopo(n)
+		topo.SetTaskID(i)
+		l, err := TopologyLinks(i, topo, 0)
+		if err != nil {
+			t.Fatalf("TopologyLinks failed: %v", err)
+		}
+		wg.Add(1)
+		go func(i uint64) {
+			defer wg.Done()
+			d, err := op(collectives[i], l, i)
+			if err != nil {
+				t.Errorf("task %d failed: %v", i, err)
+			}
+			got[i] = string(d)
+		}(i)
+	}
+	wg.Wait()
+	return got
+}
+
+func tree(n uint64) meritop.Topology { return example.NewTreeTopology(2, n) }
+
+func ring(n uint64) meritop.Topology { return example.NewRingTopology(n) }
+
+func TestCollectives(t *testing.T) {
+	all := "0,1,2,3,4,5,6"
+	tests := []struct {
+		name    string
+		n       uint64
+		newTopo func(n uint64) meritop.Topology
+	}{
+		{"tree", 7, tree},
+		{"ring", 7, ring},
+		{"ring of two", 2, ring},
+		{"single task", 1, ring},
+	}
+	for _, tt := range tests {
+		want := strings.Join(strings.Split(all, ",")[:tt.n], ",")
+		got := runCollective(t, tt.n, tt.newTopo, func(c *Collectives, l Links, id uint64) ([]byte, error) {
+			return c.AllReduce(l, []byte(fmt.Sprint(id)), concat)
+		})
+		for i, d := range got {
+			if d != want {
+				t.Errorf("%s: AllReduce of task %d = %q, want %q", tt.name, i, d, want)
+			}
+		}
+
+		got = runCollective(t, tt.n, tt.newTopo, func(c *Collectives, l Links, id uint64) ([]byte, error) {
+			return c.Reduce(l, []byte(fmt.Sprint(id)), concat)
+		})
+		for i, d := range got {
+			if i == 0 && d != want || i != 0 && d != "" {
+				t.Errorf("%s: Reduce of task %d = %q", tt.name, i, d)
+			}
+		}
+
+		got = runCollective(t, tt.n, tt.newTopo, func(c *Collectives, l Links, id uint64) ([]byte, error) {
+			return c.Broadcast(l, []byte(fmt.Sprintf("from %d", id)))
+		})
+		for i, d := range got {
+			if d != "from 0" {
+				t.Errorf("%s: Broadcast to task %d = %q, want from 0", tt.name, i, d)
+			}
+		}
+	}
+}
+
+func TestCollectivesEpochChanged(t *testing.T) {
+	collectives := make(map[uint64]*Collectives)
+	for i := uint64(0); i < 2; i++ {
+		collectives[i] = NewCollectives(&collectiveLoopback{id: i, collectives: collectives})
+	}
+	errc := make(chan error, 1)
+	go func() {
+		// Task 1 never takes part.
+		_, err := collectives[0].Reduce(Links{Children: []uint64{1}}, []byte("0"), concat)
+		errc <- err
+	}()
+	// Let the reduce wait for task 1.
+	waitUntil(collectives[0].ex, func() bool { return collectives[0].ex.peers[1] != nil })
+	collectives[0].SetEpoch(1)
+	collectives[1].SetEpoch(1)
+	if err := <-errc; err != ErrEpochChanged {
+		t.Errorf("Reduce after epoch change = %v, want %v", err, ErrEpochChanged)
+	}
+	if _, ok := collectives[0].Serve(1, ExchangeReq+"/0"); ok {
+		t.Errorf("Serve takes exchange requests of the task")
+	}
+}
+
+func TestTopologyLinks(t *testing.T) {
+	topo := ring(3)
+	topo.SetTaskID(2)
+	l, err := TopologyLinks(2, topo, 0)
+	if err != nil || fmt.Sprint(l) != "{[1] []}" {
+		t.Errorf("links of the last task of a ring = (%v, %v), want ({[1] []}, nil)", l, err)
+	}
+	if _, err := TopologyLinks(0, example.NewRandomPairTopology(0, 2), 0); err != ErrNoLinks {
+		t.Errorf("TopologyLinks of random pairs = %v, want %v", err, ErrNoLinks)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Package collective provides communication patterns built on top of the
+framework's data requests.
+
+Exchanger swaps data between two peers of a symmetric link, e.g. neighbors on
+a ring or a random pair. With plain data requests, each side has to both
+request its peer and serve the peer's request, and a task blocking in Serve on
+its own progress easily deadlocks when both sides ask at the same time.
+Exchanger takes care of the ordering: a request from the peer that comes
+before local data is offered simply waits for it. A task may exchange with the
+same peer more than once in an epoch, e.g. in a ring of two tasks where the
+previous and the next task are the same; the n-th exchange on one side pairs
+with the n-th exchange on the other side.
+
+A task using Exchanger forwards its SetEpoch, Serve and DataReady to it:
+
+	func (t *task) SetEpoch(epoch uint64) {
+		t.ex.SetEpoch(epoch)
+		go func() {
+			peerData, err := t.ex.Exchange(peerID, myData)
+			...
+		}()
+	}
+	func (t *task) Serve(fromID uint64, linkType, req string) []byte {
+		return t.ex.Serve(fromID, req)
+	}
+	func (t *task) DataReady(fromID uint64, linkType, req string, resp []byte) {
+		t.ex.DataReady(fromID, req, resp)
+	}
+
+Collectives builds AllReduce, Reduce and Broadcast of the data of all tasks on
+exchanges along the links of a tree or a ring topology, so that tasks don't
+hand-roll aggregation in their DataReady. The framework runs them for
+meritop.Framework.AllReduce, Reduce and Broadcast.
+*/
+package collective
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrEpochChanged = errors.New("collective: epoch changed before exchange is done")
+
+// ExchangeReq prefixes the data requests Exchanger sends to peers. The full
+// request is ExchangeReq + "/" + sequence number of the exchange in the epoch.
+const ExchangeReq = "collective.exchange"
+
+// The first byte of a response tells whether data follows. A peer whose
+// epoch has ended can't offer data, and it must not look like empty data.
+const (
+	respEpochEnded byte = iota
+	respData
+)
+
+// DataRequester sends data requests to other tasks, e.g. meritop.Framework.
+type DataRequester interface {
+	DataRequest(toID uint64, req string)
+}
+
+// Exchanger swaps data with peers.
+type Exchanger struct {
+	dr DataRequester
+	// prefix of its data requests
+	req string
+
+	mu sync.Mutex
+	// closed when the epoch ends
+	epochDone chan struct{}
+	peers     map[uint64]*peerExchanges
+}
+
+// peerExchanges are the exchanges with one peer in the current epoch, keyed
+// by their sequence numbers.
+type peerExchanges struct {
+	started int
+	// data offered to the peer, and the channel closed once it's offered
+	offered  map[int][]byte
+	offeredC map[int]chan struct{}
+	// data received from the peer
+	received map[int]chan []byte
+}
+
+func NewExchanger(dr DataRequester) *Exchanger {
+	return newExchanger(dr, ExchangeReq)
+}
+
+func newExchanger(dr DataRequester, req string) *Exchanger {
+	e := &Exchanger{dr: dr, req: req}
+	e.reset()
+	return e
+}
+
+func (e *Exchanger) reset() {
+	e.epochDone = make(chan struct{})
+	e.peers = make(map[uint64]*peerExchanges)
+}
+
+func (e *Exchanger) peer(id uint64) *peerExchanges {
+	p, ok := e.peers[id]
+	if !ok {
+		p = &peerExchanges{
+			offered:  make(map[int][]byte),
+			offeredC: make(map[int]chan struct{}),
+			received: make(map[int]chan []byte),
+		}
+		e.peers[id] = p
+	}
+	return p
+}
+
+func (p *peerExchanges) offeredChan(seq int) chan struct{} {
+	c, ok := p.offeredC[seq]
+	if !ok {
+		c = make(chan struct{})
+		p.offeredC[seq] = c
+	}
+	return c
+}
+
+// SetEpoch drops unfinished exchanges of the previous epoch. Pending Exchange
+// calls return ErrEpochChanged.
+func (e *Exchanger) SetEpoch(epoch uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	close(e.epochDone)
+	e.reset()
+}
+
+// Exchange offers data to the peer and blocks until it gets the data the peer
+// offers in return.
+func (e *Exchanger) Exchange(peerID uint64, data []byte) ([]byte, error) {
+	e.mu.Lock()
+	epochDone := e.epochDone
+	p := e.peer(peerID)
+	seq := p.started
+	p.started++
+	p.offered[seq] = data
+	close(p.offeredChan(seq))
+	received := make(chan []byte, 1)
+	p.received[seq] = received
+	e.mu.Unlock()
+
+	e.dr.DataRequest(peerID, e.req+"/"+strconv.Itoa(seq))
+	select {
+	case d := <-received:
+		return d, nil
+	case <-epochDone:
+		return nil, ErrEpochChanged
+	}
+}
+
+func (e *Exchanger) parseExchangeReq(req string) (int, bool) {
+	if !strings.HasPrefix(req, e.req+"/") {
+		return 0, false
+	}
+	seq, err := strconv.Atoi(strings.TrimPrefix(req, e.req+"/"))
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+// Serve answers the exchange request of the peer. If data for the peer isn't
+// offered yet, it waits until it is or the epoch ends. It returns nil if req
+// isn't an exchange request.
+func (e *Exchanger) Serve(fromID uint64, req string) []byte {
+	seq, ok := e.parseExchangeReq(req)
+	if !ok {
+		return nil
+	}
+	e.mu.Lock()
+	epochDone := e.epochDone
+	p := e.peer(fromID)
+	offered := p.offeredChan(seq)
+	e.mu.Unlock()
+
+	select {
+	case <-offered:
+	case <-epochDone:
+		// Framework drops the response anyway since the epoch doesn't match.
+		return []byte{respEpochEnded}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]byte{respData}, p.offered[seq]...)
+}
+
+// DataReady takes the response of an exchange request. It returns false if
+// the response isn't for Exchanger.
+func (e *Exchanger) DataReady(fromID uint64, req string, resp []byte) bool {
+	seq, ok := e.parseExchangeReq(req)
+	if !ok {
+		return false
+	}
+	if len(resp) == 0 || resp[0] != respData {
+		// The peer has moved on. Exchange waits for our own epoch to end.
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.peers[fromID]
+	if !ok {
+		return true
+	}
+	if c, ok := p.received[seq]; ok {
+		delete(p.received, seq)
+		c <- resp[1:]
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package collective
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loopback delivers data requests among exchangers directly, like framework
+// does over HTTP.
+type loopback struct {
+	id        uint64
+	exchanges map[uint64]*Exchanger
+}
+
+func (l *loopback) DataRequest(toID uint64, req string) {
+	go func() {
+		resp := l.exchanges[toID].Serve(l.id, req)
+		l.exchanges[l.id].DataReady(toID, req, resp)
+	}()
+}
+
+func newExchanges(n uint64) map[uint64]*Exchanger {
+	exchanges := make(map[uint64]*Exchanger)
+	for i := uint64(0); i < n; i++ {
+		exchanges[i] = NewExchanger(&loopback{id: i, exchanges: exchanges})
+	}
+	return exchanges
+}
+
+// exchangeRing lets every task exchange with both neighbors at the same time.
+func exchangeRing(t *testing.T, n uint64) {
+	exchanges := newExchanges(n)
+	var wg sync.WaitGroup
+	for i := uint64(0); i < n; i++ {
+		for _, peer := range []uint64{(i + n - 1) % n, (i + 1) % n} {
+			wg.Add(1)
+			go func(i, peer uint64) {
+				defer wg.Done()
+				d, err := exchanges[i].Exchange(peer, []byte(fmt.Sprintf("%d->%d", i, peer)))
+				if err != nil {
+					t.Errorf("task %d Exchange(%d) failed: %v", i, peer, err)
+					return
+				}
+				if want := []byte(fmt.Sprintf("%d->%d", peer, i)); !bytes.Equal(d, want) {
+					t.Errorf("task %d got %s from %d, want %s", i, d, peer, want)
+				}
+			}(i, peer)
+		}
+	}
+	wg.Wait()
+}
+
+func TestExchangeRing(t *testing.T) {
+	exchangeRing(t, 5)
+}
+
+// In a ring of two, both neighbors of a task are the same task.
+func TestExchangeRingOfTwo(t *testing.T) {
+	exchangeRing(t, 2)
+}
+
+func TestExchangeEmptyData(t *testing.T) {
+	exchanges := newExchanges(2)
+	go exchanges[1].Exchange(0, nil)
+	d, err := exchanges[0].Exchange(1, []byte("data"))
+	if err != nil || len(d) != 0 {
+		t.Errorf("Exchange() = (%q, %v), want empty data", d, err)
+	}
+}
+
+// waitUntil polls cond with the exchanger locked.
+func waitUntil(e *Exchanger, cond func() bool) {
+	for {
+		e.mu.Lock()
+		ok := cond()
+		e.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExchangeEpochChanged(t *testing.T) {
+	exchanges := newExchanges(2)
+	errC := make(chan error, 1)
+	go func() {
+		_, err := exchanges[0].Exchange(1, []byte("data"))
+		errC <- err
+	}()
+	// Task 1 never offers its data in this epoch.
+	waitUntil(exchanges[0], func() bool { return exchanges[0].peer(1).started == 1 })
+	waitUntil(exchanges[1], func() bool { return len(exchanges[1].peer(0).offeredC) == 1 })
+
+	// Task 1 moving on must not be taken as data from it.
+	exchanges[1].SetEpoch(1)
+	select {
+	case err := <-errC:
+		t.Fatalf("Exchange() returns %v before its epoch ends", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	exchanges[0].SetEpoch(1)
+	if err := <-errC; err != ErrEpochChanged {
+		t.Errorf("Exchange() = %v, want %v", err, ErrEpochChanged)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Package datacodec marshals the typed values of data requests and responses,
+see meritop.TypedHandler. Codecs are registered by content type, which nodes
+negotiate over HTTP with Accept and Content-Type, as they do compression
+with Accept-Encoding.
+
+Gob, JSON and Protobuf are registered. Applications register their own, e.g.
+one built on a protobuf library, with Register.
+*/
+package datacodec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sync"
+)
+
+// Codec marshals values to data of its content type, and back.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v, a pointer.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Content types of the codecs registered by default.
+const (
+	ContentTypeGob      = "application/x-gob"
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+var (
+	Gob      Codec = gobCodec{}
+	JSON     Codec = jsonCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]Codec{
+		ContentTypeGob:      Gob,
+		ContentTypeJSON:     JSON,
+		ContentTypeProtobuf: Protobuf,
+	}
+)
+
+// Register registers the codec under its content type, replacing the codec
+// registered under it, if any.
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[c.ContentType()] = c
+}
+
+// Get returns the codec of the content type. Parameters of the content
+// type, e.g. charset, are ignored.
+func Get(contentType string) (Codec, bool) {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = t
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := codecs[contentType]
+	return c, ok
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string { return ContentTypeGob }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// Message is a protobuf message marshaling itself, as generated by
+// github.com/gogo/protobuf, so that meritop doesn't depend on any protobuf
+// library. Register a codec of ContentTypeProtobuf for other messages.
+type Message interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(Message)
+	if !ok {
+		return nil, fmt.Errorf("datacodec: %T is not a protobuf message", v)
+	}
+	return m.Marshal()
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(Message)
+	if !ok {
+		return fmt.Errorf("datacodec: %T is not a protobuf message", v)
+	}
+	return m.Unmarshal(data)
+}
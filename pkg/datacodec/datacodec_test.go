@@ -0,0 +1,67 @@
+package datacodec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+	Tag  string
+}
+
+// protoPoint marshals itself, like a generated protobuf message.
+type protoPoint struct{ point }
+
+func (p *protoPoint) Marshal() ([]byte, error) { return JSON.Marshal(p.point) }
+
+func (p *protoPoint) Unmarshal(data []byte) error { return JSON.Unmarshal(data, &p.point) }
+
+func TestCodecs(t *testing.T) {
+	in := point{1, -2, "a"}
+	for _, ct := range []string{ContentTypeGob, ContentTypeJSON, ContentTypeJSON + "; charset=utf-8"} {
+		c, ok := Get(ct)
+		if !ok {
+			t.Fatalf("no codec of %s", ct)
+		}
+		data, err := c.Marshal(in)
+		if err != nil {
+			t.Fatalf("%s: Marshal failed: %v", ct, err)
+		}
+		var out point
+		if err := c.Unmarshal(data, &out); err != nil || !reflect.DeepEqual(out, in) {
+			t.Errorf("%s: Unmarshal = (%+v, %v), want %+v", ct, out, err, in)
+		}
+	}
+
+	data, err := Protobuf.Marshal(&protoPoint{in})
+	if err != nil {
+		t.Fatalf("protobuf: Marshal failed: %v", err)
+	}
+	var out protoPoint
+	if err := Protobuf.Unmarshal(data, &out); err != nil || out.point != in {
+		t.Errorf("protobuf: Unmarshal = (%+v, %v), want %+v", out.point, err, in)
+	}
+	if _, err := Protobuf.Marshal(in); err == nil {
+		t.Errorf("protobuf: Marshal of a struct which isn't a message succeeded")
+	}
+	if _, ok := Get("text/csv"); ok {
+		t.Errorf("got a codec of text/csv")
+	}
+}
+
+type failingCodec struct{}
+
+func (failingCodec) ContentType() string                        { return ContentTypeProtobuf }
+func (failingCodec) Marshal(interface{}) ([]byte, error)        { return nil, errors.New("failing") }
+func (failingCodec) Unmarshal(data []byte, v interface{}) error { return errors.New("failing") }
+
+func TestRegister(t *testing.T) {
+	defer Register(Protobuf)
+	Register(failingCodec{})
+	c, ok := Get(ContentTypeProtobuf)
+	if !ok || c != (failingCodec{}) {
+		t.Errorf("codec of %s = %T, want the registered one", ContentTypeProtobuf, c)
+	}
+}
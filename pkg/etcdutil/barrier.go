@@ -0,0 +1,67 @@
+package etcdutil
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// EnterBarrier marks that given task has entered a barrier of an epoch.
+func EnterBarrier(client Coordinator, name string, epoch uint64, barrier string, taskID uint64) error {
+	_, err := client.Set(BarrierTaskPath(name, epoch, barrier, taskID), "", 0)
+	return err
+}
+
+// WaitBarrier blocks until n tasks have entered the barrier. The caller must
+// have entered it. It returns false if stopped before.
+func WaitBarrier(client Coordinator, name string, epoch uint64, barrier string, n uint64, stop chan bool) (bool, error) {
+	dir := BarrierPath(name, epoch, barrier)
+	resp, err := client.Get(dir, false, false)
+	if err != nil {
+		return false, err
+	}
+	entered := make(map[string]bool)
+	for _, node := range resp.Node.Nodes {
+		entered[node.Key] = true
+	}
+	if uint64(len(entered)) >= n {
+		return true, nil
+	}
+
+	receiver := make(chan *etcd.Response, 1)
+	watchStop := make(chan bool, 1)
+	go client.Watch(dir, resp.EtcdIndex+1, true, receiver, watchStop)
+	defer func() {
+		watchStop <- true
+		for _ = range receiver {
+		}
+	}()
+	for {
+		select {
+		case resp, ok := <-receiver:
+			if !ok {
+				return false, nil
+			}
+			if resp.Action != "set" && resp.Action != "create" {
+				continue
+			}
+			entered[resp.Node.Key] = true
+			if uint64(len(entered)) >= n {
+				return true, nil
+			}
+		case <-stop:
+			return false, nil
+		}
+	}
+}
+
+// LeaveBarrier removes the mark of given task, and the barrier once all tasks
+// have left. It must be called only after the epoch is over, when nobody waits
+// for the barrier any more.
+func LeaveBarrier(client Coordinator, name string, epoch uint64, barrier string, taskID uint64) error {
+	_, err := client.Delete(BarrierTaskPath(name, epoch, barrier, taskID), false)
+	if err != nil && !IsKeyNotFound(err) {
+		return err
+	}
+	// fails as long as other tasks are in the barrier
+	client.DeleteDir(BarrierPath(name, epoch, barrier))
+	return nil
+}
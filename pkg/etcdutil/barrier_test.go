@@ -0,0 +1,66 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestBarrier(t *testing.T) {
+	name := "TestBarrier"
+	m := StartNewEtcdServer(t, name)
+	defer m.Terminate(t)
+	client := etcd.NewClient([]string{m.URL()})
+	n := uint64(3)
+
+	done := make(chan uint64)
+	for id := uint64(0); id < n-1; id++ {
+		go func(id uint64) {
+			if err := EnterBarrier(client, name, 1, "sync", id); err != nil {
+				t.Errorf("EnterBarrier failed: %v", err)
+			}
+			ok, err := WaitBarrier(client, name, 1, "sync", n, make(chan bool, 1))
+			if !ok || err != nil {
+				t.Errorf("WaitBarrier = (%v, %v), want (true, nil)", ok, err)
+			}
+			done <- id
+		}(id)
+	}
+	select {
+	case id := <-done:
+		t.Fatalf("task %d passed the barrier before all tasks entered", id)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// A barrier of another epoch doesn't count.
+	if err := EnterBarrier(client, name, 2, "sync", n-1); err != nil {
+		t.Fatalf("EnterBarrier failed: %v", err)
+	}
+	stop := make(chan bool, 1)
+	stopped := make(chan bool)
+	go func() {
+		ok, _ := WaitBarrier(client, name, 2, "sync", n, stop)
+		stopped <- ok
+	}()
+
+	if err := EnterBarrier(client, name, 1, "sync", n-1); err != nil {
+		t.Fatalf("EnterBarrier failed: %v", err)
+	}
+	for i := uint64(0); i < n-1; i++ {
+		<-done
+	}
+	stop <- true
+	if <-stopped {
+		t.Errorf("stopped WaitBarrier should return false")
+	}
+
+	for id := uint64(0); id < n; id++ {
+		if err := LeaveBarrier(client, name, 1, "sync", id); err != nil {
+			t.Fatalf("LeaveBarrier failed: %v", err)
+		}
+	}
+	if _, err := client.Get(BarrierPath(name, 1, "sync"), false, false); !IsKeyNotFound(err) {
+		t.Errorf("barrier after all tasks left: err want = key not found, get = %v", err)
+	}
+}
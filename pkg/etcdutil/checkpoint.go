@@ -0,0 +1,61 @@
+package etcdutil
+
+import (
+	"encoding/base64"
+	"path"
+	"strconv"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// SaveCheckpoint stores the snapshot of a task at given epoch. Snapshots of
+// previous epochs are removed once the new one is written.
+func SaveCheckpoint(client Coordinator, name string, taskID, epoch uint64, data []byte) error {
+	// etcd values are strings; encode it so that arbitrary bytes survive.
+	value := base64.StdEncoding.EncodeToString(data)
+	if _, err := client.Set(TaskCheckpointPath(name, taskID, epoch), value, 0); err != nil {
+		return err
+	}
+	resp, err := client.Get(TaskCheckpointDir(name, taskID), false, false)
+	if err != nil {
+		return err
+	}
+	for _, n := range resp.Node.Nodes {
+		ep, err := strconv.ParseUint(path.Base(n.Key), 10, 64)
+		if err != nil || ep >= epoch {
+			continue
+		}
+		client.Delete(n.Key, false)
+	}
+	return nil
+}
+
+// GetLatestCheckpoint returns the snapshot with the largest epoch of a task.
+// found is false if the task has never been checkpointed.
+func GetLatestCheckpoint(client Coordinator, name string, taskID uint64) (epoch uint64, data []byte, found bool, err error) {
+	resp, err := client.Get(TaskCheckpointDir(name, taskID), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return 0, nil, false, nil
+		}
+		return 0, nil, false, err
+	}
+	var latest *etcd.Node
+	for _, n := range resp.Node.Nodes {
+		ep, err := strconv.ParseUint(path.Base(n.Key), 10, 64)
+		if err != nil {
+			continue
+		}
+		if latest == nil || ep > epoch {
+			latest, epoch = n, ep
+		}
+	}
+	if latest == nil {
+		return 0, nil, false, nil
+	}
+	data, err = base64.StdEncoding.DecodeString(latest.Value)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	return epoch, data, true, nil
+}
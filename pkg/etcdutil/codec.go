@@ -0,0 +1,134 @@
+package etcdutil
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes the epoch and meta flags of a job in etcd. All tasks of a job
+// use the codec chosen by the controller, see CreateCodec.
+type Codec interface {
+	Name() string
+	EncodeEpoch(epoch uint64) string
+	DecodeEpoch(value string) (uint64, error)
+	// Meta is flagged with the epoch in which it is flagged.
+	EncodeMeta(epoch uint64, meta string) string
+	DecodeMeta(value string) (epoch uint64, meta string, err error)
+}
+
+var (
+	// TextCodec keeps epochs as decimal strings and meta as
+	// "{epoch}-{meta}". It is the default, and readable with etcdctl.
+	TextCodec Codec = textCodec{}
+	// Base64Codec keeps epochs and meta as base64 of the varint epoch
+	// followed by the meta. Large epochs, e.g. ExitEpoch, are shorter than
+	// in text, and meta can hold any bytes. etcd values go through JSON,
+	// which can't hold raw bytes, hence base64.
+	Base64Codec Codec = base64Codec{}
+)
+
+// DecodeError is returned by codecs for malformed values.
+type DecodeError struct {
+	Codec string
+	Value string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("etcdutil: %s codec can't decode %q: %v", e.Codec, e.Value, e.Err)
+}
+
+// CodecByName returns the codec of given name, i.e. "text" or "base64".
+func CodecByName(name string) (Codec, error) {
+	for _, c := range []Codec{TextCodec, Base64Codec} {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("etcdutil: unknown codec %q", name)
+}
+
+func CreateCodec(client Coordinator, appname string, codec Codec) error {
+	_, err := client.Create(CodecPath(appname), codec.Name(), 0)
+	return err
+}
+
+// GetCodec returns the codec of the job. Jobs created before codecs were
+// configurable use TextCodec.
+func GetCodec(client Coordinator, appname string) (Codec, error) {
+	resp, err := client.Get(CodecPath(appname), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return TextCodec, nil
+		}
+		return nil, err
+	}
+	return CodecByName(resp.Node.Value)
+}
+
+type textCodec struct{}
+
+func (textCodec) Name() string { return "text" }
+
+func (textCodec) EncodeEpoch(epoch uint64) string { return strconv.FormatUint(epoch, 10) }
+
+func (c textCodec) DecodeEpoch(value string) (uint64, error) {
+	epoch, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, &DecodeError{Codec: c.Name(), Value: value, Err: err}
+	}
+	return epoch, nil
+}
+
+func (textCodec) EncodeMeta(epoch uint64, meta string) string {
+	return strconv.FormatUint(epoch, 10) + "-" + meta
+}
+
+func (c textCodec) DecodeMeta(value string) (uint64, string, error) {
+	values := strings.SplitN(value, "-", 2)
+	if len(values) != 2 {
+		return 0, "", &DecodeError{Codec: c.Name(), Value: value, Err: errors.New("no epoch")}
+	}
+	epoch, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		return 0, "", &DecodeError{Codec: c.Name(), Value: value, Err: err}
+	}
+	return epoch, values[1], nil
+}
+
+type base64Codec struct{}
+
+func (base64Codec) Name() string { return "base64" }
+
+func (c base64Codec) EncodeEpoch(epoch uint64) string { return c.EncodeMeta(epoch, "") }
+
+func (c base64Codec) DecodeEpoch(value string) (uint64, error) {
+	epoch, meta, err := c.DecodeMeta(value)
+	if err == nil && meta != "" {
+		err = &DecodeError{Codec: c.Name(), Value: value, Err: errors.New("trailing bytes")}
+	}
+	return epoch, err
+}
+
+func (base64Codec) EncodeMeta(epoch uint64, meta string) string {
+	b := make([]byte, binary.MaxVarintLen64+len(meta))
+	n := binary.PutUvarint(b, epoch)
+	n += copy(b[n:], meta)
+	return base64.URLEncoding.EncodeToString(b[:n])
+}
+
+func (c base64Codec) DecodeMeta(value string) (uint64, string, error) {
+	b, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, "", &DecodeError{Codec: c.Name(), Value: value, Err: err}
+	}
+	epoch, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, "", &DecodeError{Codec: c.Name(), Value: value, Err: errors.New("bad varint epoch")}
+	}
+	return epoch, string(b[n:]), nil
+}
@@ -0,0 +1,37 @@
+package etcdutil
+
+import "testing"
+
+func TestCodec(t *testing.T) {
+	for _, c := range []Codec{TextCodec, Base64Codec} {
+		byName, err := CodecByName(c.Name())
+		if err != nil || byName != c {
+			t.Errorf("CodecByName(%q) = %v, %v", c.Name(), byName, err)
+		}
+		for _, epoch := range []uint64{0, 1, 300, ExitEpoch} {
+			got, err := c.DecodeEpoch(c.EncodeEpoch(epoch))
+			if err != nil || got != epoch {
+				t.Errorf("%s: epoch %d decoded as %d, %v", c.Name(), epoch, got, err)
+			}
+			for _, meta := range []string{"", "a", "a-b", "\x00\xff"} {
+				ep, m, err := c.DecodeMeta(c.EncodeMeta(epoch, meta))
+				if err != nil || ep != epoch || m != meta {
+					t.Errorf("%s: meta %d %q decoded as %d %q, %v", c.Name(), epoch, meta, ep, m, err)
+				}
+			}
+		}
+		for _, bad := range []string{"", "x", "-1"} {
+			if _, err := c.DecodeEpoch(bad); err == nil {
+				t.Errorf("%s: DecodeEpoch(%q) succeeded", c.Name(), bad)
+			} else if _, ok := err.(*DecodeError); !ok {
+				t.Errorf("%s: DecodeEpoch(%q) error %v isn't a DecodeError", c.Name(), bad, err)
+			}
+		}
+	}
+	if len(Base64Codec.EncodeEpoch(ExitEpoch)) >= len(TextCodec.EncodeEpoch(ExitEpoch)) {
+		t.Error("base64 exit epoch isn't shorter than text")
+	}
+	if _, err := CodecByName("gob"); err == nil {
+		t.Error("CodecByName(gob) succeeded")
+	}
+}
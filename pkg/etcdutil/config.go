@@ -0,0 +1,67 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// SetJobConfig sets the config of the job, e.g. hyperparameters like the
+// learning rate, replacing the one it had. Tasks watching it get the new one.
+func SetJobConfig(client Coordinator, appname string, config map[string]string) error {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(JobConfigPath(appname), string(b), 0)
+	return err
+}
+
+// GetJobConfig returns the config of the job, empty if it has none.
+func GetJobConfig(client Coordinator, appname string) (map[string]string, error) {
+	resp, err := client.Get(JobConfigPath(appname), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	return decodeJobConfig(resp.Node.Value)
+}
+
+func decodeJobConfig(value string) (map[string]string, error) {
+	config := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return nil, fmt.Errorf("bad job config %q: %v", value, err)
+	}
+	return config, nil
+}
+
+// WatchJobConfig returns the config of the job, and calls onChange with every
+// config set from now on, in order, until stop. Configs which can't be
+// decoded are skipped.
+func WatchJobConfig(client Coordinator, appname string, stop chan bool, onChange func(config map[string]string)) (map[string]string, error) {
+	// The job might have no config yet, but it has a layout.
+	resp, err := client.Get(JobPath(appname), false, false)
+	if err != nil {
+		return nil, err
+	}
+	config, err := GetJobConfig(client, appname)
+	if err != nil {
+		return nil, err
+	}
+	receiver := make(chan *etcd.Response, 1)
+	go client.Watch(JobConfigPath(appname), resp.EtcdIndex+1, false, receiver, stop)
+	go func() {
+		for resp := range receiver {
+			if resp.Action == "delete" || resp.Action == "expire" || resp.Action == "compareAndDelete" {
+				continue
+			}
+			if config, err := decodeJobConfig(resp.Node.Value); err == nil {
+				onChange(config)
+			}
+		}
+	}()
+	return config, nil
+}
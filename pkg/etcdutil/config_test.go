@@ -0,0 +1,50 @@
+package etcdutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobConfig(t *testing.T) {
+	client := NewMemoryCoordinator()
+	job := "TestJobConfig"
+	if err := CreateNumOfTasks(client, job, 2); err != nil {
+		t.Fatal(err)
+	}
+	config, err := GetJobConfig(client, job)
+	if err != nil || len(config) != 0 {
+		t.Fatalf("GetJobConfig = %v, %v, want empty config", config, err)
+	}
+	if err := SetJobConfig(client, job, map[string]string{"lr": "0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan map[string]string, 2)
+	stop := make(chan bool, 1)
+	config, err = WatchJobConfig(client, job, stop, func(c map[string]string) { changes <- c })
+	if err != nil {
+		t.Fatalf("WatchJobConfig failed: %v", err)
+	}
+	if want := map[string]string{"lr": "0.1"}; !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %v, want %v", config, want)
+	}
+	want := map[string]string{"lr": "0.01", "momentum": "0.9"}
+	if err := SetJobConfig(client, job, want); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("changed config = %v, want %v", c, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no config change")
+	}
+	stop <- true
+	SetJobConfig(client, job, map[string]string{})
+	select {
+	case c := <-changes:
+		t.Errorf("config change %v after stop", c)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
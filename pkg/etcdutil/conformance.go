@@ -0,0 +1,148 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// CheckCoordinator checks that c behaves the way the framework expects of a
+// Coordinator. Backends run it in their tests. It uses the keys under
+// /CheckCoordinator, and takes a few seconds to see a TTL expire.
+func CheckCoordinator(t *testing.T, c Coordinator) {
+	const root = "/CheckCoordinator"
+	errorCode := func(err error) int {
+		if e, ok := err.(*etcd.EtcdError); ok {
+			return e.ErrorCode
+		}
+		return 0
+	}
+
+	if _, err := c.Get(root+"/a", false, false); errorCode(err) != errCodeKeyNotFound {
+		t.Fatalf("Get of missing key returns %v", err)
+	}
+	resp, err := c.Create(root+"/a", "1", 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if resp.Node.Value != "1" || resp.Node.CreatedIndex == 0 || resp.Node.CreatedIndex != resp.Node.ModifiedIndex {
+		t.Errorf("Create returns node %+v", resp.Node)
+	}
+	if _, err := c.Create(root+"/a", "1", 0); errorCode(err) != errCodeNodeExist {
+		t.Errorf("Create of existing key returns %v", err)
+	}
+	set, err := c.Set(root+"/a", "2", 0)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if set.Node.ModifiedIndex <= resp.Node.ModifiedIndex {
+		t.Errorf("Set index %d isn't after Create index %d", set.Node.ModifiedIndex, resp.Node.ModifiedIndex)
+	}
+	if resp, err = c.Get(root+"/a", false, false); err != nil || resp.Node.Value != "2" || resp.EtcdIndex < set.Node.ModifiedIndex {
+		t.Errorf("Get after Set returns %+v, %v", resp, err)
+	}
+
+	if _, err := c.CompareAndSwap(root+"/a", "3", 0, "", set.Node.ModifiedIndex+100); errorCode(err) != errCodeTestFailed {
+		t.Errorf("CompareAndSwap of wrong index returns %v", err)
+	}
+	if _, err := c.CompareAndSwap(root+"/b", "3", 0, "", set.Node.ModifiedIndex); errorCode(err) != errCodeKeyNotFound {
+		t.Errorf("CompareAndSwap of missing key returns %v", err)
+	}
+	cas, err := c.CompareAndSwap(root+"/a", "3", 0, "", set.Node.ModifiedIndex)
+	if err != nil {
+		t.Fatalf("CompareAndSwap failed: %v", err)
+	}
+	if cas.Node.CreatedIndex != set.Node.CreatedIndex || cas.Node.ModifiedIndex <= set.Node.ModifiedIndex {
+		t.Errorf("CompareAndSwap returns node %+v after %+v", cas.Node, set.Node)
+	}
+	if _, err := c.CompareAndSwap(root+"/a", "4", 0, "2", 0); errorCode(err) != errCodeTestFailed {
+		t.Errorf("CompareAndSwap of wrong value returns %v", err)
+	}
+	if _, err := c.CompareAndSwap(root+"/a", "4", 0, "3", 0); err != nil {
+		t.Errorf("CompareAndSwap of value failed: %v", err)
+	}
+	if _, err := c.CompareAndDelete(root+"/a", "", cas.Node.ModifiedIndex); errorCode(err) != errCodeTestFailed {
+		t.Errorf("CompareAndDelete of wrong index returns %v", err)
+	}
+	if _, err := c.CompareAndDelete(root+"/a", "4", 0); err != nil {
+		t.Errorf("CompareAndDelete failed: %v", err)
+	}
+	if _, err := c.Get(root+"/a", false, false); errorCode(err) != errCodeKeyNotFound {
+		t.Errorf("Get of deleted key returns %v", err)
+	}
+
+	for _, key := range []string{root + "/d/y/z", root + "/d/x"} {
+		if _, err := c.Create(key, key, 0); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if resp, err = c.Get(root+"/d", true, true); err != nil {
+		t.Fatalf("Get of dir failed: %v", err)
+	}
+	d := resp.Node
+	if !d.Dir || len(d.Nodes) != 2 || d.Nodes[0].Key != root+"/d/x" || d.Nodes[0].Value != root+"/d/x" ||
+		!d.Nodes[1].Dir || len(d.Nodes[1].Nodes) != 1 || d.Nodes[1].Nodes[0].Key != root+"/d/y/z" {
+		t.Errorf("recursive Get of dir returns %+v", d)
+	}
+	if resp, err = c.Get(root+"/d", true, false); err != nil || len(resp.Node.Nodes) != 2 || len(resp.Node.Nodes[1].Nodes) != 0 {
+		t.Errorf("Get of dir returns %+v, %v", resp, err)
+	}
+	if _, err := c.Delete(root+"/d/x", false); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := c.Delete(root+"/d/y/z", false); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := c.DeleteDir(root + "/d/y"); err != nil {
+		t.Errorf("DeleteDir of empty dir failed: %v", err)
+	}
+
+	receiver := make(chan *etcd.Response, 10)
+	stop := make(chan bool, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		_, err := c.Watch(root+"/w", resp.EtcdIndex+1, true, receiver, stop)
+		watchErr <- err
+	}()
+	if _, err := c.Set(root+"/w/1", "w", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := c.Delete(root+"/w/1", false); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := c.Create(root+"/w/2", "ttl", 1); err != nil {
+		t.Fatalf("Create with TTL failed: %v", err)
+	}
+	wanted := []struct {
+		key     string
+		actions map[string]bool
+	}{
+		{root + "/w/1", map[string]bool{"set": true}},
+		{root + "/w/1", map[string]bool{"delete": true}},
+		{root + "/w/2", map[string]bool{"create": true, "set": true}},
+		{root + "/w/2", map[string]bool{"expire": true, "delete": true}},
+	}
+	timeout := time.After(10 * time.Second)
+	for _, w := range wanted {
+		select {
+		case resp := <-receiver:
+			if resp.Node.Key != w.key || !w.actions[resp.Action] {
+				t.Errorf("watched %s %s, want %s %v", resp.Action, resp.Node.Key, w.key, w.actions)
+			}
+		case <-timeout:
+			t.Fatalf("timed out watching %s %v", w.key, w.actions)
+		}
+	}
+	stop <- true
+	for _ = range receiver {
+	}
+	<-watchErr
+
+	if _, err := c.Delete(root, true); err != nil {
+		t.Errorf("recursive Delete failed: %v", err)
+	}
+	if _, err := c.Get(root+"/d", false, false); errorCode(err) != errCodeKeyNotFound {
+		t.Errorf("Get after recursive Delete returns %v", err)
+	}
+}
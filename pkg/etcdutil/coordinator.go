@@ -0,0 +1,67 @@
+package etcdutil
+
+import (
+	"fmt"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// Versions of the etcd API.
+const (
+	APIv2 = "v2"
+	APIv3 = "v3"
+)
+
+// Coordinator is the store that the controller and the nodes of a job
+// coordinate through: the epoch, the free tasks, claims and heartbeats, meta
+// flags and barriers are all keys in it, see layout.go. Its API is the part
+// of the etcd v2 API meritop uses, so *etcd.Client is one. NewV3Client
+// implements it on etcd v3; other stores, e.g. ZooKeeper or Consul, can be
+// plugged in by implementing it with the same semantics, checked by
+// CheckCoordinator:
+//   - Keys are paths; a directory is implied by the keys under it.
+//   - Every change gets an index larger than all before it. Nodes carry the
+//     index of their creation and last change, and responses the index of
+//     the store.
+//   - A key with a TTL in seconds expires unless it is written again.
+//   - Errors are *etcd.EtcdError with the v2 error codes, e.g. 100 for key
+//     not found, 101 for compare failed and 105 for key already exists, or
+//     501 if the store isn't reachable.
+//   - Watch sends changes of the key, or of all keys under it if
+//     recursive, from the given index on, with actions "set", "create",
+//     "compareAndSwap", "delete", "compareAndDelete" or "expire". Backends
+//     which can't tell some apart send "set" for writes and "delete" for
+//     deletes. It closes the receiver when it returns.
+//
+// All nodes and the controller of a job must use the same store.
+type Coordinator interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key string, value string, ttl uint64) (*etcd.Response, error)
+	Create(key string, value string, ttl uint64) (*etcd.Response, error)
+	CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+	CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+	DeleteDir(key string) (*etcd.Response, error)
+	Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
+}
+
+// NewCoordinator returns an etcd client of given API version, i.e. APIv2 or
+// APIv3. On several machines, it is a FailoverCoordinator with
+// DefaultFailoverPolicy.
+func NewCoordinator(api string, machines []string) (Coordinator, error) {
+	var dial func(machines []string) Coordinator
+	switch api {
+	case APIv2, "":
+		dial = func(machines []string) Coordinator { return etcd.NewClient(machines) }
+	case APIv3:
+		dial = NewV3Client
+	default:
+		return nil, fmt.Errorf("etcdutil: unknown etcd API %q", api)
+	}
+	if len(machines) < 2 {
+		return dial(machines), nil
+	}
+	return NewFailoverCoordinator(machines, DefaultFailoverPolicy, func(machine string) Coordinator {
+		return dial([]string{machine})
+	}), nil
+}
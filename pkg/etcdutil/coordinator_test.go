@@ -0,0 +1,17 @@
+package etcdutil
+
+import (
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestEtcdCoordinator(t *testing.T) {
+	m := StartNewEtcdServer(t, "TestEtcdCoordinator")
+	defer m.Terminate(t)
+	CheckCoordinator(t, etcd.NewClient([]string{m.URL()}))
+}
+
+func TestMemoryCoordinator(t *testing.T) {
+	CheckCoordinator(t, NewMemoryCoordinator())
+}
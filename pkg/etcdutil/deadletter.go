@@ -0,0 +1,65 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DeadLetter is meta or data a task couldn't deliver to a neighbor, kept in
+// etcd with its context for debugging lost updates.
+type DeadLetter struct {
+	From uint64 `json:"from"`
+	// To is the task data was requested from, and LinkType the neighbors meta
+	// was flagged to.
+	To       uint64 `json:"to,omitempty"`
+	LinkType string `json:"linkType,omitempty"`
+	Epoch    uint64 `json:"epoch"`
+	// Kind is "meta", "data", "message", "push" or "results".
+	Kind string `json:"kind"`
+	// Payload is the meta, or the request of the data.
+	Payload string    `json:"payload"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// AddDeadLetter keeps a dead letter under a key of its own, which expires
+// after ttl seconds unless ttl is 0.
+func AddDeadLetter(client Coordinator, appname string, dl DeadLetter, ttl uint64) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	key := DeadLetterPath(appname, dl.From, strconv.FormatInt(dl.At.UnixNano(), 10))
+	_, err = client.Create(key, string(b), ttl)
+	return err
+}
+
+// GetDeadLetters returns the dead letters of the job, oldest first.
+func GetDeadLetters(client Coordinator, appname string) ([]DeadLetter, error) {
+	resp, err := client.Get(DeadLetterDir(appname), false, true)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dls []DeadLetter
+	for _, n := range resp.Node.Nodes {
+		var dl DeadLetter
+		if err := json.Unmarshal([]byte(n.Value), &dl); err != nil {
+			return nil, fmt.Errorf("bad dead letter %s: %v", n.Key, err)
+		}
+		dls = append(dls, dl)
+	}
+	sort.Sort(byTime(dls))
+	return dls, nil
+}
+
+type byTime []DeadLetter
+
+func (s byTime) Len() int           { return len(s) }
+func (s byTime) Less(i, j int) bool { return s[i].At.Before(s[j].At) }
+func (s byTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,30 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if dls, err := GetDeadLetters(client, "job"); err != nil || dls != nil {
+		t.Fatalf("GetDeadLetters of job without any = (%v, %v), want (nil, nil)", dls, err)
+	}
+	at := time.Unix(1400000000, 0).UTC()
+	letters := []DeadLetter{
+		{From: 2, To: 1, Epoch: 3, Kind: "data", Payload: "req", Error: "connection refused", At: at.Add(time.Second)},
+		{From: 1, LinkType: "parent", Epoch: 3, Kind: "meta", Payload: "ready", Error: "etcd down", At: at},
+	}
+	for _, dl := range letters {
+		if err := AddDeadLetter(client, "job", dl, 0); err != nil {
+			t.Fatalf("AddDeadLetter failed: %v", err)
+		}
+	}
+	dls, err := GetDeadLetters(client, "job")
+	if err != nil {
+		t.Fatalf("GetDeadLetters failed: %v", err)
+	}
+	if len(dls) != 2 || dls[0].Kind != "meta" || dls[1] != letters[0] {
+		t.Errorf("dead letters = %+v, want oldest first", dls)
+	}
+}
@@ -0,0 +1,47 @@
+package etcdutil
+
+import (
+	"strconv"
+)
+
+// Value of a free task handed over by draining rather than failure.
+const FreeTaskDrained = "drained"
+
+// RequestDrain asks the node running given task to hand it over to a standby
+// node.
+func RequestDrain(client Coordinator, name string, taskID uint64) error {
+	_, err := client.Set(DrainPath(name, taskID), "", 0)
+	return err
+}
+
+func DrainRequested(client Coordinator, name string, taskID uint64) (bool, error) {
+	_, err := client.Get(DrainPath(name, taskID), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// HandOver releases the claim of a draining task and frees the task for
+// standby nodes. The drain request is kept until a standby node claims the
+// task, so that failure detection doesn't take the release as a failure.
+func HandOver(client Coordinator, name string, c *Claim) error {
+	if err := ReleaseClaim(client, name, c); err != nil {
+		return err
+	}
+	_, err := client.Set(FreeTaskPath(name, strconv.FormatUint(c.TaskID, 10)), FreeTaskDrained, 0)
+	return err
+}
+
+// draining tells whether given task is being handed over.
+func draining(client Coordinator, name, idStr string) bool {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return false
+	}
+	ok, _ := DrainRequested(client, name, id)
+	return ok
+}
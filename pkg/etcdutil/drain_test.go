@@ -0,0 +1,54 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// A drained task is freed for standby nodes without being reported as failed.
+func TestHandOverDrained(t *testing.T) {
+	name := "TestHandOverDrained"
+	m := StartNewEtcdServer(t, name)
+	defer m.Terminate(t)
+	client := etcd.NewClient([]string{m.URL()})
+	if _, err := client.Set(NumTasksPath(name), formatNumTasks(1, 1), 0); err != nil {
+		t.Fatalf("Set numTasks failed: %v", err)
+	}
+
+	failures := make(chan string, 1)
+	stop := make(chan bool)
+	defer close(stop)
+	go WatchFailure(client, name, stop, func(id string) { failures <- id })
+
+	a, err := ClaimTask(client, name, 0, "a:1")
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	if err := RequestDrain(client, name, 0); err != nil {
+		t.Fatalf("RequestDrain failed: %v", err)
+	}
+	if ok, err := DrainRequested(client, name, 0); !ok || err != nil {
+		t.Fatalf("DrainRequested = (%v, %v), want (true, nil)", ok, err)
+	}
+	if err := HandOver(client, name, a); err != nil {
+		t.Fatalf("HandOver failed: %v", err)
+	}
+	resp, err := client.Get(FreeTaskPath(name, "0"), false, false)
+	if err != nil || resp.Node.Value != FreeTaskDrained {
+		t.Fatalf("free task after hand over = (%v, %v), want %q", resp, err, FreeTaskDrained)
+	}
+	select {
+	case id := <-failures:
+		t.Fatalf("task %s reported failed after hand over", id)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if _, err := ClaimTask(client, name, 0, "b:1"); err != nil {
+		t.Fatalf("ClaimTask after hand over failed: %v", err)
+	}
+	if ok, _ := DrainRequested(client, name, 0); ok {
+		t.Errorf("drain request should be done after the task is taken over")
+	}
+}
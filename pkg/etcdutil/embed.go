@@ -0,0 +1,104 @@
+package etcdutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/coreos/etcd/etcdserver"
+	"github.com/coreos/etcd/etcdserver/etcdhttp"
+	"github.com/coreos/etcd/pkg/types"
+)
+
+// EmbeddedEtcd is an etcd cluster of one member running in the process, e.g.
+// of meritop-controller -embed-etcd, so that a job runs on one machine
+// without an etcd cluster to set up. Its clients speak the v2 API.
+type EmbeddedEtcd struct {
+	server    *etcdserver.EtcdServer
+	listeners []net.Listener
+	url       string
+	dataDir   string
+	removeDir bool
+}
+
+// StartEmbeddedEtcd starts a member serving clients on clientAddr, e.g.
+// "127.0.0.1:4001", which keeps its data in dataDir, or in a temporary
+// directory removed by Stop if dataDir is empty. Its peer address is a free
+// port of the loopback interface, as it has no peers.
+func StartEmbeddedEtcd(clientAddr, dataDir string) (e *EmbeddedEtcd, err error) {
+	e = &EmbeddedEtcd{dataDir: dataDir}
+	defer func() {
+		if err != nil {
+			e.Stop()
+		}
+	}()
+	if e.dataDir == "" {
+		if e.dataDir, err = ioutil.TempDir("", "meritop-etcd"); err != nil {
+			return nil, err
+		}
+		e.removeDir = true
+	}
+	cln, err := net.Listen("tcp", clientAddr)
+	if err != nil {
+		return nil, err
+	}
+	e.listeners = append(e.listeners, cln)
+	pln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	e.listeners = append(e.listeners, pln)
+	e.url = "http://" + advertised(cln.Addr())
+	peerURL := "http://" + pln.Addr().String()
+
+	cfg := &etcdserver.ServerConfig{Name: "meritop", DataDir: e.dataDir, NewCluster: true, Transport: &http.Transport{}}
+	if cfg.ClientURLs, err = types.NewURLs([]string{e.url}); err != nil {
+		return nil, err
+	}
+	if cfg.PeerURLs, err = types.NewURLs([]string{peerURL}); err != nil {
+		return nil, err
+	}
+	if cfg.Cluster, err = etcdserver.NewClusterFromString("meritop", cfg.Name+"="+peerURL); err != nil {
+		return nil, err
+	}
+	if e.server, err = etcdserver.NewServer(cfg); err != nil {
+		return nil, fmt.Errorf("etcdutil: failed to start embedded etcd: %v", err)
+	}
+	e.server.Ticker = time.Tick(100 * time.Millisecond)
+	e.server.SyncTicker = time.Tick(500 * time.Millisecond)
+	e.server.Start()
+	go http.Serve(pln, etcdhttp.NewPeerHandler(e.server))
+	go http.Serve(cln, etcdhttp.NewClientHandler(e.server))
+	return e, nil
+}
+
+// advertised is the address clients reach a listener at: that of the
+// loopback interface if it listens on all of them.
+func advertised(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return net.JoinHostPort("127.0.0.1", fmt.Sprint(tcp.Port))
+}
+
+// URL is where clients reach the member, e.g. for NewCoordinator.
+func (e *EmbeddedEtcd) URL() string { return e.url }
+
+// Stop stops the member, and removes its data unless they are kept in a
+// directory given to StartEmbeddedEtcd.
+func (e *EmbeddedEtcd) Stop() error {
+	if e.server != nil {
+		e.server.Stop()
+	}
+	for _, ln := range e.listeners {
+		ln.Close()
+	}
+	if e.removeDir {
+		return os.RemoveAll(e.dataDir)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package etcdutil
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestEmbeddedEtcd(t *testing.T) {
+	e, err := StartEmbeddedEtcd("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatalf("StartEmbeddedEtcd failed: %v", err)
+	}
+	CheckCoordinator(t, etcd.NewClient([]string{e.URL()}))
+	if err := e.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if _, err := os.Stat(e.dataDir); !os.IsNotExist(err) {
+		t.Errorf("data dir %s is left behind: %v", e.dataDir, err)
+	}
+}
+
+func TestEmbeddedEtcdAdvertised(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{&net.TCPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 4001}, "10.0.0.5:4001"},
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 4001}, "127.0.0.1:4001"},
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 4001}, "127.0.0.1:4001"},
+	}
+	for i, tt := range tests {
+		if get := advertised(tt.addr); get != tt.want {
+			t.Errorf("#%d: advertised(%v) = %s, want %s", i, tt.addr, get, tt.want)
+		}
+	}
+}
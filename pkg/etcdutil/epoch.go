@@ -2,19 +2,44 @@ package etcdutil
 
 import (
 	"log"
+	"math"
 	"strconv"
 
 	"github.com/coreos/go-etcd/etcd"
 )
 
-func GetAndWatchEpoch(client *etcd.Client, appname string, epochC chan uint64, stop chan bool) (uint64, error) {
+// When epoch is set to ExitEpoch, all tasks of the job exit.
+const ExitEpoch uint64 = math.MaxUint64
+
+// EpochChange is an epoch with the etcd index at which it started. The index
+// orders epochs with other changes of the job, e.g. scaling.
+type EpochChange struct {
+	Epoch uint64
+	Index uint64
+}
+
+func GetEpochChange(client Coordinator, codec Codec, appname string) (*EpochChange, error) {
+	resp, err := client.Get(EpochPath(appname), false, false)
+	if err != nil {
+		return nil, err
+	}
+	ep, err := codec.DecodeEpoch(resp.Node.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &EpochChange{Epoch: ep, Index: resp.Node.ModifiedIndex}, nil
+}
+
+// GetAndWatchEpoch returns the current epoch and sends every later one to
+// changeC until stop.
+func GetAndWatchEpoch(client Coordinator, codec Codec, appname string, changeC chan *EpochChange, stop chan bool) (*EpochChange, error) {
 	resp, err := client.Get(EpochPath(appname), false, false)
 	if err != nil {
-		log.Fatal("etcdutil: can not get epoch from etcd")
+		return nil, err
 	}
-	ep, err := strconv.ParseUint(resp.Node.Value, 10, 64)
+	ep, err := codec.DecodeEpoch(resp.Node.Value)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	receiver := make(chan *etcd.Response, 1)
 	go client.Watch(EpochPath(appname), resp.EtcdIndex+1, false, receiver, stop)
@@ -23,20 +48,41 @@ func GetAndWatchEpoch(client *etcd.Client, appname string, epochC chan uint64, s
 			if resp.Action != "compareAndSwap" && resp.Action != "set" {
 				continue
 			}
-			epoch, err := strconv.ParseUint(resp.Node.Value, 10, 64)
+			epoch, err := codec.DecodeEpoch(resp.Node.Value)
 			if err != nil {
-				log.Fatal("etcdutil: can't parse epoch from etcd")
+				log.Fatal(err)
 			}
-			epochC <- epoch
+			changeC <- &EpochChange{Epoch: epoch, Index: resp.Node.ModifiedIndex}
 		}
 	}()
+	return &EpochChange{Epoch: ep, Index: resp.Node.ModifiedIndex}, nil
+}
 
-	return ep, nil
+func CASEpoch(client Coordinator, codec Codec, appname string, prevEpoch, epoch uint64) error {
+	_, err := client.CompareAndSwap(EpochPath(appname), codec.EncodeEpoch(epoch), 0, codec.EncodeEpoch(prevEpoch), 0)
+	return err
 }
 
-func CASEpoch(client *etcd.Client, appname string, prevEpoch, epoch uint64) error {
-	prevEpochStr := strconv.FormatUint(prevEpoch, 10)
-	epochStr := strconv.FormatUint(epoch, 10)
-	_, err := client.CompareAndSwap(EpochPath(appname), epochStr, 0, prevEpochStr, 0)
+// CreateEpochMaster designates the task which may advance the epoch of the
+// job, besides the controller.
+func CreateEpochMaster(client Coordinator, appname string, taskID uint64) error {
+	_, err := client.Create(EpochMasterPath(appname), strconv.FormatUint(taskID, 10), 0)
 	return err
 }
+
+// GetEpochMaster returns the task designated to advance the epoch of the job.
+// found is false if there is none, i.e. any task may.
+func GetEpochMaster(client Coordinator, appname string) (taskID uint64, found bool, err error) {
+	resp, err := client.Get(EpochMasterPath(appname), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	taskID, err = strconv.ParseUint(resp.Node.Value, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return taskID, true, nil
+}
@@ -0,0 +1,298 @@
+package etcdutil
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/metrics"
+)
+
+// FailoverPolicy tells how a FailoverCoordinator scores its endpoints.
+type FailoverPolicy struct {
+	// An endpoint which isn't reachable is tried last for Backoff.
+	Backoff time.Duration
+	// An endpoint which turns unreachable or back FlapThreshold times within
+	// FlapWindow is flapping, and is tried last for Quarantine.
+	FlapThreshold int
+	FlapWindow    time.Duration
+	Quarantine    time.Duration
+}
+
+var DefaultFailoverPolicy = FailoverPolicy{
+	Backoff:       10 * time.Second,
+	FlapThreshold: 4,
+	FlapWindow:    time.Minute,
+	Quarantine:    2 * time.Minute,
+}
+
+// Weight of the last request in the moving averages of an endpoint.
+const endpointDecay = 0.2
+
+// EndpointStats is how an endpoint of a FailoverCoordinator fares.
+type EndpointStats struct {
+	URL string `json:"url"`
+	// Moving averages of the latency of requests which reached the
+	// endpoint, and of the share of requests which didn't.
+	Latency   time.Duration `json:"latency"`
+	ErrorRate float64       `json:"errorRate"`
+	Requests  uint64        `json:"requests"`
+	Errors    uint64        `json:"errors"`
+	// The endpoint is tried last until then.
+	DownUntil        time.Time `json:"downUntil"`
+	QuarantinedUntil time.Time `json:"quarantinedUntil"`
+}
+
+type endpoint struct {
+	EndpointStats
+	client Coordinator
+	tried  bool
+	failed bool
+	// times the endpoint turned unreachable or back within the flap window
+	flaps []time.Time
+}
+
+// score is lower for better endpoints. Endpoints not tried yet score 0, so
+// that all are measured.
+func (e *endpoint) score() float64 {
+	return float64(e.Latency) * (1 + 10*e.ErrorRate)
+}
+
+// FailoverCoordinator is a Coordinator on several endpoints of an etcd
+// cluster, each with its own client. Every request goes to the best endpoint
+// first, i.e. the fastest of those with few errors, and fails over to the
+// next one if the endpoint isn't reachable, see IsTransient. Endpoints which
+// fail, or flap, are tried last for a while.
+//
+// Like the etcd client, a write whose endpoint fails after the request was
+// sent might be applied and sent again to the next endpoint, e.g. a Create
+// then fails as the key exists.
+type FailoverCoordinator struct {
+	policy FailoverPolicy
+	// stubbed by tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+
+	requests  *metrics.CounterVec
+	errors    *metrics.CounterVec
+	failovers metrics.Counter
+}
+
+// NewFailoverCoordinator returns a coordinator on given machines, whose
+// clients are returned by dial, e.g. an etcd client of one machine.
+func NewFailoverCoordinator(machines []string, p FailoverPolicy, dial func(machine string) Coordinator) *FailoverCoordinator {
+	c := &FailoverCoordinator{
+		policy:   p,
+		now:      time.Now,
+		requests: metrics.NewCounterVec("endpoint"),
+		errors:   metrics.NewCounterVec("endpoint"),
+	}
+	for _, m := range machines {
+		c.endpoints = append(c.endpoints, &endpoint{EndpointStats: EndpointStats{URL: m}, client: dial(m)})
+	}
+	return c
+}
+
+// Endpoints returns the stats of the endpoints, best first.
+func (c *FailoverCoordinator) Endpoints() []EndpointStats {
+	order := c.order()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]EndpointStats, len(order))
+	for i, e := range order {
+		stats[i] = e.EndpointStats
+	}
+	return stats
+}
+
+// Register exports the requests and errors of each endpoint, and the
+// failovers.
+func (c *FailoverCoordinator) Register(r *metrics.Registry) {
+	r.RegisterCounterVec("meritop_etcd_endpoint_requests_total", "Requests sent to each etcd endpoint.", c.requests)
+	r.RegisterCounterVec("meritop_etcd_endpoint_errors_total", "Requests which failed to reach each etcd endpoint.", c.errors)
+	r.RegisterCounter("meritop_etcd_failovers_total", "Requests which failed over to another etcd endpoint.", &c.failovers)
+}
+
+// order returns the endpoints to try: those which are up by score, then
+// those down, then those quarantined. Ties keep the order of the machines.
+func (c *FailoverCoordinator) order() []*endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	rank := func(e *endpoint) int {
+		switch {
+		case now.Before(e.QuarantinedUntil):
+			return 2
+		case now.Before(e.DownUntil):
+			return 1
+		}
+		return 0
+	}
+	order := append([]*endpoint(nil), c.endpoints...)
+	sort.Stable(byRank{order, rank})
+	return order
+}
+
+type byRank struct {
+	endpoints []*endpoint
+	rank      func(*endpoint) int
+}
+
+func (s byRank) Len() int      { return len(s.endpoints) }
+func (s byRank) Swap(i, j int) { s.endpoints[i], s.endpoints[j] = s.endpoints[j], s.endpoints[i] }
+func (s byRank) Less(i, j int) bool {
+	a, b := s.endpoints[i], s.endpoints[j]
+	if ra, rb := s.rank(a), s.rank(b); ra != rb {
+		return ra < rb
+	}
+	return a.score() < b.score()
+}
+
+// observe scores an endpoint by a request which took d, or failed to reach
+// it. A negative d isn't timed, e.g. of watches.
+func (c *FailoverCoordinator) observe(e *endpoint, d time.Duration, failed bool) {
+	c.requests.With(e.URL).Inc()
+	if failed {
+		c.errors.With(e.URL).Inc()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	e.Requests++
+	if failed {
+		e.Errors++
+		e.ErrorRate += endpointDecay * (1 - e.ErrorRate)
+		e.DownUntil = now.Add(c.policy.Backoff)
+	} else {
+		e.ErrorRate -= endpointDecay * e.ErrorRate
+		e.DownUntil = time.Time{}
+		switch {
+		case d < 0:
+		case e.Latency == 0:
+			e.Latency = d
+		default:
+			e.Latency += time.Duration(endpointDecay * float64(d-e.Latency))
+		}
+	}
+	if e.tried && failed != e.failed {
+		flaps := e.flaps[:0]
+		for _, t := range e.flaps {
+			if now.Sub(t) < c.policy.FlapWindow {
+				flaps = append(flaps, t)
+			}
+		}
+		e.flaps = append(flaps, now)
+		if c.policy.FlapThreshold > 0 && len(e.flaps) >= c.policy.FlapThreshold {
+			e.QuarantinedUntil = now.Add(c.policy.Quarantine)
+			e.flaps = nil
+		}
+	}
+	e.tried, e.failed = true, failed
+}
+
+// unreachable tells whether err is of an endpoint which might be fine on
+// another one.
+func unreachable(err error) bool {
+	return err != nil && err != etcd.ErrWatchStoppedByUser && IsTransient(err)
+}
+
+func (c *FailoverCoordinator) do(op func(Coordinator) (*etcd.Response, error)) (resp *etcd.Response, err error) {
+	for i, e := range c.order() {
+		if i > 0 {
+			c.failovers.Inc()
+		}
+		start := time.Now()
+		resp, err = op(e.client)
+		failed := unreachable(err)
+		c.observe(e, time.Since(start), failed)
+		if !failed {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+func (c *FailoverCoordinator) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) { return cl.Get(key, sort, recursive) })
+}
+
+func (c *FailoverCoordinator) Set(key string, value string, ttl uint64) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) { return cl.Set(key, value, ttl) })
+}
+
+func (c *FailoverCoordinator) Create(key string, value string, ttl uint64) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) { return cl.Create(key, value, ttl) })
+}
+
+func (c *FailoverCoordinator) CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) {
+		return cl.CompareAndSwap(key, value, ttl, prevValue, prevIndex)
+	})
+}
+
+func (c *FailoverCoordinator) CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) { return cl.CompareAndDelete(key, prevValue, prevIndex) })
+}
+
+func (c *FailoverCoordinator) Delete(key string, recursive bool) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) { return cl.Delete(key, recursive) })
+}
+
+func (c *FailoverCoordinator) DeleteDir(key string) (*etcd.Response, error) {
+	return c.do(func(cl Coordinator) (*etcd.Response, error) { return cl.DeleteDir(key) })
+}
+
+// Watch fails over only until a change is sent, as the next endpoint would
+// send it again. The caller watches again from the next index.
+func (c *FailoverCoordinator) Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error) {
+	// The stop of the caller is read here only, as one value sent on it would
+	// stop the watch of an endpoint or the relay of its changes, but not both.
+	// Closing done stops them all.
+	done := make(chan bool)
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-stop:
+			close(done)
+		case <-finished:
+		}
+	}()
+	if receiver == nil {
+		return c.do(func(cl Coordinator) (*etcd.Response, error) {
+			return cl.Watch(prefix, waitIndex, recursive, nil, done)
+		})
+	}
+	defer close(receiver)
+	var resp *etcd.Response
+	var err error
+	for i, e := range c.order() {
+		if i > 0 {
+			c.failovers.Inc()
+		}
+		sent := false
+		inner := make(chan *etcd.Response)
+		relayed := make(chan struct{})
+		go func() {
+			defer close(relayed)
+			for r := range inner {
+				sent = true
+				select {
+				case receiver <- r:
+				case <-done:
+				}
+			}
+		}()
+		resp, err = e.client.Watch(prefix, waitIndex, recursive, inner, done)
+		<-relayed
+		failed := unreachable(err)
+		c.observe(e, -1, failed)
+		if !failed || sent {
+			return resp, err
+		}
+	}
+	return resp, err
+}
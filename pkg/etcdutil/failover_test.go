@@ -0,0 +1,137 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// flakyCoordinator is a member of a cluster which can be slow or down.
+type flakyCoordinator struct {
+	Coordinator
+	delay time.Duration
+	down  bool
+	gets  int
+}
+
+func (f *flakyCoordinator) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	f.gets++
+	if f.down {
+		return nil, &etcd.EtcdError{ErrorCode: etcd.ErrCodeEtcdNotReachable, Message: "down"}
+	}
+	time.Sleep(f.delay)
+	return f.Coordinator.Get(key, sort, recursive)
+}
+
+func TestFailoverCoordinator(t *testing.T) {
+	store := NewMemoryCoordinator()
+	CheckCoordinator(t, NewFailoverCoordinator([]string{"a", "b"}, DefaultFailoverPolicy, func(string) Coordinator {
+		return &flakyCoordinator{Coordinator: store}
+	}))
+}
+
+func TestFailoverOrder(t *testing.T) {
+	store := NewMemoryCoordinator()
+	store.Set("/k", "v", 0)
+	members := map[string]*flakyCoordinator{
+		"a": {Coordinator: store, delay: 20 * time.Millisecond},
+		"b": {Coordinator: store},
+		"c": {Coordinator: store},
+	}
+	c := NewFailoverCoordinator([]string{"a", "b", "c"}, FailoverPolicy{
+		Backoff:       time.Second,
+		FlapThreshold: 3,
+		FlapWindow:    time.Minute,
+		Quarantine:    time.Hour,
+	}, func(m string) Coordinator { return members[m] })
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	get := func() {
+		if _, err := c.Get("/k", false, false); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	order := func() (urls []string) {
+		for _, e := range c.Endpoints() {
+			urls = append(urls, e.URL)
+		}
+		return urls
+	}
+
+	// All endpoints are measured, then the slow one goes last.
+	for i := 0; i < 3; i++ {
+		get()
+	}
+	if o := order(); o[2] != "a" {
+		t.Fatalf("order = %v, want the slow endpoint last", o)
+	}
+	first := order()[0]
+	members[first].down = true
+	get()
+	if o := order(); o[0] == first || o[2] != first {
+		t.Fatalf("order = %v, want %s last as it's down", o, first)
+	}
+	if c.failovers.Value() != 1 {
+		t.Errorf("failovers = %d, want 1", c.failovers.Value())
+	}
+
+	// After the backoff, the endpoint is ahead of the slow one again.
+	members[first].down = false
+	now = now.Add(2 * time.Second)
+	if o := order(); o[2] == first {
+		t.Fatalf("order = %v, want %s back ahead of a", o, first)
+	}
+	// It flaps: back, down and back again.
+	for _, e := range c.endpoints {
+		if e.URL == first {
+			c.observe(e, time.Millisecond, false)
+			c.observe(e, 0, true)
+		}
+	}
+	stats := c.Endpoints()
+	if last := stats[2]; last.URL != first || !last.QuarantinedUntil.Equal(now.Add(time.Hour)) {
+		t.Fatalf("last endpoint = %+v, want %s quarantined", last, first)
+	}
+	if last := stats[2]; last.Requests != 4 || last.Errors != 2 {
+		t.Errorf("%s has %d requests and %d errors, want 4 and 2", first, last.Requests, last.Errors)
+	}
+	// Quarantined endpoints still serve when all others are down.
+	members[first].down = false
+	for m, f := range members {
+		f.down = m != first
+	}
+	get()
+}
+
+// One value sent on stop stops the watch, even while a change waits for the
+// caller to receive it.
+func TestFailoverWatchStop(t *testing.T) {
+	store := NewMemoryCoordinator()
+	c := NewFailoverCoordinator([]string{"a"}, DefaultFailoverPolicy, func(string) Coordinator { return store })
+	resp, err := store.Set("/k", "v", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := make(chan *etcd.Response)
+	stop := make(chan bool)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Watch("/k", resp.Node.ModifiedIndex, false, receiver, stop)
+		errc <- err
+	}()
+	// The change is relayed, and the watch waits for the next one.
+	time.Sleep(50 * time.Millisecond)
+	stop <- true
+	select {
+	case err := <-errc:
+		if err != etcd.ErrWatchStoppedByUser {
+			t.Errorf("Watch = %v, want %v", err, etcd.ErrWatchStoppedByUser)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch didn't stop")
+	}
+	if _, ok := <-receiver; ok {
+		t.Errorf("receiver isn't closed")
+	}
+}
@@ -1,21 +1,33 @@
 package etcdutil
 
 import (
-	"fmt"
-	"log"
+	"errors"
 	"math/rand"
 	"path"
 	"strconv"
 	"time"
 
 	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/logging"
 )
 
-// heartbeat to etcd cluster until stop
-func Heartbeat(client *etcd.Client, name string, taskID uint64, interval time.Duration, stop chan struct{}) error {
+// heartbeat to etcd cluster until stop. The claim expires ttl after the last
+// heartbeat, or three intervals of at least a second if ttl is 0; etcd keeps it
+// in whole seconds.
+// It returns ErrClaimLost if the claim expired and the task might have been
+// taken over by another node. Transient errors are retried at the next
+// heartbeat as long as the claim lasts.
+func Heartbeat(client Coordinator, name string, c *Claim, interval, ttl time.Duration, stop chan struct{}) error {
+	secs := computeTTL(interval, ttl)
+	renewed := time.Now()
 	for {
-		_, err := client.Set(TaskHealthyPath(name, taskID), "health", computeTTL(interval))
-		if err != nil {
+		err := c.renew(client, name, secs)
+		switch {
+		case err == nil:
+			renewed = time.Now()
+		case err == ErrClaimLost || !IsTransient(err):
+			return err
+		case time.Since(renewed) > time.Duration(secs)*time.Second:
 			return err
 		}
 		select {
@@ -27,78 +39,160 @@ func Heartbeat(client *etcd.Client, name string, taskID uint64, interval time.Du
 }
 
 // detect failure of the given taskID
-func DetectFailure(client *etcd.Client, name string, stop chan bool, logger *log.Logger) error {
+func DetectFailure(client Coordinator, name string, stop chan bool, logger logging.Logger) error {
+	return WatchFailure(client, name, stop, func(failedTask string) {
+		err := ReportFailure(client, name, failedTask)
+		if err != nil {
+			logger.Errorf("ReportFailure returns error: %v", err)
+		}
+	})
+}
+
+// WatchFailure calls onFailure with the ID of every failed task until stop.
+func WatchFailure(client Coordinator, name string, stop chan bool, onFailure func(failedTask string)) error {
 	receiver := make(chan *etcd.Response, 1)
 	go client.Watch(HealthyPath(name), 0, true, receiver, stop)
 	for resp := range receiver {
-		if resp.Action != "expire" && resp.Action != "delete" {
+		// A released claim is deleted with compareAndDelete.
+		if resp.Action != "expire" && resp.Action != "delete" && resp.Action != "compareAndDelete" {
 			continue
 		}
-		err := ReportFailure(client, name, path.Base(resp.Node.Key))
-		if err != nil {
-			logger.Printf("ReportFailure returns error: %v", err)
+		if removed(client, name, path.Base(resp.Node.Key)) {
+			// The task was removed by scaling down, not failed.
+			continue
+		}
+		if resp.Action == "compareAndDelete" && draining(client, name, path.Base(resp.Node.Key)) {
+			// The claim was released to hand the task over to a standby
+			// node. If the node dies while draining, the claim expires.
+			continue
 		}
+		onFailure(path.Base(resp.Node.Key))
 	}
 	return nil
 }
 
+// removed tells whether given task is beyond the current number of tasks.
+func removed(client Coordinator, name, idStr string) bool {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return false
+	}
+	n, err := GetNumOfTasks(client, name)
+	if err != nil {
+		return false
+	}
+	return id >= n
+}
+
 // report failure to etcd cluster
 // If a framework detects a failure, it tries to report failure to /FreeTasks/{taskID}
-func ReportFailure(client *etcd.Client, name, failedTask string) error {
+func ReportFailure(client Coordinator, name, failedTask string) error {
 	_, err := client.Set(FreeTaskPath(name, failedTask), "failed", 0)
 	return err
 }
 
-// WaitFreeTask blocks until it gets a hint of free task
-func WaitFreeTask(client *etcd.Client, name string, logger *log.Logger) (uint64, error) {
+// how long WaitFreeTask waits for a task to fail
+var waitFreeTaskTimeout = 10 * time.Second
+
+// ErrWaitFreeTaskTimeout is returned by WaitFreeTask if no task failed in
+// time. Standby nodes wait again unless the job has finished.
+var ErrWaitFreeTaskTimeout = errors.New("WaitFailure timeout!")
+
+// WaitFreeTask blocks until it gets a hint of free task, among those
+// requiring no resources (see CreateRequirements).
+func WaitFreeTask(client Coordinator, name string, logger logging.Logger) (uint64, error) {
+	return waitFreeTask(client, name, logger, false, nil)
+}
+
+// WaitFailedTask is WaitFreeTask for standby nodes: it waits for a task
+// failed or handed over, leaving the tasks no node has run yet to the nodes
+// started for them.
+func WaitFailedTask(client Coordinator, name string, logger logging.Logger) (uint64, error) {
+	return waitFreeTask(client, name, logger, true, nil)
+}
+
+// WaitFreeTaskFor is WaitFreeTask for a node which has given resources: it
+// waits for a free task whose requirements they satisfy.
+func WaitFreeTaskFor(client Coordinator, name string, logger logging.Logger, caps Resources) (uint64, error) {
+	return waitFreeTask(client, name, logger, false, caps)
+}
+
+// WaitFailedTaskFor is WaitFailedTask for a node which has given resources.
+func WaitFailedTaskFor(client Coordinator, name string, logger logging.Logger, caps Resources) (uint64, error) {
+	return waitFreeTask(client, name, logger, true, caps)
+}
+
+func waitFreeTask(client Coordinator, name string, logger logging.Logger, failedOnly bool, caps Resources) (uint64, error) {
+	reqs, err := GetRequirements(client, name)
+	if err != nil {
+		return 0, err
+	}
+	// fits tells whether the free task of given key is one the node may claim.
+	fits := func(key string) bool {
+		id, err := strconv.ParseUint(path.Base(key), 10, 64)
+		return err != nil || caps.Satisfies(reqs[id])
+	}
 	slots, err := client.Get(FreeTaskDir(name), false, true)
 	if err != nil {
 		return 0, err
 	}
-	if total := len(slots.Node.Nodes); total > 0 {
+	var free etcd.Nodes
+	for _, s := range slots.Node.Nodes {
+		if (!failedOnly || s.Value != "") && fits(s.Key) {
+			free = append(free, s)
+		}
+	}
+	if total := len(free); total > 0 {
 		ri := rand.Intn(total)
-		s := slots.Node.Nodes[ri]
+		s := free[ri]
 		idStr := path.Base(s.Key)
 		id, err := strconv.ParseUint(idStr, 0, 64)
 		if err != nil {
 			return 0, err
 		}
-		logger.Printf("got failures %v at index %d, randomly choose %d to try...", ListKeys(slots.Node.Nodes), slots.EtcdIndex, ri)
+		logger.Infof("got failures %v at index %d, randomly choose %d to try...", ListKeys(free), slots.EtcdIndex, ri)
 		return id, nil
 	}
 
-	watchIndex := slots.EtcdIndex + 1
-	respChan := make(chan *etcd.Response, 1)
+	receiver := make(chan *etcd.Response, 1)
+	stop := make(chan bool, 1)
+	defer close(stop)
 	go func() {
-		for {
-			logger.Printf("start to wait failure at index %d", watchIndex)
-			resp, err := client.Watch(FreeTaskDir(name), watchIndex, true, nil, nil)
-			if err != nil {
-				logger.Printf("WARN: WaitFailure watch failed: %v", err)
-				return
+		logger.Debugf("start to wait failure at index %d", slots.EtcdIndex+1)
+		_, err := client.Watch(FreeTaskDir(name), slots.EtcdIndex+1, true, receiver, stop)
+		if err != nil && err != etcd.ErrWatchStoppedByUser {
+			logger.Warnf("WaitFailure watch failed: %v", err)
+		}
+	}()
+	timeout := time.After(waitFreeTaskTimeout)
+	for {
+		select {
+		case resp, ok := <-receiver:
+			if !ok {
+				// The watch failed; wait for the timeout as if no task failed.
+				receiver = nil
+				continue
 			}
-			if resp.Action == "set" {
-				respChan <- resp
-				return
+			if resp.Action != "set" || failedOnly && resp.Node.Value == "" || !fits(resp.Node.Key) {
+				continue
 			}
-			watchIndex = resp.EtcdIndex + 1
+			idStr := path.Base(resp.Node.Key)
+			id, err := strconv.ParseUint(idStr, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return id, nil
+		case <-timeout:
+			return 0, ErrWaitFreeTaskTimeout
 		}
-	}()
-	var resp *etcd.Response
-	select {
-	case resp = <-respChan:
-	case <-time.After(10 * time.Second):
-		return 0, fmt.Errorf("WaitFailure timeout!")
 	}
-	idStr := path.Base(resp.Node.Key)
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		return 0, err
-	}
-	return id, nil
 }
 
-func computeTTL(interval time.Duration) uint64 {
+// computeTTL returns the TTL of a claim in seconds, rounded up.
+func computeTTL(interval, ttl time.Duration) uint64 {
+	if ttl > 0 {
+		return seconds(ttl)
+	}
 	if interval/time.Second < 1 {
 		return 3
 	}
@@ -0,0 +1,54 @@
+package etcdutil
+
+import (
+	"path"
+	"sort"
+	"strconv"
+)
+
+// ListJobs returns the names of the jobs in etcd, in order.
+func ListJobs(client Coordinator) ([]string, error) {
+	resp, err := client.Get(RootDir, true, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jobs []string
+	for _, n := range resp.Node.Nodes {
+		if n.Dir {
+			jobs = append(jobs, path.Base(n.Key))
+		}
+	}
+	sort.Strings(jobs)
+	return jobs, nil
+}
+
+// FreeTasks returns the tasks of the job no node runs, in order: those no
+// node has run yet, and those failed or handed over.
+func FreeTasks(client Coordinator, name string) ([]uint64, error) {
+	resp, err := client.Get(FreeTaskDir(name), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []uint64
+	for _, n := range resp.Node.Nodes {
+		id, err := strconv.ParseUint(path.Base(n.Key), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(uint64s(ids))
+	return ids, nil
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
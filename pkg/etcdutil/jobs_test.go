@@ -0,0 +1,34 @@
+package etcdutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListJobs(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if jobs, err := ListJobs(client); err != nil || len(jobs) != 0 {
+		t.Fatalf("ListJobs = %v, %v, want none", jobs, err)
+	}
+	for _, job := range []string{"b", "a"} {
+		if err := CreateNumOfTasks(client, job, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"2", "0"} {
+		if _, err := client.Create(FreeTaskPath("a", id), "", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs, err := ListJobs(client)
+	if want := []string{"a", "b"}; err != nil || !reflect.DeepEqual(jobs, want) {
+		t.Errorf("ListJobs = %v, %v, want %v", jobs, err, want)
+	}
+	free, err := FreeTasks(client, "a")
+	if want := []uint64{0, 2}; err != nil || !reflect.DeepEqual(free, want) {
+		t.Errorf("FreeTasks = %v, %v, want %v", free, err, want)
+	}
+	if free, err := FreeTasks(client, "b"); err != nil || len(free) != 0 {
+		t.Errorf("FreeTasks = %v, %v, want none", free, err)
+	}
+}
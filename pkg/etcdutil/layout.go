@@ -1,22 +1,44 @@
 package etcdutil
 
 import (
+	"net/url"
 	"path"
 	"strconv"
 )
 
-// The directory layout we going to define in etcd:
+// The directory layout we going to define in etcd, where {app} is
+// /meritop/{job name}, so that jobs sharing an etcd cluster with each other and
+// other users keep to their own subtree:
 //   /{app}/config -> application configuration
+//   /{app}/config/roles/{identity} -> role of admin API caller
+//   /{app}/config/spec -> task builder, topology and params of the job
+//   /{app}/config/jobConfig -> JSON of the config of the job, e.g. hyperparameters
+//   /{app}/config/epochMaster -> ID of the only task which may advance the epoch, if any
+//   /{app}/config/requirements -> JSON of the resources tasks require, by task ID
 //   /{app}/epoch -> global value for epoch
+//   /{app}/numTasks -> current number of tasks, changes when job scales
+//   /{app}/seed -> job-wide random seed
+//   /{app}/codec -> name of the codec of epoch and meta values
 //   /{app}/tasks/: register tasks under this directory
-//   /{app}/tasks/{taskID}/{replicaID} -> pointer to nodes, 0 replicaID means master
-//   /{app}/tasks/{taskID}/parentMeta
-//   /{app}/tasks/{taskID}/childMeta
-//   /{app}/healthy/{taskID} -> tasks' healthy condition
+//   /{app}/tasks/{taskID}/{linkType}Meta, e.g. parentMeta, childMeta
+//   /{app}/healthy/{taskID} -> claim of the task: last heartbeat and address of its node
 //   /{app}/nodes/: register nodes under this directory
 //   /{app}/nodes/{nodeID}/address -> scheme://host:port/{path(if http)}
 //   /{app}/nodes/{nodeID}/ttl -> keep alive timeout
 //   /{app}/FreeTasks/{taskID}
+//   /{app}/drain/{taskID} -> request to hand the task over to a standby node
+//   /{app}/standby/{address} -> standby node waiting to take over a failed task
+//   /{app}/capabilities/{address} -> JSON of the resources of a node looking for a task
+//   /{app}/barriers/{epoch}-{name}/{taskID} -> task has entered the barrier
+//   /{app}/checkpoints/{taskID}/{epoch} -> base64 encoded task snapshot
+//   /{app}/backups/{taskID}-{epoch} -> address of the backup node running a copy of a straggler, empty until one takes it
+//   /{app}/commits/{taskID}-{epoch} -> address of the copy of the task whose output the epoch takes
+//   /{app}/timings/{taskID} -> JSON of how long the task took in its last epochs
+//   /{app}/deadLetters/{taskID}-{unix nano} -> meta or data the task couldn't deliver
+//   /{app}/topics/{topic} -> last event published on the topic
+//   /{app}/shards -> JSON of the last shard assignment, see ShardAssignment
+//   /{app}/datatoken -> token authenticating data requests between tasks
+//   /{app}/layoutLock -> held by the node setting up the layout, if any
 
 const (
 	TasksDir       = "tasks"
@@ -24,52 +46,213 @@ const (
 	ConfigDir      = "config"
 	FreeDir        = "freeTasks"
 	Epoch          = "epoch"
-	TaskMaster     = "0"
+	NumTasks       = "numTasks"
+	Seed           = "seed"
+	ValueCodec     = "codec"
+	DataToken      = "datatoken"
+	LayoutLock     = "layoutLock"
 	TaskParentMeta = "parentMeta"
 	TaskChildMeta  = "childMeta"
+	TaskMetaSuffix = "Meta"
 	NodeAddr       = "address"
 	NodeTTL        = "ttl"
 	Healthy        = "healthy"
+	CheckpointDir  = "checkpoints"
+	RolesDir       = "roles"
+	DrainDir       = "drain"
+	BarriersDir    = "barriers"
+	JobSpecKey     = "spec"
+	JobConfigKey   = "jobConfig"
+	EpochMasterKey = "epochMaster"
+	Requirements   = "requirements"
+	DeadLettersDir = "deadLetters"
+	StandbyDir     = "standby"
+	TopicsDir      = "topics"
+	Shards         = "shards"
+	BackupsDir     = "backups"
+	CommitsDir     = "commits"
+	TimingsDir     = "timings"
+	Capabilities   = "capabilities"
 )
 
+// RootDir is the directory of all jobs.
+const RootDir = "/meritop"
+
+// JobPath is the root of everything the job keeps in etcd.
+func JobPath(appName string) string {
+	return path.Join(RootDir, appName)
+}
+
+func CheckpointPath(appName string) string {
+	return path.Join(JobPath(appName), CheckpointDir)
+}
+
 func EpochPath(appName string) string {
-	return path.Join("/", appName, Epoch)
+	return path.Join(JobPath(appName), Epoch)
+}
+
+func NumTasksPath(appName string) string {
+	return path.Join(JobPath(appName), NumTasks)
+}
+
+func SeedPath(appName string) string {
+	return path.Join(JobPath(appName), Seed)
+}
+
+func CodecPath(appName string) string {
+	return path.Join(JobPath(appName), ValueCodec)
+}
+
+func DataTokenPath(appName string) string {
+	return path.Join(JobPath(appName), DataToken)
+}
+
+func LayoutLockPath(appName string) string {
+	return path.Join(JobPath(appName), LayoutLock)
 }
 
 func HealthyPath(appName string) string {
-	return path.Join("/", appName, Healthy)
+	return path.Join(JobPath(appName), Healthy)
 }
 
 func TaskHealthyPath(appName string, taskID uint64) string {
 	return path.Join(HealthyPath(appName), strconv.FormatUint(taskID, 10))
 }
 func FreeTaskDir(appName string) string {
-	return path.Join("/", appName, FreeDir)
+	return path.Join(JobPath(appName), FreeDir)
 }
 func FreeTaskPath(appName, idStr string) string {
 	return path.Join(FreeTaskDir(appName), idStr)
 }
 
+func StandbyPoolDir(appName string) string {
+	return path.Join(JobPath(appName), StandbyDir)
+}
+
+// StandbyPath escapes the address, so that each standby node is a single key.
+func StandbyPath(appName, addr string) string {
+	return path.Join(StandbyPoolDir(appName), url.QueryEscape(addr))
+}
+
+func CapabilityDir(appName string) string {
+	return path.Join(JobPath(appName), Capabilities)
+}
+
+func CapabilityPath(appName, addr string) string {
+	return path.Join(CapabilityDir(appName), url.QueryEscape(addr))
+}
+
+func DrainPath(appName string, taskID uint64) string {
+	return path.Join(JobPath(appName), DrainDir, strconv.FormatUint(taskID, 10))
+}
+
+// BarrierPath escapes the barrier name, so that each barrier is a single
+// directory.
+func BarrierPath(appName string, epoch uint64, barrier string) string {
+	return path.Join(JobPath(appName), BarriersDir, strconv.FormatUint(epoch, 10)+"-"+url.QueryEscape(barrier))
+}
+
+func BarrierTaskPath(appName string, epoch uint64, barrier string, taskID uint64) string {
+	return path.Join(BarrierPath(appName, epoch, barrier), strconv.FormatUint(taskID, 10))
+}
+
+func DeadLetterDir(appName string) string {
+	return path.Join(JobPath(appName), DeadLettersDir)
+}
+
+func DeadLetterPath(appName string, taskID uint64, id string) string {
+	return path.Join(DeadLetterDir(appName), strconv.FormatUint(taskID, 10)+"-"+id)
+}
+
+// TopicPath escapes the topic, so that each topic is a single key.
+func TopicPath(appName, topic string) string {
+	return path.Join(JobPath(appName), TopicsDir, url.QueryEscape(topic))
+}
+
+func BackupDir(appName string) string {
+	return path.Join(JobPath(appName), BackupsDir)
+}
+
+func BackupPath(appName string, taskID, epoch uint64) string {
+	return path.Join(BackupDir(appName), taskEpoch(taskID, epoch))
+}
+
+func CommitPath(appName string, taskID, epoch uint64) string {
+	return path.Join(JobPath(appName), CommitsDir, taskEpoch(taskID, epoch))
+}
+
+func TimingDir(appName string) string {
+	return path.Join(JobPath(appName), TimingsDir)
+}
+
+func TaskTimingPath(appName string, taskID uint64) string {
+	return path.Join(TimingDir(appName), strconv.FormatUint(taskID, 10))
+}
+
+func taskEpoch(taskID, epoch uint64) string {
+	return strconv.FormatUint(taskID, 10) + "-" + strconv.FormatUint(epoch, 10)
+}
+
+func ShardsPath(appName string) string {
+	return path.Join(JobPath(appName), Shards)
+}
+
 func TaskDirPath(appName string) string {
-	return path.Join("/", appName, TasksDir)
+	return path.Join(JobPath(appName), TasksDir)
 }
 
-func TaskMasterPath(appName string, taskID uint64) string {
-	return path.Join("/", appName, TasksDir, strconv.FormatUint(taskID, 10), TaskMaster)
+// MetaPath is where a task flags meta to its neighbors of the given link type.
+func MetaPath(appName string, taskID uint64, linkType string) string {
+	return path.Join(JobPath(appName),
+		TasksDir,
+		strconv.FormatUint(taskID, 10),
+		linkType+TaskMetaSuffix)
 }
 
 func ParentMetaPath(appName string, taskID uint64) string {
-	return path.Join("/",
-		appName,
+	return path.Join(JobPath(appName),
 		TasksDir,
 		strconv.FormatUint(taskID, 10),
 		TaskParentMeta)
 }
 
 func ChildMetaPath(appName string, taskID uint64) string {
-	return path.Join("/",
-		appName,
+	return path.Join(JobPath(appName),
 		TasksDir,
 		strconv.FormatUint(taskID, 10),
 		TaskChildMeta)
 }
+
+func TaskCheckpointDir(appName string, taskID uint64) string {
+	return path.Join(CheckpointPath(appName), strconv.FormatUint(taskID, 10))
+}
+
+func TaskCheckpointPath(appName string, taskID, epoch uint64) string {
+	return path.Join(TaskCheckpointDir(appName, taskID), strconv.FormatUint(epoch, 10))
+}
+
+func JobSpecPath(appName string) string {
+	return path.Join(JobPath(appName), ConfigDir, JobSpecKey)
+}
+
+func JobConfigPath(appName string) string {
+	return path.Join(JobPath(appName), ConfigDir, JobConfigKey)
+}
+
+func EpochMasterPath(appName string) string {
+	return path.Join(JobPath(appName), ConfigDir, EpochMasterKey)
+}
+
+func RequirementsPath(appName string) string {
+	return path.Join(JobPath(appName), ConfigDir, Requirements)
+}
+
+func RoleDir(appName string) string {
+	return path.Join(JobPath(appName), ConfigDir, RolesDir)
+}
+
+// RolePath escapes the identity, so that it is always a single key right
+// under RoleDir, whatever characters it contains.
+func RolePath(appName, identity string) string {
+	return path.Join(RoleDir(appName), url.QueryEscape(identity))
+}
@@ -0,0 +1,59 @@
+package etcdutil
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// seconds the layout lock outlives a node which crashed holding it
+var layoutLockTTL uint64 = 10
+
+// SetupLayoutOnce calls setup unless the layout of the job is already set up,
+// i.e. it has an epoch. Nodes calling it at the same time take turns with a
+// lock: one calls setup, the others wait until the layout is set up, or the
+// lock expires with a node which crashed holding it. setup must then complete
+// the layout set up halfway. It returns whether setup was called.
+func SetupLayoutOnce(client Coordinator, name string, setup func() error) (bool, error) {
+	lock := LayoutLockPath(name)
+	for {
+		_, err := client.Get(EpochPath(name), false, false)
+		if err == nil {
+			return false, nil
+		}
+		if !IsKeyNotFound(err) {
+			return false, err
+		}
+		_, err = client.Create(lock, "", layoutLockTTL)
+		if err == nil {
+			err = setup()
+			if _, derr := client.Delete(lock, false); err == nil && derr != nil && !IsKeyNotFound(derr) {
+				err = derr
+			}
+			return true, err
+		}
+		if !IsNodeExist(err) {
+			return false, err
+		}
+		var index uint64
+		if etcdErr, ok := err.(*etcd.EtcdError); ok {
+			index = etcdErr.Index
+		}
+		if err := waitGone(client, lock, index+1); err != nil {
+			return false, err
+		}
+	}
+}
+
+// waitGone waits for the key to be deleted or to expire after given index.
+func waitGone(client Coordinator, key string, index uint64) error {
+	for {
+		resp, err := client.Watch(key, index, false, nil, nil)
+		if err != nil {
+			return err
+		}
+		switch resp.Action {
+		case "delete", "expire", "compareAndDelete":
+			return nil
+		}
+		index = resp.Node.ModifiedIndex + 1
+	}
+}
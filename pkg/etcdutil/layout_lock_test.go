@@ -0,0 +1,63 @@
+package etcdutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetupLayoutOnce(t *testing.T) {
+	job := "TestSetupLayoutOnce"
+	client := NewMemoryCoordinator()
+	var mu sync.Mutex
+	setups := 0
+	setup := func() error {
+		mu.Lock()
+		setups++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		_, err := client.Create(EpochPath(job), "0", 0)
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := SetupLayoutOnce(client, job, setup)
+			errc <- err
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		if err != nil {
+			t.Errorf("SetupLayoutOnce failed: %v", err)
+		}
+	}
+	if setups != 1 {
+		t.Errorf("setups = %d, want 1", setups)
+	}
+	if _, err := client.Get(LayoutLockPath(job), false, false); !IsKeyNotFound(err) {
+		t.Errorf("layout lock is left: %v", err)
+	}
+}
+
+// The lock of a node crashed while setting up the layout expires, and the
+// next node sets up the layout.
+func TestSetupLayoutOnceAfterCrash(t *testing.T) {
+	job := "TestSetupLayoutOnceAfterCrash"
+	client := NewMemoryCoordinator()
+	if _, err := client.Create(LayoutLockPath(job), "", 1); err != nil {
+		t.Fatal(err)
+	}
+	setup, err := SetupLayoutOnce(client, job, func() error {
+		_, err := client.Create(EpochPath(job), "0", 0)
+		return err
+	})
+	if !setup || err != nil {
+		t.Errorf("SetupLayoutOnce = (%v, %v), want (true, nil)", setup, err)
+	}
+}
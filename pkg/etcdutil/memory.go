@@ -0,0 +1,335 @@
+package etcdutil
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+const (
+	errCodeNotFile      = 102
+	errCodeRootReadOnly = 107
+
+	// events kept for watches from past indexes, as many as etcd v2 keeps
+	memoryHistory = 1000
+)
+
+// memoryCoordinator is a Coordinator in memory with the semantics of etcd
+// v2, for tests of a whole job in one process.
+type memoryCoordinator struct {
+	mu      sync.Mutex
+	index   uint64
+	root    *memoryNode
+	history []*etcd.Response
+	// closed and replaced on every change, to wake up watches
+	changed chan struct{}
+}
+
+type memoryNode struct {
+	key      string
+	value    string
+	dir      bool
+	children map[string]*memoryNode
+	created  uint64
+	modified uint64
+	expire   time.Time
+}
+
+// NewMemoryCoordinator returns an empty Coordinator in memory. It is meant
+// for tests running the controller and all nodes of a job in one process,
+// e.g. with framework.WithCoordinator.
+func NewMemoryCoordinator() Coordinator {
+	return &memoryCoordinator{
+		root:    &memoryNode{key: "/", dir: true, children: make(map[string]*memoryNode)},
+		changed: make(chan struct{}),
+	}
+}
+
+func (n *memoryNode) etcdNode(recursive, children bool) *etcd.Node {
+	en := &etcd.Node{
+		Key:           n.key,
+		Value:         n.value,
+		Dir:           n.dir,
+		CreatedIndex:  n.created,
+		ModifiedIndex: n.modified,
+	}
+	if !n.expire.IsZero() {
+		expire := n.expire
+		en.Expiration = &expire
+		en.TTL = int64(n.expire.Sub(time.Now())/time.Second) + 1
+	}
+	if n.dir && children {
+		for _, c := range n.children {
+			en.Nodes = append(en.Nodes, c.etcdNode(recursive, recursive))
+		}
+		sort.Sort(byKey(en.Nodes))
+	}
+	return en
+}
+
+func cleanKey(key string) string {
+	return path.Join("/", key)
+}
+
+func (m *memoryCoordinator) error(code int, message, key string) error {
+	return &etcd.EtcdError{ErrorCode: code, Message: message, Cause: key, Index: m.index}
+}
+
+func (m *memoryCoordinator) lookup(key string) *memoryNode {
+	n := m.root
+	if key == "/" {
+		return n
+	}
+	for _, name := range strings.Split(key[1:], "/") {
+		if !n.dir {
+			return nil
+		}
+		if n = n.children[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// parent returns the directory of key, creating it if missing.
+func (m *memoryCoordinator) parent(key string) (*memoryNode, error) {
+	n := m.root
+	names := strings.Split(key[1:], "/")
+	for _, name := range names[:len(names)-1] {
+		c := n.children[name]
+		if c == nil {
+			c = &memoryNode{
+				key:      path.Join(n.key, name),
+				dir:      true,
+				children: make(map[string]*memoryNode),
+				created:  m.index,
+				modified: m.index,
+			}
+			n.children[name] = c
+		}
+		if !c.dir {
+			return nil, m.error(errCodeNotFile, "Not a directory", c.key)
+		}
+		n = c
+	}
+	return n, nil
+}
+
+// change records a change at the current index and wakes up watches.
+func (m *memoryCoordinator) change(resp *etcd.Response) *etcd.Response {
+	resp.EtcdIndex = m.index
+	m.history = append(m.history, resp)
+	if len(m.history) > memoryHistory {
+		m.history = m.history[len(m.history)-memoryHistory:]
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+	return resp
+}
+
+// put writes value at key with given ttl. If keep is set, the node keeps its
+// created index, i.e. it is updated rather than replaced.
+func (m *memoryCoordinator) put(action, key, value string, ttl uint64, keep bool) (*etcd.Response, error) {
+	dir, err := m.parent(key)
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(key)
+	prev := dir.children[name]
+	m.index++
+	n := &memoryNode{key: key, value: value, created: m.index, modified: m.index}
+	if keep && prev != nil {
+		n.created = prev.created
+	}
+	if ttl > 0 {
+		n.expire = time.Now().Add(time.Duration(ttl) * time.Second)
+		time.AfterFunc(time.Duration(ttl)*time.Second, func() { m.expire(key, n) })
+	}
+	dir.children[name] = n
+	resp := &etcd.Response{Action: action, Node: n.etcdNode(false, false)}
+	if prev != nil {
+		resp.PrevNode = prev.etcdNode(false, false)
+	}
+	return m.change(resp), nil
+}
+
+func (m *memoryCoordinator) expire(key string, n *memoryNode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lookup(key) != n {
+		// written again or deleted
+		return
+	}
+	m.remove("expire", n)
+}
+
+func (m *memoryCoordinator) remove(action string, n *memoryNode) *etcd.Response {
+	dir := m.lookup(path.Dir(n.key))
+	delete(dir.children, path.Base(n.key))
+	m.index++
+	return m.change(&etcd.Response{
+		Action:   action,
+		Node:     &etcd.Node{Key: n.key, Dir: n.dir, CreatedIndex: n.created, ModifiedIndex: m.index},
+		PrevNode: n.etcdNode(false, false),
+	})
+}
+
+func (m *memoryCoordinator) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key = cleanKey(key)
+	n := m.lookup(key)
+	if n == nil {
+		return nil, m.error(errCodeKeyNotFound, "Key not found", key)
+	}
+	return &etcd.Response{Action: "get", Node: n.etcdNode(recursive, true), EtcdIndex: m.index}, nil
+}
+
+func (m *memoryCoordinator) Set(key string, value string, ttl uint64) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key = cleanKey(key)
+	if n := m.lookup(key); n != nil && n.dir {
+		return nil, m.error(errCodeNotFile, "Not a file", key)
+	}
+	return m.put("set", key, value, ttl, false)
+}
+
+func (m *memoryCoordinator) Create(key string, value string, ttl uint64) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key = cleanKey(key)
+	if m.lookup(key) != nil {
+		return nil, m.error(errCodeNodeExist, "Key already exists", key)
+	}
+	return m.put("create", key, value, ttl, false)
+}
+
+// compare finds the node at key, and checks it against prevValue and
+// prevIndex if they are set.
+func (m *memoryCoordinator) compare(key, prevValue string, prevIndex uint64) (*memoryNode, error) {
+	n := m.lookup(key)
+	if n == nil {
+		return nil, m.error(errCodeKeyNotFound, "Key not found", key)
+	}
+	if n.dir {
+		return nil, m.error(errCodeNotFile, "Not a file", key)
+	}
+	if prevValue != "" && n.value != prevValue || prevIndex != 0 && n.modified != prevIndex {
+		return nil, m.error(errCodeTestFailed, "Compare failed", key)
+	}
+	return n, nil
+}
+
+func (m *memoryCoordinator) CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key = cleanKey(key)
+	if _, err := m.compare(key, prevValue, prevIndex); err != nil {
+		return nil, err
+	}
+	return m.put("compareAndSwap", key, value, ttl, true)
+}
+
+func (m *memoryCoordinator) CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.compare(cleanKey(key), prevValue, prevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return m.remove("compareAndDelete", n), nil
+}
+
+func (m *memoryCoordinator) Delete(key string, recursive bool) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key = cleanKey(key)
+	n := m.lookup(key)
+	switch {
+	case n == nil:
+		return nil, m.error(errCodeKeyNotFound, "Key not found", key)
+	case n == m.root:
+		return nil, m.error(errCodeRootReadOnly, "Root is read only", key)
+	case n.dir && !recursive:
+		return nil, m.error(errCodeNotFile, "Not a file", key)
+	}
+	return m.remove("delete", n), nil
+}
+
+func (m *memoryCoordinator) DeleteDir(key string) (*etcd.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key = cleanKey(key)
+	n := m.lookup(key)
+	switch {
+	case n == nil:
+		return nil, m.error(errCodeKeyNotFound, "Key not found", key)
+	case n == m.root:
+		return nil, m.error(errCodeRootReadOnly, "Root is read only", key)
+	case !n.dir:
+		return nil, m.error(errCodeNotFile, "Not a directory", key)
+	case len(n.children) > 0:
+		return nil, m.error(errCodeDirNotEmpty, "Directory not empty", key)
+	}
+	return m.remove("delete", n), nil
+}
+
+// watched tells whether a change of key is seen by a watch of prefix.
+func watched(prefix string, recursive bool, key string) bool {
+	return key == prefix ||
+		recursive && strings.HasPrefix(key, dirPrefix(prefix)) ||
+		// a directory above is deleted
+		strings.HasPrefix(prefix, dirPrefix(key))
+}
+
+// Watch sends changes from waitIndex on, or from the next change if it is 0.
+// Like etcd v2, it fails if waitIndex is older than the history kept.
+func (m *memoryCoordinator) Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error) {
+	if receiver != nil {
+		defer close(receiver)
+	}
+	prefix = cleanKey(prefix)
+	m.mu.Lock()
+	next := waitIndex
+	if next == 0 {
+		next = m.index + 1
+	}
+	if len(m.history) > 0 && next < m.history[0].Node.ModifiedIndex {
+		m.mu.Unlock()
+		return nil, m.error(errCodeEventCleared, "The event in requested index is outdated and cleared", prefix)
+	}
+	m.mu.Unlock()
+	for {
+		m.mu.Lock()
+		var events []*etcd.Response
+		for _, resp := range m.history {
+			if resp.Node.ModifiedIndex >= next && watched(prefix, recursive, resp.Node.Key) {
+				events = append(events, resp)
+			}
+		}
+		next = m.index + 1
+		changed := m.changed
+		m.mu.Unlock()
+
+		for _, resp := range events {
+			if receiver == nil {
+				return resp, nil
+			}
+			select {
+			case receiver <- resp:
+			case <-stop:
+				return nil, etcd.ErrWatchStoppedByUser
+			}
+		}
+		select {
+		case <-changed:
+		case <-stop:
+			return nil, etcd.ErrWatchStoppedByUser
+		}
+	}
+}
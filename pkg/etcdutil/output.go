@@ -0,0 +1,255 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// The outputs of jobs are kept apart from their layouts, which are destroyed
+// once they finish, so that later jobs of a pipeline can depend on them:
+//
+//	/meritop-outputs/{job}/done -> time the job finished
+//	/meritop-outputs/{job}/result -> JSON of the JobResult a task finished the
+//	job with, if any
+//	/meritop-outputs/{job}/failure -> JSON of the JobFailure the controller
+//	failed the job with, if any
+//	/meritop-outputs/{job}/artifacts/{name} -> artifact exported by a task,
+//	e.g. the URL of a model
+//	/meritop-outputs/{job}/results/{key} -> result of a unit of work of the
+//	job, e.g. a work item, reused when the job is retried
+const OutputsRootDir = "/meritop-outputs"
+
+func OutputsPath(job string) string {
+	return path.Join(OutputsRootDir, job)
+}
+
+func JobDonePath(job string) string {
+	return path.Join(OutputsPath(job), "done")
+}
+
+func JobResultPath(job string) string {
+	return path.Join(OutputsPath(job), "result")
+}
+
+func JobFailurePath(job string) string {
+	return path.Join(OutputsPath(job), "failure")
+}
+
+func ArtifactPath(job, name string) string {
+	return path.Join(OutputsPath(job), "artifacts", name)
+}
+
+// SetArtifact exports an artifact of the job for the jobs depending on it.
+func SetArtifact(client Coordinator, job, name, value string) error {
+	_, err := client.Set(ArtifactPath(job, name), value, 0)
+	return err
+}
+
+func GetArtifact(client Coordinator, job, name string) (string, error) {
+	resp, err := client.Get(ArtifactPath(job, name), false, false)
+	if err != nil {
+		return "", err
+	}
+	return resp.Node.Value, nil
+}
+
+func ResultsPath(job string) string {
+	return path.Join(OutputsPath(job), "results")
+}
+
+func ResultPath(job, key string) string {
+	return path.Join(ResultsPath(job), key)
+}
+
+// SetResult records the result of a unit of work of the job.
+func SetResult(client Coordinator, job, key, value string) error {
+	_, err := client.Set(ResultPath(job, key), value, 0)
+	return err
+}
+
+// GetResults returns the results recorded by the job by key, none if it has
+// recorded none.
+func GetResults(client Coordinator, job string) (map[string]string, error) {
+	return getValues(client, ResultsPath(job))
+}
+
+// GetArtifacts returns the artifacts exported by the job by name, none if it
+// has exported none.
+func GetArtifacts(client Coordinator, job string) (map[string]string, error) {
+	return getValues(client, path.Join(OutputsPath(job), "artifacts"))
+}
+
+// getValues returns the values under the directory by their key relative to
+// it.
+func getValues(client Coordinator, dir string) (map[string]string, error) {
+	values := make(map[string]string)
+	resp, err := client.Get(dir, false, true)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return values, nil
+		}
+		return nil, err
+	}
+	var collect func(n *etcd.Node)
+	collect = func(n *etcd.Node) {
+		for _, child := range n.Nodes {
+			if child.Dir {
+				collect(child)
+				continue
+			}
+			values[strings.TrimPrefix(child.Key, dir+"/")] = child.Value
+		}
+	}
+	collect(resp.Node)
+	return values, nil
+}
+
+// ClearResults deletes the results recorded by the job.
+func ClearResults(client Coordinator, job string) error {
+	_, err := client.Delete(ResultsPath(job), true)
+	if err != nil && IsKeyNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// SetJobDone records that the job has finished.
+func SetJobDone(client Coordinator, job string, at time.Time) error {
+	_, err := client.Set(JobDonePath(job), at.UTC().Format(time.RFC3339Nano), 0)
+	return err
+}
+
+// JobDone tells whether the job has finished.
+func JobDone(client Coordinator, job string) (bool, error) {
+	_, err := client.Get(JobDonePath(job), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// JobResult is the result a task finished a job with, e.g. the final loss of
+// a training job.
+type JobResult struct {
+	TaskID uint64
+	At     time.Time
+	Result []byte
+}
+
+// CreateJobResult records the result of the job, unless it has one already.
+func CreateJobResult(client Coordinator, job string, r *JobResult) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = client.Create(JobResultPath(job), string(b), 0)
+	return err
+}
+
+// GetJobResult returns the result of the job. The error is key not found if
+// it has none.
+func GetJobResult(client Coordinator, job string) (*JobResult, error) {
+	resp, err := client.Get(JobResultPath(job), false, false)
+	if err != nil {
+		return nil, err
+	}
+	var r JobResult
+	if err := json.Unmarshal([]byte(resp.Node.Value), &r); err != nil {
+		return nil, fmt.Errorf("bad result of job %s: %v", job, err)
+	}
+	return &r, nil
+}
+
+// ClearJobResult deletes the result of the job, e.g. as it runs again.
+func ClearJobResult(client Coordinator, job string) error {
+	_, err := client.Delete(JobResultPath(job), false)
+	if err != nil && IsKeyNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// JobFailure is why the controller failed a job, e.g. as it ran past its
+// deadline.
+type JobFailure struct {
+	Reason string
+	At     time.Time
+}
+
+// CreateJobFailure records why the job failed, unless it has failed already.
+func CreateJobFailure(client Coordinator, job string, f *JobFailure) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = client.Create(JobFailurePath(job), string(b), 0)
+	return err
+}
+
+// GetJobFailure returns why the job failed. The error is key not found if it
+// hasn't.
+func GetJobFailure(client Coordinator, job string) (*JobFailure, error) {
+	resp, err := client.Get(JobFailurePath(job), false, false)
+	if err != nil {
+		return nil, err
+	}
+	var f JobFailure
+	if err := json.Unmarshal([]byte(resp.Node.Value), &f); err != nil {
+		return nil, fmt.Errorf("bad failure of job %s: %v", job, err)
+	}
+	return &f, nil
+}
+
+// ClearJobFailure forgets that the job failed, e.g. as it runs again.
+func ClearJobFailure(client Coordinator, job string) error {
+	_, err := client.Delete(JobFailurePath(job), false)
+	if err != nil && IsKeyNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ClearJobDone forgets that the job has finished, e.g. as it runs again.
+func ClearJobDone(client Coordinator, job string) error {
+	_, err := client.Delete(JobDonePath(job), false)
+	if err != nil && IsKeyNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// WaitJobDone polls at given interval until the job has finished, or stop.
+// It returns false on stop.
+func WaitJobDone(client Coordinator, job string, interval time.Duration, stop chan struct{}) (bool, error) {
+	for {
+		done, err := JobDone(client, job)
+		if err != nil && !IsTransient(err) {
+			return false, err
+		}
+		if done {
+			return true, nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return false, nil
+		}
+	}
+}
+
+// ParseInput splits an input of a job spec, "{job}/{artifact}".
+func ParseInput(input string) (job, artifact string, err error) {
+	i := strings.Index(input, "/")
+	if i <= 0 || i == len(input)-1 {
+		return "", "", fmt.Errorf("input %q isn't job/artifact", input)
+	}
+	return input[:i], input[i+1:], nil
+}
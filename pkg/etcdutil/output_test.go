@@ -0,0 +1,81 @@
+package etcdutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobOutputs(t *testing.T) {
+	client := NewMemoryCoordinator()
+	stop := make(chan struct{})
+	done := make(chan bool, 1)
+	go func() {
+		ok, err := WaitJobDone(client, "prep", time.Millisecond, stop)
+		if err != nil {
+			t.Errorf("WaitJobDone failed: %v", err)
+		}
+		done <- ok
+	}()
+	if err := SetArtifact(client, "prep", "url", "file:///data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetJobDone(client, "prep", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if !<-done {
+		t.Errorf("WaitJobDone returns false, want true")
+	}
+	if v, err := GetArtifact(client, "prep", "url"); err != nil || v != "file:///data" {
+		t.Errorf("GetArtifact = (%q, %v), want file:///data", v, err)
+	}
+
+	close(stop)
+	if ok, err := WaitJobDone(client, "train", time.Millisecond, stop); ok || err != nil {
+		t.Errorf("WaitJobDone of unfinished job after stop = (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestJobResults(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if results, err := GetResults(client, "sweep"); err != nil || len(results) != 0 {
+		t.Errorf("GetResults without results = (%v, %v), want none", results, err)
+	}
+	for key, value := range map[string]string{"item/0": "a", "item/1": "b", "best": "1"} {
+		if err := SetResult(client, "sweep", key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{"item/0": "a", "item/1": "b", "best": "1"}
+	if results, err := GetResults(client, "sweep"); err != nil || !reflect.DeepEqual(results, want) {
+		t.Errorf("GetResults = (%v, %v), want %v", results, err, want)
+	}
+	if err := ClearResults(client, "sweep"); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := GetResults(client, "sweep"); err != nil || len(results) != 0 {
+		t.Errorf("GetResults after ClearResults = (%v, %v), want none", results, err)
+	}
+	if err := ClearResults(client, "sweep"); err != nil {
+		t.Errorf("ClearResults without results failed: %v", err)
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	tests := []struct {
+		input, job, artifact string
+		ok                   bool
+	}{
+		{"prep/url", "prep", "url", true},
+		{"prep/dir/url", "prep", "dir/url", true},
+		{"prep", "", "", false},
+		{"/url", "", "", false},
+		{"prep/", "", "", false},
+	}
+	for _, tt := range tests {
+		job, artifact, err := ParseInput(tt.input)
+		if job != tt.job || artifact != tt.artifact || (err == nil) != tt.ok {
+			t.Errorf("ParseInput(%q) = (%q, %q, %v)", tt.input, job, artifact, err)
+		}
+	}
+}
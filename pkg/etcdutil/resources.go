@@ -0,0 +1,149 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resources are amounts of named resources, e.g. {"gpu": 2, "memory":
+// 16 << 30}, which tasks require and nodes have. A node has none of the
+// resources it doesn't name.
+type Resources map[string]uint64
+
+// Satisfies tells whether r has at least the amounts required.
+func (r Resources) Satisfies(required Resources) bool {
+	for name, amount := range required {
+		if r[name] < amount {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Resources) String() string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + strconv.FormatUint(r[name], 10)
+	}
+	return strings.Join(names, ",")
+}
+
+var resourceUnits = map[string]uint64{"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40}
+
+// ParseResources parses comma separated name=amount pairs, where amounts may
+// end with Ki, Mi, Gi or Ti, e.g. "gpu=1,memory=16Gi".
+func ParseResources(s string) (Resources, error) {
+	r := Resources{}
+	if s == "" {
+		return r, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("etcdutil: resource %q isn't name=amount", pair)
+		}
+		amount, unit := kv[1], uint64(1)
+		if len(amount) > 2 {
+			if u, ok := resourceUnits[amount[len(amount)-2:]]; ok {
+				amount, unit = amount[:len(amount)-2], u
+			}
+		}
+		n, err := strconv.ParseUint(amount, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("etcdutil: bad amount of resource %q", pair)
+		}
+		r[kv[0]] = n * unit
+	}
+	return r, nil
+}
+
+// CreateRequirements records the resources tasks require, by task ID. Nodes
+// only claim the tasks whose requirements they satisfy, see
+// WaitFreeTaskFor; tasks without requirements go to any node.
+func CreateRequirements(client Coordinator, appname string, reqs map[uint64]Resources) error {
+	// by decimal task ID, as JSON objects only have string keys
+	byID := make(map[string]Resources, len(reqs))
+	for id, r := range reqs {
+		byID[strconv.FormatUint(id, 10)] = r
+	}
+	b, err := json.Marshal(byID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Create(RequirementsPath(appname), string(b), 0)
+	return err
+}
+
+// GetRequirements returns the resources tasks require, by task ID, none if
+// the job has no requirements.
+func GetRequirements(client Coordinator, appname string) (map[uint64]Resources, error) {
+	resp, err := client.Get(RequirementsPath(appname), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var byID map[string]Resources
+	if err := json.Unmarshal([]byte(resp.Node.Value), &byID); err != nil {
+		return nil, fmt.Errorf("etcdutil: bad task requirements: %v", err)
+	}
+	reqs := make(map[uint64]Resources, len(byID))
+	for s, r := range byID {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("etcdutil: bad task ID %q of requirements", s)
+		}
+		reqs[id] = r
+	}
+	return reqs, nil
+}
+
+// AdvertiseCapabilities tells the job what resources the node of given
+// address has while it looks for a task, until WithdrawCapabilities.
+func AdvertiseCapabilities(client Coordinator, appname, addr string, caps Resources) error {
+	b, err := json.Marshal(caps)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(CapabilityPath(appname, addr), string(b), 0)
+	return err
+}
+
+func WithdrawCapabilities(client Coordinator, appname, addr string) error {
+	_, err := client.Delete(CapabilityPath(appname, addr), false)
+	return err
+}
+
+// GetCapabilities returns the resources of the nodes looking for a task, by
+// address.
+func GetCapabilities(client Coordinator, appname string) (map[string]Resources, error) {
+	resp, err := client.Get(CapabilityDir(appname), false, true)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	caps := make(map[string]Resources)
+	for _, n := range resp.Node.Nodes {
+		addr, err := url.QueryUnescape(path.Base(n.Key))
+		if err != nil {
+			continue
+		}
+		var r Resources
+		if json.Unmarshal([]byte(n.Value), &r) == nil {
+			caps[addr] = r
+		}
+	}
+	return caps, nil
+}
@@ -0,0 +1,77 @@
+package etcdutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseResources(t *testing.T) {
+	r, err := ParseResources("gpu=2,memory=16Gi")
+	if err != nil {
+		t.Fatalf("ParseResources failed: %v", err)
+	}
+	if want := (Resources{"gpu": 2, "memory": 16 << 30}); !reflect.DeepEqual(r, want) {
+		t.Errorf("resources = %v, want %v", r, want)
+	}
+	if !r.Satisfies(Resources{"gpu": 1}) || !r.Satisfies(nil) {
+		t.Errorf("%v should satisfy gpu=1 and no requirement", r)
+	}
+	if r.Satisfies(Resources{"gpu": 4}) || r.Satisfies(Resources{"tpu": 1}) {
+		t.Errorf("%v shouldn't satisfy gpu=4 or tpu=1", r)
+	}
+	for _, s := range []string{"gpu", "=1", "gpu=x", "memory=1Xi"} {
+		if _, err := ParseResources(s); err == nil {
+			t.Errorf("ParseResources(%q) should fail", s)
+		}
+	}
+}
+
+func TestWaitFreeTaskFor(t *testing.T) {
+	defer func(d time.Duration) { waitFreeTaskTimeout = d }(waitFreeTaskTimeout)
+	waitFreeTaskTimeout = 10 * time.Millisecond
+
+	name := "TestWaitFreeTaskFor"
+	client := NewMemoryCoordinator()
+	reqs := map[uint64]Resources{0: {"gpu": 1}}
+	if err := CreateRequirements(client, name, reqs); err != nil {
+		t.Fatalf("CreateRequirements failed: %v", err)
+	}
+	if get, err := GetRequirements(client, name); err != nil || !reflect.DeepEqual(get, reqs) {
+		t.Fatalf("GetRequirements = (%v, %v), want %v", get, err, reqs)
+	}
+	if _, err := client.Create(FreeTaskPath(name, "0"), "", 0); err != nil {
+		t.Fatal(err)
+	}
+	logger := testLogger()
+	// A node without GPU doesn't take the task, not even once it fails.
+	if _, err := WaitFreeTask(client, name, logger); err != ErrWaitFreeTaskTimeout {
+		t.Fatalf("WaitFreeTask error = %v, want %v", err, ErrWaitFreeTaskTimeout)
+	}
+	waitFreeTaskTimeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ReportFailure(client, name, "0")
+		ReportFailure(client, name, "1")
+	}()
+	if id, err := WaitFailedTaskFor(client, name, logger, Resources{"memory": 1 << 30}); err != nil || id != 1 {
+		t.Fatalf("WaitFailedTaskFor = (%d, %v), want task 1", id, err)
+	}
+	// Task 1 is claimed.
+	client.Delete(FreeTaskPath(name, "1"), false)
+	if id, err := WaitFreeTaskFor(client, name, logger, Resources{"gpu": 1}); err != nil || id != 0 {
+		t.Fatalf("WaitFreeTaskFor = (%d, %v), want task 0", id, err)
+	}
+
+	if err := AdvertiseCapabilities(client, name, "10.0.0.1:7000", Resources{"gpu": 1}); err != nil {
+		t.Fatalf("AdvertiseCapabilities failed: %v", err)
+	}
+	caps, err := GetCapabilities(client, name)
+	if want := map[string]Resources{"10.0.0.1:7000": {"gpu": 1}}; err != nil || !reflect.DeepEqual(caps, want) {
+		t.Errorf("GetCapabilities = (%v, %v), want %v", caps, err, want)
+	}
+	WithdrawCapabilities(client, name, "10.0.0.1:7000")
+	if caps, err := GetCapabilities(client, name); err != nil || len(caps) != 0 {
+		t.Errorf("GetCapabilities after withdrawal = (%v, %v), want none", caps, err)
+	}
+}
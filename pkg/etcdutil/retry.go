@@ -0,0 +1,83 @@
+package etcdutil
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// etcd error codes of the cluster being unavailable for a moment, e.g. during
+// leader election.
+const (
+	errCodeRaftInternal   = 300
+	errCodeLeaderElection = 301
+)
+
+var ErrRetryTimeout = errors.New("etcdutil: retry timed out")
+
+// RetryPolicy retries etcd operations failing with transient errors, with
+// exponential backoff and jitter. Other errors, e.g. key not found or compare
+// failed, are returned at once. The zero value doesn't retry.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one.
+	MaxAttempts int
+	// Backoff before the second attempt. It doubles every attempt, up to
+	// MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Limit of the time spent on all attempts; no limit if zero.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy rides out an etcd leader election, which usually takes a
+// few seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 8,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	Timeout:     30 * time.Second,
+}
+
+// Do calls op until it succeeds, fails with an error which isn't transient, or
+// the policy gives up. It returns the last error of op, or ErrRetryTimeout if
+// the next backoff would exceed the timeout.
+func (p RetryPolicy) Do(op func() error) error {
+	var deadline time.Time
+	if p.Timeout > 0 {
+		deadline = time.Now().Add(p.Timeout)
+	}
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !IsTransient(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+		// Sleep a random time in [backoff/2, backoff) so that tasks retrying
+		// together don't hit etcd at the same time.
+		d := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if !deadline.IsZero() && time.Now().Add(d).After(deadline) {
+			return ErrRetryTimeout
+		}
+		time.Sleep(d)
+		if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// IsTransient tells whether err might go away by retrying, i.e. etcd isn't
+// reachable or has no leader.
+func IsTransient(err error) bool {
+	etcdErr, ok := err.(*etcd.EtcdError)
+	if !ok {
+		// e.g. network errors
+		return true
+	}
+	switch etcdErr.ErrorCode {
+	case etcd.ErrCodeEtcdNotReachable, errCodeRaftInternal, errCodeLeaderElection:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package etcdutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	unreachable := &etcd.EtcdError{ErrorCode: etcd.ErrCodeEtcdNotReachable}
+	notFound := &etcd.EtcdError{ErrorCode: 100, Message: "Key not found"}
+
+	tests := []struct {
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{[]error{nil}, 1, nil},
+		{[]error{unreachable, nil}, 2, nil},
+		{[]error{notFound}, 1, notFound},
+		{[]error{unreachable, unreachable, unreachable}, 3, unreachable},
+		{[]error{errors.New("connection refused"), notFound}, 2, notFound},
+	}
+	for i, tt := range tests {
+		attempts := 0
+		err := p.Do(func() error {
+			err := tt.errs[attempts]
+			attempts++
+			return err
+		})
+		if err != tt.err || attempts != tt.attempts {
+			t.Errorf("#%d: Do = %v after %d attempts, want %v after %d", i, err, attempts, tt.err, tt.attempts)
+		}
+	}
+
+	var none RetryPolicy
+	attempts := 0
+	none.Do(func() error { attempts++; return unreachable })
+	if attempts != 1 {
+		t.Errorf("zero policy made %d attempts, want 1", attempts)
+	}
+
+	p = RetryPolicy{MaxAttempts: 10, Backoff: 20 * time.Millisecond, Timeout: 30 * time.Millisecond}
+	if err := p.Do(func() error { return unreachable }); err != ErrRetryTimeout {
+		t.Errorf("Do = %v, want ErrRetryTimeout", err)
+	}
+}
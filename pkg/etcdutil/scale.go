@@ -0,0 +1,98 @@
+package etcdutil
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrScalePending = errors.New("etcdutil: last change of number of tasks hasn't taken effect")
+
+// The number of tasks is stored as "{prev},{n}": n is the latest number and
+// prev is the one before the last change. A change takes effect at the first
+// epoch started after it, i.e. the first epoch whose etcd index is larger than
+// the one of the change; earlier epochs keep using prev. Since a change can't
+// be made before the previous one takes effect, all tasks agree on the number
+// of tasks of every epoch, no matter when they see the change.
+type TaskCount struct {
+	Prev, N uint64
+	// etcd index of the last change
+	Index uint64
+}
+
+// At returns the number of tasks of the epoch started at given etcd index.
+func (nt *TaskCount) At(epochIndex uint64) uint64 {
+	if nt.Index < epochIndex {
+		return nt.N
+	}
+	return nt.Prev
+}
+
+// Pending tells whether the last change hasn't taken effect at the epoch
+// started at given etcd index.
+func (nt *TaskCount) Pending(epochIndex uint64) bool {
+	return nt.Prev != nt.N && nt.Index >= epochIndex
+}
+
+func formatNumTasks(prev, n uint64) string {
+	return strconv.FormatUint(prev, 10) + "," + strconv.FormatUint(n, 10)
+}
+
+// ParseNumTasks parses the value of the numTasks key.
+func ParseNumTasks(value string) (prev, n uint64, err error) {
+	values := strings.Split(value, ",")
+	if len(values) != 2 {
+		return 0, 0, fmt.Errorf("etcdutil: bad number of tasks %q", value)
+	}
+	if prev, err = strconv.ParseUint(values[0], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if n, err = strconv.ParseUint(values[1], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return prev, n, nil
+}
+
+func CreateNumOfTasks(client Coordinator, appname string, n uint64) error {
+	_, err := client.Create(NumTasksPath(appname), formatNumTasks(n, n), 0)
+	return err
+}
+
+func GetTaskCount(client Coordinator, appname string) (*TaskCount, error) {
+	resp, err := client.Get(NumTasksPath(appname), false, false)
+	if err != nil {
+		return nil, err
+	}
+	prev, n, err := ParseNumTasks(resp.Node.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskCount{Prev: prev, N: n, Index: resp.Node.ModifiedIndex}, nil
+}
+
+// GetNumOfTasks returns the latest number of tasks of the job, which might
+// not have taken effect yet.
+func GetNumOfTasks(client Coordinator, appname string) (uint64, error) {
+	nt, err := GetTaskCount(client, appname)
+	if err != nil {
+		return 0, err
+	}
+	return nt.N, nil
+}
+
+// CASNumOfTasks changes the number of tasks to n, if it is still nt. It fails
+// with ErrScalePending if the change of nt hasn't taken effect at current
+// epoch.
+func CASNumOfTasks(client Coordinator, appname string, nt *TaskCount, n uint64) error {
+	// Only the index of the epoch matters, not its value.
+	resp, err := client.Get(EpochPath(appname), false, false)
+	if err != nil {
+		return err
+	}
+	if nt.Pending(resp.Node.ModifiedIndex) {
+		return ErrScalePending
+	}
+	_, err = client.CompareAndSwap(NumTasksPath(appname), formatNumTasks(nt.N, n), 0, "", nt.Index)
+	return err
+}
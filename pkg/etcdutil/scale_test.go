@@ -0,0 +1,41 @@
+package etcdutil
+
+import "testing"
+
+func TestTaskCount(t *testing.T) {
+	// scaled from 4 to 6 at etcd index 10
+	nt := &TaskCount{Prev: 4, N: 6, Index: 10}
+	tests := []struct {
+		epochIndex uint64
+		n          uint64
+		pending    bool
+	}{
+		{5, 4, true},
+		{10, 4, true},
+		{11, 6, false},
+	}
+	for i, tt := range tests {
+		if n := nt.At(tt.epochIndex); n != tt.n {
+			t.Errorf("#%d: At(%d) = %d, want %d", i, tt.epochIndex, n, tt.n)
+		}
+		if p := nt.Pending(tt.epochIndex); p != tt.pending {
+			t.Errorf("#%d: Pending(%d) = %v, want %v", i, tt.epochIndex, p, tt.pending)
+		}
+	}
+	// never scaled
+	if nt := (&TaskCount{Prev: 4, N: 4, Index: 10}); nt.Pending(5) {
+		t.Errorf("unchanged count should not be pending")
+	}
+}
+
+func TestParseNumTasks(t *testing.T) {
+	prev, n, err := ParseNumTasks(formatNumTasks(4, 6))
+	if err != nil || prev != 4 || n != 6 {
+		t.Errorf("ParseNumTasks = (%d, %d, %v), want (4, 6, nil)", prev, n, err)
+	}
+	for _, v := range []string{"", "4", "4,", "a,6", "4,6,8"} {
+		if _, _, err := ParseNumTasks(v); err == nil {
+			t.Errorf("ParseNumTasks(%q) should fail", v)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package etcdutil
+
+import (
+	"strconv"
+)
+
+func CreateSeed(client Coordinator, appname string, seed int64) error {
+	_, err := client.Create(SeedPath(appname), strconv.FormatInt(seed, 10), 0)
+	return err
+}
+
+func GetSeed(client Coordinator, appname string) (int64, error) {
+	resp, err := client.Get(SeedPath(appname), false, false)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(resp.Node.Value, 10, 64)
+}
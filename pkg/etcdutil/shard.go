@@ -0,0 +1,128 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// ShardAssignment assigns shards of the data of a job, e.g. files or key
+// ranges, to its tasks for an epoch.
+type ShardAssignment struct {
+	Epoch uint64
+	// shards by task ID
+	Shards map[uint64][]string
+}
+
+// shardAssignment is the JSON of a ShardAssignment, whose task IDs are keys.
+type shardAssignment struct {
+	Epoch  uint64              `json:"epoch"`
+	Shards map[string][]string `json:"shards"`
+}
+
+// SetShardAssignment publishes the assignment, replacing the one of an
+// earlier epoch. Tasks watching it get the new one.
+func SetShardAssignment(client Coordinator, appname string, a *ShardAssignment) error {
+	enc := shardAssignment{Epoch: a.Epoch, Shards: make(map[string][]string, len(a.Shards))}
+	for id, shards := range a.Shards {
+		enc.Shards[strconv.FormatUint(id, 10)] = shards
+	}
+	b, err := json.Marshal(enc)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(ShardsPath(appname), string(b), 0)
+	return err
+}
+
+// GetShardAssignment returns the last assignment published, nil if none has
+// been.
+func GetShardAssignment(client Coordinator, appname string) (*ShardAssignment, error) {
+	resp, err := client.Get(ShardsPath(appname), false, false)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeShardAssignment(resp.Node.Value)
+}
+
+func decodeShardAssignment(value string) (*ShardAssignment, error) {
+	var enc shardAssignment
+	if err := json.Unmarshal([]byte(value), &enc); err != nil {
+		return nil, fmt.Errorf("bad shard assignment %q: %v", value, err)
+	}
+	a := &ShardAssignment{Epoch: enc.Epoch, Shards: make(map[uint64][]string, len(enc.Shards))}
+	for idStr, shards := range enc.Shards {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad shard assignment %q: task %q", value, idStr)
+		}
+		a.Shards[id] = shards
+	}
+	return a, nil
+}
+
+// WatchShardAssignment returns the last assignment published, if any, and
+// calls onChange with every assignment published from now on, in order,
+// until stop. Assignments which can't be decoded are skipped.
+func WatchShardAssignment(client Coordinator, appname string, stop chan bool, onChange func(a *ShardAssignment)) (*ShardAssignment, error) {
+	// The job might have no assignment yet, but it has a layout.
+	resp, err := client.Get(JobPath(appname), false, false)
+	if err != nil {
+		return nil, err
+	}
+	a, err := GetShardAssignment(client, appname)
+	if err != nil {
+		return nil, err
+	}
+	receiver := make(chan *etcd.Response, 1)
+	go client.Watch(ShardsPath(appname), resp.EtcdIndex+1, false, receiver, stop)
+	go func() {
+		for resp := range receiver {
+			if resp.Action == "delete" || resp.Action == "expire" || resp.Action == "compareAndDelete" {
+				continue
+			}
+			if a, err := decodeShardAssignment(resp.Node.Value); err == nil {
+				onChange(a)
+			}
+		}
+	}()
+	return a, nil
+}
+
+// Reassign hands the shards of the failed task over to the other tasks of
+// the assignment, one at a time to the task holding the fewest, the lowest
+// ID first on ties. It returns false if the failed task holds no shards, or
+// there is no other task to take them.
+func (a *ShardAssignment) Reassign(failed uint64) bool {
+	shards := a.Shards[failed]
+	if len(shards) == 0 {
+		return false
+	}
+	var ids []uint64
+	for id := range a.Shards {
+		if id != failed {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return false
+	}
+	sort.Sort(uint64s(ids))
+	for _, shard := range shards {
+		to := ids[0]
+		for _, id := range ids[1:] {
+			if len(a.Shards[id]) < len(a.Shards[to]) {
+				to = id
+			}
+		}
+		a.Shards[to] = append(a.Shards[to], shard)
+	}
+	delete(a.Shards, failed)
+	return true
+}
@@ -0,0 +1,50 @@
+package etcdutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShardAssignment(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if _, err := client.Create(EpochPath("job"), "0", 0); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := GetShardAssignment(client, "job"); a != nil || err != nil {
+		t.Errorf("GetShardAssignment without assignment = (%v, %v), want (nil, nil)", a, err)
+	}
+	changes := make(chan *ShardAssignment, 1)
+	stop := make(chan bool, 1)
+	defer func() { stop <- true }()
+	if _, err := WatchShardAssignment(client, "job", stop, func(a *ShardAssignment) { changes <- a }); err != nil {
+		t.Fatal(err)
+	}
+	want := &ShardAssignment{Epoch: 3, Shards: map[uint64][]string{1: {"a", "b"}, 2: {"c"}}}
+	if err := SetShardAssignment(client, "job", want); err != nil {
+		t.Fatal(err)
+	}
+	if a := <-changes; !reflect.DeepEqual(a, want) {
+		t.Errorf("assignment watched = %+v, want %+v", a, want)
+	}
+	if a, err := GetShardAssignment(client, "job"); err != nil || !reflect.DeepEqual(a, want) {
+		t.Errorf("GetShardAssignment = (%+v, %v), want %+v", a, err, want)
+	}
+}
+
+func TestShardAssignmentReassign(t *testing.T) {
+	a := &ShardAssignment{Shards: map[uint64][]string{1: {"a", "b", "c"}, 2: {"d"}, 3: {"e", "f"}}}
+	if !a.Reassign(1) {
+		t.Fatalf("Reassign(1) = false, want true")
+	}
+	want := map[uint64][]string{2: {"d", "a", "b"}, 3: {"e", "f", "c"}}
+	if !reflect.DeepEqual(a.Shards, want) {
+		t.Errorf("shards = %v, want %v", a.Shards, want)
+	}
+	if a.Reassign(1) {
+		t.Errorf("Reassign of a task without shards = true, want false")
+	}
+	a = &ShardAssignment{Shards: map[uint64][]string{1: {"a"}}}
+	if a.Reassign(1) {
+		t.Errorf("Reassign without other tasks = true, want false")
+	}
+}
@@ -0,0 +1,78 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JobSpec names the application of a job among the task builders and
+// topologies registered by worker binaries (see meritop.RegisterTaskBuilder),
+// so that nodes of a generic worker find out what to run from etcd.
+type JobSpec struct {
+	Task     string            `json:"task"`
+	Topology string            `json:"topology"`
+	Params   map[string]string `json:"params,omitempty"`
+	// Plugins are loaded by the workers before they look up Task and
+	// Topology, see package taskplugin.
+	Plugins []PluginSpec `json:"plugins,omitempty"`
+	// Phases split the epochs of the job into stages run in order, e.g.
+	// setup, train, evaluate and export. The controller shuts the job down
+	// once the last one is over.
+	Phases []PhaseSpec `json:"phases,omitempty"`
+	// DependsOn are jobs which must finish before the job is set up. Inputs
+	// map params to artifacts exported by them, as "{job}/{artifact}"; the
+	// controller sets the params to the artifacts once they finish.
+	DependsOn []string          `json:"dependsOn,omitempty"`
+	Inputs    map[string]string `json:"inputs,omitempty"`
+}
+
+// PhaseSpec is a stage of a job running Epochs epochs on its own registered
+// topology, or on the topology of the job if Topology is empty.
+type PhaseSpec struct {
+	Name     string `json:"name"`
+	Topology string `json:"topology,omitempty"`
+	Epochs   uint64 `json:"epochs"`
+}
+
+// PhaseAt returns the index of the phase running given epoch. Phases take
+// turns from epoch 0. ok is false once all phases are over.
+func PhaseAt(phases []PhaseSpec, epoch uint64) (i int, ok bool) {
+	for i, p := range phases {
+		if epoch < p.Epochs {
+			return i, true
+		}
+		epoch -= p.Epochs
+	}
+	return len(phases), false
+}
+
+// PluginSpec is a Go plugin registering task builders or topologies. SHA256 is
+// the hex encoded hash of the file, and Version, if set, must match the
+// MeritopPluginVersion string that the plugin exports before its Register
+// function is called.
+type PluginSpec struct {
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256"`
+	Version string `json:"version,omitempty"`
+}
+
+func CreateJobSpec(client Coordinator, appname string, spec JobSpec) error {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	_, err = client.Create(JobSpecPath(appname), string(b), 0)
+	return err
+}
+
+func GetJobSpec(client Coordinator, appname string) (JobSpec, error) {
+	var spec JobSpec
+	resp, err := client.Get(JobSpecPath(appname), false, false)
+	if err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal([]byte(resp.Node.Value), &spec); err != nil {
+		return spec, fmt.Errorf("bad job spec %q: %v", resp.Node.Value, err)
+	}
+	return spec, nil
+}
@@ -0,0 +1,45 @@
+package etcdutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJobSpec(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if _, err := GetJobSpec(client, "job"); !IsKeyNotFound(err) {
+		t.Fatalf("GetJobSpec of job without spec: err = %v, want key not found", err)
+	}
+	spec := JobSpec{Task: "ps", Topology: "ps", Params: map[string]string{"servers": "2"}}
+	if err := CreateJobSpec(client, "job", spec); err != nil {
+		t.Fatalf("CreateJobSpec failed: %v", err)
+	}
+	got, err := GetJobSpec(client, "job")
+	if err != nil || !reflect.DeepEqual(got, spec) {
+		t.Errorf("GetJobSpec = (%+v, %v), want (%+v, nil)", got, err, spec)
+	}
+	if err := CreateJobSpec(client, "job", spec); !IsNodeExist(err) {
+		t.Errorf("CreateJobSpec twice: err = %v, want node exist", err)
+	}
+}
+
+func TestPhaseAt(t *testing.T) {
+	phases := []PhaseSpec{{Name: "setup", Epochs: 1}, {Name: "train", Epochs: 3}, {Name: "export", Epochs: 1}}
+	tests := []struct {
+		epoch uint64
+		i     int
+		ok    bool
+	}{
+		{0, 0, true},
+		{1, 1, true},
+		{3, 1, true},
+		{4, 2, true},
+		{5, 3, false},
+		{ExitEpoch, 3, false},
+	}
+	for _, tt := range tests {
+		if i, ok := PhaseAt(phases, tt.epoch); i != tt.i || ok != tt.ok {
+			t.Errorf("PhaseAt(%d) = (%d, %v), want (%d, %v)", tt.epoch, i, ok, tt.i, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package etcdutil
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNoBackupRequest is returned by TakeBackupRequest if no straggler waits
+// for a backup copy.
+var ErrNoBackupRequest = errors.New("etcdutil: no backup request")
+
+// RequestBackup asks the backup nodes of the job to run a copy of given task
+// in given epoch, if no one has asked yet.
+func RequestBackup(client Coordinator, name string, taskID, epoch uint64) error {
+	_, err := client.Create(BackupPath(name, taskID, epoch), "", 0)
+	if err != nil && IsNodeExist(err) {
+		return nil
+	}
+	return err
+}
+
+// TakeBackupRequest takes a backup request no backup node has taken yet for
+// the node of given address. Requests of epochs which are over are left to
+// CommitOutput to clean up, and the node taking them should give them up.
+func TakeBackupRequest(client Coordinator, name, addr string) (taskID, epoch uint64, err error) {
+	resp, err := client.Get(BackupDir(name), true, true)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return 0, 0, ErrNoBackupRequest
+		}
+		return 0, 0, err
+	}
+	for _, n := range resp.Node.Nodes {
+		if n.Value != "" {
+			continue
+		}
+		id, e, ok := parseTaskEpoch(path.Base(n.Key))
+		if !ok {
+			continue
+		}
+		_, err := client.CompareAndSwap(n.Key, addr, 0, "", n.ModifiedIndex)
+		if err == nil {
+			return id, e, nil
+		}
+		if !IsCompareFailed(err) && !IsKeyNotFound(err) {
+			return 0, 0, err
+		}
+		// Another backup node took it.
+	}
+	return 0, 0, ErrNoBackupRequest
+}
+
+// CommitOutput commits the output of given task in given epoch to the copy
+// at addr, unless another copy did first. It returns the address of the copy
+// whose output the epoch takes. The records of the epoch before are removed.
+func CommitOutput(client Coordinator, name string, taskID, epoch uint64, addr string) (string, error) {
+	_, err := client.Create(CommitPath(name, taskID, epoch), addr, 0)
+	if err == nil {
+		if epoch > 0 {
+			client.Delete(CommitPath(name, taskID, epoch-1), false)
+			client.Delete(BackupPath(name, taskID, epoch-1), false)
+		}
+		return addr, nil
+	}
+	if !IsNodeExist(err) {
+		return "", err
+	}
+	return GetCommit(client, name, taskID, epoch)
+}
+
+// GetCommit returns the address of the copy of given task whose output given
+// epoch takes. It returns a key-not-found error if no copy has committed.
+func GetCommit(client Coordinator, name string, taskID, epoch uint64) (string, error) {
+	resp, err := client.Get(CommitPath(name, taskID, epoch), false, false)
+	if err != nil {
+		return "", err
+	}
+	return resp.Node.Value, nil
+}
+
+// parseTaskEpoch parses the "{taskID}-{epoch}" names of backup requests.
+func parseTaskEpoch(s string) (taskID, epoch uint64, ok bool) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	taskID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if epoch, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return 0, 0, false
+	}
+	return taskID, epoch, true
+}
@@ -0,0 +1,48 @@
+package etcdutil
+
+import "testing"
+
+func TestSpeculation(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if _, _, err := TakeBackupRequest(client, "job", "b:1"); err != ErrNoBackupRequest {
+		t.Fatalf("TakeBackupRequest without request = %v, want %v", err, ErrNoBackupRequest)
+	}
+	// Neighbors of a straggler all ask for its backup.
+	for i := 0; i < 2; i++ {
+		if err := RequestBackup(client, "job", 3, 5); err != nil {
+			t.Fatalf("RequestBackup failed: %v", err)
+		}
+	}
+	id, epoch, err := TakeBackupRequest(client, "job", "b:1")
+	if err != nil || id != 3 || epoch != 5 {
+		t.Fatalf("TakeBackupRequest = (%d, %d, %v), want (3, 5, nil)", id, epoch, err)
+	}
+	if _, _, err := TakeBackupRequest(client, "job", "b:2"); err != ErrNoBackupRequest {
+		t.Fatalf("TakeBackupRequest of a taken request = %v, want %v", err, ErrNoBackupRequest)
+	}
+
+	if _, err := GetCommit(client, "job", 3, 5); !IsKeyNotFound(err) {
+		t.Fatalf("GetCommit before commit = %v, want key not found", err)
+	}
+	// The backup copy commits first, the straggler learns it lost.
+	if winner, err := CommitOutput(client, "job", 3, 5, "b:1"); winner != "b:1" || err != nil {
+		t.Fatalf("CommitOutput of backup = (%q, %v), want b:1", winner, err)
+	}
+	if winner, err := CommitOutput(client, "job", 3, 5, "a:1"); winner != "b:1" || err != nil {
+		t.Fatalf("CommitOutput of straggler = (%q, %v), want b:1", winner, err)
+	}
+	if winner, err := GetCommit(client, "job", 3, 5); winner != "b:1" || err != nil {
+		t.Fatalf("GetCommit = (%q, %v), want b:1", winner, err)
+	}
+
+	// The commit of the next epoch cleans up.
+	if _, err := CommitOutput(client, "job", 3, 6, "a:1"); err != nil {
+		t.Fatalf("CommitOutput of next epoch failed: %v", err)
+	}
+	if _, err := GetCommit(client, "job", 3, 5); !IsKeyNotFound(err) {
+		t.Errorf("commit of epoch 5 after commit of epoch 6 = %v, want key not found", err)
+	}
+	if _, err := client.Get(BackupPath("job", 3, 5), false, false); !IsKeyNotFound(err) {
+		t.Errorf("backup request of epoch 5 after commit of epoch 6 = %v, want key not found", err)
+	}
+}
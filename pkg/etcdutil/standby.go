@@ -0,0 +1,67 @@
+package etcdutil
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// RegisterStandby adds the node of given address to the standby pool of the
+// job until stop, heartbeating at given interval so that the node leaves the
+// pool if it dies. The pool only tells who is standing by; standby nodes take
+// over failed tasks with WaitFailedTask. The node leaves the pool ttl after
+// its last refresh, or three intervals if ttl is 0.
+func RegisterStandby(client Coordinator, name, addr string, interval, ttl time.Duration, stop chan struct{}) error {
+	key := StandbyPath(name, addr)
+	secs := computeTTL(interval, ttl)
+	if _, err := client.Set(key, addr, secs); err != nil {
+		return err
+	}
+	defer client.Delete(key, false)
+	for {
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return nil
+		}
+		// A refresh doesn't count as a change of the pool, see
+		// controller.Subscribe.
+		_, err := client.CompareAndSwap(key, addr, secs, addr, 0)
+		if err != nil && IsKeyNotFound(err) {
+			_, err = client.Set(key, addr, secs)
+		}
+		if err != nil && !IsTransient(err) {
+			return err
+		}
+	}
+}
+
+// GetStandbys returns the addresses of the standby nodes of the job, sorted.
+func GetStandbys(client Coordinator, name string) ([]string, error) {
+	resp, err := client.Get(StandbyPoolDir(name), false, true)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return ParseStandbys(resp.Node.Nodes), nil
+}
+
+// ParseStandbys returns the addresses of the standby nodes of the job, sorted,
+// from the nodes of the standby directory.
+func ParseStandbys(nodes etcd.Nodes) []string {
+	var addrs []string
+	for _, n := range nodes {
+		addr, err := url.QueryUnescape(path.Base(n.Key))
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
@@ -0,0 +1,77 @@
+package etcdutil
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStandbyPool(t *testing.T) {
+	name := "TestStandbyPool"
+	client := NewMemoryCoordinator()
+	if addrs, err := GetStandbys(client, name); err != nil || addrs != nil {
+		t.Fatalf("GetStandbys of empty pool = (%v, %v), want (nil, nil)", addrs, err)
+	}
+	stops := make([]chan struct{}, 2)
+	dones := make([]chan error, 2)
+	for i, addr := range []string{"b:1", "a:1"} {
+		stops[i], dones[i] = make(chan struct{}), make(chan error, 1)
+		go func(addr string, stop chan struct{}, done chan error) {
+			done <- RegisterStandby(client, name, addr, 10*time.Millisecond, 0, stop)
+		}(addr, stops[i], dones[i])
+	}
+	waitStandbys := func(want []string) {
+		for i := 0; ; i++ {
+			addrs, err := GetStandbys(client, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(addrs, want) {
+				return
+			}
+			if i == 100 {
+				t.Fatalf("standbys = %v, want %v", addrs, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitStandbys([]string{"a:1", "b:1"})
+	close(stops[0])
+	if err := <-dones[0]; err != nil {
+		t.Errorf("RegisterStandby returns %v", err)
+	}
+	waitStandbys([]string{"a:1"})
+	close(stops[1])
+	<-dones[1]
+}
+
+func TestWaitFailedTask(t *testing.T) {
+	name := "TestWaitFailedTask"
+	client := NewMemoryCoordinator()
+	logger := testLogger()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Create(FreeTaskPath(name, strconv.Itoa(i)), "", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan uint64, 1)
+	go func() {
+		id, err := WaitFailedTask(client, name, logger)
+		if err != nil {
+			t.Errorf("WaitFailedTask failed: %v", err)
+		}
+		done <- id
+	}()
+	select {
+	case id := <-done:
+		t.Fatalf("WaitFailedTask returns unassigned task %d", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := ReportFailure(client, name, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if id := <-done; id != 1 {
+		t.Errorf("WaitFailedTask = %d, want 1", id)
+	}
+}
@@ -1,34 +1,113 @@
 package etcdutil
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"strconv"
-
-	"github.com/coreos/go-etcd/etcd"
+	"strings"
+	"time"
 )
 
-func TryOccupyTask(client *etcd.Client, name string, taskID uint64, connection string) bool {
-	_, err := client.Create(TaskHealthyPath(name, taskID), "health", 3)
+var ErrClaimLost = errors.New("etcdutil: task is claimed by another node")
+
+// Claim is the ownership of a task by a node. It lives in a single key, the
+// healthy key of the task, so it is taken and lost atomically:
+//   - the key exists as long as the owner heartbeats;
+//   - its value holds the address of the owner and the last heartbeat time;
+//   - its etcd CreatedIndex is the generation, which increases every time a
+//     new node takes over the task.
+type Claim struct {
+	TaskID     uint64
+	Address    string
+	Generation uint64
+	// ModifiedIndex of the key as last written by the owner. Writing with it
+	// fails once the key expired, even if another node has claimed it since.
+	index uint64
+}
+
+// ClaimTask tries to take over a task. It fails if another node owns the task.
+func ClaimTask(client Coordinator, name string, taskID uint64, addr string) (*Claim, error) {
+	return ClaimTaskTTL(client, name, taskID, addr, DefaultTTLs.AddressSeconds())
+}
+
+// ClaimTaskTTL is ClaimTask whose claim lasts ttl seconds until the first
+// heartbeat, see TTLs.Address.
+func ClaimTaskTTL(client Coordinator, name string, taskID uint64, addr string, ttl uint64) (*Claim, error) {
+	resp, err := client.Create(TaskHealthyPath(name, taskID), healthyValue(time.Now(), addr), ttl)
 	if err != nil {
-		return false
+		return nil, err
 	}
-	idStr := strconv.FormatUint(taskID, 10)
-	client.Delete(FreeTaskPath(name, idStr), false)
-	_, err = client.Set(TaskMasterPath(name, taskID), connection, 0)
+	// The free task is only a hint for standby nodes. If we die before
+	// removing it, they fail to claim it until our claim expires.
+	client.Delete(FreeTaskPath(name, strconv.FormatUint(taskID, 10)), false)
+	// A drained task is taken over.
+	client.Delete(DrainPath(name, taskID), false)
+	return &Claim{
+		TaskID:     taskID,
+		Address:    addr,
+		Generation: resp.Node.CreatedIndex,
+		index:      resp.Node.ModifiedIndex,
+	}, nil
+}
+
+// renew updates the heartbeat time of the claim. It returns ErrClaimLost if
+// the claim expired in the meantime.
+func (c *Claim) renew(client Coordinator, name string, ttl uint64) error {
+	resp, err := client.CompareAndSwap(TaskHealthyPath(name, c.TaskID),
+		healthyValue(time.Now(), c.Address), ttl, "", c.index)
 	if err != nil {
-		log.Fatal(err)
+		if IsKeyNotFound(err) || IsCompareFailed(err) {
+			return ErrClaimLost
+		}
+		return err
 	}
-	return true
+	c.index = resp.Node.ModifiedIndex
+	return nil
+}
+
+// ReleaseClaim gives up the task at once, so that it is failed over as if the
+// claim had expired. It won't touch the claim of another node.
+func ReleaseClaim(client Coordinator, name string, c *Claim) error {
+	_, err := client.CompareAndDelete(TaskHealthyPath(name, c.TaskID), "", c.index)
+	if err != nil && (IsKeyNotFound(err) || IsCompareFailed(err)) {
+		return ErrClaimLost
+	}
+	return err
 }
 
 // getAddress will return the host:port address of the service taking care of
 // the task that we want to talk to.
 // Currently we grab the information from etcd every time. Local cache could be used.
-// If it failed, e.g. network failure, it should return error.
-func GetAddress(client *etcd.Client, name string, id uint64) (string, error) {
-	resp, err := client.Get(TaskMasterPath(name, id), false, false)
+// If it failed, e.g. network failure or the task is being failed over, it
+// should return error.
+func GetAddress(client Coordinator, name string, id uint64) (string, error) {
+	resp, err := client.Get(TaskHealthyPath(name, id), false, false)
 	if err != nil {
 		return "", err
 	}
-	return resp.Node.Value, nil
+	_, addr, ok := ParseHealthy(resp.Node.Value)
+	if !ok {
+		return "", fmt.Errorf("etcdutil: bad claim of task %d: %q", id, resp.Node.Value)
+	}
+	return addr, nil
+}
+
+// The healthy key of a task holds the time of its last heartbeat, in unix
+// nanoseconds, and the address of its owner: "{time},{address}".
+func healthyValue(t time.Time, addr string) string {
+	return strconv.FormatInt(t.UnixNano(), 10) + "," + addr
+}
+
+// ParseHealthy returns the time of last heartbeat and the address of the
+// owner stored in a healthy key.
+func ParseHealthy(value string) (heartbeat time.Time, addr string, ok bool) {
+	parts := strings.SplitN(value, ",", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", false
+	}
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, ns), parts[1], true
 }
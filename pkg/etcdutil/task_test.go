@@ -0,0 +1,186 @@
+package etcdutil
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+func TestParseHealthy(t *testing.T) {
+	now := time.Unix(1400000000, 5)
+	tests := []struct {
+		value string
+		addr  string
+		ok    bool
+	}{
+		{healthyValue(now, "host:1234"), "host:1234", true},
+		{healthyValue(now, ""), "", true},
+		{"1400000000000000005", "", false},
+		{"x,host:1234", "", false},
+	}
+	for i, tt := range tests {
+		heartbeat, addr, ok := ParseHealthy(tt.value)
+		if ok != tt.ok || addr != tt.addr || (ok && !heartbeat.Equal(now)) {
+			t.Errorf("#%d: ParseHealthy(%q) = (%v, %q, %v), want (%v, %q, %v)",
+				i, tt.value, heartbeat, addr, ok, now, tt.addr, tt.ok)
+		}
+	}
+}
+
+// A claim is taken by one node at a time, and a node whose claim expired can
+// neither renew nor release the claim of the node which took over.
+func TestClaimTaskInterleavings(t *testing.T) {
+	name := "TestClaimTaskInterleavings"
+	m := StartNewEtcdServer(t, name)
+	defer m.Terminate(t)
+	client := etcd.NewClient([]string{m.URL()})
+	if _, err := client.Create(FreeTaskPath(name, "0"), "failed", 0); err != nil {
+		t.Fatalf("Create free task failed: %v", err)
+	}
+
+	a, err := ClaimTask(client, name, 0, "a:1")
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	if _, err := client.Get(FreeTaskPath(name, "0"), false, false); !IsKeyNotFound(err) {
+		t.Errorf("free task after claim: err want = key not found, get = %v", err)
+	}
+	if _, err := ClaimTask(client, name, 0, "b:1"); err == nil {
+		t.Fatalf("ClaimTask of a claimed task should fail")
+	}
+	if err := a.renew(client, name, 1); err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+
+	// a stalls until its claim expires, and b takes over
+	time.Sleep(2500 * time.Millisecond)
+	b, err := ClaimTask(client, name, 0, "b:1")
+	if err != nil {
+		t.Fatalf("ClaimTask after expiry failed: %v", err)
+	}
+	if b.Generation <= a.Generation {
+		t.Errorf("generation want > %d, get = %d", a.Generation, b.Generation)
+	}
+	if err := a.renew(client, name, 3); err != ErrClaimLost {
+		t.Errorf("renew of expired claim: err want = %v, get = %v", ErrClaimLost, err)
+	}
+	if err := ReleaseClaim(client, name, a); err != ErrClaimLost {
+		t.Errorf("release of expired claim: err want = %v, get = %v", ErrClaimLost, err)
+	}
+	if addr, err := GetAddress(client, name, 0); err != nil || addr != "b:1" {
+		t.Errorf("GetAddress = (%q, %v), want (%q, nil)", addr, err, "b:1")
+	}
+
+	if err := ReleaseClaim(client, name, b); err != nil {
+		t.Fatalf("ReleaseClaim failed: %v", err)
+	}
+	if _, err := GetAddress(client, name, 0); err == nil {
+		t.Errorf("GetAddress of a released task should fail")
+	}
+}
+
+// A released claim is deleted rather than expired, and is reported as a
+// failure all the same, so that the task is failed over at once.
+func TestWatchFailureReleasedClaim(t *testing.T) {
+	name := "TestWatchFailureReleasedClaim"
+	m := StartNewEtcdServer(t, name)
+	defer m.Terminate(t)
+	client := etcd.NewClient([]string{m.URL()})
+	if _, err := client.Set(NumTasksPath(name), formatNumTasks(1, 1), 0); err != nil {
+		t.Fatalf("Set numTasks failed: %v", err)
+	}
+
+	failures := make(chan string, 1)
+	stop := make(chan bool)
+	defer close(stop)
+	go WatchFailure(client, name, stop, func(id string) { failures <- id })
+
+	c, err := ClaimTask(client, name, 0, "a:1")
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	// The watch only sees changes after it starts.
+	time.Sleep(100 * time.Millisecond)
+	if err := ReleaseClaim(client, name, c); err != nil {
+		t.Fatalf("ReleaseClaim failed: %v", err)
+	}
+	select {
+	case id := <-failures:
+		if id != "0" {
+			t.Errorf("failed task = %s, want 0", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("released claim of task 0 wasn't reported failed")
+	}
+}
+
+// A standby node waiting for a failure times out, and gets the next failure
+// when it waits again.
+func TestWaitFreeTask(t *testing.T) {
+	defer func(d time.Duration) { waitFreeTaskTimeout = d }(waitFreeTaskTimeout)
+	waitFreeTaskTimeout = 10 * time.Millisecond
+
+	name := "TestWaitFreeTask"
+	client := NewMemoryCoordinator()
+	// The tasks were all claimed.
+	ReportFailure(client, name, "0")
+	if _, err := client.Delete(FreeTaskPath(name, "0"), false); err != nil {
+		t.Fatalf("Delete free task failed: %v", err)
+	}
+	logger := testLogger()
+	if _, err := WaitFreeTask(client, name, logger); err != ErrWaitFreeTaskTimeout {
+		t.Fatalf("WaitFreeTask error = %v, want %v", err, ErrWaitFreeTaskTimeout)
+	}
+
+	waitFreeTaskTimeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ReportFailure(client, name, "3")
+	}()
+	id, err := WaitFreeTask(client, name, logger)
+	if err != nil {
+		t.Fatalf("WaitFreeTask failed: %v", err)
+	}
+	if id != 3 {
+		t.Errorf("free task = %d, want 3", id)
+	}
+}
+
+func TestHeartbeatTTL(t *testing.T) {
+	name := "TestHeartbeatTTL"
+	client := NewMemoryCoordinator()
+	c, err := ClaimTask(client, name, 0, "a:1")
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- Heartbeat(client, name, c, time.Hour, 4500*time.Millisecond, stop) }()
+	// The first heartbeat goes at once.
+	for i := 0; ; i++ {
+		resp, err := client.Get(TaskHealthyPath(name, 0), false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Node.TTL == 5 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("TTL = %d, want 5", resp.Node.TTL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("Heartbeat returns %v", err)
+	}
+}
+
+// testLogger logs nowhere.
+func testLogger() logging.Logger {
+	return logging.NewStd(log.New(ioutil.Discard, "", 0), logging.Info)
+}
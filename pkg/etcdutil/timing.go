@@ -0,0 +1,67 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"time"
+)
+
+// TimingWindow is how many of its last epochs a task keeps timed.
+const TimingWindow = 10
+
+// EpochTiming is how long a task took in an epoch: from its start until the
+// last output of the task in it.
+type EpochTiming struct {
+	Epoch    uint64        `json:"epoch"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RecordTiming adds the timing of an epoch to those of given task, keeping
+// the last TimingWindow of them.
+func RecordTiming(client Coordinator, name string, taskID uint64, t EpochTiming) error {
+	key := TaskTimingPath(name, taskID)
+	var timings []EpochTiming
+	resp, err := client.Get(key, false, false)
+	switch {
+	case err == nil:
+		// Timings which can't be read are started over.
+		json.Unmarshal([]byte(resp.Node.Value), &timings)
+	case !IsKeyNotFound(err):
+		return err
+	}
+	timings = append(timings, t)
+	if len(timings) > TimingWindow {
+		timings = timings[len(timings)-TimingWindow:]
+	}
+	value, err := json.Marshal(timings)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(key, string(value), 0)
+	return err
+}
+
+// GetTimings returns the timings of the last epochs of the tasks of the job,
+// by task ID.
+func GetTimings(client Coordinator, name string) (map[uint64][]EpochTiming, error) {
+	resp, err := client.Get(TimingDir(name), false, true)
+	if err != nil {
+		if IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	all := make(map[uint64][]EpochTiming)
+	for _, n := range resp.Node.Nodes {
+		id, err := strconv.ParseUint(path.Base(n.Key), 10, 64)
+		if err != nil {
+			continue
+		}
+		var timings []EpochTiming
+		if json.Unmarshal([]byte(n.Value), &timings) == nil {
+			all[id] = timings
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,35 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	client := NewMemoryCoordinator()
+	if timings, err := GetTimings(client, "job"); timings != nil || err != nil {
+		t.Fatalf("GetTimings without timings = (%v, %v), want none", timings, err)
+	}
+	for epoch := uint64(0); epoch < TimingWindow+2; epoch++ {
+		if err := RecordTiming(client, "job", 1, EpochTiming{Epoch: epoch, Duration: time.Second}); err != nil {
+			t.Fatalf("RecordTiming failed: %v", err)
+		}
+	}
+	if err := RecordTiming(client, "job", 4, EpochTiming{Epoch: 3, Duration: time.Minute}); err != nil {
+		t.Fatalf("RecordTiming failed: %v", err)
+	}
+	timings, err := GetTimings(client, "job")
+	if err != nil {
+		t.Fatalf("GetTimings failed: %v", err)
+	}
+	if len(timings) != 2 {
+		t.Fatalf("timings of %d tasks, want 2", len(timings))
+	}
+	// Only the last epochs are kept.
+	if ts := timings[1]; len(ts) != TimingWindow || ts[0].Epoch != 2 || ts[TimingWindow-1].Epoch != TimingWindow+1 {
+		t.Errorf("timings of task 1 = %v, want epochs 2 to %d", ts, TimingWindow+1)
+	}
+	if ts := timings[4]; len(ts) != 1 || ts[0] != (EpochTiming{Epoch: 3, Duration: time.Minute}) {
+		t.Errorf("timings of task 4 = %v, want one minute in epoch 3", ts)
+	}
+}
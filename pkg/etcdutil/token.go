@@ -0,0 +1,29 @@
+package etcdutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// NewDataToken generates a random token for authenticating data requests
+// between tasks.
+func NewDataToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func CreateDataToken(client Coordinator, appname, token string) error {
+	_, err := client.Create(DataTokenPath(appname), token, 0)
+	return err
+}
+
+func GetDataToken(client Coordinator, appname string) (string, error) {
+	resp, err := client.Get(DataTokenPath(appname), false, false)
+	if err != nil {
+		return "", err
+	}
+	return resp.Node.Value, nil
+}
@@ -0,0 +1,35 @@
+package etcdutil
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// Publish publishes an event on the topic of the job, e.g. a learning rate
+// change or an early stop, to all tasks subscribed to it. Events have to be
+// small, as they are kept in etcd.
+func Publish(client Coordinator, name, topic, data string) error {
+	_, err := client.Set(TopicPath(name, topic), data, 0)
+	return err
+}
+
+// WatchTopic calls onEvent with every event published on the topic from now
+// on, in order, until stop. Events published before aren't replayed. It
+// returns once the watch is set up.
+func WatchTopic(client Coordinator, name, topic string, stop chan bool, onEvent func(data string)) error {
+	// The topic might have no event yet, but the job has a layout.
+	resp, err := client.Get(JobPath(name), false, false)
+	if err != nil {
+		return err
+	}
+	receiver := make(chan *etcd.Response, 1)
+	go client.Watch(TopicPath(name, topic), resp.EtcdIndex+1, false, receiver, stop)
+	go func() {
+		for resp := range receiver {
+			if resp.Action == "delete" || resp.Action == "expire" || resp.Action == "compareAndDelete" {
+				continue
+			}
+			onEvent(resp.Node.Value)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,46 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopics(t *testing.T) {
+	client := NewMemoryCoordinator()
+	job := "TestTopics"
+	if err := CreateNumOfTasks(client, job, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Publish(client, job, "lr", "0.1"); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan string, 4)
+	stop := make(chan bool, 1)
+	if err := WatchTopic(client, job, "lr", stop, func(data string) { events <- data }); err != nil {
+		t.Fatalf("WatchTopic failed: %v", err)
+	}
+	for _, p := range []struct{ topic, data string }{{"lr", "0.01"}, {"stop", "now"}, {"lr", "0.001"}} {
+		if err := Publish(client, job, p.topic, p.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The event published before the watch isn't replayed, nor are events
+	// of other topics sent.
+	for _, want := range []string{"0.01", "0.001"} {
+		select {
+		case data := <-events:
+			if data != want {
+				t.Errorf("event = %q, want %q", data, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event %q", want)
+		}
+	}
+	stop <- true
+	Publish(client, job, "lr", "1")
+	select {
+	case data := <-events:
+		t.Errorf("event %q after stop", data)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,75 @@
+package etcdutil
+
+import "time"
+
+// TTLs are the lifetimes of the records nodes keep in etcd, by class, so
+// that operators can trade how soon a dead node is noticed for how much
+// churn, e.g. GC pauses or a slow etcd, is tolerated before a live one is
+// failed over. etcd keeps TTLs in whole seconds; they are rounded up. A TTL
+// of 0 is that of DefaultTTLs.
+type TTLs struct {
+	// Address is how long the claim of a task, which holds the address of
+	// its node, lasts until the first heartbeat.
+	Address time.Duration
+	// Heartbeat is how long the claim lasts after each heartbeat. By
+	// default it's three heartbeat intervals.
+	Heartbeat time.Duration
+	// Standby is how long a node stays in the standby pool after its last
+	// refresh. By default it's three refresh intervals.
+	Standby time.Duration
+	// Meta is how long meta flags stay set. By default they stay until
+	// flagged again or the job is destroyed.
+	Meta time.Duration
+	// DeadLetter is how long undelivered meta and data are kept for the
+	// controller to show, see AddDeadLetter.
+	DeadLetter time.Duration
+}
+
+// DefaultTTLs are the TTLs of nodes which don't set theirs.
+var DefaultTTLs = TTLs{
+	Address:    3 * time.Second,
+	DeadLetter: 7 * 24 * time.Hour,
+}
+
+// AddressSeconds returns the TTL of the claim until the first heartbeat, in
+// seconds.
+func (t TTLs) AddressSeconds() uint64 {
+	if t.Address > 0 {
+		return seconds(t.Address)
+	}
+	return seconds(DefaultTTLs.Address)
+}
+
+// HeartbeatSeconds returns the TTL of the claim after heartbeats at given
+// interval, in seconds.
+func (t TTLs) HeartbeatSeconds(interval time.Duration) uint64 {
+	return computeTTL(interval, t.Heartbeat)
+}
+
+// StandbySeconds returns the TTL of standby nodes refreshing at given
+// interval, in seconds.
+func (t TTLs) StandbySeconds(interval time.Duration) uint64 {
+	return computeTTL(interval, t.Standby)
+}
+
+// MetaSeconds returns the TTL of meta flags in seconds, 0 if they don't
+// expire.
+func (t TTLs) MetaSeconds() uint64 {
+	if t.Meta > 0 {
+		return seconds(t.Meta)
+	}
+	return seconds(DefaultTTLs.Meta)
+}
+
+// DeadLetterSeconds returns the TTL of dead letters in seconds.
+func (t TTLs) DeadLetterSeconds() uint64 {
+	if t.DeadLetter > 0 {
+		return seconds(t.DeadLetter)
+	}
+	return seconds(DefaultTTLs.DeadLetter)
+}
+
+// seconds rounds d up to seconds.
+func seconds(d time.Duration) uint64 {
+	return uint64((d + time.Second - 1) / time.Second)
+}
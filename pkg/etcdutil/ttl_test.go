@@ -0,0 +1,37 @@
+package etcdutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLs(t *testing.T) {
+	tests := []struct {
+		ttls                                    TTLs
+		address, heartbeat, standby, meta, dead uint64
+	}{
+		// defaults, heartbeats and refreshes every 2s
+		{TTLs{}, 3, 6, 6, 0, 7 * 24 * 3600},
+		{
+			TTLs{Address: 10 * time.Second, Heartbeat: 1500 * time.Millisecond, Standby: time.Minute, Meta: time.Hour, DeadLetter: time.Second},
+			10, 2, 60, 3600, 1,
+		},
+	}
+	for i, tt := range tests {
+		if got := tt.ttls.AddressSeconds(); got != tt.address {
+			t.Errorf("#%d: address TTL = %d, want %d", i, got, tt.address)
+		}
+		if got := tt.ttls.HeartbeatSeconds(2 * time.Second); got != tt.heartbeat {
+			t.Errorf("#%d: heartbeat TTL = %d, want %d", i, got, tt.heartbeat)
+		}
+		if got := tt.ttls.StandbySeconds(2 * time.Second); got != tt.standby {
+			t.Errorf("#%d: standby TTL = %d, want %d", i, got, tt.standby)
+		}
+		if got := tt.ttls.MetaSeconds(); got != tt.meta {
+			t.Errorf("#%d: meta TTL = %d, want %d", i, got, tt.meta)
+		}
+		if got := tt.ttls.DeadLetterSeconds(); got != tt.dead {
+			t.Errorf("#%d: dead letter TTL = %d, want %d", i, got, tt.dead)
+		}
+	}
+}
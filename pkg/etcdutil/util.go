@@ -6,6 +6,10 @@ import (
 	"github.com/coreos/go-etcd/etcd"
 )
 
+func IsNodeExist(err error) bool {
+	return strings.Contains(err.Error(), "Key already exists")
+}
+
 func IsKeyNotFound(err error) bool {
 	if strings.Contains(err.Error(), "Key not found") {
 		return true
@@ -13,6 +17,10 @@ func IsKeyNotFound(err error) bool {
 	return false
 }
 
+func IsCompareFailed(err error) bool {
+	return strings.Contains(err.Error(), "Compare failed")
+}
+
 func ListKeys(nodes []*etcd.Node) []string {
 	res := make([]string, len(nodes))
 	for i, n := range nodes {
@@ -0,0 +1,494 @@
+package etcdutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// etcd v2 error codes, which callers check, e.g. with IsKeyNotFound.
+const (
+	errCodeKeyNotFound  = 100
+	errCodeTestFailed   = 101
+	errCodeNodeExist    = 105
+	errCodeDirNotEmpty  = 108
+	errCodeEventCleared = 401
+)
+
+// v3Client implements Coordinator on the JSON gateway of the etcd v3 API:
+//   - keys are kept as they are; directories are key prefixes ending with /
+//   - keys with a TTL are attached to a lease of the TTL, granted on every
+//     write, so renewing a key means writing it again
+//   - Create and compare-and-* are transactions on the create and mod
+//     revisions of the key, which stand in for the v2 indexes
+//   - watch events are "set" for puts and "delete" for deletes, including
+//     lease expiry, since v3 doesn't tell them apart
+type v3Client struct {
+	machines []string
+	http     *http.Client
+}
+
+// NewV3Client returns a client of the etcd v3 API, e.g. of etcd 3.3 with the
+// gRPC gateway at http://127.0.0.1:2379/v3/.
+func NewV3Client(machines []string) Coordinator {
+	return &v3Client{machines: machines, http: &http.Client{}}
+}
+
+type v3Header struct {
+	Revision uint64 `json:"revision,string"`
+}
+
+type v3KV struct {
+	Key            []byte `json:"key"`
+	Value          []byte `json:"value,omitempty"`
+	CreateRevision uint64 `json:"create_revision,string,omitempty"`
+	ModRevision    uint64 `json:"mod_revision,string,omitempty"`
+}
+
+func (kv *v3KV) node() *etcd.Node {
+	return &etcd.Node{
+		Key:           string(kv.Key),
+		Value:         string(kv.Value),
+		CreatedIndex:  kv.CreateRevision,
+		ModifiedIndex: kv.ModRevision,
+	}
+}
+
+type v3Range struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type v3RangeResponse struct {
+	Header v3Header `json:"header"`
+	KVs    []*v3KV  `json:"kvs"`
+}
+
+type v3Put struct {
+	Key    []byte `json:"key"`
+	Value  []byte `json:"value"`
+	Lease  int64  `json:"lease,string,omitempty"`
+	PrevKV bool   `json:"prev_kv"`
+}
+
+type v3DeleteRange struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	PrevKV   bool   `json:"prev_kv"`
+}
+
+type v3DeleteRangeResponse struct {
+	Header  v3Header `json:"header"`
+	Deleted int64    `json:"deleted,string"`
+	PrevKVs []*v3KV  `json:"prev_kvs"`
+}
+
+type v3Compare struct {
+	Result         string `json:"result"`
+	Target         string `json:"target"`
+	Key            []byte `json:"key"`
+	CreateRevision uint64 `json:"create_revision,string,omitempty"`
+	ModRevision    uint64 `json:"mod_revision,string,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+type v3Op struct {
+	Put         *v3Put         `json:"request_put,omitempty"`
+	DeleteRange *v3DeleteRange `json:"request_delete_range,omitempty"`
+}
+
+type v3Txn struct {
+	Compare []v3Compare `json:"compare"`
+	Success []v3Op      `json:"success"`
+}
+
+type v3TxnResponse struct {
+	Header    v3Header `json:"header"`
+	Succeeded bool     `json:"succeeded"`
+	Responses []struct {
+		Put *struct {
+			PrevKV *v3KV `json:"prev_kv"`
+		} `json:"response_put"`
+		DeleteRange *v3DeleteRangeResponse `json:"response_delete_range"`
+	} `json:"responses"`
+}
+
+// post sends a request to the first reachable machine.
+func (c *v3Client) post(path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	for _, m := range c.machines {
+		r, err := c.http.Post(strings.TrimSuffix(m, "/")+"/v3"+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			var e struct {
+				Error string `json:"error"`
+			}
+			json.NewDecoder(r.Body).Decode(&e)
+			return fmt.Errorf("etcdutil: %s returns %s: %s", path, r.Status, e.Error)
+		}
+		return json.NewDecoder(r.Body).Decode(resp)
+	}
+	return &etcd.EtcdError{
+		ErrorCode: etcd.ErrCodeEtcdNotReachable,
+		Message:   fmt.Sprintf("All the given peers are not reachable: %v", c.machines),
+	}
+}
+
+func v3Error(code int, message, key string, index uint64) error {
+	return &etcd.EtcdError{ErrorCode: code, Message: message, Cause: key, Index: index}
+}
+
+// dirPrefix is the prefix of keys under the directory key.
+func dirPrefix(key string) string {
+	return strings.TrimSuffix(key, "/") + "/"
+}
+
+// prefixEnd is the range end of all keys with given prefix.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// every key
+	return []byte{0}
+}
+
+func (c *v3Client) lease(ttl uint64) (int64, error) {
+	if ttl == 0 {
+		return 0, nil
+	}
+	var resp struct {
+		ID int64 `json:"ID,string"`
+	}
+	err := c.post("/lease/grant", &struct {
+		TTL uint64 `json:"TTL,string"`
+	}{ttl}, &resp)
+	return resp.ID, err
+}
+
+func (c *v3Client) Get(key string, sorted, recursive bool) (*etcd.Response, error) {
+	var resp v3RangeResponse
+	if err := c.post("/kv/range", &v3Range{Key: []byte(key)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) == 1 {
+		return &etcd.Response{Action: "get", Node: resp.KVs[0].node(), EtcdIndex: resp.Header.Revision}, nil
+	}
+	prefix := dirPrefix(key)
+	if err := c.post("/kv/range", &v3Range{Key: []byte(prefix), RangeEnd: prefixEnd(prefix)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) == 0 {
+		return nil, v3Error(errCodeKeyNotFound, "Key not found", key, resp.Header.Revision)
+	}
+	return &etcd.Response{Action: "get", Node: dirNode(key, resp.KVs, recursive), EtcdIndex: resp.Header.Revision}, nil
+}
+
+// dirNode builds the v2 directory of given key from the v3 keys under it.
+func dirNode(key string, kvs []*v3KV, recursive bool) *etcd.Node {
+	root := &etcd.Node{Key: strings.TrimSuffix(key, "/"), Dir: true}
+	if root.Key == "" {
+		root.Key = "/"
+	}
+	dirs := map[string]*etcd.Node{root.Key: root}
+	var dir func(key string) *etcd.Node
+	dir = func(key string) *etcd.Node {
+		if n, ok := dirs[key]; ok {
+			return n
+		}
+		n := &etcd.Node{Key: key, Dir: true}
+		dirs[key] = n
+		parent := dir(key[:strings.LastIndex(key, "/")])
+		parent.Nodes = append(parent.Nodes, n)
+		return n
+	}
+	dirs[""] = root
+	for _, kv := range kvs {
+		n := kv.node()
+		parent := dir(n.Key[:strings.LastIndex(n.Key, "/")])
+		parent.Nodes = append(parent.Nodes, n)
+	}
+	for _, n := range dirs {
+		sort.Sort(byKey(n.Nodes))
+	}
+	if !recursive {
+		for _, n := range root.Nodes {
+			if n.Dir {
+				n.Nodes = nil
+			}
+		}
+	}
+	return root
+}
+
+type byKey etcd.Nodes
+
+func (b byKey) Len() int           { return len(b) }
+func (b byKey) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byKey) Less(i, j int) bool { return b[i].Key < b[j].Key }
+
+func (c *v3Client) Set(key string, value string, ttl uint64) (*etcd.Response, error) {
+	lease, err := c.lease(ttl)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Header v3Header `json:"header"`
+		PrevKV *v3KV    `json:"prev_kv"`
+	}
+	if err := c.post("/kv/put", &v3Put{Key: []byte(key), Value: []byte(value), Lease: lease, PrevKV: true}, &resp); err != nil {
+		return nil, err
+	}
+	return putResponse("set", key, value, resp.Header.Revision, resp.PrevKV), nil
+}
+
+func putResponse(action, key, value string, rev uint64, prev *v3KV) *etcd.Response {
+	n := &etcd.Node{Key: key, Value: value, CreatedIndex: rev, ModifiedIndex: rev}
+	resp := &etcd.Response{Action: action, Node: n, EtcdIndex: rev}
+	if prev != nil {
+		n.CreatedIndex = prev.CreateRevision
+		resp.PrevNode = prev.node()
+	}
+	return resp
+}
+
+// txn runs the transaction, and tells why it fails as v2 does.
+func (c *v3Client) txn(key string, txn *v3Txn) (*v3TxnResponse, error) {
+	var resp v3TxnResponse
+	if err := c.post("/kv/txn", txn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Succeeded {
+		return &resp, nil
+	}
+	var cur v3RangeResponse
+	if err := c.post("/kv/range", &v3Range{Key: []byte(key)}, &cur); err != nil {
+		return nil, err
+	}
+	if len(cur.KVs) == 0 {
+		return nil, v3Error(errCodeKeyNotFound, "Key not found", key, cur.Header.Revision)
+	}
+	if txn.Compare[0].Target == "CREATE" && txn.Compare[0].Result == "EQUAL" {
+		return nil, v3Error(errCodeNodeExist, "Key already exists", key, cur.Header.Revision)
+	}
+	return nil, v3Error(errCodeTestFailed, "Compare failed", key, cur.Header.Revision)
+}
+
+// compares returns the v3 comparisons of a v2 compare-and-* on key.
+func compares(key, prevValue string, prevIndex uint64) []v3Compare {
+	// The key must exist.
+	cmps := []v3Compare{{Result: "GREATER", Target: "CREATE", Key: []byte(key)}}
+	if prevValue != "" {
+		cmps = append(cmps, v3Compare{Result: "EQUAL", Target: "VALUE", Key: []byte(key), Value: []byte(prevValue)})
+	}
+	if prevIndex != 0 {
+		cmps = append(cmps, v3Compare{Result: "EQUAL", Target: "MOD", Key: []byte(key), ModRevision: prevIndex})
+	}
+	return cmps
+}
+
+func (c *v3Client) Create(key string, value string, ttl uint64) (*etcd.Response, error) {
+	lease, err := c.lease(ttl)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.txn(key, &v3Txn{
+		Compare: []v3Compare{{Result: "EQUAL", Target: "CREATE", Key: []byte(key)}},
+		Success: []v3Op{{Put: &v3Put{Key: []byte(key), Value: []byte(value), Lease: lease}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return putResponse("create", key, value, resp.Header.Revision, nil), nil
+}
+
+func (c *v3Client) CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	lease, err := c.lease(ttl)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.txn(key, &v3Txn{
+		Compare: compares(key, prevValue, prevIndex),
+		Success: []v3Op{{Put: &v3Put{Key: []byte(key), Value: []byte(value), Lease: lease, PrevKV: true}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var prev *v3KV
+	if len(resp.Responses) == 1 && resp.Responses[0].Put != nil {
+		prev = resp.Responses[0].Put.PrevKV
+	}
+	return putResponse("compareAndSwap", key, value, resp.Header.Revision, prev), nil
+}
+
+func (c *v3Client) CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	resp, err := c.txn(key, &v3Txn{
+		Compare: compares(key, prevValue, prevIndex),
+		Success: []v3Op{{DeleteRange: &v3DeleteRange{Key: []byte(key), PrevKV: true}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var prevs []*v3KV
+	if len(resp.Responses) == 1 && resp.Responses[0].DeleteRange != nil {
+		prevs = resp.Responses[0].DeleteRange.PrevKVs
+	}
+	return deleteResponse("compareAndDelete", key, resp.Header.Revision, prevs), nil
+}
+
+func deleteResponse(action, key string, rev uint64, prevs []*v3KV) *etcd.Response {
+	resp := &etcd.Response{Action: action, Node: &etcd.Node{Key: key, ModifiedIndex: rev}, EtcdIndex: rev}
+	if len(prevs) == 1 && string(prevs[0].Key) == key {
+		resp.PrevNode = prevs[0].node()
+		resp.Node.CreatedIndex = prevs[0].CreateRevision
+	}
+	return resp
+}
+
+func (c *v3Client) deleteRange(r *v3DeleteRange) (*v3DeleteRangeResponse, error) {
+	var resp v3DeleteRangeResponse
+	err := c.post("/kv/deleterange", r, &resp)
+	return &resp, err
+}
+
+func (c *v3Client) Delete(key string, recursive bool) (*etcd.Response, error) {
+	resp, err := c.deleteRange(&v3DeleteRange{Key: []byte(key), PrevKV: true})
+	if err != nil {
+		return nil, err
+	}
+	deleted := resp.Deleted
+	prevs := resp.PrevKVs
+	if recursive {
+		prefix := dirPrefix(key)
+		if resp, err = c.deleteRange(&v3DeleteRange{Key: []byte(prefix), RangeEnd: prefixEnd(prefix)}); err != nil {
+			return nil, err
+		}
+		deleted += resp.Deleted
+	}
+	if deleted == 0 {
+		return nil, v3Error(errCodeKeyNotFound, "Key not found", key, resp.Header.Revision)
+	}
+	return deleteResponse("delete", key, resp.Header.Revision, prevs), nil
+}
+
+// DeleteDir succeeds if there is nothing under the directory, since v3 has no
+// directories to delete.
+func (c *v3Client) DeleteDir(key string) (*etcd.Response, error) {
+	prefix := dirPrefix(key)
+	var resp v3RangeResponse
+	if err := c.post("/kv/range", &v3Range{Key: []byte(prefix), RangeEnd: prefixEnd(prefix)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) > 0 {
+		return nil, v3Error(errCodeDirNotEmpty, "Directory not empty", key, resp.Header.Revision)
+	}
+	return &etcd.Response{Action: "delete", Node: &etcd.Node{Key: key, Dir: true}, EtcdIndex: resp.Header.Revision}, nil
+}
+
+type v3WatchResponse struct {
+	Result struct {
+		Header          v3Header `json:"header"`
+		CompactRevision uint64   `json:"compact_revision,string"`
+		Canceled        bool     `json:"canceled"`
+		Events          []struct {
+			Type string `json:"type"`
+			KV   *v3KV  `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Watch sends changes from waitIndex on to receiver until stop, like the v2
+// client. The receiver is closed when it returns.
+func (c *v3Client) Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error) {
+	defer close(receiver)
+	var create struct {
+		Request struct {
+			Key           []byte `json:"key"`
+			RangeEnd      []byte `json:"range_end,omitempty"`
+			StartRevision uint64 `json:"start_revision,string,omitempty"`
+		} `json:"create_request"`
+	}
+	create.Request.Key = []byte(prefix)
+	create.Request.StartRevision = waitIndex
+	if recursive {
+		// Keys from prefix to everything under it. Others in between, e.g.
+		// prefix-1, are filtered out below.
+		create.Request.RangeEnd = prefixEnd(dirPrefix(prefix))
+	}
+	body, err := json.Marshal(&create)
+	if err != nil {
+		return nil, err
+	}
+	var r *http.Response
+	for _, m := range c.machines {
+		if r, err = c.http.Post(strings.TrimSuffix(m, "/")+"/v3/watch", "application/json", bytes.NewReader(body)); err == nil {
+			break
+		}
+	}
+	if r == nil {
+		return nil, &etcd.EtcdError{ErrorCode: etcd.ErrCodeEtcdNotReachable, Message: err.Error()}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		r.Body.Close()
+	}()
+
+	dec := json.NewDecoder(r.Body)
+	for {
+		var resp v3WatchResponse
+		if err := dec.Decode(&resp); err != nil {
+			select {
+			case <-stop:
+				return nil, etcd.ErrWatchStoppedByUser
+			default:
+				return nil, err
+			}
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("etcdutil: watch %s: %s", prefix, resp.Error.Message)
+		}
+		if resp.Result.CompactRevision != 0 {
+			return nil, v3Error(errCodeEventCleared, "The event in requested index is outdated and cleared", prefix, resp.Result.CompactRevision)
+		}
+		if resp.Result.Canceled {
+			return nil, fmt.Errorf("etcdutil: watch %s canceled", prefix)
+		}
+		for _, ev := range resp.Result.Events {
+			key := string(ev.KV.Key)
+			if key != prefix && !strings.HasPrefix(key, dirPrefix(prefix)) {
+				continue
+			}
+			change := &etcd.Response{Action: "set", Node: ev.KV.node(), EtcdIndex: resp.Result.Header.Revision}
+			if ev.Type == "DELETE" {
+				change.Action = "delete"
+			}
+			select {
+			case receiver <- change:
+			case <-stop:
+				return nil, etcd.ErrWatchStoppedByUser
+			}
+		}
+	}
+}
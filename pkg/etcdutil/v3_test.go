@@ -0,0 +1,208 @@
+package etcdutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// fakeGateway is a bare etcd v3 JSON gateway keeping keys in memory.
+type fakeGateway struct {
+	mu     sync.Mutex
+	rev    uint64
+	kvs    map[string]*v3KV
+	leases int64
+}
+
+func (g *fakeGateway) inRange(key string, start, end []byte) bool {
+	if len(end) == 0 {
+		return key == string(start)
+	}
+	return key >= string(start) && (string(end) == "\x00" || key < string(end))
+}
+
+func (g *fakeGateway) put(p *v3Put) *v3KV {
+	g.rev++
+	prev := g.kvs[string(p.Key)]
+	kv := &v3KV{Key: p.Key, Value: p.Value, CreateRevision: g.rev, ModRevision: g.rev}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+	}
+	g.kvs[string(p.Key)] = kv
+	return prev
+}
+
+func (g *fakeGateway) deleteRange(d *v3DeleteRange) *v3DeleteRangeResponse {
+	resp := &v3DeleteRangeResponse{}
+	for k, kv := range g.kvs {
+		if g.inRange(k, d.Key, d.RangeEnd) {
+			resp.PrevKVs = append(resp.PrevKVs, kv)
+			delete(g.kvs, k)
+		}
+	}
+	if resp.Deleted = int64(len(resp.PrevKVs)); resp.Deleted > 0 {
+		g.rev++
+	}
+	resp.Header.Revision = g.rev
+	return resp
+}
+
+func (g *fakeGateway) compare(c v3Compare) bool {
+	kv := g.kvs[string(c.Key)]
+	if kv == nil {
+		kv = &v3KV{}
+	}
+	var ok bool
+	switch c.Target {
+	case "CREATE":
+		if c.Result == "GREATER" {
+			return kv.CreateRevision > c.CreateRevision
+		}
+		ok = kv.CreateRevision == c.CreateRevision
+	case "MOD":
+		ok = kv.ModRevision == c.ModRevision
+	case "VALUE":
+		ok = string(kv.Value) == string(c.Value)
+	}
+	return ok
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var resp interface{}
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req v3Range
+		json.NewDecoder(r.Body).Decode(&req)
+		rr := &v3RangeResponse{}
+		for k, kv := range g.kvs {
+			if g.inRange(k, req.Key, req.RangeEnd) {
+				rr.KVs = append(rr.KVs, kv)
+			}
+		}
+		sort.Sort(kvsByKey(rr.KVs))
+		rr.Header.Revision = g.rev
+		resp = rr
+	case "/v3/kv/put":
+		var req v3Put
+		json.NewDecoder(r.Body).Decode(&req)
+		prev := g.put(&req)
+		resp = map[string]interface{}{"header": v3Header{Revision: g.rev}, "prev_kv": prev}
+	case "/v3/kv/deleterange":
+		var req v3DeleteRange
+		json.NewDecoder(r.Body).Decode(&req)
+		resp = g.deleteRange(&req)
+	case "/v3/kv/txn":
+		var req v3Txn
+		json.NewDecoder(r.Body).Decode(&req)
+		ok := true
+		for _, c := range req.Compare {
+			ok = ok && g.compare(c)
+		}
+		var responses []interface{}
+		if ok {
+			for _, op := range req.Success {
+				if op.Put != nil {
+					responses = append(responses, map[string]interface{}{"response_put": map[string]interface{}{"prev_kv": g.put(op.Put)}})
+				} else {
+					responses = append(responses, map[string]interface{}{"response_delete_range": g.deleteRange(op.DeleteRange)})
+				}
+			}
+		}
+		resp = map[string]interface{}{"header": v3Header{Revision: g.rev}, "succeeded": ok, "responses": responses}
+	case "/v3/lease/grant":
+		g.leases++
+		resp = map[string]interface{}{"ID": "7", "TTL": "3"}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+type kvsByKey []*v3KV
+
+func (b kvsByKey) Len() int           { return len(b) }
+func (b kvsByKey) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b kvsByKey) Less(i, j int) bool { return string(b[i].Key) < string(b[j].Key) }
+
+func TestV3Client(t *testing.T) {
+	g := &fakeGateway{kvs: make(map[string]*v3KV)}
+	s := httptest.NewServer(g)
+	defer s.Close()
+	c := NewV3Client([]string{"http://127.0.0.1:1", s.URL})
+
+	resp, err := c.Create("/job/healthy/0", "a", 3)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if g.leases != 1 {
+		t.Errorf("leases granted = %d, want 1", g.leases)
+	}
+	index := resp.Node.ModifiedIndex
+	if _, err := c.Create("/job/healthy/0", "b", 0); err == nil || IsCompareFailed(err) || IsKeyNotFound(err) {
+		t.Errorf("Create of existing key returns %v", err)
+	}
+	if _, err := c.CompareAndSwap("/job/healthy/0", "b", 0, "", index+1); err == nil || !IsCompareFailed(err) {
+		t.Errorf("CompareAndSwap of wrong index returns %v", err)
+	}
+	if _, err := c.CompareAndSwap("/job/healthy/1", "b", 0, "", index); err == nil || !IsKeyNotFound(err) {
+		t.Errorf("CompareAndSwap of missing key returns %v", err)
+	}
+	resp, err = c.CompareAndSwap("/job/healthy/0", "b", 0, "", index)
+	if err != nil {
+		t.Fatalf("CompareAndSwap failed: %v", err)
+	}
+	if resp.Node.CreatedIndex != index || resp.Node.ModifiedIndex <= index || resp.PrevNode.Value != "a" {
+		t.Errorf("CompareAndSwap response = %+v, node %+v", resp, resp.Node)
+	}
+	if _, err := c.Set("/job/epoch", "1", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	resp, err = c.Get("/job", false, true)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	root := resp.Node
+	if !root.Dir || len(root.Nodes) != 2 || root.Nodes[0].Key != "/job/epoch" ||
+		!root.Nodes[1].Dir || len(root.Nodes[1].Nodes) != 1 || root.Nodes[1].Nodes[0].Value != "b" {
+		t.Errorf("Get /job = %+v", root)
+	}
+	if resp, err = c.Get("/job", false, false); err != nil || resp.Node.Nodes[1].Nodes != nil {
+		t.Errorf("non-recursive Get /job = %v, %v", resp, err)
+	}
+	if _, err := c.Get("/job/tasks", false, false); err == nil || !IsKeyNotFound(err) {
+		t.Errorf("Get of missing dir returns %v", err)
+	}
+
+	if _, err := c.DeleteDir("/job/healthy"); err == nil {
+		t.Error("DeleteDir of non-empty dir succeeded")
+	}
+	if _, err := c.Delete("/", true); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if len(g.kvs) != 0 {
+		t.Errorf("keys left after Delete: %v", g.kvs)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix, end string
+	}{
+		{"/a/", "/a0"},
+		{"/", "0"},
+		{"a\xff", "b"},
+		{"\xff", "\x00"},
+	}
+	for _, tt := range tests {
+		if end := string(prefixEnd(tt.prefix)); end != tt.end {
+			t.Errorf("prefixEnd(%q) = %q, want %q", tt.prefix, end, tt.end)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Package faultinject fails tasks on purpose, so that applications can test how
+their tasks survive node failures.
+
+A Schedule declares the faults, e.g. fail at SetEpoch of epoch 3 with
+probability 0.5. Tasks either ask the schedule at the points they want to fail
+at, or are wrapped by Wrap, which fails them on entry of their callbacks.
+*/
+package faultinject
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/go-distributed/meritop"
+)
+
+// Callbacks of meritop.Task that faults can be scheduled at.
+const (
+	SetEpoch  = "SetEpoch"
+	MetaReady = "MetaReady"
+	DataReady = "DataReady"
+	Serve     = "Serve"
+)
+
+// Point is where a task might fail.
+type Point struct {
+	TaskID   uint64
+	Epoch    uint64
+	Callback string
+	// Link type of the other task in MetaReady, DataReady and Serve.
+	LinkType string
+}
+
+// Fault fails a task at matching points. Empty fields match any point.
+type Fault struct {
+	Callback string
+	LinkType string
+	Epochs   []uint64
+	Tasks    []uint64
+	// Probability to fail at a matching point, between 0 and 1.
+	Probability float64
+	// Limit is how many times the fault can happen at most. Zero means no
+	// limit.
+	Limit int
+}
+
+func (ft *Fault) matches(p Point) bool {
+	if ft.Callback != "" && ft.Callback != p.Callback {
+		return false
+	}
+	if ft.LinkType != "" && ft.LinkType != p.LinkType {
+		return false
+	}
+	return contains(ft.Epochs, p.Epoch) && contains(ft.Tasks, p.TaskID)
+}
+
+func contains(ids []uint64, id uint64) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Schedule is shared by all tasks of a job under test. Limits of faults count
+// across tasks and nodes, e.g. a fault with limit 1 doesn't fail the node
+// taking over the failed task.
+type Schedule struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	faults []Fault
+	counts []int
+}
+
+// NewSchedule creates a schedule of given faults. The seed makes probable
+// faults reproducible.
+func NewSchedule(seed int64, faults ...Fault) *Schedule {
+	return &Schedule{
+		rand:   rand.New(rand.NewSource(seed)),
+		faults: faults,
+		counts: make([]int, len(faults)),
+	}
+}
+
+// ShouldFail tells whether the task should fail at given point. A nil
+// schedule never fails.
+func (s *Schedule) ShouldFail(p Point) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.faults {
+		ft := &s.faults[i]
+		if !ft.matches(p) || (ft.Limit > 0 && s.counts[i] >= ft.Limit) {
+			continue
+		}
+		if s.rand.Float64() >= ft.Probability {
+			continue
+		}
+		s.counts[i]++
+		return true
+	}
+	return false
+}
+
+// Wrap fails the task on entry of its callbacks according to the schedule.
+// Instead of running the callback, fail is called with the framework of the
+// task, e.g. to stop the node with framework.StopNode.
+//
+// The wrapped task only implements meritop.Task. Tasks relying on optional
+// interfaces, e.g. meritop.Checkpointer, should call ShouldFail themselves.
+func Wrap(task meritop.Task, s *Schedule, fail func(meritop.Framework)) meritop.Task {
+	return &faultyTask{Task: task, schedule: s, fail: fail}
+}
+
+type faultyTask struct {
+	meritop.Task
+	schedule  *Schedule
+	fail      func(meritop.Framework)
+	framework meritop.Framework
+	taskID    uint64
+
+	// Framework runs callbacks concurrently.
+	mu    sync.Mutex
+	epoch uint64
+	// once failed, the node is going down and the task mustn't go on
+	failed bool
+}
+
+func (t *faultyTask) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID, t.framework = taskID, framework
+	t.Task.Init(taskID, framework)
+}
+
+func (t *faultyTask) injected(callback, linkType string) bool {
+	t.mu.Lock()
+	if t.failed {
+		t.mu.Unlock()
+		return true
+	}
+	p := Point{TaskID: t.taskID, Epoch: t.epoch, Callback: callback, LinkType: linkType}
+	t.failed = t.schedule.ShouldFail(p)
+	failed := t.failed
+	t.mu.Unlock()
+	if failed {
+		t.fail(t.framework)
+	}
+	return failed
+}
+
+func (t *faultyTask) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	t.epoch = epoch
+	t.mu.Unlock()
+	if t.injected(SetEpoch, "") {
+		return
+	}
+	t.Task.SetEpoch(epoch)
+}
+
+func (t *faultyTask) MetaReady(fromID uint64, linkType, meta string) {
+	if t.injected(MetaReady, linkType) {
+		return
+	}
+	t.Task.MetaReady(fromID, linkType, meta)
+}
+
+func (t *faultyTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	if t.injected(DataReady, linkType) {
+		return
+	}
+	t.Task.DataReady(fromID, linkType, req, resp)
+}
+
+func (t *faultyTask) Serve(fromID uint64, linkType, req string) []byte {
+	if t.injected(Serve, linkType) {
+		return nil
+	}
+	return t.Task.Serve(fromID, linkType, req)
+}
@@ -0,0 +1,103 @@
+package faultinject
+
+import (
+	"testing"
+
+	"github.com/go-distributed/meritop"
+)
+
+func TestScheduleShouldFail(t *testing.T) {
+	s := NewSchedule(1,
+		Fault{Callback: SetEpoch, Epochs: []uint64{2}, Probability: 1, Limit: 1},
+		Fault{Callback: DataReady, LinkType: meritop.LinkParent, Tasks: []uint64{3, 4}, Probability: 1},
+	)
+	tests := []struct {
+		p    Point
+		fail bool
+	}{
+		{Point{TaskID: 1, Epoch: 1, Callback: SetEpoch}, false},
+		{Point{TaskID: 1, Epoch: 2, Callback: SetEpoch}, true},
+		// limit reached, e.g. by the node taking over
+		{Point{TaskID: 1, Epoch: 2, Callback: SetEpoch}, false},
+		{Point{TaskID: 3, Epoch: 2, Callback: DataReady, LinkType: meritop.LinkChild}, false},
+		{Point{TaskID: 2, Epoch: 2, Callback: DataReady, LinkType: meritop.LinkParent}, false},
+		{Point{TaskID: 4, Epoch: 2, Callback: DataReady, LinkType: meritop.LinkParent}, true},
+		{Point{TaskID: 4, Epoch: 5, Callback: DataReady, LinkType: meritop.LinkParent}, true},
+	}
+	for i, tt := range tests {
+		if fail := s.ShouldFail(tt.p); fail != tt.fail {
+			t.Errorf("#%d: ShouldFail(%+v) = %v, want %v", i, tt.p, fail, tt.fail)
+		}
+	}
+
+	var nilSchedule *Schedule
+	if nilSchedule.ShouldFail(Point{Callback: SetEpoch}) {
+		t.Errorf("nil schedule should never fail")
+	}
+}
+
+// Probable faults are reproducible with the same seed.
+func TestScheduleProbability(t *testing.T) {
+	run := func() (fails []bool) {
+		s := NewSchedule(42, Fault{Callback: Serve, Probability: 0.3})
+		for i := 0; i < 100; i++ {
+			fails = append(fails, s.ShouldFail(Point{Callback: Serve}))
+		}
+		return fails
+	}
+	a, b := run(), run()
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("#%d: faults differ with the same seed", i)
+		}
+		if a[i] {
+			n++
+		}
+	}
+	if n < 10 || n > 50 {
+		t.Errorf("faults = %d out of 100 with probability 0.3", n)
+	}
+}
+
+type recordTask struct{ calls []string }
+
+func (t *recordTask) Init(uint64, meritop.Framework)           { t.calls = append(t.calls, "Init") }
+func (t *recordTask) Exit()                                    {}
+func (t *recordTask) SetEpoch(uint64)                          { t.calls = append(t.calls, SetEpoch) }
+func (t *recordTask) MetaReady(uint64, string, string)         { t.calls = append(t.calls, MetaReady) }
+func (t *recordTask) DataReady(uint64, string, string, []byte) { t.calls = append(t.calls, DataReady) }
+func (t *recordTask) Serve(uint64, string, string) []byte {
+	t.calls = append(t.calls, Serve)
+	return nil
+}
+
+func TestWrap(t *testing.T) {
+	rt := new(recordTask)
+	failures := 0
+	task := Wrap(rt, NewSchedule(1, Fault{Callback: MetaReady, Epochs: []uint64{2}, Probability: 1}),
+		func(meritop.Framework) { failures++ })
+
+	task.Init(0, nil)
+	task.SetEpoch(1)
+	task.MetaReady(1, meritop.LinkChild, "m")
+	task.SetEpoch(2)
+	task.MetaReady(1, meritop.LinkChild, "m")
+	// the node is going down, nothing goes through any more
+	task.DataReady(1, meritop.LinkChild, "r", nil)
+	task.Serve(1, meritop.LinkChild, "r")
+
+	want := []string{"Init", SetEpoch, MetaReady, SetEpoch}
+	if len(rt.calls) != len(want) {
+		t.Fatalf("calls want = %v, get = %v", want, rt.calls)
+	}
+	for i := range want {
+		if rt.calls[i] != want[i] {
+			t.Errorf("calls want = %v, get = %v", want, rt.calls)
+			break
+		}
+	}
+	if failures != 1 {
+		t.Errorf("failures want = 1, get = %d", failures)
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Package kube places the nodes of a job on a Kubernetes cluster: one pod of
+meritop-worker per task, plus standby pods taking over failed tasks. Pods
+find etcd and the job through environment variables (see EnvEtcd, EnvJob),
+which meritop-worker reads as defaults of its flags, and serve the other
+nodes on their pod IP.
+
+Pods don't restart in place. A failed pod is deleted and replaced by a new
+one, while the controller fails its task over through etcd as for any node,
+so that a replacement, or a standby, takes it over.
+
+It talks to the API server over HTTP rather than through a client library,
+so that meritop doesn't depend on one.
+*/
+package kube
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables of the pods of a job.
+const (
+	EnvEtcd    = "MERITOP_ETCD"
+	EnvEtcdAPI = "MERITOP_ETCD_API"
+	EnvJob     = "MERITOP_JOB"
+	EnvListen  = "MERITOP_LISTEN"
+
+	envPodIP = "MERITOP_POD_IP"
+)
+
+// Labels of the pods of a job.
+const (
+	LabelJob  = "meritop-job"
+	LabelRole = "meritop-role"
+
+	RoleTask    = "task"
+	RoleStandby = "standby"
+)
+
+// Phases of pods.
+const (
+	PodPending   = "Pending"
+	PodRunning   = "Running"
+	PodSucceeded = "Succeeded"
+	PodFailed    = "Failed"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// ErrNotInCluster is returned by InClusterClient outside of a pod.
+var ErrNotInCluster = errors.New("kube: not running in a Kubernetes cluster")
+
+// Client manages pods of a namespace through the Kubernetes API server.
+type Client struct {
+	server    string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+// NewClient returns a client of the API server at the URL, e.g.
+// https://10.0.0.1:443, authenticated with the bearer token, if any.
+// tlsConfig is nil for the default one.
+func NewClient(server, namespace, token string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		server:    strings.TrimSuffix(server, "/"),
+		namespace: namespace,
+		token:     token,
+		client:    &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}
+}
+
+// InClusterClient returns a client of the cluster the process runs in, as
+// the service account of its pod, in the namespace of the pod unless
+// namespace is set.
+func InClusterClient(namespace string) (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("kube: no certificate in %s/ca.crt", serviceAccountDir)
+	}
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	server := "https://" + net.JoinHostPort(host, port)
+	return NewClient(server, namespace, strings.TrimSpace(string(token)), &tls.Config{RootCAs: pool}), nil
+}
+
+// pod is the part of a Kubernetes pod meritop deals with.
+type pod struct {
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Kind       string     `json:"kind,omitempty"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       podSpec    `json:"spec"`
+	Status     podStatus  `json:"status,omitempty"`
+}
+
+type objectMeta struct {
+	Name         string            `json:"name,omitempty"`
+	GenerateName string            `json:"generateName,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	// set once the pod is being deleted
+	DeletionTimestamp string `json:"deletionTimestamp,omitempty"`
+}
+
+type podSpec struct {
+	RestartPolicy string      `json:"restartPolicy,omitempty"`
+	Containers    []container `json:"containers"`
+}
+
+type container struct {
+	Name  string   `json:"name"`
+	Image string   `json:"image"`
+	Args  []string `json:"args,omitempty"`
+	Env   []envVar `json:"env,omitempty"`
+}
+
+type envVar struct {
+	Name      string        `json:"name"`
+	Value     string        `json:"value,omitempty"`
+	ValueFrom *envVarSource `json:"valueFrom,omitempty"`
+}
+
+type envVarSource struct {
+	FieldRef *fieldRef `json:"fieldRef,omitempty"`
+}
+
+type fieldRef struct {
+	FieldPath string `json:"fieldPath"`
+}
+
+type podStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+func (c *Client) podsURL() string {
+	return c.server + "/api/v1/namespaces/" + url.QueryEscape(c.namespace) + "/pods"
+}
+
+// createPod creates the pod, and returns it as created, e.g. with the name
+// generated by the API server.
+func (c *Client) createPod(p *pod) (*pod, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var created pod
+	if err := c.do("POST", c.podsURL(), bytes.NewReader(body), &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// listPods lists the pods with the labels.
+func (c *Client) listPods(labels map[string]string) ([]pod, error) {
+	var sel []string
+	for k, v := range labels {
+		sel = append(sel, k+"="+v)
+	}
+	q := url.Values{"labelSelector": {strings.Join(sel, ",")}}
+	var l podList
+	if err := c.do("GET", c.podsURL()+"?"+q.Encode(), nil, &l); err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+// deletePod deletes the pod of the name. Pods which don't exist are deleted
+// already.
+func (c *Client) deletePod(name string) error {
+	err := c.do("DELETE", c.podsURL()+"/"+url.QueryEscape(name), nil, nil)
+	if e, ok := err.(*StatusError); ok && e.Code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// StatusError is an error response of the API server.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kube: API server responded %d: %s", e.Code, e.Message)
+}
+
+func (c *Client) do(method, urlStr string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, urlStr, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		// The message of the Status object, if any.
+		var status struct{ Message string }
+		if json.Unmarshal(b, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(b))
+		}
+		return &StatusError{Code: resp.StatusCode, Message: status.Message}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
+
+// workerEnv returns the environment telling meritop-worker where etcd and
+// the job are, and to serve the other nodes on the IP of its pod.
+func workerEnv(p *Placement) []envVar {
+	env := []envVar{
+		{Name: EnvEtcd, Value: strings.Join(p.EtcdURLs, ",")},
+		{Name: EnvJob, Value: p.Job},
+		{Name: envPodIP, ValueFrom: &envVarSource{FieldRef: &fieldRef{FieldPath: "status.podIP"}}},
+		// Kubernetes expands $(VAR) of the variables above.
+		{Name: EnvListen, Value: "$(" + envPodIP + "):" + strconv.Itoa(p.Port)},
+	}
+	if p.EtcdAPI != "" {
+		env = append(env, envVar{Name: EnvEtcdAPI, Value: p.EtcdAPI})
+	}
+	return env
+}
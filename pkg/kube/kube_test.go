@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is an API server keeping pods in memory.
+type fakeServer struct {
+	mu   sync.Mutex
+	n    int
+	pods map[string]pod
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	const prefix = "/api/v1/namespaces/test/pods"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	switch r.Method {
+	case "POST":
+		var p pod
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.n++
+		p.Metadata.Name = p.Metadata.GenerateName + strconv.Itoa(s.n)
+		p.Status.Phase = PodPending
+		s.pods[p.Metadata.Name] = p
+		json.NewEncoder(w).Encode(p)
+	case "GET":
+		var l podList
+		sel := r.URL.Query().Get("labelSelector")
+		for _, p := range s.pods {
+			if sel == LabelJob+"="+p.Metadata.Labels[LabelJob] {
+				l.Items = append(l.Items, p)
+			}
+		}
+		json.NewEncoder(w).Encode(l)
+	case "DELETE":
+		if _, ok := s.pods[name]; !ok {
+			http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+			return
+		}
+		delete(s.pods, name)
+	}
+}
+
+func (s *fakeServer) setPhase(role, phase string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, p := range s.pods {
+		if p.Metadata.Labels[LabelRole] == role && p.Status.Phase != phase {
+			p.Status.Phase = phase
+			p.Status.Reason = "Error"
+			s.pods[name] = p
+			return name
+		}
+	}
+	return ""
+}
+
+func (s *fakeServer) count(role string) (n int, standby bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pods {
+		if p.Metadata.Labels[LabelRole] == role {
+			n++
+			standby = p.Spec.Containers[0].Args[0] == "-standby"
+		}
+	}
+	return n, standby
+}
+
+func TestPlacer(t *testing.T) {
+	fs := &fakeServer{pods: make(map[string]pod)}
+	s := httptest.NewServer(fs)
+	defer s.Close()
+	pl := NewPlacer(NewClient(s.URL, "test", "", nil), Placement{
+		Job:      "TestPlacer",
+		Tasks:    3,
+		Standbys: 1,
+		Image:    "meritop-worker",
+		Args:     []string{"-compression", "snappy"},
+		EtcdURLs: []string{"http://etcd:4001"},
+	})
+	var failed []string
+	pl.OnFailure = func(name, reason string) { failed = append(failed, name+" "+reason) }
+
+	if err := pl.Reconcile(); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if n, standby := fs.count(RoleTask); n != 3 || standby {
+		t.Errorf("task pods = %d, standby %v, want 3 taking tasks", n, standby)
+	}
+	if n, standby := fs.count(RoleStandby); n != 1 || !standby {
+		t.Errorf("standby pods = %d, standby %v, want 1 standing by", n, standby)
+	}
+	for _, p := range fs.pods {
+		env := make(map[string]string)
+		for _, e := range p.Spec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+		if env[EnvJob] != "TestPlacer" || env[EnvEtcd] != "http://etcd:4001" || env[EnvListen] != "$("+envPodIP+"):0" {
+			t.Errorf("env of pod %s = %v", p.Metadata.Name, env)
+		}
+	}
+
+	// A failed pod is replaced, one which succeeded isn't.
+	name := fs.setPhase(RoleTask, PodFailed)
+	fs.setPhase(RoleStandby, PodSucceeded)
+	if err := pl.Reconcile(); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if len(failed) != 1 || failed[0] != name+" Error" {
+		t.Errorf("failed = %v, want [%s Error]", failed, name)
+	}
+	if _, ok := fs.pods[name]; ok {
+		t.Errorf("failed pod %s isn't deleted", name)
+	}
+	if n, _ := fs.count(RoleTask); n != 3 {
+		t.Errorf("task pods = %d, want 3", n)
+	}
+	if n, _ := fs.count(RoleStandby); n != 1 {
+		t.Errorf("standby pods = %d, want 1", n)
+	}
+
+	if err := pl.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(fs.pods) != 0 {
+		t.Errorf("%d pods left", len(fs.pods))
+	}
+}
@@ -0,0 +1,153 @@
+package kube
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Placement tells which pods run a job.
+type Placement struct {
+	Job string
+	// pods of meritop-worker taking tasks, and standing by
+	Tasks    uint64
+	Standbys int
+	// image of meritop-worker, or of a binary taking the same flags
+	Image string
+	// flags of the workers besides those set through the environment, e.g.
+	// -compression snappy
+	Args     []string
+	EtcdURLs []string
+	EtcdAPI  string
+	// port workers serve the other nodes on, in their pods, any if 0
+	Port int
+}
+
+// Placer keeps the pods of a job running.
+type Placer struct {
+	client *Client
+	p      Placement
+	// OnFailure is called with the failed pods replaced by Reconcile, e.g.
+	// to log them.
+	OnFailure func(name, reason string)
+
+	mu sync.Mutex
+}
+
+// NewPlacer returns the placer of the job on the cluster of the client.
+func NewPlacer(c *Client, p Placement) *Placer {
+	return &Placer{
+		client: c,
+		p:      p,
+		OnFailure: func(name, reason string) {
+			log.Printf("kube: pod %s of job %s failed: %s", name, p.Job, reason)
+		},
+	}
+}
+
+// Reconcile creates the pods the job lacks, and replaces failed ones. Pods
+// which succeeded, i.e. whose worker exited as the job finished, aren't
+// replaced.
+func (pl *Placer) Reconcile() error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pods, err := pl.client.listPods(map[string]string{LabelJob: pl.p.Job})
+	if err != nil {
+		return err
+	}
+	have := make(map[string]int)
+	for _, p := range pods {
+		if p.Metadata.DeletionTimestamp != "" {
+			continue
+		}
+		if p.Status.Phase == PodFailed {
+			if err := pl.client.deletePod(p.Metadata.Name); err != nil {
+				return err
+			}
+			pl.OnFailure(p.Metadata.Name, failureReason(p.Status))
+			continue
+		}
+		have[p.Metadata.Labels[LabelRole]]++
+	}
+	for i := have[RoleTask]; uint64(i) < pl.p.Tasks; i++ {
+		if err := pl.create(RoleTask); err != nil {
+			return err
+		}
+	}
+	for i := have[RoleStandby]; i < pl.p.Standbys; i++ {
+		if err := pl.create(RoleStandby); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func failureReason(s podStatus) string {
+	switch {
+	case s.Reason != "" && s.Message != "":
+		return s.Reason + ": " + s.Message
+	case s.Reason != "":
+		return s.Reason
+	case s.Message != "":
+		return s.Message
+	}
+	return "unknown reason"
+}
+
+func (pl *Placer) create(role string) error {
+	args := pl.p.Args
+	if role == RoleStandby {
+		args = append([]string{"-standby"}, args...)
+	}
+	p := &pod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: objectMeta{
+			GenerateName: pl.p.Job + "-" + role + "-",
+			Labels:       map[string]string{LabelJob: pl.p.Job, LabelRole: role},
+		},
+		Spec: podSpec{
+			RestartPolicy: "Never",
+			Containers: []container{{
+				Name:  "worker",
+				Image: pl.p.Image,
+				Args:  args,
+				Env:   workerEnv(&pl.p),
+			}},
+		},
+	}
+	_, err := pl.client.createPod(p)
+	return err
+}
+
+// Run reconciles the pods of the job every interval, until stop is closed.
+func (pl *Placer) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := pl.Reconcile(); err != nil {
+			log.Printf("kube: reconciling pods of job %s failed: %v", pl.p.Job, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Remove deletes all pods of the job.
+func (pl *Placer) Remove() error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pods, err := pl.client.listPods(map[string]string{LabelJob: pl.p.Job})
+	if err != nil {
+		return err
+	}
+	for _, p := range pods {
+		if err := pl.client.deletePod(p.Metadata.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
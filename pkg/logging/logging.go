@@ -0,0 +1,153 @@
+/*
+Package logging is the leveled, structured logging used by the framework and
+the controller.
+
+A Logger carries fields, e.g. job and task, which are attached to every
+message it logs. Applications can plug in their own logging library through
+NewLeveled, or keep using the standard library through NewStd.
+*/
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+	Fatal
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "DEBUG"
+	case Info:
+		return "INFO"
+	case Warn:
+		return "WARN"
+	case Error:
+		return "ERROR"
+	case Fatal:
+		return "FATAL"
+	}
+	return "UNKNOWN"
+}
+
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// Fatalf logs at Error level or above and exits the process.
+	Fatalf(format string, args ...interface{})
+	// With returns a logger which attaches given field to all messages.
+	With(key string, value interface{}) Logger
+}
+
+// fields are kept in the order they are added, and formatted as key=value.
+type fields []string
+
+func (fs fields) with(key string, value interface{}) fields {
+	n := make(fields, len(fs), len(fs)+1)
+	copy(n, fs)
+	return append(n, fmt.Sprintf("%s=%v", key, value))
+}
+
+func (fs fields) format(format string, args []interface{}) string {
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	if len(fs) == 0 {
+		return msg
+	}
+	return strings.Join(fs, " ") + " " + msg
+}
+
+type stdLogger struct {
+	l      *log.Logger
+	level  Level
+	fields fields
+}
+
+// NewStd logs messages at given level or above to a standard library logger.
+func NewStd(l *log.Logger, level Level) Logger {
+	return &stdLogger{l: l, level: level}
+}
+
+// Default logs Info and above to stdout.
+func Default() Logger {
+	return NewStd(log.New(os.Stdout, "", log.Lshortfile|log.Ltime|log.Ldate), Info)
+}
+
+func (s *stdLogger) output(level Level, format string, args []interface{}) {
+	if level < s.level {
+		return
+	}
+	// skip output, the level method and the caller of Logger
+	s.l.Output(3, level.String()+" "+s.fields.format(format, args))
+}
+
+func (s *stdLogger) Debugf(format string, args ...interface{}) { s.output(Debug, format, args) }
+func (s *stdLogger) Infof(format string, args ...interface{})  { s.output(Info, format, args) }
+func (s *stdLogger) Warnf(format string, args ...interface{})  { s.output(Warn, format, args) }
+func (s *stdLogger) Errorf(format string, args ...interface{}) { s.output(Error, format, args) }
+
+func (s *stdLogger) Fatalf(format string, args ...interface{}) {
+	s.output(Fatal, format, args)
+	os.Exit(1)
+}
+
+func (s *stdLogger) With(key string, value interface{}) Logger {
+	return &stdLogger{l: s.l, level: s.level, fields: s.fields.with(key, value)}
+}
+
+// LeveledPrinter is implemented by most logging libraries, e.g. logrus
+// Logger and Entry, and zap SugaredLogger.
+type LeveledPrinter interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+type leveledLogger struct {
+	p      LeveledPrinter
+	fields fields
+}
+
+// NewLeveled adapts a logging library to Logger. Level filtering is left to
+// the library; fields are prepended to messages.
+func NewLeveled(p LeveledPrinter) Logger {
+	return &leveledLogger{p: p}
+}
+
+func (l *leveledLogger) Debugf(format string, args ...interface{}) {
+	l.p.Debugf("%s", l.fields.format(format, args))
+}
+
+func (l *leveledLogger) Infof(format string, args ...interface{}) {
+	l.p.Infof("%s", l.fields.format(format, args))
+}
+
+func (l *leveledLogger) Warnf(format string, args ...interface{}) {
+	l.p.Warnf("%s", l.fields.format(format, args))
+}
+
+func (l *leveledLogger) Errorf(format string, args ...interface{}) {
+	l.p.Errorf("%s", l.fields.format(format, args))
+}
+
+func (l *leveledLogger) Fatalf(format string, args ...interface{}) {
+	l.p.Fatalf("%s", l.fields.format(format, args))
+}
+
+func (l *leveledLogger) With(key string, value interface{}) Logger {
+	return &leveledLogger{p: l.p, fields: l.fields.with(key, value)}
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStd(log.New(&buf, "", 0), Info)
+	l.Debugf("hidden %d", 1)
+	task := l.With("job", "j").With("task", 3)
+	task.Infof("starting at epoch %d\n", 2)
+	task.With("epoch", 2).Warnf("epoch mismatch")
+	l.Errorf("no fields")
+
+	want := "INFO job=j task=3 starting at epoch 2\n" +
+		"WARN job=j task=3 epoch=2 epoch mismatch\n" +
+		"ERROR no fields\n"
+	if buf.String() != want {
+		t.Errorf("log want =\n%s\nget =\n%s", want, buf.String())
+	}
+}
+
+type fakePrinter struct{ lines []string }
+
+func (p *fakePrinter) printf(level, format string, args []interface{}) {
+	p.lines = append(p.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (p *fakePrinter) Debugf(format string, args ...interface{}) { p.printf("D", format, args) }
+func (p *fakePrinter) Infof(format string, args ...interface{})  { p.printf("I", format, args) }
+func (p *fakePrinter) Warnf(format string, args ...interface{})  { p.printf("W", format, args) }
+func (p *fakePrinter) Errorf(format string, args ...interface{}) { p.printf("E", format, args) }
+func (p *fakePrinter) Fatalf(format string, args ...interface{}) { p.printf("F", format, args) }
+
+func TestLeveledLogger(t *testing.T) {
+	p := new(fakePrinter)
+	l := NewLeveled(p)
+	l.With("task", 1).Debugf("a %s", "b")
+	// fields must not leak between loggers derived from the same one
+	base := l.With("job", "j")
+	base.With("task", 1).Infof("c")
+	base.With("task", 2).Errorf("100%%")
+
+	want := []string{"D task=1 a b", "I job=j task=1 c", "E job=j task=2 100%"}
+	if fmt.Sprint(p.lines) != fmt.Sprint(want) {
+		t.Errorf("lines want = %q, get = %q", want, p.lines)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Package membudget caps the memory of the buffers held by framework nodes, e.g.
+data received from other tasks until DataReady takes it, so that their
+overhead stays bounded on memory-constrained hosts. A Budget is usually
+shared by all nodes of a process, see framework.WithMemoryBudget.
+*/
+package membudget
+
+import (
+	"sync"
+
+	"github.com/go-distributed/meritop/pkg/metrics"
+)
+
+// Budget accounts bytes against a limit. A nil Budget has no limit and
+// accounts nothing.
+type Budget struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+	// closed on release, waking up waiting acquisitions
+	released chan struct{}
+
+	usedGauge  metrics.Gauge
+	limitGauge metrics.Gauge
+	peak       metrics.Gauge
+	waits      metrics.Counter
+	rejections metrics.Counter
+}
+
+// New returns a budget of limit bytes, or without limit if it is zero.
+func New(limit int64) *Budget {
+	b := &Budget{limit: limit, released: make(chan struct{})}
+	b.limitGauge.Set(limit)
+	return b
+}
+
+// fits tells whether n more bytes fit. A buffer bigger than the limit fits
+// once nothing else is held, so that it isn't held back forever.
+func (b *Budget) fits(n int64) bool {
+	return b.limit == 0 || b.used == 0 || b.used+n <= b.limit
+}
+
+func (b *Budget) take(n int64) {
+	b.used += n
+	b.usedGauge.Set(b.used)
+	if b.used > b.peak.Value() {
+		b.peak.Set(b.used)
+	}
+}
+
+// TryAcquire accounts n bytes if they fit, and tells whether they did.
+func (b *Budget) TryAcquire(n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.fits(n) {
+		b.rejections.Inc()
+		return false
+	}
+	b.take(n)
+	return true
+}
+
+// Acquire accounts n bytes, waiting until they fit. It gives up and returns
+// false once cancel is closed.
+func (b *Budget) Acquire(n int64, cancel <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+	waited := false
+	for {
+		b.mu.Lock()
+		if b.fits(n) {
+			b.take(n)
+			b.mu.Unlock()
+			return true
+		}
+		released := b.released
+		b.mu.Unlock()
+		if !waited {
+			waited = true
+			b.waits.Inc()
+		}
+		select {
+		case <-released:
+		case <-cancel:
+			b.rejections.Inc()
+			return false
+		}
+	}
+}
+
+// Release gives back n bytes acquired before.
+func (b *Budget) Release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.usedGauge.Set(b.used)
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// Used returns the bytes accounted.
+func (b *Budget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Register exports the accounting of the budget to the registry. A budget
+// shared by the nodes of a process is exported by each of them.
+func (b *Budget) Register(r *metrics.Registry) {
+	r.RegisterGauge("meritop_memory_used_bytes", "Bytes of framework buffers held in the memory budget.", &b.usedGauge)
+	r.RegisterGauge("meritop_memory_peak_bytes", "Most bytes of framework buffers held in the memory budget at once.", &b.peak)
+	r.RegisterGauge("meritop_memory_limit_bytes", "Limit of the memory budget, none if 0.", &b.limitGauge)
+	r.RegisterCounter("meritop_memory_waits_total", "Buffers which waited for room in the memory budget.", &b.waits)
+	r.RegisterCounter("meritop_memory_rejections_total", "Buffers turned away or dropped for want of room in the memory budget.", &b.rejections)
+}
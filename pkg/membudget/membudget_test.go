@@ -0,0 +1,64 @@
+package membudget
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-distributed/meritop/pkg/metrics"
+)
+
+func TestBudget(t *testing.T) {
+	b := New(10)
+	if !b.TryAcquire(6) || b.TryAcquire(5) {
+		t.Fatalf("TryAcquire of 6 then 5 bytes of 10 = (false, true) or worse")
+	}
+	acquired := make(chan bool, 1)
+	go func() { acquired <- b.Acquire(5, nil) }()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire didn't wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.Release(6)
+	if ok := <-acquired; !ok || b.Used() != 5 {
+		t.Errorf("Acquire after release = %v, used %d, want true, 5", ok, b.Used())
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if b.Acquire(6, cancel) {
+		t.Errorf("canceled Acquire succeeded")
+	}
+	b.Release(5)
+	// A buffer bigger than the limit gets in once nothing else is held.
+	if !b.TryAcquire(20) {
+		t.Errorf("TryAcquire of 20 bytes of an empty budget of 10 failed")
+	}
+	b.Release(20)
+
+	r := metrics.NewRegistry(nil)
+	b.Register(r)
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	for _, want := range []string{
+		"meritop_memory_used_bytes 0",
+		"meritop_memory_peak_bytes 20",
+		"meritop_memory_limit_bytes 10",
+		"meritop_memory_waits_total 2",
+		"meritop_memory_rejections_total 2",
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("metrics don't have %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestNilBudget(t *testing.T) {
+	var b *Budget
+	if !b.TryAcquire(1<<40) || !b.Acquire(1<<40, nil) || b.Used() != 0 {
+		t.Errorf("nil budget limits or accounts")
+	}
+	b.Release(1 << 40)
+}
@@ -0,0 +1,178 @@
+/*
+Package metrics keeps counters and gauges of a process and exports them in the
+Prometheus text format, so that they can be scraped without pulling in a
+metrics client library.
+
+Each process, e.g. a framework node or a controller, has one Registry. Labels
+given to the registry, e.g. job and task, are attached to all its metrics.
+*/
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter only goes up, e.g. number of requests served.
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Inc()          { c.Add(1) }
+func (c *Counter) Add(n uint64)  { atomic.AddUint64(&c.v, n) }
+func (c *Counter) Value() uint64 { return atomic.LoadUint64(&c.v) }
+
+// Gauge goes up and down, e.g. number of pending requests.
+type Gauge struct {
+	v int64
+}
+
+func (g *Gauge) Set(v int64)  { atomic.StoreInt64(&g.v, v) }
+func (g *Gauge) Add(n int64)  { atomic.AddInt64(&g.v, n) }
+func (g *Gauge) Value() int64 { return atomic.LoadInt64(&g.v) }
+
+// CounterVec is counters told apart by the value of a label, e.g. errors by
+// etcd endpoint.
+type CounterVec struct {
+	label string
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{label: label, counters: make(map[string]*Counter)}
+}
+
+// With returns the counter of given label value, creating it if needed.
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[value]
+	if !ok {
+		c = new(Counter)
+		v.counters[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) values() map[string]uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	values := make(map[string]uint64, len(v.counters))
+	for k, c := range v.counters {
+		values[k] = c.Value()
+	}
+	return values
+}
+
+type metric struct {
+	name, help, kind string
+	value            func() string
+	vec              *CounterVec
+}
+
+type Registry struct {
+	// label pairs, e.g. job="a", sorted
+	pairs  []string
+	labels string
+
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry creates a registry whose metrics all carry given labels.
+func NewRegistry(labels map[string]string) *Registry {
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(pairs)
+	r := &Registry{pairs: pairs}
+	if len(pairs) > 0 {
+		r.labels = "{" + strings.Join(pairs, ",") + "}"
+	}
+	return r
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, old := range r.metrics {
+		if old.name == m.name {
+			panic("metrics: duplicate metric " + m.name)
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// NewCounter creates and registers a counter. By Prometheus convention, its
+// name should end with "_total".
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := new(Counter)
+	r.RegisterCounter(name, help, c)
+	return c
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := new(Gauge)
+	r.RegisterGauge(name, help, g)
+	return g
+}
+
+// RegisterCounter exports an existing counter, e.g. one embedded in a struct
+// which is usable before any registry is set up.
+func (r *Registry) RegisterCounter(name, help string, c *Counter) {
+	r.add(metric{name, help, "counter", func() string { return fmt.Sprint(c.Value()) }, nil})
+}
+
+// RegisterCounterVec exports the counters of v, one sample per label value.
+func (r *Registry) RegisterCounterVec(name, help string, v *CounterVec) {
+	r.add(metric{name: name, help: help, kind: "counter", vec: v})
+}
+
+func (r *Registry) RegisterGauge(name, help string, g *Gauge) {
+	r.add(metric{name, help, "gauge", func() string { return fmt.Sprint(g.Value()) }, nil})
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	ms := make([]metric, len(r.metrics))
+	copy(ms, r.metrics)
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, m := range ms {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", m.name, m.kind)
+		if m.vec == nil {
+			fmt.Fprintf(&buf, "%s%s %s\n", m.name, r.labels, m.value())
+			continue
+		}
+		values := m.vec.values()
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			pairs := append([]string{fmt.Sprintf("%s=%q", m.vec.label, k)}, r.pairs...)
+			sort.Strings(pairs)
+			fmt.Fprintf(&buf, "%s{%s} %d\n", m.name, strings.Join(pairs, ","), values[k])
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteTo(w)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry(map[string]string{"task": "3", "job": "j"})
+	c := r.NewCounter("requests_total", "Requests served.")
+	g := r.NewGauge("pending", "Pending requests.")
+	c.Add(5)
+	c.Inc()
+	g.Add(2)
+	g.Add(-3)
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{job="j",task="3"} 6
+# HELP pending Pending requests.
+# TYPE pending gauge
+pending{job="j",task="3"} -1
+`
+	if buf.String() != want {
+		t.Errorf("metrics want =\n%s\nget =\n%s", want, buf.String())
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := NewRegistry(nil)
+	r.NewCounter("a_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a duplicate metric should panic")
+		}
+	}()
+	r.NewGauge("a_total", "")
+}
+
+func TestRegistryCounterVec(t *testing.T) {
+	r := NewRegistry(map[string]string{"job": "j"})
+	v := NewCounterVec("endpoint")
+	r.RegisterCounterVec("errors_total", "Errors by endpoint.", v)
+	v.With("http://b").Add(2)
+	v.With("http://a").Inc()
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	want := `# HELP errors_total Errors by endpoint.
+# TYPE errors_total counter
+errors_total{endpoint="http://a",job="j"} 1
+errors_total{endpoint="http://b",job="j"} 2
+`
+	if buf.String() != want {
+		t.Errorf("metrics want =\n%s\nget =\n%s", want, buf.String())
+	}
+}
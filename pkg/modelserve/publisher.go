@@ -0,0 +1,133 @@
+/*
+Package modelserve lets the task holding model parameters publish them over a
+stable HTTP endpoint, so that online serving systems can hot load the latest
+model in the middle of training without speaking the internal task protocol.
+
+A typical parameter task creates a Publisher, registers it on the framework
+listener with framework.WithHTTPHandler(modelserve.DefaultPath, publisher), and
+calls Publish at the end of every epoch. Serving systems poll the endpoint with
+Fetch, which only downloads the model when its version changes.
+*/
+package modelserve
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPath = "/model"
+
+	// VersionHeader carries the version of the model in the response.
+	VersionHeader = "X-Meritop-Model-Version"
+)
+
+// Publisher is an http.Handler serving the latest published model.
+type Publisher struct {
+	mu        sync.RWMutex
+	published bool
+	version   uint64
+	model     []byte
+	modTime   time.Time
+}
+
+func NewPublisher() *Publisher {
+	return &Publisher{}
+}
+
+// Publish makes the given model the one being served. Models with a version
+// older than the one being served are ignored, so that a task recovering
+// from failure never rolls the serving model back.
+func (p *Publisher) Publish(version uint64, model []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.published && version < p.version {
+		return
+	}
+	p.published = true
+	p.version = version
+	p.model = model
+	p.modTime = time.Now()
+}
+
+// Version returns the version being served. ok is false if nothing has been
+// published yet.
+func (p *Publisher) Version() (version uint64, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.version, p.published
+}
+
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p.mu.RLock()
+	published, version, model, modTime := p.published, p.version, p.model, p.modTime
+	p.mu.RUnlock()
+
+	if !published {
+		http.Error(w, "no model has been published", http.StatusServiceUnavailable)
+		return
+	}
+	etag := versionETag(version)
+	h := w.Header()
+	h.Set(VersionHeader, strconv.FormatUint(version, 10))
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	h.Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.Itoa(len(model)))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(model)
+}
+
+func versionETag(version uint64) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(version, 10))
+}
+
+// Fetch gets the model published at url. If the served version equals
+// haveVersion, it returns changed == false without downloading the model.
+// Pass a negative haveVersion to always download.
+func Fetch(url string, haveVersion int64) (version uint64, model []byte, changed bool, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if haveVersion >= 0 {
+		req.Header.Set("If-None-Match", versionETag(uint64(haveVersion)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return uint64(haveVersion), nil, false, nil
+	default:
+		return 0, nil, false, fmt.Errorf("modelserve: unexpected status %q", resp.Status)
+	}
+	version, err = strconv.ParseUint(strings.TrimSpace(resp.Header.Get(VersionHeader)), 10, 64)
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("modelserve: bad version header: %v", err)
+	}
+	model, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	return version, model, true, nil
+}
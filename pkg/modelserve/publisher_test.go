@@ -0,0 +1,46 @@
+package modelserve
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPublisherFetch(t *testing.T) {
+	p := NewPublisher()
+	s := httptest.NewServer(p)
+	defer s.Close()
+
+	if _, _, _, err := Fetch(s.URL, -1); err == nil {
+		t.Fatal("Fetch before Publish should fail")
+	}
+
+	p.Publish(1, []byte("model-1"))
+	version, model, changed, err := Fetch(s.URL, -1)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if version != 1 || !changed || !reflect.DeepEqual(model, []byte("model-1")) {
+		t.Errorf("Fetch = (%d, %s, %v), want (1, model-1, true)", version, model, changed)
+	}
+
+	// Same version: nothing to download.
+	_, model, changed, err = Fetch(s.URL, 1)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if changed || model != nil {
+		t.Errorf("Fetch of unchanged version = (%s, %v), want (nil, false)", model, changed)
+	}
+
+	// Older versions never replace the served model.
+	p.Publish(3, []byte("model-3"))
+	p.Publish(2, []byte("model-2"))
+	version, model, changed, err = Fetch(s.URL, 1)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if version != 3 || !changed || !reflect.DeepEqual(model, []byte("model-3")) {
+		t.Errorf("Fetch = (%d, %s, %v), want (3, model-3, true)", version, model, changed)
+	}
+}
@@ -0,0 +1,235 @@
+package sandbox
+
+import (
+	"log"
+	"net/rpc"
+	"os"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// IsChild tells whether the process is the child of a sandbox, which is to
+// call Serve.
+func IsChild() bool { return os.Getenv(EnvSandbox) != "" }
+
+// Serve runs the task the node asks for, built by builder, until the node
+// closes the sandbox.
+func Serve(builder meritop.TaskBuilder) error {
+	logger := logging.NewStd(log.New(os.Stderr, "sandbox: ", log.LstdFlags), logging.Info)
+	fw := &framework{
+		client: rpc.NewClient(pipeConn{os.NewFile(6, "framework-in"), os.NewFile(5, "framework-out")}),
+		logger: logger,
+	}
+	defer fw.client.Close()
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Task", &taskService{builder: builder, framework: fw}); err != nil {
+		return err
+	}
+	srv.ServeConn(pipeConn{os.NewFile(3, "task-in"), os.NewFile(4, "task-out")})
+	return nil
+}
+
+// taskService serves the callbacks of the task to the node.
+type taskService struct {
+	builder   meritop.TaskBuilder
+	framework *framework
+	task      meritop.Task
+}
+
+func (s *taskService) Init(args InitArgs, _ *bool) error {
+	s.task = s.builder.GetTask(args.TaskID)
+	s.task.Init(args.TaskID, s.framework)
+	return nil
+}
+
+func (s *taskService) Exit(_ bool, _ *bool) error {
+	s.task.Exit()
+	return nil
+}
+
+func (s *taskService) SetEpoch(epoch uint64, _ *bool) error {
+	s.task.SetEpoch(epoch)
+	return nil
+}
+
+func (s *taskService) MetaReady(args MetaArgs, _ *bool) error {
+	s.task.MetaReady(args.FromID, args.LinkType, args.Meta)
+	return nil
+}
+
+func (s *taskService) DataReady(args DataArgs, _ *bool) error {
+	s.task.DataReady(args.FromID, args.LinkType, args.Req, args.Resp)
+	return nil
+}
+
+func (s *taskService) Serve(args DataArgs, resp *[]byte) error {
+	*resp = s.task.Serve(args.FromID, args.LinkType, args.Req)
+	return nil
+}
+
+func (s *taskService) Snapshot(_ bool, snapshot *[]byte) error {
+	if c, ok := s.task.(meritop.Checkpointer); ok {
+		*snapshot = c.Snapshot()
+	}
+	return nil
+}
+
+func (s *taskService) Restore(snapshot []byte, _ *bool) error {
+	if c, ok := s.task.(meritop.Checkpointer); ok {
+		c.Restore(snapshot)
+	}
+	return nil
+}
+
+// framework is the framework of the task in the child, calling the one of the
+// node.
+type framework struct {
+	client *rpc.Client
+	logger logging.Logger
+}
+
+var _ meritop.Framework = (*framework)(nil)
+
+func (f *framework) call(method string, args, reply interface{}) error {
+	if reply == nil {
+		reply = new(bool)
+	}
+	err := f.client.Call("Framework."+method, args, reply)
+	if err != nil {
+		f.logger.Errorf("framework call %s failed: %v", method, err)
+	}
+	return err
+}
+
+func (f *framework) FlagMeta(linkType, meta string) {
+	f.call("FlagMeta", MetaArgs{LinkType: linkType, Meta: meta}, nil)
+}
+
+func (f *framework) FlagMetaToParent(meta string) { f.FlagMeta(meritop.LinkParent, meta) }
+
+func (f *framework) FlagMetaToChild(meta string) { f.FlagMeta(meritop.LinkChild, meta) }
+
+func (f *framework) FlagMetaBroadcast(meta string) { f.call("FlagMetaBroadcast", meta, nil) }
+
+func (f *framework) GatherMeta(meta string) { f.call("GatherMeta", meta, nil) }
+
+func (f *framework) GetTopology() meritop.Topology { return &topology{f} }
+
+func (f *framework) ShutdownJob() { f.call("ShutdownJob", false, nil) }
+
+func (f *framework) FinishJob(result []byte) { f.call("FinishJob", result, nil) }
+
+func (f *framework) IncEpoch() { f.call("IncEpoch", false, nil) }
+
+func (f *framework) GetLogger() logging.Logger { return f.logger }
+
+func (f *framework) EnterBarrier(name string) { f.call("EnterBarrier", name, nil) }
+
+func (f *framework) DataRequest(toID uint64, req string) {
+	f.call("DataRequest", RequestArgs{ToID: toID, Req: []byte(req)}, nil)
+}
+
+func (f *framework) Handle(name string, h meritop.TypedHandler) { f.unsupported("Handle") }
+
+func (f *framework) TypedDataRequest(toID uint64, name string, arg interface{}) error {
+	return ErrUnsupported
+}
+
+func (f *framework) RegisterHandler(name string, h meritop.HandlerFunc) {
+	f.unsupported("RegisterHandler")
+}
+
+func (f *framework) Call(toID uint64, name string, args []byte) {
+	f.call("Call", RequestArgs{ToID: toID, Name: name, Req: args}, nil)
+}
+
+func (f *framework) Respond(requestID uint64, data []byte) {
+	f.call("Respond", RespondArgs{RequestID: requestID, Data: data}, nil)
+}
+
+func (f *framework) AllReduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (f *framework) Reduce(data []byte, reduce meritop.ReduceFunc) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (f *framework) Broadcast(data []byte) ([]byte, error) { return nil, ErrUnsupported }
+
+func (f *framework) SendMessage(toID uint64, payload []byte) {
+	f.call("SendMessage", RequestArgs{ToID: toID, Req: payload}, nil)
+}
+
+func (f *framework) GetJobConfig() map[string]string {
+	var config map[string]string
+	f.call("GetJobConfig", false, &config)
+	return config
+}
+
+func (f *framework) Push(toID uint64, payload []byte) {
+	f.call("Push", RequestArgs{ToID: toID, Req: payload}, nil)
+}
+
+func (f *framework) GetTaskID() uint64 {
+	var id uint64
+	f.call("GetTaskID", false, &id)
+	return id
+}
+
+func (f *framework) ReportProgress() { f.call("ReportProgress", false, nil) }
+
+func (f *framework) Publish(topic, data string) {
+	f.call("Publish", KeyValue{Key: topic, Value: data}, nil)
+}
+
+func (f *framework) Subscribe(topic string, handler func(data string)) { f.unsupported("Subscribe") }
+
+func (f *framework) Emit(record []byte) { f.call("Emit", record, nil) }
+
+func (f *framework) ExportArtifact(name, value string) {
+	f.call("ExportArtifact", KeyValue{Key: name, Value: value}, nil)
+}
+
+func (f *framework) AssignShards(shards map[uint64][]string) { f.call("AssignShards", shards, nil) }
+
+func (f *framework) RecordResult(key, value string) {
+	f.call("RecordResult", KeyValue{Key: key, Value: value}, nil)
+}
+
+func (f *framework) GetResults() map[string]string {
+	var results map[string]string
+	f.call("GetResults", false, &results)
+	return results
+}
+
+func (f *framework) unsupported(method string) {
+	f.logger.Errorf("framework call %s failed: %v", method, ErrUnsupported)
+}
+
+// topology is the topology of the task in the node.
+type topology struct {
+	f *framework
+}
+
+func (t *topology) SetTaskID(taskID uint64)            {}
+func (t *topology) SetNumberOfTasks(numOfTasks uint64) {}
+
+func (t *topology) GetLinkTypes() []string {
+	var types []string
+	t.f.call("GetLinkTypes", false, &types)
+	return types
+}
+
+func (t *topology) GetReverseLinkType(linkType string) string {
+	var reverse string
+	t.f.call("GetReverseLinkType", linkType, &reverse)
+	return reverse
+}
+
+func (t *topology) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	var ids []uint64
+	t.f.call("GetNeighbors", NeighborsArgs{LinkType: linkType, Epoch: epoch}, &ids)
+	return ids
+}
@@ -0,0 +1,91 @@
+/*
+Package sandbox runs the callbacks of a task in a child process supervised by
+the node, so that a crash of the task, e.g. a segfault in cgo-based ML code,
+kills only the child. The node restarts the child from the last snapshot of
+the task, and runs current epoch again, as a standby node taking over the
+task would.
+
+The child is usually the binary of the node started again, which calls Serve
+with the same task builder instead of bootstrapping when IsChild, e.g.
+meritop-worker -sandbox. Nodes run tasks in a sandbox with
+framework.WithSandbox.
+
+The node and the child talk the sidecar protocol: net/rpc with gob over two
+pairs of pipes, the child inheriting their ends as file descriptors 3 to 6.
+The node calls the "Task" service of the child (fds 3 and 4) for the
+callbacks of the task, and the child calls the "Framework" service of the
+node (fds 5 and 6) for the framework calls of the task. Framework calls
+taking functions, i.e. Handle, TypedDataRequest, RegisterHandler,
+AllReduce, Reduce, Broadcast and Subscribe, can't cross processes, and fail
+with ErrUnsupported in a sandbox. Of the optional task interfaces, only
+meritop.Checkpointer reaches the child.
+*/
+package sandbox
+
+import (
+	"errors"
+	"io"
+)
+
+// EnvSandbox is set in the environment of children.
+const EnvSandbox = "MERITOP_SANDBOX"
+
+// ErrUnsupported is returned by the framework calls a sandboxed task can't
+// make.
+var ErrUnsupported = errors.New("sandbox: framework call not supported in a sandbox")
+
+// Arguments of the calls of the Task service.
+type InitArgs struct {
+	TaskID uint64
+}
+
+type MetaArgs struct {
+	FromID   uint64
+	LinkType string
+	Meta     string
+}
+
+type DataArgs struct {
+	FromID   uint64
+	LinkType string
+	Req      string
+	Resp     []byte
+}
+
+// Arguments of the calls of the Framework service.
+type RequestArgs struct {
+	ToID uint64
+	Name string
+	Req  []byte
+}
+
+type RespondArgs struct {
+	RequestID uint64
+	Data      []byte
+}
+
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+type NeighborsArgs struct {
+	LinkType string
+	Epoch    uint64
+}
+
+// pipeConn is a connection over a pipe read from and a pipe written to.
+type pipeConn struct {
+	io.ReadCloser
+	w io.WriteCloser
+}
+
+func (c pipeConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c pipeConn) Close() error {
+	err := c.ReadCloser.Close()
+	if werr := c.w.Close(); err == nil {
+		err = werr
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package sandbox
+
+import (
+	"fmt"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/go-distributed/meritop"
+)
+
+// Config is how to start the children of a sandbox.
+type Config struct {
+	// Path and Args of the child, which is to call Serve.
+	Path string
+	Args []string
+	// MaxRestarts is how many times the child of a task is restarted before
+	// the node gives up on it. The default is 3.
+	MaxRestarts int
+}
+
+func (c Config) maxRestarts() int {
+	if c.MaxRestarts <= 0 {
+		return 3
+	}
+	return c.MaxRestarts
+}
+
+// NewTaskBuilder returns a task builder whose tasks run in a child started
+// with cfg.
+func NewTaskBuilder(cfg Config) meritop.TaskBuilder {
+	return &taskBuilder{cfg: cfg}
+}
+
+type taskBuilder struct {
+	cfg Config
+}
+
+func (b *taskBuilder) GetTask(taskID uint64) meritop.Task {
+	return &Task{cfg: b.cfg}
+}
+
+// Task is a task running in a child, which is restarted if it crashes. A
+// callback the child crashed in is dropped: the child is restarted from the
+// last snapshot of the task and runs current epoch again instead.
+type Task struct {
+	cfg       Config
+	taskID    uint64
+	framework meritop.Framework
+
+	mu       sync.Mutex
+	child    *child
+	restarts int
+	exited   bool
+	epoch    uint64
+	epochSet bool
+	// last snapshot taken or restored, from which the child restarts
+	snapshot []byte
+}
+
+// child is a started child process, and the ends of the pipes to it.
+type child struct {
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+func (t *Task) Init(taskID uint64, framework meritop.Framework) {
+	t.taskID, t.framework = taskID, framework
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.restartLocked(nil)
+}
+
+func (t *Task) Exit() {
+	t.call("Exit", false, nil)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exited = true
+	if t.child != nil {
+		t.child.stop()
+		t.child = nil
+	}
+}
+
+func (t *Task) SetEpoch(epoch uint64) {
+	t.mu.Lock()
+	t.epoch, t.epochSet = epoch, true
+	t.mu.Unlock()
+	t.call("SetEpoch", epoch, nil)
+}
+
+func (t *Task) MetaReady(fromID uint64, linkType, meta string) {
+	t.call("MetaReady", MetaArgs{FromID: fromID, LinkType: linkType, Meta: meta}, nil)
+}
+
+func (t *Task) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	t.call("DataReady", DataArgs{FromID: fromID, LinkType: linkType, Req: req, Resp: resp}, nil)
+}
+
+func (t *Task) Serve(fromID uint64, linkType, req string) []byte {
+	var resp []byte
+	t.call("Serve", DataArgs{FromID: fromID, LinkType: linkType, Req: req}, &resp)
+	return resp
+}
+
+// Snapshot returns the snapshot of the task if it is a Checkpointer, and nil
+// otherwise.
+func (t *Task) Snapshot() []byte {
+	var snapshot []byte
+	if err := t.call("Snapshot", false, &snapshot); err != nil {
+		// The restarted child has the last snapshot.
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.snapshot
+	}
+	t.mu.Lock()
+	t.snapshot = snapshot
+	t.mu.Unlock()
+	return snapshot
+}
+
+func (t *Task) Restore(snapshot []byte) {
+	t.mu.Lock()
+	t.snapshot = snapshot
+	t.mu.Unlock()
+	t.call("Restore", snapshot, nil)
+}
+
+// call calls the Task service of the child, and restarts the child if it
+// crashed.
+func (t *Task) call(method string, args, reply interface{}) error {
+	t.mu.Lock()
+	c := t.child
+	t.mu.Unlock()
+	if c == nil {
+		return rpc.ErrShutdown
+	}
+	if reply == nil {
+		reply = new(bool)
+	}
+	err := c.client.Call("Task."+method, args, reply)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(rpc.ServerError); ok {
+		t.framework.GetLogger().Errorf("sandbox of task %d failed %s: %v", t.taskID, method, err)
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Another callback might have restarted the child already.
+	if t.child == c && !t.exited {
+		t.framework.GetLogger().Warnf("sandbox of task %d crashed in %s: %v", t.taskID, method, err)
+		t.restartLocked(c)
+	}
+	return err
+}
+
+// restartLocked stops old, if any, and starts a child in the state of the
+// task: initialized, restored from the last snapshot, and at current epoch.
+func (t *Task) restartLocked(old *child) {
+	for {
+		if old != nil {
+			old.stop()
+			t.restarts++
+			if t.restarts > t.cfg.maxRestarts() {
+				t.framework.GetLogger().Fatalf("sandbox of task %d crashed %d times", t.taskID, t.restarts)
+				return
+			}
+		}
+		c, err := startChild(t.cfg, t.framework)
+		if err != nil {
+			t.framework.GetLogger().Fatalf("sandbox of task %d failed to start: %v", t.taskID, err)
+			return
+		}
+		t.child = c
+		if err = c.restore(t); err == nil {
+			return
+		}
+		t.framework.GetLogger().Warnf("sandbox of task %d crashed restarting: %v", t.taskID, err)
+		old = c
+	}
+}
+
+func (c *child) restore(t *Task) error {
+	if err := c.client.Call("Task.Init", InitArgs{TaskID: t.taskID}, new(bool)); err != nil {
+		return err
+	}
+	if t.snapshot != nil {
+		if err := c.client.Call("Task.Restore", t.snapshot, new(bool)); err != nil {
+			return err
+		}
+	}
+	if t.epochSet {
+		return c.client.Call("Task.SetEpoch", t.epoch, new(bool))
+	}
+	return nil
+}
+
+func startChild(cfg Config, fw meritop.Framework) (*child, error) {
+	// Requests to the task, responses of the task, requests to the framework
+	// and responses of the framework.
+	var ends [8]*os.File
+	for i := 0; i < len(ends); i += 2 {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeFiles(ends[:i])
+			return nil, err
+		}
+		ends[i], ends[i+1] = r, w
+	}
+	taskReqR, taskReqW, taskRespR, taskRespW := ends[0], ends[1], ends[2], ends[3]
+	fwReqR, fwReqW, fwRespR, fwRespW := ends[4], ends[5], ends[6], ends[7]
+
+	cmd := exec.Command(cfg.Path, cfg.Args...)
+	cmd.Env = append(os.Environ(), EnvSandbox+"=1")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{taskReqR, taskRespW, fwReqW, fwRespR}
+	err := cmd.Start()
+	closeFiles(cmd.ExtraFiles)
+	if err != nil {
+		closeFiles([]*os.File{taskReqW, taskRespR, fwReqR, fwRespW})
+		return nil, fmt.Errorf("sandbox: %v", err)
+	}
+
+	srv := rpc.NewServer()
+	srv.RegisterName("Framework", &frameworkService{fw})
+	go srv.ServeConn(pipeConn{fwReqR, fwRespW})
+	client := rpc.NewClient(pipeConn{taskRespR, taskReqW})
+	return &child{cmd: cmd, client: client}, nil
+}
+
+// stop closes the pipes to the child, which makes it exit, and kills it in
+// case it hangs in a callback.
+func (c *child) stop() {
+	c.client.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
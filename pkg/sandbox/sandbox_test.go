@@ -0,0 +1,106 @@
+package sandbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/pkg/logging"
+)
+
+// TestHelperProcess is the child of the sandbox of TestSandboxRestart.
+func TestHelperProcess(t *testing.T) {
+	if !IsChild() {
+		return
+	}
+	if err := Serve(testTaskBuilder{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestSandboxRestart(t *testing.T) {
+	fw := &testFramework{logger: logging.NewStd(log.New(ioutil.Discard, "", 0), logging.Info)}
+	task := NewTaskBuilder(Config{Path: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}}).GetTask(1)
+	task.Init(1, fw)
+	defer task.Exit()
+
+	task.SetEpoch(1)
+	task.DataReady(0, meritop.LinkParent, "add", []byte("x"))
+	snapshot := task.(meritop.Checkpointer).Snapshot()
+	if string(snapshot) != "x" {
+		t.Fatalf("snapshot = %q, want %q", snapshot, "x")
+	}
+	task.DataReady(0, meritop.LinkParent, "add", []byte("y"))
+	if resp := task.Serve(0, meritop.LinkChild, "state"); string(resp) != "xy" {
+		t.Fatalf("state = %q, want %q", resp, "xy")
+	}
+
+	// The child crashes, and is restarted from the snapshot at epoch 1.
+	task.DataReady(0, meritop.LinkParent, "crash", nil)
+	if resp := task.Serve(0, meritop.LinkChild, "state"); string(resp) != "x" {
+		t.Fatalf("state after restart = %q, want %q", resp, "x")
+	}
+	want := []string{"1: ", "1: x"}
+	if metas := fw.getMetas(); !reflect.DeepEqual(metas, want) {
+		t.Fatalf("metas = %v, want %v", metas, want)
+	}
+}
+
+// testTask keeps the responses it is added, and crashes when asked to.
+type testTask struct {
+	framework meritop.Framework
+	state     string
+}
+
+type testTaskBuilder struct{}
+
+func (testTaskBuilder) GetTask(taskID uint64) meritop.Task { return &testTask{} }
+
+func (t *testTask) Init(taskID uint64, framework meritop.Framework) { t.framework = framework }
+func (t *testTask) Exit()                                           {}
+func (t *testTask) MetaReady(fromID uint64, linkType, meta string)  {}
+
+func (t *testTask) SetEpoch(epoch uint64) {
+	t.framework.FlagMetaToParent(fmt.Sprintf("%d: %s", epoch, t.state))
+}
+
+func (t *testTask) DataReady(fromID uint64, linkType, req string, resp []byte) {
+	if req == "crash" {
+		os.Exit(2)
+	}
+	t.state += string(resp)
+}
+
+func (t *testTask) Serve(fromID uint64, linkType, req string) []byte { return []byte(t.state) }
+func (t *testTask) Snapshot() []byte                                 { return []byte(t.state) }
+func (t *testTask) Restore(snapshot []byte)                          { t.state = string(snapshot) }
+
+// testFramework records the metas flagged by the task.
+type testFramework struct {
+	meritop.Framework
+	logger logging.Logger
+
+	mu    sync.Mutex
+	metas []string
+}
+
+func (f *testFramework) GetLogger() logging.Logger { return f.logger }
+
+func (f *testFramework) FlagMeta(linkType, meta string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metas = append(f.metas, meta)
+}
+
+func (f *testFramework) getMetas() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.metas...)
+}
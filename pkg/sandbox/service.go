@@ -0,0 +1,129 @@
+package sandbox
+
+import "github.com/go-distributed/meritop"
+
+// frameworkService serves the framework calls of a task in a child with the
+// framework of the node.
+type frameworkService struct {
+	fw meritop.Framework
+}
+
+func (s *frameworkService) FlagMeta(args MetaArgs, _ *bool) error {
+	s.fw.FlagMeta(args.LinkType, args.Meta)
+	return nil
+}
+
+func (s *frameworkService) FlagMetaBroadcast(meta string, _ *bool) error {
+	s.fw.FlagMetaBroadcast(meta)
+	return nil
+}
+
+func (s *frameworkService) GatherMeta(meta string, _ *bool) error {
+	s.fw.GatherMeta(meta)
+	return nil
+}
+
+func (s *frameworkService) ShutdownJob(_ bool, _ *bool) error {
+	s.fw.ShutdownJob()
+	return nil
+}
+
+func (s *frameworkService) FinishJob(result []byte, _ *bool) error {
+	s.fw.FinishJob(result)
+	return nil
+}
+
+func (s *frameworkService) IncEpoch(_ bool, _ *bool) error {
+	s.fw.IncEpoch()
+	return nil
+}
+
+func (s *frameworkService) EnterBarrier(name string, _ *bool) error {
+	s.fw.EnterBarrier(name)
+	return nil
+}
+
+func (s *frameworkService) DataRequest(args RequestArgs, _ *bool) error {
+	s.fw.DataRequest(args.ToID, string(args.Req))
+	return nil
+}
+
+func (s *frameworkService) Call(args RequestArgs, _ *bool) error {
+	s.fw.Call(args.ToID, args.Name, args.Req)
+	return nil
+}
+
+func (s *frameworkService) Respond(args RespondArgs, _ *bool) error {
+	s.fw.Respond(args.RequestID, args.Data)
+	return nil
+}
+
+func (s *frameworkService) SendMessage(args RequestArgs, _ *bool) error {
+	s.fw.SendMessage(args.ToID, args.Req)
+	return nil
+}
+
+func (s *frameworkService) GetJobConfig(_ bool, config *map[string]string) error {
+	*config = s.fw.GetJobConfig()
+	return nil
+}
+
+func (s *frameworkService) Push(args RequestArgs, _ *bool) error {
+	s.fw.Push(args.ToID, args.Req)
+	return nil
+}
+
+func (s *frameworkService) GetTaskID(_ bool, id *uint64) error {
+	*id = s.fw.GetTaskID()
+	return nil
+}
+
+func (s *frameworkService) ReportProgress(_ bool, _ *bool) error {
+	s.fw.ReportProgress()
+	return nil
+}
+
+func (s *frameworkService) Publish(args KeyValue, _ *bool) error {
+	s.fw.Publish(args.Key, args.Value)
+	return nil
+}
+
+func (s *frameworkService) Emit(record []byte, _ *bool) error {
+	s.fw.Emit(record)
+	return nil
+}
+
+func (s *frameworkService) ExportArtifact(args KeyValue, _ *bool) error {
+	s.fw.ExportArtifact(args.Key, args.Value)
+	return nil
+}
+
+func (s *frameworkService) AssignShards(shards map[uint64][]string, _ *bool) error {
+	s.fw.AssignShards(shards)
+	return nil
+}
+
+func (s *frameworkService) RecordResult(args KeyValue, _ *bool) error {
+	s.fw.RecordResult(args.Key, args.Value)
+	return nil
+}
+
+func (s *frameworkService) GetResults(_ bool, results *map[string]string) error {
+	*results = s.fw.GetResults()
+	return nil
+}
+
+func (s *frameworkService) GetLinkTypes(_ bool, types *[]string) error {
+	*types = s.fw.GetTopology().GetLinkTypes()
+	return nil
+}
+
+func (s *frameworkService) GetReverseLinkType(linkType string, reverse *string) error {
+	*reverse = s.fw.GetTopology().GetReverseLinkType(linkType)
+	return nil
+}
+
+func (s *frameworkService) GetNeighbors(args NeighborsArgs, ids *[]uint64) error {
+	*ids = s.fw.GetTopology().GetNeighbors(args.LinkType, args.Epoch)
+	return nil
+}
@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileSource tails files being appended, e.g. logs, one partition per file.
+// Records are lines, and offsets are byte offsets. A line is read once it
+// ends with a newline. Files which don't exist yet have no records; files
+// must not be truncated or rotated.
+type FileSource struct {
+	Paths []string
+}
+
+func (s *FileSource) Partitions() (int32, error) { return int32(len(s.Paths)), nil }
+
+func (s *FileSource) Read(partition int32, offset int64, max int) ([]Record, int64, error) {
+	if partition < 0 || int(partition) >= len(s.Paths) {
+		return nil, offset, fmt.Errorf("no partition %d", partition)
+	}
+	f, err := os.Open(s.Paths[partition])
+	if os.IsNotExist(err) {
+		return nil, offset, nil
+	}
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, 0); err != nil {
+		return nil, offset, err
+	}
+	var records []Record
+	br := bufio.NewReader(f)
+	for len(records) < max {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial line is still being written.
+			break
+		}
+		if err != nil {
+			return nil, offset, err
+		}
+		records = append(records, Record{
+			Partition: partition,
+			Offset:    offset,
+			Value:     bytes.TrimSuffix(line, []byte{'\n'}),
+		})
+		offset += int64(len(line))
+	}
+	return records, offset, nil
+}
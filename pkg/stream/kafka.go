@@ -0,0 +1,34 @@
+package stream
+
+// KafkaClient is the part of a Kafka client KafkaSource uses, e.g. built on
+// github.com/Shopify/sarama, so that meritop doesn't depend on any client.
+// Offsets are Kafka offsets: the reader keeps them in the snapshots of tasks
+// rather than committing them for a consumer group.
+type KafkaClient interface {
+	// Partitions returns the number of partitions of the topic.
+	Partitions(topic string) (int32, error)
+	// Fetch returns up to max messages of the partition from the offset on,
+	// without waiting for more. Offsets of messages may have gaps, e.g. in
+	// compacted topics.
+	Fetch(topic string, partition int32, offset int64, max int) ([]Record, error)
+}
+
+// KafkaSource reads a Kafka topic, whose partitions are assigned to the tasks
+// of the job as by a consumer group whose members are the tasks.
+type KafkaSource struct {
+	Client KafkaClient
+	Topic  string
+}
+
+func (s *KafkaSource) Partitions() (int32, error) { return s.Client.Partitions(s.Topic) }
+
+func (s *KafkaSource) Read(partition int32, offset int64, max int) ([]Record, int64, error) {
+	records, err := s.Client.Fetch(s.Topic, partition, offset, max)
+	if err != nil {
+		return nil, offset, err
+	}
+	if len(records) > 0 {
+		offset = records[len(records)-1].Offset + 1
+	}
+	return records, offset, nil
+}
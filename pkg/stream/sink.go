@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Sink takes the results tasks emit at each epoch, e.g. metrics or
+// predictions. The framework writes the results of an epoch once it is over
+// (see framework.WithSink). Writes must be idempotent by task and epoch:
+// after failover, the epochs since the last snapshot run again, and their
+// results are written again.
+type Sink interface {
+	Write(taskID, epoch uint64, records [][]byte) error
+}
+
+// NewSink returns the sink of a URL: file:///dir for a FileSink, or an http
+// or https URL for an HTTPSink.
+func NewSink(rawurl string) (Sink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return &FileSink{Dir: u.Path}, nil
+	case "http", "https":
+		return &HTTPSink{URL: rawurl}, nil
+	}
+	return nil, fmt.Errorf("stream: unknown sink %q", rawurl)
+}
+
+// FileSink writes the results of each task and epoch as lines of the file
+// {Dir}/{epoch}/{taskID}, replacing it if it is written again.
+type FileSink struct {
+	Dir string
+}
+
+func (s *FileSink) Write(taskID, epoch uint64, records [][]byte) error {
+	dir := filepath.Join(s.Dir, strconv.FormatUint(epoch, 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := strconv.FormatUint(taskID, 10)
+	tmp, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	var lines bytes.Buffer
+	for _, r := range records {
+		lines.Write(r)
+		lines.WriteByte('\n')
+	}
+	if _, err := tmp.Write(lines.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// Headers of the requests of HTTPSink, by which the endpoint drops results
+// written again.
+const (
+	HeaderTask  = "X-Meritop-Task"
+	HeaderEpoch = "X-Meritop-Epoch"
+)
+
+// HTTPSink posts the results of each task and epoch as lines to URL.
+type HTTPSink struct {
+	URL string
+	// http.DefaultClient if nil
+	Client *http.Client
+}
+
+func (s *HTTPSink) Write(taskID, epoch uint64, records [][]byte) error {
+	var body bytes.Buffer
+	for _, r := range records {
+		body.Write(r)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest("POST", s.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set(HeaderTask, strconv.FormatUint(taskID, 10))
+	req.Header.Set(HeaderEpoch, strconv.FormatUint(epoch, 10))
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("stream: %s responds %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// KafkaProducer is the part of a Kafka client KafkaSink uses.
+type KafkaProducer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// KafkaSink produces the results to a topic, keyed by
+// {taskID}-{epoch}-{index}, so that results written again replace the others
+// in compacted topics, or are told apart by consumers.
+type KafkaSink struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+func (s *KafkaSink) Write(taskID, epoch uint64, records [][]byte) error {
+	for i, r := range records {
+		key := fmt.Sprintf("%d-%d-%d", taskID, epoch, i)
+		if err := s.Producer.Produce(s.Topic, []byte(key), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
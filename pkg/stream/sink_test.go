@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewSink("file://" + dir)
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+	if err := s.Write(3, 7, [][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// Written again after failover.
+	if err := s.Write(3, 7, [][]byte{[]byte("a2")}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "7", "3"))
+	if err != nil || string(b) != "a2\n" {
+		t.Errorf("file = (%q, %v), want a2", b, err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "7"))
+	if len(files) != 1 {
+		t.Errorf("files = %d, want 1", len(files))
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var task, epoch, body string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		task, epoch = r.Header.Get(HeaderTask), r.Header.Get(HeaderEpoch)
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	s, err := NewSink(ts.URL)
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+	if err := s.Write(1, 2, [][]byte{[]byte("x"), []byte("y")}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if task != "1" || epoch != "2" || body != "x\ny\n" {
+		t.Errorf("request = (%s, %s, %q), want (1, 2, \"x\\ny\\n\")", task, epoch, body)
+	}
+	status = http.StatusServiceUnavailable
+	if err := s.Write(1, 2, nil); err == nil {
+		t.Errorf("Write succeeded with status %d", status)
+	}
+	if _, err := NewSink("ftp://host/results"); err == nil {
+		t.Errorf("NewSink of ftp succeeded")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Package stream feeds records of external streams, e.g. Kafka topics or files
+being appended, to tasks of streaming jobs epoch by epoch.
+
+A stream is split into partitions, which are assigned to the tasks of the job
+by task ID (see Assign), so that the node taking over a failed task reads the
+same partitions. A task reads the records which arrived during the last epoch
+at the start of each epoch, and keeps the offsets it has read up to in its
+snapshots, so that failover neither processes records twice nor loses any:
+
+	func (t *task) Init(taskID uint64, fw meritop.Framework) {
+		t.reader, err = stream.NewReader(&stream.FileSource{Paths: paths}, taskID, numOfTasks)
+		...
+	}
+	func (t *task) SetEpoch(epoch uint64) {
+		records, err := t.reader.Next(1000)
+		...
+	}
+	func (t *task) Snapshot() []byte { return t.reader.Snapshot(t.state()) }
+	func (t *task) Restore(snapshot []byte) {
+		state, err := t.reader.Restore(snapshot)
+		...
+	}
+
+Records read in an epoch are processed in it, and the snapshot taken at the
+end of the epoch covers both their effect and their offsets.
+
+The other way, tasks emit their results, e.g. metrics or predictions, with
+meritop.Framework.Emit to a Sink: a Kafka topic, files or an HTTP endpoint.
+The framework writes the results of an epoch once it is over, before the
+snapshot of the next one.
+*/
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Record is a record of a partition of a stream.
+type Record struct {
+	Partition int32
+	Offset    int64
+	Value     []byte
+}
+
+// Source is a stream split into partitions numbered from 0.
+type Source interface {
+	Partitions() (int32, error)
+	// Read returns up to max records of the partition from the offset on,
+	// without waiting for more, and the offset following them.
+	Read(partition int32, offset int64, max int) ([]Record, int64, error)
+}
+
+// Assign returns the partitions read by the task: partition p goes to task p
+// modulo the number of tasks. Unlike with Kafka consumer groups, partitions
+// don't move between tasks on failover. The number of tasks must not change
+// while the job runs.
+func Assign(taskID, numOfTasks uint64, partitions int32) []int32 {
+	var assigned []int32
+	for p := int32(0); p < partitions; p++ {
+		if uint64(p)%numOfTasks == taskID {
+			assigned = append(assigned, p)
+		}
+	}
+	return assigned
+}
+
+// Reader reads the partitions of a source assigned to a task, from the
+// offsets it has read up to.
+type Reader struct {
+	src     Source
+	offsets map[int32]int64
+}
+
+// NewReader returns a reader of the partitions assigned to the task, from
+// their beginning unless restored.
+func NewReader(src Source, taskID, numOfTasks uint64) (*Reader, error) {
+	n, err := src.Partitions()
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{src: src, offsets: make(map[int32]int64)}
+	for _, p := range Assign(taskID, numOfTasks, n) {
+		r.offsets[p] = 0
+	}
+	return r, nil
+}
+
+// Partitions returns the partitions read, in order.
+func (r *Reader) Partitions() []int32 {
+	var ps []int32
+	for p := range r.offsets {
+		ps = append(ps, p)
+	}
+	sort.Sort(byPartition(ps))
+	return ps
+}
+
+// Next returns the records which arrived since the last call, up to max of
+// each partition, and moves past them. On error, no offset moves.
+func (r *Reader) Next(max int) ([]Record, error) {
+	var records []Record
+	next := make(map[int32]int64)
+	for _, p := range r.Partitions() {
+		rs, offset, err := r.src.Read(p, r.offsets[p], max)
+		if err != nil {
+			return nil, fmt.Errorf("stream: read partition %d: %v", p, err)
+		}
+		records = append(records, rs...)
+		next[p] = offset
+	}
+	for p, offset := range next {
+		r.offsets[p] = offset
+	}
+	return records, nil
+}
+
+// Offset returns the offset the partition is read from next.
+func (r *Reader) Offset(partition int32) int64 { return r.offsets[partition] }
+
+type snapshot struct {
+	Offsets map[string]int64
+	State   []byte
+}
+
+// Snapshot returns the snapshot of the task with the offsets of the reader.
+func (r *Reader) Snapshot(state []byte) []byte {
+	s := snapshot{Offsets: make(map[string]int64), State: state}
+	for p, offset := range r.offsets {
+		s.Offsets[fmt.Sprint(p)] = offset
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic("stream: snapshot can't be marshaled: " + err.Error())
+	}
+	return b
+}
+
+// Restore restores the offsets kept by Snapshot, and returns the state of the
+// task. Partitions the snapshot doesn't have are read from their beginning.
+func (r *Reader) Restore(b []byte) ([]byte, error) {
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("stream: bad snapshot: %v", err)
+	}
+	for p := range r.offsets {
+		if offset, ok := s.Offsets[fmt.Sprint(p)]; ok {
+			r.offsets[p] = offset
+		}
+	}
+	return s.State, nil
+}
+
+type byPartition []int32
+
+func (ps byPartition) Len() int           { return len(ps) }
+func (ps byPartition) Less(i, j int) bool { return ps[i] < ps[j] }
+func (ps byPartition) Swap(i, j int)      { ps[i], ps[j] = ps[j], ps[i] }
@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAssign(t *testing.T) {
+	tests := []struct {
+		taskID, numOfTasks uint64
+		partitions         int32
+		want               []int32
+	}{
+		{0, 2, 5, []int32{0, 2, 4}},
+		{1, 2, 5, []int32{1, 3}},
+		{2, 3, 2, nil},
+	}
+	for i, tt := range tests {
+		if got := Assign(tt.taskID, tt.numOfTasks, tt.partitions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: Assign = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func values(records []Record) []string {
+	var vs []string
+	for _, r := range records {
+		vs = append(vs, string(r.Value))
+	}
+	return vs
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	paths := []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}
+	appendTo := func(path, s string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewReader(&FileSource{Paths: paths}, 0, 1)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	// b.log doesn't exist yet.
+	appendTo(paths[0], "a1\na2\na3\npartial")
+	records, err := r.Next(2)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if got, want := values(records), []string{"a1", "a2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	appendTo(paths[1], "b1\n")
+	records, err = r.Next(10)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if got, want := values(records), []string{"a3", "b1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	if records[0].Partition != 0 || records[0].Offset != 6 || records[1].Partition != 1 {
+		t.Errorf("records = %+v", records)
+	}
+	appendTo(paths[0], " line\n")
+	records, err = r.Next(10)
+	if got, want := values(records), []string{"partial line"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("records = (%v, %v), want %v", got, err, want)
+	}
+}
+
+// fakeKafka keeps the messages of one topic by partition, at their offsets.
+type fakeKafka map[int32][]Record
+
+func (k fakeKafka) Partitions(topic string) (int32, error) { return int32(len(k)), nil }
+
+func (k fakeKafka) Fetch(topic string, partition int32, offset int64, max int) ([]Record, error) {
+	var records []Record
+	for _, r := range k[partition] {
+		if r.Offset >= offset && len(records) < max {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func TestReaderSnapshot(t *testing.T) {
+	kafka := fakeKafka{
+		0: {{0, 0, []byte("p0-0")}, {0, 3, []byte("p0-3")}},
+		1: {{1, 0, []byte("p1-0")}},
+		2: {{2, 5, []byte("p2-5")}, {2, 6, []byte("p2-6")}},
+	}
+	src := &KafkaSource{Client: kafka, Topic: "events"}
+	r, err := NewReader(src, 0, 2)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if got := r.Partitions(); !reflect.DeepEqual(got, []int32{0, 2}) {
+		t.Errorf("partitions = %v, want [0 2]", got)
+	}
+	records, err := r.Next(1)
+	if got, want := values(records), []string{"p0-0", "p2-5"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("records = (%v, %v), want %v", got, err, want)
+	}
+	snap := r.Snapshot([]byte("state"))
+
+	// Records read after the snapshot are read again by the node taking
+	// over, after the ones before aren't.
+	r.Next(10)
+	r2, err := NewReader(src, 0, 2)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	state, err := r2.Restore(snap)
+	if err != nil || string(state) != "state" {
+		t.Errorf("Restore = (%q, %v), want state", state, err)
+	}
+	records, err = r2.Next(10)
+	if got, want := values(records), []string{"p0-3", "p2-6"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("records after restore = (%v, %v), want %v", got, err, want)
+	}
+	if r2.Offset(0) != 4 || r2.Offset(2) != 7 {
+		t.Errorf("offsets = %d, %d, want 4, 7", r2.Offset(0), r2.Offset(2))
+	}
+	if _, err := r2.Restore([]byte("garbage")); err == nil {
+		t.Errorf("Restore of garbage succeeded")
+	}
+}
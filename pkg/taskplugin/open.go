@@ -0,0 +1,44 @@
+//go:build go1.8
+// +build go1.8
+
+package taskplugin
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// open opens the plugin copied to path, checks its version and only then
+// calls its Register function. Go itself refuses plugins built against other
+// versions of shared packages.
+func open(spec etcdutil.PluginSpec, path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("taskplugin: %s: %v", spec.Path, err)
+	}
+	if spec.Version != "" {
+		sym, err := p.Lookup(VersionSymbol)
+		if err != nil {
+			return fmt.Errorf("taskplugin: %s: %v", spec.Path, err)
+		}
+		version, ok := sym.(*string)
+		if !ok {
+			return fmt.Errorf("taskplugin: %s: %s is %T, want string", spec.Path, VersionSymbol, sym)
+		}
+		if *version != spec.Version {
+			return fmt.Errorf("taskplugin: %s has version %q, want %q", spec.Path, *version, spec.Version)
+		}
+	}
+	sym, err := p.Lookup(RegisterSymbol)
+	if err != nil {
+		return fmt.Errorf("taskplugin: %s: %v", spec.Path, err)
+	}
+	register, ok := sym.(func())
+	if !ok {
+		return fmt.Errorf("taskplugin: %s: %s is %T, want func()", spec.Path, RegisterSymbol, sym)
+	}
+	register()
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !go1.8
+// +build !go1.8
+
+package taskplugin
+
+import "github.com/go-distributed/meritop/pkg/etcdutil"
+
+func open(spec etcdutil.PluginSpec, path string) error { return ErrUnsupported }
@@ -0,0 +1,184 @@
+/*
+Package taskplugin loads task builders and topologies from Go plugins, so that
+a generic worker binary runs applications built after it.
+
+A plugin is a main package built with "go build -buildmode=plugin" against the
+same version of meritop as the worker. It registers what it brings in an
+exported Register function rather than in init, as the worker calls Register
+only once the version of the plugin is checked:
+
+	package main
+
+	import "github.com/go-distributed/meritop"
+
+	var MeritopPluginVersion = "lr-1.2"
+
+	func Register() {
+		meritop.RegisterTaskBuilder("lr", newLRTaskBuilder)
+	}
+
+The job spec names the plugins with the hash of their file, which is checked
+before the plugin runs any code, see etcdutil.PluginSpec. The worker hashes the
+file as it copies it to a private temporary file, and loads the copy, so that
+the file can't be replaced between the check and the load.
+*/
+package taskplugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+const (
+	// VersionSymbol is the string variable a plugin exports to be checked
+	// against the version of its spec.
+	VersionSymbol = "MeritopPluginVersion"
+	// RegisterSymbol is the func() a plugin exports to register its task
+	// builders and topologies.
+	RegisterSymbol = "Register"
+)
+
+// ErrUnsupported is returned by Load where Go can't load plugins.
+var ErrUnsupported = errors.New("taskplugin: Go plugins are not supported by this build")
+
+var loaded = struct {
+	sync.Mutex
+	paths map[string]string
+}{paths: make(map[string]string)}
+
+// Load verifies and opens the plugins in order. A plugin already loaded from
+// the same path is skipped if its hash is the same, as Go can't unload it.
+func Load(specs []etcdutil.PluginSpec) error {
+	loaded.Lock()
+	defer loaded.Unlock()
+	for _, spec := range specs {
+		if sum, ok := loaded.paths[spec.Path]; ok {
+			if !strings.EqualFold(sum, spec.SHA256) {
+				return fmt.Errorf("taskplugin: %s is loaded with sha256 %s, can't load %s", spec.Path, sum, spec.SHA256)
+			}
+			continue
+		}
+		path, err := copyVerified(spec)
+		if err != nil {
+			return err
+		}
+		err = open(spec, path)
+		// The copy stays mapped once opened.
+		os.RemoveAll(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		loaded.paths[spec.Path] = spec.SHA256
+	}
+	return nil
+}
+
+// Verify checks the file of the plugin against the hash of its spec.
+func Verify(spec etcdutil.PluginSpec) error {
+	if spec.SHA256 == "" {
+		return fmt.Errorf("taskplugin: %s has no sha256", spec.Path)
+	}
+	sum, err := FileSHA256(spec.Path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, spec.SHA256) {
+		return fmt.Errorf("taskplugin: %s has sha256 %s, want %s", spec.Path, sum, spec.SHA256)
+	}
+	return nil
+}
+
+// copyVerified copies the file of the plugin to a private temporary directory,
+// hashing what it copies, and returns the path of the copy if the hash matches
+// the spec.
+func copyVerified(spec etcdutil.PluginSpec) (string, error) {
+	if spec.SHA256 == "" {
+		return "", fmt.Errorf("taskplugin: %s has no sha256", spec.Path)
+	}
+	src, err := os.Open(spec.Path)
+	if err != nil {
+		return "", fmt.Errorf("taskplugin: %v", err)
+	}
+	defer src.Close()
+	dir, err := ioutil.TempDir("", "taskplugin")
+	if err != nil {
+		return "", fmt.Errorf("taskplugin: %v", err)
+	}
+	path := filepath.Join(dir, filepath.Base(spec.Path))
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0500)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("taskplugin: %v", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, h), src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("taskplugin: %v", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, spec.SHA256) {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("taskplugin: %s has sha256 %s, want %s", spec.Path, sum, spec.SHA256)
+	}
+	return path, nil
+}
+
+// FileSHA256 returns the hex encoded hash of a file, e.g. for a job spec.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("taskplugin: %v", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("taskplugin: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseSpec parses a plugin given as "path,sha256=hex[,version=v]". Without
+// sha256, the hash of the file at path is taken, e.g. by a controller sharing
+// the file system of the workers.
+func ParseSpec(s string) (etcdutil.PluginSpec, error) {
+	fields := strings.Split(s, ",")
+	spec := etcdutil.PluginSpec{Path: fields[0]}
+	if spec.Path == "" {
+		return spec, fmt.Errorf("taskplugin: plugin %q has no path", s)
+	}
+	for _, field := range fields[1:] {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return spec, fmt.Errorf("taskplugin: plugin %q: %q isn't name=value", s, field)
+		}
+		switch name, value := field[:i], field[i+1:]; name {
+		case "sha256":
+			spec.SHA256 = value
+		case "version":
+			spec.Version = value
+		default:
+			return spec, fmt.Errorf("taskplugin: plugin %q: unknown field %s", s, name)
+		}
+	}
+	if spec.SHA256 == "" {
+		sum, err := FileSHA256(spec.Path)
+		if err != nil {
+			return spec, err
+		}
+		spec.SHA256 = sum
+	}
+	return spec, nil
+}
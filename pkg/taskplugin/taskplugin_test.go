@@ -0,0 +1,106 @@
+package taskplugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-distributed/meritop/pkg/etcdutil"
+)
+
+// a hash of none of the files of the tests
+const otherSum = "0000000000000000000000000000000000000000000000000000000000000000"
+
+func writePlugin(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "taskplugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.so")
+	if err := ioutil.WriteFile(path, []byte("plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestParseSpec(t *testing.T) {
+	path, cleanup := writePlugin(t)
+	defer cleanup()
+	sum, err := FileSHA256(path)
+	if err != nil {
+		t.Fatalf("FileSHA256 failed: %v", err)
+	}
+
+	tests := []struct {
+		s    string
+		want etcdutil.PluginSpec
+	}{
+		{path, etcdutil.PluginSpec{Path: path, SHA256: sum}},
+		{"lr.so,sha256=abc", etcdutil.PluginSpec{Path: "lr.so", SHA256: "abc"}},
+		{"lr.so,sha256=abc,version=1.2", etcdutil.PluginSpec{Path: "lr.so", SHA256: "abc", Version: "1.2"}},
+	}
+	for i, tt := range tests {
+		spec, err := ParseSpec(tt.s)
+		if err != nil || spec != tt.want {
+			t.Errorf("#%d: ParseSpec(%q) = (%+v, %v), want (%+v, nil)", i, tt.s, spec, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", ",sha256=abc", "lr.so,abc", "lr.so,sha256=abc,md5=def", "missing.so"} {
+		if _, err := ParseSpec(s); err == nil {
+			t.Errorf("ParseSpec(%q) should fail", s)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path, cleanup := writePlugin(t)
+	defer cleanup()
+	sum, err := FileSHA256(path)
+	if err != nil {
+		t.Fatalf("FileSHA256 failed: %v", err)
+	}
+
+	if err := Verify(etcdutil.PluginSpec{Path: path, SHA256: sum}); err != nil {
+		t.Errorf("Verify of matching hash failed: %v", err)
+	}
+	for _, spec := range []etcdutil.PluginSpec{
+		{Path: path},
+		{Path: path, SHA256: otherSum},
+		{Path: path + ".missing", SHA256: sum},
+	} {
+		if err := Verify(spec); err == nil {
+			t.Errorf("Verify(%+v) should fail", spec)
+		}
+		// Load verifies the plugin before opening it.
+		if err := Load([]etcdutil.PluginSpec{spec}); err == nil {
+			t.Errorf("Load(%+v) should fail", spec)
+		}
+	}
+}
+
+// The plugin is loaded from the copy that was hashed, whatever happens to its
+// file afterwards.
+func TestCopyVerified(t *testing.T) {
+	path, cleanup := writePlugin(t)
+	defer cleanup()
+	sum, err := FileSHA256(path)
+	if err != nil {
+		t.Fatalf("FileSHA256 failed: %v", err)
+	}
+
+	cp, err := copyVerified(etcdutil.PluginSpec{Path: path, SHA256: sum})
+	if err != nil {
+		t.Fatalf("copyVerified failed: %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(cp))
+	if err := ioutil.WriteFile(path, []byte("replaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(cp); err != nil || string(b) != "plugin" {
+		t.Errorf("copy = (%q, %v), want %q", b, err, "plugin")
+	}
+	if _, err := copyVerified(etcdutil.PluginSpec{Path: path, SHA256: sum}); err == nil {
+		t.Errorf("copyVerified of replaced file should fail")
+	}
+}
@@ -0,0 +1,81 @@
+package topoutil
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-distributed/meritop"
+)
+
+// CycleError tells that a task is its own ancestor by parent links, which
+// malformed custom topologies can do. Meta and data flowing up such a tree
+// would never reach a root.
+type CycleError struct {
+	Epoch uint64
+	// Cycle goes from the task, parent after parent, back to the task.
+	Cycle []uint64
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("topology: task %d is its own ancestor at epoch %d: %s", e.Cycle[0], e.Epoch, e.path())
+}
+
+// path is the cycle as "1 -> 2 -> 1".
+func (e *CycleError) path() string {
+	ids := make([]string, len(e.Cycle))
+	for i, id := range e.Cycle {
+		ids[i] = strconv.FormatUint(id, 10)
+	}
+	return strings.Join(ids, " -> ")
+}
+
+// CheckAncestors returns a *CycleError if task taskID is its own ancestor at
+// the given epoch. It follows parent links on a private copy of the topology,
+// see private, so that the tasks of the node may query the topology meanwhile.
+func CheckAncestors(t meritop.Topology, taskID, epoch uint64) error {
+	t = private(t)
+	defer t.SetTaskID(taskID)
+	visited := make(map[uint64]bool)
+	var path []uint64
+	var visit func(id uint64) []uint64
+	visit = func(id uint64) []uint64 {
+		path = append(path, id)
+		defer func() { path = path[:len(path)-1] }()
+		t.SetTaskID(id)
+		for _, parent := range t.GetNeighbors(meritop.LinkParent, epoch) {
+			if parent == taskID {
+				return append(append([]uint64(nil), path...), taskID)
+			}
+			if visited[parent] {
+				continue
+			}
+			visited[parent] = true
+			if cycle := visit(parent); cycle != nil {
+				return cycle
+			}
+			t.SetTaskID(id)
+		}
+		return nil
+	}
+	if cycle := visit(taskID); cycle != nil {
+		return &CycleError{Epoch: epoch, Cycle: cycle}
+	}
+	return nil
+}
+
+// private returns a copy of the topology to set the IDs of other tasks on.
+// Topologies are pointers to structs keeping the task ID in a field, of which
+// a shallow copy keeps its own; one keeping it behind another pointer, e.g.
+// wrapping another topology, should be checked on an instance of its own.
+// Others are returned as is.
+func private(t meritop.Topology) meritop.Topology {
+	v := reflect.ValueOf(t)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return t
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(meritop.Topology)
+}
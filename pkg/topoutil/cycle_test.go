@@ -0,0 +1,72 @@
+package topoutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+)
+
+// parentMap is a topology with parents given by a map.
+type parentMap struct {
+	parents map[uint64][]uint64
+	taskID  uint64
+	// number of times the task ID is set
+	sets int
+}
+
+func (t *parentMap) SetTaskID(taskID uint64)                   { t.taskID, t.sets = taskID, t.sets+1 }
+func (t *parentMap) SetNumberOfTasks(uint64)                   {}
+func (t *parentMap) GetLinkTypes() []string                    { return []string{meritop.LinkParent} }
+func (t *parentMap) GetReverseLinkType(linkType string) string { return meritop.LinkChild }
+func (t *parentMap) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	if linkType != meritop.LinkParent {
+		return nil
+	}
+	return t.parents[t.taskID]
+}
+
+func TestCheckAncestors(t *testing.T) {
+	tree := example.NewTreeTopology(2, 7)
+	for id := uint64(0); id < 7; id++ {
+		tree.SetTaskID(id)
+		if err := CheckAncestors(tree, id, 0); err != nil {
+			t.Errorf("task %d of a tree: %v", id, err)
+		}
+	}
+
+	// 1 -> 2 -> 3 -> 1, and 4 under the cycle; 5 has two parents joining at 0
+	topo := &parentMap{parents: map[uint64][]uint64{
+		1: {2}, 2: {3}, 3: {1}, 4: {1}, 5: {6, 7}, 6: {0}, 7: {0},
+	}}
+	tests := []struct {
+		taskID uint64
+		cycle  []uint64
+	}{
+		{1, []uint64{1, 2, 3, 1}},
+		{3, []uint64{3, 1, 2, 3}},
+		{4, nil},
+		{5, nil},
+		{0, nil},
+	}
+	for _, tt := range tests {
+		topo.SetTaskID(tt.taskID)
+		sets := topo.sets
+		err := CheckAncestors(topo, tt.taskID, 2)
+		if tt.cycle == nil {
+			if err != nil {
+				t.Errorf("task %d: %v", tt.taskID, err)
+			}
+		} else if ce, ok := err.(*CycleError); !ok || !reflect.DeepEqual(ce.Cycle, tt.cycle) || ce.Epoch != 2 {
+			t.Errorf("task %d: err = %v, want cycle %v", tt.taskID, err, tt.cycle)
+		}
+		// The tasks of the node query the topology meanwhile.
+		if topo.taskID != tt.taskID || topo.sets != sets {
+			t.Errorf("task %d: task ID set %d times, left at %d", tt.taskID, topo.sets-sets, topo.taskID)
+		}
+	}
+	if s := (&CycleError{Epoch: 2, Cycle: []uint64{1, 2, 1}}).Error(); s != "topology: task 1 is its own ancestor at epoch 2: 1 -> 2 -> 1" {
+		t.Errorf("error = %q", s)
+	}
+}
@@ -0,0 +1,37 @@
+package topoutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/go-distributed/meritop"
+)
+
+// WriteDOT writes the topology of numTasks tasks at the given epoch as a
+// Graphviz DOT digraph, e.g. to render with "dot -Tsvg". Each link is an edge
+// labeled by its type; of a link and its reverse, only the one from the task
+// of the lower ID is drawn. Like Validate, it sets the number of tasks and
+// the ID of each task on a private copy of the topology.
+func WriteDOT(w io.Writer, t meritop.Topology, numTasks, epoch uint64) error {
+	t = private(t)
+	t.SetNumberOfTasks(numTasks)
+	all := links(t, numTasks, epoch)
+	has := make(map[link]bool, len(all))
+	for _, l := range all {
+		has[l] = true
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph topology {\n\tlabel=\"epoch %d\";\n", epoch)
+	for id := uint64(0); id < numTasks; id++ {
+		fmt.Fprintf(bw, "\t%d;\n", id)
+	}
+	for _, l := range all {
+		if l.To < l.From && has[link{l.To, l.From, t.GetReverseLinkType(l.Type)}] {
+			continue
+		}
+		fmt.Fprintf(bw, "\t%d -> %d [label=%q];\n", l.From, l.To, l.Type)
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
@@ -3,7 +3,7 @@ package topoutil
 import "github.com/go-distributed/meritop"
 
 func IsParent(t meritop.Topology, epoch, taskID uint64) bool {
-	for _, id := range t.GetParents(epoch) {
+	for _, id := range t.GetNeighbors(meritop.LinkParent, epoch) {
 		if taskID == id {
 			return true
 		}
@@ -12,10 +12,24 @@ func IsParent(t meritop.Topology, epoch, taskID uint64) bool {
 }
 
 func IsChild(t meritop.Topology, epoch, taskID uint64) bool {
-	for _, id := range t.GetChildren(epoch) {
+	for _, id := range t.GetNeighbors(meritop.LinkChild, epoch) {
 		if taskID == id {
 			return true
 		}
 	}
 	return false
 }
+
+// GetLinkType returns the type of link connecting this task to given task at
+// the given epoch. If they are connected by more than one link, e.g. in a ring
+// of two, the first link type returned by GetLinkTypes wins.
+func GetLinkType(t meritop.Topology, epoch, taskID uint64) (string, bool) {
+	for _, linkType := range t.GetLinkTypes() {
+		for _, id := range t.GetNeighbors(linkType, epoch) {
+			if taskID == id {
+				return linkType, true
+			}
+		}
+	}
+	return "", false
+}
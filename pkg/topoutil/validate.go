@@ -0,0 +1,127 @@
+package topoutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-distributed/meritop"
+)
+
+// link is a link of type Type from task From to task To.
+type link struct {
+	From, To uint64
+	Type     string
+}
+
+// links returns the links of all tasks at the given epoch, setting the ID of
+// each task on the topology in turn.
+func links(t meritop.Topology, numTasks, epoch uint64) []link {
+	var all []link
+	for id := uint64(0); id < numTasks; id++ {
+		t.SetTaskID(id)
+		for _, linkType := range t.GetLinkTypes() {
+			for _, to := range t.GetNeighbors(linkType, epoch) {
+				all = append(all, link{id, to, linkType})
+			}
+		}
+	}
+	return all
+}
+
+// ValidationError lists what is wrong with a topology, each problem one
+// sentence naming the tasks.
+type ValidationError struct {
+	Epoch    uint64
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("topology: invalid at epoch %d: %s", e.Epoch, strings.Join(e.Problems, "; "))
+}
+
+// Validate checks the topology of numTasks tasks at the given epoch, which
+// otherwise shows as a job silently waiting for meta or data that never come:
+//   - links go to existing tasks other than the task itself
+//   - the other end of every link sees it, by the reverse link type
+//   - no task is its own ancestor by parent links, see CheckAncestors
+//   - every task is linked, and all tasks are reachable from task 0 by links;
+//     topologies splitting tasks into groups at each epoch, e.g. random pairs,
+//     fail this on purpose
+//
+// It returns a *ValidationError listing the problems found. It sets the
+// number of tasks and the ID of each task on a private copy of the topology,
+// like CheckAncestors, leaving the topology as it is.
+func Validate(t meritop.Topology, numTasks, epoch uint64) error {
+	t = private(t)
+	t.SetNumberOfTasks(numTasks)
+	all := links(t, numTasks, epoch)
+	var problems []string
+
+	has := make(map[link]bool, len(all))
+	for _, l := range all {
+		has[l] = true
+	}
+	adjacent := make(map[uint64][]uint64)
+	linked := make(map[uint64]bool)
+	outOfRange := false
+	for _, l := range all {
+		linked[l.From], linked[l.To] = true, true
+		switch {
+		case l.To >= numTasks:
+			problems = append(problems, fmt.Sprintf("task %d has %s %d, beyond the %d tasks", l.From, l.Type, l.To, numTasks))
+			outOfRange = true
+			continue
+		case l.To == l.From:
+			problems = append(problems, fmt.Sprintf("task %d is its own %s", l.From, l.Type))
+			continue
+		}
+		if reverse := t.GetReverseLinkType(l.Type); !has[link{l.To, l.From, reverse}] {
+			problems = append(problems, fmt.Sprintf("task %d has %s %d, which doesn't have it as %s", l.From, l.Type, l.To, reverse))
+		}
+		adjacent[l.From] = append(adjacent[l.From], l.To)
+		adjacent[l.To] = append(adjacent[l.To], l.From)
+	}
+
+	// Parents beyond the tasks can't be followed.
+	for id := uint64(0); id < numTasks && !outOfRange; id++ {
+		if err := CheckAncestors(t, id, epoch); err != nil {
+			ce := err.(*CycleError)
+			problems = append(problems, fmt.Sprintf("task %d is its own ancestor: %s", ce.Cycle[0], ce.path()))
+			// The other tasks of the cycle would report it again.
+			break
+		}
+	}
+
+	var orphans, unreachable []uint64
+	reached := map[uint64]bool{0: true}
+	queue := []uint64{0}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacent[id] {
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	for id := uint64(0); id < numTasks && numTasks > 1; id++ {
+		switch {
+		case !linked[id]:
+			orphans = append(orphans, id)
+		case !reached[id]:
+			unreachable = append(unreachable, id)
+		}
+	}
+	if len(orphans) > 0 {
+		problems = append(problems, fmt.Sprintf("tasks %v have no links", orphans))
+	}
+	if len(unreachable) > 0 {
+		problems = append(problems, fmt.Sprintf("tasks %v aren't reachable from task 0", unreachable))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Epoch: epoch, Problems: problems}
+}
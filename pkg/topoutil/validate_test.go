@@ -0,0 +1,98 @@
+package topoutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/go-distributed/meritop"
+	"github.com/go-distributed/meritop/example"
+)
+
+// linkMap is a topology with parent and child links given by maps.
+type linkMap struct {
+	parents, children map[uint64][]uint64
+	taskID            uint64
+}
+
+func (t *linkMap) SetTaskID(taskID uint64) { t.taskID = taskID }
+func (t *linkMap) SetNumberOfTasks(uint64) {}
+func (t *linkMap) GetLinkTypes() []string  { return []string{meritop.LinkParent, meritop.LinkChild} }
+func (t *linkMap) GetReverseLinkType(linkType string) string {
+	if linkType == meritop.LinkParent {
+		return meritop.LinkChild
+	}
+	return meritop.LinkParent
+}
+func (t *linkMap) GetNeighbors(linkType string, epoch uint64) []uint64 {
+	if linkType == meritop.LinkParent {
+		return t.parents[t.taskID]
+	}
+	return t.children[t.taskID]
+}
+
+func TestValidate(t *testing.T) {
+	valid := map[string]meritop.Topology{
+		"tree": example.NewTreeTopology(2, 7),
+		"ring": example.NewRingTopology(7),
+		"ps":   example.NewParameterServerTopology(2, 5),
+	}
+	for name, topo := range valid {
+		if err := Validate(topo, 7, 3); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// Pairs are apart by design.
+	err := Validate(example.NewRandomPairTopology(1, 6), 6, 3)
+	if ve, ok := err.(*ValidationError); !ok || len(ve.Problems) != 1 {
+		t.Errorf("random pairs: err = %v, want tasks not reachable", err)
+	}
+
+	tests := []struct {
+		topo     *linkMap
+		problems []string
+	}{{
+		// 2 is a child of 0 which doesn't know it; 3 has no links.
+		&linkMap{parents: map[uint64][]uint64{1: {0}, 2: {0}}, children: map[uint64][]uint64{0: {1}}},
+		[]string{"task 2 has parent 0, which doesn't have it as child", "tasks [3] have no links"},
+	}, {
+		// 0 and 1 are each other's parent; 2 and 3 are apart.
+		&linkMap{
+			parents:  map[uint64][]uint64{0: {1}, 1: {0}, 3: {2}},
+			children: map[uint64][]uint64{0: {1}, 1: {0}, 2: {3}},
+		},
+		[]string{"task 0 is its own ancestor: 0 -> 1 -> 0", "tasks [2 3] aren't reachable from task 0"},
+	}, {
+		&linkMap{parents: map[uint64][]uint64{1: {9}, 2: {2}}, children: map[uint64][]uint64{}},
+		[]string{"task 1 has parent 9, beyond the 4 tasks", "task 2 is its own parent",
+			"tasks [0 3] have no links", "tasks [1 2] aren't reachable from task 0"},
+	}}
+	for i, tt := range tests {
+		err := Validate(tt.topo, 4, 3)
+		if ve, ok := err.(*ValidationError); !ok || ve.Epoch != 3 || !reflect.DeepEqual(ve.Problems, tt.problems) {
+			t.Errorf("#%d: err = %v, want problems %q", i, err, tt.problems)
+		}
+		if tt.topo.taskID != 0 {
+			t.Errorf("#%d: task ID of the topology set to %d", i, tt.topo.taskID)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, example.NewTreeTopology(2, 3), 3, 0); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	want := `digraph topology {
+	label="epoch 0";
+	0;
+	1;
+	2;
+	0 -> 1 [label="child"];
+	0 -> 2 [label="child"];
+}
+`
+	if buf.String() != want {
+		t.Errorf("DOT =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,144 @@
+package meritop
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Params are the settings of a registered task builder or topology, given as
+// name=value pairs. Params is a flag.Value, so that "-param name=value" can be
+// repeated.
+type Params map[string]string
+
+func (p Params) String() string {
+	pairs := make([]string, 0, len(p))
+	for name, value := range p {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set sets a param given as name=value.
+func (p Params) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("param %q isn't name=value", s)
+	}
+	p[s[:i]] = s[i+1:]
+	return nil
+}
+
+// Uint returns the param of given name, or def if it isn't set.
+func (p Params) Uint(name string, def uint64) (uint64, error) {
+	s, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("param %s: %v", name, err)
+	}
+	return v, nil
+}
+
+// Float returns the param of given name, or def if it isn't set.
+func (p Params) Float(name string, def float64) (float64, error) {
+	s, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("param %s: %v", name, err)
+	}
+	return v, nil
+}
+
+// TaskBuilderFactory creates the task builder of a job of numOfTasks tasks.
+type TaskBuilderFactory func(numOfTasks uint64, params Params) (TaskBuilder, error)
+
+// TopologyFactory creates the topology of a job of numOfTasks tasks.
+type TopologyFactory func(numOfTasks uint64, params Params) (Topology, error)
+
+var registry = struct {
+	sync.Mutex
+	taskBuilders map[string]TaskBuilderFactory
+	topologies   map[string]TopologyFactory
+}{
+	taskBuilders: make(map[string]TaskBuilderFactory),
+	topologies:   make(map[string]TopologyFactory),
+}
+
+// RegisterTaskBuilder makes a task builder available by name, so that a
+// generic worker binary selects the application of a job on its command line.
+// Packages register theirs in init, like database/sql drivers, and binaries
+// import them for the side effect. It panics if the name is taken.
+func RegisterTaskBuilder(name string, factory TaskBuilderFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.taskBuilders[name]; ok {
+		panic("meritop: task builder " + name + " is registered twice")
+	}
+	registry.taskBuilders[name] = factory
+}
+
+// RegisterTopology makes a topology available by name. It panics if the name
+// is taken.
+func RegisterTopology(name string, factory TopologyFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.topologies[name]; ok {
+		panic("meritop: topology " + name + " is registered twice")
+	}
+	registry.topologies[name] = factory
+}
+
+// NewTaskBuilder creates the task builder registered by name.
+func NewTaskBuilder(name string, numOfTasks uint64, params Params) (TaskBuilder, error) {
+	registry.Lock()
+	factory, ok := registry.taskBuilders[name]
+	registry.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("meritop: unknown task builder %q (registered: %s)", name, strings.Join(TaskBuilders(), ", "))
+	}
+	return factory(numOfTasks, params)
+}
+
+// NewTopology creates the topology registered by name.
+func NewTopology(name string, numOfTasks uint64, params Params) (Topology, error) {
+	registry.Lock()
+	factory, ok := registry.topologies[name]
+	registry.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("meritop: unknown topology %q (registered: %s)", name, strings.Join(Topologies(), ", "))
+	}
+	return factory(numOfTasks, params)
+}
+
+// TaskBuilders returns the sorted names of registered task builders.
+func TaskBuilders() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.taskBuilders))
+	for name := range registry.taskBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Topologies returns the sorted names of registered topologies.
+func Topologies() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.topologies))
+	for name := range registry.topologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
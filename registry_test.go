@@ -0,0 +1,57 @@
+package meritop
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	p := Params{}
+	for _, s := range []string{"fanout=3", "rate=0.1", "fanout=4", "empty="} {
+		if err := p.Set(s); err != nil {
+			t.Fatalf("Set(%q) failed: %v", s, err)
+		}
+	}
+	if err := p.Set("=1"); err == nil {
+		t.Errorf("Set(%q) succeeded", "=1")
+	}
+	if s := p.String(); s != "empty=,fanout=4,rate=0.1" {
+		t.Errorf("params = %q", s)
+	}
+	if v, err := p.Uint("fanout", 2); err != nil || v != 4 {
+		t.Errorf("fanout = %d, %v, want 4", v, err)
+	}
+	if v, err := p.Uint("servers", 1); err != nil || v != 1 {
+		t.Errorf("servers = %d, %v, want default 1", v, err)
+	}
+	if _, err := p.Uint("rate", 1); err == nil {
+		t.Errorf("rate parsed as uint")
+	}
+	if v, err := p.Float("rate", 0.5); err != nil || v != 0.1 {
+		t.Errorf("rate = %v, %v, want 0.1", v, err)
+	}
+}
+
+type registryTestBuilder uint64
+
+func (registryTestBuilder) GetTask(taskID uint64) Task { return nil }
+
+func TestRegisterTaskBuilder(t *testing.T) {
+	RegisterTaskBuilder("TestRegisterTaskBuilder", func(numOfTasks uint64, params Params) (TaskBuilder, error) {
+		return registryTestBuilder(numOfTasks), nil
+	})
+	b, err := NewTaskBuilder("TestRegisterTaskBuilder", 3, nil)
+	if err != nil || !reflect.DeepEqual(b, registryTestBuilder(3)) {
+		t.Errorf("NewTaskBuilder = %v, %v, want %v", b, err, registryTestBuilder(3))
+	}
+	if _, err := NewTaskBuilder("TestRegisterTaskBuilder-unknown", 3, nil); err == nil {
+		t.Errorf("unknown task builder created")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a name twice didn't panic")
+		}
+	}()
+	RegisterTaskBuilder("TestRegisterTaskBuilder", nil)
+}
@@ -10,3 +10,17 @@ type TaskBuilder interface {
 	// right task implementation for given node/task.
 	GetTask(taskID uint64) Task
 }
+
+// PhasedTaskBuilder is an interface that task builders can implement to run
+// another task at some epochs, e.g. a final evaluation epoch after training
+// epochs. When the task changes, the framework inits the new one, restores the
+// snapshot of the current one into it if both are Checkpointers, and calls
+// Exit of the current one.
+type PhasedTaskBuilder interface {
+	TaskBuilder
+
+	// GetEpochTask is called before SetEpoch of every epoch, with the task
+	// running so far, which is the one of GetTask at first. It returns the task
+	// running given epoch, or nil to keep the current one.
+	GetEpochTask(taskID, epoch uint64, current Task) Task
+}
@@ -1,5 +1,7 @@
 package meritop
 
+import "errors"
+
 // Task is a logic repersentation of a computing unit.
 // Each task contain at least one Node.
 // Each task has exact one master Node and might have multiple salve Nodes.
@@ -16,15 +18,15 @@ type Task interface {
 	SetEpoch(epoch uint64)
 
 	// NOTE: the meta/data ready notifications follow at-least-once fault
-	// tolerance semantics
-	ParentMetaReady(parentID uint64, meta string)
-	ChildMetaReady(childID uint64, meta string)
-	ParentDataReady(parentID uint64, req string, resp []byte)
-	ChildDataReady(childID uint64, req string, resp []byte)
+	// tolerance semantics.
+	// linkType tells how the sender is linked to this task, e.g. LinkParent
+	// if the meta or data comes from a parent of this task.
+	MetaReady(fromID uint64, linkType, meta string)
+	DataReady(fromID uint64, linkType, req string, resp []byte)
 
-	// These are payload for application purpose.
-	ServeAsParent(fromID uint64, req string) []byte
-	ServeAsChild(fromID uint64, req string) []byte
+	// This is payload for application purpose. linkType tells how the
+	// requester is linked to this task, e.g. LinkChild when serving a child.
+	Serve(fromID uint64, linkType, req string) []byte
 }
 
 type UpdateLog interface {
@@ -42,3 +44,195 @@ type Backupable interface {
 	// one update the state of copy.
 	Update(log UpdateLog)
 }
+
+// Checkpointer is an interface that task can implement if they want framework
+// to persist their state periodically. When a task is taken over by a new node
+// after failure, the latest snapshot is restored so that the task doesn't need
+// to recompute from scratch.
+type Checkpointer interface {
+	// Snapshot returns the serialized state of the task. It is called at
+	// epoch boundary, before SetEpoch of the new epoch.
+	Snapshot() []byte
+
+	// Restore brings the task back to the snapshotted state. It is called after
+	// Init and before SetEpoch.
+	Restore(snapshot []byte)
+}
+
+// BarrierWaiter is an interface that task can implement to synchronize with
+// other tasks within an epoch, see Framework.EnterBarrier.
+type BarrierWaiter interface {
+	// BarrierReady is called once all tasks of the epoch have entered the
+	// named barrier.
+	BarrierReady(name string)
+}
+
+// MetaGatherer is an interface that the root of a tree topology can implement
+// to collect the acknowledgements of a broadcast, see
+// Framework.FlagMetaBroadcast and Framework.GatherMeta.
+type MetaGatherer interface {
+	// MetaGathered is called once all tasks have gathered meta in current
+	// epoch, with the meta keyed by task ID.
+	MetaGathered(metas map[uint64]string)
+}
+
+// Observable is an interface that task can implement to expose data, e.g. the
+// current model, to observers. Observers join a running job for inspection or
+// ad hoc evaluation; they never claim tasks or affect epochs.
+type Observable interface {
+	ServeAsObserver(req string) []byte
+}
+
+// StaleMessageObserver is an interface that task can implement to learn of
+// meta and data the framework drops as they are of another epoch than the one
+// the task runs, e.g. to tell slow neighbors apart. Such messages never reach
+// MetaReady or DataReady.
+type StaleMessageObserver interface {
+	// StaleMessage is called with the sender, the kind of the message, "meta"
+	// or "data", and the epoch it was sent at.
+	StaleMessage(fromID uint64, kind string, epoch uint64)
+}
+
+// InvalidDataObserver is an interface that task can implement to learn of
+// data responses the framework drops as they break the schema of their
+// request (see framework.WithSchema), e.g. to fail fast. Such responses never
+// reach DataReady.
+type InvalidDataObserver interface {
+	InvalidData(fromID uint64, req string, err error)
+}
+
+// PeerFailureObserver is an interface that task can implement to learn of
+// other tasks failing in current epoch, i.e. the claim of their node expired,
+// e.g. to skip the gradient of a dead child instead of waiting for a standby
+// node to take over. Tasks drained or removed by scaling down don't fail.
+type PeerFailureObserver interface {
+	PeerFailed(taskID uint64)
+}
+
+// MessageReceiver is an interface that task can implement to take the
+// messages other tasks send with Framework.SendMessage. Messages aren't bound
+// to epochs, and are taken in any state of the task.
+type MessageReceiver interface {
+	MessageReady(fromID uint64, payload []byte)
+}
+
+// PushReceiver is an interface that task can implement to take the pushes
+// other tasks send with Framework.Push. Unlike messages, pushes are bound to
+// the epoch they are sent at: the task takes all pushes of an epoch before it
+// moves to the next one, i.e. PushReady returns before SetEpoch of the next
+// epoch is called. PushReady shouldn't wait on other tasks, as the task can't
+// move on until it returns.
+type PushReceiver interface {
+	PushReady(fromID uint64, payload []byte)
+}
+
+// PushFailureReceiver is an interface that task can implement to learn of its
+// pushes which weren't taken within their epoch, e.g. as the receiver had
+// moved on. Failed pushes are kept as dead letters otherwise.
+type PushFailureReceiver interface {
+	PushFailed(toID, epoch uint64, payload []byte, err error)
+}
+
+// ConfigObserver is an interface that task can implement to learn of changes
+// of the config of the job, see Framework.GetJobConfig, e.g. to pick up a new
+// learning rate without restarting.
+type ConfigObserver interface {
+	ConfigChanged(config map[string]string)
+}
+
+// ShardReceiver is an interface that task can implement to take the shards
+// assigned to it in current epoch, see Framework.AssignShards. ShardAssigned
+// is called with all shards of the task once the assignment is published,
+// and again if it changes within the epoch, e.g. as the shards of a failed
+// task are reassigned.
+type ShardReceiver interface {
+	ShardAssigned(shards []string)
+}
+
+// ErrNotReady is returned by ErrorServer for data which isn't ready yet. The
+// requester retries later within the epoch, as with a busy server.
+var ErrNotReady = errors.New("data not ready")
+
+// ErrorServer is an interface that task can implement to fail data requests,
+// e.g. for a request it doesn't know, instead of serving them bytes. Its
+// ServeWithError is called instead of Serve. The error goes back to the
+// requester, see DataErrorReceiver.
+type ErrorServer interface {
+	ServeWithError(fromID uint64, linkType, req string) ([]byte, error)
+}
+
+// ErrPending is returned by DeferredServer for requests it responds to later.
+var ErrPending = errors.New("response pending")
+
+// DeferredServer is an interface that task can implement to respond to data
+// requests later, e.g. once its gradient is computed, rather than turning them
+// away for requesters to poll. ServeDeferred is called instead of Serve and
+// ServeWithError, with the ID of the request. Returning ErrPending defers the
+// response until Framework.Respond with the ID; other errors are those of
+// ErrorServer. Requests still pending at the end of their epoch fail, and
+// requesters drop them.
+type DeferredServer interface {
+	ServeDeferred(requestID, fromID uint64, linkType, req string) ([]byte, error)
+}
+
+// Payload is data in a buffer the task owns, e.g. memory pinned through cgo
+// for a GPU, which the framework uses in place instead of copying it.
+// Release, if not nil, hands the buffer back once the framework is done
+// with it.
+type Payload struct {
+	Data    []byte
+	Release func()
+}
+
+// PayloadServer is an interface that task can implement to serve data out of
+// its own buffers. ServePayload is called instead of Serve and
+// ServeWithError, and the framework writes the data of the payload to the
+// requester as it is, then releases it, whether it was sent or not.
+type PayloadServer interface {
+	ServePayload(fromID uint64, linkType, req string) (Payload, error)
+}
+
+// PayloadReceiver is an interface that task can implement to receive data
+// into its own buffers rather than into []byte of the framework.
+// PayloadBuffer is called off the event loop, before the data of a request
+// of the task is read, with its size; a payload without Data leaves the
+// buffer to the framework. Data is read into the buffer in place, and
+// DataReady takes it, and the buffer with it. If the data is dropped
+// instead, e.g. as its epoch is over, the framework releases the buffer.
+// Buffers are only asked for plain data requests, not for calls, typed data
+// or collectives, and data which is compressed, or sent in parallel streams,
+// is received as usual.
+type PayloadReceiver interface {
+	PayloadBuffer(toID uint64, req string, size int) Payload
+}
+
+// DataErrorReceiver is an interface that task can implement to learn of its
+// data requests which the other task failed (see ErrorServer), with the error
+// of the other task. Such requests never reach DataReady.
+type DataErrorReceiver interface {
+	DataFailed(fromID uint64, linkType, req string, err error)
+}
+
+// CallReceiver is an interface that task can implement to take the results
+// of its calls of the handlers of other tasks, see Framework.Call. err is
+// that of the handler, or of the call, e.g. frameworkhttp.ErrNoHandler.
+type CallReceiver interface {
+	CallReady(fromID uint64, name string, args, result []byte, err error)
+}
+
+// PhaseObserver is an interface that task can implement to learn of the
+// phases of the job, e.g. setup, train, evaluate and export (see
+// framework.WithPhases). PhaseChanged is called before SetEpoch of the first
+// epoch of every phase, and of the first epoch the node runs.
+type PhaseObserver interface {
+	PhaseChanged(phase string)
+}
+
+// AdaptedTask is implemented by tasks adapting a task written against
+// another API, e.g. an older version of meritop (see compat/v1). The
+// framework looks for the optional interfaces above, e.g. Checkpointer, on
+// the adapted task.
+type AdaptedTask interface {
+	Task
+	Adapted() interface{}
+}
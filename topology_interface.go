@@ -6,8 +6,8 @@ a. At beginning of the framework initialization for each task, framework
    call the SetTaskID so that the singleton Topology knows which taskID it
    represents.
 b. At beginning of each epoch, the framework implementation (on each task)
-   will call GetParents and GetChildren with given epoch, so that it knows
-   how to setup watcher for node failures.
+   will call GetNeighbors for each of its link types with given epoch, so
+   that it knows how to setup watcher for node failures.
 */
 package meritop
 
@@ -19,14 +19,46 @@ type Topology interface {
 	// we can get the local topology for each epoch later.
 	SetTaskID(taskID uint64)
 
-	// GetParents returns the parents' IDs of this task at the
-	// given epoch.
-	GetParents(epoch uint64) []uint64
+	// GetLinkTypes returns all the types of links this topology uses to
+	// connect tasks, e.g. LinkParent and LinkChild for a tree.
+	GetLinkTypes() []string
 
-	// GetChlidren returns the children's IDs of this task at the
-	// given epoch.
-	GetChildren(epoch uint64) []uint64
+	// GetReverseLinkType returns how the other end sees a link. If task A
+	// has B as its LinkChild, then B has A as its LinkParent.
+	GetReverseLinkType(linkType string) string
+
+	// GetNeighbors returns the IDs of tasks linked to this task with the
+	// given link type at the given epoch. Meta flags and data requests are
+	// routed along these links.
+	GetNeighbors(linkType string, epoch uint64) []uint64
 
 	// Inform the new NumberOfTasks, this allow the number of tasks to change.
 	SetNumberOfTasks(numOfTasks uint64)
 }
+
+// Link types used by the topologies shipped with meritop. Applications can
+// define their own link types in their topology implementation.
+const (
+	LinkParent = "parent"
+	LinkChild  = "child"
+	LinkPrev   = "prev"
+	LinkNext   = "next"
+	LinkServer = "server"
+	LinkWorker = "worker"
+	LinkPeer   = "peer"
+	LinkUp     = "up"
+	LinkDown   = "down"
+	LinkLeft   = "left"
+	LinkRight  = "right"
+)
+
+// MetaBroadcast is the linkType of MetaReady for meta broadcast by
+// Framework.FlagMetaBroadcast. It isn't a link type of topologies.
+const MetaBroadcast = "broadcast"
+
+// SeededTopology is implemented by randomized topologies, e.g. ones pairing
+// tasks randomly at each epoch. Framework sets the same job-wide seed on every
+// task, so that all tasks compute the same topology.
+type SeededTopology interface {
+	SetSeed(seed int64)
+}